@@ -0,0 +1,300 @@
+// Package bbolt_adaptor implements the key/value interfaces of the trie on top of the bbolt embedded database.
+// It is the persistent store for embedded deployments, where badger is too heavy
+package bbolt_adaptor
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/iotaledger/trie.go/trie"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltKVStore maps a bucket of the bbolt database to trie.KVStore. Each Set is a separate transaction,
+// so updates should be written with BoltBatch or BoltBatchedUpdater. Keys are iterated in the byte order.
+// Methods of trie.KVStore panic on errors of the database. Methods with the 'Try' prefix return those errors instead
+type BoltKVStore struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+var (
+	_ trie.KVStore          = &BoltKVStore{}
+	_ trie.KVPrefixIterator = &BoltKVStore{}
+	_ trie.BatchWriter      = &BoltKVStore{}
+)
+
+var errNoBucket = errors.New("bbolt_adaptor: bucket does not exist")
+
+// NewBoltKVStore creates a new KVStore in the bucket of the database. The bucket is created if it does not exist
+func NewBoltKVStore(db *bolt.DB, bucket []byte) (*BoltKVStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltKVStore{db: db, bucket: bucket}, nil
+}
+
+// DB returns the underlying database
+func (s *BoltKVStore) DB() *bolt.DB {
+	return s.db
+}
+
+func mustNoErr(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (s *BoltKVStore) view(fun func(b *bolt.Bucket) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return errNoBucket
+		}
+		return fun(b)
+	})
+}
+
+func (s *BoltKVStore) update(fun func(b *bolt.Bucket) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		if b == nil {
+			return errNoBucket
+		}
+		return fun(b)
+	})
+}
+
+func (s *BoltKVStore) Get(key []byte) []byte {
+	v, err := s.TryGet(key)
+	mustNoErr(err)
+	return v
+}
+
+// TryGet is Get which returns error of the database. Absence of the key is not an error
+func (s *BoltKVStore) TryGet(key []byte) ([]byte, error) {
+	var ret []byte
+	err := s.view(func(b *bolt.Bucket) error {
+		// the value is valid only during the transaction
+		if v := b.Get(key); len(v) > 0 {
+			ret = trie.Concat(v)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+func (s *BoltKVStore) Has(key []byte) bool {
+	ret, err := s.TryHas(key)
+	mustNoErr(err)
+	return ret
+}
+
+// TryHas is Has which returns error of the database
+func (s *BoltKVStore) TryHas(key []byte) (bool, error) {
+	var ret bool
+	err := s.view(func(b *bolt.Bucket) error {
+		ret = len(b.Get(key)) > 0
+		return nil
+	})
+	return ret, err
+}
+
+func (s *BoltKVStore) Set(key, value []byte) {
+	mustNoErr(s.TrySet(key, value))
+}
+
+// TrySet is Set which returns error of the database
+func (s *BoltKVStore) TrySet(key, value []byte) error {
+	return s.update(func(b *bolt.Bucket) error {
+		return set(b, key, value)
+	})
+}
+
+func set(b *bolt.Bucket, key, value []byte) error {
+	if len(value) == 0 {
+		return b.Delete(key)
+	}
+	return b.Put(key, value)
+}
+
+// Iterate iterates all key/value pairs of the bucket in the order of keys.
+// Iteration runs in the read transaction, so the callback must not write to the database
+func (s *BoltKVStore) Iterate(fun func(k []byte, v []byte) bool) {
+	mustNoErr(s.TryIteratePrefix(nil, fun))
+}
+
+// TryIterate is Iterate which returns error of the database
+func (s *BoltKVStore) TryIterate(fun func(k []byte, v []byte) bool) error {
+	return s.TryIteratePrefix(nil, fun)
+}
+
+// IteratePrefix implements trie.KVPrefixIterator. The cursor seeks the prefix, so only keys with the prefix are read
+func (s *BoltKVStore) IteratePrefix(prefix []byte, fun func(k []byte, v []byte) bool) {
+	mustNoErr(s.TryIteratePrefix(prefix, fun))
+}
+
+// TryIteratePrefix is IteratePrefix which returns error of the database
+func (s *BoltKVStore) TryIteratePrefix(prefix []byte, fun func(k []byte, v []byte) bool) error {
+	return s.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if !fun(trie.Concat(k), trie.Concat(v)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// IterateKeysPrefix implements trie.KVPrefixIterator
+func (s *BoltKVStore) IterateKeysPrefix(prefix []byte, fun func(k []byte) bool) {
+	mustNoErr(s.TryIterateKeysPrefix(prefix, fun))
+}
+
+// TryIterateKeysPrefix is IterateKeysPrefix which returns error of the database
+func (s *BoltKVStore) TryIterateKeysPrefix(prefix []byte, fun func(k []byte) bool) error {
+	return s.view(func(b *bolt.Bucket) error {
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if !fun(trie.Concat(k)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// WriteBatch implements trie.BatchWriter: mutations are written in one transaction, which is durable
+// when it is committed, so the store can be used with trie.AsyncPersister
+func (s *BoltKVStore) WriteBatch(mutations []trie.NodeMutation) error {
+	return s.update(func(b *bolt.Bucket) error {
+		for _, m := range mutations {
+			if err := set(b, m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BoltBatch collects mutations of the store in memory and writes them in one transaction upon Commit.
+// Mutations are not visible to readers of the store until committed. The last mutation of the key wins
+type BoltBatch struct {
+	store     *BoltKVStore
+	mutations map[string][]byte
+}
+
+var _ trie.KVWriter = &BoltBatch{}
+
+// Batch creates an empty batch of the store
+func (s *BoltKVStore) Batch() *BoltBatch {
+	return &BoltBatch{
+		store:     s,
+		mutations: make(map[string][]byte),
+	}
+}
+
+// Set adds the mutation to the batch. Empty value means deletion of the key
+func (b *BoltBatch) Set(key, value []byte) {
+	b.mutations[string(key)] = trie.Concat(value)
+}
+
+// Len returns number of mutations in the batch
+func (b *BoltBatch) Len() int {
+	return len(b.mutations)
+}
+
+// Commit writes mutations in one transaction in the order of keys, which is the most efficient order for bbolt.
+// The batch is empty after successful commit
+func (b *BoltBatch) Commit() error {
+	if len(b.mutations) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(b.mutations))
+	for k := range b.mutations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	err := b.store.update(func(bucket *bolt.Bucket) error {
+		for _, k := range keys {
+			if err := set(bucket, []byte(k), b.mutations[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.mutations = make(map[string][]byte)
+	return nil
+}
+
+// partitionWriter writes to the partition of the batch under the prefix
+type partitionWriter struct {
+	batch  *BoltBatch
+	prefix []byte
+}
+
+func (w partitionWriter) Set(key, value []byte) {
+	w.batch.Set(trie.Concat(w.prefix, key), value)
+}
+
+// BoltBatchedUpdater buffers updates of values and the trie and writes them to the store in one transaction upon
+// Commit, so each block of updates is atomic and costs one fsync
+type BoltBatchedUpdater struct {
+	store  *BoltKVStore
+	batch  *BoltBatch
+	layout trie.StoreLayout
+	trie   *trie.Trie
+}
+
+var _ trie.KVBatchedUpdater = &BoltBatchedUpdater{}
+
+// NewBoltBatchedUpdater creates new batch updater of the trie with nodes and values located in the store
+// according to the layout
+func NewBoltBatchedUpdater(store *BoltKVStore, model trie.CommitmentModel, layout trie.StoreLayout, opt trie.Options) (*BoltBatchedUpdater, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	return &BoltBatchedUpdater{
+		store:  store,
+		batch:  store.Batch(),
+		layout: layout,
+		trie:   trie.NewWithLayout(model, store, layout, opt),
+	}, nil
+}
+
+// Trie returns the trie of the updater. Uncommitted updates are visible in it
+func (a *BoltBatchedUpdater) Trie() *trie.Trie {
+	return a.trie
+}
+
+// Batch returns the batch the updater writes to. The application may add its own mutations to the batch,
+// so that they are committed by Commit atomically with the trie changes
+func (a *BoltBatchedUpdater) Batch() *BoltBatch {
+	return a.batch
+}
+
+// Update adds key value both to the batch and to the trie
+func (a *BoltBatchedUpdater) Update(key []byte, value []byte) {
+	partitionWriter{batch: a.batch, prefix: a.layout.ValuePrefix}.Set(key, value)
+	a.trie.Update(key, value)
+}
+
+// Commit commits the trie and writes values and node mutations in one transaction
+func (a *BoltBatchedUpdater) Commit() error {
+	a.trie.Commit()
+	a.trie.PersistMutations(partitionWriter{batch: a.batch, prefix: a.layout.NodePrefix})
+	if err := a.batch.Commit(); err != nil {
+		return err
+	}
+	a.trie.ClearCache()
+	return nil
+}
@@ -0,0 +1,105 @@
+package bbolt_adaptor
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openDB(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "trie.db"), 0o600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestBoltKVStore(t *testing.T) {
+	t.Run("get set", func(t *testing.T) {
+		s, err := NewBoltKVStore(openDB(t), []byte("b"))
+		require.NoError(t, err)
+		require.Nil(t, s.Get([]byte("a")))
+		require.False(t, s.Has([]byte("a")))
+		s.Set([]byte("a"), []byte("1"))
+		require.EqualValues(t, []byte("1"), s.Get([]byte("a")))
+		require.True(t, s.Has([]byte("a")))
+		s.Set([]byte("a"), nil)
+		require.Nil(t, s.Get([]byte("a")))
+		require.False(t, s.Has([]byte("a")))
+	})
+	t.Run("ordered iteration", func(t *testing.T) {
+		s, err := NewBoltKVStore(openDB(t), []byte("b"))
+		require.NoError(t, err)
+		batch := s.Batch()
+		for _, k := range []string{"ab2", "b", "ab1", "a", "ac"} {
+			batch.Set([]byte(k), []byte(k+"v"))
+		}
+		require.EqualValues(t, 5, batch.Len())
+		require.Nil(t, s.Get([]byte("a")))
+		require.NoError(t, batch.Commit())
+		require.EqualValues(t, 0, batch.Len())
+
+		var keys []string
+		s.Iterate(func(k, v []byte) bool {
+			require.EqualValues(t, string(k)+"v", string(v))
+			keys = append(keys, string(k))
+			return true
+		})
+		require.EqualValues(t, []string{"a", "ab1", "ab2", "ac", "b"}, keys)
+
+		keys = nil
+		s.IterateKeysPrefix([]byte("ab"), func(k []byte) bool {
+			keys = append(keys, string(k))
+			return true
+		})
+		require.EqualValues(t, []string{"ab1", "ab2"}, keys)
+
+		keys = nil
+		s.IteratePrefix([]byte("a"), func(k, _ []byte) bool {
+			keys = append(keys, string(k))
+			return len(keys) < 2
+		})
+		require.EqualValues(t, []string{"a", "ab1"}, keys)
+	})
+	t.Run("write batch", func(t *testing.T) {
+		s, err := NewBoltKVStore(openDB(t), []byte("b"))
+		require.NoError(t, err)
+		p := trie.NewAsyncPersister(s, 0)
+		b := p.Write([]trie.NodeMutation{{Key: []byte("a"), Value: []byte("1")}, {Key: []byte("b"), Value: []byte("2")}})
+		require.NoError(t, b.Wait())
+		p.Write([]trie.NodeMutation{{Key: []byte("a")}})
+		require.NoError(t, p.Close())
+		require.Nil(t, s.Get([]byte("a")))
+		require.EqualValues(t, []byte("2"), s.Get([]byte("b")))
+	})
+}
+
+func TestBoltBatchedUpdater(t *testing.T) {
+	model := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256)
+	db := openDB(t)
+	s, err := NewBoltKVStore(db, []byte("state"))
+	require.NoError(t, err)
+	upd, err := NewBoltBatchedUpdater(s, model, trie.DefaultStoreLayout, trie.Options{})
+	require.NoError(t, err)
+
+	reference := trie.New(model, trie.NewInMemoryKVStore(), nil)
+	for block := 0; block < 5; block++ {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key%d", (block*37+i)%300))
+			value := []byte(fmt.Sprintf("value%d-%d", block, i))
+			upd.Update(key, value)
+			reference.Update(key, value)
+		}
+		require.NoError(t, upd.Commit())
+		reference.Commit()
+		require.True(t, model.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(upd.Trie())))
+	}
+	// the state is read back from the database
+	tr := trie.NewTrieReaderWithLayout(model, s, trie.DefaultStoreLayout)
+	require.True(t, model.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+	require.EqualValues(t, []byte("value4-99"), trie.DefaultStoreLayout.ValueStore(s).Get([]byte("key247")))
+}
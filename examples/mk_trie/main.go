@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/iotaledger/trie.go/models/trie_blake2b"
 	"github.com/iotaledger/trie.go/trie"
@@ -16,19 +16,22 @@ func main() {
 	// create blake2b 20 bytes (160 bit) commitment model for binary trie
 	model := trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160)
 
+	// example and trie events are logged to the console
+	log := trie.NewPrintfLogger(os.Stdout, true)
+
 	// create the trie with binary keys
-	tr := trie.New(model, store, nil)
-	fmt.Printf("\nExample of trie.\n%s\n", tr.Info())
+	tr := trie.NewWithOptions(model, store, nil, trie.Options{Logger: log})
+	log.Debugf("example of trie: %s", tr.Info())
 
 	// add data key/value pairs to the trie
 	for _, s := range data {
-		fmt.Printf("add key '%s' into the trie\n", s)
+		log.Debugf("add key '%s' into the trie", s)
 		tr.Update([]byte(s), []byte(s+"$"))
 	}
 	// recalculate commitments in the trie
 	tr.Commit()
 	rootCommitment := trie.RootCommitment(tr)
-	fmt.Printf("root commitment 1: %s\n", rootCommitment)
+	log.Debugf("root commitment 1: %s", rootCommitment)
 
 	// currently, the trie is partially cached
 	// Persist all cached mutations to the store
@@ -38,11 +41,11 @@ func main() {
 	tr.ClearCache()
 
 	// create another trie on the same store
-	tr2 := trie.New(model, store, nil)
+	tr2 := trie.NewWithOptions(model, store, nil, trie.Options{Logger: log})
 
 	// the root must be the same
 	rootCommitment2 := trie.RootCommitment(tr2)
-	fmt.Printf("root commitment 2: %s\n", rootCommitment2)
+	log.Debugf("root commitment 2: %s", rootCommitment2)
 
-	fmt.Printf("roo1 == root2: %v\n", model.EqualCommitments(rootCommitment, rootCommitment2))
+	log.Debugf("roo1 == root2: %v", model.EqualCommitments(rootCommitment, rootCommitment2))
 }
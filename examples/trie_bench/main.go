@@ -21,7 +21,9 @@ import (
 
 const usage = "USAGE: trie_bench [-n=<num kv pairs>] [-blake2b=20|32]" +
 	"[-arity=2|16|26] [-optkey] [-valuethr=<terminal optimization threshold>]" +
-	"[maxkey=<max key size>] [maxvalue=<max value size>]" +
+	"[maxkey=<max key size>] [maxvalue=<max value size>] [-seed=<seed>] [-keydist|-valuedist=uniform|fixed|exponential]" +
+	"[-dup=<duplicate key probability>] [-del=<delete probability>] [-manifest=<manifest file to reproduce>]" +
+	"[-batch=<records per commit>] [-prealloc]" +
 	"<gen|mkdbbadger|mkdbmem|scandbbadger|mkdbbadgernotrie> <name>\n"
 
 var (
@@ -34,10 +36,20 @@ var (
 	optterm  = flag.Int("valuethr", 0, "commitments to values longer that parameter won't be saved in the try")
 	maxKey   = flag.Int("maxkey", MaxKey, "maximum size of the generated key")
 	maxValue = flag.Int("maxvalue", MaxValue, "maximum size of the generated value")
+	seed     = flag.Int64("seed", 0, "seed of the generator, 0 means random")
+	keyDist  = flag.String("keydist", "", "distribution of key lengths: uniform, fixed or exponential")
+	valDist  = flag.String("valuedist", "", "distribution of value lengths: uniform, fixed or exponential")
+	dupProb  = flag.Float64("dup", 0, "probability of duplicate keys")
+	delProb  = flag.Float64("del", 0, "probability of delete markers")
+	manifest = flag.String("manifest", "", "manifest of the corpus to reproduce, overrides parameters of generation")
+	batch    = flag.Int("batch", flushEach, "number of records per commit of mkdb commands")
+	prealloc = flag.Bool("prealloc", false, "preallocate the node cache of the trie for the batch")
 	cmd      string
 	name     string
 	fname    string
 	dbdir    string
+	// log reports progress and results of commands, and events of the trie
+	log = trie.NewPrintfLogger(os.Stdout, true)
 )
 
 func main() {
@@ -78,21 +90,23 @@ func main() {
 		fmt.Printf(usage)
 		os.Exit(1)
 	}
-	fmt.Printf("Commitment model: '%s'\n", model.Description())
-	fmt.Printf("Optimize key commitments: %v\n", *optkey)
-	fmt.Printf("Terminal optimization threshold: %d\n", *optterm)
+	log.Debugf("Commitment model: '%s'", model.Description())
+	log.Debugf("Optimize key commitments: %v", *optkey)
+	log.Debugf("Terminal optimization threshold: %d", *optterm)
+	if *batch <= 0 {
+		log.Warnf("wrong number of records per commit %d", *batch)
+		os.Exit(1)
+	}
+	log.Debugf("Records per commit: %d, preallocate the node cache: %v", *batch, *prealloc)
 	fname = name + ".bin"
 	dbdir = fmt.Sprintf("%s.%d.%d.%d.dbdir", name, *hashsize, *arityPar, *optterm)
 
 	switch cmd {
 	case "gen":
-		fmt.Printf("number of key/value pairs to generate: %d\n", *num)
-		fmt.Printf("maximum key length: %d\n", *maxKey)
-		fmt.Printf("maximum value length: %d\n", *maxValue)
 		if *hashkv {
-			fmt.Printf("generated keys and values will be hashed into 32 bytes\n")
+			log.Debugf("generated keys and values will be hashed into 32 bytes")
 		}
-		fmt.Printf("generating file '%s'\n", fname)
+		log.Debugf("generating file '%s'", fname)
 		genrnd()
 
 	case "mkdbbadgernotrie":
@@ -116,7 +130,7 @@ func main() {
 
 func must(err error) {
 	if err != nil {
-		fmt.Printf("error: %v\n", err)
+		log.Warnf("error: %v", err)
 		os.Exit(1)
 	}
 }
@@ -127,12 +141,34 @@ const (
 )
 
 func genrnd() {
-	rndIterator := trie.NewRandStreamIterator(trie.RandStreamParams{
-		Seed:       time.Now().UnixNano(),
-		NumKVPairs: *num,
-		MaxKey:     *maxKey,
-		MaxValue:   *maxValue,
-	})
+	par := trie.RandStreamParams{
+		Seed:                    *seed,
+		NumKVPairs:              *num,
+		MaxKey:                  *maxKey,
+		MaxValue:                *maxValue,
+		KeyDistribution:         trie.Distribution(*keyDist),
+		ValueDistribution:       trie.Distribution(*valDist),
+		DuplicateKeyProbability: *dupProb,
+		DeleteProbability:       *delProb,
+	}
+	if par.Seed == 0 {
+		par.Seed = time.Now().UnixNano()
+	}
+	if *manifest != "" {
+		var err error
+		par, err = trie.ReadRandStreamManifest(*manifest)
+		must(err)
+		log.Debugf("reproducing corpus from manifest '%s'", *manifest)
+	}
+	must(par.Validate())
+	log.Debugf("seed: %d", par.Seed)
+	log.Debugf("number of key/value pairs to generate: %d", par.NumKVPairs)
+	log.Debugf("maximum key length: %d", par.MaxKey)
+	log.Debugf("maximum value length: %d", par.MaxValue)
+	rndIterator := trie.NewRandStreamIterator(par)
+	manifestName := name + ".manifest.json"
+	must(rndIterator.WriteManifest(manifestName))
+	log.Debugf("manifest written to '%s'", manifestName)
 	fileWriter, err := trie.CreateKVStreamFile(fname)
 	must(err)
 	defer func() { _ = fileWriter.Close() }()
@@ -141,7 +177,7 @@ func genrnd() {
 	wrote := 0
 	err = rndIterator.Iterate(func(k []byte, v []byte) bool {
 		if (count+1)%100000 == 0 {
-			fmt.Printf("writing key/value pair %d. Wrote %d bytes\n", count+1, wrote)
+			log.Debugf("writing key/value pair %d. Wrote %d bytes", count+1, wrote)
 		}
 		if *hashkv {
 			t := blake2b.Sum256(k)
@@ -157,7 +193,7 @@ func genrnd() {
 		return true
 	})
 	must(err)
-	fmt.Printf("generated total %d key/value pairs, %f MB\n", count+1, float32(wrote)/(1024*1024))
+	log.Debugf("generated total %d key/value pairs, %f MB", count+1, float32(wrote)/(1024*1024))
 }
 
 // all values loads in memory
@@ -168,14 +204,14 @@ func mkdbmem() {
 	file2kvs(kvs)
 }
 
-// all value and trie in badger db. Flushes every 100_000 records
+// all value and trie in badger db. Commits every -batch records
 
 func mkdbbadger() {
 	if _, err := os.Stat(dbdir); !os.IsNotExist(err) {
-		fmt.Printf("directory %s already exists. Can't create new database\n", dbdir)
+		log.Warnf("directory %s already exists. Can't create new database", dbdir)
 		os.Exit(1)
 	}
-	fmt.Printf("creating new Badger database '%s'\n", dbdir)
+	log.Debugf("creating new Badger database '%s'", dbdir)
 
 	db, err := badger.CreateDB(dbdir)
 	must(err)
@@ -189,10 +225,10 @@ func mkdbbadger() {
 
 func mkdbbadgerNoTrie() {
 	if _, err := os.Stat(dbdir); !os.IsNotExist(err) {
-		fmt.Printf("directory %s already exists. Can't create new database\n", dbdir)
+		log.Warnf("directory %s already exists. Can't create new database", dbdir)
 		os.Exit(1)
 	}
-	fmt.Printf("creating new Badger database. No trie '%s'\n", dbdir)
+	log.Debugf("creating new Badger database. No trie '%s'", dbdir)
 
 	db, err := badger.CreateDB(dbdir)
 	must(err)
@@ -206,18 +242,17 @@ func mkdbbadgerNoTrie() {
 
 func scandbbadger() {
 	if _, err := os.Stat(dbdir); os.IsNotExist(err) {
-		fmt.Printf("directory %s does not exist\n", dbdir)
+		log.Warnf("directory %s does not exist", dbdir)
 		os.Exit(1)
 	}
-	fmt.Printf("opening database '%s'\n", dbdir)
+	log.Debugf("opening database '%s'", dbdir)
 
 	db, err := badger.CreateDB(dbdir)
 	must(err)
 	defer func() { _ = db.Close() }()
 
 	kvs := badger.New(db)
-	trieKVS := hive_adaptor.NewHiveKVStoreAdaptor(kvs, triePrefix)
-	valueKVS := hive_adaptor.NewHiveKVStoreAdaptor(kvs, valueStorePrefix)
+	trieKVS, valueKVS, _ := hive_adaptor.NewHiveKVStoreLayout(kvs, trie.DefaultStoreLayout)
 
 	//trie.DangerouslyDumpToConsole("----- VALUES ------", valueKVS)
 	//trie.DangerouslyDumpToConsole("----- TRIE ------", trieKVS)
@@ -229,7 +264,7 @@ func scandbbadger() {
 		keyByteCounter += len(k)
 		return true
 	})
-	fmt.Printf("K/V STORAGE: number of key/value pairs: %d, avg key len: %d\n",
+	log.Debugf("K/V STORAGE: number of key/value pairs: %d, avg key len: %d",
 		recCounter, keyByteCounter/recCounter)
 
 	recCounter = 0
@@ -241,12 +276,12 @@ func scandbbadger() {
 		valueByteCounter += len(v)
 		return true
 	})
-	fmt.Printf("TRIE: number of nodes: %d, avg key len: %d, avg node size: %d\n",
+	log.Debugf("TRIE: number of nodes: %d, avg key len: %d, avg node size: %d",
 		recCounter, keyByteCounter/recCounter, valueByteCounter/recCounter)
 
 	tr := trie.NewTrieReader(model, trieKVS, valueKVS)
 	root := trie.RootCommitment(tr)
-	fmt.Printf("root commitment: %s\n", root)
+	log.Debugf("root commitment: %s", root)
 
 	recCounter = 1
 	proofBytes := 0
@@ -267,7 +302,7 @@ func scandbbadger() {
 		must(err)
 
 		if recCounter%flushEach == 0 {
-			fmt.Printf("validated %d records in %v, %f proof/sec, avg proof bytes %d, avg proof len %f\n",
+			log.Debugf("validated %d records in %v, %f proof/sec, avg proof bytes %d, avg proof len %f",
 				recCounter, tm.Duration(), float64(recCounter)/tm.Duration().Seconds(),
 				proofBytes/recCounter, float32(proofLen)/float32(recCounter))
 		}
@@ -278,11 +313,6 @@ func scandbbadger() {
 
 type timer time.Time
 
-var (
-	triePrefix       = []byte{0x01}
-	valueStorePrefix = []byte{0x02}
-)
-
 func file2kvs(kvs kvstore.KVStore) {
 	streamIn, err := trie.OpenKVStreamFile(fname)
 	must(err)
@@ -290,17 +320,24 @@ func file2kvs(kvs kvstore.KVStore) {
 
 	tm := newTimer()
 	counterRec := 1
-	tr := trie.NewTrieReader(model, hive_adaptor.NewHiveKVStoreAdaptor(kvs, triePrefix), nil)
-	updater, err := hive_adaptor.NewHiveBatchedUpdater(kvs, model, triePrefix, valueStorePrefix, *optkey)
+	tr := trie.NewTrieReader(model, hive_adaptor.NewHiveKVStoreAdaptor(kvs, trie.DefaultStoreLayout.NodePrefix), nil)
+	opt := trie.Options{
+		OptimizeKeyCommitments: *optkey,
+		Logger:                 log,
+	}
+	if *prealloc {
+		opt.ExpectedSize = *batch
+	}
+	updater, err := hive_adaptor.NewHiveBatchedUpdaterWithOptions(kvs, model, trie.DefaultStoreLayout, opt)
 	must(err)
 	var mem runtime.MemStats
 	err = streamIn.Iterate(func(k []byte, v []byte) bool {
 		updater.Update(k, v)
-		if counterRec%flushEach == 0 {
+		if counterRec%*batch == 0 {
 			must(updater.Commit())
 			runtime.ReadMemStats(&mem)
 
-			fmt.Printf("commited %d records. rec/sec: %v, mem alloc: %f MB\n",
+			log.Debugf("commited %d records. rec/sec: %v, mem alloc: %f MB",
 				counterRec, counterRec/int(tm.Duration().Seconds()),
 				float32(mem.Alloc)/(1024*1024),
 			)
@@ -311,11 +348,11 @@ func file2kvs(kvs kvstore.KVStore) {
 	must(err)
 	if updater != nil {
 		must(updater.Commit())
-		fmt.Printf("commited %d records. Duration: %v\n", counterRec, tm.Duration())
+		log.Debugf("commited %d records. Duration: %v", counterRec, tm.Duration())
 	}
-	fmt.Printf("Speed: %f records/sec\n", float64(counterRec)/tm.Duration().Seconds())
+	log.Debugf("Speed: %f records/sec", float64(counterRec)/tm.Duration().Seconds())
 
-	fmt.Printf("root commitment: %s\n", trie.RootCommitment(tr))
+	log.Debugf("root commitment: %s", trie.RootCommitment(tr))
 }
 
 func file2kvsNoTrie(kvs kvstore.KVStore) {
@@ -345,7 +382,7 @@ func file2kvsNoTrie(kvs kvstore.KVStore) {
 			if sec == 0 {
 				sec = 1
 			}
-			fmt.Printf("wrote %d records. rec/sec: %v, mem alloc: %f MB\n",
+			log.Debugf("wrote %d records. rec/sec: %v, mem alloc: %f MB",
 				counterRec, counterRec/sec,
 				float32(mem.Alloc)/(1024*1024),
 			)
@@ -354,7 +391,7 @@ func file2kvsNoTrie(kvs kvstore.KVStore) {
 		return true
 	})
 	must(err)
-	fmt.Printf("Speed: %f records/sec\n", float64(counterRec)/tm.Duration().Seconds())
+	log.Debugf("Speed: %f records/sec", float64(counterRec)/tm.Duration().Seconds())
 }
 
 func newTimer() timer {
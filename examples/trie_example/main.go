@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/iotaledger/trie.go/models/trie_blake2b"
 	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
@@ -17,34 +17,37 @@ func main() {
 	// create blake2b 20 bytes (160 bit) commitment model for binary trie
 	model := trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160)
 
+	// example and trie events are logged to the console
+	log := trie.NewPrintfLogger(os.Stdout, true)
+
 	// create the trie with binary keys
-	tr := trie.New(model, store, nil)
-	fmt.Printf("\nExample of trie.\n%s\n", tr.Info())
+	tr := trie.NewWithOptions(model, store, nil, trie.Options{Logger: log})
+	log.Debugf("example of trie: %s", tr.Info())
 
 	// add data key/value pairs to the trie
 	for _, s := range data {
-		fmt.Printf("add key '%s' into the trie\n", s)
+		log.Debugf("add key '%s' into the trie", s)
 		tr.UpdateStr(s, s+"$")
 	}
 	// recalculate commitments in the trie
 	tr.Commit()
 	rootCommitment := trie.RootCommitment(tr)
-	fmt.Printf("root commitment: %s\n", rootCommitment)
+	log.Debugf("root commitment: %s", rootCommitment)
 	// remove some keys from the trie
 	for _, i := range []int{1, 5, 6} {
-		fmt.Printf("remove key '%s' from the trie\n", data[i])
+		log.Debugf("remove key '%s' from the trie", data[i])
 		tr.DeleteStr(data[i])
 	}
 	// recalc trie again
 	tr.Commit()
 	rootCommitment = trie.RootCommitment(tr)
-	fmt.Printf("root commitment: %s\n", rootCommitment)
+	log.Debugf("root commitment: %s", rootCommitment)
 
 	// check PoI for all data
 	for _, s := range data {
 		// retrieve proof
 		proof := model.Proof([]byte(s), tr)
-		fmt.Printf("PoI of the key '%s': length %d, serialized size %d bytes\n",
+		log.Debugf("PoI of the key '%s': length %d, serialized size %d bytes",
 			s, len(proof.Path), trie.MustSize(proof))
 		// validate proof
 		err := trie_blake2b_verify.Validate(proof, rootCommitment.Bytes())
@@ -53,13 +56,13 @@ func main() {
 			errstr = err.Error()
 		}
 		if err != nil {
-			fmt.Printf("validating PoI for '%s': %s\n", s, errstr)
+			log.Warnf("validating PoI for '%s': %s", s, errstr)
 			continue
 		}
 		if trie_blake2b_verify.IsProofOfAbsence(proof) {
-			fmt.Printf("key '%s' is NOT IN THE STATE\n", s)
+			log.Debugf("key '%s' is NOT IN THE STATE", s)
 		} else {
-			fmt.Printf("key '%s' is IN THE STATE\n", s)
+			log.Debugf("key '%s' is IN THE STATE", s)
 		}
 	}
 }
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"os"
 
 	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
 	"github.com/iotaledger/trie.go/trie"
@@ -16,38 +16,41 @@ func main() {
 	// create kzg commitment model for 256-ary trie
 	model := trie_kzg_bn256.New()
 
+	// example and trie events are logged to the console
+	log := trie.NewPrintfLogger(os.Stdout, true)
+
 	// create the trie with binary keys
-	tr := trie.New(model, store, nil)
-	fmt.Printf("\nExample of trie.\n%s\n", tr.Info())
+	tr := trie.NewWithOptions(model, store, nil, trie.Options{Logger: log})
+	log.Debugf("example of trie: %s", tr.Info())
 
 	// add data key/value pairs to the trie
 	for _, s := range data {
-		fmt.Printf("add key '%s' into the trie\n", s)
+		log.Debugf("add key '%s' into the trie", s)
 		tr.UpdateStr(s, s+"$")
 	}
 	// recalculate commitments in the trie
 	tr.Commit()
 	rootCommitment := trie.RootCommitment(tr)
-	fmt.Printf("root commitment: %s\n", rootCommitment)
+	log.Debugf("root commitment: %s", rootCommitment)
 	// remove some keys from the trie
 	for _, i := range []int{1, 5, 6} {
-		fmt.Printf("remove key '%s' from the trie\n", data[i])
+		log.Debugf("remove key '%s' from the trie", data[i])
 		tr.DeleteStr(data[i])
 	}
 	// recalc trie again
 	tr.Commit()
 	rootCommitment = trie.RootCommitment(tr)
-	fmt.Printf("root commitment: %s\n", rootCommitment)
+	log.Debugf("root commitment: %s", rootCommitment)
 
 	// check PoI for all data
 	for _, s := range data {
 		// retrieve proof
 		proof, exists := model.ProofOfInclusion([]byte(s), tr)
 		if !exists {
-			fmt.Printf("key not found: '%s'\n", s)
+			log.Debugf("key not found: '%s'", s)
 			continue
 		}
-		fmt.Printf("PoI of the key '%s': length %d, serialized size %d bytes\n",
+		log.Debugf("PoI of the key '%s': length %d, serialized size %d bytes",
 			s, len(proof.Path), trie.MustSize(proof))
 		// validate proof
 		err := proof.Validate(rootCommitment)
@@ -56,7 +59,7 @@ func main() {
 			errstr = err.Error()
 		}
 		if err != nil {
-			fmt.Printf("validating PoI for '%s': %s\n", s, errstr)
+			log.Warnf("validating PoI for '%s': %s", s, errstr)
 			continue
 		}
 	}
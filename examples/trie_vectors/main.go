@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iotaledger/trie.go/models/trie_vectors"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+const usage = "USAGE: trie_vectors [-o=<output JSON file>] [-golden=<directory of golden vectors>]\n"
+
+var (
+	output = flag.String("o", "", "file of the JSON verification suite, empty means standard output")
+	golden = flag.String("golden", "", "directory where golden vectors are regenerated, empty means they are not")
+)
+
+func main() {
+	flag.Parse()
+	if len(flag.Args()) != 0 {
+		fmt.Printf(usage)
+		os.Exit(1)
+	}
+	log := trie.NewPrintfLogger(os.Stderr, true)
+
+	suite, err := trie_vectors.GenerateVerificationSuite()
+	if err != nil {
+		log.Warnf("generating verification suite: %v", err)
+		os.Exit(1)
+	}
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			log.Warnf("creating '%s': %v", *output, err)
+			os.Exit(1)
+		}
+	}
+	if err = suite.WriteJSON(w); err == nil && w != os.Stdout {
+		err = w.Close()
+	}
+	if err != nil {
+		log.Warnf("writing verification suite: %v", err)
+		os.Exit(1)
+	}
+	log.Debugf("%d verification vectors written", len(suite.Vectors))
+
+	if *golden != "" {
+		if err = trie_vectors.WriteGoldenFiles(*golden); err != nil {
+			log.Warnf("writing golden vectors: %v", err)
+			os.Exit(1)
+		}
+		log.Debugf("golden vectors written to '%s'", *golden)
+	}
+}
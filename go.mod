@@ -6,6 +6,7 @@ require (
 	github.com/iotaledger/hive.go/core v1.0.0-beta.4
 	github.com/stretchr/testify v1.8.0
 	go.dedis.ch/kyber/v3 v3.0.14
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/crypto v0.0.0-20220829220503-c86fa9a7ed90
 	golang.org/x/term v0.0.0-20220722155259-a9ba230a4035
 	golang.org/x/xerrors v0.0.0-20220609144429-65e65417b02f
@@ -8,17 +8,46 @@ import (
 	"github.com/iotaledger/trie.go/trie"
 )
 
-// HiveKVStoreAdaptor maps a partition of the Hive KVStore to trie_go.KVStore
+// HiveKVStoreAdaptor maps a partition of the Hive KVStore to trie_go.KVStore.
+// Methods of trie_go.KVStore panic on errors of the underlying kvstore. Methods with the 'Try' prefix
+// return those errors instead
 type HiveKVStoreAdaptor struct {
 	kvs    kvstore.KVStore
 	prefix []byte
 }
 
+var (
+	_ trie.KVStore          = &HiveKVStoreAdaptor{}
+	_ trie.KVPrefixIterator = &HiveKVStoreAdaptor{}
+)
+
 // NewHiveKVStoreAdaptor creates a new KVStore as a partition of hive.go KVStore
 func NewHiveKVStoreAdaptor(kvs kvstore.KVStore, prefix []byte) *HiveKVStoreAdaptor {
 	return &HiveKVStoreAdaptor{kvs: kvs, prefix: prefix}
 }
 
+// NewHiveKVStoreAdaptorWithRealm creates a new KVStore as a partition of the realm of hive.go KVStore.
+// The realm is isolated by the kvstore itself, the prefix is the partition within the realm
+func NewHiveKVStoreAdaptorWithRealm(kvs kvstore.KVStore, realm kvstore.Realm, prefix []byte) (*HiveKVStoreAdaptor, error) {
+	realmKVS, err := kvs.WithRealm(realm)
+	if err != nil {
+		return nil, err
+	}
+	return NewHiveKVStoreAdaptor(realmKVS, prefix), nil
+}
+
+// Realm returns the realm of the underlying kvstore
+func (kvs *HiveKVStoreAdaptor) Realm() kvstore.Realm {
+	return kvs.kvs.Realm()
+}
+
+// NewHiveKVStoreLayout returns node, value and metadata partitions of the hive.go KVStore according to the layout
+func NewHiveKVStoreLayout(kvs kvstore.KVStore, layout trie.StoreLayout) (*HiveKVStoreAdaptor, *HiveKVStoreAdaptor, *HiveKVStoreAdaptor) {
+	return NewHiveKVStoreAdaptor(kvs, layout.NodePrefix),
+		NewHiveKVStoreAdaptor(kvs, layout.ValuePrefix),
+		NewHiveKVStoreAdaptor(kvs, layout.MetadataPrefix)
+}
+
 func mustNoErr(err error) {
 	if err != nil {
 		panic(err)
@@ -33,24 +62,39 @@ func makeKey(prefix, k []byte) []byte {
 }
 
 func (kvs *HiveKVStoreAdaptor) Get(key []byte) []byte {
+	v, err := kvs.TryGet(key)
+	mustNoErr(err)
+	return v
+}
+
+// TryGet is Get which returns error of the kvstore. Absence of the key is not an error
+func (kvs *HiveKVStoreAdaptor) TryGet(key []byte) ([]byte, error) {
 	v, err := kvs.kvs.Get(makeKey(kvs.prefix, key))
 	if errors.Is(err, kvstore.ErrKeyNotFound) {
-		return nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
-	mustNoErr(err)
 	if len(v) == 0 {
-		return nil
+		return nil, nil
 	}
-	return v
+	return v, nil
 }
 
 func (kvs *HiveKVStoreAdaptor) Has(key []byte) bool {
-	v, err := kvs.kvs.Get(makeKey(kvs.prefix, key))
-	if errors.Is(err, kvstore.ErrKeyNotFound) || len(v) == 0 {
-		return false
-	}
+	ret, err := kvs.TryHas(key)
 	mustNoErr(err)
-	return true
+	return ret
+}
+
+// TryHas is Has which returns error of the kvstore
+func (kvs *HiveKVStoreAdaptor) TryHas(key []byte) (bool, error) {
+	v, err := kvs.TryGet(key)
+	if err != nil {
+		return false, err
+	}
+	return v != nil, nil
 }
 
 func (kvs *HiveKVStoreAdaptor) Set(key, value []byte) {
@@ -64,53 +108,158 @@ func (kvs *HiveKVStoreAdaptor) Set(key, value []byte) {
 }
 
 func (kvs *HiveKVStoreAdaptor) Iterate(fun func(k []byte, v []byte) bool) {
-	err := kvs.kvs.Iterate(kvs.prefix, func(key kvstore.Key, value kvstore.Value) bool {
+	mustNoErr(kvs.TryIterate(fun))
+}
+
+// TryIterate is Iterate which returns error of the kvstore
+func (kvs *HiveKVStoreAdaptor) TryIterate(fun func(k []byte, v []byte) bool) error {
+	return kvs.TryIteratePrefix(nil, fun)
+}
+
+// IteratePrefix implements trie.KVPrefixIterator. The prefix is passed to the iterator of the kvstore,
+// so only keys with the prefix are read
+func (kvs *HiveKVStoreAdaptor) IteratePrefix(prefix []byte, fun func(k []byte, v []byte) bool) {
+	mustNoErr(kvs.TryIteratePrefix(prefix, fun))
+}
+
+// TryIteratePrefix is IteratePrefix which returns error of the kvstore
+func (kvs *HiveKVStoreAdaptor) TryIteratePrefix(prefix []byte, fun func(k []byte, v []byte) bool) error {
+	return kvs.kvs.Iterate(makeKey(kvs.prefix, prefix), func(key kvstore.Key, value kvstore.Value) bool {
 		return fun(key[len(kvs.prefix):], value)
 	})
-	mustNoErr(err)
+}
+
+// IterateKeysPrefix implements trie.KVPrefixIterator. Values are not read from the kvstore
+func (kvs *HiveKVStoreAdaptor) IterateKeysPrefix(prefix []byte, fun func(k []byte) bool) {
+	mustNoErr(kvs.TryIterateKeysPrefix(prefix, fun))
+}
+
+// TryIterateKeysPrefix is IterateKeysPrefix which returns error of the kvstore
+func (kvs *HiveKVStoreAdaptor) TryIterateKeysPrefix(prefix []byte, fun func(k []byte) bool) error {
+	return kvs.kvs.IterateKeys(makeKey(kvs.prefix, prefix), func(key kvstore.Key) bool {
+		return fun(key[len(kvs.prefix):])
+	})
 }
 
 // HiveBatchedUpdater implements buffering and flush updates in batches, both k/v pairs and trie.
 // Dramatically improves speed
 type HiveBatchedUpdater struct {
-	kvs              kvstore.KVStore
-	batch            kvstore.BatchedMutations
-	wTrie            batchWriter
-	wValue           batchWriter
-	triePrefix       []byte
-	valueStorePrefix []byte
-	trie             *trie.Trie
+	kvs      kvstore.KVStore
+	batch    kvstore.BatchedMutations
+	external bool // the batch is provided by the application with AttachBatch
+	// pending is true while the attached batch is committed by the updater but not yet by the application.
+	// The trie cache is kept then, because the kvstore does not contain the nodes yet
+	pending bool
+	wTrie    batchWriter
+	wValue   batchWriter
+	layout   trie.StoreLayout
+	trie     *trie.Trie
+	log      trie.Logger
+}
+
+// NewHiveBatchedUpdater creates new batch updater with the hive.go batch as a backend.
+// Optional logger receives events of the updater and the underlying trie
+func NewHiveBatchedUpdater(kvs kvstore.KVStore, model trie.CommitmentModel, triePrefix, valueStorePrefix []byte, optimizeKeyCommitments bool, log ...trie.Logger) (*HiveBatchedUpdater, error) {
+	layout := trie.StoreLayout{
+		NodePrefix:  triePrefix,
+		ValuePrefix: valueStorePrefix,
+	}
+	return newHiveBatchedUpdater(kvs, model, layout, optimizeKeyCommitments, log...), nil
 }
 
-// NewHiveBatchedUpdater creates new batch updater with the hive.go batch as a backend
-func NewHiveBatchedUpdater(kvs kvstore.KVStore, model trie.CommitmentModel, triePrefix, valueStorePrefix []byte, optimizeKeyCommitments bool) (*HiveBatchedUpdater, error) {
+// NewHiveBatchedUpdaterWithLayout creates new batch updater with node and value partitions defined by the layout.
+// All partitions are located in the same hive.go KVStore, so that the batch is committed atomically
+func NewHiveBatchedUpdaterWithLayout(kvs kvstore.KVStore, model trie.CommitmentModel, layout trie.StoreLayout, optimizeKeyCommitments bool, log ...trie.Logger) (*HiveBatchedUpdater, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	return newHiveBatchedUpdater(kvs, model, layout, optimizeKeyCommitments, log...), nil
+}
+
+// NewHiveBatchedUpdaterWithOptions is NewHiveBatchedUpdaterWithLayout with options of the underlying trie,
+// for example Options.ExpectedSize set to the number of updates between commits of the bulk import
+func NewHiveBatchedUpdaterWithOptions(kvs kvstore.KVStore, model trie.CommitmentModel, layout trie.StoreLayout, opt trie.Options) (*HiveBatchedUpdater, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	return newHiveBatchedUpdaterWithOptions(kvs, model, layout, opt), nil
+}
+
+func newHiveBatchedUpdater(kvs kvstore.KVStore, model trie.CommitmentModel, layout trie.StoreLayout, optimizeKeyCommitments bool, log ...trie.Logger) *HiveBatchedUpdater {
+	var l trie.Logger
+	if len(log) > 0 {
+		l = log[0]
+	}
+	return newHiveBatchedUpdaterWithOptions(kvs, model, layout, trie.Options{
+		OptimizeKeyCommitments: optimizeKeyCommitments,
+		Logger:                 l,
+	})
+}
+
+func newHiveBatchedUpdaterWithOptions(kvs kvstore.KVStore, model trie.CommitmentModel, layout trie.StoreLayout, opt trie.Options) *HiveBatchedUpdater {
 	ret := &HiveBatchedUpdater{
 		kvs: kvs,
-		trie: trie.New(
+		trie: trie.NewWithOptions(
 			model,
-			NewHiveKVStoreAdaptor(kvs, triePrefix),
-			NewHiveKVStoreAdaptor(kvs, valueStorePrefix),
-			optimizeKeyCommitments,
+			NewHiveKVStoreAdaptor(kvs, layout.NodePrefix),
+			NewHiveKVStoreAdaptor(kvs, layout.ValuePrefix),
+			opt,
 		),
-		triePrefix:       triePrefix,
-		valueStorePrefix: valueStorePrefix,
+		layout: layout,
+		log:    opt.Logger,
 	}
-	return ret, nil
+	return ret
 }
 
 // Update adds key values store both to the batch and to the trie
 func (a *HiveBatchedUpdater) Update(key []byte, value []byte) {
-	var err error
-	if a.batch == nil {
-		a.batch, err = a.kvs.Batched()
-		mustNoErr(err)
-		a.wTrie = newBatchWriter(a.batch, a.triePrefix)
-		a.wValue = newBatchWriter(a.batch, a.valueStorePrefix)
-	}
+	mustNoErr(a.ensureBatch())
 	a.wValue.Set(key, value)
 	a.trie.Update(key, value)
 }
 
+// Batch returns the batch the updater writes to, creating it if needed. The application may add its own
+// mutations to the batch, so that they are committed by Commit atomically with the trie changes
+func (a *HiveBatchedUpdater) Batch() (kvstore.BatchedMutations, error) {
+	if err := a.ensureBatch(); err != nil {
+		return nil, err
+	}
+	return a.batch, nil
+}
+
+// AttachBatch makes the updater write values and trie node mutations into the batch provided by the application,
+// until the next Commit. The batch must belong to the same kvstore as the updater.
+// Then Commit does not commit the batch: the application commits it together with its own data in one transaction,
+// then calls BatchCommitted. Trie changes are visible to readers of the kvstore only after the batch is committed.
+// Until then, the updater serves nodes of the trie from its cache.
+// AttachBatch fails if the updater already has uncommitted updates
+func (a *HiveBatchedUpdater) AttachBatch(batch kvstore.BatchedMutations) error {
+	if a.batch != nil {
+		return errors.New("hive_adaptor: updater already has uncommitted updates")
+	}
+	a.setBatch(batch)
+	a.external = true
+	return nil
+}
+
+func (a *HiveBatchedUpdater) ensureBatch() error {
+	if a.batch != nil {
+		return nil
+	}
+	batch, err := a.kvs.Batched()
+	if err != nil {
+		return err
+	}
+	a.setBatch(batch)
+	return nil
+}
+
+func (a *HiveBatchedUpdater) setBatch(batch kvstore.BatchedMutations) {
+	a.batch = batch
+	a.wTrie = newBatchWriter(batch, a.layout.NodePrefix)
+	a.wValue = newBatchWriter(batch, a.layout.ValuePrefix)
+}
+
 // batchWriter implements KVWriter interface over the hive.go batch
 type batchWriter struct {
 	prefix []byte
@@ -135,20 +284,51 @@ func (b batchWriter) Set(key, value []byte) {
 }
 
 // Commit commits the tries cache and persist mutations to the batch. Then it commits the whole batch
-// as an atomic update to the underlying kvstore
+// as an atomic update to the underlying kvstore. If the batch was attached with AttachBatch, it is left
+// for the application to commit and the updater is detached from it. The cache of the trie is kept then
+// until BatchCommitted
 func (a *HiveBatchedUpdater) Commit() error {
 	if a.batch == nil {
 		return nil
 	}
 	a.trie.Commit()
 	a.trie.PersistMutations(a.wTrie)
+	if a.external {
+		a.batch = nil
+		a.external = false
+		a.pending = true
+		return nil
+	}
 	if err := a.batch.Commit(); err != nil {
+		a.warnf("hive_adaptor: batch commit failed: %v", err)
 		return err
 	}
 	if err := a.kvs.Flush(); err != nil {
+		a.warnf("hive_adaptor: flush failed: %v", err)
 		return err
 	}
-	a.trie.ClearCache()
+	if !a.pending {
+		a.trie.ClearCache()
+	}
 	a.batch = nil
 	return nil
 }
+
+// BatchCommitted must be called by the application after it commits the batch attached with AttachBatch.
+// Nodes of the trie are in the kvstore then, so the cache of the trie is cleared. Until then, the trie is read
+// from the cache, because nodes written to the uncommitted batch are not visible in the kvstore
+func (a *HiveBatchedUpdater) BatchCommitted() {
+	if !a.pending {
+		return
+	}
+	a.pending = false
+	if a.batch == nil {
+		a.trie.ClearCache()
+	}
+}
+
+func (a *HiveBatchedUpdater) warnf(format string, args ...interface{}) {
+	if a.log != nil {
+		a.log.Warnf(format, args...)
+	}
+}
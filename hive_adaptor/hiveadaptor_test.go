@@ -0,0 +1,216 @@
+package hive_adaptor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/iotaledger/hive.go/core/kvstore"
+	"github.com/iotaledger/hive.go/core/kvstore/mapdb"
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+var errTest = errors.New("test kvstore error")
+
+// failingKVStore returns error on all reads
+type failingKVStore struct {
+	kvstore.KVStore
+}
+
+func (f failingKVStore) Get(kvstore.Key) (kvstore.Value, error) {
+	return nil, errTest
+}
+
+func (f failingKVStore) Iterate(kvstore.KeyPrefix, kvstore.IteratorKeyValueConsumerFunc, ...kvstore.IterDirection) error {
+	return errTest
+}
+
+func TestHiveKVStoreAdaptor(t *testing.T) {
+	t.Run("realms", func(t *testing.T) {
+		kvs := mapdb.NewMapDB()
+		a1, err := NewHiveKVStoreAdaptorWithRealm(kvs, []byte("r1"), []byte{0x01})
+		require.NoError(t, err)
+		a2, err := NewHiveKVStoreAdaptorWithRealm(kvs, []byte("r2"), []byte{0x01})
+		require.NoError(t, err)
+		require.EqualValues(t, []byte("r1"), a1.Realm())
+
+		a1.Set([]byte("a"), []byte("1"))
+		require.EqualValues(t, []byte("1"), a1.Get([]byte("a")))
+		require.False(t, a2.Has([]byte("a")))
+		require.Nil(t, a2.Get([]byte("a")))
+		require.EqualValues(t, 1, trie.NumEntries(a1))
+		require.EqualValues(t, 0, trie.NumEntries(a2))
+	})
+	t.Run("iterate prefix", func(t *testing.T) {
+		kvs := mapdb.NewMapDB()
+		a := NewHiveKVStoreAdaptor(kvs, []byte{0x01})
+		other := NewHiveKVStoreAdaptor(kvs, []byte{0x02})
+		for i := 0; i < 100; i++ {
+			a.Set([]byte(fmt.Sprintf("k%02d", i)), []byte{byte(i)})
+			other.Set([]byte(fmt.Sprintf("k%02d", i)), []byte{byte(i)})
+		}
+		keys := make([]string, 0)
+		trie.IterateKeysPrefix(a, []byte("k1"), func(k []byte) bool {
+			keys = append(keys, string(k))
+			return true
+		})
+		require.EqualValues(t, 10, len(keys))
+		for _, k := range keys {
+			require.EqualValues(t, "k1", k[:2])
+		}
+		n := 0
+		trie.IteratePrefix(a, []byte("k2"), func(k, v []byte) bool {
+			require.EqualValues(t, a.Get(k), v)
+			n++
+			return true
+		})
+		require.EqualValues(t, 10, n)
+		require.EqualValues(t, 100, trie.NumEntries(a))
+	})
+	t.Run("errors", func(t *testing.T) {
+		a := NewHiveKVStoreAdaptor(failingKVStore{KVStore: mapdb.NewMapDB()}, []byte{0x01})
+		_, err := a.TryGet([]byte("a"))
+		require.ErrorIs(t, err, errTest)
+		_, err = a.TryHas([]byte("a"))
+		require.ErrorIs(t, err, errTest)
+		require.ErrorIs(t, a.TryIterate(func(_, _ []byte) bool { return true }), errTest)
+		require.Panics(t, func() {
+			a.Has([]byte("a"))
+		})
+		require.Panics(t, func() {
+			a.Get([]byte("a"))
+		})
+	})
+}
+
+func TestHiveBatchedUpdaterExternalBatch(t *testing.T) {
+	model := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	layout := trie.DefaultStoreLayout
+	data := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		data[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	trExpected := trie.New(model, trie.NewInMemoryKVStore(), nil)
+	for k, v := range data {
+		trExpected.Update([]byte(k), []byte(v))
+	}
+	trExpected.Commit()
+	rootExpected := trie.RootCommitment(trExpected)
+
+	t.Run("attach", func(t *testing.T) {
+		kvs := mapdb.NewMapDB()
+		upd, err := NewHiveBatchedUpdaterWithLayout(kvs, model, layout, false)
+		require.NoError(t, err)
+		batch, err := kvs.Batched()
+		require.NoError(t, err)
+		require.NoError(t, upd.AttachBatch(batch))
+		for k, v := range data {
+			upd.Update([]byte(k), []byte(v))
+		}
+		require.NoError(t, batch.Set([]byte("application"), []byte("data")))
+		require.NoError(t, upd.Commit())
+
+		nodes := NewHiveKVStoreAdaptor(kvs, layout.NodePrefix)
+		require.EqualValues(t, 0, trie.NumEntries(nodes))
+		require.NoError(t, batch.Commit())
+		upd.BatchCommitted()
+
+		require.True(t, model.EqualCommitments(rootExpected, trie.RootCommitment(trie.NewTrieReader(model, nodes, nil))))
+		values := NewHiveKVStoreAdaptor(kvs, layout.ValuePrefix)
+		require.EqualValues(t, len(data), trie.NumEntries(values))
+		v, err := kvs.Get([]byte("application"))
+		require.NoError(t, err)
+		require.EqualValues(t, "data", string(v))
+	})
+	t.Run("read before the batch is committed", func(t *testing.T) {
+		kvs := mapdb.NewMapDB()
+		upd, err := NewHiveBatchedUpdaterWithLayout(kvs, model, layout, false)
+		require.NoError(t, err)
+		batch, err := kvs.Batched()
+		require.NoError(t, err)
+		require.NoError(t, upd.AttachBatch(batch))
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		half := len(keys) / 2
+		trHalf := trie.New(model, trie.NewInMemoryKVStore(), nil)
+		for _, k := range keys[:half] {
+			upd.Update([]byte(k), []byte(data[k]))
+			trHalf.Update([]byte(k), []byte(data[k]))
+		}
+		trHalf.Commit()
+		require.NoError(t, upd.Commit())
+
+		// nodes are not in the kvstore yet, the trie is read from the cache
+		nodes := NewHiveKVStoreAdaptor(kvs, layout.NodePrefix)
+		require.EqualValues(t, 0, trie.NumEntries(nodes))
+		require.True(t, model.EqualCommitments(trie.RootCommitment(trHalf), trie.RootCommitment(upd.trie)))
+		require.True(t, trie.HasMany(upd.trie, [][]byte{[]byte(keys[0])})[0])
+		// updates read nodes of the trie too. They go to the next batch of the updater
+		for _, k := range keys[half:] {
+			upd.Update([]byte(k), []byte(data[k]))
+		}
+		require.NoError(t, batch.Commit())
+		upd.BatchCommitted()
+		require.NoError(t, upd.Commit())
+		require.True(t, model.EqualCommitments(rootExpected, trie.RootCommitment(trie.NewTrieReader(model, nodes, nil))))
+		require.True(t, model.EqualCommitments(rootExpected, trie.RootCommitment(upd.trie)))
+	})
+	t.Run("expose", func(t *testing.T) {
+		kvs := mapdb.NewMapDB()
+		upd, err := NewHiveBatchedUpdaterWithLayout(kvs, model, layout, false)
+		require.NoError(t, err)
+		for k, v := range data {
+			upd.Update([]byte(k), []byte(v))
+		}
+		batch, err := upd.Batch()
+		require.NoError(t, err)
+		require.Error(t, upd.AttachBatch(batch))
+		require.NoError(t, batch.Set([]byte("application"), []byte("data")))
+		require.NoError(t, upd.Commit())
+
+		nodes := NewHiveKVStoreAdaptor(kvs, layout.NodePrefix)
+		require.True(t, model.EqualCommitments(rootExpected, trie.RootCommitment(trie.NewTrieReader(model, nodes, nil))))
+		v, err := kvs.Get([]byte("application"))
+		require.NoError(t, err)
+		require.EqualValues(t, "data", string(v))
+	})
+}
+
+func TestRebuildFromValues(t *testing.T) {
+	model := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	layout := trie.DefaultStoreLayout
+	kvs := mapdb.NewMapDB()
+	upd, err := NewHiveBatchedUpdaterWithLayout(kvs, model, layout, false)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		upd.Update([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d-which-is-longer-than-the-hash", i)))
+	}
+	require.NoError(t, upd.Commit())
+
+	nodes := NewHiveKVStoreAdaptor(kvs, layout.NodePrefix)
+	values := NewHiveKVStoreAdaptor(kvs, layout.ValuePrefix)
+	root := trie.RootCommitment(trie.NewTrieReader(model, nodes, values))
+	lost := make(map[string][]byte)
+	nodes.Iterate(func(k, v []byte) bool {
+		lost[string(k)] = append([]byte{}, v...)
+		return true
+	})
+	for k := range lost {
+		nodes.Set([]byte(k), nil)
+	}
+	require.EqualValues(t, 0, trie.NumEntries(nodes))
+
+	stats, err := trie.RebuildFromValues(values, model, nodes, trie.RebuildOptions{ExpectedRoot: root})
+	require.NoError(t, err)
+	require.EqualValues(t, 100, stats.Keys)
+	require.True(t, model.EqualCommitments(root, stats.Root))
+	// the lost partition is restored byte by byte
+	require.EqualValues(t, len(lost), trie.NumEntries(nodes))
+	for k, v := range lost {
+		require.EqualValues(t, v, nodes.Get([]byte(k)))
+	}
+}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// Fuzz targets check that decoding of nodes and proofs from untrusted bytes never panics.
+// Seed corpora are generated from real tries. Run with, for example:
+//
+//	go test ./models/tests -run XXX -fuzz FuzzNodeDataFromBytes -fuzztime 60s
+
+var fuzzModels = []trie.CommitmentModel{
+	trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160),
+	trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256, 10),
+	trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256),
+	trie_blake2b.NewWithParams(trie.PathArity16, trie_blake2b.HashSize160, trie_blake2b.Params{Aggregator: trie_blake2b.SumAggregator}),
+	trie_kzg_bn256.New(),
+}
+
+// fuzzTrie returns the committed trie with some keys, its store and the value store
+func fuzzTrie(m trie.CommitmentModel) (*trie.Trie, trie.KVStore, trie.KVStore) {
+	store, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+	tr := trie.New(m, store, valueStore)
+	for _, s := range []string{"", "a", "ab", "abc", "abd", "b", "bcdefghijklmnopqrstuvwxyz0123456789", "c"} {
+		tr.UpdateStr(s, s+"-value")
+		valueStore.Set([]byte(s), []byte(s+"-value"))
+	}
+	tr.Commit()
+	tr.PersistMutations(store)
+	return tr, store, valueStore
+}
+
+func FuzzNodeDataFromBytes(f *testing.F) {
+	for i, m := range fuzzModels {
+		_, store, _ := fuzzTrie(m)
+		store.Iterate(func(k, v []byte) bool {
+			f.Add(byte(i), k, v)
+			return true
+		})
+	}
+	valueStores := make([]trie.KVStore, len(fuzzModels))
+	for i, m := range fuzzModels {
+		_, _, valueStores[i] = fuzzTrie(m)
+	}
+	f.Fuzz(func(t *testing.T, modelIndex byte, encodedKey, data []byte) {
+		i := int(modelIndex) % len(fuzzModels)
+		m := fuzzModels[i]
+		unpackedKey, err := trie.DecodeToUnpackedBytes(encodedKey, m.PathArity())
+		if err != nil {
+			return
+		}
+		n, err := trie.NodeDataFromBytes(m, data, unpackedKey, m.PathArity(), valueStores[i])
+		if err != nil {
+			return
+		}
+		m.CalcNodeCommitment(n)
+	})
+}
+
+func FuzzCBORNodeDataFromBytes(f *testing.F) {
+	valueStores := make([]trie.KVStore, len(fuzzModels))
+	for i, m := range fuzzModels {
+		store, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+		tr := trie.NewWithOptions(m, store, valueStore, trie.Options{Codec: trie.CBORCodec})
+		for _, s := range []string{"", "a", "ab", "abc", "abd", "b", "bcdefghijklmnopqrstuvwxyz0123456789", "c"} {
+			tr.UpdateStr(s, s+"-value")
+			valueStore.Set([]byte(s), []byte(s+"-value"))
+		}
+		tr.Commit()
+		tr.PersistMutations(store)
+		store.Iterate(func(k, v []byte) bool {
+			f.Add(byte(i), k, v)
+			return true
+		})
+		valueStores[i] = valueStore
+	}
+	f.Fuzz(func(t *testing.T, modelIndex byte, encodedKey, data []byte) {
+		i := int(modelIndex) % len(fuzzModels)
+		m := fuzzModels[i]
+		unpackedKey, err := trie.DecodeToUnpackedBytes(encodedKey, m.PathArity())
+		if err != nil {
+			return
+		}
+		n, err := trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, data, unpackedKey, m.PathArity(), valueStores[i])
+		if err != nil {
+			return
+		}
+		m.CalcNodeCommitment(n)
+	})
+}
+
+func FuzzDecodeToUnpackedBytes(f *testing.F) {
+	for _, arity := range []trie.PathArity{trie.PathArity256, trie.PathArity16, trie.PathArity2} {
+		for _, s := range []string{"", "a", "abc"} {
+			encoded, err := trie.EncodeUnpackedBytes(trie.UnpackBytes([]byte(s), arity), arity)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(byte(arity), encoded)
+		}
+	}
+	f.Fuzz(func(t *testing.T, arity byte, encoded []byte) {
+		unpacked, err := trie.DecodeToUnpackedBytes(encoded, trie.PathArity(arity))
+		if err != nil {
+			return
+		}
+		if _, err = trie.EncodeUnpackedBytes(unpacked, trie.PathArity(arity)); err != nil {
+			t.Fatalf("decoded bytes can't be encoded: %v", err)
+		}
+	})
+}
+
+func FuzzBlake2bProofFromBytes(f *testing.F) {
+	var roots [][]byte
+	for _, m := range fuzzModels {
+		b2b, ok := m.(*trie_blake2b.CommitmentModel)
+		if !ok {
+			continue
+		}
+		tr, _, _ := fuzzTrie(m)
+		roots = append(roots, trie.RootCommitment(tr).Bytes())
+		for _, k := range []string{"", "a", "abc", "abx", "bcd", "z"} {
+			p := b2b.Proof([]byte(k), tr)
+			f.Add(p.Bytes())
+			p.Compact = true
+			f.Add(p.Bytes())
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := trie_blake2b.ProofFromBytes(data)
+		if err != nil {
+			return
+		}
+		for _, root := range roots {
+			if trie_blake2b_verify.Validate(p, root) == nil {
+				trie_blake2b_verify.IsProofOfAbsence(p)
+			}
+			_ = trie_blake2b_verify.ValidateConstantTime(p, root)
+			_, _ = trie_blake2b_verify.ValidateAggregate(p, root)
+		}
+	})
+}
+
+func FuzzKZGProofFromBytes(f *testing.F) {
+	m := trie_kzg_bn256.New()
+	tr, _, _ := fuzzTrie(m)
+	for _, k := range []string{"", "a", "abc"} {
+		p, ok := m.ProofOfInclusion([]byte(k), tr)
+		if ok {
+			f.Add(p.Bytes())
+		}
+	}
+	root := trie.RootCommitment(tr)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := trie_kzg_bn256.ProofOfInclusionFromBytes(data)
+		if err != nil {
+			return
+		}
+		_ = p.Validate(root)
+	})
+}
+
+func FuzzKZGMultiProofFromBytes(f *testing.F) {
+	m := trie_kzg_bn256.New()
+	tr, _, _ := fuzzTrie(m)
+	if p, ok := m.MultiProof([][]byte{[]byte("a"), []byte("abc")}, tr); ok {
+		f.Add(p.Bytes())
+	}
+	root := trie.RootCommitment(tr)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := trie_kzg_bn256.MultiProofFromBytes(data)
+		if err != nil {
+			return
+		}
+		_ = p.Validate(root)
+	})
+}
@@ -2,11 +2,20 @@ package tests
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/iotaledger/trie.go/models/trie_blake2b"
 	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
 	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/models/trie_vectors"
+	"github.com/iotaledger/trie.go/models/trie_verify"
+	"github.com/iotaledger/trie.go/proofarchive"
 	"github.com/iotaledger/trie.go/trie"
 	"github.com/stretchr/testify/require"
 )
@@ -588,3 +597,1060 @@ func TestTrieProofKZG(t *testing.T) {
 		}
 	})
 }
+
+func TestTrieMultiProofKZG(t *testing.T) {
+	Model := trie_kzg_bn256.New()
+	store := trie.NewInMemoryKVStore()
+	tr := trie.New(Model, store, nil)
+
+	data := []string{"a", "ab", "abc", "ac", "acb", "adb", "bcdddd", "bcddde", "x", "xyz"}
+	for _, d := range data {
+		tr.Update([]byte(d), []byte("1"+d))
+	}
+	tr.Commit()
+	rootC := trie.RootCommitment(tr)
+
+	keys := make([][]byte, len(data))
+	values := make([][]byte, len(data))
+	for i, d := range data {
+		keys[i] = []byte(d)
+		values[i] = []byte("1" + d)
+	}
+	t.Run("validate", func(t *testing.T) {
+		proof, ok := Model.MultiProof(keys, tr)
+		require.True(t, ok)
+		require.NoError(t, proof.Validate(rootC))
+		require.NoError(t, proof.Validate(rootC, values...))
+
+		sizeSingle := 0
+		for _, k := range keys {
+			poi, ok := Model.ProofOfInclusion(k, tr)
+			require.True(t, ok)
+			sizeSingle += trie.MustSize(poi)
+		}
+		t.Logf("multiproof size = %d bytes, sum of proofs of inclusion = %d bytes", trie.MustSize(proof), sizeSingle)
+		require.Less(t, trie.MustSize(proof), sizeSingle)
+	})
+	t.Run("serialize", func(t *testing.T) {
+		proof, ok := Model.MultiProof(keys, tr)
+		require.True(t, ok)
+		back, err := trie_kzg_bn256.MultiProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		require.EqualValues(t, proof.Bytes(), back.Bytes())
+		require.NoError(t, back.Validate(rootC, values...))
+	})
+	t.Run("reject", func(t *testing.T) {
+		proof, ok := Model.MultiProof(keys, tr)
+		require.True(t, ok)
+
+		wrongValues := append([][]byte{}, values...)
+		wrongValues[3] = []byte("wrong")
+		require.Error(t, proof.Validate(rootC, wrongValues...))
+
+		tr.UpdateStr("zzz", "1")
+		tr.Commit()
+		require.Error(t, proof.Validate(trie.RootCommitment(tr)))
+		tr.DeleteStr("zzz")
+		tr.Commit()
+
+		tampered, err := trie_kzg_bn256.MultiProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		tampered.Terminals[1] = tampered.Terminals[2]
+		require.Error(t, tampered.Validate(rootC))
+
+		tampered, err = trie_kzg_bn256.MultiProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		tampered.Pi = tampered.D
+		require.Error(t, tampered.Validate(rootC))
+
+		tampered, err = trie_kzg_bn256.MultiProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		tampered.Paths[0][0].Commitment = uint16(len(tampered.Commitments))
+		require.Error(t, tampered.Validate(rootC))
+
+		// keys are bound to paths, path fragments are opened
+		tampered, err = trie_kzg_bn256.MultiProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		tampered.Keys[0] = []byte("b")
+		require.Error(t, tampered.Validate(rootC))
+
+		tampered, err = trie_kzg_bn256.MultiProofFromBytes(proof.Bytes())
+		require.NoError(t, err)
+		tampered.Keys[6] = []byte("bcddddx")
+		tampered.Fragments[tampered.Paths[6][len(tampered.Paths[6])-1].Commitment] = []byte("x")
+		require.Error(t, tampered.Validate(rootC))
+
+		_, ok = Model.MultiProof([][]byte{[]byte("a"), []byte("absent")}, tr)
+		require.False(t, ok)
+	})
+}
+
+func TestKeyWithTerminal(t *testing.T) {
+	for _, arity := range trie.AllPathArity {
+		model := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run("key with terminal"+tn(model), func(t *testing.T) {
+			tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+			for _, s := range genData2()[:100] {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+
+			proof := model.Proof([]byte(genData2()[0]), tr)
+			key, terminal, err := trie_blake2b_verify.KeyWithTerminal(proof)
+			require.NoError(t, err)
+			keyMust, terminalMust := trie_blake2b_verify.MustKeyWithTerminal(proof)
+			require.EqualValues(t, keyMust, key)
+			require.EqualValues(t, terminalMust, terminal)
+			require.NotNil(t, terminal)
+
+			// malformed last element is an error, not a panic
+			last := proof.Path[len(proof.Path)-1]
+			last.ChildIndex = arity.PathFragmentCommitmentIndex() + 1
+			_, _, err = trie_blake2b_verify.KeyWithTerminal(proof)
+			require.Error(t, err)
+			require.Panics(t, func() {
+				trie_blake2b_verify.MustKeyWithTerminal(proof)
+			})
+			require.Error(t, trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte(genData2()[0]+"$")))
+
+			proof.Compact = true
+			_, err = trie.Bytes(proof)
+			require.Error(t, err)
+			require.Panics(t, func() {
+				proof.Bytes()
+			})
+		})
+	}
+}
+
+func TestTrieProofEmptyValue(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("proof empty value"+tn(model), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(model, store, nil, trie.Options{AllowEmptyValues: true})
+			tr.Update([]byte("a"), []byte("a"))
+			tr.Update([]byte("ab"), []byte{})
+			tr.Update([]byte("abc"), []byte("abc"))
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+
+			proof := model.Proof([]byte("ab"), tr)
+			err := trie_blake2b_verify.Validate(proof, rootC.Bytes())
+			require.NoError(t, err)
+			require.False(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+			err = trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte{})
+			require.NoError(t, err)
+			err = trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte("ab"))
+			require.Error(t, err)
+
+			proofBack, err := trie_blake2b.ProofFromBytes(proof.Bytes())
+			require.NoError(t, err)
+			err = trie_blake2b_verify.ValidateWithValue(proofBack, rootC.Bytes(), []byte{})
+			require.NoError(t, err)
+
+			tr.Update([]byte("ab"), nil)
+			tr.Commit()
+			rootC = trie.RootCommitment(tr)
+			proof = model.Proof([]byte("ab"), tr)
+			err = trie_blake2b_verify.Validate(proof, rootC.Bytes())
+			require.NoError(t, err)
+			require.True(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestTrieProofSalt(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.NewWithSalt(arity, sz, []byte("application 1"))
+		t.Run("proof salt"+tn(model), func(t *testing.T) {
+			data := genData1()
+			mkRoot := func(m trie.CommitmentModel) trie.VCommitment {
+				tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+				for _, d := range data {
+					tr.Update([]byte(d), []byte(d+"++++++++++++++++++++++++++++++++++"))
+				}
+				tr.Commit()
+				return trie.RootCommitment(tr)
+			}
+			rootNoSalt := mkRoot(trie_blake2b.New(arity, sz))
+			rootOther := mkRoot(trie_blake2b.NewWithSalt(arity, sz, []byte("application 2")))
+			require.EqualValues(t, rootNoSalt, mkRoot(trie_blake2b.NewWithSalt(arity, sz, nil)))
+
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(model, store, nil)
+			for _, d := range data {
+				tr.Update([]byte(d), []byte(d+"++++++++++++++++++++++++++++++++++"))
+			}
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+			require.False(t, model.EqualCommitments(rootC, rootNoSalt))
+			require.False(t, model.EqualCommitments(rootC, rootOther))
+
+			for _, d := range data {
+				proof := model.Proof([]byte(d), tr)
+				require.EqualValues(t, []byte("application 1"), proof.Salt)
+				err := trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte(d+"++++++++++++++++++++++++++++++++++"))
+				require.NoError(t, err)
+
+				proofBack, err := trie_blake2b.ProofFromBytes(proof.Bytes())
+				require.NoError(t, err)
+				require.EqualValues(t, proof.Salt, proofBack.Salt)
+				err = trie_blake2b_verify.ValidateWithValue(proofBack, rootC.Bytes(), []byte(d+"++++++++++++++++++++++++++++++++++"))
+				require.NoError(t, err)
+
+				proofBack.Salt = nil
+				err = trie_blake2b_verify.Validate(proofBack, rootC.Bytes())
+				require.Error(t, err)
+			}
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestTrieProofHashParams(t *testing.T) {
+	const suffix = "++++++++++++++++++++++++++++++++++"
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize, params trie_blake2b.Params) {
+		model := trie_blake2b.NewWithParams(arity, sz, params)
+		t.Run("proof hash params"+tn(model), func(t *testing.T) {
+			data := genData1()
+			mkRoot := func(m trie.CommitmentModel) trie.VCommitment {
+				tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+				for _, d := range data {
+					tr.Update([]byte(d), []byte(d+suffix))
+				}
+				tr.Commit()
+				return trie.RootCommitment(tr)
+			}
+			rootC := mkRoot(model)
+			require.EqualValues(t, sz, len(rootC.Bytes()))
+			require.False(t, model.EqualCommitments(rootC, mkRoot(trie_blake2b.NewWithSalt(arity, sz, params.Salt))))
+			other := trie_blake2b.Params{Salt: params.Salt, Personalization: []byte("other")}
+			require.False(t, model.EqualCommitments(rootC, mkRoot(trie_blake2b.NewWithParams(arity, sz, other))))
+
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(model, store, nil)
+			for _, d := range data {
+				tr.Update([]byte(d), []byte(d+suffix))
+			}
+			tr.Commit()
+			for _, d := range data {
+				proof := model.Proof([]byte(d), tr)
+				require.EqualValues(t, params.Personalization, proof.Personalization)
+				err := trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte(d+suffix))
+				require.NoError(t, err)
+
+				for _, compact := range []bool{false, true} {
+					proof.Compact = compact
+					proofBack, err := trie_blake2b.ProofFromBytes(proof.Bytes())
+					require.NoError(t, err)
+					require.EqualValues(t, sz, proofBack.HashSize)
+					require.EqualValues(t, proof.Salt, proofBack.Salt)
+					require.EqualValues(t, proof.Personalization, proofBack.Personalization)
+					err = trie_blake2b_verify.ValidateWithValue(proofBack, rootC.Bytes(), []byte(d+suffix))
+					require.NoError(t, err)
+
+					proofBack.Personalization = nil
+					err = trie_blake2b_verify.Validate(proofBack, rootC.Bytes())
+					require.Error(t, err)
+				}
+			}
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range []trie_blake2b.HashSize{trie_blake2b.HashSize128, trie_blake2b.HashSize192, trie_blake2b.HashSize256} {
+			runTest(arity, sz, trie_blake2b.Params{Personalization: []byte("trie.go")})
+			runTest(arity, sz, trie_blake2b.Params{Salt: []byte("application 1"), Personalization: []byte("trie.go")})
+		}
+	}
+	require.Panics(t, func() {
+		trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize(17))
+	})
+	require.Panics(t, func() {
+		trie_blake2b.NewWithParams(trie.PathArity16, trie_blake2b.HashSize160, trie_blake2b.Params{Personalization: make([]byte, 17)})
+	})
+}
+
+func TestTrieProofChildOrder(t *testing.T) {
+	const suffix = "++++++++++++++++++++++++++++++++++"
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize, order trie_blake2b.ChildOrder) {
+		model := trie_blake2b.NewWithParams(arity, sz, trie_blake2b.Params{ChildOrder: order})
+		t.Run("proof child order "+order.String()+tn(model), func(t *testing.T) {
+			data := genData1()
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(model, store, nil)
+			trDefault := trie.New(trie_blake2b.New(arity, sz), trie.NewInMemoryKVStore(), nil)
+			for _, d := range data {
+				tr.Update([]byte(d), []byte(d+suffix))
+				trDefault.Update([]byte(d), []byte(d+suffix))
+			}
+			tr.Commit()
+			trDefault.Commit()
+			rootC := trie.RootCommitment(tr)
+			// for the binary trie, bit reversed order is same as ascending
+			sameAsDefault := order == trie_blake2b.ChildOrderAscending ||
+				(order == trie_blake2b.ChildOrderBitReversed && arity == trie.PathArity2)
+			require.EqualValues(t, sameAsDefault, model.EqualCommitments(rootC, trie.RootCommitment(trDefault)))
+
+			for _, d := range data {
+				proof := model.Proof([]byte(d), tr)
+				require.EqualValues(t, order, proof.ChildOrder)
+				err := trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte(d+suffix))
+				require.NoError(t, err)
+
+				for _, compact := range []bool{false, true} {
+					proof.Compact = compact
+					proofBack, err := trie_blake2b.ProofFromBytes(proof.Bytes())
+					require.NoError(t, err)
+					require.EqualValues(t, order, proofBack.ChildOrder)
+					err = trie_blake2b_verify.ValidateWithValue(proofBack, rootC.Bytes(), []byte(d+suffix))
+					require.NoError(t, err)
+				}
+			}
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz, trie_blake2b.ChildOrderAscending)
+			runTest(arity, sz, trie_blake2b.ChildOrderDescending)
+			runTest(arity, sz, trie_blake2b.ChildOrderBitReversed)
+		}
+	}
+	// proofs of the default order are serialized same way as before
+	model := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+	tr.UpdateStr("a", "1")
+	tr.Commit()
+	require.EqualValues(t, trie_blake2b.HashSize160, model.Proof([]byte("a"), tr).Bytes()[1])
+	require.Panics(t, func() {
+		trie_blake2b.NewWithParams(trie.PathArity16, trie_blake2b.HashSize160, trie_blake2b.Params{ChildOrder: trie_blake2b.ChildOrder(3)})
+	})
+}
+
+func TestGetWithProof(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("get with proof"+tn(model), func(t *testing.T) {
+			data := genData2()
+			trieStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(model, trieStore, valueStore)
+			for _, d := range data {
+				tr.Update([]byte(d), []byte(d+"value"))
+				valueStore.Set([]byte(d), []byte(d+"value"))
+			}
+			tr.Commit()
+			tr.PersistMutations(trieStore)
+			rootC := trie.RootCommitment(tr)
+
+			trr := trie.NewTrieReader(model, trieStore, valueStore)
+			for _, d := range data {
+				value, proof := model.GetWithProof([]byte(d), trr)
+				require.EqualValues(t, []byte(d+"value"), value)
+				require.EqualValues(t, model.Proof([]byte(d), trr).Bytes(), proof.Bytes())
+				err := trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), value)
+				require.NoError(t, err)
+			}
+			value, proof := model.GetWithProof([]byte("absent key"), trr)
+			require.Nil(t, value)
+			err := trie_blake2b_verify.Validate(proof, rootC.Bytes())
+			require.NoError(t, err)
+			require.True(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestMetadataProof(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("metadata proof"+tn(model), func(t *testing.T) {
+			trieStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(model, trieStore, valueStore)
+			for _, d := range genData1() {
+				tr.Update([]byte(d), []byte(d+"value"))
+				valueStore.Set([]byte(d), []byte(d+"value"))
+			}
+			tr.Commit()
+			rootNoMetadata := trie.RootCommitment(tr)
+
+			md := &trie.Metadata{StateIndex: 314, Timestamp: 1_000_000_000, Data: []byte("block info")}
+			tr.SetMetadata(md, valueStore)
+			tr.Commit()
+			tr.PersistMutations(trieStore)
+			rootC := trie.RootCommitment(tr)
+			require.False(t, model.EqualCommitments(rootNoMetadata, rootC))
+
+			trr := trie.NewTrieReader(model, trieStore, valueStore)
+			mdBack, err := trr.GetMetadata()
+			require.NoError(t, err)
+			require.EqualValues(t, md, mdBack)
+
+			proof := model.MetadataProof(trr)
+			err = trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), mdBack.Bytes())
+			require.NoError(t, err)
+			mdBack.StateIndex++
+			err = trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), mdBack.Bytes())
+			require.Error(t, err)
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestProofArchive(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("proof archive"+tn(model), func(t *testing.T) {
+			data := genData2()[:300]
+			tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+
+			fname := filepath.Join(t.TempDir(), "proofs.arch")
+			w, err := proofarchive.Create(fname, model.ShortName(), rootC.Bytes())
+			require.NoError(t, err)
+			for _, s := range data {
+				err = w.Write([]byte(s), model.Proof([]byte(s), tr).Bytes())
+				require.NoError(t, err)
+			}
+			// proof of absence
+			err = w.Write([]byte("absent"), model.Proof([]byte("absent"), tr).Bytes())
+			require.NoError(t, err)
+			err = w.Write([]byte(data[0]), nil)
+			require.ErrorIs(t, err, proofarchive.ErrDuplicateKey)
+			require.NoError(t, w.Close())
+
+			r, err := proofarchive.Open(fname)
+			require.NoError(t, err)
+			defer func() { _ = r.Close() }()
+
+			require.EqualValues(t, model.ShortName(), r.ModelName())
+			require.EqualValues(t, rootC.Bytes(), r.Root())
+			require.EqualValues(t, len(data)+1, r.Len())
+
+			validate := func(key, proofBin, root []byte) error {
+				proof, err := trie_blake2b.ProofFromBytes(proofBin)
+				if err != nil {
+					return err
+				}
+				return trie_blake2b_verify.Validate(proof, root)
+			}
+			require.NoError(t, r.Validate(validate))
+
+			proofBin, err := r.Proof([]byte(data[5]))
+			require.NoError(t, err)
+			proof, err := trie_blake2b.ProofFromBytes(proofBin)
+			require.NoError(t, err)
+			err = trie_blake2b_verify.ValidateWithValue(proof, r.Root(), []byte(data[5]+"$"))
+			require.NoError(t, err)
+
+			proofBin, err = r.Proof([]byte("absent"))
+			require.NoError(t, err)
+			proof, err = trie_blake2b.ProofFromBytes(proofBin)
+			require.NoError(t, err)
+			require.True(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+
+			_, err = r.Proof([]byte("not in archive"))
+			require.ErrorIs(t, err, proofarchive.ErrKeyNotFound)
+
+			err = r.Validate(func(key, proofBin, _ []byte) error {
+				return validate(key, proofBin, model.NewVectorCommitment().Bytes())
+			})
+			require.ErrorIs(t, err, proofarchive.ErrProofNotValid)
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestProofArchiveCorrupted(t *testing.T) {
+	model := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256)
+	tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+	data := genData1()[:10]
+	for _, s := range data {
+		tr.UpdateStr(s, s+"$")
+	}
+	tr.Commit()
+
+	var buf bytes.Buffer
+	w, err := proofarchive.NewWriter(&buf, model.ShortName(), trie.RootCommitment(tr).Bytes())
+	require.NoError(t, err)
+	for _, s := range data {
+		require.NoError(t, w.Write([]byte(s), model.Proof([]byte(s), tr).Bytes()))
+	}
+	require.NoError(t, w.Close())
+	archive := buf.Bytes()
+	indexOffset := binary.LittleEndian.Uint64(archive[len(archive)-8:])
+
+	// corrupt returns a copy of the archive modified by the function
+	corrupt := func(f func(a []byte)) []byte {
+		ret := append([]byte{}, archive...)
+		f(ret)
+		return ret
+	}
+	open := func(a []byte) (*proofarchive.Reader, error) {
+		return proofarchive.NewReader(bytes.NewReader(a), int64(len(a)))
+	}
+	r, err := open(archive)
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), r.Len())
+
+	t.Run("number of records", func(t *testing.T) {
+		_, err := open(corrupt(func(a []byte) {
+			binary.LittleEndian.PutUint32(a[indexOffset:], math.MaxUint32)
+		}))
+		require.ErrorIs(t, err, proofarchive.ErrWrongFormat)
+	})
+	// offset of the first record follows its key in the index
+	firstOffset := indexOffset + 4 + 2 + uint64(len(r.Keys()[0]))
+	t.Run("record offset", func(t *testing.T) {
+		_, err := open(corrupt(func(a []byte) {
+			binary.LittleEndian.PutUint64(a[firstOffset:], math.MaxUint64-1)
+		}))
+		require.ErrorIs(t, err, proofarchive.ErrWrongFormat)
+		_, err = open(corrupt(func(a []byte) {
+			binary.LittleEndian.PutUint64(a[firstOffset:], 0)
+		}))
+		require.ErrorIs(t, err, proofarchive.ErrWrongFormat)
+	})
+	t.Run("index offset", func(t *testing.T) {
+		_, err := open(corrupt(func(a []byte) {
+			binary.LittleEndian.PutUint64(a[len(a)-8:], 1)
+		}))
+		require.ErrorIs(t, err, proofarchive.ErrWrongFormat)
+	})
+	t.Run("proof length", func(t *testing.T) {
+		key := r.Keys()[0]
+		off := binary.LittleEndian.Uint64(archive[firstOffset:])
+		rc, err := open(corrupt(func(a []byte) {
+			binary.LittleEndian.PutUint32(a[off+2+uint64(len(key)):], math.MaxUint32)
+		}))
+		require.NoError(t, err)
+		_, err = rc.Proof(key)
+		require.ErrorIs(t, err, proofarchive.ErrWrongFormat)
+	})
+}
+
+func TestGenerateProofs(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("generate proofs"+tn(model), func(t *testing.T) {
+			data := genData2()[:500]
+			tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+
+			keys := make([][]byte, 0, len(data)+1)
+			for _, s := range data {
+				keys = append(keys, []byte(s))
+			}
+			keys = append(keys, []byte("absent"))
+
+			proofs := model.GenerateProofs(keys, tr, 8)
+			require.EqualValues(t, len(keys), len(proofs))
+			for i, p := range proofs {
+				require.EqualValues(t, model.Proof(keys[i], tr).Bytes(), p.Bytes())
+				require.NoError(t, trie_blake2b_verify.Validate(p, rootC.Bytes()))
+			}
+			require.True(t, trie_blake2b_verify.IsProofOfAbsence(proofs[len(proofs)-1]))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestStreamProofs(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("stream proofs"+tn(model), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				if len(s) > 0 {
+					tr.UpdateStr(s, s+"$")
+				}
+			}
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+
+			for _, prefix := range []string{"", "a", "ab", "absent"} {
+				expected := make([][]byte, 0)
+				err := tr.IteratePrefixDepth([]byte(prefix), math.MaxInt32, func(key []byte, _ trie.TCommitment) bool {
+					expected = append(expected, key)
+					return true
+				})
+				require.NoError(t, err)
+
+				var buf bytes.Buffer
+				n, err := model.StreamProofs([]byte(prefix), tr, &buf)
+				require.NoError(t, err)
+				require.EqualValues(t, len(expected), n)
+
+				streamSize := buf.Len()
+				rdr, err := trie_blake2b.NewProofStreamReader(&buf)
+				require.NoError(t, err)
+				var sizeSeparate int
+				for _, key := range expected {
+					p, err := rdr.Next()
+					require.NoError(t, err)
+					require.EqualValues(t, trie.UnpackBytes(key, arity), p.Key)
+					err = trie_blake2b_verify.ValidateWithValue(p, rootC.Bytes(), trie.Concat(key, "$"))
+					require.NoError(t, err)
+
+					single := model.Proof(key, tr)
+					single.Compact = true
+					require.EqualValues(t, single.Bytes(), p.Bytes())
+					sizeSeparate += len(single.Bytes())
+				}
+				_, err = rdr.Next()
+				require.ErrorIs(t, err, io.EOF)
+				if len(expected) > 1 {
+					require.True(t, streamSize < sizeSeparate)
+					t.Logf("prefix '%s', %d keys: stream %d bytes, separate proofs %d bytes",
+						prefix, len(expected), streamSize, sizeSeparate)
+				}
+			}
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestTrieProofCompact(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("proof compact"+tn(model), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(model, store, nil)
+			for _, d := range data {
+				tr.UpdateStr(d, d+"$")
+			}
+			tr.Commit()
+			rootC := trie.RootCommitment(tr)
+
+			var sizeLegacy, sizeCompact int
+			for _, d := range append(data[:100], "absent key") {
+				proof := model.Proof([]byte(d), tr)
+				legacy := proof.Bytes()
+				proof.Compact = true
+				compact := proof.Bytes()
+				sizeLegacy += len(legacy)
+				sizeCompact += len(compact)
+
+				for _, b := range [][]byte{legacy, compact} {
+					proofBack, err := trie_blake2b.ProofFromBytes(b)
+					require.NoError(t, err)
+					require.EqualValues(t, b, proofBack.Bytes())
+					err = trie_blake2b_verify.Validate(proofBack, rootC.Bytes())
+					require.NoError(t, err)
+					if d != "absent key" {
+						err = trie_blake2b_verify.ValidateWithValue(proofBack, rootC.Bytes(), []byte(d+"$"))
+						require.NoError(t, err)
+					} else {
+						require.True(t, trie_blake2b_verify.IsProofOfAbsence(proofBack))
+					}
+				}
+			}
+			require.True(t, sizeCompact < sizeLegacy)
+			t.Logf("total proof size: legacy %d, compact %d bytes (-%d%%)",
+				sizeLegacy, sizeCompact, 100-sizeCompact*100/sizeLegacy)
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestTrieProofAnchored(t *testing.T) {
+	runTest := func(arity trie.PathArity, sz trie_blake2b.HashSize) {
+		model := trie_blake2b.New(arity, sz)
+		t.Run("proof anchored"+tn(model), func(t *testing.T) {
+			anchor := []byte("account1/")
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(model, store, nil)
+			namespace := make([]string, 0)
+			for _, d := range genRnd4()[:1000] {
+				tr.UpdateStr(d, d+"$")
+				tr.UpdateStr(string(anchor)+d, d+"$")
+				namespace = append(namespace, d)
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			rdr := trie.NewTrieReader(model, store, nil)
+
+			anchorC, _, ok := rdr.CommitmentAt(anchor)
+			require.True(t, ok)
+			for _, d := range namespace[:100] {
+				key := []byte(string(anchor) + d)
+				proof := model.ProofAnchored(key, anchor, rdr)
+				require.NotNil(t, proof)
+				require.True(t, len(proof.Path) < len(model.Proof(key, rdr).Path))
+				proofBack, err := trie_blake2b.ProofFromBytes(proof.Bytes())
+				require.NoError(t, err)
+				err = trie_blake2b_verify.ValidateWithValue(proofBack, anchorC.Bytes(), []byte(d+"$"))
+				require.NoError(t, err)
+				err = trie_blake2b_verify.Validate(proofBack, trie.RootCommitment(rdr).Bytes())
+				require.Error(t, err)
+			}
+			proof := model.ProofAnchored([]byte(string(anchor)+"absent key"), anchor, rdr)
+			require.NoError(t, trie_blake2b_verify.Validate(proof, anchorC.Bytes()))
+			require.True(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+
+			require.Nil(t, model.ProofAnchored([]byte(namespace[0]), anchor, rdr))
+			require.Nil(t, model.ProofAnchored([]byte("account2/a"), []byte("account2/"), rdr))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, sz := range trie_blake2b.AllHashSize {
+			runTest(arity, sz)
+		}
+	}
+}
+
+func TestChunkedValue(t *testing.T) {
+	runTest := func(arity trie.PathArity, chunkSize, valueSize int) {
+		model := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(fmt.Sprintf("chunked value %d/%d%s", chunkSize, valueSize, tn(model)), func(t *testing.T) {
+			value := make([]byte, valueSize)
+			for i := range value {
+				value[i] = byte(i*31 + i/7)
+			}
+			trieStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			chunkStore := trie.NewInMemoryKVStore()
+			tr := trie.New(model, trieStore, valueStore)
+			data := genData1()
+			for _, d := range data {
+				tr.UpdateStr(d, d+"++")
+				valueStore.Set([]byte(d), []byte(d+"++"))
+			}
+			key := []byte("blob")
+			cv, err := tr.UpdateChunked(key, bytes.NewReader(value), chunkSize, chunkStore, valueStore)
+			require.NoError(t, err)
+			tr.Commit()
+			tr.PersistMutations(trieStore)
+			rootC := trie.RootCommitment(tr)
+
+			require.EqualValues(t, valueSize, cv.Size)
+			require.EqualValues(t, (valueSize+chunkSize-1)/chunkSize, cv.NumChunks())
+			cvBack, err := trie.GetChunkedValue(key, valueStore)
+			require.NoError(t, err)
+			require.EqualValues(t, cv, cvBack)
+
+			var buf bytes.Buffer
+			require.NoError(t, trie.ReadChunked(&buf, key, cvBack, chunkStore))
+			require.True(t, bytes.Equal(value, buf.Bytes()))
+
+			// the chunk trie is the trie of chunks under chunk keys
+			pairs := trie.NewInMemoryKVStore()
+			for i := uint64(0); i < cv.NumChunks(); i++ {
+				pairs.Set(trie.ChunkKey(i), trie.GetChunk(key, i, chunkStore))
+			}
+			chunkRoot := trie.ComputeRoot(model, pairs)
+			if valueSize == 0 {
+				require.Nil(t, chunkRoot)
+				require.EqualValues(t, 0, len(cv.Root))
+			} else {
+				require.EqualValues(t, chunkRoot.Bytes(), cv.Root)
+			}
+
+			proof := model.Proof(key, tr)
+			err = trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), cv.Bytes())
+			require.NoError(t, err)
+			for i := uint64(0); i < cv.NumChunks(); i += 1 + cv.NumChunks()/20 {
+				chunk := trie.GetChunk(key, i, chunkStore)
+				proof := model.ChunkProof(key, i, chunkStore)
+				err = trie_blake2b_verify.ValidateWithValue(proof, cv.Root, chunk)
+				require.NoError(t, err)
+				err = trie_blake2b_verify.ValidateWithValue(proof, cv.Root, append(chunk, 0))
+				require.Error(t, err)
+			}
+
+			// replacing the value removes previous chunks
+			cvShort, err := tr.UpdateChunked(key, bytes.NewReader(value[:valueSize/3]), chunkSize, chunkStore, valueStore)
+			require.NoError(t, err)
+			require.Nil(t, trie.GetChunk(key, cvShort.NumChunks(), chunkStore))
+			buf.Reset()
+			require.NoError(t, trie.ReadChunked(&buf, key, cvShort, chunkStore))
+			require.True(t, bytes.Equal(value[:valueSize/3], buf.Bytes()))
+
+			require.EqualValues(t, trie.NumEntries(chunkStore), trie.DeleteChunks(key, chunkStore))
+			require.EqualValues(t, 0, trie.NumEntries(chunkStore))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(arity, 100, 0)
+		runTest(arity, 100, 99)
+		runTest(arity, 1000, 100_000)
+		runTest(arity, 64, 150_000)
+	}
+	_, err := trie.New(trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160), trie.NewInMemoryKVStore(), nil).
+		UpdateChunked([]byte("a"), bytes.NewReader(nil), 0, trie.NewInMemoryKVStore(), nil)
+	require.Error(t, err)
+}
+
+func TestSortedTableNodeStore(t *testing.T) {
+	runTest := func(arity trie.PathArity) {
+		model := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run("sorted table"+tn(model), func(t *testing.T) {
+			data := genRnd4()[:2000]
+			trieStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(model, trieStore, valueStore)
+			for _, d := range data {
+				tr.UpdateStr(d, d+"++")
+				valueStore.Set([]byte(d), []byte(d+"++"))
+			}
+			tr.Commit()
+			tr.PersistMutations(trieStore)
+			rootC := trie.RootCommitment(tr)
+
+			fname := filepath.Join(t.TempDir(), "nodes.sst")
+			n, err := trie.WriteSortedTableFile(fname, trieStore)
+			require.NoError(t, err)
+			require.EqualValues(t, trie.NumEntries(trieStore), n)
+
+			table, err := trie.OpenSortedTable(fname)
+			require.NoError(t, err)
+			defer table.Close()
+			require.EqualValues(t, n, table.Len())
+			require.EqualValues(t, trie.ByteSize(trieStore), trie.ByteSize(table))
+
+			var prev []byte
+			table.Iterate(func(k, v []byte) bool {
+				require.True(t, prev == nil || bytes.Compare(prev, k) < 0)
+				require.EqualValues(t, trieStore.Get(k), v)
+				prev = k
+				return true
+			})
+			require.Nil(t, table.Get([]byte("absent")))
+			require.False(t, table.Has([]byte("absent")))
+			numPrefix := 0
+			trie.IterateKeysPrefix(table, prev[:1], func(k []byte) bool {
+				require.EqualValues(t, prev[0], k[0])
+				numPrefix++
+				return true
+			})
+			require.True(t, numPrefix > 0)
+
+			allocs := testing.AllocsPerRun(100, func() {
+				table.Get(prev)
+			})
+			require.EqualValues(t, 0, allocs)
+
+			trReader := trie.NewTrieReader(model, table, valueStore)
+			require.True(t, model.EqualCommitments(rootC, trie.RootCommitment(trReader)))
+			for _, d := range data[:200] {
+				proof := model.Proof([]byte(d), trReader)
+				err := trie_blake2b_verify.ValidateWithValue(proof, rootC.Bytes(), []byte(d+"++"))
+				require.NoError(t, err)
+				require.EqualValues(t, model.Proof([]byte(d), tr).Bytes(), proof.Bytes())
+			}
+
+			tableBytes, err := trie.NewSortedTable(append([]byte{}, table.Get(prev)...))
+			require.Error(t, err)
+			require.Nil(t, tableBytes)
+
+			// the offset of the record which overflows with lengths is out of bounds
+			var buf bytes.Buffer
+			_, err = trie.WriteSortedTable(&buf, trieStore)
+			require.NoError(t, err)
+			raw := buf.Bytes()
+			_, err = trie.NewSortedTable(raw)
+			require.NoError(t, err)
+			indexOffset := binary.LittleEndian.Uint64(raw[len(raw)-24:])
+			rec := raw[indexOffset : indexOffset+16]
+			kl, vl := binary.LittleEndian.Uint32(rec[8:12]), binary.LittleEndian.Uint32(rec[12:16])
+			binary.LittleEndian.PutUint64(rec[0:8], math.MaxUint64-uint64(kl)-uint64(vl)+20)
+			_, err = trie.NewSortedTable(raw)
+			require.Error(t, err)
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(arity)
+	}
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	data := genRnd4()[:200]
+	runTestBlake2b := func(t *testing.T, m *trie_blake2b.CommitmentModel) {
+		t.Run("verify inclusion"+tn(m), func(t *testing.T) {
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				if len(s) > 0 {
+					tr.UpdateStr(s, s+"-value-which-is-longer-than-the-hash")
+				}
+			}
+			tr.Commit()
+			rootBytes := trie.RootCommitment(tr).Bytes()
+			for _, s := range data {
+				if len(s) == 0 {
+					continue
+				}
+				proofBytes := m.Proof([]byte(s), tr).Bytes()
+				res, err := trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s), []byte(s+"-value-which-is-longer-than-the-hash"), proofBytes)
+				require.NoError(t, err)
+				require.EqualValues(t, trie_verify.Present, res.Status)
+				require.True(t, res.ValueChecked)
+				require.True(t, len(res.Terminal) > 0)
+
+				res, err = trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s), nil, proofBytes)
+				require.NoError(t, err)
+				require.EqualValues(t, trie_verify.Present, res.Status)
+				require.False(t, res.ValueChecked)
+
+				_, err = trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s), []byte("wrong value"), proofBytes)
+				require.Error(t, err)
+				_, err = trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s+"x"), nil, proofBytes)
+				require.Error(t, err)
+			}
+			absent := []byte("absent key")
+			res, err := trie_verify.VerifyInclusion(rootBytes, m.ShortName(), absent, []byte("value"), m.Proof(absent, tr).Bytes())
+			require.NoError(t, err)
+			require.EqualValues(t, trie_verify.Absent, res.Status)
+			require.Nil(t, res.Terminal)
+			t.Logf("%s", res)
+
+			proofBytes := m.Proof([]byte(data[1]), tr).Bytes()
+			wrongRoot := append([]byte{}, rootBytes...)
+			wrongRoot[0] ^= 0xff
+			_, err = trie_verify.VerifyInclusion(wrongRoot, m.ShortName(), []byte(data[1]), nil, proofBytes)
+			require.Error(t, err)
+			_, err = trie_verify.VerifyInclusion(rootBytes, "b2b_other", []byte(data[1]), nil, proofBytes)
+			require.Error(t, err)
+			_, err = trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(data[1]), nil, proofBytes[:len(proofBytes)-1])
+			require.Error(t, err)
+			_, err = trie_verify.VerifyInclusion(rootBytes, "unknown", []byte(data[1]), nil, proofBytes)
+			require.ErrorIs(t, err, trie_verify.ErrUnsupportedModel)
+		})
+	}
+	runTestBlake2b(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTestBlake2b(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTestBlake2b(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTestBlake2b(t, trie_blake2b.NewWithParams(trie.PathArity16, trie_blake2b.HashSize256, trie_blake2b.Params{Salt: []byte("salt")}))
+
+	t.Run("verify inclusion kzg", func(t *testing.T) {
+		m := trie_kzg_bn256.Model
+		tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+		for _, s := range data[:50] {
+			if len(s) > 0 {
+				tr.UpdateStr(s, s+"-value")
+			}
+		}
+		tr.Commit()
+		rootBytes := trie.RootCommitment(tr).Bytes()
+		for _, s := range data[:50] {
+			if len(s) == 0 {
+				continue
+			}
+			p, ok := m.ProofOfInclusion([]byte(s), tr)
+			require.True(t, ok)
+			res, err := trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s), []byte(s+"-value"), p.Bytes())
+			require.NoError(t, err)
+			require.EqualValues(t, trie_verify.Present, res.Status)
+			require.True(t, res.ValueChecked)
+
+			_, err = trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s), []byte("wrong value"), p.Bytes())
+			require.Error(t, err)
+			_, err = trie_verify.VerifyInclusion(rootBytes, m.ShortName(), []byte(s+"x"), nil, p.Bytes())
+			require.Error(t, err)
+		}
+	})
+}
+
+// goldenDir is the directory of golden vectors. Set TRIE_UPDATE_GOLDEN=1 to regenerate them after the intended change
+// of the serialization: go test ./models/tests -run TestGoldenVectors
+var goldenDir = filepath.Join("testdata", "golden")
+
+func TestGoldenVectors(t *testing.T) {
+	if os.Getenv("TRIE_UPDATE_GOLDEN") != "" {
+		require.NoError(t, trie_vectors.WriteGoldenFiles(goldenDir))
+	}
+	for _, m := range trie_vectors.GoldenModels() {
+		t.Run("golden vectors"+tn(m), func(t *testing.T) {
+			expected, err := trie_vectors.ReadGoldenFile(goldenDir, m.ShortName())
+			require.NoError(t, err)
+			set, err := trie_vectors.GenerateGoldenSet(m)
+			require.NoError(t, err)
+			require.EqualValues(t, string(expected.Bytes()), string(set.Bytes()))
+
+			for _, v := range expected.Vectors {
+				res, err := trie_verify.VerifyInclusion(expected.Root, expected.Model, v.Key, v.Value, v.Proof)
+				require.NoError(t, err)
+				if v.Value == nil {
+					require.EqualValues(t, trie_verify.Absent, res.Status)
+				} else {
+					require.EqualValues(t, trie_verify.Present, res.Status)
+					require.True(t, res.ValueChecked)
+				}
+			}
+		})
+	}
+	var set trie_vectors.GoldenSet
+	require.Error(t, set.Read(bytes.NewReader([]byte("model kzg\nproof 00\n"))))
+}
+
+func TestVerificationSuite(t *testing.T) {
+	models := []trie.CommitmentModel{
+		trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160),
+		trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256),
+		trie_kzg_bn256.Model,
+	}
+	suite, err := trie_vectors.GenerateVerificationSuite(models...)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, suite.WriteJSON(&buf))
+
+	var suite1 trie_vectors.VerificationSuite
+	require.NoError(t, suite1.ReadJSON(bytes.NewReader(buf.Bytes())))
+	require.EqualValues(t, suite, &suite1)
+	counts := make(map[string]int)
+	for i := range suite1.Vectors {
+		require.NoError(t, suite1.Vectors[i].Check())
+		counts[suite1.Vectors[i].Expected]++
+	}
+	require.EqualValues(t, 3*4, counts[trie_vectors.ExpectInvalid])
+	require.True(t, counts[trie_vectors.ExpectPresent] > 0)
+	require.True(t, counts[trie_vectors.ExpectAbsent] > 0)
+
+	v := suite1.Vectors[0]
+	v.Expected = trie_vectors.ExpectInvalid
+	require.Error(t, v.Check())
+}
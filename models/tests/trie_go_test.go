@@ -2,8 +2,10 @@ package tests
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	iofs "io/fs"
 	"math"
 	"math/rand"
 	"strings"
@@ -11,6 +13,9 @@ import (
 	"time"
 
 	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/iotaledger/trie.go/models/trie_dual"
+	"github.com/iotaledger/trie.go/models/trie_fs"
 	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
 	"github.com/iotaledger/trie.go/trie"
 	"github.com/stretchr/testify/require"
@@ -338,6 +343,64 @@ func TestTrieBase(t *testing.T) {
 			tr2Clone := tr2.Clone()
 			require.True(t, m.EqualCommitments(c2, trie.RootCommitment(tr2Clone)))
 		})
+		t.Run("empty genesis"+tn(m), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			require.EqualValues(t, 0, len(tr.Reconcile(trie.NewInMemoryKVStore())))
+			valueStore := trie.NewInMemoryKVStore()
+			valueStore.Set([]byte("a"), []byte("a"))
+			require.EqualValues(t, 1, len(tr.Reconcile(valueStore)))
+
+			tr.Update([]byte("a"), []byte("a"))
+			tr.Update([]byte("b"), []byte("b"))
+			tr.Commit()
+			require.NotNil(t, trie.RootCommitment(tr))
+			tr.Update([]byte("a"), nil)
+			tr.Update([]byte("b"), nil)
+			tr.Commit()
+			tr.PersistMutations(store)
+			require.Nil(t, trie.RootCommitment(tr))
+			require.Nil(t, trie.RootCommitment(trie.NewTrieReader(m, store, nil)))
+		})
+		t.Run("fork"+tn(m), func(t *testing.T) {
+			data := []string{"001", "002", "010", "a", "ab", "abc"}
+			spec := []string{"0", "011", "abd", "b"}
+
+			tr1 := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for i := range data[:3] {
+				tr1.Update([]byte(data[i]), []byte(data[i]))
+			}
+			tr1.Commit()
+			for i := range data[3:] {
+				tr1.Update([]byte(data[3+i]), []byte(data[3+i]))
+			}
+			// fork with uncommitted mutations
+			tr1Fork := tr1.Fork()
+			for i := range spec {
+				tr1Fork.Update([]byte(spec[i]), []byte(spec[i]))
+			}
+			tr1Fork.Delete([]byte(data[0]))
+			tr1Fork.Commit()
+			cFork := trie.RootCommitment(tr1Fork)
+
+			tr1.Commit()
+			c1 := trie.RootCommitment(tr1)
+			require.False(t, m.EqualCommitments(c1, cFork))
+
+			tr2 := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for i := range data {
+				tr2.Update([]byte(data[i]), []byte(data[i]))
+			}
+			tr2.Commit()
+			require.True(t, m.EqualCommitments(c1, trie.RootCommitment(tr2)))
+
+			for i := range spec {
+				tr2.Update([]byte(spec[i]), []byte(spec[i]))
+			}
+			tr2.Delete([]byte(data[0]))
+			tr2.Commit()
+			require.True(t, m.EqualCommitments(cFork, trie.RootCommitment(tr2)))
+		})
 
 		t.Run("reverse short"+tn(m), func(t *testing.T) {
 			store1 := trie.NewInMemoryKVStore()
@@ -1225,3 +1288,586 @@ func TestGenTrie(t *testing.T) {
 
 	runTest(t, trie_kzg_bn256.New())
 }
+
+func TestEmptyValues(t *testing.T) {
+	data := []string{"a", "ab", "abc", "b", "bcd"}
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("empty value is not deletion"+tn(m), func(t *testing.T) {
+			tr1 := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, trie.Options{AllowEmptyValues: true})
+			for _, s := range data {
+				tr1.UpdateStr(s, s)
+			}
+			tr1.Commit()
+			c1 := trie.RootCommitment(tr1)
+
+			tr1.Update([]byte("abc"), []byte{})
+			tr1.Update([]byte("x"), []byte{})
+			tr1.Commit()
+			c2 := trie.RootCommitment(tr1)
+			require.False(t, m.EqualCommitments(c1, c2))
+
+			tr1.Update([]byte("x"), nil)
+			tr1.Commit()
+			c3 := trie.RootCommitment(tr1)
+			require.False(t, m.EqualCommitments(c1, c3))
+			require.False(t, m.EqualCommitments(c2, c3))
+
+			tr1.Update([]byte("abc"), []byte("abc"))
+			tr1.Commit()
+			require.True(t, m.EqualCommitments(c1, trie.RootCommitment(tr1)))
+		})
+		t.Run("empty value is deletion by default"+tn(m), func(t *testing.T) {
+			tr1 := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			tr2 := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				tr1.UpdateStr(s, s)
+				tr2.UpdateStr(s, s)
+			}
+			tr1.Update([]byte("abc"), []byte{})
+			tr2.Delete([]byte("abc"))
+			tr1.Commit()
+			tr2.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr1), trie.RootCommitment(tr2)))
+		})
+		t.Run("empty value persist"+tn(m), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			tr1 := trie.NewWithOptions(m, store, nil, trie.Options{AllowEmptyValues: true})
+			for _, s := range data {
+				tr1.Update([]byte(s), []byte{})
+			}
+			tr1.Commit()
+			c1 := trie.RootCommitment(tr1)
+			require.NotNil(t, c1)
+			tr1.PersistMutations(store)
+
+			tr2 := trie.NewTrieReader(m, store, nil)
+			require.True(t, m.EqualCommitments(c1, trie.RootCommitment(tr2)))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestDualModel(t *testing.T) {
+	runTest := func(t *testing.T, m0, m1 trie.CommitmentModel, numKeys int) {
+		m := trie_dual.New(m0, m1)
+		t.Run("dual model"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:numKeys]
+			trieStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, trieStore, valueStore)
+			tr0 := trie.New(m0, trie.NewInMemoryKVStore(), nil)
+			tr1 := trie.New(m1, trie.NewInMemoryKVStore(), nil)
+			update := func(k, v string) {
+				tr.UpdateStr(k, v)
+				tr0.UpdateStr(k, v)
+				tr1.UpdateStr(k, v)
+				valueStore.Set([]byte(k), []byte(v))
+			}
+			checkRoots := func() {
+				tr.Commit()
+				tr0.Commit()
+				tr1.Commit()
+				root0, root1 := trie_dual.RootCommitments(tr)
+				require.True(t, m0.EqualCommitments(trie.RootCommitment(tr0), root0))
+				require.True(t, m1.EqualCommitments(trie.RootCommitment(tr1), root1))
+			}
+			for _, d := range data {
+				update(d, d+"~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~")
+			}
+			checkRoots()
+			for _, d := range data[:len(data)/2] {
+				update(d, "")
+			}
+			for _, d := range data[len(data)/2 : len(data)*3/4] {
+				update(d, d)
+			}
+			checkRoots()
+
+			tr.PersistMutations(trieStore)
+			trReader := trie.NewTrieReader(m, trieStore, valueStore)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr), trie.RootCommitment(trReader)))
+			require.EqualValues(t, 0, len(tr.Reconcile(valueStore)))
+
+			model0, ok := m0.(*trie_blake2b.CommitmentModel)
+			if !ok {
+				return
+			}
+			root0, _ := trie_dual.RootCommitments(trReader)
+			for _, d := range data[len(data)/2:] {
+				proof := model0.Proof([]byte(d), trie_dual.Projection(trReader, 0))
+				if value := valueStore.Get([]byte(d)); len(value) > 0 {
+					require.NoError(t, trie_blake2b_verify.ValidateWithValue(proof, root0.Bytes(), value))
+				} else {
+					require.NoError(t, trie_blake2b_verify.Validate(proof, root0.Bytes()))
+					require.True(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+				}
+				require.EqualValues(t, model0.Proof([]byte(d), tr0).Bytes(), proof.Bytes())
+			}
+			if model1, ok := m1.(*trie_kzg_bn256.CommitmentModel); ok {
+				_, root1 := trie_dual.RootCommitments(trReader)
+				for _, d := range data[len(data)/2 : len(data)/2+10] {
+					if len(valueStore.Get([]byte(d))) == 0 {
+						continue
+					}
+					proof, ok := model1.ProofOfInclusion([]byte(d), trie_dual.Projection(trReader, 1))
+					require.True(t, ok)
+					require.NoError(t, proof.Validate(root1, valueStore.Get([]byte(d))))
+				}
+			}
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160), trie_blake2b.New(arity, trie_blake2b.HashSize256), 1000)
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160, 10),
+			trie_blake2b.NewWithSalt(arity, trie_blake2b.HashSize160, []byte("salt")), 1000)
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160), trie_kzg_bn256.New(), 100)
+	require.Panics(t, func() {
+		trie_dual.New(trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160), trie_kzg_bn256.New())
+	})
+}
+
+func storeContents(store trie.KVIterator) map[string]string {
+	ret := make(map[string]string)
+	store.Iterate(func(k, v []byte) bool {
+		ret[string(k)] = string(v)
+		return true
+	})
+	return ret
+}
+
+func TestUpdateWithTerminal(t *testing.T) {
+	runTest := func(t *testing.T, m *trie_blake2b.CommitmentModel, valueThreshold bool) {
+		t.Run("update with terminal"+tn(m), func(t *testing.T) {
+			data := make([]string, 0)
+			seen := make(map[string]bool)
+			for _, s := range genRnd4()[:200] {
+				if !seen[s] {
+					seen[s] = true
+					data = append(data, s)
+				}
+			}
+			var logBuf bytes.Buffer
+			store := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, valueStore, trie.Options{OpLog: trie.NewOpLog(&logBuf)})
+			external := make(map[string][]byte)
+			for i, s := range data {
+				if i%2 == 0 {
+					tr.UpdateStr(s, s+"++")
+					valueStore.Set([]byte(s), []byte(s+"++"))
+					continue
+				}
+				// e.g. the root of another Merkle tree
+				ext := trie_blake2b.CommitToDataRaw([]byte(strings.Repeat("external "+s, 10)), trie_blake2b.HashSize256)[:m.HashSize()]
+				terminal, err := m.ExternalTerminalCommitment(ext)
+				require.NoError(t, err)
+				tr.UpdateWithTerminal([]byte(s), terminal)
+				external[s] = ext
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			tr.ClearCache()
+			root := trie.RootCommitment(tr).Bytes()
+
+			reader := trie.NewTrieReader(m, store, valueStore)
+			for s, ext := range external {
+				require.True(t, reader.HasMany([][]byte{[]byte(s)})[0])
+				p := m.Proof([]byte(s), reader)
+				require.NoError(t, trie_blake2b_verify.ValidateWithTerminal(p, root, ext))
+				wrong := trie.Concat(ext)
+				wrong[0]++
+				require.Error(t, trie_blake2b_verify.ValidateWithTerminal(p, root, wrong))
+				require.Error(t, trie_blake2b_verify.ValidateWithValue(p, root, []byte(s+"++")))
+			}
+			// the same trie built by the replay of the op-log
+			replayStore := trie.NewInMemoryKVStore()
+			replayRoot, _, err := trie.ReplayOpLog(bytes.NewReader(logBuf.Bytes()), m, replayStore, trie.NewInMemoryKVStore())
+			require.NoError(t, err)
+			require.EqualValues(t, root, replayRoot.Bytes())
+			require.EqualValues(t, storeContents(store), storeContents(replayStore))
+
+			// nil terminal deletes the key
+			for s := range external {
+				tr.UpdateWithTerminal([]byte(s), nil)
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for i, s := range data {
+				if i%2 == 0 {
+					reference.UpdateStr(s, s+"++")
+				}
+			}
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+
+			_, err = m.ExternalTerminalCommitment(make([]byte, int(m.HashSize())+1))
+			require.Error(t, err)
+			if valueThreshold {
+				require.Panics(t, func() {
+					tr.UpdateWithTerminal([]byte("a"), m.CommitToData([]byte("short")))
+				})
+			}
+		})
+	}
+	for _, arity := range []trie.PathArity{trie.PathArity256, trie.PathArity16, trie.PathArity2} {
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160), false)
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize256, 10), true)
+	}
+}
+
+func TestFS(t *testing.T) {
+	files := map[string]string{
+		"README":               "readme",
+		"etc/config.json":      "{}",
+		"etc/hosts":            "127.0.0.1 localhost",
+		"etc/ssl/cert.pem":     "certificate",
+		"etc/ssl/key.pem":      "private key",
+		"var/log/app.log":      "log line",
+		"var/log.d/app.log.d":  "other log",
+		"var":                  "file and directory",
+		"home/user/notes.txt":  "notes",
+		"home/user2/notes.txt": "other notes",
+	}
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("fs"+tn(m), func(t *testing.T) {
+			f := trie_fs.FS{Prefix: []byte("fs:")}
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			tr.UpdateStr("other key", "not a file")
+			for name, data := range files {
+				require.NoError(t, f.WriteFile(tr, name, []byte(data)))
+				key, err := f.Key(name)
+				require.NoError(t, err)
+				valueStore.Set(key, []byte(data))
+				back, err := f.Name(key)
+				require.NoError(t, err)
+				require.EqualValues(t, name, back)
+			}
+			tr.Commit()
+
+			for name, data := range files {
+				got, err := f.ReadFile(tr, valueStore, name)
+				require.NoError(t, err)
+				require.EqualValues(t, data, string(got))
+			}
+			_, err := f.ReadFile(tr, valueStore, "etc/absent")
+			require.ErrorIs(t, err, iofs.ErrNotExist)
+			_, err = f.ReadFile(tr, valueStore, "etc")
+			require.ErrorIs(t, err, iofs.ErrNotExist)
+			for _, wrong := range []string{"", ".", "/etc", "etc/", "etc//hosts", "etc/../hosts"} {
+				_, err = f.Key(wrong)
+				require.ErrorIs(t, err, iofs.ErrInvalid)
+				_, err = f.ReadDir(tr, wrong+"/x/")
+				require.ErrorIs(t, err, iofs.ErrInvalid)
+			}
+			_, err = f.Name([]byte("other key"))
+			require.ErrorIs(t, err, iofs.ErrInvalid)
+
+			entries, err := f.ReadDir(tr, ".")
+			require.NoError(t, err)
+			require.EqualValues(t, []trie_fs.Entry{
+				{Name: "README"}, {Name: "etc", IsDir: true}, {Name: "home", IsDir: true}, {Name: "var"}, {Name: "var", IsDir: true},
+			}, entries)
+			entries, err = f.ReadDir(tr, "etc")
+			require.NoError(t, err)
+			require.EqualValues(t, []trie_fs.Entry{
+				{Name: "config.json"}, {Name: "hosts"}, {Name: "ssl", IsDir: true},
+			}, entries)
+			entries, err = f.ReadDir(tr, "var")
+			require.NoError(t, err)
+			require.EqualValues(t, []trie_fs.Entry{
+				{Name: "log", IsDir: true}, {Name: "log.d", IsDir: true},
+			}, entries)
+			_, err = f.ReadDir(tr, "et")
+			require.ErrorIs(t, err, iofs.ErrNotExist)
+			_, err = f.ReadDir(tr, "etc/hosts")
+			require.ErrorIs(t, err, iofs.ErrNotExist)
+
+			rootBytes := trie.RootCommitment(tr).Bytes()
+			for name, data := range files {
+				proof, err := f.Proof(tr, name)
+				require.NoError(t, err)
+				require.NoError(t, f.VerifyFile(rootBytes, m.ShortName(), name, []byte(data), proof))
+				require.Error(t, f.VerifyFile(rootBytes, m.ShortName(), name, []byte("wrong content"), proof))
+			}
+			proof, err := f.Proof(tr, "etc/absent")
+			if _, ok := m.(*trie_blake2b.CommitmentModel); ok {
+				require.NoError(t, err)
+				require.ErrorIs(t, f.VerifyFile(rootBytes, m.ShortName(), "etc/absent", nil, proof), iofs.ErrNotExist)
+			} else {
+				require.ErrorIs(t, err, iofs.ErrNotExist)
+			}
+
+			require.NoError(t, f.Remove(tr, "etc/ssl/key.pem"))
+			require.NoError(t, f.Remove(tr, "etc/ssl/cert.pem"))
+			tr.Commit()
+			entries, err = f.ReadDir(tr, "etc")
+			require.NoError(t, err)
+			require.EqualValues(t, []trie_fs.Entry{{Name: "config.json"}, {Name: "hosts"}}, entries)
+			_, err = f.ReadDir(tr, "etc/ssl")
+			require.ErrorIs(t, err, iofs.ErrNotExist)
+
+			empty := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			entries, err = f.ReadDir(empty, ".")
+			require.NoError(t, err)
+			require.EqualValues(t, 0, len(entries))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestValidateConstantTime(t *testing.T) {
+	runTest := func(t *testing.T, m *trie_blake2b.CommitmentModel) {
+		t.Run("const time"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			values := make(map[string]string)
+			for _, s := range data[:200] {
+				tr.UpdateStr(s, s+"-value")
+				values[s] = s + "-value"
+			}
+			tr.Commit()
+			root := trie.RootCommitment(tr).Bytes()
+			wrongRoot := trie.Concat(root)
+			wrongRoot[len(wrongRoot)-1] ^= 1
+
+			for _, s := range data {
+				p := m.Proof([]byte(s), tr)
+				require.NoError(t, trie_blake2b_verify.ValidateConstantTime(p, root))
+				require.ErrorIs(t, trie_blake2b_verify.ValidateConstantTime(p, wrongRoot), trie_blake2b_verify.ErrInvalidProof)
+
+				v, ok := values[s]
+				if !ok {
+					require.True(t, trie_blake2b_verify.IsProofOfAbsence(p))
+					require.ErrorIs(t, trie_blake2b_verify.ValidateWithValueConstantTime(p, root, []byte(s)), trie_blake2b_verify.ErrInvalidProof)
+					require.ErrorIs(t, trie_blake2b_verify.ValidateWithTerminalConstantTime(p, root, nil), trie_blake2b_verify.ErrInvalidProof)
+					continue
+				}
+				require.NoError(t, trie_blake2b_verify.ValidateWithValueConstantTime(p, root, []byte(v)))
+				require.ErrorIs(t, trie_blake2b_verify.ValidateWithValueConstantTime(p, root, []byte(v+"x")), trie_blake2b_verify.ErrInvalidProof)
+				require.ErrorIs(t, trie_blake2b_verify.ValidateWithValueConstantTime(p, wrongRoot, []byte(v)), trie_blake2b_verify.ErrInvalidProof)
+
+				_, terminal := trie_blake2b_verify.MustKeyWithTerminal(p)
+				require.NoError(t, trie_blake2b_verify.ValidateWithTerminalConstantTime(p, root, terminal))
+				wrongTerminal := trie.Concat(terminal)
+				wrongTerminal[0] ^= 1
+				require.ErrorIs(t, trie_blake2b_verify.ValidateWithTerminalConstantTime(p, root, wrongTerminal), trie_blake2b_verify.ErrInvalidProof)
+
+				// tampered proof
+				p.Path[len(p.Path)-1].Terminal = wrongTerminal
+				require.ErrorIs(t, trie_blake2b_verify.ValidateWithTerminalConstantTime(p, root, wrongTerminal), trie_blake2b_verify.ErrInvalidProof)
+				p.Path[len(p.Path)-1].ChildIndex = 0
+				p.Path[len(p.Path)-1].Children = map[byte][]byte{0: root}
+				require.ErrorIs(t, trie_blake2b_verify.ValidateWithValueConstantTime(p, root, []byte(v)), trie_blake2b_verify.ErrInvalidProof)
+			}
+			empty := m.Proof([]byte("a"), trie.New(m, trie.NewInMemoryKVStore(), nil))
+			require.NoError(t, trie_blake2b_verify.ValidateConstantTime(empty, nil))
+			require.ErrorIs(t, trie_blake2b_verify.ValidateWithValueConstantTime(empty, nil, []byte("a")), trie_blake2b_verify.ErrInvalidProof)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.NewWithParams(trie.PathArity2, trie_blake2b.HashSize192, trie_blake2b.Params{Salt: []byte("s")}))
+}
+
+func TestCountPrefix(t *testing.T) {
+	runTest := func(t *testing.T, m *trie_blake2b.CommitmentModel) {
+		t.Run("count prefix"+tn(m), func(t *testing.T) {
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			empty := m.CountProof([]byte("a"), tr)
+			n, err := trie_blake2b_verify.ValidateCount(empty, nil)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, n)
+
+			keys := make(map[string]bool)
+			for _, s := range genRnd4()[:500] {
+				tr.UpdateStr(s, s+"-value")
+				keys[s] = true
+			}
+			tr.Commit()
+			deleted := 0
+			for s := range keys {
+				if deleted == 100 {
+					break
+				}
+				tr.DeleteStr(s)
+				delete(keys, s)
+				deleted++
+			}
+			tr.Commit()
+			root := trie.RootCommitment(tr).Bytes()
+			require.EqualValues(t, len(keys), trie_blake2b.Uint64FromAggregate(trie_blake2b.AggregateOf(root, m.HashSize())))
+
+			prefixes := map[string]bool{"": true, "zzz": true}
+			for s := range keys {
+				for i := 0; i <= len(s) && i <= 3; i++ {
+					prefixes[s[:i]] = true
+				}
+				prefixes[s] = true
+				prefixes[s+"x"] = true
+			}
+			for prefix := range prefixes {
+				expected := 0
+				for s := range keys {
+					if strings.HasPrefix(s, prefix) {
+						expected++
+					}
+				}
+				require.EqualValues(t, expected, m.CountPrefix([]byte(prefix), tr))
+
+				p := m.CountProof([]byte(prefix), tr)
+				p.Compact = len(prefix)%2 == 0
+				p, err = trie_blake2b.ProofFromBytes(p.Bytes())
+				require.NoError(t, err)
+				require.True(t, p.Aggregator == trie_blake2b.CountAggregator)
+				n, err = trie_blake2b_verify.ValidateCount(p, root)
+				require.NoError(t, err)
+				require.EqualValues(t, expected, n, "prefix '%s'", prefix)
+			}
+			// counts of children are committed
+			for s := range keys {
+				p := m.CountProof([]byte(s[:1]), tr)
+				for _, e := range p.Path {
+					for idx, c := range e.Children {
+						wrong := trie.Concat(c)
+						wrong[len(wrong)-1]++
+						e.Children[idx] = wrong
+						_, err = trie_blake2b_verify.ValidateCount(p, root)
+						require.Error(t, err)
+						e.Children[idx] = c
+					}
+				}
+				break
+			}
+			// proofs of keys are validated as usual
+			for s := range keys {
+				require.NoError(t, trie_blake2b_verify.ValidateWithValue(m.Proof([]byte(s), tr), root, []byte(s+"-value")))
+			}
+		})
+	}
+	runTest(t, trie_blake2b.NewWithParams(trie.PathArity256, trie_blake2b.HashSize160, trie_blake2b.Params{Aggregator: trie_blake2b.CountAggregator}))
+	runTest(t, trie_blake2b.NewWithParams(trie.PathArity16, trie_blake2b.HashSize256, trie_blake2b.Params{Aggregator: trie_blake2b.CountAggregator}))
+	runTest(t, trie_blake2b.NewWithParams(trie.PathArity2, trie_blake2b.HashSize192,
+		trie_blake2b.Params{Aggregator: trie_blake2b.CountAggregator, ChildOrder: trie_blake2b.ChildOrderDescending, Salt: []byte("s")}))
+}
+
+// xorAggregator is the custom aggregator of 1-byte aggregates
+type xorAggregator struct{}
+
+func (xorAggregator) ID() byte     { return 200 }
+func (xorAggregator) Name() string { return "xor" }
+func (xorAggregator) Size() int    { return 1 }
+
+func (xorAggregator) Terminal(terminal []byte) []byte {
+	var ret byte
+	for _, b := range terminal {
+		ret ^= b
+	}
+	return []byte{ret}
+}
+
+func (xorAggregator) Combine(aggregates [][]byte) []byte {
+	var ret byte
+	for _, a := range aggregates {
+		ret ^= a[0]
+	}
+	return []byte{ret}
+}
+
+func TestAggregator(t *testing.T) {
+	if _, ok := trie_blake2b.AggregatorByID(xorAggregator{}.ID()); !ok {
+		require.NoError(t, trie_blake2b.RegisterAggregator(xorAggregator{}))
+	}
+	require.Error(t, trie_blake2b.RegisterAggregator(xorAggregator{}))
+
+	values := make(map[string]uint64)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 300; i++ {
+		values[fmt.Sprintf("acc%d", rnd.Intn(1000))] = uint64(rnd.Intn(1_000_000))
+	}
+	expected := func(agg trie_blake2b.Aggregator, prefix string) []byte {
+		var ret []byte
+		for k, v := range values {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			// values are shorter than the hash, so terminal commitments are the values themselves
+			a := agg.Terminal(trie_blake2b.Uint64Aggregate(v))
+			if ret == nil {
+				ret = a
+				continue
+			}
+			ret = agg.Combine([][]byte{ret, a})
+		}
+		return ret
+	}
+	runTest := func(t *testing.T, m *trie_blake2b.CommitmentModel) {
+		t.Run("aggregator"+tn(m), func(t *testing.T) {
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for k, v := range values {
+				tr.Update([]byte(k), trie_blake2b.Uint64Aggregate(v))
+			}
+			tr.Commit()
+			root := trie.RootCommitment(tr).Bytes()
+			require.EqualValues(t, trie_blake2b.AggregatedCommitmentSize(m.HashSize(), m.Aggregator()), len(root))
+
+			for _, prefix := range []string{"", "acc", "acc1", "acc12", "acc123", "acc1234", "b"} {
+				exp := expected(m.Aggregator(), prefix)
+				require.EqualValues(t, exp, m.AggregateAt([]byte(prefix), tr))
+
+				p, err := trie_blake2b.ProofFromBytes(m.AggregateProof([]byte(prefix), tr).Bytes())
+				require.NoError(t, err)
+				require.True(t, p.Aggregator == m.Aggregator())
+				agg, err := trie_blake2b_verify.ValidateAggregate(p, root)
+				require.NoError(t, err)
+				require.EqualValues(t, exp, agg, "prefix '%s'", prefix)
+
+				_, err = trie_blake2b_verify.ValidateCount(p, root)
+				require.Error(t, err)
+			}
+		})
+	}
+	for _, agg := range []trie_blake2b.Aggregator{trie_blake2b.SumAggregator, trie_blake2b.MinAggregator, trie_blake2b.MaxAggregator, xorAggregator{}} {
+		runTest(t, trie_blake2b.NewWithParams(trie.PathArity16, trie_blake2b.HashSize160, trie_blake2b.Params{Aggregator: agg}))
+		runTest(t, trie_blake2b.NewWithParams(trie.PathArity2, trie_blake2b.HashSize160, trie_blake2b.Params{Aggregator: agg, Salt: []byte("s")}))
+	}
+}
+
+func genHashedKeys(n int) [][]byte {
+	ret := make([][]byte, n)
+	for i := range ret {
+		h := sha256.Sum256([]byte(fmt.Sprintf("key %d", i)))
+		ret[i] = h[:]
+	}
+	return ret
+}
+
+func BenchmarkFixedKeyLength(b *testing.B) {
+	keys := genHashedKeys(100_000)
+	for _, arity := range trie.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		for _, fixed := range []int{0, 32} {
+			b.Run(fmt.Sprintf("%s_fixed_%d", arity, fixed), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					tr := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, trie.Options{FixedKeyLength: fixed})
+					for _, k := range keys {
+						tr.Update(k, k[:8])
+					}
+				}
+			})
+		}
+	}
+}
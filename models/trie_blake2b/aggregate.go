@@ -0,0 +1,284 @@
+package trie_blake2b
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// In the aggregating model (see Params.Aggregator) the vector commitment of each node is the hash of the node followed by
+// the aggregate of its subtree, for example the number of keys or the sum of values. The aggregate of the node is folded
+// by the Aggregator from the aggregate of its terminal and aggregates of its children. It is hashed together with
+// the vector, and aggregates of children are part of the child commitments, so the root commits to aggregates of all
+// subtries. The aggregate of keys under any prefix is proven with the proof of the prefix (see AggregateProof)
+// and validated with trie_blake2b_verify.ValidateAggregate in O(depth)
+
+// Aggregator folds values committed in the subtrie into the aggregate of the fixed size
+type Aggregator interface {
+	// ID identifies the aggregator in serialized proofs. IDs below MinCustomAggregatorID are reserved
+	ID() byte
+	// Name is the short name of the aggregator
+	Name() string
+	// Size is the size of the aggregate in bytes, at least 1
+	Size() int
+	// Terminal returns the aggregate of the terminal commitment. The terminal commitment is the value itself
+	// for values not longer than the hash size. It is empty for the empty value
+	Terminal(terminal []byte) []byte
+	// Combine folds at least one aggregate into one: the aggregate of the terminal (if any) is followed by aggregates
+	// of children in the order of child indices. It must not fail on arbitrary aggregates of the valid size,
+	// because aggregates in proofs are untrusted
+	Combine(aggregates [][]byte) []byte
+}
+
+// MinCustomAggregatorID is the smallest ID of the aggregator which can be registered with RegisterAggregator
+const MinCustomAggregatorID = 128
+
+const (
+	countAggregatorID = byte(iota + 1)
+	sumAggregatorID
+	minAggregatorID
+	maxAggregatorID
+)
+
+// Built-in aggregators have 8-byte big-endian aggregates. Sum, min and max aggregators interpret terminal commitments
+// as big-endian unsigned numbers, so values must not be longer than 8 bytes. Longer values and the empty value are 0.
+// Sums are modulo 2^64
+var (
+	// CountAggregator aggregates the number of keys
+	CountAggregator Aggregator = &uint64Aggregator{
+		id:       countAggregatorID,
+		name:     "count",
+		terminal: func([]byte) uint64 { return 1 },
+		combine:  func(a, b uint64) uint64 { return a + b },
+	}
+	// SumAggregator aggregates the sum of values
+	SumAggregator Aggregator = &uint64Aggregator{
+		id:       sumAggregatorID,
+		name:     "sum",
+		terminal: terminalUint64,
+		combine:  func(a, b uint64) uint64 { return a + b },
+	}
+	// MinAggregator aggregates the minimum of values
+	MinAggregator Aggregator = &uint64Aggregator{
+		id:       minAggregatorID,
+		name:     "min",
+		terminal: terminalUint64,
+		combine: func(a, b uint64) uint64 {
+			if a < b {
+				return a
+			}
+			return b
+		},
+	}
+	// MaxAggregator aggregates the maximum of values
+	MaxAggregator Aggregator = &uint64Aggregator{
+		id:       maxAggregatorID,
+		name:     "max",
+		terminal: terminalUint64,
+		combine: func(a, b uint64) uint64 {
+			if a > b {
+				return a
+			}
+			return b
+		},
+	}
+)
+
+var aggregators = struct {
+	sync.RWMutex
+	byID map[byte]Aggregator
+}{
+	byID: map[byte]Aggregator{
+		countAggregatorID: CountAggregator,
+		sumAggregatorID:   SumAggregator,
+		minAggregatorID:   MinAggregator,
+		maxAggregatorID:   MaxAggregator,
+	},
+}
+
+// RegisterAggregator makes the custom aggregator known to ProofFromBytes. Built-in aggregators are always known
+func RegisterAggregator(a Aggregator) error {
+	if a.ID() < MinCustomAggregatorID {
+		return fmt.Errorf("trie_blake2b::RegisterAggregator: ID %d is reserved", a.ID())
+	}
+	if a.Size() < 1 {
+		return fmt.Errorf("trie_blake2b::RegisterAggregator: wrong aggregate size %d", a.Size())
+	}
+	aggregators.Lock()
+	defer aggregators.Unlock()
+	if _, ok := aggregators.byID[a.ID()]; ok {
+		return fmt.Errorf("trie_blake2b::RegisterAggregator: aggregator with ID %d already registered", a.ID())
+	}
+	aggregators.byID[a.ID()] = a
+	return nil
+}
+
+// AggregatorByID returns the built-in or registered aggregator
+func AggregatorByID(id byte) (Aggregator, bool) {
+	aggregators.RLock()
+	defer aggregators.RUnlock()
+	ret, ok := aggregators.byID[id]
+	return ret, ok
+}
+
+// uint64Aggregator is the aggregator of 8-byte big-endian aggregates
+type uint64Aggregator struct {
+	id       byte
+	name     string
+	terminal func(terminal []byte) uint64
+	combine  func(a, b uint64) uint64
+}
+
+func (a *uint64Aggregator) ID() byte {
+	return a.id
+}
+
+func (a *uint64Aggregator) Name() string {
+	return a.name
+}
+
+func (a *uint64Aggregator) Size() int {
+	return 8
+}
+
+func (a *uint64Aggregator) Terminal(terminal []byte) []byte {
+	return Uint64Aggregate(a.terminal(terminal))
+}
+
+func (a *uint64Aggregator) Combine(aggregates [][]byte) []byte {
+	ret := binary.BigEndian.Uint64(aggregates[0])
+	for _, agg := range aggregates[1:] {
+		ret = a.combine(ret, binary.BigEndian.Uint64(agg))
+	}
+	return Uint64Aggregate(ret)
+}
+
+func terminalUint64(terminal []byte) uint64 {
+	if len(terminal) > 8 {
+		return 0
+	}
+	var buf [8]byte
+	copy(buf[8-len(terminal):], terminal)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// Uint64Aggregate is the aggregate of built-in aggregators. Values aggregated by SumAggregator, MinAggregator
+// and MaxAggregator are usually inserted in the same encoding
+func Uint64Aggregate(v uint64) []byte {
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], v)
+	return ret[:]
+}
+
+// Uint64FromAggregate decodes the aggregate of built-in aggregators. Returns 0 for nil, i.e. for no keys
+func Uint64FromAggregate(agg []byte) uint64 {
+	if len(agg) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(agg)
+}
+
+// AggregatedCommitmentSize is the size of the vector commitment in the aggregating model
+func AggregatedCommitmentSize(sz HashSize, agg Aggregator) int {
+	return int(sz) + agg.Size()
+}
+
+func (m *CommitmentModel) vectorCommitmentSize() int {
+	if m.aggregator != nil {
+		return AggregatedCommitmentSize(m.hashSize, m.aggregator)
+	}
+	return int(m.hashSize)
+}
+
+// AggregateOf returns the aggregate committed by the vector commitment of the aggregating model
+func AggregateOf(commitment []byte, sz HashSize) []byte {
+	if len(commitment) <= int(sz) {
+		return nil
+	}
+	return commitment[sz:]
+}
+
+// AggregateNode folds the aggregate of the node from its terminal commitment (nil if none) and commitments of children
+// by child index. Commitments of children are vector commitments of the aggregating model
+func AggregateNode(agg Aggregator, terminal []byte, children map[byte][]byte, sz HashSize) []byte {
+	aggregates := make([][]byte, 0, len(children)+1)
+	if terminal != nil {
+		aggregates = append(aggregates, agg.Terminal(terminal))
+	}
+	indices := make([]int, 0, len(children))
+	for i := range children {
+		indices = append(indices, int(i))
+	}
+	sort.Ints(indices)
+	for _, i := range indices {
+		aggregates = append(aggregates, AggregateOf(children[byte(i)], sz))
+	}
+	if len(aggregates) == 0 {
+		return nil
+	}
+	return agg.Combine(aggregates)
+}
+
+func (m *CommitmentModel) nodeAggregate(nodeData *trie.NodeData) []byte {
+	children := make(map[byte][]byte, len(nodeData.ChildCommitments))
+	for i, c := range nodeData.ChildCommitments {
+		children[i] = c.Bytes()
+	}
+	var terminal []byte
+	if nodeData.Terminal != nil {
+		terminal = nodeData.Terminal.(*terminalCommitment).bytes
+	}
+	return AggregateNode(m.aggregator, terminal, children, m.hashSize)
+}
+
+// HashTheAggregatedVector hashes the vector of node elements of the aggregating model together with the aggregate.
+// Each element takes the size of the vector commitment in the hashed data. Returns the hash followed by the aggregate
+func HashTheAggregatedVector(hashes [][]byte, aggregate []byte, arity trie.PathArity, sz HashSize, params ...[]byte) []byte {
+	esz := int(sz) + len(aggregate)
+	if esz < sz.MaxCommitmentSize() {
+		esz = sz.MaxCommitmentSize()
+	}
+	buf := make([]byte, arity.VectorLength()*esz, arity.VectorLength()*esz+len(aggregate))
+	for i, h := range hashes {
+		if h == nil {
+			continue
+		}
+		pos := i * esz
+		copy(buf[pos:pos+esz], h)
+	}
+	buf = append(buf, aggregate...)
+	return trie.Concat(blakeIt(buf, sz, params...), aggregate)
+}
+
+// AggregateAt returns the aggregate of keys with the prefix committed in the trie of the aggregating model,
+// nil if there are no such keys. It reads only nodes on the path to the prefix
+func (m *CommitmentModel) AggregateAt(prefix []byte, tr trie.NodeStore) []byte {
+	trie.Assert(m.aggregator != nil, "trie_blake2b::AggregateAt: not an aggregating model")
+	c, _, ok := trie.CommitmentAt(tr, prefix)
+	if !ok || c == nil {
+		return nil
+	}
+	return AggregateOf(c.Bytes(), m.hashSize)
+}
+
+// AggregateProof returns the proof of the aggregate of keys with the prefix. It is the proof of the prefix as a key,
+// validated with trie_blake2b_verify.ValidateAggregate. Returns nil if the trie is empty
+func (m *CommitmentModel) AggregateProof(prefix []byte, tr trie.NodeStore) *Proof {
+	trie.Assert(m.aggregator != nil, "trie_blake2b::AggregateProof: not an aggregating model")
+	return m.Proof(prefix, tr)
+}
+
+// CountPrefix returns the number of keys with the prefix in the trie of the model with CountAggregator
+func (m *CommitmentModel) CountPrefix(prefix []byte, tr trie.NodeStore) uint64 {
+	trie.Assert(m.aggregator == CountAggregator, "trie_blake2b::CountPrefix: not a counting model")
+	return Uint64FromAggregate(m.AggregateAt(prefix, tr))
+}
+
+// CountProof returns the proof of the number of keys with the prefix, validated with trie_blake2b_verify.ValidateCount
+func (m *CommitmentModel) CountProof(prefix []byte, tr trie.NodeStore) *Proof {
+	trie.Assert(m.aggregator == CountAggregator, "trie_blake2b::CountProof: not a counting model")
+	return m.Proof(prefix, tr)
+}
@@ -0,0 +1,36 @@
+package trie_blake2b_test
+
+import (
+	"fmt"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+func ExampleCommitmentModel_Proof() {
+	model := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+	for _, s := range []string{"a", "abc", "abcd", "b", "klmn"} {
+		tr.UpdateStr(s, s+"$")
+	}
+	tr.Commit()
+	root := trie.RootCommitment(tr)
+
+	for _, s := range []string{"abc", "abd"} {
+		proof := model.Proof([]byte(s), tr)
+		// the proof is validated against the root commitment only
+		if err := trie_blake2b_verify.Validate(proof, root.Bytes()); err != nil {
+			panic(err)
+		}
+		if trie_blake2b_verify.IsProofOfAbsence(proof) {
+			fmt.Printf("'%s' is absent, proof length %d\n", s, len(proof.Path))
+			continue
+		}
+		err := trie_blake2b_verify.ValidateWithValue(proof, root.Bytes(), []byte(s+"$"))
+		fmt.Printf("'%s' is present, proof length %d, value is valid: %v\n", s, len(proof.Path), err == nil)
+	}
+	// Output:
+	// 'abc' is present, proof length 3, value is valid: true
+	// 'abd' is absent, proof length 3
+}
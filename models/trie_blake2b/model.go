@@ -4,7 +4,6 @@ package trie_blake2b
 import (
 	"bytes"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
 
@@ -21,18 +20,33 @@ type terminalCommitment struct {
 	isCostlyCommitment bool
 }
 
-// vectorCommitment is a blake2b hash of the vector elements
+// vectorCommitment is a blake2b hash of the vector elements. In the aggregating model it is followed by the aggregate
+// of the subtree (see Params.Aggregator)
 type vectorCommitment []byte
 
 type HashSize byte
 
+// HashSize128 and HashSize192 are intended for applications with strict proof size budgets.
+// Note that HashSize128 provides only 64-bit collision resistance
 const (
+	HashSize128 = HashSize(16)
 	HashSize160 = HashSize(20)
+	HashSize192 = HashSize(24)
 	HashSize256 = HashSize(32)
 )
 
+// AllHashSize are commonly used hash sizes
 var AllHashSize = []HashSize{HashSize160, HashSize256}
 
+// IsValid checks if the hash size is supported by the model
+func (hs HashSize) IsValid() bool {
+	switch hs {
+	case HashSize128, HashSize160, HashSize192, HashSize256:
+		return true
+	}
+	return false
+}
+
 func (hs HashSize) MaxCommitmentSize() int {
 	return int(hs) + 1
 }
@@ -41,8 +55,12 @@ func (hs HashSize) String() string {
 	switch hs {
 	case HashSize256:
 		return "HashSize(256)"
+	case HashSize192:
+		return "HashSize(192)"
 	case HashSize160:
 		return "HashSize(160)"
+	case HashSize128:
+		return "HashSize(128)"
 	}
 	panic("wrong hash size")
 }
@@ -52,6 +70,26 @@ type CommitmentModel struct {
 	hashSize                       HashSize
 	arity                          trie.PathArity
 	valueSizeOptimizationThreshold int
+	salt                           []byte
+	personalization                []byte
+	childOrder                     ChildOrder
+	aggregator                     Aggregator
+}
+
+// MaxSaltSize is the maximum length of the domain separation salt. The salt is used as the blake2b key
+const MaxSaltSize = blake2b.Size
+
+// Params are optional parameters of blake2b hashing in the model
+type Params struct {
+	// Salt is the domain separation salt (tag), used as the blake2b key. Not longer than MaxSaltSize
+	Salt []byte
+	// Personalization is the blake2b personalization string. Not longer than MaxPersonalizationSize
+	Personalization []byte
+	// ChildOrder is the order of child commitments in the hashed vector of the node. Default is ChildOrderAscending
+	ChildOrder ChildOrder
+	// Aggregator enables the aggregating model: each node commits to the aggregate of its subtree, for example
+	// CountAggregator commits to the number of keys (see AggregateAt). Nil means model without aggregates
+	Aggregator Aggregator
 }
 
 // New creates new CommitmentModel.
@@ -65,6 +103,7 @@ type CommitmentModel struct {
 // Reasonable value of valueSizeOptimizationThreshold, allows significantly optimize trie storage without
 // requiring hashing big data each time
 func New(arity trie.PathArity, hashSize HashSize, valueSizeOptimizationThreshold ...int) *CommitmentModel {
+	trie.Assert(hashSize.IsValid(), "trie_blake2b: unsupported hash size %d", hashSize)
 	t := 0
 	if len(valueSizeOptimizationThreshold) > 0 {
 		t = valueSizeOptimizationThreshold[0]
@@ -76,6 +115,39 @@ func New(arity trie.PathArity, hashSize HashSize, valueSizeOptimizationThreshold
 	}
 }
 
+// NewWithSalt creates new CommitmentModel with the domain separation salt (tag).
+// All hashing in the model, both of the terminal data and of the nodes, is keyed with the salt,
+// so two tries with identical data but different salts have different roots.
+// Salt must be not longer than MaxSaltSize. Empty salt means model without salt, same as New
+func NewWithSalt(arity trie.PathArity, hashSize HashSize, salt []byte, valueSizeOptimizationThreshold ...int) *CommitmentModel {
+	return NewWithParams(arity, hashSize, Params{Salt: salt}, valueSizeOptimizationThreshold...)
+}
+
+// NewWithParams creates new CommitmentModel with the blake2b salt (key), personalization and child order.
+// As with the salt, two tries with identical data but different personalization or child order have different roots.
+// Empty parameters mean model without them
+func NewWithParams(arity trie.PathArity, hashSize HashSize, params Params, valueSizeOptimizationThreshold ...int) *CommitmentModel {
+	trie.Assert(len(params.Salt) <= MaxSaltSize, "trie_blake2b: salt can't be longer than %d bytes", MaxSaltSize)
+	trie.Assert(len(params.Personalization) <= MaxPersonalizationSize,
+		"trie_blake2b: personalization can't be longer than %d bytes", MaxPersonalizationSize)
+	trie.Assert(params.ChildOrder.IsValid(), "trie_blake2b: unsupported child order %d", params.ChildOrder)
+	ret := New(arity, hashSize, valueSizeOptimizationThreshold...)
+	ret.childOrder = params.ChildOrder
+	if params.Aggregator != nil {
+		trie.Assert(params.Aggregator.Size() > 0, "trie_blake2b: wrong aggregate size %d", params.Aggregator.Size())
+		ret.aggregator = params.Aggregator
+	}
+	if len(params.Salt) > 0 {
+		ret.salt = make([]byte, len(params.Salt))
+		copy(ret.salt, params.Salt)
+	}
+	if len(params.Personalization) > 0 {
+		ret.personalization = make([]byte, len(params.Personalization))
+		copy(ret.personalization, params.Personalization)
+	}
+	return ret
+}
+
 func (m *CommitmentModel) PathArity() trie.PathArity {
 	return m.arity
 }
@@ -83,6 +155,32 @@ func (m *CommitmentModel) PathArity() trie.PathArity {
 func (m *CommitmentModel) HashSize() HashSize {
 	return m.hashSize
 }
+
+// Salt returns domain separation salt of the model or nil if the model has no salt
+func (m *CommitmentModel) Salt() []byte {
+	return m.salt
+}
+
+// Personalization returns blake2b personalization of the model or nil if the model has no personalization
+func (m *CommitmentModel) Personalization() []byte {
+	return m.personalization
+}
+
+// ChildOrder returns order of child commitments in the hashed vector of the node
+func (m *CommitmentModel) ChildOrder() ChildOrder {
+	return m.childOrder
+}
+
+// Aggregator returns the aggregator of the model or nil if nodes of the model do not commit to aggregates
+func (m *CommitmentModel) Aggregator() Aggregator {
+	return m.aggregator
+}
+
+// hashParams are the optional hashing parameters of the model in the form accepted by CommitToDataRaw and HashTheVector
+func (m *CommitmentModel) hashParams() [][]byte {
+	return [][]byte{m.salt, m.personalization}
+}
+
 func (m *CommitmentModel) EqualCommitments(c1, c2 trie.Serializable) bool {
 	return equalCommitments(c1, c2)
 }
@@ -124,7 +222,7 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdat
 		return
 	}
 	if update != nil {
-		*update = (vectorCommitment)(HashTheVector(m.makeHashVector(mutate), m.arity, m.hashSize))
+		*update = m.hashNode(mutate)
 	}
 }
 
@@ -134,7 +232,14 @@ func (m *CommitmentModel) CalcNodeCommitment(par *trie.NodeData) trie.VCommitmen
 	if len(par.ChildCommitments) == 0 && par.Terminal == nil {
 		return nil
 	}
-	return vectorCommitment(HashTheVector(m.makeHashVector(par), m.arity, m.hashSize))
+	return m.hashNode(par)
+}
+
+func (m *CommitmentModel) hashNode(nodeData *trie.NodeData) vectorCommitment {
+	if m.aggregator != nil {
+		return HashTheAggregatedVector(m.makeHashVector(nodeData), m.nodeAggregate(nodeData), m.arity, m.hashSize, m.hashParams()...)
+	}
+	return HashTheVector(m.makeHashVector(nodeData), m.arity, m.hashSize, m.hashParams()...)
 }
 
 func (m *CommitmentModel) CommitToData(data []byte) trie.TCommitment {
@@ -145,13 +250,85 @@ func (m *CommitmentModel) CommitToData(data []byte) trie.TCommitment {
 	return m.commitToData(data)
 }
 
+// CommitToDataReader implements trie.ReaderCommitter. It streams the value of the size through the hasher,
+// so large values are committed without loading them into memory. The commitment is equal to the one returned
+// by CommitToData for the same data
+func (m *CommitmentModel) CommitToDataReader(r io.Reader, size int64) (trie.TCommitment, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	data, err := CommitToDataRawReader(r, size, m.hashSize, m.hashParams()...)
+	if err != nil {
+		return nil, err
+	}
+	return &terminalCommitment{
+		bytes:              data,
+		isCostlyCommitment: size > int64(m.valueSizeOptimizationThreshold),
+	}, nil
+}
+
+// CommitToEmptyValue implements trie.EmptyValueCommitter.
+// Commitment to the empty value is a terminal commitment with empty bytes. It is always stored with the node
+func (m *CommitmentModel) CommitToEmptyValue() trie.TCommitment {
+	return &terminalCommitment{
+		bytes:              []byte{},
+		isCostlyCommitment: true,
+	}
+}
+
+// ExternalTerminalCommitment creates terminal commitment from bytes computed outside the trie, for example
+// the Merkle root of another system, to be inserted with trie.Trie.UpdateWithTerminal. Its length must be from 1
+// to the hash size. The commitment is always stored with the node.
+// Note that the commitment to data not longer than the hash size is the data itself, so the external commitment
+// is indistinguishable from the commitment to the value equal to it
+func (m *CommitmentModel) ExternalTerminalCommitment(data []byte) (trie.TCommitment, error) {
+	if len(data) == 0 || len(data) > int(m.hashSize) {
+		return nil, fmt.Errorf("trie_blake2b: wrong size of the terminal commitment %d, expected 1 to %d bytes", len(data), m.hashSize)
+	}
+	return &terminalCommitment{
+		bytes:              trie.Concat(data),
+		isCostlyCommitment: true,
+	}, nil
+}
+
 func (m *CommitmentModel) Description() string {
-	return fmt.Sprintf("trie commitment model implementation based on blake2b %s, arity: %s, terminal optimization threshold: %d",
+	ret := fmt.Sprintf("trie commitment model implementation based on blake2b %s, arity: %s, terminal optimization threshold: %d",
 		m.hashSize, m.arity, m.valueSizeOptimizationThreshold)
+	if len(m.salt) > 0 {
+		ret += fmt.Sprintf(", salt: %s", hex.EncodeToString(m.salt))
+	}
+	if len(m.personalization) > 0 {
+		ret += fmt.Sprintf(", personalization: %s", hex.EncodeToString(m.personalization))
+	}
+	if m.childOrder != ChildOrderAscending {
+		ret += fmt.Sprintf(", child order: %s", m.childOrder)
+	}
+	if m.aggregator != nil {
+		ret += fmt.Sprintf(", aggregator: %s", m.aggregator.Name())
+	}
+	return ret
 }
 
 func (m *CommitmentModel) ShortName() string {
-	return fmt.Sprintf("b2b_%s_%s", m.PathArity(), m.hashSize)
+	return shortName(m.arity, m.hashSize, m.salt, m.personalization, m.childOrder, m.aggregator)
+}
+
+// shortName is the short name of the model with the parameters
+func shortName(arity trie.PathArity, hashSize HashSize, salt, personalization []byte, childOrder ChildOrder, aggregator Aggregator) string {
+	ret := fmt.Sprintf("b2b_%s_%s", arity, hashSize)
+	if len(salt) > 0 {
+		ret += "_salted"
+	}
+	if len(personalization) > 0 {
+		ret += "_personalized"
+	}
+	if childOrder != ChildOrderAscending {
+		ret += "_" + childOrder.String()
+	}
+	if aggregator != nil {
+		ret += "_" + aggregator.Name()
+	}
+	return ret
 }
 
 // NewTerminalCommitment creates empty terminal commitment
@@ -161,33 +338,63 @@ func (m *CommitmentModel) NewTerminalCommitment() trie.TCommitment {
 
 // NewVectorCommitment create empty vector commitment
 func (m *CommitmentModel) NewVectorCommitment() trie.VCommitment {
-	return newVectorCommitment(m.hashSize)
+	return newVectorCommitment(m.vectorCommitmentSize())
 }
 
 func (m *CommitmentModel) ForceStoreTerminalWithNode(c trie.TCommitment) bool {
 	return c.(*terminalCommitment).isCostlyCommitment
 }
 
-// CommitToDataRaw commits to data
-func CommitToDataRaw(data []byte, sz HashSize) []byte {
+// CommitToDataRaw commits to data. Optional params are the salt (domain separation tag) and
+// the personalization of the model, in this order
+func CommitToDataRaw(data []byte, sz HashSize, params ...[]byte) []byte {
 	var ret []byte
 	if len(data) <= int(sz) {
 		ret = make([]byte, len(data))
 		copy(ret, data)
 	} else {
-		ret = blakeIt(data, sz)
+		ret = blakeIt(data, sz, params...)
 	}
 	return ret
 }
 
 func (m *CommitmentModel) commitToData(data []byte) *terminalCommitment {
+	return m.commitToDataWithThreshold(data, m.valueSizeOptimizationThreshold)
+}
+
+// CommitToDataWithThreshold implements trie.ThresholdCommitter. The threshold overrides valueSizeOptimizationThreshold
+// of the model
+func (m *CommitmentModel) CommitToDataWithThreshold(data []byte, threshold int) trie.TCommitment {
+	if len(data) == 0 {
+		return nil
+	}
+	return m.commitToDataWithThreshold(data, threshold)
+}
+
+func (m *CommitmentModel) commitToDataWithThreshold(data []byte, threshold int) *terminalCommitment {
 	return &terminalCommitment{
-		bytes:              CommitToDataRaw(data, m.hashSize),
-		isCostlyCommitment: len(data) > m.valueSizeOptimizationThreshold,
+		bytes:              CommitToDataRaw(data, m.hashSize, m.hashParams()...),
+		isCostlyCommitment: len(data) > threshold,
 	}
 }
 
-func blakeIt(data []byte, sz HashSize) []byte {
+func blakeIt(data []byte, sz HashSize, params ...[]byte) []byte {
+	var salt, personalization []byte
+	if len(params) > 0 {
+		salt = params[0]
+	}
+	if len(params) > 1 {
+		personalization = params[1]
+	}
+	if len(personalization) > 0 {
+		if !sz.IsValid() {
+			panic("unsupported hash size")
+		}
+		return blake2bPersonal(data, int(sz), salt, personalization)
+	}
+	if len(salt) > 0 {
+		return blakeItKeyed(data, sz, salt)
+	}
 	switch sz {
 	case HashSize160:
 		ret := trie.Blake2b160(data)
@@ -196,7 +403,65 @@ func blakeIt(data []byte, sz HashSize) []byte {
 		ret := blake2b.Sum256(data)
 		return ret[:]
 	}
-	panic("must be 160 of 256")
+	return blakeItKeyed(data, sz, nil)
+}
+
+// dataHasher is the streaming hasher of data
+type dataHasher interface {
+	io.Writer
+	Sum(b []byte) []byte
+}
+
+// newDataHasher creates the streaming hasher which produces the same hash as blakeIt
+func newDataHasher(sz HashSize, params ...[]byte) dataHasher {
+	if !sz.IsValid() {
+		panic("unsupported hash size")
+	}
+	var salt, personalization []byte
+	if len(params) > 0 {
+		salt = params[0]
+	}
+	if len(params) > 1 {
+		personalization = params[1]
+	}
+	if len(personalization) > 0 {
+		return newPersonalHasher(int(sz), salt, personalization)
+	}
+	ret, err := blake2b.New(int(sz), salt)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// CommitToDataRawReader commits to data of the size read from the reader, without loading the whole data into memory.
+// The result is the same as of CommitToDataRaw. Returns an error if the reader contains less data than the size
+func CommitToDataRawReader(r io.Reader, size int64, sz HashSize, params ...[]byte) ([]byte, error) {
+	if size <= int64(sz) {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return CommitToDataRaw(data, sz, params...), nil
+	}
+	h := newDataHasher(sz, params...)
+	if _, err := io.CopyN(h, r, size); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// blakeItKeyed uses salt as a key of the blake2b hash function
+func blakeItKeyed(data []byte, sz HashSize, salt []byte) []byte {
+	if !sz.IsValid() {
+		panic("unsupported hash size")
+	}
+	h, err := blake2b.New(int(sz), salt)
+	if err != nil {
+		panic(err)
+	}
+	h.Write(data)
+	return h.Sum(nil)
 }
 
 // makeHashVector makes the node vector to be hashed. Missing children are nil
@@ -204,16 +469,33 @@ func (m *CommitmentModel) makeHashVector(nodeData *trie.NodeData) [][]byte {
 	hashes := make([][]byte, m.arity.VectorLength())
 	for i, c := range nodeData.ChildCommitments {
 		trie.Assert(int(i) < m.arity.VectorLength(), "int(i)<m.arity.VectorLength()")
-		hashes[i] = c.Bytes()
+		hashes[m.childOrder.Position(int(i), m.arity)] = c.Bytes()
 	}
 	if nodeData.Terminal != nil {
-		hashes[m.arity.TerminalCommitmentIndex()] = nodeData.Terminal.(*terminalCommitment).bytes
+		hashes[m.arity.TerminalCommitmentIndex()] = TerminalVectorElement(nodeData.Terminal.(*terminalCommitment).bytes, m.hashSize)
 	}
-	hashes[m.arity.PathFragmentCommitmentIndex()] = CommitToDataRaw(nodeData.PathFragment, m.hashSize)
+	hashes[m.arity.PathFragmentCommitmentIndex()] = CommitToDataRaw(nodeData.PathFragment, m.hashSize, m.hashParams()...)
 	return hashes
 }
 
-func HashTheVector(hashes [][]byte, arity trie.PathArity, sz HashSize) []byte {
+// emptyValueMarker is placed into the last byte of the vector element of the terminal commitment to the empty value.
+// Commitments to non-empty data are never longer than hash size, so the last byte is always 0 for them
+const emptyValueMarker = 0xFF
+
+// TerminalVectorElement returns element of the hashed vector at the terminal position for the terminal commitment bytes.
+// Commitment to the empty value (empty non-nil bytes) is distinct from absence of the terminal and from any other data
+func TerminalVectorElement(terminal []byte, sz HashSize) []byte {
+	if terminal == nil || len(terminal) > 0 {
+		return terminal
+	}
+	ret := make([]byte, sz.MaxCommitmentSize())
+	ret[len(ret)-1] = emptyValueMarker
+	return ret
+}
+
+// HashTheVector hashes the vector of node elements. Optional params are the salt and the personalization
+// of the model, as in CommitToDataRaw
+func HashTheVector(hashes [][]byte, arity trie.PathArity, sz HashSize, params ...[]byte) []byte {
 	msz := sz.MaxCommitmentSize()
 	buf := make([]byte, arity.VectorLength()*msz)
 	for i, h := range hashes {
@@ -223,14 +505,14 @@ func HashTheVector(hashes [][]byte, arity trie.PathArity, sz HashSize) []byte {
 		pos := i * msz
 		copy(buf[pos:pos+msz], h)
 	}
-	return blakeIt(buf, sz)
+	return blakeIt(buf, sz, params...)
 }
 
 // *vectorCommitment implements trie_go.VCommitment
 var _ trie.VCommitment = &vectorCommitment{}
 
-func newVectorCommitment(sz HashSize) vectorCommitment {
-	return make([]byte, sz)
+func newVectorCommitment(size int) vectorCommitment {
+	return make([]byte, size)
 }
 
 func (v vectorCommitment) Bytes() []byte {
@@ -238,7 +520,7 @@ func (v vectorCommitment) Bytes() []byte {
 }
 
 func (v vectorCommitment) Read(r io.Reader) error {
-	_, err := r.Read(v)
+	_, err := io.ReadFull(r, v)
 	return err
 }
 
@@ -311,14 +593,9 @@ func (t *terminalCommitment) Read(r io.Reader) error {
 	}
 	if l > 0 {
 		t.bytes = make([]byte, l)
-
-		n, err := r.Read(t.bytes)
-		if err != nil {
+		if _, err = io.ReadFull(r, t.bytes); err != nil {
 			return err
 		}
-		if n != int(l) {
-			return errors.New("bad data length")
-		}
 	}
 	return nil
 }
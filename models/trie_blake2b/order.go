@@ -0,0 +1,63 @@
+package trie_blake2b
+
+import (
+	"fmt"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// ChildOrder defines positions of child commitments in the hashed vector of the node.
+// Terminal and path fragment commitments always follow the children. The order changes all roots and proofs,
+// it is intended to make roots byte-compatible with external specifications which order children differently
+type ChildOrder byte
+
+const (
+	// ChildOrderAscending places child i at position i. It is the default
+	ChildOrderAscending = ChildOrder(iota)
+	// ChildOrderDescending places child i at position NumChildren-1-i
+	ChildOrderDescending
+	// ChildOrderBitReversed places child i at the position with the bits of i in reverse order,
+	// i.e. children are ordered by the least significant bit first. For PathArity2 it is same as ChildOrderAscending
+	ChildOrderBitReversed
+)
+
+// IsValid checks if the child order is supported by the model
+func (o ChildOrder) IsValid() bool {
+	switch o {
+	case ChildOrderAscending, ChildOrderDescending, ChildOrderBitReversed:
+		return true
+	}
+	return false
+}
+
+func (o ChildOrder) String() string {
+	switch o {
+	case ChildOrderAscending:
+		return "ascending"
+	case ChildOrderDescending:
+		return "descending"
+	case ChildOrderBitReversed:
+		return "bitReversed"
+	default:
+		return "ChildOrder(wrong)"
+	}
+}
+
+// Position returns position of the child in the hashed vector of the node
+func (o ChildOrder) Position(childIndex int, arity trie.PathArity) int {
+	trie.Assert(arity.IsChildIndex(childIndex), "trie_blake2b: wrong child index %d", childIndex)
+	switch o {
+	case ChildOrderAscending:
+		return childIndex
+	case ChildOrderDescending:
+		return int(arity) - childIndex
+	case ChildOrderBitReversed:
+		ret := 0
+		for n := arity.NumChildren(); n > 1; n >>= 1 {
+			ret = ret<<1 | childIndex&1
+			childIndex >>= 1
+		}
+		return ret
+	}
+	panic(fmt.Sprintf("trie_blake2b: wrong child order %d", o))
+}
@@ -0,0 +1,27 @@
+package trie_blake2b
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChildOrderPosition(t *testing.T) {
+	for _, arity := range trie.AllPathArity {
+		for _, o := range []ChildOrder{ChildOrderAscending, ChildOrderDescending, ChildOrderBitReversed} {
+			seen := make(map[int]bool)
+			for i := 0; i < arity.NumChildren(); i++ {
+				pos := o.Position(i, arity)
+				require.True(t, arity.IsChildIndex(pos))
+				require.False(t, seen[pos])
+				seen[pos] = true
+			}
+		}
+	}
+	require.EqualValues(t, 15, ChildOrderDescending.Position(0, trie.PathArity16))
+	require.EqualValues(t, 8, ChildOrderBitReversed.Position(1, trie.PathArity16))
+	require.EqualValues(t, 0xC0, ChildOrderBitReversed.Position(3, trie.PathArity256))
+	require.EqualValues(t, 1, ChildOrderBitReversed.Position(1, trie.PathArity2))
+	require.False(t, ChildOrder(3).IsValid())
+}
@@ -0,0 +1,146 @@
+package trie_blake2b
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// MaxPersonalizationSize is the maximum length of the blake2b personalization string.
+// Shorter personalization is padded with zeroes
+const MaxPersonalizationSize = 16
+
+// blake2b with personalization parameter (RFC 7693 and BLAKE2 specification, parameter block).
+// golang.org/x/crypto/blake2b does not expose the personalization, so the personalized hashing
+// is implemented here. It is only used by models with personalization, all other hashing
+// is done by the optimized golang.org/x/crypto/blake2b
+
+const blake2bBlockSize = 128
+
+var blake2bIV = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var blake2bSigma = [12][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+}
+
+// blake2bPersonal computes blake2b hash of the data with the digest size, optional key and personalization
+func blake2bPersonal(data []byte, size int, key, personal []byte) []byte {
+	h := newPersonalHasher(size, key, personal)
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// personalHasher is the streaming blake2b hasher with personalization
+type personalHasher struct {
+	h       [8]uint64
+	size    int
+	block   [blake2bBlockSize]byte
+	n       int
+	counter uint64
+}
+
+func newPersonalHasher(size int, key, personal []byte) *personalHasher {
+	if size < 1 || size > 64 || len(key) > 64 || len(personal) > MaxPersonalizationSize {
+		panic("blake2bPersonal: wrong parameters")
+	}
+	var param [64]byte
+	param[0] = byte(size)
+	param[1] = byte(len(key))
+	param[2] = 1 // fanout
+	param[3] = 1 // depth
+	copy(param[48:], personal)
+
+	ret := &personalHasher{size: size}
+	for i := range ret.h {
+		ret.h[i] = blake2bIV[i] ^ binary.LittleEndian.Uint64(param[i*8:])
+	}
+	if len(key) > 0 {
+		// the key is padded to the full block
+		var block [blake2bBlockSize]byte
+		copy(block[:], key)
+		_, _ = ret.Write(block[:])
+	}
+	return ret
+}
+
+// Write absorbs data. The last block is compressed only by Sum, because it is compressed with the final flag
+func (p *personalHasher) Write(data []byte) (int, error) {
+	ret := len(data)
+	for len(data) > 0 {
+		if p.n == blake2bBlockSize {
+			p.counter += blake2bBlockSize
+			blake2bCompress(&p.h, &p.block, p.counter, false)
+			p.n = 0
+		}
+		c := copy(p.block[p.n:], data)
+		p.n += c
+		data = data[c:]
+	}
+	return ret, nil
+}
+
+// Sum appends the hash to b. The state of the hasher is not changed
+func (p *personalHasher) Sum(b []byte) []byte {
+	h := p.h
+	var block [blake2bBlockSize]byte
+	copy(block[:], p.block[:p.n])
+	blake2bCompress(&h, &block, p.counter+uint64(p.n), true)
+
+	var out [64]byte
+	for i := range h {
+		binary.LittleEndian.PutUint64(out[i*8:], h[i])
+	}
+	return append(b, out[:p.size]...)
+}
+
+// blake2bCompress is the compression function F. Counter never exceeds 64 bits for data which fits in memory
+func blake2bCompress(h *[8]uint64, block *[blake2bBlockSize]byte, counter uint64, last bool) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+	var v [16]uint64
+	copy(v[:8], h[:])
+	copy(v[8:], blake2bIV[:])
+	v[12] ^= counter
+	if last {
+		v[14] = ^v[14]
+	}
+	for _, s := range blake2bSigma {
+		blake2bG(&v, 0, 4, 8, 12, m[s[0]], m[s[1]])
+		blake2bG(&v, 1, 5, 9, 13, m[s[2]], m[s[3]])
+		blake2bG(&v, 2, 6, 10, 14, m[s[4]], m[s[5]])
+		blake2bG(&v, 3, 7, 11, 15, m[s[6]], m[s[7]])
+		blake2bG(&v, 0, 5, 10, 15, m[s[8]], m[s[9]])
+		blake2bG(&v, 1, 6, 11, 12, m[s[10]], m[s[11]])
+		blake2bG(&v, 2, 7, 8, 13, m[s[12]], m[s[13]])
+		blake2bG(&v, 3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+	for i := range h {
+		h[i] ^= v[i] ^ v[i+8]
+	}
+}
+
+func blake2bG(v *[16]uint64, a, b, c, d int, x, y uint64) {
+	v[a] += v[b] + x
+	v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+	v[c] += v[d]
+	v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+	v[a] += v[b] + y
+	v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+	v[c] += v[d]
+	v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+}
@@ -0,0 +1,46 @@
+package trie_blake2b
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestBlake2bPersonal(t *testing.T) {
+	t.Run("no personalization", func(t *testing.T) {
+		for _, size := range []int{16, 20, 24, 32, 64} {
+			for _, key := range [][]byte{nil, []byte("salt")} {
+				for _, l := range []int{0, 1, 127, 128, 129, 256, 1000} {
+					data := make([]byte, l)
+					for i := range data {
+						data[i] = byte(i * 7)
+					}
+					h, err := blake2b.New(size, key)
+					require.NoError(t, err)
+					h.Write(data)
+					require.EqualValues(t, h.Sum(nil), blake2bPersonal(data, size, key, nil))
+				}
+			}
+		}
+	})
+	t.Run("personalization", func(t *testing.T) {
+		// reference values computed with hashlib.blake2b of Python
+		data := make([]byte, 0, 300)
+		for i := 0; i < 100; i++ {
+			data = append(data, "abc"...)
+		}
+		expected := map[int]string{
+			16: "bf89fde0e86ceacd263d364bb3b4d707",
+			20: "53a4accdd5e4f291a26b1bc391e5fe3629c0b9fb",
+			24: "69b797178eba6ef9ae6cc40698ebcaa29f3bc7a410fafdb3",
+			32: "7b214628d8803eafae77cd2dcf3151ad823b45dad017c8822ef4fde29c66ccd0",
+		}
+		for size, exp := range expected {
+			require.EqualValues(t, exp, hex.EncodeToString(blake2bPersonal(data, size, []byte("salt"), []byte("trie.go"))))
+		}
+		require.EqualValues(t, "31a7d254997d6ad64e4687e9835b1adf9f732e0bc1681e6573f8ee8dcaaee4ee",
+			hex.EncodeToString(blake2bPersonal(nil, 32, nil, []byte("p"))))
+	})
+}
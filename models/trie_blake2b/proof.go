@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/iotaledger/trie.go/trie"
 )
@@ -13,8 +14,23 @@ import (
 type Proof struct {
 	PathArity trie.PathArity
 	HashSize  HashSize
-	Key       []byte
-	Path      []*ProofElement
+	// Salt is the domain separation salt of the commitment model. Nil if the model has no salt
+	Salt []byte
+	// Personalization is the blake2b personalization of the commitment model. Nil if the model has no personalization
+	Personalization []byte
+	// ChildOrder is the order of child commitments in the hashed vector of the node of the commitment model
+	ChildOrder ChildOrder
+	// Aggregator is the aggregator of the aggregating model. Nil if the model has no aggregator.
+	// Child commitments are followed by aggregates
+	Aggregator Aggregator
+	// Compact selects the compact serialization of the proof: child index of the path element is encoded in flags
+	// and the child bitmap is sized to the arity. Both encodings are accepted by ProofFromBytes.
+	// The compact encoding is opt-in. It saves about 44-53% at arity 2, 14-19% at arity 16 and about 1% at arity 256.
+	// At arity 16 this is short of the 30% target: sibling commitments are most of the proof and can't be omitted,
+	// only the per-element overhead (child index and bitmap) is saved
+	Compact bool
+	Key     []byte
+	Path    []*ProofElement
 }
 
 type ProofElement struct {
@@ -43,21 +59,48 @@ func (m *CommitmentModel) Proof(key []byte, tr trie.NodeStore) *Proof {
 	if proofGeneric == nil {
 		return nil
 	}
-	ret := &Proof{
-		PathArity: tr.PathArity(),
-		HashSize:  m.hashSize,
-		Key:       proofGeneric.Key,
-		Path:      make([]*ProofElement, len(proofGeneric.Path)),
+	return m.proofFromGeneric(proofGeneric, tr.PathArity())
+}
+
+// ProofAnchored returns proof of the key relative to the subtrie of keys with the prefix 'anchor' (both in original bytes).
+// The proof is validated against the commitment returned by trie.CommitmentAt for the anchor, instead of the root.
+// The Key of the proof is the unpacked part of the key after the anchor.
+// Returns nil if the key does not start with the anchor or if no keys with the anchor are committed in the trie
+func (m *CommitmentModel) ProofAnchored(key, anchor []byte, tr trie.NodeStore) *Proof {
+	proofGeneric := trie.GetProofGenericAnchored(tr, trie.UnpackBytes(key, tr.PathArity()), trie.UnpackBytes(anchor, tr.PathArity()))
+	if proofGeneric == nil {
+		return nil
 	}
+	return m.proofFromGeneric(proofGeneric, tr.PathArity())
+}
+
+// ChunkProof returns proof of the chunk of the chunked value of the key (see trie.UpdateChunked).
+// The proof is validated against the Root of the trie.ChunkedValue with the chunk as a value
+func (m *CommitmentModel) ChunkProof(key []byte, index uint64, chunkStore trie.KVStore) *Proof {
+	return m.Proof(trie.ChunkKey(index), trie.ChunkTrieReader(m, key, chunkStore))
+}
+
+// GetWithProof returns value of the key together with its proof. Nodes of the trie are read once.
+// The value is taken from the value store of the trie reader, it is nil if the key is absent or value store is not provided
+func (m *CommitmentModel) GetWithProof(key []byte, tr *trie.TrieReader) ([]byte, *Proof) {
+	value, proofGeneric := tr.GetWithProofGeneric(key)
+	return value, m.proofFromGeneric(proofGeneric, tr.PathArity())
+}
+
+// MetadataProof returns proof of the state metadata committed under trie.MetadataKey.
+// It is validated with trie_blake2b_verify.ValidateWithValue against serialized metadata
+func (m *CommitmentModel) MetadataProof(tr trie.NodeStore) *Proof {
+	return m.Proof(trie.MetadataKey, tr)
+}
+
+func (m *CommitmentModel) proofFromGeneric(proofGeneric *trie.ProofGeneric, arity trie.PathArity) *Proof {
+	unpackedKey := proofGeneric.Key
+	ret := m.newProof(arity, proofGeneric.Key, make([]*ProofElement, len(proofGeneric.Path)))
 	var elemKeyPosition int
 	var isLast bool
 	var childIndex int
 
-	for i, k := range proofGeneric.Path {
-		node, ok := tr.GetNode(k)
-		if !ok {
-			panic(fmt.Errorf("can't find node key '%x'", k))
-		}
+	for i, node := range proofGeneric.Nodes {
 		isLast = i == len(proofGeneric.Path)-1
 		if !isLast {
 			elemKeyPosition += len(node.PathFragment())
@@ -73,39 +116,100 @@ func (m *CommitmentModel) Proof(key []byte, tr trie.NodeStore) *Proof {
 				panic("wrong ending code")
 			}
 		}
-		em := &ProofElement{
-			PathFragment: node.PathFragment(),
-			Children:     make(map[byte][]byte),
-			Terminal:     nil,
-			ChildIndex:   childIndex,
-		}
-		if node.Terminal() != nil {
-			em.Terminal = node.Terminal().(*terminalCommitment).bytes
-		}
-		for idx, v := range node.ChildCommitments() {
-			if int(idx) == childIndex {
-				// skipping the commitment which must come from the next child
-				continue
-			}
-			em.Children[idx] = v.(vectorCommitment)
-		}
-		ret.Path[i] = em
+		ret.Path[i] = newProofElement(node, childIndex)
 	}
 	return ret
 }
 
+// newProof makes the proof with parameters of the commitment model
+func (m *CommitmentModel) newProof(arity trie.PathArity, unpackedKey []byte, path []*ProofElement) *Proof {
+	return &Proof{
+		PathArity:       arity,
+		HashSize:        m.hashSize,
+		Salt:            m.salt,
+		Personalization: m.personalization,
+		ChildOrder:      m.childOrder,
+		Aggregator:      m.aggregator,
+		Key:             unpackedKey,
+		Path:            path,
+	}
+}
+
+// newProofElement makes the element of the proof path from the node. The commitment at the child index is skipped
+func newProofElement(node trie.Node, childIndex int) *ProofElement {
+	em := &ProofElement{
+		PathFragment: node.PathFragment(),
+		Children:     make(map[byte][]byte),
+		Terminal:     nil,
+		ChildIndex:   childIndex,
+	}
+	if node.Terminal() != nil {
+		em.Terminal = node.Terminal().(*terminalCommitment).bytes
+	}
+	for idx, v := range node.ChildCommitments() {
+		if int(idx) == childIndex {
+			// skipping the commitment which must come from the next child
+			continue
+		}
+		em.Children[idx] = v.(vectorCommitment)
+	}
+	return em
+}
+
 func (p *Proof) Bytes() []byte {
 	return trie.MustBytes(p)
 }
 
+// ShortName returns the short name of the commitment model which produced the proof (see CommitmentModel.ShortName)
+func (p *Proof) ShortName() string {
+	return shortName(p.PathArity, p.HashSize, p.Salt, p.Personalization, p.ChildOrder, p.Aggregator)
+}
+
 func (p *Proof) Write(w io.Writer) error {
 	var err error
 	if err = trie.WriteByte(w, byte(p.PathArity)); err != nil {
 		return err
 	}
-	if err = trie.WriteByte(w, byte(p.HashSize)); err != nil {
+	hs := byte(p.HashSize)
+	if len(p.Salt) > 0 {
+		hs |= saltedProofFlag
+	}
+	if len(p.Personalization) > 0 {
+		hs |= personalizedProofFlag
+	}
+	if p.hasExtension() {
+		hs |= orderedProofFlag
+	}
+	if p.Compact {
+		hs |= compactProofFlag
+	}
+	if err = trie.WriteByte(w, hs); err != nil {
 		return err
 	}
+	if len(p.Salt) > 0 {
+		if err = trie.WriteBytes8(w, p.Salt); err != nil {
+			return err
+		}
+	}
+	if len(p.Personalization) > 0 {
+		if err = trie.WriteBytes8(w, p.Personalization); err != nil {
+			return err
+		}
+	}
+	if p.hasExtension() {
+		ext := byte(p.ChildOrder)
+		if p.Aggregator != nil {
+			ext |= aggregatedProofFlag
+		}
+		if err = trie.WriteByte(w, ext); err != nil {
+			return err
+		}
+		if p.Aggregator != nil {
+			if err = trie.WriteByte(w, p.Aggregator.ID()); err != nil {
+				return err
+			}
+		}
+	}
 	encodedKey, err := trie.EncodeUnpackedBytes(p.Key, p.PathArity)
 	if err != nil {
 		return err
@@ -117,7 +221,12 @@ func (p *Proof) Write(w io.Writer) error {
 		return err
 	}
 	for _, e := range p.Path {
-		if err = e.Write(w, p.PathArity, p.HashSize); err != nil {
+		if p.Compact {
+			err = e.writeCompact(w, p.PathArity, p.childSize())
+		} else {
+			err = e.write(w, p.PathArity, p.childSize())
+		}
+		if err != nil {
 			return err
 		}
 	}
@@ -130,15 +239,57 @@ func (p *Proof) Read(r io.Reader) error {
 		return err
 	}
 	p.PathArity = trie.PathArity(b)
+	if !p.PathArity.IsValid() {
+		return errors.New("wrong path arity")
+	}
 
 	b, err = trie.ReadByte(r)
 	if err != nil {
 		return err
 	}
-	p.HashSize = HashSize(b)
-	if p.HashSize != HashSize256 && p.HashSize != HashSize160 {
+	p.HashSize = HashSize(b &^ (saltedProofFlag | compactProofFlag | personalizedProofFlag | orderedProofFlag))
+	p.Compact = b&compactProofFlag != 0
+	if !p.HashSize.IsValid() {
 		return errors.New("wrong hash size")
 	}
+	p.Salt = nil
+	if b&saltedProofFlag != 0 {
+		if p.Salt, err = trie.ReadBytes8(r); err != nil {
+			return err
+		}
+		if len(p.Salt) == 0 || len(p.Salt) > MaxSaltSize {
+			return errors.New("wrong salt size")
+		}
+	}
+	p.Personalization = nil
+	if b&personalizedProofFlag != 0 {
+		if p.Personalization, err = trie.ReadBytes8(r); err != nil {
+			return err
+		}
+		if len(p.Personalization) == 0 || len(p.Personalization) > MaxPersonalizationSize {
+			return errors.New("wrong personalization size")
+		}
+	}
+	p.ChildOrder = ChildOrderAscending
+	p.Aggregator = nil
+	if b&orderedProofFlag != 0 {
+		if b, err = trie.ReadByte(r); err != nil {
+			return err
+		}
+		p.ChildOrder = ChildOrder(b &^ aggregatedProofFlag)
+		if b&aggregatedProofFlag != 0 {
+			if b, err = trie.ReadByte(r); err != nil {
+				return err
+			}
+			var ok bool
+			if p.Aggregator, ok = AggregatorByID(b); !ok {
+				return fmt.Errorf("unknown aggregator %d", b)
+			}
+		}
+		if !p.hasExtension() || !p.ChildOrder.IsValid() {
+			return errors.New("wrong child order")
+		}
+	}
 
 	var encodedKey []byte
 	if encodedKey, err = trie.ReadBytes16(r); err != nil {
@@ -154,19 +305,62 @@ func (p *Proof) Read(r io.Reader) error {
 	p.Path = make([]*ProofElement, size)
 	for i := range p.Path {
 		p.Path[i] = &ProofElement{}
-		if err = p.Path[i].Read(r, p.PathArity, p.HashSize); err != nil {
+		if p.Compact {
+			err = p.Path[i].readCompact(r, p.PathArity, p.childSize())
+		} else {
+			err = p.Path[i].read(r, p.PathArity, p.childSize())
+		}
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// saltedProofFlag is set in the hash size byte of the serialized proof if the proof contains the salt.
+// Serialization of proofs without salt is not affected
+const saltedProofFlag = 0x80
+
+// compactProofFlag is set in the hash size byte of the serialized proof if path elements are in the compact encoding
+const compactProofFlag = 0x40
+
+// personalizedProofFlag is set in the hash size byte of the serialized proof if the proof contains the personalization.
+// All valid hash sizes are multiples of 4, so the lowest bit is never used by the hash size itself
+const personalizedProofFlag = 0x01
+
+// orderedProofFlag is set in the hash size byte of the serialized proof if the child order of the model is not the default one
+// or the model is aggregating. The extension byte with the child order and aggregatedProofFlag follows the personalization
+const orderedProofFlag = 0x02
+
+// aggregatedProofFlag is set in the extension byte of the serialized proof of the aggregating model.
+// The aggregator ID byte follows the extension byte
+const aggregatedProofFlag = 0x80
+
+func (p *Proof) hasExtension() bool {
+	return p.ChildOrder != ChildOrderAscending || p.Aggregator != nil
+}
+
+// childSize is the size of child commitments in path elements
+func (p *Proof) childSize() int {
+	if p.Aggregator != nil {
+		return AggregatedCommitmentSize(p.HashSize, p.Aggregator)
+	}
+	return int(p.HashSize)
+}
+
 const (
 	hasTerminalValueFlag = 0x01
 	hasChildrenFlag      = 0x02
+	// used only in the compact encoding. If none is set, the child index byte follows the flags
+	terminalIndexFlag     = 0x04
+	pathFragmentIndexFlag = 0x08
 )
 
 func (e *ProofElement) Write(w io.Writer, arity trie.PathArity, sz HashSize) error {
+	return e.write(w, arity, int(sz))
+}
+
+func (e *ProofElement) write(w io.Writer, arity trie.PathArity, childSize int) error {
 	encodedPathFragment, err := trie.EncodeUnpackedBytes(e.PathFragment, arity)
 	if err != nil {
 		return err
@@ -201,13 +395,13 @@ func (e *ProofElement) Write(w io.Writer, arity trie.PathArity, sz HashSize) err
 		if _, err = w.Write(flags[:]); err != nil {
 			return err
 		}
-		for i := 0; i < arity.VectorLength(); i++ {
+		for i := 0; i < arity.NumChildren(); i++ {
 			child, ok := e.Children[uint8(i)]
 			if !ok {
 				continue
 			}
-			if len(child) != int(sz) {
-				return fmt.Errorf("wrong data size. Expected %s, got %d", sz.String(), len(child))
+			if len(child) != childSize {
+				return fmt.Errorf("wrong data size. Expected %d, got %d", childSize, len(child))
 			}
 			if _, err = w.Write(child); err != nil {
 				return err
@@ -218,6 +412,10 @@ func (e *ProofElement) Write(w io.Writer, arity trie.PathArity, sz HashSize) err
 }
 
 func (e *ProofElement) Read(r io.Reader, arity trie.PathArity, sz HashSize) error {
+	return e.read(r, arity, int(sz))
+}
+
+func (e *ProofElement) read(r io.Reader, arity trie.PathArity, childSize int) error {
 	var err error
 	var encodedPathFragment []byte
 	if encodedPathFragment, err = trie.ReadBytes16(r); err != nil {
@@ -245,14 +443,141 @@ func (e *ProofElement) Read(r io.Reader, arity trie.PathArity, sz HashSize) erro
 	e.Children = make(map[byte][]byte)
 	if smallFlags&hasChildrenFlag != 0 {
 		var flags [32]byte
-		if _, err = r.Read(flags[:]); err != nil {
+		if _, err = io.ReadFull(r, flags[:]); err != nil {
+			return err
+		}
+		for i := 0; i < arity.NumChildren(); i++ {
+			ib := uint8(i)
+			if flags[i/8]&(0x1<<(i%8)) != 0 {
+				e.Children[ib] = make([]byte, childSize)
+				if _, err = io.ReadFull(r, e.Children[ib]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteCompact writes the proof element in the compact encoding:
+// - the child index is encoded in flags when it points to the terminal or to the path fragment, otherwise it takes 1 byte
+// - the child bitmap takes as many bytes as needed for the arity (1 byte for arity 2, 2 for 16, 32 for 256)
+func (e *ProofElement) WriteCompact(w io.Writer, arity trie.PathArity, sz HashSize) error {
+	return e.writeCompact(w, arity, int(sz))
+}
+
+func (e *ProofElement) writeCompact(w io.Writer, arity trie.PathArity, childSize int) error {
+	encodedPathFragment, err := trie.EncodeUnpackedBytes(e.PathFragment, arity)
+	if err != nil {
+		return err
+	}
+	if err = trie.WriteBytes16(w, encodedPathFragment); err != nil {
+		return err
+	}
+	var smallFlags byte
+	switch {
+	case arity.IsChildIndex(e.ChildIndex):
+	case e.ChildIndex == arity.TerminalCommitmentIndex():
+		smallFlags |= terminalIndexFlag
+	case e.ChildIndex == arity.PathFragmentCommitmentIndex():
+		smallFlags |= pathFragmentIndexFlag
+	default:
+		return fmt.Errorf("wrong child index %d", e.ChildIndex)
+	}
+	if e.Terminal != nil {
+		smallFlags |= hasTerminalValueFlag
+	}
+	flags := make([]byte, childBitmapSize(arity))
+	for i := range e.Children {
+		flags[i/8] |= 0x1 << (i % 8)
+		smallFlags |= hasChildrenFlag
+	}
+	if err = trie.WriteByte(w, smallFlags); err != nil {
+		return err
+	}
+	if smallFlags&(terminalIndexFlag|pathFragmentIndexFlag) == 0 {
+		if err = trie.WriteByte(w, byte(e.ChildIndex)); err != nil {
+			return err
+		}
+	}
+	if smallFlags&hasTerminalValueFlag != 0 {
+		if err = trie.WriteBytes8(w, e.Terminal); err != nil {
+			return err
+		}
+	}
+	if smallFlags&hasChildrenFlag != 0 {
+		if _, err = w.Write(flags); err != nil {
+			return err
+		}
+		for i := 0; i < arity.NumChildren(); i++ {
+			child, ok := e.Children[uint8(i)]
+			if !ok {
+				continue
+			}
+			if len(child) != childSize {
+				return fmt.Errorf("wrong data size. Expected %d, got %d", childSize, len(child))
+			}
+			if _, err = w.Write(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadCompact reads the proof element in the compact encoding. See WriteCompact
+func (e *ProofElement) ReadCompact(r io.Reader, arity trie.PathArity, sz HashSize) error {
+	return e.readCompact(r, arity, int(sz))
+}
+
+func (e *ProofElement) readCompact(r io.Reader, arity trie.PathArity, childSize int) error {
+	var err error
+	var encodedPathFragment []byte
+	if encodedPathFragment, err = trie.ReadBytes16(r); err != nil {
+		return err
+	}
+	if e.PathFragment, err = trie.DecodeToUnpackedBytes(encodedPathFragment, arity); err != nil {
+		return err
+	}
+	var smallFlags byte
+	if smallFlags, err = trie.ReadByte(r); err != nil {
+		return err
+	}
+	switch {
+	case smallFlags&terminalIndexFlag != 0 && smallFlags&pathFragmentIndexFlag != 0:
+		return errors.New("wrong proof element flags")
+	case smallFlags&terminalIndexFlag != 0:
+		e.ChildIndex = arity.TerminalCommitmentIndex()
+	case smallFlags&pathFragmentIndexFlag != 0:
+		e.ChildIndex = arity.PathFragmentCommitmentIndex()
+	default:
+		var idx byte
+		if idx, err = trie.ReadByte(r); err != nil {
+			return err
+		}
+		if !arity.IsChildIndex(int(idx)) {
+			return fmt.Errorf("wrong child index %d", idx)
+		}
+		e.ChildIndex = int(idx)
+	}
+	if smallFlags&hasTerminalValueFlag != 0 {
+		if e.Terminal, err = trie.ReadBytes8(r); err != nil {
+			return err
+		}
+	} else {
+		e.Terminal = nil
+	}
+	e.Children = make(map[byte][]byte)
+	if smallFlags&hasChildrenFlag != 0 {
+		flags := make([]byte, childBitmapSize(arity))
+		if _, err = io.ReadFull(r, flags); err != nil {
 			return err
 		}
 		for i := 0; i < arity.NumChildren(); i++ {
 			ib := uint8(i)
 			if flags[i/8]&(0x1<<(i%8)) != 0 {
-				e.Children[ib] = make([]byte, sz)
-				if _, err = r.Read(e.Children[ib]); err != nil {
+				e.Children[ib] = make([]byte, childSize)
+				if _, err = io.ReadFull(r, e.Children[ib]); err != nil {
 					return err
 				}
 			}
@@ -260,3 +585,35 @@ func (e *ProofElement) Read(r io.Reader, arity trie.PathArity, sz HashSize) erro
 	}
 	return nil
 }
+
+func childBitmapSize(arity trie.PathArity) int {
+	return (arity.NumChildren() + 7) / 8
+}
+
+// GenerateProofs generates proofs of the keys concurrently with the bounded number of workers.
+// Nodes are read from the trie once and shared between workers. The trie must not be mutated while proofs are generated.
+// Returns proofs in the order of keys
+func (m *CommitmentModel) GenerateProofs(keys [][]byte, tr trie.NodeStore, parallelism int) []*Proof {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	shared := trie.NewConcurrentNodeStore(tr)
+	ret := make([]*Proof, len(keys))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				ret[i] = m.Proof(keys[i], shared)
+			}
+		}()
+	}
+	for i := range keys {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return ret
+}
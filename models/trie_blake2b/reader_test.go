@@ -0,0 +1,43 @@
+package trie_blake2b
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitToDataReader(t *testing.T) {
+	models := []*CommitmentModel{
+		New(trie.PathArity16, HashSize160),
+		New(trie.PathArity256, HashSize256, 100),
+		NewWithSalt(trie.PathArity2, HashSize192, []byte("salt")),
+		NewWithParams(trie.PathArity16, HashSize128, Params{Salt: []byte("salt"), Personalization: []byte("personal")}),
+		NewWithParams(trie.PathArity16, HashSize256, Params{Personalization: []byte("personal")}),
+	}
+	for _, m := range models {
+		t.Run(m.ShortName(), func(t *testing.T) {
+			for _, l := range []int{0, 1, 16, 32, 33, 127, 128, 129, 256, 1000, 100000} {
+				data := make([]byte, l)
+				for i := range data {
+					data[i] = byte(i * 13)
+				}
+				// one byte at a time exercises block boundaries of the streaming hasher
+				c, err := m.CommitToDataReader(iotest.OneByteReader(bytes.NewReader(data)), int64(l))
+				require.NoError(t, err)
+				expected := m.CommitToData(data)
+				if expected == nil {
+					require.Nil(t, c)
+					continue
+				}
+				require.True(t, m.EqualCommitments(expected, c))
+				require.EqualValues(t, m.ForceStoreTerminalWithNode(expected), m.ForceStoreTerminalWithNode(c))
+			}
+			// reader is shorter than the size
+			_, err := m.CommitToDataReader(bytes.NewReader(make([]byte, 50)), 51)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package trie_blake2b
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// The proof stream consists of the header and of the sequence of records, one per key.
+// The header is the serialized proof with the parameters of the commitment model, empty key and empty path.
+// The record is:
+// - the encoded unpacked key
+// - the number of leading path elements shared with the proof of the previous record
+// - the number of path elements which follow
+// - path elements in the encoding of the header (compact or not)
+// The stream ends with the end of data
+
+// StreamProofs writes proofs of all keys with the prefix (in original bytes) to the writer in the lexicographical order
+// of keys. Proofs of adjacent keys share the upper part of the path, so only path elements which differ from the
+// previous proof are written with the record. Each node of the subtrie is read once.
+// Returns number of records written. The stream is read with ProofStreamReader.
+// For the Trie, it is expected all mutations are committed
+func (m *CommitmentModel) StreamProofs(prefix []byte, tr trie.NodeStore, w io.Writer) (int, error) {
+	header := m.newProof(tr.PathArity(), nil, nil)
+	header.Compact = true
+	s := &proofStreamWriter{
+		tr:        tr,
+		w:         w,
+		compact:   header.Compact,
+		childSize: header.childSize(),
+	}
+	if err := header.Write(w); err != nil {
+		return 0, err
+	}
+	n, ok := s.findSubtree(trie.UnpackBytes(prefix, tr.PathArity()))
+	if !ok {
+		return 0, nil
+	}
+	if err := s.visit(n); err != nil {
+		return s.count, fmt.Errorf("trie_blake2b::StreamProofs: %w", err)
+	}
+	return s.count, nil
+}
+
+type proofStreamWriter struct {
+	tr        trie.NodeStore
+	w         io.Writer
+	compact   bool
+	childSize int
+	// path is the proof path from the root to the parent of the current node
+	path []*ProofElement
+	// shared is the number of leading elements of the path which are known to the reader from the previous record
+	shared int
+	count  int
+}
+
+// findSubtree descends to the topmost node which commits to all keys with the unpacked prefix, collecting the path
+func (s *proofStreamWriter) findSubtree(unpackedPrefix []byte) (trie.Node, bool) {
+	n, ok := s.tr.GetNode(nil)
+	if !ok {
+		return nil, false
+	}
+	for {
+		path := trie.Concat(n.Key(), n.PathFragment())
+		if len(unpackedPrefix) <= len(path) {
+			return n, bytes.HasPrefix(path, unpackedPrefix)
+		}
+		if !bytes.HasPrefix(unpackedPrefix, path) {
+			return nil, false
+		}
+		childIndex := unpackedPrefix[len(path)]
+		if _, ok = n.ChildCommitments()[childIndex]; !ok {
+			return nil, false
+		}
+		s.path = append(s.path, newProofElement(n, int(childIndex)))
+		if n, ok = s.tr.GetNode(trie.Concat(path, childIndex)); !ok {
+			return nil, false
+		}
+	}
+}
+
+// visit writes records of terminals of the subtrie in depth-first order
+func (s *proofStreamWriter) visit(n trie.Node) error {
+	path := trie.Concat(n.Key(), n.PathFragment())
+	if n.Terminal() != nil {
+		if err := s.writeRecord(path, newProofElement(n, s.tr.PathArity().TerminalCommitmentIndex())); err != nil {
+			return err
+		}
+	}
+	children := n.ChildCommitments()
+	for i := 0; i < s.tr.PathArity().NumChildren(); i++ {
+		if _, ok := children[byte(i)]; !ok {
+			continue
+		}
+		child, ok := s.tr.GetNode(trie.Concat(path, byte(i)))
+		if !ok {
+			continue
+		}
+		depth := len(s.path)
+		s.path = append(s.path, newProofElement(n, i))
+		if s.shared > depth {
+			s.shared = depth
+		}
+		if err := s.visit(child); err != nil {
+			return err
+		}
+		s.path = s.path[:depth]
+	}
+	return nil
+}
+
+func (s *proofStreamWriter) writeRecord(unpackedKey []byte, last *ProofElement) error {
+	encodedKey, err := trie.EncodeUnpackedBytes(unpackedKey, s.tr.PathArity())
+	if err != nil {
+		return err
+	}
+	if err = trie.WriteBytes16(s.w, encodedKey); err != nil {
+		return err
+	}
+	if err = trie.WriteUint16(s.w, uint16(s.shared)); err != nil {
+		return err
+	}
+	if err = trie.WriteUint16(s.w, uint16(len(s.path)-s.shared+1)); err != nil {
+		return err
+	}
+	for _, e := range append(s.path[s.shared:len(s.path):len(s.path)], last) {
+		if s.compact {
+			err = e.writeCompact(s.w, s.tr.PathArity(), s.childSize)
+		} else {
+			err = e.write(s.w, s.tr.PathArity(), s.childSize)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// the last element is replaced by the next record
+	s.shared = len(s.path)
+	s.count++
+	return nil
+}
+
+// ProofStreamReader reads proofs from the stream written by CommitmentModel.StreamProofs
+type ProofStreamReader struct {
+	r      io.Reader
+	header Proof
+	path   []*ProofElement
+}
+
+// NewProofStreamReader reads the header of the proof stream
+func NewProofStreamReader(r io.Reader) (*ProofStreamReader, error) {
+	ret := &ProofStreamReader{r: r}
+	if err := ret.header.Read(r); err != nil {
+		return nil, err
+	}
+	if len(ret.header.Key) != 0 || len(ret.header.Path) != 0 {
+		return nil, errors.New("wrong proof stream header")
+	}
+	return ret, nil
+}
+
+// Next reads the next record and returns the complete proof of its key. Returns io.EOF when there are no more records.
+// Path elements shared with previous proofs are the same objects, they must not be mutated
+func (s *ProofStreamReader) Next() (*Proof, error) {
+	encodedKey, err := trie.ReadBytes16(s.r)
+	if err != nil {
+		return nil, err
+	}
+	ret := s.header
+	if ret.Key, err = trie.DecodeToUnpackedBytes(encodedKey, ret.PathArity); err != nil {
+		return nil, err
+	}
+	var shared, size uint16
+	if err = trie.ReadUint16(s.r, &shared); err != nil {
+		return nil, noEOF(err)
+	}
+	if err = trie.ReadUint16(s.r, &size); err != nil {
+		return nil, noEOF(err)
+	}
+	if int(shared) > len(s.path) || size == 0 {
+		return nil, errors.New("wrong proof stream record")
+	}
+	ret.Path = make([]*ProofElement, shared, int(shared)+int(size))
+	copy(ret.Path, s.path)
+	for i := 0; i < int(size); i++ {
+		e := &ProofElement{}
+		if ret.Compact {
+			err = e.readCompact(s.r, ret.PathArity, ret.childSize())
+		} else {
+			err = e.read(s.r, ret.PathArity, ret.childSize())
+		}
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		ret.Path = append(ret.Path, e)
+	}
+	s.path = ret.Path
+	return &ret, nil
+}
+
+// noEOF converts end of data in the middle of the record to the error
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package trie_blake2b_verify
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+)
+
+// ErrInvalidProof is the only error returned by the constant-time validation functions. It does not reveal
+// which of the checks failed
+var ErrInvalidProof = errors.New("invalid proof")
+
+// Constant-time validation is intended for verifiers in adversarial settings, where the expected root, value or
+// terminal commitment must not leak through timing. The functions with the ConstantTime suffix:
+// - compare commitments with crypto/subtle, i.e. the time does not depend on the position of the first different byte
+// - perform all checks, including hashing of the value, regardless of the outcome of the previous ones, and combine
+// results without branching
+// - return the same ErrInvalidProof for any failure
+// Early returns in the verification of the path depend only on the shape of the proof and on the key, which
+// are public, so they do not leak the expected commitments. Time depends on lengths of the proof, the key and
+// the value, which are considered public as well
+
+// ValidateConstantTime is Validate in constant time (see ErrInvalidProof)
+func ValidateConstantTime(p *trie_blake2b.Proof, rootBytes []byte) error {
+	return toError(validateConstantTime(p, rootBytes))
+}
+
+// ValidateWithValueConstantTime is ValidateWithValue in constant time (see ErrInvalidProof)
+func ValidateWithValueConstantTime(p *trie_blake2b.Proof, rootBytes []byte, value []byte) error {
+	ok := validateConstantTime(p, rootBytes)
+	expected := trie_blake2b.CommitToDataRaw(value, p.HashSize, hashParams(p)...)
+	return toError(ok & terminalEqual(p, expected))
+}
+
+// ValidateWithTerminalConstantTime is ValidateWithTerminal in constant time (see ErrInvalidProof)
+func ValidateWithTerminalConstantTime(p *trie_blake2b.Proof, rootBytes []byte, terminal []byte) error {
+	ok := validateConstantTime(p, rootBytes)
+	return toError(ok & terminalEqual(p, terminal))
+}
+
+// validateConstantTime returns 1 if the proof is valid against the root, 0 otherwise
+func validateConstantTime(p *trie_blake2b.Proof, rootBytes []byte) int {
+	if len(p.Path) == 0 {
+		return subtle.ConstantTimeEq(int32(len(rootBytes)), 0)
+	}
+	c, err := verify(p, 0, 0)
+	if err != nil {
+		// the error depends only on the shape of the proof
+		return 0
+	}
+	return subtle.ConstantTimeCompare(c, rootBytes)
+}
+
+// terminalEqual returns 1 if the proof is a proof of presence of the terminal commitment, 0 otherwise
+func terminalEqual(p *trie_blake2b.Proof, terminal []byte) int {
+	present := 0
+	// malformed proofs fail the validation anyway
+	_, r, err := KeyWithTerminal(p)
+	if err == nil && r != nil {
+		present = 1
+	}
+	return present & subtle.ConstantTimeCompare(r, terminal)
+}
+
+func toError(ok int) error {
+	if ok != 1 {
+		return ErrInvalidProof
+	}
+	return nil
+}
@@ -10,30 +10,40 @@ import (
 	"golang.org/x/xerrors"
 )
 
-// MustKeyWithTerminal returns key and terminal commitment the proof is about. It returns:
+// KeyWithTerminal returns key and terminal commitment the proof is about. It returns:
 // - key
-// - commitment slice of up to hashSize bytes long. If it is nil, the proof is a proof of absence
+// - commitment slice of up to hashSize bytes long. If it is nil, the proof is a proof of absence. Empty slice is a commitment to the empty value
+// - error if the last element of the proof is malformed
 // It does not verify the proof, so this function should be used only after Validate()
-func MustKeyWithTerminal(p *trie_blake2b.Proof) ([]byte, []byte) {
+func KeyWithTerminal(p *trie_blake2b.Proof) ([]byte, []byte, error) {
 	if len(p.Path) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	lastElem := p.Path[len(p.Path)-1]
 	switch {
 	case p.PathArity.IsChildIndex(lastElem.ChildIndex):
 		if _, ok := lastElem.Children[byte(lastElem.ChildIndex)]; ok {
-			panic("nil child commitment expected for proof of absence")
+			return nil, nil, errors.New("nil child commitment expected for proof of absence")
 		}
-		return p.Key, nil
+		return p.Key, nil, nil
 	case lastElem.ChildIndex == p.PathArity.TerminalCommitmentIndex():
 		if lastElem.Terminal == nil {
-			return p.Key, nil
+			return p.Key, nil, nil
 		}
-		return p.Key, lastElem.Terminal
+		return p.Key, lastElem.Terminal, nil
 	case lastElem.ChildIndex == p.PathArity.PathFragmentCommitmentIndex():
-		return p.Key, nil
+		return p.Key, nil, nil
+	}
+	return nil, nil, fmt.Errorf("wrong child index %d of the last element", lastElem.ChildIndex)
+}
+
+// MustKeyWithTerminal is KeyWithTerminal which panics if the last element of the proof is malformed
+func MustKeyWithTerminal(p *trie_blake2b.Proof) ([]byte, []byte) {
+	key, terminal, err := KeyWithTerminal(p)
+	if err != nil {
+		panic(err)
 	}
-	panic("wrong lastElem.ChildIndex")
+	return key, terminal
 }
 
 // IsProofOfAbsence checks if it is proof of absence. Proof that the trie commits to something else in the place
@@ -66,16 +76,38 @@ func ValidateWithValue(p *trie_blake2b.Proof, rootBytes []byte, value []byte) er
 	if err := Validate(p, rootBytes); err != nil {
 		return err
 	}
-	_, r := MustKeyWithTerminal(p)
-	if len(r) == 0 {
+	_, r, err := KeyWithTerminal(p)
+	if err != nil {
+		return err
+	}
+	if r == nil {
 		return errors.New("key is not present in the state")
 	}
-	if !bytes.Equal(trie_blake2b.CommitToDataRaw(value, p.HashSize), r) {
+	if !bytes.Equal(trie_blake2b.CommitToDataRaw(value, p.HashSize, hashParams(p)...), r) {
 		return errors.New("key does not correspond to the given value")
 	}
 	return nil
 }
 
+// ValidateWithTerminal checks the proof and checks if the proof commits to the specific terminal commitment,
+// inserted with trie.Trie.UpdateWithTerminal
+func ValidateWithTerminal(p *trie_blake2b.Proof, rootBytes []byte, terminal []byte) error {
+	if err := Validate(p, rootBytes); err != nil {
+		return err
+	}
+	_, r, err := KeyWithTerminal(p)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return errors.New("key is not present in the state")
+	}
+	if !bytes.Equal(terminal, r) {
+		return errors.New("key does not correspond to the given terminal commitment")
+	}
+	return nil
+}
+
 //CommitmentToTheTerminalNode returns hash of the last node in the proof
 //If it is a valid proof, it s always contains terminal commitment
 //It is useful to get commitment to the sub-state. It must contain some value
@@ -84,7 +116,7 @@ func CommitmentToTheTerminalNode(p *trie_blake2b.Proof) []byte {
 	if len(p.Path) == 0 {
 		return nil
 	}
-	return hashIt(p.Path[len(p.Path)-1], nil, p.PathArity, p.HashSize)
+	return hashIt(p.Path[len(p.Path)-1], nil, p)
 }
 
 func verify(p *trie_blake2b.Proof, pathIdx, keyIdx int) ([]byte, error) {
@@ -92,6 +124,9 @@ func verify(p *trie_blake2b.Proof, pathIdx, keyIdx int) ([]byte, error) {
 	trie.Assert(keyIdx <= len(p.Key), "assertion: keyIdx <= lenPlus1(p.Key)")
 
 	elem := p.Path[pathIdx]
+	if err := checkChildSizes(elem, p); err != nil {
+		return nil, fmt.Errorf("wrong proof: %v. Path position: %d, key position %d", err, pathIdx, keyIdx)
+	}
 	tail := p.Key[keyIdx:]
 	isPrefix := bytes.HasPrefix(tail, elem.PathFragment)
 	last := pathIdx == len(p.Path)-1
@@ -114,7 +149,10 @@ func verify(p *trie_blake2b.Proof, pathIdx, keyIdx int) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		return hashIt(elem, c, p.PathArity, p.HashSize), nil
+		if len(c) != commitmentSize(p) {
+			return nil, fmt.Errorf("wrong proof: empty node. Path position: %d, key position %d", pathIdx+1, nextKeyIdx)
+		}
+		return hashIt(elem, c, p), nil
 	}
 	// it is the last in the path
 	if p.PathArity.IsChildIndex(elem.ChildIndex) {
@@ -122,31 +160,120 @@ func verify(p *trie_blake2b.Proof, pathIdx, keyIdx int) ([]byte, error) {
 		if c != nil {
 			return nil, fmt.Errorf("wrong proof: child commitment of the last element expected to be nil. Path position: %d, key position %d", pathIdx, keyIdx)
 		}
-		return hashIt(elem, nil, p.PathArity, p.HashSize), nil
+		return hashIt(elem, nil, p), nil
 	}
 	if elem.ChildIndex != p.PathArity.TerminalCommitmentIndex() && elem.ChildIndex != p.PathArity.PathFragmentCommitmentIndex() {
 		return nil, fmt.Errorf("wrong proof: child index expected to be %d or %d. Path position: %d, key position %d",
 			p.PathArity.TerminalCommitmentIndex(), p.PathArity.PathFragmentCommitmentIndex(), pathIdx, keyIdx)
 	}
-	return hashIt(elem, nil, p.PathArity, p.HashSize), nil
+	return hashIt(elem, nil, p), nil
 }
 
-func makeHashVector(e *trie_blake2b.ProofElement, missingCommitment []byte, arity trie.PathArity, sz trie_blake2b.HashSize) [][]byte {
+func makeHashVector(e *trie_blake2b.ProofElement, missingCommitment []byte, p *trie_blake2b.Proof) [][]byte {
+	arity, sz, params := p.PathArity, p.HashSize, hashParams(p)
 	hashes := make([][]byte, arity.VectorLength())
 	for idx, c := range e.Children {
 		trie.Assert(arity.IsChildIndex(int(idx)), "arity.IsChildIndex(int(idx)")
-		hashes[idx] = c
+		hashes[p.ChildOrder.Position(int(idx), arity)] = c
 	}
-	if len(e.Terminal) > 0 {
-		hashes[arity.TerminalCommitmentIndex()] = e.Terminal
+	if e.Terminal != nil {
+		hashes[arity.TerminalCommitmentIndex()] = trie_blake2b.TerminalVectorElement(e.Terminal, sz)
 	}
-	hashes[arity.PathFragmentCommitmentIndex()] = trie_blake2b.CommitToDataRaw(e.PathFragment, sz)
+	hashes[arity.PathFragmentCommitmentIndex()] = trie_blake2b.CommitToDataRaw(e.PathFragment, sz, params...)
 	if arity.IsChildIndex(e.ChildIndex) {
-		hashes[e.ChildIndex] = missingCommitment
+		hashes[p.ChildOrder.Position(e.ChildIndex, arity)] = missingCommitment
 	}
 	return hashes
 }
 
-func hashIt(e *trie_blake2b.ProofElement, missingCommitment []byte, arity trie.PathArity, sz trie_blake2b.HashSize) []byte {
-	return trie_blake2b.HashTheVector(makeHashVector(e, missingCommitment, arity, sz), arity, sz)
+func hashIt(e *trie_blake2b.ProofElement, missingCommitment []byte, p *trie_blake2b.Proof) []byte {
+	if p.Aggregator != nil {
+		return trie_blake2b.HashTheAggregatedVector(makeHashVector(e, missingCommitment, p), elemAggregate(e, missingCommitment, p),
+			p.PathArity, p.HashSize, hashParams(p)...)
+	}
+	return trie_blake2b.HashTheVector(makeHashVector(e, missingCommitment, p), p.PathArity, p.HashSize, hashParams(p)...)
+}
+
+// elemAggregate is the aggregate of the subtree of the element of the proof of the aggregating model
+func elemAggregate(e *trie_blake2b.ProofElement, missingCommitment []byte, p *trie_blake2b.Proof) []byte {
+	children := e.Children
+	if missingCommitment != nil {
+		children = make(map[byte][]byte, len(e.Children)+1)
+		for idx, c := range e.Children {
+			children[idx] = c
+		}
+		children[byte(e.ChildIndex)] = missingCommitment
+	}
+	return trie_blake2b.AggregateNode(p.Aggregator, e.Terminal, children, p.HashSize)
+}
+
+// commitmentSize is the size of vector commitments of the model of the proof
+func commitmentSize(p *trie_blake2b.Proof) int {
+	if p.Aggregator != nil {
+		return trie_blake2b.AggregatedCommitmentSize(p.HashSize, p.Aggregator)
+	}
+	return int(p.HashSize)
+}
+
+// checkChildSizes checks if child commitments of the element are of the size of vector commitments of the model
+func checkChildSizes(e *trie_blake2b.ProofElement, p *trie_blake2b.Proof) error {
+	size := commitmentSize(p)
+	for idx, c := range e.Children {
+		if len(c) != size {
+			return fmt.Errorf("wrong size of the child commitment %d", idx)
+		}
+	}
+	return nil
+}
+
+// ValidateAggregate checks the proof of the aggregating model returned by trie_blake2b.CommitmentModel.AggregateProof
+// and returns the aggregate of keys with the prefix, which is the key of the proof. Returns nil if there are no such keys
+func ValidateAggregate(p *trie_blake2b.Proof, rootBytes []byte) ([]byte, error) {
+	if p.Aggregator == nil {
+		return nil, errors.New("not a proof of the aggregating model")
+	}
+	if err := Validate(p, rootBytes); err != nil {
+		return nil, err
+	}
+	if len(p.Path) == 0 {
+		return nil, nil
+	}
+	keyIdx := 0
+	for _, e := range p.Path[:len(p.Path)-1] {
+		keyIdx += len(e.PathFragment) + 1
+	}
+	lastElem := p.Path[len(p.Path)-1]
+	tail := p.Key[keyIdx:]
+	// the last node is authenticated by the path, so the aggregate follows from its content regardless of the ending
+	if bytes.HasPrefix(lastElem.PathFragment, tail) {
+		// the prefix ends at the last node
+		return elemAggregate(lastElem, nil, p), nil
+	}
+	if !bytes.HasPrefix(tail, lastElem.PathFragment) {
+		// the prefix diverges from the path fragment
+		return nil, nil
+	}
+	if _, ok := lastElem.Children[tail[len(lastElem.PathFragment)]]; ok {
+		return nil, errors.New("wrong proof: proof path does not reach the prefix")
+	}
+	// the child on the path of the prefix is absent
+	return nil, nil
+}
+
+// ValidateCount checks the proof of the model with trie_blake2b.CountAggregator returned by
+// trie_blake2b.CommitmentModel.CountProof and returns the number of keys with the prefix
+func ValidateCount(p *trie_blake2b.Proof, rootBytes []byte) (uint64, error) {
+	if p.Aggregator != trie_blake2b.CountAggregator {
+		return 0, errors.New("not a proof of the counting model")
+	}
+	agg, err := ValidateAggregate(p, rootBytes)
+	if err != nil {
+		return 0, err
+	}
+	return trie_blake2b.Uint64FromAggregate(agg), nil
+}
+
+// hashParams returns optional hashing parameters of the model in the order accepted by trie_blake2b.HashTheVector
+func hashParams(p *trie_blake2b.Proof) [][]byte {
+	return [][]byte{p.Salt, p.Personalization}
 }
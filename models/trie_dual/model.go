@@ -0,0 +1,231 @@
+// Package trie_dual implements trie.CommitmentModel which maintains commitments of two models in lockstep.
+// The trie with the dual model has one node structure and one node store, while each node commits
+// to the same data with both models. Root commitment contains roots of both models.
+// Proofs of each model are built from the projection of the trie to the model (see Projection)
+package trie_dual
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// vectorCommitment is a pair of vector commitments of both models
+type vectorCommitment [2]trie.VCommitment
+
+// terminalCommitment is a pair of terminal commitments of both models
+type terminalCommitment [2]trie.TCommitment
+
+// CommitmentModel is a composition of two commitment models of the same path arity
+type CommitmentModel struct {
+	models [2]trie.CommitmentModel
+}
+
+// New creates the dual commitment model. Both models must have the same path arity
+func New(m0, m1 trie.CommitmentModel) *CommitmentModel {
+	trie.Assert(m0.PathArity() == m1.PathArity(), "trie_dual: models must have the same path arity. Got %s and %s",
+		m0.PathArity(), m1.PathArity())
+	return &CommitmentModel{models: [2]trie.CommitmentModel{m0, m1}}
+}
+
+// Model returns the component model, i = 0 or 1
+func (m *CommitmentModel) Model(i int) trie.CommitmentModel {
+	return m.models[i]
+}
+
+// Commitment returns component of the dual vector commitment, i = 0 or 1. Nil commitment has nil components
+func Commitment(c trie.VCommitment, i int) trie.VCommitment {
+	if c == nil {
+		return nil
+	}
+	return c.(*vectorCommitment)[i]
+}
+
+// Terminal returns component of the dual terminal commitment, i = 0 or 1. Nil commitment has nil components
+func Terminal(t trie.TCommitment, i int) trie.TCommitment {
+	if t == nil {
+		return nil
+	}
+	return t.(*terminalCommitment)[i]
+}
+
+func (m *CommitmentModel) PathArity() trie.PathArity {
+	return m.models[0].PathArity()
+}
+
+func (m *CommitmentModel) EqualCommitments(c1, c2 trie.Serializable) bool {
+	if equals, conclusive := trie.CheckNils(c1, c2); conclusive {
+		return equals
+	}
+	switch c1t := c1.(type) {
+	case *vectorCommitment:
+		c2t, ok := c2.(*vectorCommitment)
+		return ok && m.models[0].EqualCommitments(c1t[0], c2t[0]) && m.models[1].EqualCommitments(c1t[1], c2t[1])
+	case *terminalCommitment:
+		c2t, ok := c2.(*terminalCommitment)
+		return ok && m.models[0].EqualCommitments(c1t[0], c2t[0]) && m.models[1].EqualCommitments(c1t[1], c2t[1])
+	}
+	return false
+}
+
+func (m *CommitmentModel) NewVectorCommitment() trie.VCommitment {
+	return &vectorCommitment{m.models[0].NewVectorCommitment(), m.models[1].NewVectorCommitment()}
+}
+
+func (m *CommitmentModel) NewTerminalCommitment() trie.TCommitment {
+	return &terminalCommitment{m.models[0].NewTerminalCommitment(), m.models[1].NewTerminalCommitment()}
+}
+
+func (m *CommitmentModel) CommitToData(data []byte) trie.TCommitment {
+	return newTerminalCommitment(m.models[0].CommitToData(data), m.models[1].CommitToData(data))
+}
+
+// CommitToEmptyValue implements trie.EmptyValueCommitter. Both models must implement it
+func (m *CommitmentModel) CommitToEmptyValue() trie.TCommitment {
+	var ret [2]trie.TCommitment
+	for i, model := range m.models {
+		evc, ok := model.(trie.EmptyValueCommitter)
+		trie.Assert(ok, "trie_dual: model %s does not support empty values", model.ShortName())
+		ret[i] = evc.CommitToEmptyValue()
+	}
+	return newTerminalCommitment(ret[0], ret[1])
+}
+
+func newTerminalCommitment(t0, t1 trie.TCommitment) trie.TCommitment {
+	trie.Assert((t0 == nil) == (t1 == nil), "trie_dual: inconsistent terminal commitments")
+	if t0 == nil {
+		return nil
+	}
+	return &terminalCommitment{t0, t1}
+}
+
+func (m *CommitmentModel) CalcNodeCommitment(data *trie.NodeData) trie.VCommitment {
+	c0 := m.models[0].CalcNodeCommitment(projectNodeData(data, 0))
+	c1 := m.models[1].CalcNodeCommitment(projectNodeData(data, 1))
+	if c0 == nil && c1 == nil {
+		return nil
+	}
+	return &vectorCommitment{c0, c1}
+}
+
+// UpdateNodeCommitment updates projections of the node data with each model, then applies the update to the node data
+func (m *CommitmentModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdates map[byte]trie.VCommitment, calcDelta bool, terminal trie.TCommitment, update *trie.VCommitment) {
+	var updated [2]trie.VCommitment
+	for i, model := range m.models {
+		childUpdatesProjected := make(map[byte]trie.VCommitment, len(childUpdates))
+		for idx, c := range childUpdates {
+			childUpdatesProjected[idx] = Commitment(c, i)
+		}
+		var upd *trie.VCommitment
+		if update != nil {
+			updated[i] = Commitment(*update, i)
+			upd = &updated[i]
+		}
+		model.UpdateNodeCommitment(projectNodeData(mutate, i), childUpdatesProjected, calcDelta, Terminal(terminal, i), upd)
+	}
+	for idx, c := range childUpdates {
+		if c == nil {
+			delete(mutate.ChildCommitments, idx)
+		} else {
+			mutate.ChildCommitments[idx] = c
+		}
+	}
+	mutate.Terminal = terminal
+	if update == nil {
+		return
+	}
+	if updated[0] == nil && updated[1] == nil {
+		*update = nil
+		return
+	}
+	*update = &vectorCommitment{updated[0], updated[1]}
+}
+
+// ForceStoreTerminalWithNode is true if any of the models requires it
+func (m *CommitmentModel) ForceStoreTerminalWithNode(c trie.TCommitment) bool {
+	return m.models[0].ForceStoreTerminalWithNode(Terminal(c, 0)) || m.models[1].ForceStoreTerminalWithNode(Terminal(c, 1))
+}
+
+func (m *CommitmentModel) Description() string {
+	return fmt.Sprintf("dual commitment model of (1) %s and (2) %s", m.models[0].Description(), m.models[1].Description())
+}
+
+func (m *CommitmentModel) ShortName() string {
+	return fmt.Sprintf("dual_%s_%s", m.models[0].ShortName(), m.models[1].ShortName())
+}
+
+// projectNodeData returns node data with commitments of the model i. Path fragment is shared
+func projectNodeData(n *trie.NodeData, i int) *trie.NodeData {
+	ret := trie.NewNodeData()
+	ret.PathFragment = n.PathFragment
+	ret.Terminal = Terminal(n.Terminal, i)
+	for idx, c := range n.ChildCommitments {
+		ret.ChildCommitments[idx] = Commitment(c, i)
+	}
+	return ret
+}
+
+// *vectorCommitment implements trie.VCommitment
+var _ trie.VCommitment = &vectorCommitment{}
+
+func (v *vectorCommitment) Clone() trie.VCommitment {
+	if v == nil {
+		return nil
+	}
+	return &vectorCommitment{v[0].Clone(), v[1].Clone()}
+}
+
+func (v *vectorCommitment) Read(r io.Reader) error {
+	if err := v[0].Read(r); err != nil {
+		return err
+	}
+	return v[1].Read(r)
+}
+
+func (v *vectorCommitment) Write(w io.Writer) error {
+	if err := v[0].Write(w); err != nil {
+		return err
+	}
+	return v[1].Write(w)
+}
+
+func (v *vectorCommitment) Bytes() []byte {
+	return trie.MustBytes(v)
+}
+
+func (v *vectorCommitment) String() string {
+	return fmt.Sprintf("(%s, %s)", v[0], v[1])
+}
+
+// *terminalCommitment implements trie.TCommitment
+var _ trie.TCommitment = &terminalCommitment{}
+
+func (t *terminalCommitment) Clone() trie.TCommitment {
+	if t == nil {
+		return nil
+	}
+	return &terminalCommitment{t[0].Clone(), t[1].Clone()}
+}
+
+func (t *terminalCommitment) Read(r io.Reader) error {
+	if err := t[0].Read(r); err != nil {
+		return err
+	}
+	return t[1].Read(r)
+}
+
+func (t *terminalCommitment) Write(w io.Writer) error {
+	if err := t[0].Write(w); err != nil {
+		return err
+	}
+	return t[1].Write(w)
+}
+
+func (t *terminalCommitment) Bytes() []byte {
+	return trie.MustBytes(t)
+}
+
+func (t *terminalCommitment) String() string {
+	return fmt.Sprintf("(%s, %s)", t[0], t[1])
+}
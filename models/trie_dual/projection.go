@@ -0,0 +1,67 @@
+package trie_dual
+
+import (
+	"fmt"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// projection is the node store of the trie with the dual model, as seen by one of the component models
+type projection struct {
+	tr trie.NodeStore
+	i  int
+}
+
+// projectedNode is the node with commitments of one of the component models
+type projectedNode struct {
+	trie.Node
+	i int
+}
+
+// Projection returns the node store of the trie with the dual model as seen by the component model i = 0 or 1.
+// Proofs of the component model are built from the projection, for example
+// trie_blake2b.CommitmentModel.Proof(key, Projection(tr, 0)), and are validated against the root of the component
+func Projection(tr trie.NodeStore, i int) trie.NodeStore {
+	_, ok := tr.Model().(*CommitmentModel)
+	trie.Assert(ok, "trie_dual: trie with the dual commitment model expected")
+	trie.Assert(i == 0 || i == 1, "trie_dual: wrong model index %d", i)
+	return &projection{tr: tr, i: i}
+}
+
+// RootCommitments returns root commitments of both component models
+func RootCommitments(tr trie.NodeStore) (trie.VCommitment, trie.VCommitment) {
+	root := trie.RootCommitment(tr)
+	return Commitment(root, 0), Commitment(root, 1)
+}
+
+func (p *projection) GetNode(unpackedKey []byte) (trie.Node, bool) {
+	n, ok := p.tr.GetNode(unpackedKey)
+	if !ok {
+		return nil, false
+	}
+	return &projectedNode{Node: n, i: p.i}, true
+}
+
+func (p *projection) Model() trie.CommitmentModel {
+	return p.tr.Model().(*CommitmentModel).models[p.i]
+}
+
+func (p *projection) PathArity() trie.PathArity {
+	return p.tr.PathArity()
+}
+
+func (p *projection) Info() string {
+	return fmt.Sprintf("projection #%d (model: %s) of %s", p.i, p.Model().ShortName(), p.tr.Info())
+}
+
+func (n *projectedNode) Terminal() trie.TCommitment {
+	return Terminal(n.Node.Terminal(), n.i)
+}
+
+func (n *projectedNode) ChildCommitments() map[byte]trie.VCommitment {
+	ret := make(map[byte]trie.VCommitment)
+	for idx, c := range n.Node.ChildCommitments() {
+		ret[idx] = Commitment(c, n.i)
+	}
+	return ret
+}
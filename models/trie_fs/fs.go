@@ -0,0 +1,168 @@
+// Package trie_fs maps slash-separated paths, as in io/fs, onto keys of the trie, so verifiable configuration
+// and content trees can be built on top of the trie: files are values of keys, directories are common prefixes of paths.
+// Directories are implicit, i.e. the directory exists as long as it contains files. Files are proven with proofs
+// of the commitment model of the trie and verified with trie_verify
+package trie_fs
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/models/trie_verify"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// FS is the namespace of paths under the key prefix of the trie. The key of the file is the prefix followed by the name
+// of the file. Names are paths valid in the sense of fs.ValidPath, e.g. "etc/config.json". The root directory is ".".
+// Errors are *fs.PathError wrapping fs.ErrInvalid for wrong names and fs.ErrNotExist for absent files and directories
+type FS struct {
+	// Prefix is the namespace of keys
+	Prefix []byte
+}
+
+// Entry is the entry of the directory. The same name may be both the file and the directory
+type Entry struct {
+	Name  string
+	IsDir bool
+}
+
+// Key returns the key of the file
+func (f FS) Key(name string) ([]byte, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "key", Path: name, Err: fs.ErrInvalid}
+	}
+	return trie.Concat(f.Prefix, name), nil
+}
+
+// Name returns the name of the file of the key
+func (f FS) Name(key []byte) (string, error) {
+	if !bytes.HasPrefix(key, f.Prefix) {
+		return "", &fs.PathError{Op: "name", Path: fmt.Sprintf("%x", key), Err: fs.ErrInvalid}
+	}
+	name := string(key[len(f.Prefix):])
+	if !fs.ValidPath(name) || name == "." {
+		return "", &fs.PathError{Op: "name", Path: name, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+// WriteFile updates the file in the trie. Empty data removes the file, same as updates of the trie with empty values
+func (f FS) WriteFile(tr *trie.Trie, name string, data []byte) error {
+	key, err := f.Key(name)
+	if err != nil {
+		return err
+	}
+	tr.Update(key, data)
+	return nil
+}
+
+// Remove removes the file from the trie
+func (f FS) Remove(tr *trie.Trie, name string) error {
+	key, err := f.Key(name)
+	if err != nil {
+		return err
+	}
+	tr.Delete(key)
+	return nil
+}
+
+// ReadFile returns content of the file committed in the trie, read from the value store
+func (f FS) ReadFile(tr trie.NodeStore, valueStore trie.KVReader, name string) ([]byte, error) {
+	key, err := f.Key(name)
+	if err != nil {
+		return nil, err
+	}
+	if !trie.HasMany(tr, [][]byte{key})[0] {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	data := valueStore.Get(key)
+	if data == nil {
+		return nil, fmt.Errorf("trie_fs: file '%s' is committed in the trie but missing in the value store", name)
+	}
+	return data, nil
+}
+
+// ReadDir returns entries of the directory sorted by name, files before directories of the same name.
+// All keys under the directory are iterated, including those of nested directories.
+// For the Trie, it is expected all mutations are committed
+func (f FS) ReadDir(tr trie.NodeStore, dir string) ([]Entry, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrInvalid}
+	}
+	prefix := f.Prefix
+	if dir != "." {
+		prefix = trie.Concat(f.Prefix, dir, "/")
+	}
+	ret := make([]Entry, 0)
+	seen := make(map[Entry]struct{})
+	err := trie.IteratePrefixDepth(tr, prefix, math.MaxInt32, func(key []byte, _ trie.TCommitment) bool {
+		rest := string(key[len(prefix):])
+		e := Entry{Name: rest}
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			e = Entry{Name: rest[:i], IsDir: true}
+		}
+		if _, ok := seen[e]; !ok && fs.ValidPath(e.Name) {
+			seen[e] = struct{}{}
+			ret = append(ret, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 && dir != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrNotExist}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return !ret[i].IsDir
+	})
+	return ret, nil
+}
+
+// Proof returns the serialized proof of the file, verified with VerifyFile. For blake2b models it is the proof
+// of inclusion of the present file or the proof of absence. The KZG model only proves inclusion, so for the absent file
+// the error wrapping fs.ErrNotExist is returned
+func (f FS) Proof(tr trie.NodeStore, name string) ([]byte, error) {
+	key, err := f.Key(name)
+	if err != nil {
+		return nil, err
+	}
+	switch m := tr.Model().(type) {
+	case *trie_blake2b.CommitmentModel:
+		return m.Proof(key, tr).Bytes(), nil
+	case *trie_kzg_bn256.CommitmentModel:
+		p, ok := m.ProofOfInclusion(key, tr)
+		if !ok {
+			return nil, &fs.PathError{Op: "proof", Path: name, Err: fs.ErrNotExist}
+		}
+		return p.Bytes(), nil
+	}
+	return nil, fmt.Errorf("trie_fs: model '%s': %w", tr.Model().ShortName(), trie_verify.ErrUnsupportedModel)
+}
+
+// VerifyFile verifies the serialized proof of the file with the content against the serialized root commitment
+// of the model (see trie_verify.VerifyInclusion). Returns the error wrapping fs.ErrNotExist if the proof is the valid
+// proof of absence of the file
+func (f FS) VerifyFile(rootBytes []byte, modelDescriptor string, name string, data, proof []byte) error {
+	key, err := f.Key(name)
+	if err != nil {
+		return err
+	}
+	res, err := trie_verify.VerifyInclusion(rootBytes, modelDescriptor, key, data, proof)
+	if err != nil {
+		return fmt.Errorf("trie_fs: file '%s': %w", name, err)
+	}
+	if res.Status != trie_verify.Present {
+		return &fs.PathError{Op: "verify", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package trie_kzg_bn256_test
+
+import (
+	"fmt"
+
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+func ExampleCommitmentModel_ProofOfInclusion() {
+	model := trie_kzg_bn256.New()
+	tr := trie.New(model, trie.NewInMemoryKVStore(), nil)
+	for _, s := range []string{"a", "abc", "abcd", "b", "klmn"} {
+		tr.UpdateStr(s, s+"$")
+	}
+	tr.Commit()
+	root := trie.RootCommitment(tr)
+
+	for _, s := range []string{"abc", "abd"} {
+		proof, ok := model.ProofOfInclusion([]byte(s), tr)
+		if !ok {
+			fmt.Printf("'%s' is absent\n", s)
+			continue
+		}
+		fmt.Printf("'%s' is present, proof length %d, valid: %v\n", s, len(proof.Path), proof.Validate(root) == nil)
+	}
+	// Output:
+	// 'abc' is present, proof length 3, valid: true
+	// 'abd' is absent
+}
@@ -7,16 +7,7 @@ import "go.dedis.ch/kyber/v3"
 // i.e. with f(rou[i]) = vect[i], i = 0..D-1
 // vect[k] == nil equivalent to 0
 func (sd *TrustedSetup) commit(vect []kyber.Scalar) kyber.Point {
-	ret := sd.Suite.G1().Point().Null()
-	elem := sd.Suite.G1().Point()
-	for i, e := range vect {
-		if e == nil {
-			continue
-		}
-		elem.Mul(e, sd.LagrangeBasis[i])
-		ret.Add(ret, elem)
-	}
-	return ret
+	return sd.msm.multiExp(vect)
 }
 
 // prove returns pi = [(f(s)-vect<index>)/(s-rou<index>)]1
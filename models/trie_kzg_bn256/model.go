@@ -143,6 +143,11 @@ func (m *CommitmentModel) CommitToData(data []byte) trie.TCommitment {
 	return commitToData(data, m.Suite)
 }
 
+// CommitToEmptyValue implements trie.EmptyValueCommitter. It is a scalar of the hash of the empty data
+func (m *CommitmentModel) CommitToEmptyValue() trie.TCommitment {
+	return commitToEmptyValue(m.Suite)
+}
+
 func (m *CommitmentModel) UpdateVCommitment(c *trie.VCommitment, delta trie.VCommitment) {
 	if *c == nil {
 		*c = m.newVectorCommitment()
@@ -153,14 +158,10 @@ func (m *CommitmentModel) UpdateVCommitment(c *trie.VCommitment, delta trie.VCom
 
 // UpdateNodeCommitment updates mutated part of node's data and, optionaly, upper
 func (m *CommitmentModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdates map[byte]trie.VCommitment, calcDelta bool, terminal trie.TCommitment, update *trie.VCommitment) {
-	var deltas map[int]kyber.Scalar
+	var deltas [258]kyber.Scalar
 
 	trie.Assert(!calcDelta || (update != nil && *update != nil), "UpdateNodeCommitment: inconsistent parameters")
 
-	if calcDelta {
-		deltas = make(map[int]kyber.Scalar)
-	}
-
 	for i, childUpd := range childUpdates {
 		if calcDelta {
 			delta := m.TrustedSetup.Suite.G1().Scalar().Zero()
@@ -177,8 +178,8 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdat
 					prevS := scalarFromPoint(m.TrustedSetup.Suite.G1().Scalar(), prevC.(*vectorCommitment).Point)
 					delta.Sub(delta, prevS)
 				}
-				deltas[int(i)] = delta
 			}
+			deltas[int(i)] = delta
 		}
 		// update mutated part
 		if childUpd == nil {
@@ -191,8 +192,7 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdat
 		delta := m.TrustedSetup.Suite.G1().Scalar().Zero()
 		if terminal == nil {
 			if mutate.Terminal != nil {
-				delta = mutate.Terminal.(*terminalCommitment).Scalar
-				delta.Neg(delta)
+				delta.Neg(mutate.Terminal.(*terminalCommitment).Scalar)
 			}
 		} else {
 			delta.Set(terminal.(*terminalCommitment).Scalar)
@@ -206,17 +206,13 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdat
 	if calcDelta {
 		var prevP kyber.Point
 
-		// update upper commitment by adding calculated delta
+		// update upper commitment by adding commitment to the vector of calculated deltas
 		if *update != nil {
 			prevP = (*update).(*vectorCommitment).Point
 		} else {
 			prevP = m.TrustedSetup.Suite.G1().Point().Null()
 		}
-		elem := m.TrustedSetup.Suite.G1().Point()
-		for i, deltaS := range deltas {
-			elem.Mul(deltaS, m.TrustedSetup.LagrangeBasis[i])
-			prevP.Add(prevP, elem)
-		}
+		prevP.Add(prevP, m.TrustedSetup.commit(deltas[:]))
 		*update = m.newVectorCommitment(prevP)
 	} else {
 		if update != nil {
@@ -254,9 +250,13 @@ func makeVector(n *trie.NodeData, ts *TrustedSetup, ret *[258]kyber.Scalar) {
 	if n.Terminal != nil {
 		ret[256] = n.Terminal.(*terminalCommitment).Scalar
 	}
-	h := blake2b.Sum256(n.PathFragment)
-	ret[257] = ts.Suite.G1().Scalar()
-	scalarFromBytes(ret[257], h[:])
+	ret[257] = scalarFromPathFragment(ts.Suite.G1().Scalar(), n.PathFragment)
+}
+
+// scalarFromPathFragment returns the element of the vector which commits to the path fragment of the node
+func scalarFromPathFragment(ret kyber.Scalar, pathFragment []byte) kyber.Scalar {
+	h := blake2b.Sum256(pathFragment)
+	return scalarFromBytes(ret, h[:])
 }
 
 // scalarFromPoint hashes the point and make a scalar from hash
@@ -289,3 +289,10 @@ func commitToData(data []byte, suite *bn256.Suite) trie.TCommitment {
 	ret.Scalar.SetBytes(h[:])
 	return ret
 }
+
+func commitToEmptyValue(suite *bn256.Suite) trie.TCommitment {
+	h := blake2b.Sum256(nil)
+	ret := &terminalCommitment{Scalar: suite.G1().Scalar()}
+	ret.Scalar.SetBytes(h[:])
+	return ret
+}
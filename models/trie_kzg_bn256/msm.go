@@ -0,0 +1,119 @@
+package trie_kzg_bn256
+
+import (
+	"math/big"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/group/mod"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+)
+
+// Multi-scalar multiplication sum_i(s_i * B_i) over the fixed bases of the Lagrange basis
+// by the Pippenger (bucket) method.
+// Each scalar is split into 8-bit digits (bytes of the scalar). For every base B_i the table of
+// points 2^(8k) * B_i, k = 0..31 is precomputed, so all digits of all scalars are accumulated
+// into 255 buckets by point additions only, without doublings.
+// The cost is about n*32 additions for n non-zero scalars plus 510 additions to aggregate buckets,
+// compared to n full scalar multiplications (about 380 group operations each) of the naive method
+
+const (
+	msmWindowBits = 8
+	msmNumWindows = 256 / msmWindowBits
+	msmNumBuckets = 1 << msmWindowBits
+	// msmMinScalars is the minimum number of non-zero scalars for which the bucket method is faster than
+	// individual scalar multiplications
+	msmMinScalars = 3
+)
+
+// msmTable is the lazily precomputed table of multiples of the bases
+type msmTable struct {
+	once  sync.Once
+	suite *bn256.Suite
+	bases []kyber.Point
+	table [][msmNumWindows]kyber.Point // table[i][k] = 2^(8k) * bases[i]
+}
+
+func newMsmTable(suite *bn256.Suite, bases []kyber.Point) *msmTable {
+	return &msmTable{
+		suite: suite,
+		bases: bases,
+	}
+}
+
+func (t *msmTable) precompute() {
+	t.table = make([][msmNumWindows]kyber.Point, len(t.bases))
+	for i, b := range t.bases {
+		p := b.Clone()
+		for k := 0; k < msmNumWindows; k++ {
+			t.table[i][k] = p.Clone()
+			for j := 0; j < msmWindowBits; j++ {
+				p.Add(p, p)
+			}
+		}
+	}
+}
+
+// multiExp returns sum_i(scalars[i] * bases[i]). Nil scalar is equivalent to 0
+func (t *msmTable) multiExp(scalars []kyber.Scalar) kyber.Point {
+	ret := t.suite.G1().Point().Null()
+	n := 0
+	for _, s := range scalars {
+		if s != nil {
+			n++
+		}
+	}
+	if n < msmMinScalars {
+		elem := t.suite.G1().Point()
+		for i, s := range scalars {
+			if s == nil {
+				continue
+			}
+			elem.Mul(s, t.bases[i])
+			ret.Add(ret, elem)
+		}
+		return ret
+	}
+	t.once.Do(t.precompute)
+
+	var buckets [msmNumBuckets]kyber.Point
+	var digits [msmNumWindows]byte
+	for i, s := range scalars {
+		if s == nil {
+			continue
+		}
+		scalarDigits(s, &digits)
+		for k, d := range digits {
+			if d == 0 {
+				continue
+			}
+			if buckets[d] == nil {
+				buckets[d] = t.table[i][k].Clone()
+			} else {
+				buckets[d].Add(buckets[d], t.table[i][k])
+			}
+		}
+	}
+	// sum_d(d * buckets[d]) as sum of running sums from the highest bucket
+	sum := t.suite.G1().Point().Null()
+	for d := msmNumBuckets - 1; d > 0; d-- {
+		if buckets[d] != nil {
+			sum.Add(sum, buckets[d])
+		}
+		ret.Add(ret, sum)
+	}
+	return ret
+}
+
+// scalarDigits splits scalar into bytes, the least significant first
+func scalarDigits(s kyber.Scalar, ret *[msmNumWindows]byte) {
+	v := new(big.Int).Set(&s.(*mod.Int).V)
+	if v.Sign() < 0 || v.BitLen() > 256 {
+		v.Mod(v, bn256.Order)
+	}
+	var be [msmNumWindows]byte
+	v.FillBytes(be[:])
+	for k := range ret {
+		ret[k] = be[msmNumWindows-1-k]
+	}
+}
@@ -0,0 +1,452 @@
+package trie_kzg_bn256
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/iotaledger/trie.go/trie"
+	"go.dedis.ch/kyber/v3"
+	"golang.org/x/xerrors"
+)
+
+// MultiProof is the proof of inclusion of many keys at once (the verkle-style multipoint opening).
+// Each node on the paths of the keys is included once, as its commitment. All openings 'the vector committed with C
+// has the value y at the index z' along all paths are aggregated by the random challenge into one polynomial,
+// which is opened at another challenge point. The opening takes two points regardless of the number of keys,
+// so the proof is much smaller than the proofs of inclusion of the same keys, which contain an opening per node.
+// Path fragments of nodes are opened too, so each key is bound to its path: the key must be the concatenation of
+// path fragments and vector indices along the path
+type MultiProof struct {
+	// keys of the proof
+	Keys [][]byte
+	// commitments to the terminal values of keys
+	Terminals []kyber.Scalar
+	// distinct commitments to vectors (nodes) along paths of keys
+	Commitments []kyber.Point
+	// path fragments of nodes, in the order of Commitments
+	Fragments [][]byte
+	// paths of keys, from the root
+	Paths [][]MultiProofElement
+	// commitment to the aggregated quotient polynomial
+	D kyber.Point
+	// proof of the opening of the aggregated polynomial at the challenge point
+	Pi kyber.Point
+}
+
+// MultiProofElement is the node on the path of the key
+type MultiProofElement struct {
+	// index of the commitment to the vector in MultiProof.Commitments
+	Commitment uint16
+	// index of the vector element, as in ProofElement. 256 means terminal, valid only in the last element of the path.
+	// Path fragment of the node (index 257) is opened implicitly
+	VectorIndex uint16
+}
+
+// opening is the statement that the vector committed with c has the value y at the index
+type opening struct {
+	c kyber.Point
+	// ci is the index of c in MultiProof.Commitments
+	ci    uint16
+	index int
+	y     kyber.Scalar
+	// vect is the committed vector. Known only to the prover
+	vect []kyber.Scalar
+}
+
+func MultiProofFromBytes(data []byte) (*MultiProof, error) {
+	ret := &MultiProof{}
+	rdr := bytes.NewReader(data)
+	if err := ret.Read(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, trie.ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+// MultiProof builds the aggregated proof of inclusion of keys.
+// Returns nil, false if any of keys is not present in the trie
+func (m *CommitmentModel) MultiProof(keys [][]byte, tr trie.NodeStore) (*MultiProof, bool) {
+	trie.Assert(tr.PathArity() == trie.PathArity256, "for KZG commitment model only 256-ary trie is supported")
+
+	ret := &MultiProof{
+		Keys:      make([][]byte, len(keys)),
+		Terminals: make([]kyber.Scalar, len(keys)),
+		Paths:     make([][]MultiProofElement, len(keys)),
+	}
+	// vectors of nodes, in the order of commitments
+	vectors := make([][]kyber.Scalar, 0)
+	nodeIndex := make(map[string]uint16)
+	for i, key := range keys {
+		proofGeneric := trie.GetProofGeneric(tr, key)
+		if proofGeneric == nil || len(proofGeneric.Path) == 0 || proofGeneric.Ending != trie.EndingTerminal {
+			// key is not present in the state
+			return nil, false
+		}
+		proofLength := len(proofGeneric.Path)
+		path := make([]MultiProofElement, proofLength)
+		for j, n := range proofGeneric.Nodes {
+			idx, ok := nodeIndex[string(proofGeneric.Path[j])]
+			if !ok {
+				trie.Assert(len(ret.Commitments) < math.MaxUint16, "MultiProof: too many nodes in the proof")
+				var vect [258]kyber.Scalar
+				makeVector(&trie.NodeData{
+					PathFragment:     n.PathFragment(),
+					ChildCommitments: n.ChildCommitments(),
+					Terminal:         n.Terminal(),
+				}, &m.TrustedSetup, &vect)
+				idx = uint16(len(ret.Commitments))
+				ret.Commitments = append(ret.Commitments, m.TrustedSetup.commit(vect[:]))
+				ret.Fragments = append(ret.Fragments, n.PathFragment())
+				vectors = append(vectors, vect[:])
+				nodeIndex[string(proofGeneric.Path[j])] = idx
+			}
+			path[j].Commitment = idx
+			if j == proofLength-1 {
+				path[j].VectorIndex = 256
+			} else {
+				nextKey := proofGeneric.Path[j+1]
+				path[j].VectorIndex = uint16(nextKey[len(nextKey)-1])
+			}
+		}
+		ret.Keys[i] = proofGeneric.Key
+		ret.Paths[i] = path
+		ret.Terminals[i] = m.Suite.G1().Scalar().Set(vectors[path[proofLength-1].Commitment][256])
+	}
+	openings, err := ret.openings()
+	trie.Assert(err == nil, "MultiProof: %v", err)
+	for _, o := range openings {
+		o.vect = vectors[o.ci]
+	}
+	ret.D, ret.Pi = m.TrustedSetup.proveMulti(openings)
+	return ret, true
+}
+
+// Validate checks the proof against the provided root commitment.
+// If values are specified, checks if commitments to values are terminals of respective keys.
+// Empty value is checked against the commitment to the empty value (see trie.Options.AllowEmptyValues)
+func (p *MultiProof) Validate(root trie.VCommitment, values ...[]byte) error {
+	if len(values) > 0 && len(values) != len(p.Keys) {
+		return xerrors.New("number of values not equal to the number of keys")
+	}
+	for i, value := range values {
+		var ct trie.TCommitment
+		if len(value) == 0 {
+			ct = commitToEmptyValue(Model.Suite)
+		} else {
+			ct = commitToData(value, Model.Suite)
+		}
+		if !equalCommitments(ct, &terminalCommitment{Scalar: p.Terminals[i]}) {
+			return xerrors.New(fmt.Sprintf("terminal commitment not equal to the provided value of the key #%d", i))
+		}
+	}
+	openings, err := p.openings()
+	if err != nil {
+		return err
+	}
+	for i, path := range p.Paths {
+		if !equalCommitments(root, &vectorCommitment{Point: p.Commitments[path[0].Commitment]}) {
+			return xerrors.New(fmt.Sprintf("provided commitment and commitment to the first element of the path #%d are not equal", i))
+		}
+	}
+	if len(openings) == 0 {
+		return nil
+	}
+	if p.D == nil || p.Pi == nil || !Model.verifyMulti(openings, p.D, p.Pi) {
+		return xerrors.New("multiproof is invalid")
+	}
+	return nil
+}
+
+// openings checks the structure of the proof and returns distinct statements proven by it,
+// in the order of their appearance along paths. Each key is checked against path fragments and vector indices
+// along its path, path fragments are opened at the index 257 of vectors
+func (p *MultiProof) openings() ([]*opening, error) {
+	if len(p.Terminals) != len(p.Keys) || len(p.Paths) != len(p.Keys) {
+		return nil, xerrors.New("wrong number of terminals or paths")
+	}
+	if len(p.Fragments) != len(p.Commitments) {
+		return nil, xerrors.New("wrong number of path fragments")
+	}
+	ret := make([]*opening, 0)
+	seen := make(map[[2]uint16]*opening)
+	// add returns false if the same element of the vector was already opened with another value
+	add := func(ci uint16, index uint16, y kyber.Scalar) bool {
+		k := [2]uint16{ci, index}
+		if o, ok := seen[k]; ok {
+			return o.y.Equal(y)
+		}
+		o := &opening{
+			c:     p.Commitments[ci],
+			ci:    ci,
+			index: int(index),
+			y:     y,
+		}
+		seen[k] = o
+		ret = append(ret, o)
+		return true
+	}
+	for i, path := range p.Paths {
+		if len(path) == 0 {
+			return nil, xerrors.New(fmt.Sprintf("path #%d is empty", i))
+		}
+		key := p.Keys[i]
+		pos := 0
+		for j, e := range path {
+			last := j == len(path)-1
+			if int(e.Commitment) >= len(p.Commitments) {
+				return nil, xerrors.New(fmt.Sprintf("wrong commitment index at path #%d position %d", i, j))
+			}
+			if e.VectorIndex > 256 || (e.VectorIndex == 256) != last {
+				return nil, xerrors.New(fmt.Sprintf("wrong vector index at path #%d position %d", i, j))
+			}
+			fragment := p.Fragments[e.Commitment]
+			if !bytes.HasPrefix(key[pos:], fragment) {
+				return nil, xerrors.New(fmt.Sprintf("key #%d does not match the path fragment at position %d", i, j))
+			}
+			pos += len(fragment)
+			var y kyber.Scalar
+			if last {
+				if pos != len(key) {
+					return nil, xerrors.New(fmt.Sprintf("key #%d is longer than its path", i))
+				}
+				y = p.Terminals[i]
+			} else {
+				if pos >= len(key) || key[pos] != byte(e.VectorIndex) {
+					return nil, xerrors.New(fmt.Sprintf("key #%d does not match the vector index at position %d", i, j))
+				}
+				pos++
+				next := path[j+1].Commitment
+				if int(next) >= len(p.Commitments) {
+					return nil, xerrors.New(fmt.Sprintf("wrong commitment index at path #%d position %d", i, j+1))
+				}
+				y = scalarFromPoint(Model.Suite.G1().Scalar(), p.Commitments[next])
+			}
+			if !add(e.Commitment, e.VectorIndex, y) {
+				return nil, xerrors.New(fmt.Sprintf("inconsistent value at path #%d position %d", i, j))
+			}
+			if !add(e.Commitment, 257, scalarFromPathFragment(Model.Suite.G1().Scalar(), fragment)) {
+				return nil, xerrors.New(fmt.Sprintf("inconsistent path fragment at path #%d position %d", i, j))
+			}
+		}
+	}
+	return ret, nil
+}
+
+// challengeR returns the Fiat-Shamir challenge which aggregates openings
+func (sd *TrustedSetup) challengeR(openings []*opening) kyber.Scalar {
+	var buf bytes.Buffer
+	for _, o := range openings {
+		_, _ = o.c.MarshalTo(&buf)
+		_ = trie.WriteUint16(&buf, uint16(o.index))
+		_, _ = o.y.MarshalTo(&buf)
+	}
+	return scalarFromBytes(sd.Suite.G1().Scalar(), buf.Bytes())
+}
+
+// challengeT returns the Fiat-Shamir challenge, the point where the aggregated polynomial is opened
+func (sd *TrustedSetup) challengeT(r kyber.Scalar, d kyber.Point) kyber.Scalar {
+	var buf bytes.Buffer
+	_, _ = r.MarshalTo(&buf)
+	_, _ = d.MarshalTo(&buf)
+	return scalarFromBytes(sd.Suite.G1().Scalar(), buf.Bytes())
+}
+
+// proveMulti returns the multipoint opening proof (D, pi) of openings.
+// g(X) = sum r^i * (f_i(X) - y_i)/(X - z_i), D = [g(s)]1
+// h(X) = sum r^i * f_i(X)/(t - z_i), y = h(t) - g(t) = sum r^i * y_i/(t - z_i)
+// pi = [(h(X) - g(X) - y)/(X - t)]1 at s
+func (sd *TrustedSetup) proveMulti(openings []*opening) (kyber.Point, kyber.Point) {
+	r := sd.challengeR(openings)
+	g := sd.zeroVector()
+	q := sd.Suite.G1().Scalar()
+	ri := sd.Suite.G1().Scalar().One()
+	for _, o := range openings {
+		for m := range g {
+			sd.qPoly(o.vect, o.index, m, o.y, q)
+			q.Mul(q, ri)
+			g[m].Add(g[m], q)
+		}
+		ri.Mul(ri, r)
+	}
+	d := sd.commit(g)
+	t := sd.challengeT(r, d)
+
+	h := sd.zeroVector()
+	y := sd.Suite.G1().Scalar().Zero()
+	coef := sd.Suite.G1().Scalar()
+	ri.One()
+	for _, o := range openings {
+		coef.Sub(t, sd.Domain[o.index])
+		trie.Assert(!coef.Equal(sd.ZeroG1), "proveMulti: challenge is in the domain")
+		coef.Inv(coef)
+		coef.Mul(coef, ri)
+		for m, v := range o.vect {
+			if v != nil {
+				h[m].Add(h[m], q.Mul(coef, v))
+			}
+		}
+		y.Add(y, q.Mul(coef, o.y))
+		ri.Mul(ri, r)
+	}
+	for m := range h {
+		h[m].Sub(h[m], g[m])
+		h[m].Sub(h[m], y)
+		coef.Sub(sd.Domain[m], t)
+		coef.Inv(coef)
+		h[m].Mul(h[m], coef)
+	}
+	return d, sd.commit(h)
+}
+
+// verifyMulti verifies the multipoint opening proof of openings.
+// With E = sum r^i/(t - z_i) * C_i, checks e(E - D - [y]1, [1]2) == e(pi, [s - t]2)
+func (sd *TrustedSetup) verifyMulti(openings []*opening, d, pi kyber.Point) bool {
+	r := sd.challengeR(openings)
+	t := sd.challengeT(r, d)
+
+	e := sd.Suite.G1().Point().Null()
+	p := sd.Suite.G1().Point()
+	y := sd.Suite.G1().Scalar().Zero()
+	coef := sd.Suite.G1().Scalar()
+	tmp := sd.Suite.G1().Scalar()
+	ri := sd.Suite.G1().Scalar().One()
+	for _, o := range openings {
+		coef.Sub(t, sd.Domain[o.index])
+		if coef.Equal(sd.ZeroG1) {
+			return false
+		}
+		coef.Inv(coef)
+		coef.Mul(coef, ri)
+		e.Add(e, p.Mul(coef, o.c))
+		y.Add(y, tmp.Mul(coef, o.y))
+		ri.Mul(ri, r)
+	}
+	e.Sub(e, d)
+	e.Sub(e, p.Mul(y, nil))
+	// [s - t]2 = [s - domain_0]2 + [domain_0 - t]2
+	st := sd.Suite.G2().Point().Mul(tmp.Sub(sd.Domain[0], t), nil)
+	st.Add(st, sd.Diff2[0])
+	return sd.Suite.Pair(e, sd.Suite.G2().Point().Base()).Equal(sd.Suite.Pair(pi, st))
+}
+
+func (sd *TrustedSetup) zeroVector() []kyber.Scalar {
+	ret := make([]kyber.Scalar, sd.D)
+	for i := range ret {
+		ret[i] = sd.Suite.G1().Scalar().Zero()
+	}
+	return ret
+}
+
+func (p *MultiProof) Bytes() []byte {
+	return trie.MustBytes(p)
+}
+
+func (p *MultiProof) Write(w io.Writer) error {
+	if err := trie.WriteUint16(w, uint16(len(p.Keys))); err != nil {
+		return err
+	}
+	for i := range p.Keys {
+		if err := trie.WriteBytes16(w, p.Keys[i]); err != nil {
+			return err
+		}
+		if _, err := p.Terminals[i].MarshalTo(w); err != nil {
+			return err
+		}
+		if err := trie.WriteUint16(w, uint16(len(p.Paths[i]))); err != nil {
+			return err
+		}
+		for _, e := range p.Paths[i] {
+			if err := trie.WriteUint16(w, e.Commitment); err != nil {
+				return err
+			}
+			if err := trie.WriteUint16(w, e.VectorIndex); err != nil {
+				return err
+			}
+		}
+	}
+	if err := trie.WriteUint16(w, uint16(len(p.Commitments))); err != nil {
+		return err
+	}
+	for i, c := range p.Commitments {
+		if _, err := c.MarshalTo(w); err != nil {
+			return err
+		}
+		if err := trie.WriteBytes16(w, p.Fragments[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := p.D.MarshalTo(w); err != nil {
+		return err
+	}
+	if _, err := p.Pi.MarshalTo(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *MultiProof) Read(r io.Reader) error {
+	var err error
+	var size uint16
+	if err = trie.ReadUint16(r, &size); err != nil {
+		return err
+	}
+	p.Keys = make([][]byte, size)
+	p.Terminals = make([]kyber.Scalar, size)
+	p.Paths = make([][]MultiProofElement, size)
+	for i := range p.Keys {
+		if p.Keys[i], err = trie.ReadBytes16(r); err != nil {
+			return err
+		}
+		p.Terminals[i] = Model.Suite.G1().Scalar()
+		if _, err = p.Terminals[i].UnmarshalFrom(r); err != nil {
+			return err
+		}
+		if err = trie.ReadUint16(r, &size); err != nil {
+			return err
+		}
+		p.Paths[i] = make([]MultiProofElement, size)
+		for j := range p.Paths[i] {
+			if err = trie.ReadUint16(r, &p.Paths[i][j].Commitment); err != nil {
+				return err
+			}
+			if err = trie.ReadUint16(r, &p.Paths[i][j].VectorIndex); err != nil {
+				return err
+			}
+		}
+	}
+	if err = trie.ReadUint16(r, &size); err != nil {
+		return err
+	}
+	p.Commitments = make([]kyber.Point, size)
+	p.Fragments = make([][]byte, size)
+	for i := range p.Commitments {
+		p.Commitments[i] = Model.Suite.G1().Point()
+		if _, err = p.Commitments[i].UnmarshalFrom(r); err != nil {
+			return err
+		}
+		if p.Fragments[i], err = trie.ReadBytes16(r); err != nil {
+			return err
+		}
+	}
+	p.D = Model.Suite.G1().Point()
+	if _, err = p.D.UnmarshalFrom(r); err != nil {
+		return err
+	}
+	p.Pi = Model.Suite.G1().Point()
+	if _, err = p.Pi.UnmarshalFrom(r); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *MultiProof) String() string {
+	ret := fmt.Sprintf("KZG MULTIPROOF: %d keys, %d nodes\n", len(p.Keys), len(p.Commitments))
+	for i, key := range p.Keys {
+		ret += fmt.Sprintf("key: %s, term: %s, path: %v\n", string(key), p.Terminals[i], p.Paths[i])
+	}
+	return ret
+}
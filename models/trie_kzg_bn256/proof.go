@@ -70,10 +70,7 @@ func (m *CommitmentModel) ProofOfInclusion(key []byte, tr trie.NodeStore) (*Proo
 	proofLength := len(proofGeneric.Path)
 	nodes := make([]*trie.NodeData, proofLength)
 
-	for i, k := range proofGeneric.Path {
-		n, ok := tr.GetNode(k)
-		trie.Assert(ok, "can't find node with key '%x'", k)
-
+	for i, n := range proofGeneric.Nodes {
 		nodes[i] = &trie.NodeData{
 			PathFragment:     n.PathFragment(),
 			ChildCommitments: n.ChildCommitments(),
@@ -116,10 +113,16 @@ func (p *ProofOfInclusion) Bytes() []byte {
 }
 
 // Validate check the proof against the provided root commitments
-// if 'value' is specified, checks if commitment to that value is the terminal of the last element in path
+// if 'value' is specified, checks if commitment to that value is the terminal of the last element in path.
+// Empty value is checked against the commitment to the empty value (see trie.Options.AllowEmptyValues)
 func (p *ProofOfInclusion) Validate(root trie.VCommitment, value ...[]byte) error {
 	if len(value) > 0 {
-		ct := commitToData(value[0], Model.Suite)
+		var ct trie.TCommitment
+		if len(value[0]) == 0 {
+			ct = commitToEmptyValue(Model.Suite)
+		} else {
+			ct = commitToData(value[0], Model.Suite)
+		}
 		if !equalCommitments(ct, &terminalCommitment{Scalar: p.Terminal}) {
 			return xerrors.New("terminal commitment not equal to the provided value")
 		}
@@ -133,6 +136,10 @@ func (p *ProofOfInclusion) Validate(root trie.VCommitment, value ...[]byte) erro
 	var val kyber.Scalar
 
 	for i := range p.Path {
+		last := i == len(p.Path)-1
+		if p.Path[i].VectorIndex > 256 || (p.Path[i].VectorIndex == 256) != last {
+			return xerrors.New(fmt.Sprintf("wrong vector index at path position %d", i))
+		}
 		if p.Path[i].VectorIndex < 256 {
 			val = scalarFromPoint(Model.Suite.G1().Scalar(), p.Path[i+1].C)
 		} else {
@@ -211,6 +218,9 @@ func (e *ProofElement) Read(r io.Reader) error {
 	if _, err := e.Proof.UnmarshalFrom(r); err != nil {
 		return err
 	}
+	if e.VectorIndex > 256 {
+		return xerrors.New("wrong vector index")
+	}
 	return nil
 }
 
@@ -31,6 +31,7 @@ type TrustedSetup struct {
 	Domain        []kyber.Scalar // non-persistent. if omega != 0, domain_i =  omega^i, otherwise domain_i = i.
 	AprimeDomainI []kyber.Scalar // A'(i)
 	precalc       *precalculated // only not nil if omega == nil (onl for natural domain)
+	msm           *msmTable      // non-persistent. Precomputed multiples of the Lagrange basis for commitments
 	ZeroG1        kyber.Scalar   // aux
 	OneG1         kyber.Scalar   // aux
 }
@@ -70,6 +71,7 @@ func (sd *TrustedSetup) init(d uint16) {
 		sd.LagrangeBasis[i] = sd.Suite.G1().Point()
 		sd.Diff2[i] = sd.Suite.G2().Point()
 	}
+	sd.msm = newMsmTable(sd.Suite, sd.LagrangeBasis)
 	sd.ZeroG1 = sd.Suite.G1().Scalar().Zero()
 	sd.OneG1 = sd.Suite.G1().Scalar().One()
 }
@@ -275,7 +277,7 @@ func (sd *TrustedSetup) write(w io.Writer) error {
 // read unmarshal
 func (sd *TrustedSetup) read(r io.Reader) error {
 	var tmp2 [2]byte
-	if _, err := r.Read(tmp2[:]); err != nil {
+	if _, err := io.ReadFull(r, tmp2[:]); err != nil {
 		return err
 	}
 
@@ -239,3 +239,51 @@ func TestStaticTrustedSetup(t *testing.T) {
 	tr.Update(nil, []byte("kuku"))
 	tr.Commit()
 }
+
+func naiveCommit(ts *TrustedSetup, vect []kyber.Scalar) kyber.Point {
+	ret := ts.Suite.G1().Point().Null()
+	elem := ts.Suite.G1().Point()
+	for i, e := range vect {
+		if e == nil {
+			continue
+		}
+		elem.Mul(e, ts.LagrangeBasis[i])
+		ret.Add(ret, elem)
+	}
+	return ret
+}
+
+func TestMultiExp(t *testing.T) {
+	model := New()
+	rnd := random.New()
+	for _, n := range []int{0, 1, 2, 3, 10, 100, 258} {
+		vect := make([]kyber.Scalar, 258)
+		for _, i := range rand.Perm(258)[:n] {
+			vect[i] = model.Suite.G1().Scalar().Pick(rnd)
+		}
+		if n > 1 {
+			vect[0] = model.Suite.G1().Scalar().One().Neg(model.Suite.G1().Scalar().One())
+		}
+		require.True(t, naiveCommit(&model.TrustedSetup, vect).Equal(model.commit(vect)))
+	}
+}
+
+func BenchmarkCommit(b *testing.B) {
+	model := New()
+	rnd := random.New()
+	vect := make([]kyber.Scalar, 258)
+	for i := range vect {
+		vect[i] = model.Suite.G1().Scalar().Pick(rnd)
+	}
+	model.commit(vect)
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			naiveCommit(&model.TrustedSetup, vect)
+		}
+	})
+	b.Run("msm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			model.commit(vect)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+// Package trie_vectors generates test vectors of proofs of all commitment models: fixed keys and values are committed
+// to the trie and proven. The vectors pin exact bytes of roots and proofs, so implementations in other languages
+// can check the byte-level compatibility with this implementation
+package trie_vectors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// GoldenVector is the serialized proof of one key. Value is nil for the proof of absence
+type GoldenVector struct {
+	Key   []byte
+	Value []byte
+	Proof []byte
+}
+
+// GoldenSet are golden vectors of one commitment model. All proofs are proofs against the root
+type GoldenSet struct {
+	// Model is the short name of the commitment model (see trie.CommitmentModel.ShortName)
+	Model   string
+	Root    []byte
+	Vectors []GoldenVector
+}
+
+// ErrWrongGoldenFormat is returned when the golden set can't be parsed
+var ErrWrongGoldenFormat = errors.New("trie_vectors: wrong format of golden vectors")
+
+// goldenData are fixed key/value pairs of golden vectors. They cover keys which are prefixes of other keys,
+// bytes which are not characters, short values committed in the terminal and long values committed by hash
+var goldenData = [][2]string{
+	{"a", "a"},
+	{"ab", "ab$"},
+	{"abc", "abc$"},
+	{"abcd", "abcd$"},
+	{"b", "b"},
+	{"bcd", strings.Repeat("long value ", 20)},
+	{"klmn", "klmn$"},
+	{"oprst", "oprst$"},
+	{"\x00\x01\xff", "binary key"},
+	{strings.Repeat("k", 100), "long key"},
+}
+
+// goldenAbsentKeys are fixed keys which are not in the trie of golden vectors
+var goldenAbsentKeys = []string{"abd", "abcde", "c", "klm", "\x00\x02"}
+
+// GoldenModels returns commitment models of golden vectors: blake2b models of all path arities and hash sizes,
+// and the KZG model
+func GoldenModels() []trie.CommitmentModel {
+	ret := make([]trie.CommitmentModel, 0)
+	for _, hashSize := range []trie_blake2b.HashSize{
+		trie_blake2b.HashSize128, trie_blake2b.HashSize160, trie_blake2b.HashSize192, trie_blake2b.HashSize256,
+	} {
+		for _, arity := range trie.AllPathArity {
+			ret = append(ret, trie_blake2b.New(arity, hashSize))
+		}
+	}
+	return append(ret, trie_kzg_bn256.Model)
+}
+
+// GenerateGoldenSet commits fixed key/value pairs to the trie of the model and proves them, together with
+// some absent keys. The KZG model only proves inclusion, so its set has no proofs of absence
+func GenerateGoldenSet(m trie.CommitmentModel) (*GoldenSet, error) {
+	tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+	for _, kv := range goldenData {
+		tr.UpdateStr(kv[0], kv[1])
+	}
+	tr.Commit()
+	ret := &GoldenSet{
+		Model:   m.ShortName(),
+		Root:    trie.RootCommitment(tr).Bytes(),
+		Vectors: make([]GoldenVector, 0, len(goldenData)+len(goldenAbsentKeys)),
+	}
+	keys := make([]string, 0, len(goldenData)+len(goldenAbsentKeys))
+	for _, kv := range goldenData {
+		keys = append(keys, kv[0])
+	}
+	keys = append(keys, goldenAbsentKeys...)
+	for _, k := range keys {
+		key := []byte(k)
+		var proof []byte
+		switch m := m.(type) {
+		case *trie_blake2b.CommitmentModel:
+			proof = m.Proof(key, tr).Bytes()
+		case *trie_kzg_bn256.CommitmentModel:
+			p, ok := m.ProofOfInclusion(key, tr)
+			if !ok {
+				continue
+			}
+			proof = p.Bytes()
+		default:
+			return nil, fmt.Errorf("trie_vectors::GenerateGoldenSet: unsupported model %s", m.ShortName())
+		}
+		ret.Vectors = append(ret.Vectors, GoldenVector{Key: key, Value: valueOf(k), Proof: proof})
+	}
+	return ret, nil
+}
+
+// valueOf returns the golden value of the key or nil if the key is absent
+func valueOf(key string) []byte {
+	for _, kv := range goldenData {
+		if kv[0] == key {
+			return []byte(kv[1])
+		}
+	}
+	return nil
+}
+
+// Write writes the golden set in the text format: the line 'model <short name>', the line 'root <hex>'
+// and lines 'present <key hex> <value hex> <proof hex>' or 'absent <key hex> <proof hex>' for each vector
+func (s *GoldenSet) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "model %s\nroot %x\n", s.Model, s.Root); err != nil {
+		return err
+	}
+	for _, v := range s.Vectors {
+		var err error
+		if v.Value == nil {
+			_, err = fmt.Fprintf(w, "absent %x %x\n", v.Key, v.Proof)
+		} else {
+			_, err = fmt.Fprintf(w, "present %x %x %x\n", v.Key, v.Value, v.Proof)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read reads the golden set in the format of Write
+func (s *GoldenSet) Read(r io.Reader) error {
+	*s = GoldenSet{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch {
+		case fields[0] == "model" && len(fields) == 2 && line == 1:
+			s.Model = fields[1]
+		case fields[0] == "root" && len(fields) == 2 && line == 2:
+			s.Root, err = hex.DecodeString(fields[1])
+		case fields[0] == "present" && len(fields) == 4 && line > 2:
+			var v GoldenVector
+			if v.Key, err = hex.DecodeString(fields[1]); err == nil {
+				if v.Value, err = hex.DecodeString(fields[2]); err == nil {
+					v.Proof, err = hex.DecodeString(fields[3])
+				}
+			}
+			s.Vectors = append(s.Vectors, v)
+		case fields[0] == "absent" && len(fields) == 3 && line > 2:
+			var v GoldenVector
+			if v.Key, err = hex.DecodeString(fields[1]); err == nil {
+				v.Proof, err = hex.DecodeString(fields[2])
+			}
+			s.Vectors = append(s.Vectors, v)
+		default:
+			err = ErrWrongGoldenFormat
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if s.Model == "" || len(s.Root) == 0 {
+		return ErrWrongGoldenFormat
+	}
+	return nil
+}
+
+// Bytes returns the golden set in the text format of Write
+func (s *GoldenSet) Bytes() []byte {
+	var buf bytes.Buffer
+	_ = s.Write(&buf)
+	return buf.Bytes()
+}
+
+// GoldenFileName is the name of the file of golden vectors of the model
+func GoldenFileName(model string) string {
+	return strings.NewReplacer("(", "", ")", "").Replace(model) + ".golden"
+}
+
+// ReadGoldenFile reads golden vectors of the model from the directory
+func ReadGoldenFile(dir, model string) (*GoldenSet, error) {
+	data, err := os.ReadFile(filepath.Join(dir, GoldenFileName(model)))
+	if err != nil {
+		return nil, err
+	}
+	ret := &GoldenSet{}
+	if err = ret.Read(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("trie_vectors::ReadGoldenFile: %w", err)
+	}
+	return ret, nil
+}
+
+// WriteGoldenFiles regenerates golden vectors of all models of GoldenModels into files of the directory.
+// Golden vectors must only be regenerated after the intended change of the serialization of commitments or proofs
+func WriteGoldenFiles(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, m := range GoldenModels() {
+		set, err := GenerateGoldenSet(m)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, GoldenFileName(set.Model)), set.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package trie_vectors
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iotaledger/trie.go/models/trie_verify"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// SuiteVersion is the version of the format of the verification suite
+const SuiteVersion = 1
+
+// Expected results of verification vectors
+const (
+	ExpectPresent = "present"
+	ExpectAbsent  = "absent"
+	ExpectInvalid = "invalid"
+)
+
+// VerificationVector is one case of the verification suite. Byte fields are hex encoded. Value is null if the value
+// is not checked against the terminal commitment, otherwise the verifier must check it.
+// Expected is ExpectPresent or ExpectAbsent if the proof is valid, ExpectInvalid if the verifier must reject it
+type VerificationVector struct {
+	Description string  `json:"description"`
+	Model       string  `json:"model"`
+	Root        string  `json:"root"`
+	Key         string  `json:"key"`
+	Value       *string `json:"value"`
+	Proof       string  `json:"proof"`
+	Expected    string  `json:"expected"`
+}
+
+// VerificationSuite is the machine-readable suite of verification vectors for implementations of verifiers
+// in other languages. Models are identified by short names (see trie.CommitmentModel.ShortName)
+type VerificationSuite struct {
+	Version int                  `json:"version"`
+	Vectors []VerificationVector `json:"vectors"`
+}
+
+// GenerateVerificationSuite generates the verification suite from golden sets of models. Nil models mean GoldenModels.
+// Besides valid proofs of golden vectors, each model has invalid cases: the wrong value, the proof of another key,
+// the wrong root and the truncated proof.
+// Expected result of each vector is confirmed with trie_verify.VerifyInclusion
+func GenerateVerificationSuite(models ...trie.CommitmentModel) (*VerificationSuite, error) {
+	if len(models) == 0 {
+		models = GoldenModels()
+	}
+	ret := &VerificationSuite{Version: SuiteVersion, Vectors: make([]VerificationVector, 0)}
+	for _, m := range models {
+		set, err := GenerateGoldenSet(m)
+		if err != nil {
+			return nil, err
+		}
+		vectors, err := verificationVectors(set)
+		if err != nil {
+			return nil, fmt.Errorf("trie_vectors::GenerateVerificationSuite: model %s: %w", set.Model, err)
+		}
+		ret.Vectors = append(ret.Vectors, vectors...)
+	}
+	return ret, nil
+}
+
+func verificationVectors(set *GoldenSet) ([]VerificationVector, error) {
+	ret := make([]VerificationVector, 0, len(set.Vectors)+4)
+	add := func(description string, root, key, value, proof []byte, expected string) {
+		v := VerificationVector{
+			Description: description,
+			Model:       set.Model,
+			Root:        hex.EncodeToString(root),
+			Key:         hex.EncodeToString(key),
+			Proof:       hex.EncodeToString(proof),
+			Expected:    expected,
+		}
+		if value != nil {
+			s := hex.EncodeToString(value)
+			v.Value = &s
+		}
+		ret = append(ret, v)
+	}
+	var present, other *GoldenVector
+	for i := range set.Vectors {
+		v := &set.Vectors[i]
+		if v.Value == nil {
+			add("proof of absence", set.Root, v.Key, nil, v.Proof, ExpectAbsent)
+			continue
+		}
+		add("proof of inclusion with the value", set.Root, v.Key, v.Value, v.Proof, ExpectPresent)
+		switch {
+		case present == nil:
+			present = v
+		case other == nil:
+			other = v
+		}
+	}
+	if present == nil || other == nil {
+		return nil, errors.New("not enough present keys")
+	}
+	add("proof of inclusion without the value", set.Root, present.Key, nil, present.Proof, ExpectPresent)
+	add("wrong value", set.Root, present.Key, []byte("wrong value"), present.Proof, ExpectInvalid)
+	add("proof of another key", set.Root, other.Key, nil, present.Proof, ExpectInvalid)
+	wrongRoot := make([]byte, len(set.Root))
+	copy(wrongRoot, set.Root)
+	wrongRoot[len(wrongRoot)-1] ^= 0x01
+	add("wrong root", wrongRoot, present.Key, nil, present.Proof, ExpectInvalid)
+	add("truncated proof", set.Root, present.Key, nil, present.Proof[:len(present.Proof)-1], ExpectInvalid)
+
+	for i := range ret {
+		if err := ret[i].Check(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Check verifies the vector with trie_verify.VerifyInclusion and returns error if the result is not the expected one
+func (v *VerificationVector) Check() error {
+	var root, key, value, proof []byte
+	var err error
+	if root, err = hex.DecodeString(v.Root); err != nil {
+		return err
+	}
+	if key, err = hex.DecodeString(v.Key); err != nil {
+		return err
+	}
+	if v.Value != nil {
+		if value, err = hex.DecodeString(*v.Value); err != nil {
+			return err
+		}
+	}
+	if proof, err = hex.DecodeString(v.Proof); err != nil {
+		return err
+	}
+	res, err := trie_verify.VerifyInclusion(root, v.Model, key, value, proof)
+	var result string
+	switch {
+	case err != nil:
+		result = ExpectInvalid
+	case res.Status == trie_verify.Present:
+		result = ExpectPresent
+	default:
+		result = ExpectAbsent
+	}
+	if result != v.Expected {
+		return fmt.Errorf("vector '%s' of key %s: expected %s, verified %s (%v)", v.Description, v.Key, v.Expected, result, err)
+	}
+	return nil
+}
+
+// WriteJSON writes the suite as indented JSON
+func (s *VerificationSuite) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// ReadJSON reads the suite in JSON
+func (s *VerificationSuite) ReadJSON(r io.Reader) error {
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return err
+	}
+	if s.Version != SuiteVersion {
+		return fmt.Errorf("trie_vectors: unsupported version of the verification suite %d", s.Version)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package trie_verify verifies serialized proofs of any commitment model. It is intended for callers which only
+// handle serialized artifacts: the root commitment, the short name of the commitment model, the key, the value
+// and the proof bytes. The proof is parsed and dispatched to the verifier of the model
+package trie_verify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// Status is the status of the key proven by the proof
+type Status int
+
+const (
+	// Absent means the proof is the valid proof of absence of the key
+	Absent = Status(iota)
+	// Present means the proof is the valid proof of inclusion of the key
+	Present
+)
+
+func (s Status) String() string {
+	switch s {
+	case Absent:
+		return "absent"
+	case Present:
+		return "present"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Result is the result of the successful verification
+type Result struct {
+	Status Status
+	// Model is the short name of the commitment model of the proof
+	Model string
+	// Key is the key of the proof in original bytes
+	Key []byte
+	// Terminal is the serialized terminal commitment of the present key. Nil if the key is absent
+	Terminal []byte
+	// ValueChecked is true if the value has been checked against the terminal commitment
+	ValueChecked bool
+	// PathLength is the number of elements of the proof path
+	PathLength int
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("key '%x' is %s in the state of the model '%s', value checked: %v, path length: %d",
+		r.Key, r.Status, r.Model, r.ValueChecked, r.PathLength)
+}
+
+// ErrUnsupportedModel is returned for the model without the verifier of serialized proofs
+var ErrUnsupportedModel = errors.New("unsupported commitment model")
+
+// VerifyInclusion verifies the serialized proof of the key against the serialized root commitment.
+// The model descriptor is the short name of the commitment model (see trie.CommitmentModel.ShortName), for example
+// 'b2b_256_20' or 'kzg'. Proofs of blake2b models carry parameters of the model, which must match the descriptor.
+// KZG proofs are verified with the default trusted setup and only prove inclusion.
+// If the value is not nil, it is checked against the terminal commitment of the present key. Empty non-nil value
+// is the empty value (see trie.Options.AllowEmptyValues). The error is returned if the proof is malformed or invalid,
+// if it is the proof of another key or if the present key does not commit to the value.
+// The valid proof of absence is the result with the status Absent, not an error
+func VerifyInclusion(rootBytes []byte, modelDescriptor string, key, value, proofBytes []byte) (*Result, error) {
+	var ret *Result
+	var err error
+	switch {
+	case strings.HasPrefix(modelDescriptor, "b2b_"):
+		ret, err = verifyBlake2b(rootBytes, modelDescriptor, key, value, proofBytes)
+	case modelDescriptor == trie_kzg_bn256.Model.ShortName():
+		ret, err = verifyKZG(rootBytes, key, value, proofBytes)
+	default:
+		err = ErrUnsupportedModel
+	}
+	if err != nil {
+		return nil, fmt.Errorf("trie_verify::VerifyInclusion: model '%s': %w", modelDescriptor, err)
+	}
+	return ret, nil
+}
+
+func verifyBlake2b(rootBytes []byte, modelDescriptor string, key, value, proofBytes []byte) (*Result, error) {
+	p, err := trie_blake2b.ProofFromBytes(proofBytes)
+	if err != nil {
+		return nil, err
+	}
+	if p.ShortName() != modelDescriptor {
+		return nil, fmt.Errorf("proof of the model '%s'", p.ShortName())
+	}
+	if !bytes.Equal(p.Key, trie.UnpackBytes(key, p.PathArity)) {
+		return nil, errors.New("proof of another key")
+	}
+	if err = trie_blake2b_verify.Validate(p, rootBytes); err != nil {
+		return nil, err
+	}
+	_, terminal, err := trie_blake2b_verify.KeyWithTerminal(p)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Result{
+		Status:     Absent,
+		Model:      modelDescriptor,
+		Key:        key,
+		PathLength: len(p.Path),
+	}
+	if terminal == nil {
+		return ret, nil
+	}
+	ret.Status = Present
+	ret.Terminal = terminal
+	if value != nil {
+		if err = trie_blake2b_verify.ValidateWithValue(p, rootBytes, value); err != nil {
+			return nil, err
+		}
+		ret.ValueChecked = true
+	}
+	return ret, nil
+}
+
+func verifyKZG(rootBytes []byte, key, value, proofBytes []byte) (*Result, error) {
+	p, err := trie_kzg_bn256.ProofOfInclusionFromBytes(proofBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(p.Key, key) {
+		return nil, errors.New("proof of another key")
+	}
+	root := trie_kzg_bn256.Model.NewVectorCommitment()
+	rdr := bytes.NewReader(rootBytes)
+	if err = root.Read(rdr); err != nil {
+		return nil, fmt.Errorf("wrong root commitment: %w", err)
+	}
+	if rdr.Len() != 0 {
+		return nil, fmt.Errorf("wrong root commitment: %w", trie.ErrNotAllBytesConsumed)
+	}
+	if value != nil {
+		err = p.Validate(root, value)
+	} else {
+		err = p.Validate(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+	terminal, err := p.Terminal.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Status:       Present,
+		Model:        trie_kzg_bn256.Model.ShortName(),
+		Key:          key,
+		Terminal:     terminal,
+		ValueChecked: value != nil,
+		PathLength:   len(p.Path),
+	}, nil
+}
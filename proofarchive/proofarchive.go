@@ -0,0 +1,327 @@
+// Package proofarchive implements an archive file of serialized proofs of the keys against one root commitment.
+// The archive contains index by key, so proofs can be loaded and verified later one by one.
+// The archive is agnostic about the commitment model: proofs are stored as serialized bytes, the model
+// is identified by its short name
+package proofarchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// Format of the archive:
+// - magic bytes
+// - header: model short name (up to 255 bytes), root commitment bytes
+// - records: key (2 bytes length prefix) and proof bytes (4 bytes length prefix)
+// - index: number of records (uint32) and for each record key and offset of the record (uint64)
+// - offset of the index (uint64)
+// All integers are little-endian
+
+var magic = []byte("TRIEPA01")
+
+// minIndexEntrySize is the size of the index entry with the empty key: key length prefix and offset
+const minIndexEntrySize = 2 + 8
+
+var (
+	ErrWrongFormat   = errors.New("proofarchive: wrong archive format")
+	ErrDuplicateKey  = errors.New("proofarchive: duplicate key")
+	ErrKeyNotFound   = errors.New("proofarchive: key not found")
+	ErrWriterClosed  = errors.New("proofarchive: writer is closed")
+	ErrProofNotValid = errors.New("proofarchive: proof is not valid")
+)
+
+// Writer writes proofs to the archive
+type Writer struct {
+	w      io.Writer
+	file   *os.File
+	offset uint64
+	index  map[string]uint64
+	closed bool
+}
+
+// NewWriter creates archive writer with io.Writer as a backend and writes header
+func NewWriter(w io.Writer, modelName string, root []byte) (*Writer, error) {
+	ret := &Writer{
+		w:     w,
+		index: make(map[string]uint64),
+	}
+	var buf bytes.Buffer
+	buf.Write(magic)
+	if err := trie.WriteBytes8(&buf, []byte(modelName)); err != nil {
+		return nil, err
+	}
+	if err := trie.WriteBytes16(&buf, root); err != nil {
+		return nil, err
+	}
+	if err := ret.write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Create creates archive file
+func Create(fname string, modelName string, root []byte) (*Writer, error) {
+	file, err := os.Create(fname)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := NewWriter(file, modelName, root)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	ret.file = file
+	return ret, nil
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.offset += uint64(n)
+	return err
+}
+
+// Write adds serialized proof of the key to the archive
+func (w *Writer) Write(key, proof []byte) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if _, already := w.index[string(key)]; already {
+		return ErrDuplicateKey
+	}
+	var buf bytes.Buffer
+	if err := trie.WriteBytes16(&buf, key); err != nil {
+		return err
+	}
+	if err := trie.WriteBytes32(&buf, proof); err != nil {
+		return err
+	}
+	w.index[string(key)] = w.offset
+	return w.write(buf.Bytes())
+}
+
+// Len number of proofs written so far
+func (w *Writer) Len() int {
+	return len(w.index)
+}
+
+// Close writes the index and, if archive is a file, closes it
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	indexOffset := w.offset
+	keys := make([]string, 0, len(w.index))
+	for k := range w.index {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	if err := trie.WriteUint32(&buf, uint32(len(keys))); err != nil {
+		return err
+	}
+	var tmp8 [8]byte
+	for _, k := range keys {
+		if err := trie.WriteBytes16(&buf, []byte(k)); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(tmp8[:], w.index[k])
+		buf.Write(tmp8[:])
+	}
+	binary.LittleEndian.PutUint64(tmp8[:], indexOffset)
+	buf.Write(tmp8[:])
+	err := w.write(buf.Bytes())
+	if w.file != nil {
+		if errClose := w.file.Close(); err == nil {
+			err = errClose
+		}
+	}
+	return err
+}
+
+// Reader provides access to proofs in the archive
+type Reader struct {
+	r           io.ReaderAt
+	file        *os.File
+	modelName   string
+	root        []byte
+	indexOffset int64
+	keys        []string
+	index       map[string]uint64
+}
+
+// NewReader reads header and index of the archive with the given size.
+// Number of records and offsets of records are checked against the size, ErrWrongFormat is returned if they don't fit
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	ret := &Reader{
+		r:     r,
+		index: make(map[string]uint64),
+	}
+	hdr := io.NewSectionReader(r, 0, size)
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(hdr, m); err != nil || !bytes.Equal(m, magic) {
+		return nil, ErrWrongFormat
+	}
+	name, err := trie.ReadBytes8(hdr)
+	if err != nil {
+		return nil, err
+	}
+	ret.modelName = string(name)
+	if ret.root, err = trie.ReadBytes16(hdr); err != nil {
+		return nil, err
+	}
+	headerSize, err := hdr.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if size < headerSize+8 {
+		return nil, ErrWrongFormat
+	}
+	var tmp8 [8]byte
+	if _, err = r.ReadAt(tmp8[:], size-8); err != nil {
+		return nil, err
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(tmp8[:]))
+	if indexOffset < headerSize || indexOffset > size-8 {
+		return nil, ErrWrongFormat
+	}
+	ret.indexOffset = indexOffset
+	idx := io.NewSectionReader(r, indexOffset, size-8-indexOffset)
+	var num uint32
+	if err = trie.ReadUint32(idx, &num); err != nil {
+		return nil, err
+	}
+	if uint64(num) > uint64(idx.Size()-4)/minIndexEntrySize {
+		return nil, ErrWrongFormat
+	}
+	ret.keys = make([]string, 0, num)
+	for i := uint32(0); i < num; i++ {
+		k, err := trie.ReadBytes16(idx)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(idx, tmp8[:]); err != nil {
+			return nil, err
+		}
+		off := binary.LittleEndian.Uint64(tmp8[:])
+		if off < uint64(headerSize) || off >= uint64(indexOffset) {
+			return nil, ErrWrongFormat
+		}
+		ret.keys = append(ret.keys, string(k))
+		ret.index[string(k)] = off
+	}
+	return ret, nil
+}
+
+// Open opens archive file for reading
+func Open(fname string) (*Reader, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	ret, err := NewReader(file, fi.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	ret.file = file
+	return ret, nil
+}
+
+// Close closes the archive file, if any
+func (r *Reader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// ModelName short name of the commitment model of proofs
+func (r *Reader) ModelName() string {
+	return r.modelName
+}
+
+// Root bytes of the root commitment the proofs are against
+func (r *Reader) Root() []byte {
+	return r.root
+}
+
+// Len number of proofs in the archive
+func (r *Reader) Len() int {
+	return len(r.keys)
+}
+
+// Keys returns keys of the archive in lexicographical order
+func (r *Reader) Keys() [][]byte {
+	ret := make([][]byte, len(r.keys))
+	for i, k := range r.keys {
+		ret[i] = []byte(k)
+	}
+	return ret
+}
+
+// Proof returns serialized proof of the key
+func (r *Reader) Proof(key []byte) ([]byte, error) {
+	off, ok := r.index[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	// the record can't overlap the index
+	rdr := io.NewSectionReader(r.r, int64(off), r.indexOffset-int64(off))
+	k, err := trie.ReadBytes16(rdr)
+	if err != nil {
+		return nil, ErrWrongFormat
+	}
+	if !bytes.Equal(k, key) {
+		return nil, ErrWrongFormat
+	}
+	ret, err := trie.ReadBytes32(rdr)
+	if err != nil {
+		return nil, ErrWrongFormat
+	}
+	return ret, nil
+}
+
+// Iterate iterates proofs of the archive in lexicographical order of keys
+func (r *Reader) Iterate(fun func(key, proof []byte) bool) error {
+	for _, k := range r.keys {
+		p, err := r.Proof([]byte(k))
+		if err != nil {
+			return err
+		}
+		if !fun([]byte(k), p) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Validate validates all proofs in the archive against the root with the model-specific validation function.
+// Returns error with the first key which cannot be validated
+func (r *Reader) Validate(validate func(key, proof, root []byte) error) error {
+	var errRet error
+	err := r.Iterate(func(key, proof []byte) bool {
+		if err := validate(key, proof, r.root); err != nil {
+			errRet = fmt.Errorf("%w: key '%x': %v", ErrProofNotValid, key, err)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return errRet
+}
@@ -0,0 +1,13 @@
+package statedb
+
+import (
+	"github.com/iotaledger/hive.go/core/kvstore"
+	"github.com/iotaledger/trie.go/hive_adaptor"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// OpenHive opens the DB in the hive.go KVStore. Partitions of the layout are located in the KVStore itself,
+// so the realm of the KVStore separates the DB from other data
+func OpenHive(kvs kvstore.KVStore, model trie.CommitmentModel, opt ...Options) (*DB, error) {
+	return Open(model, hive_adaptor.NewHiveKVStoreAdaptor(kvs, nil), opt...)
+}
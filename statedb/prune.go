@@ -0,0 +1,162 @@
+package statedb
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// PruneOptions are optional parameters of Prune
+type PruneOptions struct {
+	// BatchSize is the maximum number of history records deleted atomically in one batch.
+	// Zero means defaultPruneBatchSize
+	BatchSize int
+	// MaxDeletesPerSecond limits the rate of deletions. Zero means no limit
+	MaxDeletesPerSecond int
+	// Progress, if not nil, is called after each batch
+	Progress func(PruneProgress)
+}
+
+// PruneProgress is the progress of Prune reported after each batch
+type PruneProgress struct {
+	// Oldest is the oldest available version, i.e. the target of pruning
+	Oldest uint64
+	// Swept is the version from which history records are still present. Pruning is complete when Swept == Oldest
+	Swept uint64
+	// Deleted is the number of history records deleted by this call of Prune
+	Deleted int
+}
+
+// Done returns true if all history records of unavailable versions have been deleted
+func (p PruneProgress) Done() bool {
+	return p.Swept >= p.Oldest
+}
+
+const defaultPruneBatchSize = 1000
+
+// Prune makes versions older than 'oldest' unavailable and deletes their history records in batches.
+// Versions become unavailable immediately, while deletion may take long time for large stores, so Prune
+// is intended to run in the background, concurrently with other methods of the DB. In this case the store
+// must be safe for concurrent use. The progress is persisted with each batch: if Prune is interrupted,
+// cancelled with the context or the DB is reopened, the next call of Prune continues from where it has stopped.
+// If 'oldest' is not above Oldest(), only deletion of the remaining records is completed, including records
+// left by Commit with DeferPruning
+func (db *DB) Prune(ctx context.Context, oldest uint64, opt ...PruneOptions) error {
+	var o PruneOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	batchSize := o.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultPruneBatchSize
+	}
+	if o.MaxDeletesPerSecond > 0 && batchSize > o.MaxDeletesPerSecond {
+		batchSize = o.MaxDeletesPerSecond
+	}
+	if err := db.retire(oldest); err != nil {
+		return err
+	}
+	start := time.Now()
+	var deleted int
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, progress := db.pruneBatch(batchSize)
+		deleted += n
+		progress.Deleted = deleted
+		if o.Progress != nil {
+			o.Progress(progress)
+		}
+		if progress.Done() {
+			db.log.Debugf("statedb: pruning completed: %d history records deleted in %v, oldest version is %d",
+				deleted, time.Since(start), progress.Oldest)
+			return nil
+		}
+		if o.MaxDeletesPerSecond <= 0 {
+			continue
+		}
+		wait := time.Duration(deleted)*time.Second/time.Duration(o.MaxDeletesPerSecond) - time.Since(start)
+		if wait <= 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retire makes versions older than 'oldest' unavailable. The start of records to be deleted is persisted together
+// with the new oldest version
+func (db *DB) retire(oldest uint64) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if oldest > db.version {
+		return fmt.Errorf("statedb::Prune: can't prune beyond the latest version %d", db.version)
+	}
+	if oldest <= db.oldest {
+		return nil
+	}
+	mutations := make([]trie.NodeMutation, 0, 2)
+	if db.meta.Get([]byte{metaPrune}) == nil {
+		mutations = append(mutations, db.metaMutation([]byte{metaPrune}, uint64To8Bytes(db.oldest)))
+	}
+	mutations = append(mutations, db.metaMutation([]byte{metaState}, stateRecord(db.version, oldest)))
+	db.wal.Apply(db.store, mutations)
+	db.log.Debugf("statedb: versions %d..%d are pruned", db.oldest, oldest-1)
+	db.oldest = oldest
+	return nil
+}
+
+// swept returns the version from which history records are present
+func (db *DB) swept() uint64 {
+	rec := db.meta.Get([]byte{metaPrune})
+	if len(rec) != 8 {
+		return db.oldest
+	}
+	return binary.BigEndian.Uint64(rec)
+}
+
+// pruneBatch deletes up to 'limit' history records of unavailable versions, in the order of versions.
+// Version v is readable only with undo records of versions v+1 and later, so undo records of the version v+1
+// are deleted before records of the version v. Returns number of deleted records
+func (db *DB) pruneBatch(limit int) (int, PruneProgress) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	v := db.swept()
+	if v >= db.oldest {
+		return 0, PruneProgress{Oldest: db.oldest, Swept: db.oldest}
+	}
+	mutations := make([]trie.NodeMutation, 0, limit+1)
+	for v < db.oldest && len(mutations) < limit {
+		complete := true
+		trie.IterateKeysPrefix(db.meta, undoVersionPrefix(v+1), func(k []byte) bool {
+			if len(mutations) >= limit {
+				complete = false
+				return false
+			}
+			mutations = append(mutations, db.metaMutation(k, nil))
+			return true
+		})
+		if !complete {
+			break
+		}
+		mutations = append(mutations, db.versionPruneMutations(v)...)
+		v++
+	}
+	n := len(mutations)
+	if v >= db.oldest {
+		mutations = append(mutations, db.metaMutation([]byte{metaPrune}, nil))
+	} else {
+		mutations = append(mutations, db.metaMutation([]byte{metaPrune}, uint64To8Bytes(v)))
+	}
+	db.wal.Apply(db.store, mutations)
+	return n, PruneProgress{Oldest: db.oldest, Swept: v}
+}
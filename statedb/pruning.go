@@ -0,0 +1,37 @@
+package statedb
+
+// PruningPolicy defines which past versions of the state are retained by the DB.
+// Versions older than the retained ones can't be read with At/AtVersion anymore and
+// their history records are removed from the store upon Commit
+type PruningPolicy interface {
+	// Oldest returns the oldest version to retain when the version 'latest' is committed
+	Oldest(latest uint64) uint64
+}
+
+type keepAll struct{}
+
+// KeepAll retains all versions of the state. It is the default policy
+func KeepAll() PruningPolicy {
+	return keepAll{}
+}
+
+func (keepAll) Oldest(uint64) uint64 {
+	return 0
+}
+
+type keepLast uint64
+
+// KeepLast retains last n versions of the state, including the latest one. KeepLast(1) keeps no history
+func KeepLast(n uint64) PruningPolicy {
+	if n == 0 {
+		panic("statedb::KeepLast: number of versions must be positive")
+	}
+	return keepLast(n)
+}
+
+func (k keepLast) Oldest(latest uint64) uint64 {
+	if latest < uint64(k) {
+		return 0
+	}
+	return latest - uint64(k) + 1
+}
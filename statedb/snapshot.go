@@ -0,0 +1,91 @@
+package statedb
+
+import (
+	"fmt"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// Snapshot is the read-only view of the committed version of the state.
+// The snapshot remains valid after later commits, until its version is pruned
+type Snapshot struct {
+	db      *DB
+	version uint64
+	root    trie.VCommitment
+	nodes   *historyReader
+	values  *historyReader
+}
+
+func newSnapshot(db *DB, version uint64, root trie.VCommitment) *Snapshot {
+	return &Snapshot{
+		db:      db,
+		version: version,
+		root:    root,
+		nodes:   &historyReader{db: db, version: version, part: undoNodes, current: db.nodes},
+		values:  &historyReader{db: db, version: version, part: undoValues, current: db.values},
+	}
+}
+
+// Version returns the version of the snapshot
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Root returns the root commitment of the snapshot. Nil for the empty state
+func (s *Snapshot) Root() trie.VCommitment {
+	return s.root
+}
+
+// Get returns the value of the key in the snapshot, nil if absent
+func (s *Snapshot) Get(key []byte) []byte {
+	return s.values.Get(key)
+}
+
+// Has checks if the key is present in the snapshot
+func (s *Snapshot) Has(key []byte) bool {
+	return s.values.Has(key)
+}
+
+// NodeStore returns the trie of the snapshot. It is used to build proofs with the commitment model,
+// for example trie_blake2b.CommitmentModel.Proof(key, snapshot.NodeStore())
+func (s *Snapshot) NodeStore() trie.NodeStore {
+	return trie.NewTrieReader(s.db.model, s.nodes, s.values)
+}
+
+// ValueStore returns the values of the snapshot as KVReader
+func (s *Snapshot) ValueStore() trie.KVReader {
+	return s.values
+}
+
+// historyReader reads the partition of the state as it was at the version: the record is taken from the undo records
+// of the earliest later version which has overwritten it, or from the current state if it was not overwritten since
+type historyReader struct {
+	db      *DB
+	version uint64
+	part    byte
+	current trie.KVReader
+}
+
+func (h *historyReader) Get(key []byte) []byte {
+	oldest, latest := h.db.versions()
+	trie.Assert(h.version >= oldest, "statedb::Snapshot: version %d has been pruned", h.version)
+	for v := h.version + 1; v <= latest; v++ {
+		rec := h.db.meta.Get(undoKey(v, h.part, key))
+		if len(rec) == 0 {
+			continue
+		}
+		switch rec[0] {
+		case 0x00:
+			return nil
+		case 0x01:
+			return rec[1:]
+		default:
+			panic(fmt.Sprintf("statedb::Snapshot: wrong undo record of the version %d", v))
+		}
+	}
+	return h.current.Get(key)
+}
+
+func (h *historyReader) Has(key []byte) bool {
+	return h.Get(key) != nil
+}
@@ -0,0 +1,414 @@
+// Package statedb implements a versioned key/value database on top of the trie.
+// It wires together the trie, the value store, the store layout, the write-ahead log and the history of past
+// versions, so the application only deals with Get/Set/Delete/Commit and with read-only snapshots of committed
+// versions (At, AtVersion). Snapshots provide the NodeStore to build proofs with the commitment model.
+//
+// The trie itself keeps only the latest state. The history is kept as undo records: upon Commit the previous
+// contents of every node and value overwritten by the new version are saved in the metadata partition.
+// A snapshot of the past version reads the current state through the undo records of all later versions,
+// so reading deep history costs one lookup per later version. Old undo records are removed according
+// to the PruningPolicy, upon Commit or, for large stores, in the background with Prune.
+// The DB is not safe for concurrent use, except Prune, which may run concurrently with other methods
+package statedb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/iotaledger/trie.go/trie"
+)
+
+// Options are optional parameters of the DB
+type Options struct {
+	// Layout of partitions in the store. Zero value means trie.DefaultStoreLayout
+	Layout trie.StoreLayout
+	// OptimizeKeyCommitments is passed to the trie (see trie.Options)
+	OptimizeKeyCommitments bool
+	// Pruning defines retained past versions. Nil means KeepAll
+	Pruning PruningPolicy
+	// DeferPruning means Commit only makes versions older than retained by the Pruning policy unavailable,
+	// while their history records are deleted later by Prune. It keeps commits fast when a lot of history is pruned at once
+	DeferPruning bool
+	// Logger receives DB and trie events. Nil means no logging
+	Logger trie.Logger
+	// Stats receives counters of commits of the trie (see trie.Stats). Nil means counters are not maintained
+	Stats *trie.Stats
+}
+
+// DB is the versioned key/value database. Each Commit creates a new version of the state with the new root commitment.
+// Version 0 is the state found in the store when it was opened for the first time, normally the empty state
+type DB struct {
+	model   trie.CommitmentModel
+	store   trie.KVStore
+	layout  trie.StoreLayout
+	nodes   trie.KVStore
+	values  trie.KVStore
+	meta    trie.KVStore
+	wal     *trie.WAL
+	pruning PruningPolicy
+	// deferPruning leaves deletion of history records to Prune
+	deferPruning bool
+	log          trie.Logger
+	tr           *trie.Trie
+	// pending updates of values since the last commit. Nil value means deletion
+	pending map[string][]byte
+	// mutex serializes writes to the store with Prune and guards the root, the version and the oldest version
+	mutex   sync.Mutex
+	root    trie.VCommitment
+	version uint64
+	oldest  uint64
+}
+
+// partitions of the metadata partition
+const (
+	metaWAL = byte(iota)
+	metaState
+	metaModel
+	metaVersion
+	metaRoot
+	metaUndo
+	// metaPrune is the version up to which history records have been deleted, when not all records of
+	// unavailable versions are deleted yet. Absent if there are no such records
+	metaPrune
+)
+
+// partitions of the undo records
+const (
+	undoNodes = byte(iota)
+	undoValues
+)
+
+// Open opens the DB in the store. The DB is initialized upon the first open. If the store already contains the trie
+// of the model, it becomes version 0. The interrupted commit, if any, is completed or rolled back
+func Open(model trie.CommitmentModel, store trie.KVStore, opt ...Options) (*DB, error) {
+	var o Options
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	layout := o.Layout
+	if layout.NodePrefix == nil && layout.ValuePrefix == nil && layout.MetadataPrefix == nil {
+		layout = trie.DefaultStoreLayout
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, fmt.Errorf("statedb::Open: %w", err)
+	}
+	ret := &DB{
+		model:        model,
+		store:        store,
+		layout:       layout,
+		nodes:        layout.NodeStore(store),
+		values:       layout.ValueStore(store),
+		meta:         layout.MetadataStore(store),
+		pruning:      o.Pruning,
+		deferPruning: o.DeferPruning,
+		log:          o.Logger,
+		pending:      make(map[string][]byte),
+	}
+	if ret.pruning == nil {
+		ret.pruning = KeepAll()
+	}
+	if ret.log == nil {
+		ret.log = trie.NewPrintfLogger(io.Discard, false)
+	}
+	ret.wal = trie.NewWAL(trie.NewPartition(ret.meta, []byte{metaWAL}))
+	n, err := ret.wal.Recover(store)
+	if err != nil {
+		return nil, fmt.Errorf("statedb::Open: %w", err)
+	}
+	if n > 0 {
+		ret.log.Warnf("statedb: interrupted commit has been completed: %d mutations replayed", n)
+	}
+	if err = ret.init(); err != nil {
+		return nil, err
+	}
+	ret.tr = trie.NewWithOptions(model, ret.nodes, ret.values, trie.Options{
+		OptimizeKeyCommitments: o.OptimizeKeyCommitments,
+		Logger:                 o.Logger,
+		Stats:                  o.Stats,
+	})
+	return ret, nil
+}
+
+// init reads the state of the DB or initializes it. The model name is written last, so initialization is repeated
+// if it was interrupted
+func (db *DB) init() error {
+	name := db.meta.Get([]byte{metaModel})
+	if name != nil && string(name) != db.model.ShortName() {
+		return fmt.Errorf("statedb::Open: the store was created with the model '%s', got '%s'", string(name), db.model.ShortName())
+	}
+	db.root = trie.RootCommitment(trie.NewTrieReader(db.model, db.nodes, db.values))
+	if name == nil {
+		db.meta.Set(versionKey(0), versionRecord(db.root))
+		db.meta.Set(rootKey(rootBytes(db.root)), uint64To8Bytes(0))
+		db.meta.Set([]byte{metaState}, stateRecord(0, 0))
+		db.meta.Set([]byte{metaModel}, []byte(db.model.ShortName()))
+		return nil
+	}
+	state := db.meta.Get([]byte{metaState})
+	if len(state) != 16 {
+		return errors.New("statedb::Open: wrong state record")
+	}
+	db.version = binary.BigEndian.Uint64(state[:8])
+	db.oldest = binary.BigEndian.Uint64(state[8:])
+	return nil
+}
+
+// Model returns the commitment model of the DB
+func (db *DB) Model() trie.CommitmentModel {
+	return db.model
+}
+
+// Version returns the latest committed version
+func (db *DB) Version() uint64 {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.version
+}
+
+// Oldest returns the oldest version which can be read with At/AtVersion
+func (db *DB) Oldest() uint64 {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.oldest
+}
+
+// Root returns the root commitment of the latest committed version. Nil for the empty state
+func (db *DB) Root() trie.VCommitment {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.root
+}
+
+// versions returns the oldest and the latest versions
+func (db *DB) versions() (uint64, uint64) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.oldest, db.version
+}
+
+// Get returns the value of the key, including uncommitted updates. Nil if the key is absent
+func (db *DB) Get(key []byte) []byte {
+	if v, ok := db.pending[string(key)]; ok {
+		return v
+	}
+	return db.values.Get(key)
+}
+
+// Has checks if the key is present, including uncommitted updates
+func (db *DB) Has(key []byte) bool {
+	return db.Get(key) != nil
+}
+
+// Set updates the value of the key. Empty value means deletion of the key.
+// The update is visible to Get immediately and becomes part of the state upon Commit
+func (db *DB) Set(key, value []byte) {
+	if len(value) == 0 {
+		db.Delete(key)
+		return
+	}
+	db.pending[string(key)] = trie.Concat(value)
+	db.tr.Update(key, value)
+}
+
+// Delete removes the key. Deletion of the absent key has no effect
+func (db *DB) Delete(key []byte) {
+	db.pending[string(key)] = nil
+	db.tr.Delete(key)
+}
+
+// Discard drops all uncommitted updates
+func (db *DB) Discard() {
+	db.pending = make(map[string][]byte)
+	db.tr.ClearCache()
+}
+
+// Commit makes uncommitted updates a new version of the state. Nodes, values, undo records of the previous
+// version and the pruning of the history are written to the store atomically, through the write-ahead log.
+// Returns root commitment and the version. If there are no updates, the latest version is returned and nothing is written
+func (db *DB) Commit() (trie.VCommitment, uint64) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if len(db.pending) == 0 {
+		return db.root, db.version
+	}
+	db.tr.Commit()
+	root := trie.RootCommitment(db.tr)
+	nodeMutations, _ := db.tr.MutationSet()
+	version := db.version + 1
+	oldest := db.pruning.Oldest(version)
+	if oldest < db.oldest {
+		oldest = db.oldest
+	}
+	if oldest > version {
+		oldest = version
+	}
+	keepUndo := oldest < version
+
+	mutations := make([]trie.NodeMutation, 0, 2*(len(nodeMutations)+len(db.pending))+4)
+	// history records of pruned versions are deleted before new records are written, because the new version
+	// may take over the root index entry of the pruned one
+	if !db.deferPruning {
+		mutations = append(mutations, db.pruneMutations(oldest, version)...)
+	} else if oldest > db.oldest && db.meta.Get([]byte{metaPrune}) == nil {
+		mutations = append(mutations, db.metaMutation([]byte{metaPrune}, uint64To8Bytes(db.oldest)))
+	}
+	for _, m := range nodeMutations {
+		if keepUndo {
+			mutations = append(mutations, db.metaMutation(undoKey(version, undoNodes, m.Key), undoRecord(db.nodes.Get(m.Key))))
+		}
+		mutations = append(mutations, trie.NodeMutation{Key: trie.Concat(db.layout.NodePrefix, m.Key), Value: m.Value})
+	}
+	keys := make([]string, 0, len(db.pending))
+	for k := range db.pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if keepUndo {
+			mutations = append(mutations, db.metaMutation(undoKey(version, undoValues, []byte(k)), undoRecord(db.values.Get([]byte(k)))))
+		}
+		mutations = append(mutations, trie.NodeMutation{Key: trie.Concat(db.layout.ValuePrefix, k), Value: db.pending[k]})
+	}
+	mutations = append(mutations,
+		db.metaMutation(versionKey(version), versionRecord(root)),
+		db.metaMutation(rootKey(rootBytes(root)), uint64To8Bytes(version)),
+		db.metaMutation([]byte{metaState}, stateRecord(version, oldest)),
+	)
+	db.wal.Apply(db.store, mutations)
+	db.tr.ClearCache()
+
+	db.log.Debugf("statedb: committed version %d: %d keys updated, %d nodes written, %d history versions pruned",
+		version, len(db.pending), len(nodeMutations), oldest-db.oldest)
+	db.pending = make(map[string][]byte)
+	db.root = root
+	db.version = version
+	db.oldest = oldest
+	return root, version
+}
+
+// pruneMutations deletes history records of versions older than 'oldest'. Version v is readable only with undo
+// records of versions v+1 and later, so undo records up to version 'oldest' are deleted
+func (db *DB) pruneMutations(oldest, latest uint64) []trie.NodeMutation {
+	ret := make([]trie.NodeMutation, 0)
+	for v := db.oldest; v < oldest; v++ {
+		ret = append(ret, db.versionPruneMutations(v)...)
+		if v+1 == latest {
+			// the undo records of the latest version are not written yet
+			continue
+		}
+		trie.IterateKeysPrefix(db.meta, undoVersionPrefix(v+1), func(k []byte) bool {
+			ret = append(ret, db.metaMutation(k, nil))
+			return true
+		})
+	}
+	return ret
+}
+
+// versionPruneMutations deletes the version record and the root index entry of the version, unless the entry
+// has been taken over by a later version with the same root
+func (db *DB) versionPruneMutations(v uint64) []trie.NodeMutation {
+	ret := []trie.NodeMutation{db.metaMutation(versionKey(v), nil)}
+	if rec := db.meta.Get(versionKey(v)); len(rec) > 0 {
+		rk := rootKey(rootFromRecord(rec))
+		if idx := db.meta.Get(rk); len(idx) == 8 && binary.BigEndian.Uint64(idx) == v {
+			ret = append(ret, db.metaMutation(rk, nil))
+		}
+	}
+	return ret
+}
+
+func (db *DB) metaMutation(key, value []byte) trie.NodeMutation {
+	return trie.NodeMutation{Key: trie.Concat(db.layout.MetadataPrefix, key), Value: value}
+}
+
+// At returns the snapshot of the latest version with the root commitment
+func (db *DB) At(root trie.VCommitment) (*Snapshot, error) {
+	idx := db.meta.Get(rootKey(rootBytes(root)))
+	if len(idx) != 8 {
+		return nil, fmt.Errorf("statedb::At: root %s is not found or has been pruned", root)
+	}
+	return db.AtVersion(binary.BigEndian.Uint64(idx))
+}
+
+// AtVersion returns the snapshot of the version. The version must be within Oldest()..Version()
+func (db *DB) AtVersion(version uint64) (*Snapshot, error) {
+	oldest, latest := db.versions()
+	if version < oldest || version > latest {
+		return nil, fmt.Errorf("statedb::AtVersion: version %d is not available. Available versions are %d..%d",
+			version, oldest, latest)
+	}
+	rec := db.meta.Get(versionKey(version))
+	if len(rec) == 0 {
+		return nil, fmt.Errorf("statedb::AtVersion: missing record of the version %d", version)
+	}
+	var root trie.VCommitment
+	if data := rootFromRecord(rec); len(data) > 0 {
+		var err error
+		if root, err = db.tr.VectorCommitmentFromBytes(data); err != nil {
+			return nil, fmt.Errorf("statedb::AtVersion: wrong root of the version %d: %w", version, err)
+		}
+	}
+	return newSnapshot(db, version, root), nil
+}
+
+// Latest returns the snapshot of the latest committed version
+func (db *DB) Latest() *Snapshot {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return newSnapshot(db, db.version, db.root)
+}
+
+func uint64To8Bytes(v uint64) []byte {
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], v)
+	return ret[:]
+}
+
+func versionKey(version uint64) []byte {
+	return trie.Concat(metaVersion, uint64To8Bytes(version))
+}
+
+// versionRecord is the root commitment with the marker byte, so the record of the empty state is not empty
+func versionRecord(root trie.VCommitment) []byte {
+	return trie.Concat(byte(0x01), rootBytes(root))
+}
+
+func rootFromRecord(rec []byte) []byte {
+	return rec[1:]
+}
+
+func rootBytes(root trie.VCommitment) []byte {
+	if root == nil {
+		return nil
+	}
+	return root.Bytes()
+}
+
+func rootKey(root []byte) []byte {
+	return trie.Concat(metaRoot, root)
+}
+
+func stateRecord(version, oldest uint64) []byte {
+	return trie.Concat(uint64To8Bytes(version), uint64To8Bytes(oldest))
+}
+
+func undoVersionPrefix(version uint64) []byte {
+	return trie.Concat(metaUndo, uint64To8Bytes(version))
+}
+
+func undoKey(version uint64, part byte, key []byte) []byte {
+	return trie.Concat(undoVersionPrefix(version), part, key)
+}
+
+// undoRecord is the previous value with the marker byte: 0x00 if the key was absent, 0x01 otherwise
+func undoRecord(prev []byte) []byte {
+	if prev == nil {
+		return []byte{0x00}
+	}
+	return trie.Concat(byte(0x01), prev)
+}
@@ -0,0 +1,382 @@
+package statedb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/hive.go/core/kvstore/mapdb"
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// genVersions returns sequence of updates. Empty value means deletion
+func genVersions(numVersions, numUpdates, numKeys int) []map[string]string {
+	rnd := rand.New(rand.NewSource(1))
+	ret := make([]map[string]string, numVersions)
+	for i := range ret {
+		ret[i] = make(map[string]string)
+		for j := 0; j < numUpdates; j++ {
+			k := fmt.Sprintf("key%d", rnd.Intn(numKeys))
+			if rnd.Intn(4) == 0 {
+				ret[i][k] = ""
+			} else {
+				ret[i][k] = fmt.Sprintf("value%d-%d", i, rnd.Intn(1000))
+			}
+		}
+	}
+	return ret
+}
+
+// replay applies updates to the plain map and returns expected states of all versions, starting from the empty one
+func replay(versions []map[string]string) []map[string]string {
+	ret := []map[string]string{{}}
+	for _, upd := range versions {
+		state := make(map[string]string)
+		for k, v := range ret[len(ret)-1] {
+			state[k] = v
+		}
+		for k, v := range upd {
+			if v == "" {
+				delete(state, k)
+			} else {
+				state[k] = v
+			}
+		}
+		ret = append(ret, state)
+	}
+	return ret
+}
+
+func requireState(t *testing.T, m *trie_blake2b.CommitmentModel, s *Snapshot, expected map[string]string, numKeys int) {
+	require.True(t, m.EqualCommitments(trie.RootCommitment(s.NodeStore()), s.Root()))
+	for i := 0; i < numKeys; i++ {
+		k := fmt.Sprintf("key%d", i)
+		v, ok := expected[k]
+		require.EqualValues(t, ok, s.Has([]byte(k)))
+		if ok {
+			require.EqualValues(t, v, string(s.Get([]byte(k))))
+		}
+		if s.Root() == nil {
+			continue
+		}
+		proof := m.Proof([]byte(k), s.NodeStore())
+		if ok {
+			require.NoError(t, trie_blake2b_verify.ValidateWithValue(proof, s.Root().Bytes(), []byte(v)))
+		} else {
+			require.NoError(t, trie_blake2b_verify.Validate(proof, s.Root().Bytes()))
+			require.True(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+		}
+	}
+}
+
+func storeContents(store trie.KVStore) map[string]string {
+	ret := make(map[string]string)
+	store.Iterate(func(k, v []byte) bool {
+		ret[string(k)] = string(v)
+		return true
+	})
+	return ret
+}
+
+// utxoID is the key which is the commitment to the output
+func utxoID(i, j int) []byte {
+	ret := blake2b.Sum256([]byte(fmt.Sprintf("output%d-%d", i, j)))
+	return ret[:]
+}
+
+func TestStateDB(t *testing.T) {
+	const numKeys = 50
+	m := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	versions := genVersions(20, 15, numKeys)
+	states := replay(versions)
+
+	t.Run("history", func(t *testing.T) {
+		store := trie.NewInMemoryKVStore()
+		db, err := Open(m, store)
+		require.NoError(t, err)
+		require.Nil(t, db.Root())
+		roots := []trie.VCommitment{nil}
+		for i, upd := range versions {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+				require.EqualValues(t, v, string(db.Get([]byte(k))))
+			}
+			root, version := db.Commit()
+			require.EqualValues(t, i+1, version)
+			roots = append(roots, root)
+		}
+		for i, expected := range states {
+			s, err := db.AtVersion(uint64(i))
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(roots[i], s.Root()))
+			requireState(t, m, s, expected, numKeys)
+		}
+		s, err := db.At(roots[5])
+		require.NoError(t, err)
+		requireState(t, m, s, states[5], numKeys)
+
+		// the reopened DB has same history
+		db, err = Open(m, store)
+		require.NoError(t, err)
+		require.EqualValues(t, len(versions), db.Version())
+		require.True(t, m.EqualCommitments(roots[len(roots)-1], db.Root()))
+		s, err = db.AtVersion(3)
+		require.NoError(t, err)
+		requireState(t, m, s, states[3], numKeys)
+		requireState(t, m, db.Latest(), states[len(states)-1], numKeys)
+
+		_, err = Open(trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256), store)
+		require.Error(t, err)
+	})
+	t.Run("same root as separate trie", func(t *testing.T) {
+		db, err := Open(m, trie.NewInMemoryKVStore())
+		require.NoError(t, err)
+		tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+		for _, upd := range versions {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+				tr.UpdateStr(k, v)
+			}
+			root, _ := db.Commit()
+			tr.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr), root))
+		}
+	})
+	t.Run("discard and empty commit", func(t *testing.T) {
+		db, err := Open(m, trie.NewInMemoryKVStore())
+		require.NoError(t, err)
+		db.Set([]byte("a"), []byte("1"))
+		root, version := db.Commit()
+		require.EqualValues(t, 1, version)
+
+		db.Set([]byte("a"), []byte("2"))
+		db.Delete([]byte("a"))
+		db.Set([]byte("b"), []byte("3"))
+		require.False(t, db.Has([]byte("a")))
+		db.Discard()
+		require.EqualValues(t, "1", string(db.Get([]byte("a"))))
+		require.False(t, db.Has([]byte("b")))
+
+		root1, version1 := db.Commit()
+		require.EqualValues(t, 1, version1)
+		require.True(t, m.EqualCommitments(root, root1))
+	})
+	t.Run("pruning", func(t *testing.T) {
+		const keep = 4
+		store := trie.NewInMemoryKVStore()
+		db, err := Open(m, store, Options{Pruning: KeepLast(keep)})
+		require.NoError(t, err)
+		for i, upd := range versions {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+			}
+			_, version := db.Commit()
+			require.EqualValues(t, i+1, version)
+			if version >= keep {
+				require.EqualValues(t, version-keep+1, db.Oldest())
+			}
+			_, err = db.AtVersion(db.Oldest() - 1)
+			require.True(t, db.Oldest() == 0 || err != nil)
+		}
+		for v := db.Oldest(); v <= db.Version(); v++ {
+			s, err := db.AtVersion(v)
+			require.NoError(t, err)
+			requireState(t, m, s, states[v], numKeys)
+		}
+		numUndo := 0
+		trie.IterateKeysPrefix(db.meta, []byte{metaUndo}, func([]byte) bool {
+			numUndo++
+			return true
+		})
+		require.True(t, numUndo > 0)
+
+		// without history there are no undo records
+		db, err = Open(m, trie.NewInMemoryKVStore(), Options{Pruning: KeepLast(1)})
+		require.NoError(t, err)
+		for _, upd := range versions {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+			}
+			db.Commit()
+		}
+		numUndo = 0
+		trie.IterateKeysPrefix(db.meta, []byte{metaUndo}, func([]byte) bool {
+			numUndo++
+			return true
+		})
+		require.EqualValues(t, 0, numUndo)
+		require.EqualValues(t, db.Version(), db.Oldest())
+		requireState(t, m, db.Latest(), states[len(states)-1], numKeys)
+	})
+	t.Run("background pruning", func(t *testing.T) {
+		const keep = 4
+		commitAll := func(db *DB) {
+			for _, upd := range versions {
+				for k, v := range upd {
+					db.Set([]byte(k), []byte(v))
+				}
+				db.Commit()
+			}
+		}
+		storeExpected := trie.NewInMemoryKVStore()
+		db, err := Open(m, storeExpected, Options{Pruning: KeepLast(keep)})
+		require.NoError(t, err)
+		commitAll(db)
+
+		store := trie.NewInMemoryKVStore()
+		db, err = Open(m, store, Options{Pruning: KeepLast(keep), DeferPruning: true})
+		require.NoError(t, err)
+		commitAll(db)
+		require.EqualValues(t, len(versions)-keep+1, db.Oldest())
+		_, err = db.AtVersion(db.Oldest() - 1)
+		require.Error(t, err)
+		require.NotEqualValues(t, storeContents(storeExpected), storeContents(store))
+
+		// interrupted pruning is resumed by the reopened DB
+		ctx, cancel := context.WithCancel(context.Background())
+		var last PruneProgress
+		err = db.Prune(ctx, 0, PruneOptions{BatchSize: 7, Progress: func(p PruneProgress) {
+			last = p
+			cancel()
+		}})
+		require.ErrorIs(t, err, context.Canceled)
+		require.EqualValues(t, 7, last.Deleted)
+		require.False(t, last.Done())
+
+		db, err = Open(m, store, Options{Pruning: KeepLast(keep), DeferPruning: true})
+		require.NoError(t, err)
+		numBatches := 0
+		err = db.Prune(context.Background(), 0, PruneOptions{BatchSize: 7, Progress: func(p PruneProgress) {
+			require.True(t, p.Swept >= last.Swept)
+			last = p
+			numBatches++
+		}})
+		require.NoError(t, err)
+		require.True(t, last.Done())
+		require.True(t, numBatches > 1)
+		require.EqualValues(t, storeContents(storeExpected), storeContents(store))
+		for v := db.Oldest(); v <= db.Version(); v++ {
+			s, err := db.AtVersion(v)
+			require.NoError(t, err)
+			requireState(t, m, s, states[v], numKeys)
+		}
+
+		// pruning beyond the policy
+		require.Error(t, db.Prune(context.Background(), db.Version()+1))
+		require.NoError(t, db.Prune(context.Background(), db.Version()-1))
+		require.EqualValues(t, db.Version()-1, db.Oldest())
+		requireState(t, m, db.Latest(), states[len(states)-1], numKeys)
+	})
+	t.Run("rate limited pruning", func(t *testing.T) {
+		const rate = 1000
+		db, err := Open(m, trie.NewInMemoryKVStore())
+		require.NoError(t, err)
+		for _, upd := range versions {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+			}
+			db.Commit()
+		}
+		start := time.Now()
+		var last PruneProgress
+		err = db.Prune(context.Background(), db.Version(), PruneOptions{
+			BatchSize:           50,
+			MaxDeletesPerSecond: rate,
+			Progress:            func(p PruneProgress) { last = p },
+		})
+		require.NoError(t, err)
+		require.True(t, last.Deleted > 100)
+		elapsed := time.Since(start)
+		require.True(t, elapsed >= time.Duration(last.Deleted-100)*time.Second/rate, "%d records deleted in %v", last.Deleted, elapsed)
+		requireState(t, m, db.Latest(), states[len(states)-1], numKeys)
+	})
+	t.Run("concurrent pruning", func(t *testing.T) {
+		db, err := OpenHive(mapdb.NewMapDB(), m, Options{Pruning: KeepLast(2), DeferPruning: true})
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			for ctx.Err() == nil {
+				if err := db.Prune(ctx, 0, PruneOptions{BatchSize: 3}); err != nil && ctx.Err() == nil {
+					done <- err
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+			done <- nil
+		}()
+		for _, upd := range versions {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+			}
+			db.Commit()
+			requireState(t, m, db.Latest(), states[db.Version()], numKeys)
+		}
+		cancel()
+		require.NoError(t, <-done)
+		require.NoError(t, db.Prune(context.Background(), 0))
+		s, err := db.AtVersion(db.Version() - 1)
+		require.NoError(t, err)
+		requireState(t, m, s, states[db.Version()-1], numKeys)
+	})
+	t.Run("hive", func(t *testing.T) {
+		kvs := mapdb.NewMapDB()
+		db, err := OpenHive(kvs, m)
+		require.NoError(t, err)
+		for _, upd := range versions[:5] {
+			for k, v := range upd {
+				db.Set([]byte(k), []byte(v))
+			}
+			db.Commit()
+		}
+		db, err = OpenHive(kvs, m)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, db.Version())
+		for v := uint64(0); v <= 5; v++ {
+			s, err := db.AtVersion(v)
+			require.NoError(t, err)
+			requireState(t, m, s, states[v], numKeys)
+		}
+	})
+	t.Run("key commitments", func(t *testing.T) {
+		// past versions are read from the same optimized nodes, with the same savings as in the trie
+		open := func(optimize bool) (*DB, trie.KVStore) {
+			store := trie.NewInMemoryKVStore()
+			db, err := Open(m, store, Options{OptimizeKeyCommitments: optimize})
+			require.NoError(t, err)
+			return db, store
+		}
+		db1, store1 := open(true)
+		db2, store2 := open(false)
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 200; j++ {
+				k := utxoID(i, j)
+				db1.Set(k, k)
+				db2.Set(k, k)
+			}
+			db1.Commit()
+			db2.Commit()
+		}
+		size1 := trie.ByteSize(trie.DefaultStoreLayout.NodeStore(store1))
+		size2 := trie.ByteSize(trie.DefaultStoreLayout.NodeStore(store2))
+		t.Logf("node store with key commitments: %d bytes, without: %d bytes", size1, size2)
+		require.True(t, size1 < size2)
+
+		s, err := db1.AtVersion(1)
+		require.NoError(t, err)
+		for j := 0; j < 200; j++ {
+			k := utxoID(0, j)
+			proof := m.Proof(k, s.NodeStore())
+			require.NoError(t, trie_blake2b_verify.Validate(proof, s.Root().Bytes()))
+			require.False(t, trie_blake2b_verify.IsProofOfAbsence(proof))
+			require.EqualValues(t, k, s.Get(k))
+			require.False(t, s.Has(utxoID(1, j)))
+		}
+	})
+}
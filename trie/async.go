@@ -0,0 +1,197 @@
+package trie
+
+import (
+	"errors"
+	"sync"
+)
+
+// BatchWriter writes batches of node mutations to the durable storage. WriteBatch returns when the batch
+// is durable, for example after the store acknowledges fsync
+type BatchWriter interface {
+	WriteBatch(mutations []NodeMutation) error
+}
+
+// kvBatchWriter is the BatchWriter which writes mutations to the key/value store and syncs it
+type kvBatchWriter struct {
+	store KVWriter
+	sync  func() error
+}
+
+// NewKVBatchWriter creates the BatchWriter which writes mutations to the store and then calls 'sync', which makes
+// the written data durable (for example, flushes the database). Nil 'sync' means the store is durable upon Set
+func NewKVBatchWriter(store KVWriter, sync func() error) BatchWriter {
+	return &kvBatchWriter{
+		store: store,
+		sync:  sync,
+	}
+}
+
+func (w *kvBatchWriter) WriteBatch(mutations []NodeMutation) error {
+	for _, m := range mutations {
+		w.store.Set(m.Key, m.Value)
+	}
+	if w.sync == nil {
+		return nil
+	}
+	return w.sync()
+}
+
+// ErrPersisterClosed is returned by the barrier of the batch handed to the closed AsyncPersister
+var ErrPersisterClosed = errors.New("trie: async persister is closed")
+
+// DurabilityBarrier is reached when the batch and all batches handed to the AsyncPersister before it are durable,
+// or when writing of any of them has failed
+type DurabilityBarrier struct {
+	done chan struct{}
+	// mutex guards reached, err and callbacks
+	mutex     sync.Mutex
+	reached   bool
+	err       error
+	callbacks []func(error)
+}
+
+func newDurabilityBarrier() *DurabilityBarrier {
+	return &DurabilityBarrier{done: make(chan struct{})}
+}
+
+// reach calls callbacks and then releases waiters, so callbacks are completed when Wait returns
+func (b *DurabilityBarrier) reach(err error) {
+	b.mutex.Lock()
+	b.reached = true
+	b.err = err
+	callbacks := b.callbacks
+	b.callbacks = nil
+	b.mutex.Unlock()
+
+	for _, fun := range callbacks {
+		fun(err)
+	}
+	close(b.done)
+}
+
+// Done returns the channel closed when the barrier is reached
+func (b *DurabilityBarrier) Done() <-chan struct{} {
+	return b.done
+}
+
+// Wait waits until the barrier is reached. Returns the error of writing, if any
+func (b *DurabilityBarrier) Wait() error {
+	<-b.done
+	return b.err
+}
+
+// OnDurable registers the callback called with the result of writing when the barrier is reached, in the goroutine
+// of the writer and before Wait returns. If the barrier is already reached, the callback is called immediately
+func (b *DurabilityBarrier) OnDurable(fun func(err error)) {
+	b.mutex.Lock()
+	if b.reached {
+		err := b.err
+		b.mutex.Unlock()
+		fun(err)
+		return
+	}
+	b.callbacks = append(b.callbacks, fun)
+	b.mutex.Unlock()
+}
+
+type asyncBatch struct {
+	mutations []NodeMutation
+	barrier   *DurabilityBarrier
+}
+
+// AsyncPersister is the persistence pipeline which writes batches of node mutations in the background goroutine,
+// in the order they are handed to it, so computation of commitments of the next blocks is not blocked by the disk.
+// After the first failed batch, the following batches are not written and fail with the same error
+type AsyncPersister struct {
+	writer BatchWriter
+	queue  chan *asyncBatch
+	// mutex guards closed and last
+	mutex  sync.Mutex
+	closed bool
+	last   *DurabilityBarrier
+	// err is the first error of the writer, accessed only by the writer goroutine
+	err  error
+	stop chan struct{}
+}
+
+const defaultAsyncPersisterQueueSize = 16
+
+// NewAsyncPersister starts the pipeline on top of the writer. Queue size is the number of batches which can be
+// handed to the pipeline before PersistMutationsAsync blocks, zero means defaultAsyncPersisterQueueSize
+func NewAsyncPersister(writer BatchWriter, queueSize int) *AsyncPersister {
+	if queueSize <= 0 {
+		queueSize = defaultAsyncPersisterQueueSize
+	}
+	ret := &AsyncPersister{
+		writer: writer,
+		queue:  make(chan *asyncBatch, queueSize),
+		stop:   make(chan struct{}),
+	}
+	go ret.run()
+	return ret
+}
+
+func (p *AsyncPersister) run() {
+	defer close(p.stop)
+	for b := range p.queue {
+		if p.err == nil && len(b.mutations) > 0 {
+			p.err = p.writer.WriteBatch(b.mutations)
+		}
+		b.barrier.reach(p.err)
+	}
+}
+
+// Write hands the batch to the pipeline. Returns the barrier of the batch
+func (p *AsyncPersister) Write(mutations []NodeMutation) *DurabilityBarrier {
+	b := &asyncBatch{
+		mutations: mutations,
+		barrier:   newDurabilityBarrier(),
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		b.barrier.reach(ErrPersisterClosed)
+		return b.barrier
+	}
+	p.last = b.barrier
+	p.queue <- b
+	return b.barrier
+}
+
+// Barrier returns the barrier of the last batch handed to the pipeline, i.e. the barrier of all batches
+func (p *AsyncPersister) Barrier() *DurabilityBarrier {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.last == nil {
+		ret := newDurabilityBarrier()
+		ret.reach(nil)
+		return ret
+	}
+	return p.last
+}
+
+// Close writes the remaining batches and stops the pipeline. Returns the first error of the writer
+func (p *AsyncPersister) Close() error {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mutex.Unlock()
+
+	<-p.stop
+	return p.err
+}
+
+// PersistMutationsAsync collects mutations of the trie (see MutationSet) and hands them to the pipeline to be written
+// in the background. The trie treats the mutations as persisted, so the cache must not be cleared and the store
+// must not be read by other readers of the trie until the returned barrier is reached.
+// Waiting on the barrier after Commit makes the commit durable, while not waiting allows to compute
+// commitments of the next block concurrently with writing of the previous one
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryPersistMutationsAsync)
+func (tr *Trie) PersistMutationsAsync(p *AsyncPersister) (*DurabilityBarrier, PersistStats) {
+	mutations, stats := tr.MutationSet()
+	return p.Write(mutations), stats
+}
@@ -0,0 +1,110 @@
+package trie_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+// slowBatchWriter is the BatchWriter with latency, which fails after 'failAfter' batches, if it is > 0
+type slowBatchWriter struct {
+	store     *lockedKVStore
+	mutex     sync.Mutex
+	batches   int
+	failAfter int
+}
+
+func (w *slowBatchWriter) WriteBatch(mutations []trie.NodeMutation) error {
+	time.Sleep(2 * time.Millisecond)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.failAfter > 0 && w.batches >= w.failAfter {
+		return errors.New("disk failure")
+	}
+	w.batches++
+	return trie.NewKVBatchWriter(w.store, nil).WriteBatch(mutations)
+}
+
+func TestAsyncPersister(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("async persister"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			writer := &slowBatchWriter{store: &lockedKVStore{KVStore: trie.NewInMemoryKVStore()}}
+			p := trie.NewAsyncPersister(writer, 4)
+			tr := trie.New(m, writer.store, nil)
+			syncStore := trie.NewInMemoryKVStore()
+			trSync := trie.New(m, syncStore, nil)
+
+			var durable []int
+			var mutex sync.Mutex
+			for i := 0; i < len(data); i += 100 {
+				for j, s := range data[i : i+100] {
+					if j%7 == 0 {
+						tr.DeleteStr(data[i/2+j])
+						trSync.DeleteStr(data[i/2+j])
+						continue
+					}
+					tr.UpdateStr(s, s+"#")
+					trSync.UpdateStr(s, s+"#")
+				}
+				tr.Commit()
+				trSync.Commit()
+				trSync.PersistMutations(syncStore)
+				barrier, stats := tr.PersistMutationsAsync(p)
+				require.True(t, stats.NodesWritten > 0)
+				block := i / 100
+				barrier.OnDurable(func(err error) {
+					require.NoError(t, err)
+					mutex.Lock()
+					durable = append(durable, block)
+					mutex.Unlock()
+				})
+				if block%3 == 0 {
+					// the durable commit
+					require.NoError(t, barrier.Wait())
+				}
+			}
+			require.NoError(t, p.Barrier().Wait())
+			require.EqualValues(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, durable)
+			require.EqualValues(t, storeContents(syncStore), storeContents(writer.store))
+			require.NoError(t, p.Close())
+
+			// the closed persister does not accept batches
+			tr.UpdateStr("after close", "1")
+			tr.Commit()
+			barrier, _ := tr.PersistMutationsAsync(p)
+			require.ErrorIs(t, barrier.Wait(), trie.ErrPersisterClosed)
+		})
+		t.Run("async persister failure"+tn(m), func(t *testing.T) {
+			writer := &slowBatchWriter{store: &lockedKVStore{KVStore: trie.NewInMemoryKVStore()}, failAfter: 2}
+			p := trie.NewAsyncPersister(writer, 0)
+			tr := trie.New(m, writer.store, nil)
+			barriers := make([]*trie.DurabilityBarrier, 0)
+			for i := 0; i < 5; i++ {
+				tr.UpdateStr(strconv.Itoa(i), "v")
+				tr.Commit()
+				barrier, _ := tr.PersistMutationsAsync(p)
+				barriers = append(barriers, barrier)
+			}
+			<-barriers[4].Done()
+			for i, b := range barriers {
+				if i < 2 {
+					require.NoError(t, b.Wait())
+				} else {
+					require.Error(t, b.Wait())
+				}
+			}
+			require.Error(t, p.Close())
+			require.EqualValues(t, 2, writer.batches)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,66 @@
+package trie
+
+import (
+	"bytes"
+	"sort"
+)
+
+// UpdateMany updates the trie with the keys and values, same as Update of each pair, but keys are sorted and applied
+// in one pass down the trie: the path to each key continues from the deepest node shared with the path of the previous
+// key instead of descending from the root. Clustered writes, such as all keys of one account, read nodes on the common
+// path once and touch the cache less. Deletions (see Update) are applied as with Delete and restart the pass from the root.
+// Duplicate keys are applied in the order of the slice, so the last value wins. Keys and values are transformed
+// by the middleware of the trie, if any. Number of values must be equal to the number of keys
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryUpdateMany)
+func (tr *Trie) UpdateMany(keys, values [][]byte) {
+	tr.mustBeWritable("UpdateMany")
+	Assert(len(keys) == len(values), "trie::UpdateMany: number of keys %d is not equal to the number of values %d",
+		len(keys), len(values))
+	type op struct {
+		key, value []byte
+		deletion   bool
+	}
+	ops := make([]op, len(keys))
+	for i := range keys {
+		switch {
+		case len(tr.middleware) == 0:
+			ops[i] = op{key: keys[i], value: values[i]}
+		case tr.isDeletion(values[i]):
+			ops[i] = op{key: tr.middleware.TransformKey(keys[i]), deletion: true}
+		default:
+			k, v := tr.middleware.Transform(keys[i], values[i])
+			ops[i] = op{key: k, value: v}
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return bytes.Compare(ops[i].key, ops[j].key) < 0
+	})
+	// prev is the path to the previous key. All nodes of the path remain in the trie after updates
+	var prev [][]byte
+	for i := range ops {
+		var c TCommitment
+		if !ops[i].deletion {
+			c = tr.commitToValue(ops[i].key, ops[i].value)
+		}
+		if c == nil {
+			tr.delete(ops[i].key)
+			prev = nil
+			continue
+		}
+		tr.opLog.update(ops[i].key, ops[i].value)
+		tr.nodeStore.recordExpiry(ops[i].key, 0)
+		unpackedKey := tr.unpackKey(ops[i].key)
+		// keys of the path are nested prefixes of the previous key
+		shared := 0
+		for shared < len(prev) && bytes.HasPrefix(unpackedKey, prev[shared]) {
+			shared++
+		}
+		proof, lastCommonPrefix, ending := continuePath(tr, unpackedKey, prev[:shared])
+		marked := 0
+		if shared > 0 {
+			marked = shared - 1
+		}
+		tr.updateTerminalAtPath(ops[i].key, c, unpackedKey, proof, lastCommonPrefix, ending, marked)
+		prev = proof
+	}
+}
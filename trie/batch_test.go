@@ -0,0 +1,76 @@
+package trie_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMany(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel, keys [][]byte, opt trie.Options) {
+		t.Run("update many"+tn(m), func(t *testing.T) {
+			storeSeq := trie.NewInMemoryKVStore()
+			storeMany := trie.NewInMemoryKVStore()
+			trSeq := trie.NewWithOptions(m, storeSeq, nil, opt)
+			trMany := trie.NewWithOptions(m, storeMany, nil, opt)
+
+			rnd := rand.New(rand.NewSource(42))
+			for round := 0; round < 4; round++ {
+				batchKeys := make([][]byte, 0, len(keys)+10)
+				batchValues := make([][]byte, 0, len(keys)+10)
+				for _, k := range keys {
+					var v []byte
+					if rnd.Intn(4) > 0 {
+						v = []byte(fmt.Sprintf("%x-%d", k, round))
+					}
+					batchKeys = append(batchKeys, k)
+					batchValues = append(batchValues, v)
+				}
+				// duplicates are applied in the order of the batch
+				for i := 0; i < 10; i++ {
+					k := keys[rnd.Intn(len(keys))]
+					batchKeys = append(batchKeys, k)
+					batchValues = append(batchValues, []byte(fmt.Sprintf("dup-%d-%d", i, round)))
+				}
+				for i := range batchKeys {
+					trSeq.Update(batchKeys[i], batchValues[i])
+				}
+				trMany.UpdateMany(batchKeys, batchValues)
+				trSeq.Commit()
+				trMany.Commit()
+				require.True(t, m.EqualCommitments(trie.RootCommitment(trSeq), trie.RootCommitment(trMany)))
+			}
+			trSeq.PersistMutations(storeSeq)
+			trMany.PersistMutations(storeMany)
+			require.EqualValues(t, storeContents(storeSeq), storeContents(storeMany))
+
+			trMany.UpdateMany(nil, nil)
+			require.Panics(t, func() {
+				trMany.UpdateMany(keys[:2], keys[:1])
+			})
+		})
+	}
+	clustered := make([][]byte, 0)
+	for _, s := range genData2() {
+		clustered = append(clustered, []byte(s))
+	}
+	random := make([][]byte, 0)
+	for _, s := range genRnd4()[:300] {
+		random = append(random, []byte(s))
+	}
+	for _, m := range []trie.CommitmentModel{
+		trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160),
+		trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256),
+		trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256),
+	} {
+		runTest(t, m, clustered, trie.Options{})
+		runTest(t, m, random, trie.Options{})
+		runTest(t, m, genHashedKeys(500), trie.Options{FixedKeyLength: 32})
+	}
+	runTest(t, trie_kzg_bn256.New(), random, trie.Options{})
+}
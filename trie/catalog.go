@@ -0,0 +1,182 @@
+package trie
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RootCatalogOptions are optional parameters of the RootCatalog
+type RootCatalogOptions struct {
+	// MaxAge is the time after the last open of the root when it is evicted from the catalog.
+	// 0 means roots are not evicted by age
+	MaxAge time.Duration
+	// MaxRoots is the maximal number of cached roots. The least recently opened root is evicted first.
+	// 0 means no limit
+	MaxRoots int
+	// Codec is the serialization of nodes in stores. Nil means BinaryCodec
+	Codec Codec
+	// MetadataStore is the store with the config record of the trie (see ReadConfig), if any.
+	// The config is read and validated once, upon the first open
+	MetadataStore KVReader
+}
+
+// RootCatalogStats are metrics of the RootCatalog
+type RootCatalogStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// RootCatalog hands out lightweight TrieReaders of many historical states, for example for explorers serving queries
+// across many block heights. The root node of each state is read from the store and verified against the root
+// commitment once, upon the first open, and then is served from the catalog to all readers of the root. The model
+// and the codec are fixed for the catalog and the config record is validated once, so readers are not configured per root.
+// The root node binds the whole node by its commitment, so it is shared by readers of the root in different stores.
+// Roots are evicted by age and by number (see RootCatalogOptions). It is safe for concurrent use
+type RootCatalog struct {
+	model     CommitmentModel
+	opt       RootCatalogOptions
+	mutex     sync.Mutex
+	roots     map[string]*catalogRoot
+	config    *TrieConfig
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type catalogRoot struct {
+	node     *nodeReadOnly
+	lastOpen time.Time
+}
+
+// NewRootCatalog creates the empty catalog of roots of the model
+func NewRootCatalog(model CommitmentModel, opt ...RootCatalogOptions) *RootCatalog {
+	ret := &RootCatalog{
+		model: model,
+		roots: make(map[string]*catalogRoot),
+	}
+	if len(opt) > 0 {
+		ret.opt = opt[0]
+	}
+	ret.opt.Codec = codecOrDefault(ret.opt.Codec)
+	return ret
+}
+
+// Open returns the reader of the state with the root. The trie store must contain the state of the root, for example
+// it is the node store of the statedb snapshot of the version. The root node is taken from the catalog, or is read
+// from the trie store and verified against the root commitment. Other nodes are read from the trie store.
+// Nil root means the empty state. Returns error if the root node is missing or does not match the commitment,
+// or if the config record is wrong
+func (c *RootCatalog) Open(root VCommitment, trieStore, valueStore KVReader) (*TrieReader, error) {
+	if _, err := c.Config(); err != nil {
+		return nil, err
+	}
+	ret := NewTrieReader(c.model, trieStore, valueStore, c.opt.Codec)
+	if root == nil {
+		ret.reader.trieStore = NewInMemoryKVStore()
+		return ret, nil
+	}
+	key := string(root.Bytes())
+	now := time.Now()
+
+	c.mutex.Lock()
+	c.evictOlderThan(now)
+	if r, ok := c.roots[key]; ok {
+		r.lastOpen = now
+		c.hits++
+		c.mutex.Unlock()
+		ret.root = r.node
+		return ret, nil
+	}
+	c.misses++
+	c.mutex.Unlock()
+
+	n, ok := ret.reader.getNode(nil)
+	if !ok {
+		return nil, fmt.Errorf("trie::RootCatalog.Open: missing root node of %s", root)
+	}
+	if !c.model.EqualCommitments(nodeCommitment(c.model, n), root) {
+		return nil, fmt.Errorf("trie::RootCatalog.Open: root node does not match the commitment %s", root)
+	}
+	c.mutex.Lock()
+	c.roots[key] = &catalogRoot{node: n, lastOpen: now}
+	c.evictOverLimit()
+	c.mutex.Unlock()
+	ret.root = n
+	return ret, nil
+}
+
+// Config returns the validated config record of the trie. Empty config if there's no metadata store or no record
+func (c *RootCatalog) Config() (*TrieConfig, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.config != nil {
+		return c.config, nil
+	}
+	if c.opt.MetadataStore == nil {
+		c.config = &TrieConfig{}
+		return c.config, nil
+	}
+	cfg, err := ReadConfig(c.opt.MetadataStore)
+	if err != nil {
+		return nil, fmt.Errorf("trie::RootCatalog.Config: %w", err)
+	}
+	c.config = cfg
+	return c.config, nil
+}
+
+// Evict removes roots which were not opened during 'age'. Returns number of evicted roots
+func (c *RootCatalog) Evict(age time.Duration) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.evict(time.Now().Add(-age))
+}
+
+// Stats returns metrics of the catalog
+func (c *RootCatalog) Stats() RootCatalogStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return RootCatalogStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      len(c.roots),
+	}
+}
+
+// evictOlderThan evicts roots according to MaxAge, if any
+func (c *RootCatalog) evictOlderThan(now time.Time) {
+	if c.opt.MaxAge > 0 {
+		c.evict(now.Add(-c.opt.MaxAge))
+	}
+}
+
+// evict removes roots opened last before the deadline
+func (c *RootCatalog) evict(deadline time.Time) int {
+	ret := 0
+	for k, r := range c.roots {
+		if r.lastOpen.Before(deadline) {
+			delete(c.roots, k)
+			ret++
+		}
+	}
+	c.evictions += uint64(ret)
+	return ret
+}
+
+// evictOverLimit removes least recently opened roots over MaxRoots, if any
+func (c *RootCatalog) evictOverLimit() {
+	for c.opt.MaxRoots > 0 && len(c.roots) > c.opt.MaxRoots {
+		var oldestKey string
+		var oldest *catalogRoot
+		for k, r := range c.roots {
+			if oldest == nil || r.lastOpen.Before(oldest.lastOpen) {
+				oldestKey, oldest = k, r
+			}
+		}
+		delete(c.roots, oldestKey)
+		c.evictions++
+	}
+}
@@ -0,0 +1,100 @@
+package trie_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootCatalog(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("root catalog"+tn(m), func(t *testing.T) {
+			data := genData2()[:300]
+			// versions of the state in separate stores
+			const versions = 3
+			stores := make([]trie.KVStore, versions)
+			roots := make([]trie.VCommitment, versions)
+			for i := range stores {
+				stores[i] = trie.NewInMemoryKVStore()
+				tr := trie.New(m, stores[i], nil)
+				for _, s := range data[:100*(i+1)] {
+					tr.UpdateStr(s, s+"+")
+				}
+				tr.Commit()
+				tr.PersistMutations(stores[i])
+				roots[i] = trie.RootCommitment(tr)
+			}
+			catalog := trie.NewRootCatalog(m)
+			for i := range stores {
+				rdr, err := catalog.Open(roots[i], stores[i], nil)
+				require.NoError(t, err)
+				require.True(t, m.EqualCommitments(roots[i], trie.RootCommitment(rdr)))
+			}
+			require.EqualValues(t, trie.RootCatalogStats{Misses: versions, Size: versions}, catalog.Stats())
+
+			// the root node is not read again
+			counting := &countingKVReader{KVReader: stores[1]}
+			rdr, err := catalog.Open(roots[1], counting, nil)
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(roots[1], trie.RootCommitment(rdr)))
+			require.EqualValues(t, 0, counting.reads)
+			require.EqualValues(t, 1, catalog.Stats().Hits)
+
+			expected := trie.NewTrieReader(m, stores[1], nil)
+			keys := make([][]byte, 0)
+			for _, s := range data[:200] {
+				require.EqualValues(t, trie.GetProofGeneric(expected, []byte(s)), trie.GetProofGeneric(rdr, []byte(s)))
+				keys = append(keys, []byte(s))
+			}
+			require.EqualValues(t, expected.HasMany(keys), rdr.HasMany(keys))
+			require.EqualValues(t, []bool{false}, rdr.HasMany([][]byte{[]byte(data[250])}))
+
+			// root which does not match the store is not cataloged
+			fresh := trie.NewRootCatalog(m)
+			_, err = fresh.Open(roots[0], stores[2], nil)
+			require.Error(t, err)
+			_, err = fresh.Open(roots[0], trie.NewInMemoryKVStore(), nil)
+			require.Error(t, err)
+			require.EqualValues(t, 0, fresh.Stats().Size)
+
+			rdr, err = catalog.Open(nil, stores[0], nil)
+			require.NoError(t, err)
+			require.Nil(t, trie.RootCommitment(rdr))
+
+			require.EqualValues(t, 0, catalog.Evict(time.Hour))
+			require.EqualValues(t, versions, catalog.Evict(0))
+			require.EqualValues(t, 0, catalog.Stats().Size)
+
+			limited := trie.NewRootCatalog(m, trie.RootCatalogOptions{MaxRoots: 2})
+			for i := range stores {
+				_, err = limited.Open(roots[i], stores[i], nil)
+				require.NoError(t, err)
+			}
+			require.EqualValues(t, 2, limited.Stats().Size)
+			require.EqualValues(t, 1, limited.Stats().Evictions)
+
+			// the config record is validated once
+			metadata := trie.NewInMemoryKVStore()
+			policy := trie.TerminalPolicy{{Prefix: []byte("blob/"), Threshold: trie.ExternalizeAll}}
+			require.NoError(t, trie.WriteConfig(metadata, &trie.TrieConfig{TerminalPolicy: policy}))
+			configured := trie.NewRootCatalog(m, trie.RootCatalogOptions{MetadataStore: metadata})
+			_, err = configured.Open(roots[0], stores[0], nil)
+			require.NoError(t, err)
+			metadata.Set(trie.ConfigKey, []byte("wrong"))
+			cfg, err := configured.Config()
+			require.NoError(t, err)
+			require.EqualValues(t, policy, cfg.TerminalPolicy)
+
+			_, err = trie.NewRootCatalog(m, trie.RootCatalogOptions{MetadataStore: metadata}).Open(roots[0], stores[0], nil)
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
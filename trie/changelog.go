@@ -0,0 +1,155 @@
+package trie
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Changelog index is an optional index which records, for each key, roots of commits which changed the value of
+// the key (see Options.ChangelogIndex). It answers "history of the key" queries of explorers without replaying
+// diffs of all commits. Changes of terminal commitments are tracked by the trie upon updates and deletions,
+// entries are created by the commit with its root and are written to the index store together with persisting
+// of node mutations. Commits are numbered by the sequence kept in the index itself, so the history is ordered.
+// Keys are those inserted into the trie, i.e. transformed by the middleware.
+// Layout of the index store:
+// - changelogSeqPrefix -> 8 bytes of the sequence number of the next commit (big-endian)
+// - changelogKeyPrefix + 2 bytes of the key length (big-endian) + key + 8 bytes of the sequence number -> root
+const (
+	changelogSeqPrefix = byte(iota)
+	changelogKeyPrefix
+)
+
+// KeyChange is the commit which changed the value of the key, according to the changelog index
+type KeyChange struct {
+	// Seq is the sequence number of the commit in the changelog index
+	Seq uint64
+	// Root is the serialized root commitment of the commit. Nil if the commit left the trie empty
+	Root []byte
+}
+
+// recordTerminalChange tracks the change of the terminal commitment of the key for the digest and changelog indexes
+func (sc *nodeStoreBuffered) recordTerminalChange(key []byte, prev, cur TCommitment) {
+	sc.recordDigestChange(key, prev, cur)
+	if sc.changelogIndex == nil {
+		return
+	}
+	if ch, ok := sc.changelogChanges[string(key)]; ok {
+		ch.cur = cur
+		return
+	}
+	sc.changelogChanges[string(key)] = &digestChange{prev: prev, cur: cur}
+}
+
+// commitChangelog creates entries of the changelog index for keys changed since the previous commit.
+// Entries are buffered until persist
+func (sc *nodeStoreBuffered) commitChangelog(root VCommitment) {
+	if sc.changelogIndex == nil {
+		return
+	}
+	var rootBytes []byte
+	if root != nil {
+		rootBytes = root.Bytes()
+	}
+	changed := false
+	for k, ch := range sc.changelogChanges {
+		if sc.reader.m.EqualCommitments(ch.prev, ch.cur) {
+			continue
+		}
+		sc.changelogPending[string(changelogKey([]byte(k), sc.changelogSeq))] = changelogValue(rootBytes)
+		changed = true
+	}
+	sc.changelogChanges = make(map[string]*digestChange)
+	if !changed {
+		return
+	}
+	sc.changelogSeq++
+	sc.changelogPending[string([]byte{changelogSeqPrefix})] = uint64Bytes(sc.changelogSeq)
+}
+
+// persistChangelog writes buffered entries of the changelog index to the writer. Returns number of written entries
+func (sc *nodeStoreBuffered) persistChangelog(w KVWriter) int {
+	if sc.changelogIndex == nil {
+		return 0
+	}
+	for k, v := range sc.changelogPending {
+		w.Set([]byte(k), v)
+	}
+	ret := len(sc.changelogPending)
+	sc.changelogPending = make(map[string][]byte)
+	return ret
+}
+
+func (sc *nodeStoreBuffered) cloneChangelog() (map[string]*digestChange, map[string][]byte) {
+	changes := make(map[string]*digestChange, len(sc.changelogChanges))
+	for k, ch := range sc.changelogChanges {
+		chCopy := *ch
+		changes[k] = &chCopy
+	}
+	pending := make(map[string][]byte, len(sc.changelogPending))
+	for k, v := range sc.changelogPending {
+		pending[k] = v
+	}
+	return changes, pending
+}
+
+// readChangelogSeq reads the sequence number of the next commit from the changelog index
+func readChangelogSeq(index KVReader) uint64 {
+	data := index.Get([]byte{changelogSeqPrefix})
+	if len(data) == 0 {
+		return 0
+	}
+	Assert(len(data) == 8, "trie::readChangelogSeq: wrong sequence record of the changelog index")
+	return binary.BigEndian.Uint64(data)
+}
+
+func uint64Bytes(v uint64) []byte {
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], v)
+	return ret[:]
+}
+
+func changelogKeyPrefixOf(key []byte) []byte {
+	Assert(len(key) <= 0xffff, "trie::changelogKeyPrefixOf: key too long")
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(key)))
+	return Concat(changelogKeyPrefix, l[:], key)
+}
+
+func changelogKey(key []byte, seq uint64) []byte {
+	return Concat(changelogKeyPrefixOf(key), uint64Bytes(seq))
+}
+
+// changelogValue is the root prefixed with its length, so the empty root is not the empty value
+func changelogValue(root []byte) []byte {
+	Assert(len(root) < 256, "trie::changelogValue: root commitment too long")
+	return Concat(byte(len(root)), root)
+}
+
+// KeyHistory returns commits which changed the value of the key, according to the changelog index
+// (see Options.ChangelogIndex), in the order of commits. The key is the key inserted into the trie, i.e. transformed
+// by the middleware. Unless the index store implements KVPrefixIterator, it iterates the whole index
+func KeyHistory(changelogIndex KVIterator, key []byte) ([]KeyChange, error) {
+	prefix := changelogKeyPrefixOf(key)
+	ret := make([]KeyChange, 0)
+	var err error
+	IteratePrefix(changelogIndex, prefix, func(k, v []byte) bool {
+		if len(k) != len(prefix)+8 || len(v) == 0 || len(v) != int(v[0])+1 {
+			err = fmt.Errorf("trie::KeyHistory: wrong entry of the changelog index '%x'", k)
+			return false
+		}
+		ch := KeyChange{Seq: binary.BigEndian.Uint64(k[len(prefix):])}
+		if v[0] > 0 {
+			ch.Root = Concat(v[1:])
+		}
+		ret = append(ret, ch)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Seq < ret[j].Seq
+	})
+	return ret, nil
+}
@@ -0,0 +1,83 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangelogIndex(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("changelog index"+tn(m), func(t *testing.T) {
+			data := genData1()[:200]
+			store := trie.NewInMemoryKVStore()
+			index := trie.NewInMemoryKVStore()
+			opt := trie.Options{ChangelogIndex: index}
+			tr := trie.NewWithOptions(m, store, nil, opt)
+			roots := make([][]byte, 0)
+			commit := func() {
+				tr.Commit()
+				roots = append(roots, trie.RootCommitment(tr).Bytes())
+			}
+			for _, s := range data {
+				tr.UpdateStr(s, s)
+			}
+			commit()
+			// updates with the same value and updates reverted before the commit are not changes
+			tr.UpdateStr(data[0], "changed")
+			tr.UpdateStr(data[1], data[1])
+			tr.UpdateStr(data[2], "temporary")
+			tr.UpdateStr(data[2], data[2])
+			commit()
+			// commits are not persisted one by one
+			stats := tr.PersistMutationsWithStats(store)
+			require.EqualValues(t, len(data)+1+1, stats.ChangelogIndexUpdates)
+			require.True(t, tr.Stats().ChangelogIndex)
+
+			// the sequence continues in the new trie
+			tr = trie.NewWithOptions(m, store, nil, opt)
+			tr.DeleteStr(data[0])
+			commit()
+			tr.UpdateStr(data[3], "changed")
+			commit()
+			_, indexMutations, _ := tr.MutationSetWithIndexes()
+			require.EqualValues(t, 2+1, len(indexMutations.Changelog))
+			for _, mut := range indexMutations.Changelog {
+				index.Set(mut.Key, mut.Value)
+			}
+
+			history := func(key string) []trie.KeyChange {
+				ret, err := trie.KeyHistory(index, []byte(key))
+				require.NoError(t, err)
+				return ret
+			}
+			require.EqualValues(t, []trie.KeyChange{{Seq: 0, Root: roots[0]}, {Seq: 1, Root: roots[1]}, {Seq: 2, Root: roots[2]}}, history(data[0]))
+			require.EqualValues(t, []trie.KeyChange{{Seq: 0, Root: roots[0]}}, history(data[1]))
+			require.EqualValues(t, []trie.KeyChange{{Seq: 0, Root: roots[0]}}, history(data[2]))
+			require.EqualValues(t, []trie.KeyChange{{Seq: 0, Root: roots[0]}, {Seq: 3, Root: roots[3]}}, history(data[3]))
+			require.EqualValues(t, 0, len(history("absent")))
+			// the key is not the prefix of other keys in the index
+			require.EqualValues(t, 0, len(history(data[0][:1])))
+
+			// the commit which empties the trie
+			emptied := trie.NewInMemoryKVStore()
+			tr = trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, trie.Options{ChangelogIndex: emptied})
+			tr.UpdateStr("a", "a")
+			tr.Commit()
+			tr.DeleteStr("a")
+			tr.Commit()
+			tr.PersistMutations(trie.NewInMemoryKVStore())
+			h, err := trie.KeyHistory(emptied, []byte("a"))
+			require.NoError(t, err)
+			require.EqualValues(t, 2, len(h))
+			require.Nil(t, h[1].Root)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,238 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Chunked values. A value too large to be handled in memory is split into chunks of fixed size.
+// Chunks are committed in the chunk trie, a separate trie of the same commitment model with chunk indices as keys
+// (see ChunkKey). The key of the state is updated with the ChunkedValue descriptor, which contains the root commitment
+// of the chunk trie, so the terminal commitment of the key commits to every chunk of the value.
+// Nodes of the chunk trie and the chunks themselves are stored in the chunk store, in the partition of the key.
+// A chunk is proven against the root in the descriptor the same way as a key of the state is proven against the state root
+
+const chunkedValueVersion = 0x01
+
+// chunksPerFlush is the number of chunks after which the chunk trie is persisted and its cache is cleared,
+// so that memory used by UpdateChunked does not depend on the size of the value
+const chunksPerFlush = 1024
+
+const (
+	chunkTrieNodesPartition  = 0x00
+	chunkTrieChunksPartition = 0x01
+)
+
+// ChunkedValue is the descriptor of the value stored as a chunk trie. Serialized descriptor is the value of the key in the state
+type ChunkedValue struct {
+	// Size is the size of the whole value
+	Size uint64
+	// ChunkSize is the size of every chunk except, possibly, the last one
+	ChunkSize uint32
+	// Root is the serialized root commitment of the chunk trie. Nil for the empty value
+	Root []byte
+}
+
+func ChunkedValueFromBytes(data []byte) (*ChunkedValue, error) {
+	ret := &ChunkedValue{}
+	rdr := bytes.NewReader(data)
+	if err := ret.Read(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+func (cv *ChunkedValue) Bytes() []byte {
+	return MustBytes(cv)
+}
+
+func (cv *ChunkedValue) Write(w io.Writer) error {
+	if err := WriteByte(w, chunkedValueVersion); err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64]byte
+	if _, err := w.Write(buf[:binary.PutUvarint(buf[:], cv.Size)]); err != nil {
+		return err
+	}
+	if err := WriteUint32(w, cv.ChunkSize); err != nil {
+		return err
+	}
+	return WriteBytes8(w, cv.Root)
+}
+
+func (cv *ChunkedValue) Read(r io.Reader) error {
+	v, err := ReadByte(r)
+	if err != nil {
+		return err
+	}
+	if v != chunkedValueVersion {
+		return fmt.Errorf("trie::ChunkedValue: unsupported version %d", v)
+	}
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+	if cv.Size, err = binary.ReadUvarint(br); err != nil {
+		return err
+	}
+	if err = ReadUint32(r, &cv.ChunkSize); err != nil {
+		return err
+	}
+	if cv.ChunkSize == 0 {
+		return errors.New("trie::ChunkedValue: chunk size can't be 0")
+	}
+	if cv.Root, err = ReadBytes8(r); err != nil {
+		return err
+	}
+	if len(cv.Root) == 0 {
+		cv.Root = nil
+	}
+	return nil
+}
+
+// NumChunks returns number of chunks of the value
+func (cv *ChunkedValue) NumChunks() uint64 {
+	ret := cv.Size / uint64(cv.ChunkSize)
+	if cv.Size%uint64(cv.ChunkSize) != 0 {
+		ret++
+	}
+	return ret
+}
+
+// ChunkKey is the key of the chunk in the chunk trie
+func ChunkKey(index uint64) []byte {
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], index)
+	return ret[:]
+}
+
+// chunkPartition is the prefix of all data of the chunked value of the key in the chunk store.
+// The length prefix makes sure partition of one key is never a prefix of the partition of another key
+func chunkPartition(key []byte) []byte {
+	Assert(len(key) <= math.MaxUint16, "trie::chunkPartition: key too long")
+	return Concat(Uint16To2Bytes(uint16(len(key))), key)
+}
+
+func chunkStores(key []byte, chunkStore KVStore) (KVStore, KVStore) {
+	p := chunkPartition(key)
+	return NewPartition(chunkStore, Concat(p, byte(chunkTrieNodesPartition))),
+		NewPartition(chunkStore, Concat(p, byte(chunkTrieChunksPartition)))
+}
+
+// UpdateChunked reads the value from the reader until EOF, splits it into chunks of chunkSize bytes and writes
+// chunks and nodes of the chunk trie into the partition of the key in the chunk store, replacing previous chunks of the key.
+// Then the key is updated in the trie with the serialized descriptor of the chunked value.
+// If valueStore is not nil, the descriptor is also written into it, same as other values of the state.
+// The value is never loaded in memory as a whole.
+// On error the trie is not updated, however chunks of the key in the chunk store are left in inconsistent state.
+// The key and the descriptor bypass the middleware of the trie
+func (tr *Trie) UpdateChunked(key []byte, r io.Reader, chunkSize int, chunkStore KVStore, valueStore KVWriter) (*ChunkedValue, error) {
+	if err := tr.checkWritable("UpdateChunked"); err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 || uint64(chunkSize) > math.MaxUint32 {
+		return nil, fmt.Errorf("trie::UpdateChunked: wrong chunk size %d", chunkSize)
+	}
+	DeleteChunks(key, chunkStore)
+	nodes, chunks := chunkStores(key, chunkStore)
+	ct := New(tr.Model(), nodes, chunks)
+	ret := &ChunkedValue{ChunkSize: uint32(chunkSize)}
+	buf := make([]byte, chunkSize)
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := Concat(buf[:n])
+			chunks.Set(ChunkKey(index), chunk)
+			ct.Update(ChunkKey(index), chunk)
+			ret.Size += uint64(n)
+			if (index+1)%chunksPerFlush == 0 {
+				ct.Commit()
+				ct.PersistMutations(nodes)
+				ct.ClearCache()
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	ct.Commit()
+	ct.PersistMutations(nodes)
+	if root := RootCommitment(ct); root != nil {
+		ret.Root = root.Bytes()
+	}
+	data := ret.Bytes()
+	tr.update(key, data)
+	if valueStore != nil {
+		valueStore.Set(key, data)
+	}
+	return ret, nil
+}
+
+// DeleteChunks removes chunks and the chunk trie of the key from the chunk store. Returns number of deleted records.
+// Iteration is bounded by the partition of the key if the chunk store implements KVPrefixIterator
+func DeleteChunks(key []byte, chunkStore KVStore) int {
+	toDelete := make([][]byte, 0)
+	IterateKeysPrefix(chunkStore, chunkPartition(key), func(k []byte) bool {
+		toDelete = append(toDelete, Concat(k))
+		return true
+	})
+	for _, k := range toDelete {
+		chunkStore.Set(k, nil)
+	}
+	return len(toDelete)
+}
+
+// GetChunkedValue reads the descriptor of the chunked value of the key from the value store.
+// Returns nil if the key is absent
+func GetChunkedValue(key []byte, valueStore KVReader) (*ChunkedValue, error) {
+	data := valueStore.Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	return ChunkedValueFromBytes(data)
+}
+
+// GetChunk returns the chunk of the value of the key from the chunk store, nil if absent
+func GetChunk(key []byte, index uint64, chunkStore KVStore) []byte {
+	_, chunks := chunkStores(key, chunkStore)
+	return chunks.Get(ChunkKey(index))
+}
+
+// ReadChunked writes the whole chunked value of the key to the writer, chunk by chunk.
+// Chunks are checked against sizes in the descriptor but not against commitments
+func ReadChunked(w io.Writer, key []byte, cv *ChunkedValue, chunkStore KVStore) error {
+	_, chunks := chunkStores(key, chunkStore)
+	remaining := cv.Size
+	for index := uint64(0); remaining > 0; index++ {
+		chunk := chunks.Get(ChunkKey(index))
+		expected := uint64(cv.ChunkSize)
+		if remaining < expected {
+			expected = remaining
+		}
+		if uint64(len(chunk)) != expected {
+			return fmt.Errorf("trie::ReadChunked: chunk #%d: expected %d bytes, got %d", index, expected, len(chunk))
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		remaining -= expected
+	}
+	return nil
+}
+
+// ChunkTrieReader returns the reader of the chunk trie of the key. The root commitment of the reader
+// is the Root of the ChunkedValue. It is used to build proofs of individual chunks under keys ChunkKey(index)
+func ChunkTrieReader(model CommitmentModel, key []byte, chunkStore KVStore) *TrieReader {
+	nodes, chunks := chunkStores(key, chunkStore)
+	return NewTrieReader(model, nodes, chunks)
+}
@@ -0,0 +1,151 @@
+package trie
+
+import "fmt"
+
+// CloneStateOptions are optional parameters of CloneState
+type CloneStateOptions struct {
+	// Layout of partitions in both stores. Zero value means DefaultStoreLayout
+	Layout StoreLayout
+	// Codec is the serialization of nodes. Nil means BinaryCodec
+	Codec Codec
+	// TrieOptions are options of the trie which wrote the state. Values are checked against terminals the same way
+	// Trie.Update commits to them, see ReconcileTerminals
+	TrieOptions Options
+}
+
+// CloneStats is the result of CloneState
+type CloneStats struct {
+	Nodes      int
+	NodeBytes  int
+	Values     int
+	ValueBytes int
+}
+
+func (s *CloneStats) String() string {
+	return fmt.Sprintf("cloned nodes: %d (%d bytes), values: %d (%d bytes)", s.Nodes, s.NodeBytes, s.Values, s.ValueBytes)
+}
+
+// CloneState copies exactly the state of the root from the source store into the fresh destination store, for
+// verified backups and for seeding replicas. Nodes reachable from the root are verified against the root commitment,
+// as in ExportSubtree, and copied together with values of their keys unchanged. Each copied value is checked against
+// the terminal of its key, including terminals stored in nodes, which are not committed to the value. Garbage, other versions and the
+// metadata partition are not copied. Then the root commitment is re-verified at the destination: all nodes
+// are read back and their commitments are recomputed from the root down. The node partition of the destination
+// must be empty. Nil root means the empty state, nothing is copied
+func CloneState(srcStore, dstStore KVStore, model CommitmentModel, root VCommitment, opt ...CloneStateOptions) (*CloneStats, error) {
+	var o CloneStateOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	layout := o.Layout
+	if layout.NodePrefix == nil && layout.ValuePrefix == nil && layout.MetadataPrefix == nil {
+		layout = DefaultStoreLayout
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, fmt.Errorf("trie::CloneState: %w", err)
+	}
+	c := &stateCloner{
+		codec:     codecOrDefault(o.Codec),
+		model:     model,
+		trieOpt:   o.TrieOptions,
+		srcNodes:  layout.NodeStore(srcStore),
+		srcValues: layout.ValueStore(srcStore),
+		dstNodes:  layout.NodeStore(dstStore),
+		dstValues: layout.ValueStore(dstStore),
+	}
+	empty := true
+	c.dstNodes.Iterate(func(_, _ []byte) bool {
+		empty = false
+		return false
+	})
+	if !empty {
+		return nil, fmt.Errorf("trie::CloneState: destination store is not empty")
+	}
+	if root == nil {
+		return &c.stats, nil
+	}
+	if err := c.copyNode(nil, root); err != nil {
+		return nil, fmt.Errorf("trie::CloneState: %w", err)
+	}
+	verified, err := c.verifyNode(nil, root)
+	if err != nil {
+		return nil, fmt.Errorf("trie::CloneState: destination: %w", err)
+	}
+	if verified != c.stats.Nodes {
+		return nil, fmt.Errorf("trie::CloneState: destination: %d nodes verified, %d copied", verified, c.stats.Nodes)
+	}
+	return &c.stats, nil
+}
+
+type stateCloner struct {
+	codec     Codec
+	model     CommitmentModel
+	trieOpt   Options
+	srcNodes  KVStore
+	srcValues KVStore
+	dstNodes  KVStore
+	dstValues KVStore
+	stats     CloneStats
+}
+
+// copyNode verifies the node and its subtree in the source store and copies them to the destination
+func (c *stateCloner) copyNode(unpackedKey []byte, expected VCommitment) error {
+	n, err := readVerifiedNode(c.codec, c.srcNodes, c.model, c.srcValues, unpackedKey, expected)
+	if err != nil {
+		return err
+	}
+	encodedKey := mustEncodeUnpackedBytes(unpackedKey, c.model.PathArity())
+	nodeBin := c.srcNodes.Get(encodedKey)
+	c.dstNodes.Set(encodedKey, nodeBin)
+	c.stats.Nodes++
+	c.stats.NodeBytes += len(encodedKey) + len(nodeBin)
+	if n.Terminal() != nil {
+		if err = c.copyValue(Concat(n.Key(), n.PathFragment()), n.Terminal()); err != nil {
+			return err
+		}
+	}
+	for i, ch := range n.ChildCommitments() {
+		if err = c.copyNode(childKey(n, i), ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyValue verifies the value of the key against the terminal and copies it. Key commitments and terminals of keys
+// updated with UpdateWithTerminal may have no value
+func (c *stateCloner) copyValue(unpackedKey []byte, terminal TCommitment) error {
+	key, err := PackUnpackedBytes(unpackedKey, c.model.PathArity())
+	if err != nil {
+		return err
+	}
+	value := c.srcValues.Get(key)
+	if value == nil {
+		return nil
+	}
+	if t := commitToValueWithOptions(c.model, c.trieOpt, key, value); t == nil || !c.model.EqualCommitments(t, terminal) {
+		return fmt.Errorf("value of the key '%x' does not match the terminal", key)
+	}
+	c.dstValues.Set(key, value)
+	c.stats.Values++
+	c.stats.ValueBytes += len(key) + len(value)
+	return nil
+}
+
+// verifyNode reads the node and its subtree back from the destination and verifies them against the commitment.
+// Returns number of verified nodes
+func (c *stateCloner) verifyNode(unpackedKey []byte, expected VCommitment) (int, error) {
+	n, err := readVerifiedNode(c.codec, c.dstNodes, c.model, c.dstValues, unpackedKey, expected)
+	if err != nil {
+		return 0, err
+	}
+	ret := 1
+	for i, ch := range n.ChildCommitments() {
+		count, err := c.verifyNode(childKey(n, i), ch)
+		if err != nil {
+			return 0, err
+		}
+		ret += count
+	}
+	return ret, nil
+}
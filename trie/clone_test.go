@@ -0,0 +1,87 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneState(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("clone state"+tn(m), func(t *testing.T) {
+			data := genData2()[:300]
+			store := trie.NewInMemoryKVStore()
+			layout := trie.DefaultStoreLayout
+			values := layout.ValueStore(store)
+			tr := trie.NewWithLayout(m, store, layout, trie.Options{})
+			for _, s := range data {
+				if len(s) > 0 {
+					tr.UpdateStr(s, s+"-value-which-is-longer-than-the-hash")
+					values.Set([]byte(s), []byte(s+"-value-which-is-longer-than-the-hash"))
+				}
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+			// the garbage of the previous version is not cloned
+			for i, s := range data {
+				if len(s) > 0 && i%3 == 0 {
+					tr.DeleteStr(s)
+				}
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+			root := trie.RootCommitment(tr)
+			layout.MetadataStore(store).Set([]byte("meta"), []byte("data"))
+
+			dst := trie.NewInMemoryKVStore()
+			stats, err := trie.CloneState(store, dst, m, root)
+			require.NoError(t, err)
+			t.Logf("%s", stats)
+			garbage, err := trie.GarbageReport(dst, m, []trie.VCommitment{root})
+			require.NoError(t, err)
+			require.EqualValues(t, 0, garbage.GarbageBytes())
+			require.EqualValues(t, stats.Nodes, garbage.TotalNodes)
+			require.EqualValues(t, stats.Values, garbage.TotalValues)
+			require.EqualValues(t, stats.NodeBytes+stats.ValueBytes, garbage.TotalNodeBytes+garbage.TotalValueBytes)
+
+			trDst := trie.NewWithLayout(m, dst, layout, trie.Options{})
+			require.True(t, m.EqualCommitments(root, trie.RootCommitment(trDst)))
+			require.EqualValues(t, 0, len(trDst.Reconcile(layout.ValueStore(dst))))
+
+			_, err = trie.CloneState(store, dst, m, root)
+			require.Error(t, err)
+
+			stats, err = trie.CloneState(store, trie.NewInMemoryKVStore(), m, nil)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, stats.Nodes)
+
+			// the corrupted value is detected
+			key := []byte(data[1])
+			original := values.Get(key)
+			values.Set(key, []byte("corrupted-value-which-is-longer-than-the-hash"))
+			_, err = trie.CloneState(store, trie.NewInMemoryKVStore(), m, root)
+			require.Error(t, err)
+			values.Set(key, original)
+			_, err = trie.CloneState(store, trie.NewInMemoryKVStore(), m, root)
+			require.NoError(t, err)
+
+			// the corrupted node is detected
+			layout.NodeStore(store).Iterate(func(k, v []byte) bool {
+				if len(k) > 1 {
+					layout.NodeStore(store).Set(k, nil)
+					return false
+				}
+				return true
+			})
+			_, err = trie.CloneState(store, trie.NewInMemoryKVStore(), m, root)
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
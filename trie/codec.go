@@ -0,0 +1,374 @@
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Codec is the serialization of nodes in the node store. The codec is selected at the construction of the trie
+// (see Options.Codec) and must be the same for all readers and writers of the node store.
+// Commitments do not depend on the codec
+type Codec interface {
+	// Name is the name of the encoding
+	Name() string
+	// WriteNode serializes the node. If isKeyCommitment is true, the terminal is the commitment to the key of the node and
+	// is not serialized. If skipTerminal is true, the terminal is the commitment to the value in the value store and
+	// is not serialized
+	WriteNode(w io.Writer, n *NodeData, arity PathArity, isKeyCommitment, skipTerminal bool) error
+	// ReadNode deserializes the node with the key. The terminal, which is not serialized, is restored from the key
+	// or from the value store
+	ReadNode(r io.Reader, n *NodeData, model CommitmentModel, unpackedKey []byte, arity PathArity, valueStore KVReader) error
+}
+
+var (
+	// BinaryCodec is the default compact binary encoding of nodes (see NodeData.Write)
+	BinaryCodec Codec = binaryCodec{}
+	// CBORCodec encodes nodes as canonical CBOR (RFC 8949, core deterministic encoding)
+	CBORCodec Codec = cborCodec{}
+)
+
+func codecOrDefault(codec ...Codec) Codec {
+	if len(codec) == 0 || codec[0] == nil {
+		return BinaryCodec
+	}
+	return codec[0]
+}
+
+// NodeDataFromBytesWithCodec deserializes node data encoded with the codec
+func NodeDataFromBytesWithCodec(codec Codec, model CommitmentModel, data, unpackedKey []byte, arity PathArity, valueStore KVReader) (*NodeData, error) {
+	ret := NewNodeData()
+	rdr := getReader(data)
+	defer putReader(rdr)
+	if err := codec.ReadNode(rdr, ret, model, unpackedKey, arity, valueStore); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		// not all data was consumed
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return "binary"
+}
+
+func (binaryCodec) WriteNode(w io.Writer, n *NodeData, arity PathArity, isKeyCommitment, skipTerminal bool) error {
+	return n.Write(w, arity, isKeyCommitment, skipTerminal)
+}
+
+func (binaryCodec) ReadNode(r io.Reader, n *NodeData, model CommitmentModel, unpackedKey []byte, arity PathArity, valueStore KVReader) error {
+	return n.Read(r, model, unpackedKey, arity, valueStore)
+}
+
+// cborCodec encodes the node as the CBOR map with unsigned integer keys:
+// - cborKeyFlags: flags of the node, the same as in the binary encoding
+// - cborKeyPathFragment: byte string of the encoded path fragment, if not empty
+// - cborKeyTerminal: byte string of the terminal commitment, if it is stored with the node
+// - cborKeyChildren: map of child indices to byte strings of child commitments, if the node has children
+// Only the canonical encoding is accepted: the shortest form of heads, keys in the ascending order, no other keys
+type cborCodec struct{}
+
+const (
+	cborKeyFlags = iota
+	cborKeyPathFragment
+	cborKeyTerminal
+	cborKeyChildren
+)
+
+const (
+	cborMajorUint  = 0
+	cborMajorBytes = 2
+	cborMajorMap   = 5
+)
+
+var errCBORNotCanonical = errors.New("not canonical CBOR encoding of the node")
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) WriteNode(w io.Writer, n *NodeData, arity PathArity, isKeyCommitment, skipTerminal bool) error {
+	smallFlags, pathFragmentEncoded, err := n.flags(arity, isKeyCommitment, skipTerminal)
+	if err != nil {
+		return err
+	}
+	storeTerminal := smallFlags&terminalExistsFlag != 0 &&
+		smallFlags&(takeTerminalFromKeyFlag|takeTerminalFromValueFlag) == 0
+	numFields := 1
+	if smallFlags&serializePathFragmentFlag != 0 {
+		numFields++
+	}
+	if storeTerminal {
+		numFields++
+	}
+	if smallFlags&serializeChildrenFlag != 0 {
+		numFields++
+	}
+	if err = cborWriteHead(w, cborMajorMap, uint64(numFields)); err != nil {
+		return err
+	}
+	if err = cborWriteUint(w, cborKeyFlags, uint64(smallFlags)); err != nil {
+		return err
+	}
+	if smallFlags&serializePathFragmentFlag != 0 {
+		if err = cborWriteBytesField(w, cborKeyPathFragment, pathFragmentEncoded); err != nil {
+			return err
+		}
+	}
+	if storeTerminal {
+		if err = cborWriteBytesField(w, cborKeyTerminal, n.Terminal.Bytes()); err != nil {
+			return err
+		}
+	}
+	if smallFlags&serializeChildrenFlag == 0 {
+		return nil
+	}
+	if err = cborWriteHead(w, cborMajorUint, cborKeyChildren); err != nil {
+		return err
+	}
+	if err = cborWriteHead(w, cborMajorMap, uint64(len(n.ChildCommitments))); err != nil {
+		return err
+	}
+	for i := 0; i < int(arity)+1; i++ {
+		child, ok := n.ChildCommitments[uint8(i)]
+		if !ok {
+			continue
+		}
+		if err = cborWriteBytesField(w, uint64(i), child.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cborCodec) ReadNode(r io.Reader, n *NodeData, model CommitmentModel, unpackedKey []byte, arity PathArity, valueStore KVReader) error {
+	numFields, err := cborReadHead(r, cborMajorMap)
+	if err != nil {
+		return err
+	}
+	if numFields == 0 {
+		return errCBORNotCanonical
+	}
+	flags, err := cborReadUint(r, cborKeyFlags)
+	if err != nil {
+		return err
+	}
+	if flags > 0xFF || flags&^(terminalExistsFlag|takeTerminalFromValueFlag|takeTerminalFromKeyFlag|serializeChildrenFlag|serializePathFragmentFlag) != 0 {
+		return fmt.Errorf("wrong flags %x", flags)
+	}
+	smallFlags := byte(flags)
+	storeTerminal := smallFlags&terminalExistsFlag != 0 &&
+		smallFlags&(takeTerminalFromKeyFlag|takeTerminalFromValueFlag) == 0
+	expectedFields := uint64(1)
+	n.PathFragment = nil
+	if smallFlags&serializePathFragmentFlag != 0 {
+		expectedFields++
+		encoded, err := cborReadBytesField(r, cborKeyPathFragment)
+		if err != nil {
+			return err
+		}
+		if n.PathFragment, err = DecodeToUnpackedBytes(encoded, arity); err != nil {
+			return err
+		}
+	}
+	n.Terminal = nil
+	if storeTerminal {
+		expectedFields++
+		data, err := cborReadBytesField(r, cborKeyTerminal)
+		if err != nil {
+			return err
+		}
+		n.Terminal = model.NewTerminalCommitment()
+		if err = readAllFrom(n.Terminal, data); err != nil {
+			return err
+		}
+	} else if err = n.restoreTerminal(smallFlags, model, unpackedKey, arity, valueStore); err != nil {
+		return err
+	}
+	if smallFlags&serializeChildrenFlag != 0 {
+		expectedFields++
+		if err = cborReadKey(r, cborKeyChildren); err != nil {
+			return err
+		}
+		numChildren, err := cborReadHead(r, cborMajorMap)
+		if err != nil {
+			return err
+		}
+		if numChildren == 0 || numChildren > uint64(arity)+1 {
+			return errCBORNotCanonical
+		}
+		prev := -1
+		for i := uint64(0); i < numChildren; i++ {
+			idx, err := cborReadHead(r, cborMajorUint)
+			if err != nil {
+				return err
+			}
+			if idx > uint64(arity) || int(idx) <= prev {
+				return errCBORNotCanonical
+			}
+			prev = int(idx)
+			data, err := cborReadBytes(r)
+			if err != nil {
+				return err
+			}
+			c := model.NewVectorCommitment()
+			if err = readAllFrom(c, data); err != nil {
+				return err
+			}
+			n.ChildCommitments[byte(idx)] = c
+		}
+	}
+	if numFields != expectedFields {
+		return errCBORNotCanonical
+	}
+	return nil
+}
+
+// readAllFrom deserializes the object from data, which must be consumed completely
+func readAllFrom(o Serializable, data []byte) error {
+	rdr := getReader(data)
+	defer putReader(rdr)
+	if err := o.Read(rdr); err != nil {
+		return err
+	}
+	if rdr.Len() != 0 {
+		return ErrNotAllBytesConsumed
+	}
+	return nil
+}
+
+// cborWriteHead writes the head of the data item in the shortest form
+func cborWriteHead(w io.Writer, major byte, arg uint64) error {
+	var buf [9]byte
+	var size int
+	switch {
+	case arg < 24:
+		buf[0] = major<<5 | byte(arg)
+		size = 1
+	case arg <= 0xFF:
+		buf[0] = major<<5 | 24
+		buf[1] = byte(arg)
+		size = 2
+	case arg <= 0xFFFF:
+		buf[0] = major<<5 | 25
+		binary.BigEndian.PutUint16(buf[1:], uint16(arg))
+		size = 3
+	case arg <= 0xFFFFFFFF:
+		buf[0] = major<<5 | 26
+		binary.BigEndian.PutUint32(buf[1:], uint32(arg))
+		size = 5
+	default:
+		buf[0] = major<<5 | 27
+		binary.BigEndian.PutUint64(buf[1:], arg)
+		size = 9
+	}
+	_, err := w.Write(buf[:size])
+	return err
+}
+
+// cborReadHead reads the head of the data item of the major type. Heads not in the shortest form are rejected
+func cborReadHead(r io.Reader, major byte) (uint64, error) {
+	b, err := ReadByte(r)
+	if err != nil {
+		return 0, err
+	}
+	if b>>5 != major {
+		return 0, fmt.Errorf("expected CBOR major type %d, got %d", major, b>>5)
+	}
+	info := b & 0x1F
+	if info < 24 {
+		return uint64(info), nil
+	}
+	var buf [8]byte
+	var ret uint64
+	var minArg uint64
+	switch info {
+	case 24:
+		if _, err = io.ReadFull(r, buf[:1]); err != nil {
+			return 0, err
+		}
+		ret, minArg = uint64(buf[0]), 24
+	case 25:
+		if _, err = io.ReadFull(r, buf[:2]); err != nil {
+			return 0, err
+		}
+		ret, minArg = uint64(binary.BigEndian.Uint16(buf[:2])), 0x100
+	case 26:
+		if _, err = io.ReadFull(r, buf[:4]); err != nil {
+			return 0, err
+		}
+		ret, minArg = uint64(binary.BigEndian.Uint32(buf[:4])), 0x10000
+	case 27:
+		if _, err = io.ReadFull(r, buf[:]); err != nil {
+			return 0, err
+		}
+		ret, minArg = binary.BigEndian.Uint64(buf[:]), 0x100000000
+	default:
+		// indefinite length and reserved values are not canonical
+		return 0, errCBORNotCanonical
+	}
+	if ret < minArg {
+		return 0, errCBORNotCanonical
+	}
+	return ret, nil
+}
+
+func cborWriteUint(w io.Writer, key, value uint64) error {
+	if err := cborWriteHead(w, cborMajorUint, key); err != nil {
+		return err
+	}
+	return cborWriteHead(w, cborMajorUint, value)
+}
+
+// cborReadKey reads the key of the map and checks if it is the expected one
+func cborReadKey(r io.Reader, key uint64) error {
+	k, err := cborReadHead(r, cborMajorUint)
+	if err != nil {
+		return err
+	}
+	if k != key {
+		return errCBORNotCanonical
+	}
+	return nil
+}
+
+func cborReadUint(r io.Reader, key uint64) (uint64, error) {
+	if err := cborReadKey(r, key); err != nil {
+		return 0, err
+	}
+	return cborReadHead(r, cborMajorUint)
+}
+
+func cborWriteBytesField(w io.Writer, key uint64, data []byte) error {
+	if err := cborWriteHead(w, cborMajorUint, key); err != nil {
+		return err
+	}
+	if err := cborWriteHead(w, cborMajorBytes, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func cborReadBytesField(r io.Reader, key uint64) ([]byte, error) {
+	if err := cborReadKey(r, key); err != nil {
+		return nil, err
+	}
+	return cborReadBytes(r)
+}
+
+func cborReadBytes(r io.Reader) ([]byte, error) {
+	size, err := cborReadHead(r, cborMajorBytes)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0xFFFF {
+		return nil, errors.New("CBOR byte string is too long")
+	}
+	return readExact(r, int(size))
+}
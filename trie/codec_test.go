@@ -0,0 +1,96 @@
+package trie_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeCodec(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("cbor codec"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			binStore, cborStore, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			bin := trie.New(m, binStore, valueStore, true)
+			tr := trie.NewWithOptions(m, cborStore, valueStore, trie.Options{OptimizeKeyCommitments: true, Codec: trie.CBORCodec})
+			require.EqualValues(t, "cbor", tr.Stats().Codec)
+			for i, s := range data {
+				if i%10 == 0 && len(s) > 0 {
+					bin.InsertKeyCommitment([]byte(s))
+					tr.InsertKeyCommitment([]byte(s))
+					continue
+				}
+				v := []byte(s + "-value")
+				bin.Update([]byte(s), v)
+				tr.Update([]byte(s), v)
+				valueStore.Set([]byte(s), v)
+			}
+			bin.Commit()
+			bin.PersistMutations(binStore)
+			tr.Commit()
+			tr.PersistMutations(cborStore)
+			tr.ClearCache()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(bin), trie.RootCommitment(tr)))
+			require.EqualValues(t, snapshotKeys(t, bin), snapshotKeys(t, tr))
+
+			// same nodes, different encoding
+			binNodes, cborNodes := storeContents(binStore), storeContents(cborStore)
+			require.EqualValues(t, len(binNodes), len(cborNodes))
+			for k, v := range binNodes {
+				require.NotEqualValues(t, v, cborNodes[k])
+				n, err := trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, []byte(cborNodes[k]), nil, m.PathArity(), valueStore)
+				if err != nil {
+					// the node may need its key to restore the terminal
+					continue
+				}
+				var buf bytes.Buffer
+				require.NoError(t, trie.CBORCodec.WriteNode(&buf, n, m.PathArity(), false, false))
+				back, err := trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, buf.Bytes(), nil, m.PathArity(), nil)
+				require.NoError(t, err)
+				require.True(t, m.EqualCommitments(m.CalcNodeCommitment(n), m.CalcNodeCommitment(back)))
+			}
+
+			reader := trie.NewTrieReader(m, cborStore, valueStore, trie.CBORCodec)
+			require.EqualValues(t, "cbor", reader.Stats().Codec)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(bin), trie.RootCommitment(reader)))
+			require.Panics(t, func() {
+				trie.RootCommitment(trie.NewTrieReader(m, cborStore, valueStore))
+			})
+		})
+		t.Run("cbor malformed"+tn(m), func(t *testing.T) {
+			n := trie.NewNodeData()
+			n.PathFragment = trie.UnpackBytes([]byte("kuku"), m.PathArity())
+			n.Terminal = m.CommitToData(trie.UnpackBytes([]byte("data"), m.PathArity()))
+			n.ChildCommitments[1] = m.CalcNodeCommitment(&trie.NodeData{Terminal: n.Terminal})
+			var buf bytes.Buffer
+			require.NoError(t, trie.CBORCodec.WriteNode(&buf, n, m.PathArity(), false, false))
+			encoded := buf.Bytes()
+			back, err := trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, encoded, nil, m.PathArity(), nil)
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(m.CalcNodeCommitment(n), m.CalcNodeCommitment(back)))
+
+			for i := 0; i < len(encoded); i++ {
+				_, err = trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, encoded[:i], nil, m.PathArity(), nil)
+				require.Error(t, err)
+			}
+			_, err = trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, append(encoded, 0), nil, m.PathArity(), nil)
+			require.Error(t, err)
+			// the number of fields in the non-shortest form
+			_, err = trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, append([]byte{0xb8, encoded[0] & 0x1f}, encoded[1:]...), nil, m.PathArity(), nil)
+			require.Error(t, err)
+			// binary encoding is not accepted
+			buf.Reset()
+			require.NoError(t, n.Write(&buf, m.PathArity(), false, false))
+			_, err = trie.NodeDataFromBytesWithCodec(trie.CBORCodec, m, buf.Bytes(), nil, m.PathArity(), nil)
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
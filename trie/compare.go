@@ -0,0 +1,167 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// DivergenceKind is a kind of the structural difference between two tries
+type DivergenceKind byte
+
+const (
+	// DivergenceMissingInA the node is present in the trie B but not in the trie A
+	DivergenceMissingInA = DivergenceKind(iota)
+	// DivergenceMissingInB the node is present in the trie A but not in the trie B
+	DivergenceMissingInB
+	// DivergencePathFragment nodes have different path fragments, so subtries below are not comparable
+	DivergencePathFragment
+	// DivergenceTerminal nodes have different terminal commitments, i.e. the key has different values
+	DivergenceTerminal
+)
+
+func (k DivergenceKind) String() string {
+	switch k {
+	case DivergenceMissingInA:
+		return "missing in A"
+	case DivergenceMissingInB:
+		return "missing in B"
+	case DivergencePathFragment:
+		return "path fragment"
+	case DivergenceTerminal:
+		return "terminal"
+	}
+	return "unknown"
+}
+
+// Divergence is a difference between two tries at the node with the unpacked key.
+// Fields related to the missing node are nil
+type Divergence struct {
+	Kind          DivergenceKind
+	UnpackedKey   []byte
+	CommitmentA   VCommitment
+	CommitmentB   VCommitment
+	PathFragmentA []byte
+	PathFragmentB []byte
+	TerminalA     TCommitment
+	TerminalB     TCommitment
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("divergence(%s, key: '%s', commitments: %s / %s, path fragments: '%s' / '%s', terminals: %s / %s)",
+		d.Kind,
+		hex.EncodeToString(d.UnpackedKey),
+		serializableString(d.CommitmentA), serializableString(d.CommitmentB),
+		hex.EncodeToString(d.PathFragmentA), hex.EncodeToString(d.PathFragmentB),
+		serializableString(d.TerminalA), serializableString(d.TerminalB),
+	)
+}
+
+func serializableString(s interface{ String() string }) string {
+	if isNil, _ := CheckNils(s, s); isNil {
+		return "nil"
+	}
+	return s.String()
+}
+
+// CompareTries compares two tries top-down and reports the divergent nodes. Subtries with equal commitments are
+// skipped, so only the topmost nodes where the tries diverge are reported, in the depth-first order.
+// It is intended to debug the mismatch of roots of two tries which are supposed to commit to the same state.
+// Both tries must use the same commitment model. maxReports limits number of returned divergences, 0 means no limit.
+// Returns nil if tries are equal
+func CompareTries(a, b NodeStore, maxReports int) []*Divergence {
+	Assert(a.Model().ShortName() == b.Model().ShortName(), "trie::CompareTries: different commitment models: '%s' and '%s'",
+		a.Model().ShortName(), b.Model().ShortName())
+	c := &trieComparator{
+		a:          a,
+		b:          b,
+		m:          a.Model(),
+		maxReports: maxReports,
+	}
+	c.compareNodes(nil)
+	return c.ret
+}
+
+type trieComparator struct {
+	a, b       NodeStore
+	m          CommitmentModel
+	maxReports int
+	ret        []*Divergence
+}
+
+func (c *trieComparator) done() bool {
+	return c.maxReports > 0 && len(c.ret) >= c.maxReports
+}
+
+func (c *trieComparator) report(kind DivergenceKind, unpackedKey []byte, nA, nB Node) {
+	d := &Divergence{
+		Kind:        kind,
+		UnpackedKey: unpackedKey,
+	}
+	if nA != nil {
+		d.CommitmentA = nodeCommitment(c.m, nA)
+		d.PathFragmentA = nA.PathFragment()
+		d.TerminalA = nA.Terminal()
+	}
+	if nB != nil {
+		d.CommitmentB = nodeCommitment(c.m, nB)
+		d.PathFragmentB = nB.PathFragment()
+		d.TerminalB = nB.Terminal()
+	}
+	c.ret = append(c.ret, d)
+}
+
+func (c *trieComparator) compareNodes(unpackedKey []byte) {
+	if c.done() {
+		return
+	}
+	nA, okA := c.a.GetNode(unpackedKey)
+	nB, okB := c.b.GetNode(unpackedKey)
+	switch {
+	case !okA && !okB:
+		return
+	case !okA:
+		c.report(DivergenceMissingInA, unpackedKey, nil, nB)
+		return
+	case !okB:
+		c.report(DivergenceMissingInB, unpackedKey, nA, nil)
+		return
+	}
+	if c.m.EqualCommitments(nodeCommitment(c.m, nA), nodeCommitment(c.m, nB)) {
+		return
+	}
+	if !bytes.Equal(nA.PathFragment(), nB.PathFragment()) {
+		c.report(DivergencePathFragment, unpackedKey, nA, nB)
+		return
+	}
+	if !c.m.EqualCommitments(nA.Terminal(), nB.Terminal()) {
+		c.report(DivergenceTerminal, unpackedKey, nA, nB)
+	}
+	childrenA := nA.ChildCommitments()
+	childrenB := nB.ChildCommitments()
+	indices := make([]int, 0, len(childrenA)+len(childrenB))
+	for i := range childrenA {
+		indices = append(indices, int(i))
+	}
+	for i := range childrenB {
+		if _, ok := childrenA[i]; !ok {
+			indices = append(indices, int(i))
+		}
+	}
+	sort.Ints(indices)
+	for _, i := range indices {
+		if c.m.EqualCommitments(childrenA[byte(i)], childrenB[byte(i)]) {
+			continue
+		}
+		c.compareNodes(childKey(nA, byte(i)))
+	}
+}
+
+func nodeCommitment(m CommitmentModel, n Node) VCommitment {
+	return m.CalcNodeCommitment(&NodeData{
+		PathFragment:     n.PathFragment(),
+		ChildCommitments: n.ChildCommitments(),
+		Terminal:         n.Terminal(),
+	})
+}
@@ -0,0 +1,54 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareTries(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("compare tries"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			storeA := trie.NewInMemoryKVStore()
+			trA := trie.New(m, storeA, nil)
+			storeB := trie.NewInMemoryKVStore()
+			trB := trie.New(m, storeB, nil)
+			for _, s := range data {
+				trA.UpdateStr(s, s+"$")
+				trB.UpdateStr(s, s+"$")
+			}
+			trA.Commit()
+			trB.Commit()
+			trA.PersistMutations(storeA)
+			trB.PersistMutations(storeB)
+			rdrA := trie.NewTrieReader(m, storeA, nil)
+			rdrB := trie.NewTrieReader(m, storeB, nil)
+			require.Nil(t, trie.CompareTries(rdrA, rdrB, 0))
+
+			trB.UpdateStr(data[0], "different value")
+			trB.Commit()
+			trB.PersistMutations(storeB)
+			diff := trie.CompareTries(rdrA, rdrB, 0)
+			require.EqualValues(t, 1, len(diff))
+			require.EqualValues(t, trie.DivergenceTerminal, diff[0].Kind)
+			require.True(t, m.EqualCommitments(m.CommitToData([]byte(data[0]+"$")), diff[0].TerminalA))
+			require.True(t, m.EqualCommitments(m.CommitToData([]byte("different value")), diff[0].TerminalB))
+			t.Logf("%s", diff[0])
+
+			const extraKey = "extra key which is not in the trie A"
+			trB.UpdateStr(extraKey, "value")
+			trB.Commit()
+			trB.PersistMutations(storeB)
+			diff = trie.CompareTries(rdrA, rdrB, 0)
+			require.True(t, len(diff) >= 2)
+			require.EqualValues(t, 1, len(trie.CompareTries(rdrA, rdrB, 1)))
+			require.EqualValues(t, len(diff), len(trie.CompareTries(rdrB, rdrA, 0)))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,49 @@
+package trie
+
+import "sync"
+
+// concurrentNodeStore is a NodeStore wrapper which caches nodes and is safe for concurrent use
+type concurrentNodeStore struct {
+	NodeStore
+	mutexStore sync.Mutex
+	mutexCache sync.RWMutex
+	cache      map[string]Node
+	missing    map[string]struct{}
+}
+
+// NewConcurrentNodeStore wraps NodeStore into the cached NodeStore which is safe for concurrent reads,
+// even if the underlying NodeStore is not (for example, Trie). Each node is read from the underlying store only once.
+// The underlying NodeStore must not be mutated while the wrapper is in use
+func NewConcurrentNodeStore(tr NodeStore) NodeStore {
+	return &concurrentNodeStore{
+		NodeStore: tr,
+		cache:     make(map[string]Node),
+		missing:   make(map[string]struct{}),
+	}
+}
+
+func (c *concurrentNodeStore) GetNode(unpackedKey []byte) (Node, bool) {
+	c.mutexCache.RLock()
+	n, ok := c.cache[string(unpackedKey)]
+	_, isMissing := c.missing[string(unpackedKey)]
+	c.mutexCache.RUnlock()
+	if ok {
+		return n, true
+	}
+	if isMissing {
+		return nil, false
+	}
+
+	c.mutexStore.Lock()
+	n, ok = c.NodeStore.GetNode(unpackedKey)
+	c.mutexStore.Unlock()
+
+	c.mutexCache.Lock()
+	defer c.mutexCache.Unlock()
+	if ok {
+		c.cache[string(unpackedKey)] = n
+	} else {
+		c.missing[string(unpackedKey)] = struct{}{}
+	}
+	return n, ok
+}
@@ -0,0 +1,109 @@
+package trie
+
+import (
+	"bytes"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// dedupStore is the content-addressed KVStore of trie nodes. Identical nodes (i.e. with the same serialized bytes)
+// are stored once, keyed by the digest of the bytes, with the reference count. The path of the node in the trie
+// is mapped to the digest. Nodes not longer than the digest are stored under the path directly.
+// Layout of the underlying store:
+// - dedupPathPrefix + key -> dedupInline + node bytes, or dedupRef + digest
+// - dedupBlobPrefix + digest -> 4 bytes of the reference count (little-endian) + node bytes
+type dedupStore struct {
+	store KVStore
+}
+
+const (
+	dedupPathPrefix = byte(iota)
+	dedupBlobPrefix
+)
+
+const (
+	dedupInline = byte(iota)
+	dedupRef
+)
+
+// NewDedupNodeStore creates the trie store which deduplicates identical nodes on top of the store. It sharply reduces
+// the storage of tries with many repeated subtrees, for example sparse account tries with default values,
+// at the cost of one more read per node. The store must be used only through the wrapper, which, like the store
+// itself, is not safe for concurrent writes
+func NewDedupNodeStore(store KVStore) KVStore {
+	return &dedupStore{store: store}
+}
+
+func (d *dedupStore) Get(key []byte) []byte {
+	return d.resolve(d.store.Get(Concat(dedupPathPrefix, key)))
+}
+
+func (d *dedupStore) resolve(ref []byte) []byte {
+	if len(ref) == 0 {
+		return nil
+	}
+	if ref[0] == dedupInline {
+		return ref[1:]
+	}
+	blob := d.store.Get(Concat(dedupBlobPrefix, ref[1:]))
+	Assert(len(blob) > 4, "trie::dedupStore: missing node with the digest %x", ref[1:])
+	return blob[4:]
+}
+
+func (d *dedupStore) Has(key []byte) bool {
+	return d.store.Has(Concat(dedupPathPrefix, key))
+}
+
+func (d *dedupStore) Set(key, value []byte) {
+	pathKey := Concat(dedupPathPrefix, key)
+	prev := d.store.Get(pathKey)
+	var ref []byte
+	switch {
+	case len(value) == 0:
+	case len(value) <= blake2b.Size256:
+		ref = Concat(dedupInline, value)
+	default:
+		digest := blake2b.Sum256(value)
+		ref = Concat(dedupRef, digest[:])
+	}
+	if bytes.Equal(prev, ref) {
+		return
+	}
+	if len(ref) > 0 && ref[0] == dedupRef {
+		d.addRef(ref[1:], value)
+	}
+	d.store.Set(pathKey, ref)
+	if len(prev) > 0 && prev[0] == dedupRef {
+		d.releaseRef(prev[1:])
+	}
+}
+
+// addRef increments the reference count of the node, the node is stored with the first reference
+func (d *dedupStore) addRef(digest, value []byte) {
+	blobKey := Concat(dedupBlobPrefix, digest)
+	blob := d.store.Get(blobKey)
+	if len(blob) == 0 {
+		d.store.Set(blobKey, Concat(Uint32To4Bytes(1), value))
+		return
+	}
+	d.store.Set(blobKey, Concat(Uint32To4Bytes(MustUint32From4Bytes(blob[:4])+1), blob[4:]))
+}
+
+// releaseRef decrements the reference count of the node, the node is deleted with the last reference
+func (d *dedupStore) releaseRef(digest []byte) {
+	blobKey := Concat(dedupBlobPrefix, digest)
+	blob := d.store.Get(blobKey)
+	Assert(len(blob) > 4, "trie::dedupStore: missing node with the digest %x", digest)
+	refs := MustUint32From4Bytes(blob[:4])
+	if refs <= 1 {
+		d.store.Set(blobKey, nil)
+		return
+	}
+	d.store.Set(blobKey, Concat(Uint32To4Bytes(refs-1), blob[4:]))
+}
+
+func (d *dedupStore) Iterate(fun func(k, v []byte) bool) {
+	IteratePrefix(d.store, []byte{dedupPathPrefix}, func(k, v []byte) bool {
+		return fun(k[1:], d.resolve(v))
+	})
+}
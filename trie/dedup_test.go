@@ -0,0 +1,79 @@
+package trie_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupNodeStore(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("dedup"+tn(m), func(t *testing.T) {
+			// accounts with the same default storage
+			keys := make([]string, 0)
+			for i := 0; i < 100; i++ {
+				for j := 0; j < 20; j++ {
+					keys = append(keys, fmt.Sprintf("account%03d/slot%02d", i, j))
+				}
+			}
+			plainStore := trie.NewInMemoryKVStore()
+			plain := trie.New(m, plainStore, nil)
+			underlying := trie.NewInMemoryKVStore()
+			dedupStore := trie.NewDedupNodeStore(underlying)
+			tr := trie.New(m, dedupStore, nil)
+			for _, k := range keys {
+				v := "default value of the storage slot " + k[len(k)-2:]
+				plain.UpdateStr(k, v)
+				tr.UpdateStr(k, v)
+			}
+			plain.Commit()
+			plain.PersistMutations(plainStore)
+			tr.Commit()
+			tr.PersistMutations(dedupStore)
+			tr.ClearCache()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(plain), trie.RootCommitment(tr)))
+			require.EqualValues(t, storeContents(plainStore), storeContents(dedupStore))
+			require.True(t, trie.ByteSize(underlying) < trie.ByteSize(plainStore),
+				"dedup: %d bytes, plain: %d bytes", trie.ByteSize(underlying), trie.ByteSize(plainStore))
+			// nodes of accounts are shared
+			blobs := trie.NumEntries(trie.NewPartition(underlying, []byte{1}))
+			require.True(t, blobs < trie.NumEntries(plainStore)/10, "blobs: %d, nodes: %d", blobs, trie.NumEntries(plainStore))
+
+			reader := trie.NewTrieReader(m, dedupStore, nil)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(plain), trie.RootCommitment(reader)))
+			require.EqualValues(t, len(keys), len(snapshotKeys(t, reader)))
+
+			// the shared node survives deletion of some of its references
+			for i, k := range keys {
+				if i%3 != 0 {
+					plain.DeleteStr(k)
+					tr.DeleteStr(k)
+				}
+			}
+			plain.Commit()
+			plain.PersistMutations(plainStore)
+			tr.Commit()
+			tr.PersistMutations(dedupStore)
+			tr.ClearCache()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(plain), trie.RootCommitment(tr)))
+			require.EqualValues(t, storeContents(plainStore), storeContents(dedupStore))
+
+			// no nodes are left after all keys are deleted
+			for _, k := range keys {
+				tr.DeleteStr(k)
+			}
+			tr.Commit()
+			tr.PersistMutations(dedupStore)
+			require.Nil(t, trie.RootCommitment(tr))
+			require.EqualValues(t, 0, trie.NumEntries(underlying))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+	runTest(t, trie_kzg_bn256.New())
+}
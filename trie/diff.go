@@ -0,0 +1,147 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// diffStreamVersion is the first byte of the diff stream. Records of the stream follow in the BinaryStreamWriter format
+const diffStreamVersion = 0x01
+
+// WriteDiff writes the difference between trie nodes of two states to the stream. Applying the stream to the node store
+// of the state 'from' with ApplyDiff turns it into the node store of the state 'to'. The stream consists of node writes
+// and node deletions (records with empty value) in the order of encoded node keys.
+// Subtries with equal commitments are skipped, so the size of the stream is proportional to the difference.
+// Both states must use the same commitment model and trie options. Values of the state are not included.
+// Returns number of records written
+func WriteDiff(w io.Writer, from, to *TrieReader) (int, error) {
+	Assert(from.Model().ShortName() == to.Model().ShortName(), "trie::WriteDiff: different commitment models: '%s' and '%s'",
+		from.Model().ShortName(), to.Model().ShortName())
+	d := &trieDiff{
+		from:    from,
+		to:      to,
+		m:       from.Model(),
+		writes:  make(map[string][]byte),
+		deletes: make(map[string]struct{}),
+	}
+	d.diffNodes(nil)
+	// a node removed from one place may exist in the target state at another place of the trie
+	for k := range d.deletes {
+		if _, ok := d.writes[k]; ok {
+			delete(d.deletes, k)
+			continue
+		}
+		if data := to.reader.trieStore.Get([]byte(k)); len(data) > 0 {
+			delete(d.deletes, k)
+			if !bytes.Equal(data, from.reader.trieStore.Get([]byte(k))) {
+				d.writes[k] = data
+			}
+		}
+	}
+	keys := make([]string, 0, len(d.writes)+len(d.deletes))
+	for k := range d.writes {
+		keys = append(keys, k)
+	}
+	for k := range d.deletes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if err := WriteByte(w, diffStreamVersion); err != nil {
+		return 0, err
+	}
+	sw := NewBinaryStreamWriter(w)
+	for _, k := range keys {
+		if err := sw.Write([]byte(k), d.writes[k]); err != nil {
+			return 0, err
+		}
+	}
+	n, _ := sw.Stats()
+	return n, nil
+}
+
+// ApplyDiff applies the diff stream written by WriteDiff to the node store. Returns number of applied records
+func ApplyDiff(r io.Reader, trieStore KVWriter) (int, error) {
+	v, err := ReadByte(r)
+	if err != nil {
+		return 0, err
+	}
+	if v != diffStreamVersion {
+		return 0, fmt.Errorf("trie::ApplyDiff: unsupported diff stream version %d", v)
+	}
+	ret := 0
+	err = NewBinaryStreamIterator(r).Iterate(func(k, v []byte) bool {
+		if len(v) == 0 {
+			v = nil
+		}
+		trieStore.Set(k, v)
+		ret++
+		return true
+	})
+	return ret, err
+}
+
+type trieDiff struct {
+	from, to *TrieReader
+	m        CommitmentModel
+	writes   map[string][]byte
+	deletes  map[string]struct{}
+}
+
+func (d *trieDiff) diffNodes(unpackedKey []byte) {
+	nFrom, okFrom := d.from.GetNode(unpackedKey)
+	nTo, okTo := d.to.GetNode(unpackedKey)
+	switch {
+	case !okFrom && !okTo:
+		return
+	case !okTo:
+		d.from.TraverseNodes(unpackedKey, func(k []byte, _ *NodeData) bool {
+			d.deletes[string(mustEncodeUnpackedBytes(k, d.m.PathArity()))] = struct{}{}
+			return true
+		})
+		return
+	case !okFrom:
+		d.to.TraverseNodes(unpackedKey, func(k []byte, _ *NodeData) bool {
+			d.addWrite(k)
+			return true
+		})
+		return
+	}
+	if d.m.EqualCommitments(nodeCommitment(d.m, nFrom), nodeCommitment(d.m, nTo)) {
+		return
+	}
+	d.addWrite(unpackedKey)
+	childrenFrom := make(map[string]struct{})
+	for i := range nFrom.ChildCommitments() {
+		childrenFrom[string(childKey(nFrom, i))] = struct{}{}
+	}
+	childrenTo := make(map[string]struct{})
+	for i := range nTo.ChildCommitments() {
+		childrenTo[string(childKey(nTo, i))] = struct{}{}
+	}
+	for k := range childrenFrom {
+		if _, ok := childrenTo[k]; !ok {
+			d.from.TraverseNodes([]byte(k), func(k []byte, _ *NodeData) bool {
+				d.deletes[string(mustEncodeUnpackedBytes(k, d.m.PathArity()))] = struct{}{}
+				return true
+			})
+		}
+	}
+	for k := range childrenTo {
+		if _, ok := childrenFrom[k]; ok {
+			d.diffNodes([]byte(k))
+			continue
+		}
+		d.to.TraverseNodes([]byte(k), func(k []byte, _ *NodeData) bool {
+			d.addWrite(k)
+			return true
+		})
+	}
+}
+
+func (d *trieDiff) addWrite(unpackedKey []byte) {
+	encodedKey := mustEncodeUnpackedBytes(unpackedKey, d.m.PathArity())
+	d.writes[string(encodedKey)] = d.to.reader.trieStore.Get(encodedKey)
+}
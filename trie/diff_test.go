@@ -0,0 +1,86 @@
+package trie_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteApplyDiff(t *testing.T) {
+	copyStore := func(store trie.KVStore) trie.KVStore {
+		ret := trie.NewInMemoryKVStore()
+		store.Iterate(func(k, v []byte) bool {
+			ret.Set(k, v)
+			return true
+		})
+		return ret
+	}
+	equalStores := func(s1, s2 trie.KVStore) {
+		require.EqualValues(t, trie.NumEntries(s1), trie.NumEntries(s2))
+		s1.Iterate(func(k, v []byte) bool {
+			require.EqualValues(t, v, s2.Get(k))
+			return true
+		})
+	}
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("write apply diff"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:2000]
+			storeFrom := trie.NewInMemoryKVStore()
+			tr := trie.New(m, storeFrom, nil)
+			for _, s := range data[:1000] {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutations(storeFrom)
+
+			storeTo := copyStore(storeFrom)
+			tr = trie.New(m, storeTo, nil)
+			for _, s := range data[1000:1100] {
+				tr.UpdateStr(s, s+"$")
+			}
+			for _, s := range data[:100] {
+				tr.DeleteStr(s)
+			}
+			for _, s := range data[200:250] {
+				tr.UpdateStr(s, "updated")
+			}
+			tr.Commit()
+			tr.PersistMutations(storeTo)
+
+			var buf bytes.Buffer
+			n, err := trie.WriteDiff(&buf, trie.NewTrieReader(m, storeFrom, nil), trie.NewTrieReader(m, storeTo, nil))
+			require.NoError(t, err)
+			require.True(t, buf.Len() < trie.ByteSize(storeTo))
+			t.Logf("diff: %d records, %d bytes, target state %d bytes", n, buf.Len(), trie.ByteSize(storeTo))
+
+			replica := copyStore(storeFrom)
+			nApplied, err := trie.ApplyDiff(&buf, replica)
+			require.NoError(t, err)
+			require.EqualValues(t, n, nApplied)
+			equalStores(storeTo, replica)
+
+			// reverse diff returns to the original state
+			buf.Reset()
+			_, err = trie.WriteDiff(&buf, trie.NewTrieReader(m, storeTo, nil), trie.NewTrieReader(m, storeFrom, nil))
+			require.NoError(t, err)
+			_, err = trie.ApplyDiff(&buf, replica)
+			require.NoError(t, err)
+			equalStores(storeFrom, replica)
+
+			// diff from the empty state
+			buf.Reset()
+			_, err = trie.WriteDiff(&buf, trie.NewTrieReader(m, trie.NewInMemoryKVStore(), nil), trie.NewTrieReader(m, storeTo, nil))
+			require.NoError(t, err)
+			replica = trie.NewInMemoryKVStore()
+			_, err = trie.ApplyDiff(&buf, replica)
+			require.NoError(t, err)
+			equalStores(storeTo, replica)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
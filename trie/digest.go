@@ -0,0 +1,83 @@
+package trie
+
+// Digest index is an optional secondary index which maps terminal commitments to keys committed with it.
+// It allows queries like "which keys hold the value with this exact commitment".
+// The index is a set of keys, each composed of the serialized terminal commitment and the key of the state.
+// Changes of terminal commitments are tracked by the trie upon updates and are written to the index store
+// together with persisting of node mutations. Writes to the index are not atomic with writes of nodes, unless they
+// are collected with Trie.MutationSetWithIndexes and routed into one batch
+
+// digestChange is the terminal commitment of the key before the first update since the last persist
+// and the latest one
+type digestChange struct {
+	prev TCommitment
+	cur  TCommitment
+}
+
+// recordDigestChange tracks the change of the terminal commitment of the key, if the digest index is enabled
+func (sc *nodeStoreBuffered) recordDigestChange(key []byte, prev, cur TCommitment) {
+	if sc.digestIndex == nil {
+		return
+	}
+	if ch, ok := sc.digestChanges[string(key)]; ok {
+		ch.cur = cur
+		return
+	}
+	sc.digestChanges[string(key)] = &digestChange{prev: prev, cur: cur}
+}
+
+// persistDigestChanges writes tracked changes of the digest index to the writer. Returns number of changed index entries
+func (sc *nodeStoreBuffered) persistDigestChanges(w KVWriter) int {
+	if sc.digestIndex == nil {
+		return 0
+	}
+	ret := 0
+	for k, ch := range sc.digestChanges {
+		if sc.reader.m.EqualCommitments(ch.prev, ch.cur) {
+			continue
+		}
+		if ch.prev != nil {
+			w.Set(digestIndexKey(ch.prev, []byte(k)), nil)
+			ret++
+		}
+		if ch.cur != nil {
+			w.Set(digestIndexKey(ch.cur, []byte(k)), []byte{0xff})
+			ret++
+		}
+	}
+	sc.digestChanges = make(map[string]*digestChange)
+	return ret
+}
+
+func (sc *nodeStoreBuffered) cloneDigestChanges() map[string]*digestChange {
+	ret := make(map[string]*digestChange, len(sc.digestChanges))
+	for k, ch := range sc.digestChanges {
+		chCopy := *ch
+		ret[k] = &chCopy
+	}
+	return ret
+}
+
+func digestIndexPrefix(terminal TCommitment) []byte {
+	data := terminal.Bytes()
+	Assert(len(data) < 256, "trie::digestIndexPrefix: terminal commitment too long")
+	return Concat(byte(len(data)), data)
+}
+
+func digestIndexKey(terminal TCommitment, key []byte) []byte {
+	return Concat(digestIndexPrefix(terminal), key)
+}
+
+// KeysByTerminal returns keys committed with the terminal commitment, according to the digest index
+// (see Options.DigestIndex). Order of keys is not deterministic.
+// Unless the index store implements KVPrefixIterator, it iterates the whole index, so then it is intended
+// for analytics rather than for frequent queries
+func KeysByTerminal(digestIndex KVIterator, terminal TCommitment) [][]byte {
+	prefix := digestIndexPrefix(terminal)
+	ret := make([][]byte, 0)
+	IterateKeysPrefix(digestIndex, prefix, func(k []byte) bool {
+		ret = append(ret, Concat(k[len(prefix):]))
+		return true
+	})
+	return ret
+}
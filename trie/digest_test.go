@@ -0,0 +1,73 @@
+package trie_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestIndex(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("digest index"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			values := []string{"value 1", "value 2", "a value which is long enough not to fit into the terminal commitment"}
+			store := trie.NewInMemoryKVStore()
+			index := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{DigestIndex: index})
+			state := make(map[string]string)
+			for i, s := range data {
+				tr.UpdateStr(s, values[i%len(values)])
+				state[s] = values[i%len(values)]
+			}
+			checkIndex := func() {
+				for _, v := range values {
+					keys := trie.KeysByTerminal(index, m.CommitToData([]byte(v)))
+					expected := make([]string, 0)
+					for k, vs := range state {
+						if vs == v {
+							expected = append(expected, k)
+						}
+					}
+					actual := make([]string, len(keys))
+					for i := range keys {
+						actual[i] = string(keys[i])
+					}
+					sort.Strings(expected)
+					sort.Strings(actual)
+					require.EqualValues(t, expected, actual)
+				}
+			}
+			tr.Commit()
+			stats := tr.PersistMutationsWithStats(store)
+			require.EqualValues(t, len(state), stats.DigestIndexUpdates)
+			require.EqualValues(t, len(state), trie.NumEntries(index))
+			checkIndex()
+
+			for i, s := range data[:300] {
+				switch i % 3 {
+				case 0:
+					tr.DeleteStr(s)
+					delete(state, s)
+				case 1:
+					tr.UpdateStr(s, values[0])
+					state[s] = values[0]
+				case 2:
+					tr.UpdateStr(s, "temporary value")
+					tr.UpdateStr(s, values[2])
+					state[s] = values[2]
+				}
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			require.EqualValues(t, len(state), trie.NumEntries(index))
+			checkIndex()
+			require.EqualValues(t, 0, len(trie.KeysByTerminal(index, m.CommitToData([]byte("temporary value")))))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,165 @@
+package trie
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrRootMismatch is returned when the root commitment of the imported trie is not the expected one
+var ErrRootMismatch = errors.New("trie: root commitment mismatch")
+
+// DumpOptions are optional parameters of DumpToFileWithOptions and UnDumpFromFileWithOptions
+type DumpOptions struct {
+	// Progress, if not nil, is called after each ProgressInterval records and upon completion
+	Progress func(DumpProgress)
+	// ProgressInterval is the number of records between calls of Progress. Zero means defaultDumpProgressInterval
+	ProgressInterval int
+	// ExpectedRoot, if not nil, is the root commitment of the trie which must be in the store after import.
+	// All nodes of the trie are verified against it. Used by UnDumpFromFileWithOptions only.
+	// The store must be a KVReader then
+	ExpectedRoot VCommitment
+	// Model of the imported trie. Required with ExpectedRoot
+	Model CommitmentModel
+	// Codec of the imported trie. Nil means BinaryCodec
+	Codec Codec
+	// ValueStore of the imported trie. Nil means the store of the import
+	ValueStore KVReader
+}
+
+// DumpProgress is the number of records and bytes dumped or imported so far
+type DumpProgress struct {
+	Records int
+	Bytes   int
+}
+
+const defaultDumpProgressInterval = 10000
+
+type dumpProgressReporter struct {
+	DumpProgress
+	opt      DumpOptions
+	interval int
+}
+
+func newDumpProgressReporter(opt []DumpOptions) *dumpProgressReporter {
+	ret := &dumpProgressReporter{}
+	if len(opt) > 0 {
+		ret.opt = opt[0]
+	}
+	ret.interval = ret.opt.ProgressInterval
+	if ret.interval <= 0 {
+		ret.interval = defaultDumpProgressInterval
+	}
+	return ret
+}
+
+// record counts the record and reports the progress at the interval
+func (p *dumpProgressReporter) record(size int) {
+	p.Records++
+	p.Bytes += size
+	if p.opt.Progress != nil && p.Records%p.interval == 0 {
+		p.opt.Progress(p.DumpProgress)
+	}
+}
+
+// done reports the final progress
+func (p *dumpProgressReporter) done() {
+	if p.opt.Progress != nil {
+		p.opt.Progress(p.DumpProgress)
+	}
+}
+
+// DumpToFileWithOptions is DumpToFile with progress reporting and cancellation. If the context is cancelled,
+// the incomplete file is removed and the context error is returned
+func DumpToFileWithOptions(ctx context.Context, r KVIterator, fname string, opt ...DumpOptions) (DumpProgress, error) {
+	progress := newDumpProgressReporter(opt)
+	file, err := os.Create(fname)
+	if err != nil {
+		return progress.DumpProgress, err
+	}
+	w := bufio.NewWriter(file)
+	r.Iterate(func(k, v []byte) bool {
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+		var n int
+		if n, err = writeKV(w, k, v); err != nil {
+			return false
+		}
+		progress.record(n)
+		return true
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if errc := file.Close(); err == nil {
+		err = errc
+	}
+	if err != nil {
+		_ = os.Remove(fname)
+		return progress.DumpProgress, err
+	}
+	progress.done()
+	return progress.DumpProgress, nil
+}
+
+// UnDumpFromFileWithOptions is UnDumpFromFile with progress reporting and cancellation. Records imported before
+// the cancellation remain in the store. If ExpectedRoot is provided, the whole imported trie is verified against it:
+// the commitment of each node is recomputed from its children and its terminal and compared with the commitment
+// stored in its parent, as in VerifyRoot. ErrRootMismatch is returned if any node is missing or does not match
+func UnDumpFromFileWithOptions(ctx context.Context, w KVWriter, fname string, opt ...DumpOptions) (DumpProgress, error) {
+	progress := newDumpProgressReporter(opt)
+	o := progress.opt
+	var rdr KVReader
+	if o.ExpectedRoot != nil {
+		var ok bool
+		if rdr, ok = w.(KVReader); !ok {
+			return progress.DumpProgress, fmt.Errorf("trie::UnDumpFromFile: can't verify the root: the store is not a KVReader")
+		}
+		if o.Model == nil {
+			return progress.DumpProgress, fmt.Errorf("trie::UnDumpFromFile: can't verify the root: model not provided")
+		}
+	}
+	file, err := os.Open(fname)
+	if err != nil {
+		return progress.DumpProgress, err
+	}
+	defer func() { _ = file.Close() }()
+
+	r := bufio.NewReader(file)
+	var k, v []byte
+	for {
+		if err = ctx.Err(); err != nil {
+			return progress.DumpProgress, err
+		}
+		if k, err = ReadBytes16(r); errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return progress.DumpProgress, fmt.Errorf("trie::UnDumpFromFile: record %d: %w", progress.Records, err)
+		}
+		if v, err = ReadBytes32(r); err != nil {
+			return progress.DumpProgress, fmt.Errorf("trie::UnDumpFromFile: record %d: %w", progress.Records, err)
+		}
+		w.Set(k, v)
+		progress.record(len(k) + len(v) + 6)
+	}
+	progress.done()
+	if o.ExpectedRoot == nil {
+		return progress.DumpProgress, nil
+	}
+	valueStore := o.ValueStore
+	if valueStore == nil {
+		valueStore = rdr
+	}
+	report := verifyAll(rdr, o.Model, o.ExpectedRoot, valueStore, o.Codec)
+	if !report.OK() {
+		return progress.DumpProgress, fmt.Errorf("trie::UnDumpFromFile: %w: expected %v, %d nodes are missing or corrupted, e.g. '%s'",
+			ErrRootMismatch, o.ExpectedRoot, len(report.Corrupted), hex.EncodeToString(report.Corrupted[0]))
+	}
+	return progress.DumpProgress, nil
+}
@@ -0,0 +1,119 @@
+package trie_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpWithOptions(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("dump with options"+tn(m), func(t *testing.T) {
+			fname := filepath.Join(t.TempDir(), "dump")
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range genData2()[:500] {
+				tr.UpdateStr(s, s+"+")
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			root := trie.RootCommitment(tr)
+			records := trie.NumEntries(store)
+
+			reports := make([]trie.DumpProgress, 0)
+			opt := trie.DumpOptions{
+				Progress:         func(p trie.DumpProgress) { reports = append(reports, p) },
+				ProgressInterval: 100,
+			}
+			progress, err := trie.DumpToFileWithOptions(context.Background(), store, fname, opt)
+			require.NoError(t, err)
+			require.EqualValues(t, records, progress.Records)
+			require.EqualValues(t, trie.ByteSize(store), progress.Bytes)
+			require.EqualValues(t, records/100+1, len(reports))
+			require.EqualValues(t, progress, reports[len(reports)-1])
+
+			reports = reports[:0]
+			imported := trie.NewInMemoryKVStore()
+			opt.ExpectedRoot, opt.Model = root, m
+			progress1, err := trie.UnDumpFromFileWithOptions(context.Background(), imported, fname, opt)
+			require.NoError(t, err)
+			require.EqualValues(t, progress, progress1)
+			require.EqualValues(t, records/100+1, len(reports))
+			require.EqualValues(t, records, trie.NumEntries(imported))
+
+			// the import of another trie fails
+			other := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			other.UpdateStr("other", "other")
+			other.Commit()
+			opt.ExpectedRoot = trie.RootCommitment(other)
+			_, err = trie.UnDumpFromFileWithOptions(context.Background(), trie.NewInMemoryKVStore(), fname, opt)
+			require.True(t, errors.Is(err, trie.ErrRootMismatch))
+
+			// the dump with a missing or corrupted node below the root fails, while the root record is intact
+			rootKey, err := trie.EncodeUnpackedBytes(nil, m.PathArity())
+			require.NoError(t, err)
+			var nodeKey []byte
+			store.Iterate(func(k, _ []byte) bool {
+				if !bytes.Equal(k, rootKey) {
+					nodeKey = k
+					return false
+				}
+				return true
+			})
+			require.NotNil(t, nodeKey)
+			for _, corrupt := range []func(trie.KVStore){
+				func(s trie.KVStore) { s.Set(nodeKey, nil) },
+				func(s trie.KVStore) { s.Set(nodeKey, s.Get(rootKey)) },
+			} {
+				broken := trie.NewInMemoryKVStore()
+				store.Iterate(func(k, v []byte) bool {
+					broken.Set(k, v)
+					return true
+				})
+				corrupt(broken)
+				fnameBroken := fname + "-broken"
+				_, err = trie.DumpToFileWithOptions(context.Background(), broken, fnameBroken)
+				require.NoError(t, err)
+				_, err = trie.UnDumpFromFileWithOptions(context.Background(), trie.NewInMemoryKVStore(), fnameBroken,
+					trie.DumpOptions{ExpectedRoot: root, Model: m})
+				require.True(t, errors.Is(err, trie.ErrRootMismatch), "%v", err)
+			}
+
+			// cancellation
+			ctx, cancel := context.WithCancel(context.Background())
+			opt = trie.DumpOptions{
+				Progress:         func(trie.DumpProgress) { cancel() },
+				ProgressInterval: 100,
+			}
+			imported = trie.NewInMemoryKVStore()
+			progress, err = trie.UnDumpFromFileWithOptions(ctx, imported, fname, opt)
+			require.True(t, errors.Is(err, context.Canceled))
+			require.EqualValues(t, 100, progress.Records)
+			require.EqualValues(t, 100, trie.NumEntries(imported))
+
+			_, err = trie.DumpToFileWithOptions(ctx, store, fname+"1")
+			require.True(t, errors.Is(err, context.Canceled))
+			_, err = os.Stat(fname + "1")
+			require.True(t, os.IsNotExist(err))
+
+			// truncated file is an error
+			data, err := os.ReadFile(fname)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(fname, data[:len(data)-1], 0o600))
+			_, err = trie.UnDumpFromFile(trie.NewInMemoryKVStore(), fname)
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
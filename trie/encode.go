@@ -50,6 +50,9 @@ func decode16(data []byte) ([]byte, error) {
 	if data[0] > 1 {
 		return nil, ErrWrongFormat
 	}
+	if data[0] == 1 && len(data) == 1 {
+		return nil, ErrWrongFormat
+	}
 	ret := make([]byte, 0, len(data)*2)
 	ret = unpack16(ret, data[1:])
 	if data[0] == 1 && ret[len(ret)-1] != 0 {
@@ -117,8 +120,9 @@ func decode2(data []byte) ([]byte, error) {
 	}
 	ret := make([]byte, 0, len(data)*8)
 	ret = unpack2(ret, data[1:])
-	Assert(len(ret) >= int(data[0]), "trie::decode2:: assert failed: len(ret) >= int(data[0]), data: %s",
-		hex.EncodeToString(data))
+	if len(ret) < int(data[0]) {
+		return nil, ErrWrongFormat
+	}
 	// enforce the last data[0] elements are 0
 	for j := len(ret) - int(data[0]); j < len(ret); j++ {
 		if ret[j] != 0 {
@@ -129,6 +133,19 @@ func decode2(data []byte) ([]byte, error) {
 	return ret, nil
 }
 
+// Keys of the trie are "unpacked" according to the arity before they are used as paths in the trie:
+// - PathArity256: each byte is one element of the path, the key is not changed
+// - PathArity16: each byte is split into 2 elements (4 bit nibbles), the higher nibble first
+// - PathArity2: each byte is split into 8 elements (bits), the highest bit first
+// Unpacking is stable, i.e. it will never change for existing arities. It preserves the order: for any keys k1 and k2,
+// UnpackBytes(k1) precedes UnpackBytes(k2) lexicographically if and only if k1 precedes k2 lexicographically.
+// For this reason, order of keys in the trie (e.g. in IterateKeys) is the byte-lexicographic order of original keys
+// for all arities.
+// Unpacked slices of arbitrary length (e.g. prefixes or path fragments) can't always be packed back into bytes
+// without loss. PackUnpackedBytes pads them with 0, while EncodeUnpackedBytes keeps the length information.
+// Use UnpackedPrefixRange to convert an unpacked prefix to the range of original keys
+
+// UnpackBytes unpacks the key (or prefix) in original bytes into the path according to the arity
 func UnpackBytes(src []byte, arity PathArity) []byte {
 	switch arity {
 	case PathArity256:
@@ -141,6 +158,7 @@ func UnpackBytes(src []byte, arity PathArity) []byte {
 	panic(ErrWrongArity)
 }
 
+// EncodeUnpackedBytes encodes unpacked bytes of any length into bytes. It is reversed by DecodeToUnpackedBytes
 func EncodeUnpackedBytes(unpacked []byte, arity PathArity) ([]byte, error) {
 	if len(unpacked) == 0 {
 		return nil, nil
@@ -156,6 +174,8 @@ func EncodeUnpackedBytes(unpacked []byte, arity PathArity) ([]byte, error) {
 	return nil, ErrWrongArity
 }
 
+// PackUnpackedBytes packs unpacked bytes back into original bytes. It is reverse of UnpackBytes if the number of unpacked
+// elements corresponds to the whole number of bytes. Otherwise, the last byte is padded with 0
 func PackUnpackedBytes(unpacked []byte, arity PathArity) ([]byte, error) {
 	if len(unpacked) == 0 {
 		return nil, nil
@@ -186,6 +206,7 @@ func mustEncodeUnpackedBytes(unpacked []byte, arity PathArity) []byte {
 	return ret
 }
 
+// DecodeToUnpackedBytes decodes bytes encoded by EncodeUnpackedBytes
 func DecodeToUnpackedBytes(encoded []byte, arity PathArity) ([]byte, error) {
 	if len(encoded) == 0 {
 		return nil, nil
@@ -200,3 +221,28 @@ func DecodeToUnpackedBytes(encoded []byte, arity PathArity) ([]byte, error) {
 	}
 	return nil, ErrWrongArity
 }
+
+// UnpackedPrefixRange returns the range of original keys which unpacked start with the unpacked prefix.
+// The range contains keys k such that from <= k < to in the byte-lexicographic order. Nil 'to' means the range
+// is not bounded from above. It allows to build range queries over the store of original keys for prefixes
+// which do not correspond to the whole number of bytes
+func UnpackedPrefixRange(unpackedPrefix []byte, arity PathArity) ([]byte, []byte, error) {
+	from, err := PackUnpackedBytes(unpackedPrefix, arity)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the upper bound is the prefix incremented as a number in base of the arity
+	next := make([]byte, len(unpackedPrefix))
+	copy(next, unpackedPrefix)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] < byte(arity) {
+			next[i]++
+			to, err := PackUnpackedBytes(next[:i+1], arity)
+			if err != nil {
+				return nil, nil, err
+			}
+			return from, to, nil
+		}
+	}
+	return from, nil, nil
+}
@@ -1,7 +1,11 @@
 package trie
 
 import (
+	"bytes"
 	"encoding/hex"
+	"io"
+	"math"
+	"math/bits"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -148,3 +152,94 @@ func TestCheckingKey(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, unpackedBinBack, unpackedBin)
 }
+
+func TestUnpackedPrefixRange(t *testing.T) {
+	check := func(prefix []byte, arity PathArity, from, to []byte) {
+		f, tt, err := UnpackedPrefixRange(prefix, arity)
+		require.NoError(t, err)
+		require.EqualValues(t, from, f)
+		require.EqualValues(t, to, tt)
+	}
+	check([]byte{0x61, 0x62}, PathArity256, []byte{0x61, 0x62}, []byte{0x61, 0x63})
+	check([]byte{0x61, 0xFF}, PathArity256, []byte{0x61, 0xFF}, []byte{0x62})
+	check([]byte{0xFF}, PathArity256, []byte{0xFF}, nil)
+	check([]byte{0x6}, PathArity16, []byte{0x60}, []byte{0x70})
+	check([]byte{0x6, 0x1}, PathArity16, []byte{0x61}, []byte{0x62})
+	check([]byte{0x6, 0xF}, PathArity16, []byte{0x6F}, []byte{0x70})
+	check([]byte{0xF, 0xF, 0xF}, PathArity16, []byte{0xFF, 0xF0}, nil)
+	check([]byte{0, 1, 1}, PathArity2, []byte{0x60}, []byte{0x80})
+	check(nil, PathArity2, nil, nil)
+	_, _, err := UnpackedPrefixRange([]byte{0x10}, PathArity16)
+	require.Error(t, err)
+
+	// every key with the prefix is in the range, every other key is out of it
+	for _, arity := range AllPathArity {
+		for k := 0; k < 256*256; k += 7 {
+			key := []byte{byte(k >> 8), byte(k)}
+			unpacked := UnpackBytes(key, arity)
+			prefix := UnpackBytes([]byte{0x61, 0xA5}, arity)[:len(unpacked)/2+1]
+			from, to, err := UnpackedPrefixRange(prefix, arity)
+			require.NoError(t, err)
+			inRange := bytes.Compare(from, key) <= 0 && (to == nil || bytes.Compare(key, to) < 0)
+			require.EqualValues(t, bytes.HasPrefix(unpacked, prefix), inRange)
+		}
+	}
+}
+
+func TestMalformedInput(t *testing.T) {
+	for _, data := range [][]byte{{1}, {2, 0}, {1, 0x0F}} {
+		_, err := DecodeToUnpackedBytes(data, PathArity16)
+		require.Error(t, err)
+	}
+	for _, data := range [][]byte{{8, 0}, {1}, {7}, {3, 0x01}} {
+		_, err := DecodeToUnpackedBytes(data, PathArity2)
+		require.Error(t, err)
+	}
+	// short data
+	_, err := ReadBytes8(bytes.NewReader([]byte{3, 1, 2}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = ReadBytes16(bytes.NewReader([]byte{3, 0, 1}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	var v uint16
+	require.ErrorIs(t, ReadUint16(bytes.NewReader([]byte{3}), &v), io.ErrUnexpectedEOF)
+	// huge declared length is not allocated ahead
+	_, err = ReadBytes32(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF, 0xFF, 1, 2, 3}))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	data := make([]byte, maxPreallocSize+10)
+	data[0] = 7
+	b, err := ReadBytes32(bytes.NewReader(append(Uint32To4Bytes(uint32(len(data))), data...)))
+	require.NoError(t, err)
+	require.EqualValues(t, data, b)
+
+	require.False(t, PathArity(3).IsValid())
+	for _, a := range AllPathArity {
+		require.True(t, a.IsValid())
+	}
+}
+
+func TestUint64Key(t *testing.T) {
+	values := []uint64{0, 1, 2, 0xff, 0x100, 1000, 0xffff, 0x10000, 1 << 32, math.MaxUint64 - 1, math.MaxUint64}
+	for i, v := range values {
+		key := Uint64Key(v)
+		require.EqualValues(t, (bits.Len64(v)+7)/8+1, len(key))
+		dec, err := Uint64FromKey(key)
+		require.NoError(t, err)
+		require.EqualValues(t, v, dec)
+		if i > 0 {
+			require.True(t, bytes.Compare(Uint64Key(values[i-1]), key) < 0)
+		}
+	}
+	require.EqualValues(t, []byte{0x00}, Uint64Key(0))
+	require.EqualValues(t, []byte{0x02, 0x03, 0xe8}, Uint64Key(1000))
+
+	for _, key := range [][]byte{nil, {0x01}, {0x01, 0x00}, {0x02, 0x00, 0x01}, {0x00, 0x00}, {0x09, 1, 1, 1, 1, 1, 1, 1, 1, 1}} {
+		_, err := Uint64FromKey(key)
+		require.ErrorIs(t, err, ErrWrongUint64Key)
+	}
+	c := Uint64KeyCodec{Prefix: []byte("ts/")}
+	dec, err := c.Decode(c.Key(12345))
+	require.NoError(t, err)
+	require.EqualValues(t, 12345, dec)
+	_, err = c.Decode(Concat("xx/", Uint64Key(1)))
+	require.Error(t, err)
+}
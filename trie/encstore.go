@@ -0,0 +1,71 @@
+package trie
+
+import (
+	"fmt"
+)
+
+// encryptedStore is the KVStore which encrypts records of the underlying store with AES-256-GCM.
+// Keys are stored as is, values are encrypted. The nonce is derived from the hash of the key and the value, so equal
+// records are encrypted equally and overwriting the key with another value never reuses the nonce.
+// The key is authenticated as additional data: the record can't be moved to another key
+type encryptedStore struct {
+	store KVStore
+	enc   *valueEncryption
+}
+
+// NewEncryptedKVStore creates the store which encrypts values of the underlying store with the secret (at least 16 bytes).
+// It is transparent to the trie and can be used both as the node store and as the value store, for data-at-rest
+// encryption when the underlying key/value store does not provide it. Commitments are not affected.
+// Keys, i.e. paths of nodes and keys of values, are not encrypted.
+// Records, which can't be decrypted, i.e. tampered with or encrypted with another secret, are treated as
+// the corrupted store: reading them panics
+func NewEncryptedKVStore(store KVStore, secret []byte) (KVStore, error) {
+	enc, err := newValueEncryption(secret)
+	if err != nil {
+		return nil, fmt.Errorf("trie::NewEncryptedKVStore: %w", err)
+	}
+	return &encryptedStore{store: store, enc: enc}, nil
+}
+
+func (e *encryptedStore) Get(key []byte) []byte {
+	return e.decrypt(key, e.store.Get(key))
+}
+
+func (e *encryptedStore) decrypt(key, value []byte) []byte {
+	if len(value) == 0 {
+		return nil
+	}
+	ret, err := e.enc.RestoreValue(key, value)
+	Assert(err == nil, "trie::encryptedStore: can't decrypt record of the key %x: %v", key, err)
+	return ret
+}
+
+func (e *encryptedStore) Has(key []byte) bool {
+	return e.store.Has(key)
+}
+
+func (e *encryptedStore) Set(key, value []byte) {
+	if len(value) == 0 {
+		e.store.Set(key, nil)
+		return
+	}
+	e.store.Set(key, e.enc.TransformValue(key, value))
+}
+
+func (e *encryptedStore) Iterate(fun func(k, v []byte) bool) {
+	e.store.Iterate(func(k, v []byte) bool {
+		return fun(k, e.decrypt(k, v))
+	})
+}
+
+// IteratePrefix implements KVPrefixIterator. Iteration is bounded if the underlying store implements KVPrefixIterator
+func (e *encryptedStore) IteratePrefix(prefix []byte, fun func(k, v []byte) bool) {
+	IteratePrefix(e.store, prefix, func(k, v []byte) bool {
+		return fun(k, e.decrypt(k, v))
+	})
+}
+
+// IterateKeysPrefix implements KVPrefixIterator
+func (e *encryptedStore) IterateKeysPrefix(prefix []byte, fun func(k []byte) bool) {
+	IterateKeysPrefix(e.store, prefix, fun)
+}
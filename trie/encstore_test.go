@@ -0,0 +1,83 @@
+package trie_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedKVStore(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	_, err := trie.NewEncryptedKVStore(trie.NewInMemoryKVStore(), secret[:15])
+	require.Error(t, err)
+
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("encrypted store"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			plainStore, plainValues := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			plain := trie.New(m, plainStore, plainValues)
+			underlying := trie.NewInMemoryKVStore()
+			store, err := trie.NewEncryptedKVStore(trie.NewPartition(underlying, []byte{0}), secret)
+			require.NoError(t, err)
+			valueStore, err := trie.NewEncryptedKVStore(trie.NewPartition(underlying, []byte{1}), secret)
+			require.NoError(t, err)
+			tr := trie.New(m, store, valueStore)
+			for _, s := range data {
+				v := []byte(s + "-value")
+				plain.Update([]byte(s), v)
+				plainValues.Set([]byte(s), v)
+				tr.Update([]byte(s), v)
+				valueStore.Set([]byte(s), v)
+			}
+			plain.Commit()
+			plain.PersistMutations(plainStore)
+			tr.Commit()
+			tr.PersistMutations(store)
+			tr.ClearCache()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(plain), trie.RootCommitment(tr)))
+			require.EqualValues(t, storeContents(plainStore), storeContents(store))
+			require.EqualValues(t, storeContents(plainValues), storeContents(valueStore))
+
+			// records are not readable in the underlying store
+			underlying.Iterate(func(k, v []byte) bool {
+				require.False(t, bytes.Contains(v, []byte("-value")))
+				return true
+			})
+			other, err := trie.NewEncryptedKVStore(trie.NewPartition(underlying, []byte{1}), secret[1:])
+			require.NoError(t, err)
+			require.Panics(t, func() {
+				other.Get([]byte(data[0]))
+			})
+			// the record moved to another key is not decrypted. Random keys may repeat
+			from := 1
+			for data[from] == data[0] {
+				from++
+			}
+			underlying.Set(trie.Concat([]byte{1}, data[0]), underlying.Get(trie.Concat([]byte{1}, data[from])))
+			require.Panics(t, func() {
+				valueStore.Get([]byte(data[0]))
+			})
+
+			reader := trie.NewTrieReader(m, store, valueStore)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(plain), trie.RootCommitment(reader)))
+			require.EqualValues(t, snapshotKeys(t, plain), snapshotKeys(t, reader))
+
+			for _, s := range data {
+				tr.DeleteStr(s)
+				valueStore.Set([]byte(s), nil)
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			require.Nil(t, trie.RootCommitment(tr))
+			require.EqualValues(t, 0, trie.NumEntries(underlying))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,60 @@
+package trie_test
+
+import (
+	"fmt"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+)
+
+func ExampleNew() {
+	// nodes of the trie are stored in the key/value store
+	store := trie.NewInMemoryKVStore()
+	// blake2b 160 bit commitment model of the binary trie
+	model := trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160)
+
+	tr := trie.New(model, store, nil)
+	for _, s := range []string{"a", "abc", "abcd", "b", "abd"} {
+		tr.UpdateStr(s, s+"$")
+	}
+	// recalculates commitments of updated nodes
+	tr.Commit()
+	fmt.Printf("root: %s\n", trie.RootCommitment(tr))
+
+	tr.DeleteStr("abc")
+	tr.Commit()
+	fmt.Printf("root: %s\n", trie.RootCommitment(tr))
+
+	// committed nodes are persisted in the store, the trie can be read from it with the reader
+	tr.PersistMutations(store)
+	rdr := trie.NewTrieReader(model, store, nil)
+	fmt.Printf("root of the reader: %s\n", trie.RootCommitment(rdr))
+	// Output:
+	// root: e34053943c8ba1df7d3af1a4a7e8b70ca7b5f3b5
+	// root: 8ad5b43b9e5b36b2807ecd073a60b56b62cf4be6
+	// root of the reader: 8ad5b43b9e5b36b2807ecd073a60b56b62cf4be6
+}
+
+func ExampleIterateKeys() {
+	store := trie.NewInMemoryKVStore()
+	tr := trie.New(trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160), store, nil)
+	for _, s := range []string{"klmn", "abd", "b", "a", "abc"} {
+		tr.UpdateStr(s, s+"$")
+	}
+	tr.Commit()
+
+	// keys are iterated in the lexicographical order
+	_, err := trie.IterateKeys(tr, nil, func(key []byte, _ trie.TCommitment) bool {
+		fmt.Printf("%s\n", key)
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+	// Output:
+	// a
+	// abc
+	// abd
+	// b
+	// klmn
+}
@@ -0,0 +1,149 @@
+package trie
+
+import (
+	"encoding/binary"
+	"sort"
+	"time"
+)
+
+// Expiry index is an optional index of keys by their expiry time (see Options.ExpiryIndex). Keys inserted with
+// UpdateWithExpiry are deleted from the trie by Expire after the expiry time. The expiry time itself is not committed
+// in the trie: applications which need to prove it put it into the value. The committed state after Expire is
+// verifiable as any other state. Same as the digest index, changes are tracked by the trie upon updates and deletions
+// and are written to the index store together with persisting of node mutations.
+// Layout of the index store:
+// - expiryTimePrefix + 8 bytes of the expiry time (big-endian Unix nanoseconds) + key -> expiryMarker
+// - expiryKeyPrefix + key -> 8 bytes of the expiry time
+const (
+	expiryTimePrefix = byte(iota)
+	expiryKeyPrefix
+)
+
+const expiryMarker = byte(0xff)
+
+// recordExpiry tracks the expiry time of the key, zero means the key does not expire. No-op if the index is disabled
+func (sc *nodeStoreBuffered) recordExpiry(key []byte, expiry int64) {
+	if sc.expiryIndex == nil {
+		return
+	}
+	sc.expiryChanges[string(key)] = expiry
+}
+
+func (sc *nodeStoreBuffered) cloneExpiryChanges() map[string]int64 {
+	ret := make(map[string]int64, len(sc.expiryChanges))
+	for k, e := range sc.expiryChanges {
+		ret[k] = e
+	}
+	return ret
+}
+
+func expiryTimeKey(expiry []byte, key []byte) []byte {
+	return Concat(expiryTimePrefix, expiry, key)
+}
+
+func expiryBytes(expiry int64) []byte {
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], uint64(expiry))
+	return ret[:]
+}
+
+// persistExpiryChanges writes tracked changes of the expiry index to the writer. Previous entries are read from the
+// index. Returns number of changed index entries
+func (sc *nodeStoreBuffered) persistExpiryChanges(w KVWriter) int {
+	if sc.expiryIndex == nil {
+		return 0
+	}
+	ret := 0
+	for k, expiry := range sc.expiryChanges {
+		keyEntry := Concat(expiryKeyPrefix, k)
+		prev := sc.expiryIndex.Get(keyEntry)
+		if prev == nil && expiry == 0 {
+			continue
+		}
+		if prev != nil {
+			w.Set(expiryTimeKey(prev, []byte(k)), nil)
+			ret++
+		}
+		if expiry == 0 {
+			w.Set(keyEntry, nil)
+			ret++
+			continue
+		}
+		e := expiryBytes(expiry)
+		w.Set(expiryTimeKey(e, []byte(k)), []byte{expiryMarker})
+		w.Set(keyEntry, e)
+		ret += 2
+	}
+	sc.expiryChanges = make(map[string]int64)
+	return ret
+}
+
+// expiredKeys returns keys with the expiry time not later than 'now', sorted
+func (sc *nodeStoreBuffered) expiredKeys(now int64) []string {
+	ret := make([]string, 0)
+	for k, expiry := range sc.expiryChanges {
+		if expiry != 0 && expiry <= now {
+			ret = append(ret, k)
+		}
+	}
+	IterateKeysPrefix(sc.expiryIndex, []byte{expiryTimePrefix}, func(k []byte) bool {
+		if len(k) < 9 {
+			return true
+		}
+		key := string(k[9:])
+		if _, changed := sc.expiryChanges[key]; changed {
+			return true
+		}
+		if int64(binary.BigEndian.Uint64(k[1:9])) <= now {
+			ret = append(ret, key)
+		}
+		return true
+	})
+	sort.Strings(ret)
+	return ret
+}
+
+// UpdateWithExpiry updates the key with the value (see Update) and records it in the expiry index, so it is deleted
+// by Expire after the expiry time. Updating or deleting of the key without expiry removes it from the index.
+// The trie must be created with Options.ExpiryIndex
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryUpdateWithExpiry)
+func (tr *Trie) UpdateWithExpiry(key, value []byte, expiry time.Time) {
+	Assert(tr.nodeStore.expiryIndex != nil, "trie::UpdateWithExpiry: expiry index is not enabled")
+	Assert(expiry.UnixNano() > 0, "trie::UpdateWithExpiry: wrong expiry time %v", expiry)
+	tr.Update(key, value)
+	if tr.isDeletion(value) {
+		return
+	}
+	tr.nodeStore.recordExpiry(tr.middleware.TransformKey(key), expiry.UnixNano())
+}
+
+// Expiry returns the expiry time of the key, false if the key does not expire
+func (tr *Trie) Expiry(key []byte) (time.Time, bool) {
+	Assert(tr.nodeStore.expiryIndex != nil, "trie::Expiry: expiry index is not enabled")
+	key = tr.middleware.TransformKey(key)
+	expiry, changed := tr.nodeStore.expiryChanges[string(key)]
+	if !changed {
+		if e := tr.nodeStore.expiryIndex.Get(Concat(expiryKeyPrefix, key)); len(e) == 8 {
+			expiry = int64(binary.BigEndian.Uint64(e))
+		}
+	}
+	if expiry == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, expiry), true
+}
+
+// Expire deletes all keys with the expiry time not later than 'now' in one batch and commits the trie.
+// Returns number of deleted keys. Values are not deleted from the value store
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryExpire)
+func (tr *Trie) Expire(now time.Time) int {
+	tr.mustBeWritable("Expire")
+	Assert(tr.nodeStore.expiryIndex != nil, "trie::Expire: expiry index is not enabled")
+	keys := tr.nodeStore.expiredKeys(now.UnixNano())
+	for _, k := range keys {
+		tr.delete([]byte(k))
+	}
+	tr.Commit()
+	tr.log.Debugf("trie: expired %d keys", len(keys))
+	return len(keys)
+}
@@ -0,0 +1,90 @@
+package trie_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiry(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("expiry"+tn(m), func(t *testing.T) {
+			// keys must be unique and non-empty: an empty value is a deletion, which records no expiry
+			data := genData2()[:300]
+			start := time.Unix(1_700_000_000, 0)
+			store := trie.NewInMemoryKVStore()
+			index := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{ExpiryIndex: index})
+			require.True(t, tr.Stats().ExpiryIndex)
+
+			// expiry of keys in seconds after start, 0 means no expiry
+			expiry := make(map[string]int)
+			values := make(map[string]string)
+			for i, s := range data {
+				values[s] = s
+				if i%3 == 0 {
+					tr.UpdateStr(s, s)
+					expiry[s] = 0
+					continue
+				}
+				tr.UpdateWithExpiry([]byte(s), []byte(s), start.Add(time.Duration(i)*time.Second))
+				expiry[s] = i
+			}
+			tr.Commit()
+			stats := tr.PersistMutationsWithStats(store)
+			require.True(t, stats.ExpiryIndexUpdates > 0)
+
+			// the key updated without expiry does not expire anymore
+			for i, s := range data[:100] {
+				if i%3 == 1 {
+					tr.UpdateStr(s, s+"1")
+					values[s] = s + "1"
+					expiry[s] = 0
+				}
+			}
+			for s, e := range expiry {
+				exp, ok := tr.Expiry([]byte(s))
+				require.EqualValues(t, e != 0, ok)
+				if ok {
+					require.EqualValues(t, start.Add(time.Duration(e)*time.Second).UnixNano(), exp.UnixNano())
+				}
+			}
+			// expire returns the number of expired keys and commits the state without them
+			expire := func(now int) {
+				reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+				expected := 0
+				for s, e := range expiry {
+					if e != 0 && e <= now {
+						expected++
+						delete(expiry, s)
+						continue
+					}
+					reference.UpdateStr(s, values[s])
+				}
+				reference.Commit()
+				require.EqualValues(t, expected, tr.Expire(start.Add(time.Duration(now)*time.Second)))
+				require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+			}
+			expire(0)
+			expire(150)
+			tr.PersistMutations(store)
+			tr.ClearCache()
+			expire(150)
+			expire(1000)
+			tr.PersistMutations(store)
+			for s := range expiry {
+				_, ok := tr.Expiry([]byte(s))
+				require.False(t, ok)
+			}
+			// all expiring keys have expired, so the index is empty
+			require.EqualValues(t, 0, trie.NumEntries(index))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,198 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ExportFormat is a text format of the exported trie contents
+type ExportFormat byte
+
+const (
+	ExportFormatCSV = ExportFormat(iota)
+	ExportFormatJSONL
+)
+
+func (f ExportFormat) String() string {
+	switch f {
+	case ExportFormatCSV:
+		return "CSV"
+	case ExportFormatJSONL:
+		return "JSONL"
+	default:
+		return "ExportFormat(wrong)"
+	}
+}
+
+// ExportEncoding is the text encoding of keys and values in the exported records
+type ExportEncoding byte
+
+const (
+	ExportEncodingHex = ExportEncoding(iota)
+	ExportEncodingBase64
+)
+
+func (e ExportEncoding) String() string {
+	switch e {
+	case ExportEncodingHex:
+		return "hex"
+	case ExportEncodingBase64:
+		return "base64"
+	default:
+		return "ExportEncoding(wrong)"
+	}
+}
+
+func (e ExportEncoding) encode(data []byte) string {
+	if e == ExportEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+// ExportOptions are parameters of Export
+type ExportOptions struct {
+	Format ExportFormat
+	// Encoding of keys and values. Terminal commitments are always hex encoded
+	Encoding ExportEncoding
+	// Prefix of exported keys in original (packed) bytes. Nil means all keys
+	Prefix []byte
+}
+
+// ExportRecord is the record of one key in the JSONL export. CSV export has the same columns
+type ExportRecord struct {
+	Key string `json:"key"`
+	// Value is empty if the value store does not contain the key
+	Value    string `json:"value"`
+	Terminal string `json:"terminal"`
+	// Depth is the number of nodes in the path from the root to the node of the key, excluding the root
+	Depth int `json:"depth"`
+}
+
+var exportCSVHeader = []string{"key", "value", "terminal", "depth"}
+
+// Export writes keys committed in the trie under the prefix, their values, terminal commitments and depths in the trie
+// to the writer in CSV (with the header) or JSON-lines format, in the lexicographical order of keys.
+// Values are read from the value store. Nil value store means values are not exported.
+// It is intended for audit and reporting tools which can't consume the binary dump format.
+// For the Trie, it is expected all mutations are committed. Returns number of exported keys
+func Export(w io.Writer, tr NodeStore, valueStore KVReader, opt ExportOptions) (int, error) {
+	var write func(rec *ExportRecord) error
+	var flush func() error
+	switch opt.Format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportCSVHeader); err != nil {
+			return 0, err
+		}
+		write = func(rec *ExportRecord) error {
+			return cw.Write([]string{rec.Key, rec.Value, rec.Terminal, strconv.Itoa(rec.Depth)})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case ExportFormatJSONL:
+		enc := json.NewEncoder(w)
+		write = func(rec *ExportRecord) error {
+			return enc.Encode(rec)
+		}
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("trie::Export: unsupported export format %s", opt.Format)
+	}
+	if opt.Encoding != ExportEncodingHex && opt.Encoding != ExportEncodingBase64 {
+		return 0, fmt.Errorf("trie::Export: unsupported encoding %s", opt.Encoding)
+	}
+	n, ok := tr.GetNode(nil)
+	if !ok {
+		return 0, flush()
+	}
+	e := &exporter{
+		tr:             tr,
+		valueStore:     valueStore,
+		opt:            opt,
+		unpackedPrefix: UnpackBytes(opt.Prefix, tr.PathArity()),
+		write:          write,
+	}
+	e.exportNode(n, 0)
+	if e.err != nil {
+		return e.count, e.err
+	}
+	return e.count, flush()
+}
+
+type exporter struct {
+	tr             NodeStore
+	valueStore     KVReader
+	opt            ExportOptions
+	unpackedPrefix []byte
+	write          func(rec *ExportRecord) error
+	count          int
+	err            error
+}
+
+// compatible is true if the path is a prefix of the prefix or vice versa, i.e. the subtree may contain keys with the prefix
+func (e *exporter) compatible(path []byte) bool {
+	if len(path) < len(e.unpackedPrefix) {
+		return bytes.HasPrefix(e.unpackedPrefix, path)
+	}
+	return bytes.HasPrefix(path, e.unpackedPrefix)
+}
+
+func (e *exporter) exportNode(n Node, depth int) bool {
+	path := Concat(n.Key(), n.PathFragment())
+	if !e.compatible(path) {
+		return true
+	}
+	if n.Terminal() != nil && bytes.HasPrefix(path, e.unpackedPrefix) {
+		if e.err = e.exportTerminal(path, n.Terminal(), depth); e.err != nil {
+			return false
+		}
+	}
+	children := n.ChildCommitments()
+	for i := 0; i < e.tr.PathArity().NumChildren(); i++ {
+		if _, ok := children[byte(i)]; !ok {
+			continue
+		}
+		if !e.compatible(Concat(path, byte(i))) {
+			continue
+		}
+		child, ok := e.tr.GetNode(childKey(n, byte(i)))
+		if !ok {
+			continue
+		}
+		if !e.exportNode(child, depth+1) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *exporter) exportTerminal(unpackedKey []byte, terminal TCommitment, depth int) error {
+	key, err := PackUnpackedBytes(unpackedKey, e.tr.PathArity())
+	if err != nil {
+		return err
+	}
+	rec := &ExportRecord{
+		Key:      e.opt.Encoding.encode(key),
+		Terminal: hex.EncodeToString(terminal.Bytes()),
+		Depth:    depth,
+	}
+	if e.valueStore != nil {
+		if v := e.valueStore.Get(key); v != nil {
+			rec.Value = e.opt.Encoding.encode(v)
+		}
+	}
+	if err = e.write(rec); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
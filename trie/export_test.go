@@ -0,0 +1,106 @@
+package trie_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("export"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, valueStore)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+				valueStore.Set([]byte(s), []byte(s+"$"))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			rdr := trie.NewTrieReader(m, store, valueStore)
+
+			expected := func(prefix string) []string {
+				ret := make([]string, 0)
+				_, err := rdr.IterateKeys(nil, func(key []byte, _ trie.TCommitment) bool {
+					if strings.HasPrefix(string(key), prefix) {
+						ret = append(ret, string(key))
+					}
+					return true
+				})
+				require.NoError(t, err)
+				return ret
+			}
+			checkRecord := func(rec *trie.ExportRecord, key string, decode func(string) ([]byte, error)) {
+				k, err := decode(rec.Key)
+				require.NoError(t, err)
+				require.EqualValues(t, key, string(k))
+				v, err := decode(rec.Value)
+				require.NoError(t, err)
+				require.EqualValues(t, key+"$", string(v))
+				require.EqualValues(t, hex.EncodeToString(m.CommitToData(v).Bytes()), rec.Terminal)
+				require.True(t, rec.Depth >= 0)
+			}
+			for _, prefix := range []string{"", "a", "ab", "klmn", "\xff"} {
+				keys := expected(prefix)
+
+				var buf bytes.Buffer
+				n, err := trie.Export(&buf, rdr, valueStore, trie.ExportOptions{
+					Format:   trie.ExportFormatCSV,
+					Encoding: trie.ExportEncodingHex,
+					Prefix:   []byte(prefix),
+				})
+				require.NoError(t, err)
+				require.EqualValues(t, len(keys), n)
+				rows, err := csv.NewReader(&buf).ReadAll()
+				require.NoError(t, err)
+				require.EqualValues(t, len(keys)+1, len(rows))
+				require.EqualValues(t, []string{"key", "value", "terminal", "depth"}, rows[0])
+				for i, row := range rows[1:] {
+					depth, err := strconv.Atoi(row[3])
+					require.NoError(t, err)
+					checkRecord(&trie.ExportRecord{Key: row[0], Value: row[1], Terminal: row[2], Depth: depth}, keys[i], hex.DecodeString)
+				}
+
+				buf.Reset()
+				n, err = trie.Export(&buf, rdr, valueStore, trie.ExportOptions{
+					Format:   trie.ExportFormatJSONL,
+					Encoding: trie.ExportEncodingBase64,
+					Prefix:   []byte(prefix),
+				})
+				require.NoError(t, err)
+				require.EqualValues(t, len(keys), n)
+				dec := json.NewDecoder(&buf)
+				for i := 0; dec.More(); i++ {
+					var rec trie.ExportRecord
+					require.NoError(t, dec.Decode(&rec))
+					checkRecord(&rec, keys[i], base64.StdEncoding.DecodeString)
+				}
+			}
+
+			// without value store values are empty
+			var buf bytes.Buffer
+			_, err := trie.Export(&buf, rdr, nil, trie.ExportOptions{Format: trie.ExportFormatJSONL})
+			require.NoError(t, err)
+			var rec trie.ExportRecord
+			require.NoError(t, json.NewDecoder(&buf).Decode(&rec))
+			require.EqualValues(t, "", rec.Value)
+
+			_, err = trie.Export(&buf, rdr, nil, trie.ExportOptions{Format: trie.ExportFormat(10)})
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,84 @@
+package trie
+
+// unpackFixedKey unpacks the key of the fixed length (see Options.FixedKeyLength) into the new buffer owned by the trie.
+// Keys of nodes along the key and path fragments of new nodes are slices of the buffer, so the update allocates
+// the buffer only once instead of allocating each key and path fragment
+func (tr *Trie) unpackFixedKey(key []byte) []byte {
+	Assert(len(key) == tr.fixedKeyLength, "trie: wrong length of the key %d, all keys must be %d bytes long",
+		len(key), tr.fixedKeyLength)
+	switch tr.nodeStore.arity {
+	case PathArity256:
+		ret := make([]byte, len(key))
+		copy(ret, key)
+		return ret
+	case PathArity16:
+		return unpack16(make([]byte, 0, 2*len(key)), key)
+	case PathArity2:
+		return unpack2(make([]byte, 0, 8*len(key)), key)
+	}
+	panic(ErrWrongArity)
+}
+
+// unpackKey unpacks the key into the new buffer owned by the trie
+func (tr *Trie) unpackKey(key []byte) []byte {
+	if tr.fixedKeyLength == 0 {
+		return UnpackBytes(key, tr.nodeStore.arity)
+	}
+	return tr.unpackFixedKey(key)
+}
+
+// keyPath unpacks the key and returns the path to it in the trie (see proofPath)
+func (tr *Trie) keyPath(key []byte) ([]byte, [][]byte, []byte, ProofEndingCode) {
+	if tr.fixedKeyLength == 0 {
+		unpackedKey := UnpackBytes(key, tr.nodeStore.arity)
+		proof, prefix, ending := proofPath(tr, unpackedKey)
+		return unpackedKey, proof, prefix, ending
+	}
+	unpackedKey := tr.unpackFixedKey(key)
+	proof, prefix, ending := fixedKeyPath(tr, unpackedKey)
+	return unpackedKey, proof, prefix, ending
+}
+
+// fixedKeyPath is proofPath for the unpacked key owned by the trie. Keys along the path and the common prefix
+// are slices of the unpacked key, the path is allocated once with the capacity of the maximal depth
+func fixedKeyPath(tr NodeStore, unpackedKey []byte) ([][]byte, []byte, ProofEndingCode) {
+	return continuePath(tr, unpackedKey, make([][]byte, 0, len(unpackedKey)+1))
+}
+
+// continuePath is fixedKeyPath which starts from the last node of the proof instead of the root. The proof
+// is the beginning of the path to the unpacked key, i.e. keys of the path to the node which exists in the trie
+// and which key is a prefix of the unpacked key. The path is appended to the proof. Empty proof means the root
+func continuePath(tr NodeStore, unpackedKey []byte, proof [][]byte) ([][]byte, []byte, ProofEndingCode) {
+	var key []byte
+	if len(proof) > 0 {
+		key = proof[len(proof)-1]
+		proof = proof[:len(proof)-1]
+	}
+	n, ok := tr.GetNode(key)
+	if !ok {
+		Assert(len(key) == 0, "trie::continuePath: node of the path does not exist")
+		return nil, nil, 0
+	}
+	for {
+		proof = append(proof, key)
+		rest := unpackedKey[len(key):]
+		pathFragment := n.PathFragment()
+		i := 0
+		for i < len(rest) && i < len(pathFragment) && rest[i] == pathFragment[i] {
+			i++
+		}
+		if i == len(rest) && i == len(pathFragment) {
+			return proof, nil, EndingTerminal
+		}
+		prefix := rest[:i:i]
+		if i < len(pathFragment) {
+			return proof, prefix, EndingSplit
+		}
+		childIndexPosition := len(key) + i
+		Assert(childIndexPosition < len(unpackedKey), "childIndexPosition<len(unpackedKey)")
+		key = unpackedKey[: childIndexPosition+1 : childIndexPosition+1]
+		if n, ok = tr.GetNode(key); !ok {
+			return proof, prefix, EndingExtend
+		}
+	}
+}
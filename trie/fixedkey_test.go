@@ -0,0 +1,55 @@
+package trie_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedKeyLength(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("fixed key length"+tn(m), func(t *testing.T) {
+			keys := genHashedKeys(1000)
+			storeVar := trie.NewInMemoryKVStore()
+			storeFixed := trie.NewInMemoryKVStore()
+			trVar := trie.New(m, storeVar, nil)
+			trFixed := trie.NewWithOptions(m, storeFixed, nil, trie.Options{FixedKeyLength: 32})
+			require.EqualValues(t, 32, trFixed.Stats().FixedKeyLength)
+
+			rnd := rand.New(rand.NewSource(42))
+			for round := 0; round < 5; round++ {
+				for _, k := range keys {
+					switch rnd.Intn(3) {
+					case 0:
+						trVar.Delete(k)
+						trFixed.Delete(k)
+					default:
+						v := []byte(fmt.Sprintf("%x-%d", k[:4], round))
+						trVar.Update(k, v)
+						trFixed.Update(k, v)
+					}
+				}
+				trVar.Commit()
+				trFixed.Commit()
+				require.True(t, m.EqualCommitments(trie.RootCommitment(trVar), trie.RootCommitment(trFixed)))
+			}
+			trVar.PersistMutations(storeVar)
+			trFixed.PersistMutations(storeFixed)
+			require.EqualValues(t, storeContents(storeVar), storeContents(storeFixed))
+
+			require.Panics(t, func() {
+				trFixed.UpdateStr("short key", "value")
+			})
+			require.Panics(t, func() {
+				trFixed.Delete(append(keys[0], 0))
+			})
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+}
@@ -0,0 +1,151 @@
+package trie
+
+import "fmt"
+
+// GarbageReportOptions are optional parameters of GarbageReport
+type GarbageReportOptions struct {
+	// Layout of partitions in the store. Zero value means DefaultStoreLayout
+	Layout StoreLayout
+	// Codec is the serialization of nodes. Nil means BinaryCodec
+	Codec Codec
+}
+
+// GarbageStats is the result of GarbageReport. Sizes are sums of lengths of keys and values of records in partitions
+type GarbageStats struct {
+	// Roots is the number of roots which are found in the store
+	Roots int
+	// MissingNodes is the number of nodes of the roots which are absent in the store or do not match commitments,
+	// for example because they have been overwritten by later versions
+	MissingNodes        int
+	ReachableNodes      int
+	ReachableNodeBytes  int
+	ReachableValues     int
+	ReachableValueBytes int
+	TotalNodes          int
+	TotalNodeBytes      int
+	TotalValues         int
+	TotalValueBytes     int
+	// TotalBytes is the size of all records of the store, including the metadata partition
+	TotalBytes int
+}
+
+// GarbageBytes is the size of node and value records which are not reachable from any of the roots,
+// i.e. how much pruning would reclaim
+func (s *GarbageStats) GarbageBytes() int {
+	return s.TotalNodeBytes - s.ReachableNodeBytes + s.TotalValueBytes - s.ReachableValueBytes
+}
+
+func (s *GarbageStats) String() string {
+	return fmt.Sprintf("garbage: %d bytes of %d total. Roots found: %d, missing nodes: %d, nodes: %d of %d reachable (%d of %d bytes), "+
+		"values: %d of %d reachable (%d of %d bytes)",
+		s.GarbageBytes(), s.TotalBytes, s.Roots, s.MissingNodes,
+		s.ReachableNodes, s.TotalNodes, s.ReachableNodeBytes, s.TotalNodeBytes,
+		s.ReachableValues, s.TotalValues, s.ReachableValueBytes, s.TotalValueBytes)
+}
+
+// GarbageReport computes the size of node and value records reachable from the roots versus the total size
+// of the store, so operators know how much pruning would reclaim before committing to it. Nodes are read and verified
+// against commitments of the roots, as in ExportSubtree. Values are reachable if they are stored under keys
+// committed by reachable nodes. The store is read-only
+func GarbageReport(store KVStore, model CommitmentModel, roots []VCommitment, opt ...GarbageReportOptions) (*GarbageStats, error) {
+	var o GarbageReportOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	layout := o.Layout
+	if layout.NodePrefix == nil && layout.ValuePrefix == nil && layout.MetadataPrefix == nil {
+		layout = DefaultStoreLayout
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, fmt.Errorf("trie::GarbageReport: %w", err)
+	}
+	g := &garbageCollector{
+		codec:         codecOrDefault(o.Codec),
+		nodeStore:     layout.NodeStore(store),
+		valueStore:    layout.ValueStore(store),
+		model:         model,
+		visitedNodes:  make(map[string]VCommitment),
+		visitedValues: make(map[string]struct{}),
+	}
+	for _, root := range roots {
+		if root == nil {
+			continue
+		}
+		if g.visit(nil, root) {
+			g.stats.Roots++
+		}
+	}
+	g.nodeStore.Iterate(func(k, v []byte) bool {
+		g.stats.TotalNodes++
+		g.stats.TotalNodeBytes += len(k) + len(v)
+		return true
+	})
+	g.valueStore.Iterate(func(k, v []byte) bool {
+		g.stats.TotalValues++
+		g.stats.TotalValueBytes += len(k) + len(v)
+		return true
+	})
+	store.Iterate(func(k, v []byte) bool {
+		g.stats.TotalBytes += len(k) + len(v)
+		return true
+	})
+	return &g.stats, nil
+}
+
+type garbageCollector struct {
+	codec      Codec
+	nodeStore  KVStore
+	valueStore KVStore
+	model      CommitmentModel
+	// visitedNodes are commitments of reachable nodes by encoded keys
+	visitedNodes map[string]VCommitment
+	// visitedValues are keys of reachable values
+	visitedValues map[string]struct{}
+	stats         GarbageStats
+}
+
+// visit counts the node and its subtree as reachable. Returns false if the node is missing
+func (g *garbageCollector) visit(unpackedKey []byte, expected VCommitment) bool {
+	encodedKey := mustEncodeUnpackedBytes(unpackedKey, g.model.PathArity())
+	if c, ok := g.visitedNodes[string(encodedKey)]; ok {
+		// shared with another root
+		if g.model.EqualCommitments(c, expected) {
+			return true
+		}
+		g.stats.MissingNodes++
+		return false
+	}
+	n, err := readVerifiedNode(g.codec, g.nodeStore, g.model, g.valueStore, unpackedKey, expected)
+	if err != nil {
+		g.stats.MissingNodes++
+		return false
+	}
+	g.visitedNodes[string(encodedKey)] = expected
+	g.stats.ReachableNodes++
+	g.stats.ReachableNodeBytes += len(encodedKey) + len(g.nodeStore.Get(encodedKey))
+	if n.Terminal() != nil {
+		g.visitValue(Concat(n.Key(), n.PathFragment()))
+	}
+	for i, c := range n.ChildCommitments() {
+		g.visit(childKey(n, i), c)
+	}
+	return true
+}
+
+func (g *garbageCollector) visitValue(unpackedKey []byte) {
+	key, err := PackUnpackedBytes(unpackedKey, g.model.PathArity())
+	if err != nil {
+		return
+	}
+	if _, ok := g.visitedValues[string(key)]; ok {
+		return
+	}
+	value := g.valueStore.Get(key)
+	if value == nil {
+		// key commitment or terminal stored with the node
+		return
+	}
+	g.visitedValues[string(key)] = struct{}{}
+	g.stats.ReachableValues++
+	g.stats.ReachableValueBytes += len(key) + len(value)
+}
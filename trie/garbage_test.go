@@ -0,0 +1,81 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGarbageReport(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("garbage report"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:500]
+			store := trie.NewInMemoryKVStore()
+			layout := trie.DefaultStoreLayout
+			values := layout.ValueStore(store)
+			tr := trie.NewWithLayout(m, store, layout, trie.Options{})
+			for _, s := range data {
+				if len(s) > 0 {
+					tr.UpdateStr(s, s+"-value-which-is-longer-than-the-hash")
+					values.Set([]byte(s), []byte(s+"-value-which-is-longer-than-the-hash"))
+				}
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+			root1 := trie.RootCommitment(tr)
+			layout.MetadataStore(store).Set([]byte("meta"), []byte("data"))
+
+			stats, err := trie.GarbageReport(store, m, []trie.VCommitment{root1})
+			require.NoError(t, err)
+			t.Logf("%s", stats)
+			require.EqualValues(t, 1, stats.Roots)
+			require.EqualValues(t, 0, stats.MissingNodes)
+			require.EqualValues(t, 0, stats.GarbageBytes())
+			require.EqualValues(t, stats.TotalNodes, stats.ReachableNodes)
+			require.EqualValues(t, stats.TotalValues, stats.ReachableValues)
+			require.True(t, stats.TotalBytes > stats.TotalNodeBytes+stats.TotalValueBytes)
+
+			// values of deleted keys and stray nodes are garbage
+			deleted := 0
+			for i, s := range data {
+				if len(s) > 0 && i%3 == 0 {
+					if tr.HasMany([][]byte{[]byte(s)})[0] {
+						deleted++
+					}
+					tr.DeleteStr(s)
+				}
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+			root2 := trie.RootCommitment(tr)
+			layout.NodeStore(store).Set([]byte("stray node"), []byte("junk"))
+
+			stats, err = trie.GarbageReport(store, m, []trie.VCommitment{root2})
+			require.NoError(t, err)
+			t.Logf("%s", stats)
+			require.EqualValues(t, 1, stats.Roots)
+			require.EqualValues(t, 0, stats.MissingNodes)
+			require.EqualValues(t, stats.TotalValues-deleted, stats.ReachableValues)
+			require.EqualValues(t, stats.TotalNodes-1, stats.ReachableNodes)
+			require.True(t, stats.GarbageBytes() > 0)
+
+			// the old root is overwritten by the new one
+			stats, err = trie.GarbageReport(store, m, []trie.VCommitment{root1, root2})
+			require.NoError(t, err)
+			require.EqualValues(t, 1, stats.Roots)
+			require.True(t, stats.MissingNodes > 0)
+
+			stats, err = trie.GarbageReport(store, m, nil)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, stats.ReachableNodes)
+			require.EqualValues(t, stats.TotalNodeBytes+stats.TotalValueBytes, stats.GarbageBytes())
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
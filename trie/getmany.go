@@ -0,0 +1,59 @@
+package trie
+
+import "sync"
+
+// GetMany returns values of the keys (in original bytes) from the value store, nil for absent keys.
+// Presence of keys is resolved first in one traversal of the trie (see HasMany), so nodes on common paths are read
+// once and absent keys cost no value store reads. Values of present keys are read with 'parallelism' concurrent
+// workers, which reduces latency with remote or disk stores. Parallelism > 1 requires the value store
+// to be safe for concurrent reads. Returns values in the order of keys, as they are returned by the value store
+// (see KVReader on ownership of returned slices)
+func GetMany(tr NodeStore, valueStore KVReader, keys [][]byte, parallelism int) [][]byte {
+	ret := make([][]byte, len(keys))
+	present := HasMany(tr, keys)
+	indices := make([]int, 0, len(keys))
+	for i, ok := range present {
+		if ok {
+			indices = append(indices, i)
+		}
+	}
+	if parallelism <= 1 || len(indices) <= 1 {
+		for _, i := range indices {
+			ret[i] = valueStore.Get(keys[i])
+		}
+		return ret
+	}
+	if parallelism > len(indices) {
+		parallelism = len(indices)
+	}
+	ch := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ch {
+				ret[i] = valueStore.Get(keys[i])
+			}
+		}()
+	}
+	for _, i := range indices {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+	return ret
+}
+
+// GetMany returns values of the keys from the value store of the reader. Optional parameter is the parallelism
+// of reading values, default is 1. Returns nils if the value store is not provided. See GetMany
+func (tr *TrieReader) GetMany(keys [][]byte, parallelism ...int) [][]byte {
+	if tr.reader.valueStore == nil {
+		return make([][]byte, len(keys))
+	}
+	p := 1
+	if len(parallelism) > 0 {
+		p = parallelism[0]
+	}
+	return GetMany(tr, tr.reader.valueStore, keys, p)
+}
@@ -0,0 +1,54 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMany(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("get many"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, valueStore)
+			expected := make(map[string]string)
+			for i, s := range data {
+				if i%4 == 0 || s == "" {
+					continue
+				}
+				tr.UpdateStr(s, s+"+")
+				valueStore.Set([]byte(s), []byte(s+"+"))
+				expected[s] = s + "+"
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+
+			keys := make([][]byte, 0, len(data)+1)
+			for _, s := range data {
+				keys = append(keys, []byte(s))
+			}
+			keys = append(keys, []byte("absent"))
+			reader := trie.NewTrieReader(m, store, valueStore)
+			for _, parallelism := range []int{0, 1, 4, 2000} {
+				values := reader.GetMany(keys, parallelism)
+				require.EqualValues(t, len(keys), len(values))
+				for i, k := range keys {
+					v, ok := expected[string(k)]
+					if !ok {
+						require.Nil(t, values[i])
+						continue
+					}
+					require.EqualValues(t, v, string(values[i]))
+				}
+			}
+			require.EqualValues(t, make([][]byte, len(keys)), trie.NewTrieReader(m, store, nil).GetMany(keys))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160))
+	}
+}
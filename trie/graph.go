@@ -0,0 +1,108 @@
+package trie
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// GraphFormat is a text format of the trie graph rendering
+type GraphFormat byte
+
+const (
+	GraphFormatDOT = GraphFormat(iota)
+	GraphFormatMermaid
+)
+
+// graphCommitmentLen is a number of hex characters of commitments shown in the graph
+const graphCommitmentLen = 8
+
+func (f GraphFormat) String() string {
+	switch f {
+	case GraphFormatDOT:
+		return "DOT"
+	case GraphFormatMermaid:
+		return "Mermaid"
+	default:
+		return "GraphFormat(wrong)"
+	}
+}
+
+// WriteGraph renders the subtree of the trie which commits to all keys with the unpacked prefix in DOT (Graphviz)
+// or Mermaid text format. Nil prefix means the whole trie. Nodes are labeled with the key, path fragment,
+// truncated node commitment and terminal commitment. Edges are labeled with child indices.
+// Intended for debugging and documentation of small tries
+func WriteGraph(w io.Writer, tr NodeStore, unpackedPrefix []byte, format GraphFormat) error {
+	var err error
+	switch format {
+	case GraphFormatDOT:
+		_, err = fmt.Fprintf(w, "digraph trie {\n    node [shape=box, fontname=\"monospace\"];\n")
+	case GraphFormatMermaid:
+		_, err = fmt.Fprintf(w, "graph TD\n")
+	default:
+		return fmt.Errorf("unsupported graph format %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	if n, ok := findNodeByPrefix(tr, unpackedPrefix); ok {
+		TraverseNodes(tr, n.Key(), func(unpackedKey []byte, n *NodeData) bool {
+			if err = writeGraphNode(w, tr.Model(), unpackedKey, n, format); err != nil {
+				return false
+			}
+			for i := 0; i < tr.PathArity().NumChildren(); i++ {
+				if _, ok := n.ChildCommitments[byte(i)]; !ok {
+					continue
+				}
+				to := Concat(unpackedKey, n.PathFragment, byte(i))
+				if format == GraphFormatDOT {
+					_, err = fmt.Fprintf(w, "    %s -> %s [label=\"%d\"];\n", graphNodeID(unpackedKey), graphNodeID(to), i)
+				} else {
+					_, err = fmt.Fprintf(w, "    %s -->|%d| %s\n", graphNodeID(unpackedKey), i, graphNodeID(to))
+				}
+				if err != nil {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if format == GraphFormatDOT {
+		_, err = fmt.Fprintf(w, "}\n")
+	}
+	return err
+}
+
+func writeGraphNode(w io.Writer, m CommitmentModel, unpackedKey []byte, n *NodeData, format GraphFormat) error {
+	term := "-"
+	if n.Terminal != nil {
+		term = truncateString(n.Terminal.String(), graphCommitmentLen)
+	}
+	c := "-"
+	if vc := m.CalcNodeCommitment(n); vc != nil {
+		c = truncateString(vc.String(), graphCommitmentLen)
+	}
+	var err error
+	if format == GraphFormatDOT {
+		_, err = fmt.Fprintf(w, "    %s [label=\"key: '%s'\\npf: '%s'\\nC: %s\\nT: %s\"];\n",
+			graphNodeID(unpackedKey), hex.EncodeToString(unpackedKey), hex.EncodeToString(n.PathFragment), c, term)
+	} else {
+		_, err = fmt.Fprintf(w, "    %s[\"key: '%s'<br/>pf: '%s'<br/>C: %s<br/>T: %s\"]\n",
+			graphNodeID(unpackedKey), hex.EncodeToString(unpackedKey), hex.EncodeToString(n.PathFragment), c, term)
+	}
+	return err
+}
+
+func graphNodeID(unpackedKey []byte) string {
+	return "n_" + hex.EncodeToString(unpackedKey)
+}
+
+func truncateString(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + ".."
+}
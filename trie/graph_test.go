@@ -0,0 +1,54 @@
+package trie_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGraph(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("graph"+tn(m), func(t *testing.T) {
+			data := []string{"a", "ab", "abc", "abd", "b", "bcd", "klmn"}
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			numNodes := 0
+			tr.TraverseNodes(nil, func(_ []byte, _ *trie.NodeData) bool {
+				numNodes++
+				return true
+			})
+
+			var buf bytes.Buffer
+			err := trie.WriteGraph(&buf, tr, nil, trie.GraphFormatDOT)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(buf.String(), "digraph trie {"))
+			require.EqualValues(t, numNodes-1, strings.Count(buf.String(), " -> "))
+
+			buf.Reset()
+			err = trie.WriteGraph(&buf, tr, nil, trie.GraphFormatMermaid)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(buf.String(), "graph TD"))
+			require.EqualValues(t, numNodes-1, strings.Count(buf.String(), " -->|"))
+
+			var bufSub bytes.Buffer
+			err = trie.WriteGraph(&bufSub, tr, trie.UnpackBytes([]byte("ab"), m.PathArity()), trie.GraphFormatDOT)
+			require.NoError(t, err)
+			require.True(t, strings.Count(bufSub.String(), " -> ") < numNodes-1)
+
+			bufSub.Reset()
+			err = trie.WriteGraph(&bufSub, tr, trie.UnpackBytes([]byte("xyz"), m.PathArity()), trie.GraphFormatDOT)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, strings.Count(bufSub.String(), "label"))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,87 @@
+package trie
+
+import (
+	"bytes"
+	"sort"
+)
+
+// HasMany checks presence of each of the keys (in original bytes) in the trie. Keys are sorted and traversed
+// together, so nodes on the common path of many keys are read once. It is much faster than checking keys one by one,
+// for example when validating all inputs of a block. Duplicate keys are allowed.
+// For the Trie it reflects uncommitted updates. Keys are not transformed by the middleware, use Trie.HasMany for it.
+// Returns results in the order of keys
+func HasMany(tr NodeStore, keys [][]byte) []bool {
+	ret := make([]bool, len(keys))
+	root, ok := tr.GetNode(nil)
+	if !ok {
+		return ret
+	}
+	unpackedKeys := make([][]byte, len(keys))
+	order := make([]int, len(keys))
+	for i, k := range keys {
+		unpackedKeys[i] = UnpackBytes(k, tr.PathArity())
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(unpackedKeys[order[i]], unpackedKeys[order[j]]) < 0
+	})
+	h := &hasManyQuery{
+		tr:           tr,
+		unpackedKeys: unpackedKeys,
+		ret:          ret,
+	}
+	h.checkNode(root, order)
+	return ret
+}
+
+type hasManyQuery struct {
+	tr           NodeStore
+	unpackedKeys [][]byte
+	ret          []bool
+}
+
+// checkNode resolves keys with indices 'order', sorted by keys. All keys start with the key of the node
+func (h *hasManyQuery) checkNode(n Node, order []int) {
+	path := Concat(n.Key(), n.PathFragment())
+	for i := 0; i < len(order); {
+		k := h.unpackedKeys[order[i]]
+		switch {
+		case !bytes.HasPrefix(k, path):
+			i++
+		case len(k) == len(path):
+			h.ret[order[i]] = n.Terminal() != nil
+			i++
+		default:
+			// keys going to the same child are adjacent in the sorted order
+			childIndex := k[len(path)]
+			j := i + 1
+			for ; j < len(order); j++ {
+				next := h.unpackedKeys[order[j]]
+				if len(next) <= len(path) || next[len(path)] != childIndex || !bytes.HasPrefix(next, path) {
+					break
+				}
+			}
+			if child, ok := h.tr.GetNode(childKey(n, childIndex)); ok {
+				h.checkNode(child, order[i:j])
+			}
+			i = j
+		}
+	}
+}
+
+// HasMany checks presence of each of the keys. Keys are transformed by the middleware of the trie. See HasMany
+func (tr *Trie) HasMany(keys [][]byte) []bool {
+	if len(tr.middleware) > 0 {
+		transformed := make([][]byte, len(keys))
+		for i, k := range keys {
+			transformed[i] = tr.middleware.TransformKey(k)
+		}
+		keys = transformed
+	}
+	return HasMany(tr, keys)
+}
+
+// HasMany checks presence of each of the keys. See HasMany
+func (tr *TrieReader) HasMany(keys [][]byte) []bool {
+	return HasMany(tr, keys)
+}
@@ -0,0 +1,88 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+type countingNodeStore struct {
+	trie.NodeStore
+	reads int
+}
+
+func (c *countingNodeStore) GetNode(unpackedKey []byte) (trie.Node, bool) {
+	c.reads++
+	return c.NodeStore.GetNode(unpackedKey)
+}
+
+func TestHasMany(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("has many"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			present := make(map[string]bool)
+			for i, s := range data {
+				if i%3 == 0 {
+					continue
+				}
+				tr.UpdateStr(s, s+"+")
+				present[s] = true
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			tr.ClearCache()
+
+			keys := make([][]byte, 0, len(data)+3)
+			for _, s := range data {
+				keys = append(keys, []byte(s))
+			}
+			keys = append(keys, []byte("absent"), nil, []byte(data[1]))
+			check := func(tr trie.NodeStore, present map[string]bool) {
+				res := trie.HasMany(tr, keys)
+				require.EqualValues(t, len(keys), len(res))
+				for i, k := range keys {
+					require.EqualValues(t, present[string(k)], res[i], "key '%s'", string(k))
+				}
+			}
+			reader := &countingNodeStore{NodeStore: trie.NewTrieReader(m, store, nil)}
+			check(reader, present)
+			readsMany := reader.reads
+			reader.reads = 0
+			for _, k := range keys {
+				trie.HasMany(reader, [][]byte{k})
+			}
+			require.True(t, readsMany < reader.reads)
+
+			// uncommitted updates are visible in the Trie
+			for i, s := range data {
+				if i%2 == 0 {
+					tr.DeleteStr(s)
+					delete(present, s)
+				}
+			}
+			tr.UpdateStr("absent", "not anymore")
+			present["absent"] = true
+			check(tr, present)
+			require.EqualValues(t, 0, len(trie.HasMany(tr, nil)))
+			require.EqualValues(t, []bool{false}, trie.NewTrieReader(m, trie.NewInMemoryKVStore(), nil).HasMany([][]byte{[]byte("a")}))
+		})
+		t.Run("has many with middleware"+tn(m), func(t *testing.T) {
+			opt := trie.Options{Middleware: trie.MiddlewareChain{prefixMiddleware("pref:")}}
+			tr := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, opt)
+			data := genData1()[:100]
+			for _, s := range data {
+				tr.UpdateStr(s, s+"+")
+			}
+			tr.Commit()
+			res := tr.HasMany([][]byte{[]byte(data[0]), []byte(data[99]), []byte("absent")})
+			require.EqualValues(t, []bool{true, true, false}, res)
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160))
+	}
+}
@@ -0,0 +1,170 @@
+package trie_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func tn(m trie.CommitmentModel) string {
+	return "-" + m.ShortName()
+}
+
+const letters = "abcdefghijklmnop"
+
+func genRnd4() []string {
+	ret := make([]string, 0, len(letters)*len(letters)*len(letters))
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := range letters {
+		for j := range letters {
+			for k := range letters {
+				for l := range letters {
+					s := string([]byte{letters[i], letters[j], letters[k], letters[l]})
+					s = s + s + s + s
+					r1 := rnd.Intn(len(s))
+					r2 := rnd.Intn(len(s))
+					if r2 < r1 {
+						r1, r2 = r2, r1
+					}
+					ret = append(ret, s[r1:r2])
+				}
+			}
+		}
+	}
+	if len(ret) > math.MaxUint16 {
+		ret = ret[:math.MaxUint16]
+	}
+	return ret
+}
+
+func genData1() []string {
+	ret := make([]string, 0, len(letters)*len(letters)*len(letters))
+	for i := range letters {
+		for j := range letters {
+			for k := range letters {
+				ret = append(ret, string([]byte{letters[i], letters[j], letters[k]}))
+			}
+		}
+	}
+	return ret
+}
+
+func genData2() []string {
+	ret := make([]string, 0, len(letters)*len(letters)*len(letters))
+	for i := range letters {
+		for j := range letters {
+			for k := range letters {
+				s := string([]byte{letters[i], letters[j], letters[k]})
+				ret = append(ret, s+s+s+s)
+			}
+		}
+	}
+	return ret
+}
+
+func storeContents(store trie.KVIterator) map[string]string {
+	ret := make(map[string]string)
+	store.Iterate(func(k, v []byte) bool {
+		ret[string(k)] = string(v)
+		return true
+	})
+	return ret
+}
+
+type prefixMiddleware []byte
+
+func (p prefixMiddleware) TransformKey(key []byte) []byte {
+	return trie.Concat([]byte(p), key)
+}
+
+func (p prefixMiddleware) TransformValue(_, value []byte) []byte {
+	return value
+}
+
+func (p prefixMiddleware) RestoreValue(_, value []byte) ([]byte, error) {
+	return value, nil
+}
+
+type countingKVReader struct {
+	trie.KVReader
+	mutex sync.Mutex
+	reads int
+}
+
+func (c *countingKVReader) Get(key []byte) []byte {
+	c.mutex.Lock()
+	c.reads++
+	c.mutex.Unlock()
+	return c.KVReader.Get(key)
+}
+
+// lockedKVStore is the store safe for concurrent use
+type lockedKVStore struct {
+	trie.KVStore
+	mutex sync.RWMutex
+}
+
+func (s *lockedKVStore) Get(key []byte) []byte {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.KVStore.Get(key)
+}
+
+func (s *lockedKVStore) Has(key []byte) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.KVStore.Has(key)
+}
+
+func (s *lockedKVStore) Set(key, value []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.KVStore.Set(key, value)
+}
+
+func snapshotKeys(t *testing.T, tr trie.NodeStore) map[string]bool {
+	ret := make(map[string]bool)
+	_, err := trie.IterateKeys(tr, nil, func(key []byte, _ trie.TCommitment) bool {
+		ret[string(key)] = true
+		return true
+	})
+	require.NoError(t, err)
+	return ret
+}
+
+// patternReader generates 'size' bytes of the pattern without allocating them
+type patternReader struct {
+	size, pos int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if n > r.size-r.pos {
+		n = r.size - r.pos
+	}
+	for i := int64(0); i < n; i++ {
+		p[i] = byte((r.pos + i) % 251)
+	}
+	r.pos += n
+	return int(n), nil
+}
+
+func genHashedKeys(n int) [][]byte {
+	ret := make([][]byte, n)
+	for i := range ret {
+		h := sha256.Sum256([]byte(fmt.Sprintf("key %d", i)))
+		ret[i] = h[:]
+	}
+	return ret
+}
@@ -0,0 +1,115 @@
+package trie
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// ImportJSON reads key/value pairs from the JSON document in the format of Ethereum genesis allocations,
+// to build the trie from them (for example, with ComputeRoot or Trie.UpdateAll). Accepted documents:
+//   - an object of hex keys to hex values: {"0x01ab": "0xcafe", ...}
+//   - an object of hex keys to account objects: {"0x01ab": {"balance": "0x10", "nonce": 1, "storage": {"0x00": "0x01"}}}
+//   - the genesis file with such object under "alloc". Other fields of the genesis file are ignored
+//
+// Each scalar field of the account is imported under the key address||len(field)||field, each entry of the nested object
+// (such as storage) under the key address||len(field)||field||entry key.
+// Scalar values are hex strings with '0x' prefix, decimal strings or JSON numbers. Hex strings are imported as bytes,
+// odd number of digits is padded with the leading zero. Numbers are imported as big-endian bytes without leading zeroes,
+// so zero numbers and empty hex strings are empty values, which are skipped by the trie, same as deletions
+func ImportJSON(r io.Reader) (KVStore, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("trie::ImportJSON: %w", err)
+	}
+	if alloc, ok := doc["alloc"]; ok {
+		if doc, ok = alloc.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("trie::ImportJSON: 'alloc' must be an object")
+		}
+	}
+	ret := NewInMemoryKVStore()
+	for k, v := range doc {
+		key, err := decodeHexString(k)
+		if err != nil {
+			return nil, fmt.Errorf("trie::ImportJSON: wrong key '%s': %w", k, err)
+		}
+		switch vt := v.(type) {
+		case map[string]interface{}:
+			if err = importJSONAccount(ret, key, vt); err != nil {
+				return nil, fmt.Errorf("trie::ImportJSON: account '%s': %w", k, err)
+			}
+		default:
+			value, err := decodeJSONValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("trie::ImportJSON: key '%s': %w", k, err)
+			}
+			ret.Set(key, value)
+		}
+	}
+	return ret, nil
+}
+
+func importJSONAccount(store KVStore, address []byte, account map[string]interface{}) error {
+	for field, v := range account {
+		if len(field) == 0 || len(field) > math.MaxUint8 {
+			return fmt.Errorf("wrong field name '%s'", field)
+		}
+		prefix := Concat(address, byte(len(field)), field)
+		nested, ok := v.(map[string]interface{})
+		if !ok {
+			value, err := decodeJSONValue(v)
+			if err != nil {
+				return fmt.Errorf("field '%s': %w", field, err)
+			}
+			store.Set(prefix, value)
+			continue
+		}
+		for k, nv := range nested {
+			key, err := decodeHexString(k)
+			if err != nil {
+				return fmt.Errorf("field '%s': wrong key '%s': %w", field, k, err)
+			}
+			value, err := decodeJSONValue(nv)
+			if err != nil {
+				return fmt.Errorf("field '%s': key '%s': %w", field, k, err)
+			}
+			store.Set(Concat(prefix, key), value)
+		}
+	}
+	return nil
+}
+
+func decodeJSONValue(v interface{}) ([]byte, error) {
+	switch vt := v.(type) {
+	case string:
+		if strings.HasPrefix(vt, "0x") || strings.HasPrefix(vt, "0X") {
+			return decodeHexString(vt)
+		}
+		return decodeDecimal(vt)
+	case json.Number:
+		return decodeDecimal(vt.String())
+	}
+	return nil, fmt.Errorf("unsupported value type %T", v)
+}
+
+func decodeHexString(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 != 0 {
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
+
+func decodeDecimal(s string) ([]byte, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("wrong number '%s'", s)
+	}
+	return n.Bytes(), nil
+}
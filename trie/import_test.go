@@ -0,0 +1,72 @@
+package trie_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportJSON(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("import json"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:500]
+			plain := make(map[string]string)
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				plain["0x"+hex.EncodeToString([]byte(s))] = "0x" + hex.EncodeToString([]byte(s+"$"))
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			doc, err := json.Marshal(plain)
+			require.NoError(t, err)
+			pairs, err := trie.ImportJSON(bytes.NewReader(doc))
+			require.NoError(t, err)
+			require.EqualValues(t, len(plain), trie.NumEntries(pairs))
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr), trie.ComputeRoot(m, pairs)))
+
+			genesis := `{
+				"config": {"chainId": 1},
+				"alloc": {
+					"0x0000000000000000000000000000000000000001": {"balance": "1000000000000000000", "nonce": 1},
+					"0x0000000000000000000000000000000000000002": {
+						"balance": "0x0",
+						"code": "0x6001",
+						"storage": {"0x00": "0x01", "0x01": "0xff"}
+					}
+				}
+			}`
+			pairs, err = trie.ImportJSON(strings.NewReader(genesis))
+			require.NoError(t, err)
+			addr1, _ := hex.DecodeString("0000000000000000000000000000000000000001")
+			addr2, _ := hex.DecodeString("0000000000000000000000000000000000000002")
+			expected := trie.NewInMemoryKVStore()
+			expected.Set(trie.Concat(addr1, byte(7), "balance"), []byte{0x0d, 0xe0, 0xb6, 0xb3, 0xa7, 0x64, 0x00, 0x00})
+			expected.Set(trie.Concat(addr1, byte(5), "nonce"), []byte{0x01})
+			expected.Set(trie.Concat(addr2, byte(7), "balance"), []byte{0x00})
+			expected.Set(trie.Concat(addr2, byte(4), "code"), []byte{0x60, 0x01})
+			expected.Set(trie.Concat(addr2, byte(7), "storage", byte(0x00)), []byte{0x01})
+			expected.Set(trie.Concat(addr2, byte(7), "storage", byte(0x01)), []byte{0xff})
+			require.EqualValues(t, trie.NumEntries(expected), trie.NumEntries(pairs))
+			expected.Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, v, pairs.Get(k))
+				return true
+			})
+			require.True(t, m.EqualCommitments(trie.ComputeRoot(m, expected), trie.ComputeRoot(m, pairs)))
+
+			for _, wrong := range []string{`[]`, `{"xyz": "0x01"}`, `{"0x01": "0xzz"}`, `{"0x01": true}`, `{"alloc": 1}`,
+				`{"0x01": {"storage": {"0x00": {"a": "0x01"}}}}`} {
+				_, err = trie.ImportJSON(strings.NewReader(wrong))
+				require.Error(t, err, wrong)
+			}
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,76 @@
+package trie
+
+import "fmt"
+
+// TrieInfo is the machine-readable configuration of the trie returned by Stats of Trie and TrieReader.
+// It is marshaled to JSON, so startup logs and monitoring can check the exact configuration programmatically.
+// Its String is the Info of the node store
+type TrieInfo struct {
+	// Type is the type of the node store, such as Trie or TrieReader
+	Type string `json:"type"`
+	// Model is the short name of the commitment model
+	Model            string `json:"model"`
+	ModelDescription string `json:"modelDescription"`
+	// PathArity is the number of children of the node: 256, 16 or 2
+	PathArity int `json:"pathArity"`
+	// CommitmentSize is the size of the serialized vector commitment in bytes, i.e. the hash size for hash based models
+	CommitmentSize         int  `json:"commitmentSize"`
+	OptimizeKeyCommitments bool `json:"optimizeKeyCommitments"`
+	AllowEmptyValues       bool `json:"allowEmptyValues"`
+	DigestIndex            bool `json:"digestIndex"`
+	ExpiryIndex            bool `json:"expiryIndex"`
+	ChangelogIndex         bool `json:"changelogIndex"`
+	OpLog                  bool `json:"opLog"`
+	ReadSnapshots          bool `json:"readSnapshots"`
+	Stats                  bool `json:"stats"`
+	ProfileCommits         bool `json:"profileCommits"`
+	// Codec is the name of the serialization of nodes
+	Codec string `json:"codec"`
+	// TerminalRules is the number of rules of the terminal policy
+	TerminalRules int `json:"terminalRules"`
+	// FixedKeyLength is the length of all keys, 0 means keys of any length
+	FixedKeyLength int `json:"fixedKeyLength"`
+	// ReadOnly is true if the Trie rejects mutations
+	ReadOnly bool `json:"readOnly"`
+	// ExpectedNodes is the capacity of the node cache of the Trie preallocated for the expected size, 0 if not preallocated
+	ExpectedNodes int `json:"expectedNodes"`
+	// TrieStore and ValueStore are Go types of the stores. Empty if the store is not provided
+	TrieStore  string `json:"trieStore"`
+	ValueStore string `json:"valueStore"`
+	// CachedNodes is the number of nodes in the cache of the Trie
+	CachedNodes int `json:"cachedNodes"`
+}
+
+// SetModel sets fields of the commitment model
+func (i *TrieInfo) SetModel(m CommitmentModel) {
+	i.Model = m.ShortName()
+	i.ModelDescription = m.Description()
+	i.PathArity = m.PathArity().NumChildren()
+	i.CommitmentSize = len(m.NewVectorCommitment().Bytes())
+}
+
+func (i *TrieInfo) String() string {
+	return fmt.Sprintf("%s( model: %s, path arity: %d, commitment size: %d, optimize key commitments: %v, allow empty values: %v, "+
+		"digest index: %v, expiry index: %v, changelog index: %v, op-log: %v, read snapshots: %v, stats: %v, profile commits: %v, codec: %s, terminal rules: %d, fixed key length: %d, read-only: %v, expected nodes: %d, trie store: %s, value store: %s, cached nodes: %d )",
+		i.Type, i.Model, i.PathArity, i.CommitmentSize, i.OptimizeKeyCommitments, i.AllowEmptyValues,
+		i.DigestIndex, i.ExpiryIndex, i.ChangelogIndex, i.OpLog, i.ReadSnapshots, i.Stats, i.ProfileCommits, i.Codec, i.TerminalRules, i.FixedKeyLength, i.ReadOnly, i.ExpectedNodes, i.TrieStore, i.ValueStore, i.CachedNodes)
+}
+
+// storeType returns Go type of the store, empty string for nil store
+func storeType(store KVReader) string {
+	if store == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", store)
+}
+
+func newTrieInfo(typ string, sr *nodeStore) *TrieInfo {
+	ret := &TrieInfo{
+		Type:       typ,
+		TrieStore:  storeType(sr.trieStore),
+		ValueStore: storeType(sr.valueStore),
+		Codec:      sr.codec.Name(),
+	}
+	ret.SetModel(sr.m)
+	return ret
+}
@@ -0,0 +1,57 @@
+package trie_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_dual"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrieInfo(t *testing.T) {
+	m := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	store := trie.NewInMemoryKVStore()
+	tr := trie.NewWithOptions(m, store, nil, trie.Options{
+		OptimizeKeyCommitments: true,
+		DigestIndex:            trie.NewInMemoryKVStore(),
+	})
+	tr.UpdateStr("a", "1")
+	tr.UpdateStr("b", "2")
+	info := tr.Stats()
+	require.EqualValues(t, "Trie", info.Type)
+	require.EqualValues(t, m.ShortName(), info.Model)
+	require.EqualValues(t, 16, info.PathArity)
+	require.EqualValues(t, 20, info.CommitmentSize)
+	require.True(t, info.OptimizeKeyCommitments)
+	require.False(t, info.AllowEmptyValues)
+	require.True(t, info.DigestIndex)
+	require.False(t, info.OpLog)
+	require.NotEmpty(t, info.TrieStore)
+	require.Empty(t, info.ValueStore)
+	require.True(t, info.CachedNodes > 0)
+
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+	var back trie.TrieInfo
+	require.NoError(t, json.Unmarshal(data, &back))
+	require.EqualValues(t, *info, back)
+	require.Contains(t, string(data), `"pathArity":16`)
+	require.Contains(t, info.String(), m.ShortName())
+	require.EqualValues(t, info.String(), tr.Info())
+
+	info = trie.NewTrieReader(trie_kzg_bn256.New(), store, trie.NewInMemoryKVStore()).Stats()
+	require.EqualValues(t, "TrieReader", info.Type)
+	require.EqualValues(t, 256, info.PathArity)
+	require.True(t, info.CommitmentSize > 0)
+	require.NotEmpty(t, info.ValueStore)
+	require.EqualValues(t, 0, info.CachedNodes)
+
+	dual := trie_dual.New(trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize256), trie_kzg_bn256.New())
+	projected := trie_dual.Projection(trie.NewTrieReader(dual, store, nil), 0).Info()
+	require.Contains(t, projected, "projection #0")
+	require.Contains(t, projected, dual.Model(0).ShortName())
+	require.Contains(t, projected, "TrieReader")
+}
@@ -0,0 +1,215 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ResumeToken is an opaque token which allows to continue iteration of keys from the key following
+// the last visited key. It can be persisted and used across process restarts, as long as the trie
+// has the same path arity
+type ResumeToken []byte
+
+const resumeTokenVersion = 0x01
+
+var ErrWrongResumeToken = errors.New("wrong resume token")
+
+func newResumeToken(key []byte) ResumeToken {
+	return Concat(byte(resumeTokenVersion), key)
+}
+
+func (t ResumeToken) key() ([]byte, error) {
+	if len(t) == 0 || t[0] != resumeTokenVersion {
+		return nil, ErrWrongResumeToken
+	}
+	return t[1:], nil
+}
+
+// IterateKeys iterates keys committed in the trie in the lexicographical order of keys, together with the terminal commitments.
+// If 'resume' is not nil, iteration starts from the key following the key the token was issued for.
+// Iteration stops when 'fun' returns false. In that case it returns token to resume iteration after the last visited key.
+// Returns nil token if all keys were visited.
+// For the Trie, it is expected all mutations are committed
+func IterateKeys(tr NodeStore, resume ResumeToken, fun func(key []byte, terminal TCommitment) bool) (ResumeToken, error) {
+	var after []byte
+	if resume != nil {
+		k, err := resume.key()
+		if err != nil {
+			return nil, err
+		}
+		after = UnpackBytes(k, tr.PathArity())
+	}
+	tracer, ctx := tracerOf(tr)
+	span := startSpan(ctx, tracer, SpanIterate)
+	defer span.End()
+	n, ok := tr.GetNode(nil)
+	if !ok {
+		return nil, nil
+	}
+	var ret ResumeToken
+	var err error
+	visited := 0
+	defer func() { span.SetAttribute(AttrKeysVisited, int64(visited)) }()
+	iterateKeys(tr, n, after, resume != nil, func(unpackedKey []byte, terminal TCommitment) bool {
+		visited++
+		var key []byte
+		if key, err = PackUnpackedBytes(unpackedKey, tr.PathArity()); err != nil {
+			return false
+		}
+		if !fun(key, terminal) {
+			ret = newResumeToken(key)
+			return false
+		}
+		return true
+	})
+	return ret, err
+}
+
+// iterateKeys visits terminals in the subtree of the node. If 'skip' is true, it only visits keys greater than 'after'
+func iterateKeys(tr NodeStore, n Node, after []byte, skip bool, fun func(unpackedKey []byte, terminal TCommitment) bool) bool {
+	path := Concat(n.Key(), n.PathFragment())
+	if skip && !bytes.HasPrefix(after, path) {
+		if bytes.Compare(path, after) < 0 {
+			// all keys of the subtree precede 'after'
+			return true
+		}
+		// all keys of the subtree follow 'after'
+		skip = false
+	}
+	// if still 'skip', 'path' is a prefix of 'after', so terminal of the node precedes or is equal to 'after'
+	if !skip && n.Terminal() != nil {
+		if !fun(path, n.Terminal()) {
+			return false
+		}
+	}
+	children := n.ChildCommitments()
+	first := 0
+	if skip && len(after) > len(path) {
+		first = int(after[len(path)])
+	}
+	for i := first; i < tr.PathArity().NumChildren(); i++ {
+		if _, ok := children[byte(i)]; !ok {
+			continue
+		}
+		child, ok := tr.GetNode(childKey(n, byte(i)))
+		if !ok {
+			continue
+		}
+		if !iterateKeys(tr, child, after, skip, fun) {
+			return false
+		}
+	}
+	return true
+}
+
+// IterateKeys iterates keys committed in the trie. See IterateKeys
+func (tr *Trie) IterateKeys(resume ResumeToken, fun func(key []byte, terminal TCommitment) bool) (ResumeToken, error) {
+	return IterateKeys(tr, resume, fun)
+}
+
+// IterateKeys iterates keys committed in the trie. See IterateKeys
+func (tr *TrieReader) IterateKeys(resume ResumeToken, fun func(key []byte, terminal TCommitment) bool) (ResumeToken, error) {
+	return IterateKeys(tr, resume, fun)
+}
+
+// IteratePrefixDepth iterates keys with the prefix (in original, packed bytes), together with terminal commitments,
+// in the lexicographical order of keys. Only keys which are not longer than the prefix plus 'maxDepth' are visited.
+// Length is measured in unpacked bytes, i.e. in bytes, nibbles or bits for PathArity256, PathArity16 and PathArity2
+// respectively. Subtrees which contain only longer keys are skipped without reading them, so it is efficient
+// to list immediate children of a namespace with maxDepth = len(child key suffix).
+// Iteration stops when 'fun' returns false.
+// For the Trie, it is expected all mutations are committed
+func IteratePrefixDepth(tr NodeStore, prefix []byte, maxDepth int, fun func(key []byte, terminal TCommitment) bool) error {
+	if maxDepth < 0 {
+		return fmt.Errorf("trie::IteratePrefixDepth: wrong depth %d", maxDepth)
+	}
+	unpackedPrefix := UnpackBytes(prefix, tr.PathArity())
+	n, ok := findNodeByPrefix(tr, unpackedPrefix)
+	if !ok {
+		return nil
+	}
+	var err error
+	iterateKeysDepth(tr, n, len(unpackedPrefix)+maxDepth, func(unpackedKey []byte, terminal TCommitment) bool {
+		var key []byte
+		if key, err = PackUnpackedBytes(unpackedKey, tr.PathArity()); err != nil {
+			return false
+		}
+		return fun(key, terminal)
+	})
+	return err
+}
+
+// iterateKeysDepth visits terminals in the subtree of the node with unpacked keys not longer than maxLen
+func iterateKeysDepth(tr NodeStore, n Node, maxLen int, fun func(unpackedKey []byte, terminal TCommitment) bool) bool {
+	path := Concat(n.Key(), n.PathFragment())
+	if len(path) > maxLen {
+		// all keys of the subtree are longer
+		return true
+	}
+	if n.Terminal() != nil {
+		if !fun(path, n.Terminal()) {
+			return false
+		}
+	}
+	if len(path) == maxLen {
+		return true
+	}
+	children := n.ChildCommitments()
+	for i := 0; i < tr.PathArity().NumChildren(); i++ {
+		if _, ok := children[byte(i)]; !ok {
+			continue
+		}
+		child, ok := tr.GetNode(childKey(n, byte(i)))
+		if !ok {
+			continue
+		}
+		if !iterateKeysDepth(tr, child, maxLen, fun) {
+			return false
+		}
+	}
+	return true
+}
+
+// IteratePrefixDepth iterates keys with the prefix up to the depth. See IteratePrefixDepth
+func (tr *Trie) IteratePrefixDepth(prefix []byte, maxDepth int, fun func(key []byte, terminal TCommitment) bool) error {
+	return IteratePrefixDepth(tr, prefix, maxDepth, fun)
+}
+
+// IteratePrefixDepth iterates keys with the prefix up to the depth. See IteratePrefixDepth
+func (tr *TrieReader) IteratePrefixDepth(prefix []byte, maxDepth int, fun func(key []byte, terminal TCommitment) bool) error {
+	return IteratePrefixDepth(tr, prefix, maxDepth, fun)
+}
+
+// DeletePrefix deletes all keys with the prefix (in original, packed bytes) and returns the number of deleted keys.
+// Empty prefix deletes all keys. If 'fun' is provided, it is called for each deleted key, in the lexicographical order
+// of keys, with the value read from the value store of the trie (nil if the trie has no value store), so the caller can
+// maintain secondary indexes and accounting of the wiped namespace. The prefix and keys are as inserted into the trie,
+// i.e. transformed by the middleware, if any. Values are not deleted from the value store.
+// It is expected all mutations are committed
+func (tr *Trie) DeletePrefix(prefix []byte, fun ...func(key, value []byte)) (int, error) {
+	if err := tr.checkWritable("DeletePrefix"); err != nil {
+		return 0, err
+	}
+	var keys [][]byte
+	err := IteratePrefixDepth(tr, prefix, math.MaxInt32, func(key []byte, _ TCommitment) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return 0, fmt.Errorf("trie::DeletePrefix: %w", err)
+	}
+	for _, key := range keys {
+		if len(fun) > 0 && fun[0] != nil {
+			var value []byte
+			if tr.nodeStore.reader.valueStore != nil {
+				value = tr.nodeStore.reader.valueStore.Get(key)
+			}
+			fun[0](key, value)
+		}
+		tr.delete(key)
+	}
+	tr.log.Debugf("trie: deleted %d keys with prefix %x", len(keys), prefix)
+	return len(keys), nil
+}
@@ -0,0 +1,178 @@
+package trie_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterateKeys(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("iterate keys"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			unique := make(map[string]struct{})
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+				unique[s] = struct{}{}
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			rdr := trie.NewTrieReader(m, store, nil)
+
+			all := make([]string, 0)
+			token, err := rdr.IterateKeys(nil, func(key []byte, terminal trie.TCommitment) bool {
+				require.True(t, m.EqualCommitments(m.CommitToData([]byte(string(key)+"$")), terminal))
+				all = append(all, string(key))
+				return true
+			})
+			require.NoError(t, err)
+			require.Nil(t, token)
+			require.EqualValues(t, len(unique), len(all))
+			require.True(t, sort.StringsAreSorted(all))
+
+			chunks := make([]string, 0)
+			for {
+				count := 0
+				token, err = rdr.IterateKeys(token, func(key []byte, _ trie.TCommitment) bool {
+					chunks = append(chunks, string(key))
+					count++
+					return count < 7
+				})
+				require.NoError(t, err)
+				if token == nil {
+					break
+				}
+			}
+			require.EqualValues(t, all, chunks)
+
+			_, err = rdr.IterateKeys(trie.ResumeToken{0xFF}, func(_ []byte, _ trie.TCommitment) bool {
+				return true
+			})
+			require.ErrorIs(t, err, trie.ErrWrongResumeToken)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
+
+func TestIteratePrefixDepth(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("iterate prefix depth"+tn(m), func(t *testing.T) {
+			data := append(genRnd4()[:1000], "ns", "ns/a", "ns/b", "ns/a/1", "ns/a/2", "ns/c/1/x", "nt")
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			rdr := trie.NewTrieReader(m, store, nil)
+
+			unpackedLen := func(s string) int {
+				return len(trie.UnpackBytes([]byte(s), m.PathArity()))
+			}
+			for _, prefix := range []string{"", "a", "ns", "ns/", "ns/a", "xyz"} {
+				for _, depth := range []int{0, 1, 2, 3, 8, 100} {
+					expected := make([]string, 0)
+					_, err := rdr.IterateKeys(nil, func(key []byte, _ trie.TCommitment) bool {
+						if strings.HasPrefix(string(key), prefix) && unpackedLen(string(key)) <= unpackedLen(prefix)+depth {
+							expected = append(expected, string(key))
+						}
+						return true
+					})
+					require.NoError(t, err)
+					actual := make([]string, 0)
+					err = rdr.IteratePrefixDepth([]byte(prefix), depth, func(key []byte, terminal trie.TCommitment) bool {
+						require.True(t, m.EqualCommitments(m.CommitToData([]byte(string(key)+"$")), terminal))
+						actual = append(actual, string(key))
+						return true
+					})
+					require.NoError(t, err)
+					require.EqualValues(t, expected, actual, "prefix: '%s', depth: %d", prefix, depth)
+				}
+			}
+			children := make([]string, 0)
+			err := rdr.IteratePrefixDepth([]byte("ns/"), unpackedLen("a"), func(key []byte, _ trie.TCommitment) bool {
+				children = append(children, string(key))
+				return true
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, []string{"ns/a", "ns/b"}, children)
+
+			count := 0
+			err = rdr.IteratePrefixDepth(nil, 100, func(_ []byte, _ trie.TCommitment) bool {
+				count++
+				return count < 5
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, 5, count)
+
+			require.Error(t, rdr.IteratePrefixDepth(nil, -1, func(_ []byte, _ trie.TCommitment) bool { return true }))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
+
+func TestDeletePrefix(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("delete prefix"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:400]
+			namespaces := []string{"acc/", "acc", "ac/", "bal/"}
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, trie.NewInMemoryKVStore(), valueStore)
+			reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			expected := make(map[string]string)
+			all := make(map[string]struct{})
+			for i, s := range data {
+				ns := namespaces[i%len(namespaces)]
+				k, v := ns+s, "v"+s
+				all[k] = struct{}{}
+				tr.UpdateStr(k, v)
+				valueStore.Set([]byte(k), []byte(v))
+				if ns != "acc/" {
+					reference.UpdateStr(k, v)
+				} else {
+					expected[k] = v
+				}
+			}
+			tr.Commit()
+			reference.Commit()
+
+			n, err := tr.DeletePrefix([]byte("xyz"))
+			require.NoError(t, err)
+			require.EqualValues(t, 0, n)
+
+			var deleted []string
+			n, err = tr.DeletePrefix([]byte("acc/"), func(key, value []byte) {
+				require.EqualValues(t, expected[string(key)], string(value))
+				deleted = append(deleted, string(key))
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, len(expected), n)
+			require.EqualValues(t, len(expected), len(deleted))
+			require.True(t, sort.StringsAreSorted(deleted))
+			tr.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+
+			n, err = tr.DeletePrefix(nil)
+			require.NoError(t, err)
+			require.EqualValues(t, len(all)-len(expected), n)
+			tr.Commit()
+			require.Nil(t, trie.RootCommitment(tr))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
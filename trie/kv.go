@@ -1,7 +1,10 @@
 package trie
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
@@ -12,7 +15,11 @@ import (
 //----------------------------------------------------------------------------
 // abstraction interfaces of key/value storage
 
-// KVReader is a key/value reader
+// KVReader is a key/value reader.
+// Slices returned by Get and passed to callbacks of iterations are owned by the store unless the store says otherwise:
+// they may alias memory of the store, such as the mapped file of the SortedTable, so the caller must not modify them
+// and must copy them to retain them beyond the next mutation of the store or beyond closing of it.
+// Wrap the store with NewCopyOnReturnKVStore to always receive copies owned by the caller
 type KVReader interface {
 	// Get retrieves value by key. Returned nil means absence of the key
 	Get(key []byte) []byte
@@ -33,6 +40,39 @@ type KVIterator interface {
 	Iterate(func(k, v []byte) bool)
 }
 
+// KVPrefixIterator is implemented by key/value stores which are able to iterate keys with the prefix
+// without scanning the whole store. Keys passed to the callback are full keys, including the prefix
+type KVPrefixIterator interface {
+	IteratePrefix(prefix []byte, f func(k, v []byte) bool)
+	IterateKeysPrefix(prefix []byte, f func(k []byte) bool)
+}
+
+// IteratePrefix iterates key/value pairs with the prefix. If the iterator implements KVPrefixIterator,
+// iteration is bounded by the store, otherwise all pairs are iterated and filtered
+func IteratePrefix(it KVIterator, prefix []byte, f func(k, v []byte) bool) {
+	if pi, ok := it.(KVPrefixIterator); ok {
+		pi.IteratePrefix(prefix, f)
+		return
+	}
+	it.Iterate(func(k, v []byte) bool {
+		if !bytes.HasPrefix(k, prefix) {
+			return true
+		}
+		return f(k, v)
+	})
+}
+
+// IterateKeysPrefix iterates keys with the prefix, same as IteratePrefix
+func IterateKeysPrefix(it KVIterator, prefix []byte, f func(k []byte) bool) {
+	if pi, ok := it.(KVPrefixIterator); ok {
+		pi.IterateKeysPrefix(prefix, f)
+		return
+	}
+	IteratePrefix(it, prefix, func(k, _ []byte) bool {
+		return f(k)
+	})
+}
+
 // KVStore is a compound interface
 type KVStore interface {
 	KVReader
@@ -46,40 +86,125 @@ type KVBatchedUpdater interface {
 	Commit() error
 }
 
+// InMemoryKVStoreOptions are optional parameters of NewInMemoryKVStore
+type InMemoryKVStoreOptions struct {
+	// Copy makes the store copy values upon Set and upon return from Get and Iterate, so the caller owns returned
+	// values and may retain and modify them. By default, the store is zero-copy: it keeps values passed to Set
+	// and returns them as they are, so values must not be modified after Set, neither by the writer, nor by readers
+	Copy bool
+}
+
 // inMemoryKVStore is a KVStore implementation. Mostly used for testing
-var _ KVStore = inMemoryKVStore{}
+var _ KVStore = &inMemoryKVStore{}
 
-type inMemoryKVStore map[string][]byte
+type inMemoryKVStore struct {
+	m    map[string][]byte
+	copy bool
+}
+
+func NewInMemoryKVStore(opt ...InMemoryKVStoreOptions) KVStore {
+	ret := &inMemoryKVStore{m: make(map[string][]byte)}
+	if len(opt) > 0 {
+		ret.copy = opt[0].Copy
+	}
+	return ret
+}
 
-func NewInMemoryKVStore() KVStore {
-	return make(inMemoryKVStore)
+func (im *inMemoryKVStore) value(v []byte) []byte {
+	if !im.copy {
+		return v
+	}
+	return copyBytes(v)
 }
 
-func (im inMemoryKVStore) Get(k []byte) []byte {
-	return im[string(k)]
+func (im *inMemoryKVStore) Get(k []byte) []byte {
+	return im.value(im.m[string(k)])
 }
 
-func (im inMemoryKVStore) Has(k []byte) bool {
-	_, ok := im[string(k)]
+func (im *inMemoryKVStore) Has(k []byte) bool {
+	_, ok := im.m[string(k)]
 	return ok
 }
 
-func (im inMemoryKVStore) Iterate(f func(k []byte, v []byte) bool) {
-	for k, v := range im {
-		if !f([]byte(k), v) {
+func (im *inMemoryKVStore) Iterate(f func(k []byte, v []byte) bool) {
+	for k, v := range im.m {
+		if !f([]byte(k), im.value(v)) {
 			return
 		}
 	}
 }
 
-func (im inMemoryKVStore) Set(k, v []byte) {
+func (im *inMemoryKVStore) Set(k, v []byte) {
 	if len(v) != 0 {
-		im[string(k)] = v
+		im.m[string(k)] = im.value(v)
 	} else {
-		delete(im, string(k))
+		delete(im.m, string(k))
 	}
 }
 
+// copyBytes returns the copy of the slice. Nil remains nil, so absence of the key is preserved
+func copyBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	ret := make([]byte, len(data))
+	copy(ret, data)
+	return ret
+}
+
+// copyOnReturnStore returns copies of keys and values of the underlying store
+type copyOnReturnStore struct {
+	store KVReader
+}
+
+// NewCopyOnReturnKVStore wraps the store, so that Get and iterations return copies of keys and values, which
+// are owned by the caller. It enforces the ownership over zero-copy stores, for example to retain values read from
+// the SortedTable after it is closed. Set writes to the store, iterations iterate the store. Set and iterations panic
+// if the store is not a KVWriter or a KVIterator respectively
+func NewCopyOnReturnKVStore(store KVReader) KVStore {
+	return &copyOnReturnStore{store: store}
+}
+
+func (c *copyOnReturnStore) Get(key []byte) []byte {
+	return copyBytes(c.store.Get(key))
+}
+
+func (c *copyOnReturnStore) Has(key []byte) bool {
+	return c.store.Has(key)
+}
+
+func (c *copyOnReturnStore) Set(key, value []byte) {
+	w, ok := c.store.(KVWriter)
+	Assert(ok, "trie::copyOnReturnStore: the store is not a KVWriter")
+	w.Set(key, value)
+}
+
+func (c *copyOnReturnStore) iterator() KVIterator {
+	it, ok := c.store.(KVIterator)
+	Assert(ok, "trie::copyOnReturnStore: the store is not a KVIterator")
+	return it
+}
+
+func (c *copyOnReturnStore) Iterate(f func(k, v []byte) bool) {
+	c.iterator().Iterate(func(k, v []byte) bool {
+		return f(copyBytes(k), copyBytes(v))
+	})
+}
+
+// IteratePrefix implements KVPrefixIterator
+func (c *copyOnReturnStore) IteratePrefix(prefix []byte, f func(k, v []byte) bool) {
+	IteratePrefix(c.iterator(), prefix, func(k, v []byte) bool {
+		return f(copyBytes(k), copyBytes(v))
+	})
+}
+
+// IterateKeysPrefix implements KVPrefixIterator
+func (c *copyOnReturnStore) IterateKeysPrefix(prefix []byte, f func(k []byte) bool) {
+	IterateKeysPrefix(c.iterator(), prefix, func(k []byte) bool {
+		return f(copyBytes(k))
+	})
+}
+
 //----------------------------------------------------------------------------
 // interfaces for writing/reading persistent streams of key/value pairs
 
@@ -214,25 +339,76 @@ func (fs *BinaryStreamFileIterator) Close() error {
 }
 
 // RandStreamIterator is a stream of random key/value pairs with the given parameters
-// Used for testing
+// Used for testing. The stream is fully determined by the parameters, so corpora are reproduced from the manifest
+// (see WriteManifest) on any machine
 var _ KVStreamIterator = &RandStreamIterator{}
 
 type RandStreamIterator struct {
 	rnd   *rand.Rand
 	par   RandStreamParams
 	count int
+	// recent are keys generated last, candidates for duplicates and deletions
+	recent [][]byte
+	next   int
 }
 
+// Distribution is the distribution of random lengths in the range [1, max]
+type Distribution string
+
+const (
+	// DistributionUniform is the uniform distribution of lengths, the default
+	DistributionUniform = Distribution("uniform")
+	// DistributionFixed means all lengths are equal to the maximum
+	DistributionFixed = Distribution("fixed")
+	// DistributionExponential is the exponential distribution with the mean of 1/4 of the maximum, truncated to the maximum.
+	// Most lengths are short with the long tail, as values of real states
+	DistributionExponential = Distribution("exponential")
+)
+
 // RandStreamParams represents parameters of the RandStreamIterator
 type RandStreamParams struct {
 	// Seed for deterministic randomization
-	Seed int64
+	Seed int64 `json:"seed"`
 	// NumKVPairs maximum number of key value pairs to generate. 0 means infinite
-	NumKVPairs int
+	NumKVPairs int `json:"numKVPairs"`
 	// MaxKey maximum length of key (randomly generated)
-	MaxKey int
+	MaxKey int `json:"maxKey"`
 	// MaxValue maximum length of value (randomly generated)
-	MaxValue int
+	MaxValue int `json:"maxValue"`
+	// KeyDistribution and ValueDistribution are distributions of lengths of keys and values. Empty means uniform
+	KeyDistribution   Distribution `json:"keyDistribution,omitempty"`
+	ValueDistribution Distribution `json:"valueDistribution,omitempty"`
+	// DuplicateKeyProbability is the probability that the pair updates one of the recently generated keys
+	// instead of the new key
+	DuplicateKeyProbability float64 `json:"duplicateKeyProbability,omitempty"`
+	// DeleteProbability is the probability that the pair is the delete marker, i.e. one of the recently generated
+	// keys with the empty value
+	DeleteProbability float64 `json:"deleteProbability,omitempty"`
+}
+
+// randStreamRecentKeys is the number of recently generated keys, which are duplicated and deleted
+const randStreamRecentKeys = 1024
+
+// Validate checks parameters
+func (p RandStreamParams) Validate() error {
+	if p.NumKVPairs < 0 {
+		return fmt.Errorf("rand stream: wrong number of pairs %d", p.NumKVPairs)
+	}
+	if p.MaxKey < 1 || p.MaxValue < 1 {
+		return fmt.Errorf("rand stream: maximum key and value lengths must be positive")
+	}
+	for _, d := range []Distribution{p.KeyDistribution, p.ValueDistribution} {
+		switch d {
+		case "", DistributionUniform, DistributionFixed, DistributionExponential:
+		default:
+			return fmt.Errorf("rand stream: unknown distribution '%s'", d)
+		}
+	}
+	if p.DuplicateKeyProbability < 0 || p.DeleteProbability < 0 || p.DuplicateKeyProbability+p.DeleteProbability > 1 {
+		return fmt.Errorf("rand stream: wrong probabilities of duplicates %f and deletions %f",
+			p.DuplicateKeyProbability, p.DeleteProbability)
+	}
+	return nil
 }
 
 func NewRandStreamIterator(p ...RandStreamParams) *RandStreamIterator {
@@ -251,16 +427,77 @@ func NewRandStreamIterator(p ...RandStreamParams) *RandStreamIterator {
 	return ret
 }
 
+// Params returns parameters of the stream
+func (r *RandStreamIterator) Params() RandStreamParams {
+	return r.par
+}
+
+// length returns random length in [1, max]. Uniform distribution is the same as in previous versions of the generator,
+// so old corpora are reproduced from their seeds
+func (r *RandStreamIterator) length(d Distribution, max int) int {
+	switch d {
+	case DistributionFixed:
+		return max
+	case DistributionExponential:
+		ret := int(r.rnd.ExpFloat64()*float64(max)/4) + 1
+		if ret > max {
+			ret = max
+		}
+		return ret
+	}
+	if max <= 1 {
+		return 1
+	}
+	return r.rnd.Intn(max-1) + 1
+}
+
+// recentKey returns one of the recently generated keys, nil if none
+func (r *RandStreamIterator) recentKey() []byte {
+	if len(r.recent) == 0 {
+		return nil
+	}
+	return r.recent[r.rnd.Intn(len(r.recent))]
+}
+
+func (r *RandStreamIterator) remember(k []byte) {
+	if len(r.recent) < randStreamRecentKeys {
+		r.recent = append(r.recent, k)
+		return
+	}
+	r.recent[r.next] = k
+	r.next = (r.next + 1) % randStreamRecentKeys
+}
+
 func (r *RandStreamIterator) Iterate(fun func(k []byte, v []byte) bool) error {
 	max := r.par.NumKVPairs
 	if max <= 0 {
 		max = math.MaxInt
 	}
 	for r.count < max {
-		k := make([]byte, r.rnd.Intn(r.par.MaxKey-1)+1)
-		r.rnd.Read(k)
-		v := make([]byte, r.rnd.Intn(r.par.MaxValue-1)+1)
-		r.rnd.Read(v)
+		var k, v []byte
+		var dice float64
+		if r.par.DuplicateKeyProbability > 0 || r.par.DeleteProbability > 0 {
+			dice = r.rnd.Float64()
+		}
+		switch {
+		case dice < r.par.DeleteProbability:
+			if k = r.recentKey(); k != nil {
+				v = []byte{}
+			}
+		case dice < r.par.DeleteProbability+r.par.DuplicateKeyProbability:
+			k = r.recentKey()
+		}
+		if k == nil {
+			k = make([]byte, r.length(r.par.KeyDistribution, r.par.MaxKey))
+			r.rnd.Read(k)
+			if r.par.DuplicateKeyProbability > 0 || r.par.DeleteProbability > 0 {
+				r.remember(k)
+			}
+		}
+		if v == nil {
+			v = make([]byte, r.length(r.par.ValueDistribution, r.par.MaxValue))
+			r.rnd.Read(v)
+		}
 		if !fun(k, v) {
 			return nil
 		}
@@ -268,3 +505,43 @@ func (r *RandStreamIterator) Iterate(fun func(k []byte, v []byte) bool) error {
 	}
 	return nil
 }
+
+// randStreamGenerator identifies the algorithm of the generator in the manifest
+const randStreamGenerator = "trie.RandStreamIterator/v1"
+
+// RandStreamManifest describes generation of the corpus, so it can be reproduced exactly
+type RandStreamManifest struct {
+	Generator string           `json:"generator"`
+	Params    RandStreamParams `json:"params"`
+}
+
+// WriteManifest writes the JSON manifest of the parameters of the stream to the file
+func (r *RandStreamIterator) WriteManifest(fname string) error {
+	data, err := json.MarshalIndent(RandStreamManifest{
+		Generator: randStreamGenerator,
+		Params:    r.par,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fname, data, 0o644)
+}
+
+// ReadRandStreamManifest reads parameters of the stream from the manifest file written by WriteManifest
+func ReadRandStreamManifest(fname string) (RandStreamParams, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return RandStreamParams{}, err
+	}
+	var m RandStreamManifest
+	if err = json.Unmarshal(data, &m); err != nil {
+		return RandStreamParams{}, fmt.Errorf("rand stream manifest: %w", err)
+	}
+	if m.Generator != randStreamGenerator {
+		return RandStreamParams{}, fmt.Errorf("rand stream manifest: unsupported generator '%s'", m.Generator)
+	}
+	if err = m.Params.Validate(); err != nil {
+		return RandStreamParams{}, err
+	}
+	return m.Params, nil
+}
@@ -0,0 +1,165 @@
+package trie_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func collectRandStream(t *testing.T, it *trie.RandStreamIterator) [][2][]byte {
+	var ret [][2][]byte
+	require.NoError(t, it.Iterate(func(k, v []byte) bool {
+		ret = append(ret, [2][]byte{k, v})
+		return true
+	}))
+	return ret
+}
+
+func TestRandStreamIterator(t *testing.T) {
+	t.Run("compatible", func(t *testing.T) {
+		// zero extended parameters generate the same stream as before
+		par := trie.RandStreamParams{Seed: 42, NumKVPairs: 100, MaxKey: 10, MaxValue: 20}
+		rnd := rand.New(rand.NewSource(par.Seed))
+		for _, kv := range collectRandStream(t, trie.NewRandStreamIterator(par)) {
+			k := make([]byte, rnd.Intn(par.MaxKey-1)+1)
+			rnd.Read(k)
+			v := make([]byte, rnd.Intn(par.MaxValue-1)+1)
+			rnd.Read(v)
+			require.EqualValues(t, k, kv[0])
+			require.EqualValues(t, v, kv[1])
+		}
+	})
+	t.Run("distributions", func(t *testing.T) {
+		par := trie.RandStreamParams{
+			Seed:                    7,
+			NumKVPairs:              10000,
+			MaxKey:                  32,
+			MaxValue:                1000,
+			KeyDistribution:         trie.DistributionFixed,
+			ValueDistribution:       trie.DistributionExponential,
+			DuplicateKeyProbability: 0.2,
+			DeleteProbability:       0.1,
+		}
+		require.NoError(t, par.Validate())
+		stream := collectRandStream(t, trie.NewRandStreamIterator(par))
+		require.EqualValues(t, par.NumKVPairs, len(stream))
+		seen := make(map[string]struct{})
+		dups, deletes, short := 0, 0, 0
+		for _, kv := range stream {
+			require.EqualValues(t, 32, len(kv[0]))
+			require.True(t, len(kv[1]) <= par.MaxValue)
+			if len(kv[1]) == 0 {
+				deletes++
+				_, ok := seen[string(kv[0])]
+				require.True(t, ok)
+				continue
+			}
+			if len(kv[1]) <= par.MaxValue/2 {
+				short++
+			}
+			if _, ok := seen[string(kv[0])]; ok {
+				dups++
+			}
+			seen[string(kv[0])] = struct{}{}
+		}
+		require.InDelta(t, 1000, deletes, 150)
+		require.InDelta(t, 2000, dups, 200)
+		require.True(t, short > len(stream)*3/4)
+	})
+	t.Run("manifest", func(t *testing.T) {
+		par := trie.RandStreamParams{
+			Seed:                    time.Now().UnixNano(),
+			NumKVPairs:              1000,
+			MaxKey:                  40,
+			MaxValue:                100,
+			KeyDistribution:         trie.DistributionExponential,
+			DuplicateKeyProbability: 0.3,
+			DeleteProbability:       0.05,
+		}
+		it := trie.NewRandStreamIterator(par)
+		fname := t.TempDir() + "/corpus.manifest.json"
+		require.NoError(t, it.WriteManifest(fname))
+		expected := collectRandStream(t, it)
+
+		back, err := trie.ReadRandStreamManifest(fname)
+		require.NoError(t, err)
+		require.EqualValues(t, par, back)
+		require.EqualValues(t, expected, collectRandStream(t, trie.NewRandStreamIterator(back)))
+	})
+	t.Run("validate", func(t *testing.T) {
+		require.Error(t, trie.RandStreamParams{MaxKey: 0, MaxValue: 1}.Validate())
+		require.Error(t, trie.RandStreamParams{MaxKey: 1, MaxValue: 1, KeyDistribution: "normal"}.Validate())
+		require.Error(t, trie.RandStreamParams{MaxKey: 1, MaxValue: 1, DuplicateKeyProbability: 0.6, DeleteProbability: 0.6}.Validate())
+		require.NoError(t, trie.RandStreamParams{MaxKey: 1, MaxValue: 1}.Validate())
+	})
+}
+
+func TestKVOwnership(t *testing.T) {
+	t.Run("copying in-memory store", func(t *testing.T) {
+		store := trie.NewInMemoryKVStore(trie.InMemoryKVStoreOptions{Copy: true})
+		value := []byte("value")
+		store.Set([]byte("key"), value)
+		value[0] = 'X'
+		require.EqualValues(t, "value", string(store.Get([]byte("key"))))
+		store.Get([]byte("key"))[0] = 'X'
+		store.Iterate(func(k, v []byte) bool {
+			v[0] = 'X'
+			return true
+		})
+		require.EqualValues(t, "value", string(store.Get([]byte("key"))))
+	})
+	t.Run("zero-copy in-memory store", func(t *testing.T) {
+		store := trie.NewInMemoryKVStore()
+		value := []byte("value")
+		store.Set([]byte("key"), value)
+		value[0] = 'X'
+		require.EqualValues(t, "Xalue", string(store.Get([]byte("key"))))
+	})
+	t.Run("copy on return", func(t *testing.T) {
+		m := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256)
+		store := trie.NewInMemoryKVStore()
+		tr := trie.New(m, store, nil)
+		for _, s := range genData1()[:100] {
+			tr.UpdateStr(s, s+"$")
+		}
+		tr.Commit()
+		tr.PersistMutations(store)
+		var buf bytes.Buffer
+		_, err := trie.WriteSortedTable(&buf, store)
+		require.NoError(t, err)
+		table, err := trie.NewSortedTable(buf.Bytes())
+		require.NoError(t, err)
+		copying := trie.NewCopyOnReturnKVStore(table)
+		require.True(t, m.EqualCommitments(trie.RootCommitment(tr), trie.RootCommitment(trie.NewTrieReader(m, copying, nil))))
+
+		n := 0
+		copying.Iterate(func(k, v []byte) bool {
+			copying.Get(k)[0] ^= 0xff
+			v[0] ^= 0xff
+			if len(k) > 0 {
+				k[0] ^= 0xff
+			}
+			n++
+			return true
+		})
+		require.EqualValues(t, table.Len(), n)
+		trie.IteratePrefix(copying, nil, func(k, v []byte) bool {
+			require.EqualValues(t, store.Get(k), v)
+			return true
+		})
+		// the table itself is zero-copy
+		var k []byte
+		table.Iterate(func(key, _ []byte) bool {
+			k = key
+			return len(k) == 0
+		})
+		table.Get(k)[0] ^= 0xff
+		require.NotEqualValues(t, store.Get(k), table.Get(k))
+		require.Panics(t, func() { copying.Set(k, []byte("value")) })
+	})
+}
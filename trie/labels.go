@@ -0,0 +1,120 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// RootLabelPrefix is the prefix of keys of root labels in the metadata store (see StoreLayout.MetadataStore)
+var RootLabelPrefix = []byte("trie_label:")
+
+// maxRootLabelSize is the maximal length of the label, so the key of the label fits into the key of any store
+const maxRootLabelSize = 256
+
+// RootLabels is the persistent registry of human-readable labels of root commitments, for example "block-1234".
+// Tools reference historical states by labels instead of hex commitments. Labels are kept in the metadata store,
+// the label is assigned to one root, while the root may have many labels. Labels do not keep the state
+// from being overwritten or pruned, they are only names
+type RootLabels struct {
+	model CommitmentModel
+	store KVStore
+}
+
+// NewRootLabels creates the registry of labels of roots of the model in the metadata store
+func NewRootLabels(model CommitmentModel, store KVStore) *RootLabels {
+	return &RootLabels{
+		model: model,
+		store: store,
+	}
+}
+
+func rootLabelKey(label string) []byte {
+	return Concat(RootLabelPrefix, label)
+}
+
+// rootLabelRecord is the root commitment with the marker byte, so the record of the empty state is not empty
+func rootLabelRecord(root VCommitment) []byte {
+	if root == nil {
+		return []byte{0x01}
+	}
+	return Concat(byte(0x01), root.Bytes())
+}
+
+// Tag assigns the label to the root. The label previously assigned to another root is moved. Nil root is the empty state
+func (l *RootLabels) Tag(root VCommitment, label string) error {
+	if len(label) == 0 || len(label) > maxRootLabelSize {
+		return fmt.Errorf("trie::RootLabels.Tag: wrong length of the label: %d", len(label))
+	}
+	l.store.Set(rootLabelKey(label), rootLabelRecord(root))
+	return nil
+}
+
+// Untag removes the label. Removal of the absent label has no effect
+func (l *RootLabels) Untag(label string) {
+	l.store.Set(rootLabelKey(label), nil)
+}
+
+// Resolve returns the root with the label. Returns false if the label is absent. Nil root is the empty state
+func (l *RootLabels) Resolve(label string) (VCommitment, bool, error) {
+	rec := l.store.Get(rootLabelKey(label))
+	if len(rec) == 0 {
+		return nil, false, nil
+	}
+	ret, err := l.rootFromRecord(rec)
+	if err != nil {
+		return nil, false, fmt.Errorf("trie::RootLabels.Resolve: label '%s': %w", label, err)
+	}
+	return ret, true, nil
+}
+
+func (l *RootLabels) rootFromRecord(rec []byte) (VCommitment, error) {
+	if rec[0] != 0x01 {
+		return nil, errors.New("wrong record of the label")
+	}
+	if len(rec) == 1 {
+		return nil, nil
+	}
+	ret := l.model.NewVectorCommitment()
+	rdr := bytes.NewReader(rec[1:])
+	if err := ret.Read(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+// Iterate calls the function for each label and its root until it returns false. Order of labels is the order
+// of iteration of the store
+func (l *RootLabels) Iterate(fun func(label string, root VCommitment) bool) error {
+	var err error
+	IteratePrefix(l.store, RootLabelPrefix, func(k, v []byte) bool {
+		if len(v) == 0 {
+			return true
+		}
+		label := string(k[len(RootLabelPrefix):])
+		root, e := l.rootFromRecord(v)
+		if e != nil {
+			err = fmt.Errorf("trie::RootLabels.Iterate: label '%s': %w", label, e)
+			return false
+		}
+		return fun(label, root)
+	})
+	return err
+}
+
+// Labels returns labels of the root in the lexicographical order
+func (l *RootLabels) Labels(root VCommitment) ([]string, error) {
+	ret := make([]string, 0)
+	err := l.Iterate(func(label string, r VCommitment) bool {
+		if l.model.EqualCommitments(r, root) {
+			ret = append(ret, label)
+		}
+		return true
+	})
+	sort.Strings(ret)
+	return ret, err
+}
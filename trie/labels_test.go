@@ -0,0 +1,80 @@
+package trie_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootLabels(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("root labels"+tn(m), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			layout := trie.DefaultStoreLayout
+			tr := trie.New(m, layout.NodeStore(store), nil)
+			labels := trie.NewRootLabels(m, layout.MetadataStore(store))
+
+			require.NoError(t, labels.Tag(nil, "genesis"))
+			tr.UpdateStr("a", "1")
+			tr.Commit()
+			root1 := trie.RootCommitment(tr)
+			require.NoError(t, labels.Tag(root1, "block-1"))
+			require.NoError(t, labels.Tag(root1, "latest"))
+			tr.UpdateStr("b", "2")
+			tr.Commit()
+			root2 := trie.RootCommitment(tr)
+			require.NoError(t, labels.Tag(root2, "block-2"))
+			require.NoError(t, labels.Tag(root2, "latest"))
+
+			// labels are persistent
+			labels = trie.NewRootLabels(m, layout.MetadataStore(store))
+			r, ok, err := labels.Resolve("genesis")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Nil(t, r)
+			r, ok, err = labels.Resolve("block-1")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.True(t, m.EqualCommitments(root1, r))
+			r, ok, err = labels.Resolve("latest")
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.True(t, m.EqualCommitments(root2, r))
+			_, ok, err = labels.Resolve("block-3")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			l, err := labels.Labels(root2)
+			require.NoError(t, err)
+			require.EqualValues(t, []string{"block-2", "latest"}, l)
+			l, err = labels.Labels(root1)
+			require.NoError(t, err)
+			require.EqualValues(t, []string{"block-1"}, l)
+
+			labels.Untag("latest")
+			_, ok, err = labels.Resolve("latest")
+			require.NoError(t, err)
+			require.False(t, ok)
+			count := 0
+			require.NoError(t, labels.Iterate(func(string, trie.VCommitment) bool {
+				count++
+				return true
+			}))
+			require.EqualValues(t, 3, count)
+
+			require.Error(t, labels.Tag(root1, ""))
+			require.Error(t, labels.Tag(root1, strings.Repeat("x", 257)))
+			layout.MetadataStore(store).Set(trie.Concat(trie.RootLabelPrefix, "junk"), []byte{0x01, 0xff})
+			_, _, err = labels.Resolve("junk")
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,114 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// StoreLayout defines partitions of the key/value store used by the state:
+// - trie nodes
+// - values of the state (the committed key/value pairs)
+// - metadata, i.e. auxiliary data of the state which is not committed in the trie
+// Each partition is identified by its prefix. All partitions may be located in the same physical store,
+// or each of them may be in a different one
+type StoreLayout struct {
+	NodePrefix     []byte
+	ValuePrefix    []byte
+	MetadataPrefix []byte
+}
+
+// DefaultStoreLayout is the layout used when all partitions are located in one physical store
+var DefaultStoreLayout = StoreLayout{
+	NodePrefix:     []byte{0x01},
+	ValuePrefix:    []byte{0x02},
+	MetadataPrefix: []byte{0x03},
+}
+
+// Validate checks if partitions do not overlap when located in the same physical store
+func (l StoreLayout) Validate() error {
+	prefixes := [][]byte{l.NodePrefix, l.ValuePrefix, l.MetadataPrefix}
+	names := []string{"node", "value", "metadata"}
+	for i := range prefixes {
+		for j := i + 1; j < len(prefixes); j++ {
+			if bytes.HasPrefix(prefixes[i], prefixes[j]) || bytes.HasPrefix(prefixes[j], prefixes[i]) {
+				return fmt.Errorf("store layout: %s partition overlaps with %s partition", names[i], names[j])
+			}
+		}
+	}
+	return nil
+}
+
+// NodeStore returns the trie node partition of the store
+func (l StoreLayout) NodeStore(store KVStore) KVStore {
+	return NewPartition(store, l.NodePrefix)
+}
+
+// ValueStore returns the value partition of the store
+func (l StoreLayout) ValueStore(store KVStore) KVStore {
+	return NewPartition(store, l.ValuePrefix)
+}
+
+// MetadataStore returns the metadata partition of the store
+func (l StoreLayout) MetadataStore(store KVStore) KVStore {
+	return NewPartition(store, l.MetadataPrefix)
+}
+
+// NewWithLayout creates Trie with nodes and values located in the store according to the layout
+func NewWithLayout(model CommitmentModel, store KVStore, layout StoreLayout, opt Options) *Trie {
+	return NewWithOptions(model, layout.NodeStore(store), layout.ValueStore(store), opt)
+}
+
+// NewTrieReaderWithLayout creates TrieReader with nodes and values located in the store according to the layout
+func NewTrieReaderWithLayout(model CommitmentModel, store KVStore, layout StoreLayout) *TrieReader {
+	return NewTrieReader(model, layout.NodeStore(store), layout.ValueStore(store))
+}
+
+// partition is a KVStore which maps all keys under the prefix of the underlying store
+type partition struct {
+	store  KVStore
+	prefix []byte
+}
+
+// NewPartition creates a new KVStore as a partition of the store under the prefix.
+// Empty prefix means the store itself
+func NewPartition(store KVStore, prefix []byte) KVStore {
+	if len(prefix) == 0 {
+		return store
+	}
+	return &partition{store: store, prefix: prefix}
+}
+
+func (p *partition) Get(key []byte) []byte {
+	return p.store.Get(Concat(p.prefix, key))
+}
+
+func (p *partition) Has(key []byte) bool {
+	return p.store.Has(Concat(p.prefix, key))
+}
+
+func (p *partition) Set(key, value []byte) {
+	p.store.Set(Concat(p.prefix, key), value)
+}
+
+func (p *partition) Iterate(fun func(k, v []byte) bool) {
+	p.store.Iterate(func(k, v []byte) bool {
+		if !bytes.HasPrefix(k, p.prefix) {
+			return true
+		}
+		return fun(k[len(p.prefix):], v)
+	})
+}
+
+// IteratePrefix implements KVPrefixIterator. Iteration is bounded if the underlying store implements KVPrefixIterator
+func (p *partition) IteratePrefix(prefix []byte, fun func(k, v []byte) bool) {
+	IteratePrefix(p.store, Concat(p.prefix, prefix), func(k, v []byte) bool {
+		return fun(k[len(p.prefix):], v)
+	})
+}
+
+// IterateKeysPrefix implements KVPrefixIterator
+func (p *partition) IterateKeysPrefix(prefix []byte, fun func(k []byte) bool) {
+	IterateKeysPrefix(p.store, Concat(p.prefix, prefix), func(k []byte) bool {
+		return fun(k[len(p.prefix):])
+	})
+}
@@ -0,0 +1,61 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreLayout(t *testing.T) {
+	require.NoError(t, trie.DefaultStoreLayout.Validate())
+	require.Error(t, trie.StoreLayout{
+		NodePrefix:     []byte{0x01},
+		ValuePrefix:    []byte{0x01, 0x02},
+		MetadataPrefix: []byte{0x03},
+	}.Validate())
+	require.Error(t, trie.StoreLayout{
+		NodePrefix:  []byte{0x01},
+		ValuePrefix: []byte{0x02},
+	}.Validate())
+
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("store layout"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			layout := trie.DefaultStoreLayout
+
+			store := trie.NewInMemoryKVStore()
+			tr := trie.NewWithLayout(m, store, layout, trie.Options{})
+			valueStore := layout.ValueStore(store)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+				valueStore.Set([]byte(s), []byte(s+"$"))
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+
+			// the same state with values in a different physical store
+			nodeStore := trie.NewInMemoryKVStore()
+			valueStoreSeparate := trie.NewInMemoryKVStore()
+			trSeparate := trie.New(m, layout.NodeStore(nodeStore), layout.ValueStore(valueStoreSeparate))
+			for _, s := range data {
+				trSeparate.UpdateStr(s, s+"$")
+			}
+			trSeparate.Commit()
+			trSeparate.PersistMutations(layout.NodeStore(nodeStore))
+
+			require.EqualValues(t, trie.NumEntries(layout.NodeStore(store)), trie.NumEntries(nodeStore))
+			require.EqualValues(t, trie.NumEntries(store), trie.NumEntries(nodeStore)+trie.NumEntries(valueStore))
+			require.EqualValues(t, 0, trie.NumEntries(layout.MetadataStore(store)))
+
+			rdr := trie.NewTrieReaderWithLayout(m, store, layout)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(rdr), trie.RootCommitment(trSeparate)))
+			value, _ := rdr.GetWithProofGeneric([]byte(data[0]))
+			require.EqualValues(t, data[0]+"$", string(value))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
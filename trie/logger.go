@@ -0,0 +1,48 @@
+package trie
+
+import (
+	"fmt"
+	"io"
+)
+
+// Logger is an optional logging interface used by the trie to report events such as commits, cache flushes
+// and inconsistencies. It is compatible with the hive.go logger and the zap sugared logger
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// nullLogger ignores all events. Used by default
+type nullLogger struct{}
+
+func (nullLogger) Debugf(string, ...interface{}) {}
+func (nullLogger) Warnf(string, ...interface{})  {}
+
+// printfLogger writes events to io.Writer, each event in a separate line
+type printfLogger struct {
+	w     io.Writer
+	debug bool
+}
+
+// NewPrintfLogger creates simple Logger which writes events to the io.Writer.
+// Debug events are written only if debug == true
+func NewPrintfLogger(w io.Writer, debug bool) Logger {
+	return &printfLogger{w: w, debug: debug}
+}
+
+func (l *printfLogger) Debugf(format string, args ...interface{}) {
+	if l.debug {
+		_, _ = fmt.Fprintf(l.w, "DEBUG: "+format+"\n", args...)
+	}
+}
+
+func (l *printfLogger) Warnf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(l.w, "WARN: "+format+"\n", args...)
+}
+
+func loggerOrNull(log Logger) Logger {
+	if log == nil {
+		return nullLogger{}
+	}
+	return log
+}
@@ -0,0 +1,104 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MetadataKey is the reserved key under which the state metadata is committed in the trie.
+// Applications must not use the key for other data
+var MetadataKey = []byte("\xff\xfftrie_metadata")
+
+// Metadata is a small typed header committed into the state together with other data,
+// so that block information is bound into the root commitment
+type Metadata struct {
+	// StateIndex is, for example, index of the block which produced the state
+	StateIndex uint64
+	// Timestamp is a unix timestamp in nanoseconds
+	Timestamp int64
+	// Data is arbitrary application data
+	Data []byte
+}
+
+func MetadataFromBytes(data []byte) (*Metadata, error) {
+	ret := &Metadata{}
+	rdr := bytes.NewReader(data)
+	if err := ret.Read(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+func (md *Metadata) Bytes() []byte {
+	return MustBytes(md)
+}
+
+func (md *Metadata) Write(w io.Writer) error {
+	var buf [binary.MaxVarintLen64]byte
+	if _, err := w.Write(buf[:binary.PutUvarint(buf[:], md.StateIndex)]); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf[:binary.PutVarint(buf[:], md.Timestamp)]); err != nil {
+		return err
+	}
+	return WriteBytes16(w, md.Data)
+}
+
+func (md *Metadata) Read(r io.Reader) error {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = byteReader{r}
+	}
+	var err error
+	if md.StateIndex, err = binary.ReadUvarint(br); err != nil {
+		return err
+	}
+	if md.Timestamp, err = binary.ReadVarint(br); err != nil {
+		return err
+	}
+	md.Data, err = ReadBytes16(r)
+	return err
+}
+
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	return ReadByte(r.Reader)
+}
+
+// SetMetadata commits metadata into the trie under the MetadataKey.
+// If valueStore is not nil, serialized metadata is also written into it, same as other values of the state.
+// Metadata bypasses the middleware of the trie
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TrySetMetadata)
+func (tr *Trie) SetMetadata(md *Metadata, valueStore KVWriter) {
+	tr.mustBeWritable("SetMetadata")
+	data := md.Bytes()
+	tr.update(MetadataKey, data)
+	if valueStore != nil {
+		valueStore.Set(MetadataKey, data)
+	}
+}
+
+// GetMetadata reads metadata from the value store of the state. Returns nil if metadata is absent
+func GetMetadata(valueStore KVReader) (*Metadata, error) {
+	data := valueStore.Get(MetadataKey)
+	if data == nil {
+		return nil, nil
+	}
+	return MetadataFromBytes(data)
+}
+
+// GetMetadata reads metadata from the value store of the trie reader. Returns nil if metadata is absent
+func (tr *TrieReader) GetMetadata() (*Metadata, error) {
+	if tr.reader.valueStore == nil {
+		return nil, errors.New("value store not provided")
+	}
+	return GetMetadata(tr.reader.valueStore)
+}
@@ -0,0 +1,139 @@
+package trie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Middleware transforms keys and values before they are inserted into the trie (see Options.Middleware), for example
+// hashes or prefixes keys, or encrypts values at rest. Commitments are computed on transformed keys and values, so
+// proofs prove transformed values. Transformations must be deterministic, otherwise the same updates lead
+// to different root commitments. Transformed non-empty value must not be empty
+type Middleware interface {
+	// TransformKey returns the key as it is inserted into the trie
+	TransformKey(key []byte) []byte
+	// TransformValue returns the value inserted instead of the value of the key. The key is not yet transformed
+	// by the middleware
+	TransformValue(key, value []byte) []byte
+	// RestoreValue is the inverse of TransformValue
+	RestoreValue(key, value []byte) ([]byte, error)
+}
+
+// MiddlewareChain applies middlewares in order: each one transforms the key and the value produced by the previous one
+type MiddlewareChain []Middleware
+
+// TransformKey returns the key as it is inserted into the trie
+func (c MiddlewareChain) TransformKey(key []byte) []byte {
+	for _, m := range c {
+		key = m.TransformKey(key)
+	}
+	return key
+}
+
+// Transform returns the key and the value as they are inserted into the trie. The value store of the trie
+// must contain transformed pairs
+func (c MiddlewareChain) Transform(key, value []byte) ([]byte, []byte) {
+	for _, m := range c {
+		value = m.TransformValue(key, value)
+		key = m.TransformKey(key)
+	}
+	return key, value
+}
+
+// RestoreValue restores the original value of the key from the value inserted into the trie.
+// The key is the original one, not transformed
+func (c MiddlewareChain) RestoreValue(key, value []byte) ([]byte, error) {
+	keys := make([][]byte, len(c))
+	for i, m := range c {
+		keys[i] = key
+		key = m.TransformKey(key)
+	}
+	var err error
+	for i := len(c) - 1; i >= 0; i-- {
+		if value, err = c[i].RestoreValue(keys[i], value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// ErrCannotDecrypt is returned when the value was not encrypted with the secret or was tampered with
+var ErrCannotDecrypt = errors.New("trie: cannot decrypt value")
+
+// valueEncryption encrypts values with AES-256-GCM. The nonce is derived from the key and the value (as in SIV mode),
+// so encryption is deterministic. The key is authenticated as additional data: the value can't be moved to another key
+type valueEncryption struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+const minEncryptionSecretSize = 16
+
+// NewValueEncryption creates the middleware which encrypts values at rest with the secret.
+// Keys are not transformed. Equal values of the same key are encrypted equally, which is revealed by the ciphertext
+func NewValueEncryption(secret []byte) (Middleware, error) {
+	ret, err := newValueEncryption(secret)
+	if err != nil {
+		return nil, fmt.Errorf("trie::NewValueEncryption: %w", err)
+	}
+	return ret, nil
+}
+
+func newValueEncryption(secret []byte) (*valueEncryption, error) {
+	if len(secret) < minEncryptionSecretSize {
+		return nil, fmt.Errorf("secret must be at least %d bytes long", minEncryptionSecretSize)
+	}
+	block, err := aes.NewCipher(deriveSecret(secret, "trie.encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &valueEncryption{
+		aead:   aead,
+		macKey: deriveSecret(secret, "trie.nonce"),
+	}, nil
+}
+
+func deriveSecret(secret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func (e *valueEncryption) TransformKey(key []byte) []byte {
+	return key
+}
+
+func (e *valueEncryption) nonce(key, value []byte) []byte {
+	mac := hmac.New(sha256.New, e.macKey)
+	_ = WriteBytes16(mac, key)
+	mac.Write(value)
+	return mac.Sum(nil)[:e.aead.NonceSize()]
+}
+
+func (e *valueEncryption) TransformValue(key, value []byte) []byte {
+	nonce := e.nonce(key, value)
+	return e.aead.Seal(nonce, nonce, value, key)
+}
+
+func (e *valueEncryption) RestoreValue(key, value []byte) ([]byte, error) {
+	if len(value) < e.aead.NonceSize()+e.aead.Overhead() {
+		return nil, ErrCannotDecrypt
+	}
+	nonceSize := e.aead.NonceSize()
+	ret, err := e.aead.Open(nil, value[:nonceSize], value[nonceSize:], key)
+	if err != nil {
+		return nil, ErrCannotDecrypt
+	}
+	if ret == nil {
+		ret = []byte{}
+	}
+	return ret, nil
+}
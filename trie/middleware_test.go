@@ -0,0 +1,79 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	_, err := trie.NewValueEncryption(secret[:15])
+	require.Error(t, err)
+
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("middleware"+tn(m), func(t *testing.T) {
+			enc, err := trie.NewValueEncryption(secret)
+			require.NoError(t, err)
+			chain := trie.MiddlewareChain{prefixMiddleware("pref:"), enc}
+
+			data := genRnd4()[:300]
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), valueStore, trie.Options{Middleware: chain})
+			reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				value := []byte(s + "-value")
+				tr.Update([]byte(s), value)
+				k, v := tr.Transform([]byte(s), value)
+				require.NotEqual(t, value, v)
+				valueStore.Set(k, v)
+				reference.Update(k, v)
+			}
+			tr.Commit()
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+
+			// encryption is deterministic
+			tr1 := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, trie.Options{Middleware: chain})
+			for _, s := range data {
+				tr1.Update([]byte(s), []byte(s+"-value"))
+			}
+			tr1.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr1), trie.RootCommitment(tr)))
+
+			other, err := trie.NewValueEncryption(secret[1:])
+			require.NoError(t, err)
+			for _, s := range data {
+				key := []byte(s)
+				stored := valueStore.Get(chain.TransformKey(key))
+				require.NotNil(t, stored)
+				value, err := chain.RestoreValue(key, stored)
+				require.NoError(t, err)
+				require.EqualValues(t, s+"-value", string(value))
+
+				_, err = other.RestoreValue(key, stored)
+				require.ErrorIs(t, err, trie.ErrCannotDecrypt)
+				_, err = chain.RestoreValue(trie.Concat(key, "x"), stored)
+				require.ErrorIs(t, err, trie.ErrCannotDecrypt)
+				tampered := trie.Concat(stored)
+				tampered[len(tampered)-1] ^= 1
+				_, err = chain.RestoreValue(key, tampered)
+				require.ErrorIs(t, err, trie.ErrCannotDecrypt)
+			}
+			require.Error(t, tr.UpdateReader([]byte("a"), &patternReader{size: 10}, 10))
+
+			for _, s := range data {
+				tr.Delete([]byte(s))
+			}
+			tr.Commit()
+			require.Nil(t, trie.RootCommitment(tr))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,128 @@
+package trie
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// MigrateOptions are optional parameters of Migrate
+type MigrateOptions struct {
+	// Options of the target trie. The middleware is ignored: values of the source trie are already transformed
+	Options
+	// BatchSize is the number of keys after which the target trie is committed and persisted.
+	// Zero means defaultMigrateBatchSize
+	BatchSize int
+	// SpotChecks is the number of keys, evenly sampled, which are proven in the target trie after migration.
+	// Zero means defaultMigrateSpotChecks, negative means no spot checks
+	SpotChecks int
+	// Progress, if not nil, is called after each batch with the number of migrated keys
+	Progress func(keys int)
+}
+
+// MigrateStats is the result of Migrate
+type MigrateStats struct {
+	// Root is the root commitment of the target trie
+	Root VCommitment
+	// Keys is the number of migrated keys
+	Keys int
+	// SpotChecks is the number of keys proven in the target trie
+	SpotChecks int
+}
+
+const (
+	defaultMigrateBatchSize  = 10000
+	defaultMigrateSpotChecks = 100
+)
+
+// Migrate rebuilds the trie under another commitment model, for example with another path arity or hash size.
+// Keys of the source trie are streamed in the lexicographical order, their values are read from the value store,
+// which becomes the value store of the target trie too. Keys committed with InsertKeyCommitment may have no value
+// in the value store, their value is the key. The target trie is written to the trie store in batches, which must
+// not be the store of the source trie. The trie store must contain no trie.
+// After migration, the number of keys in the target trie is verified and the sample of keys is checked with
+// proofs of the target trie against terminal commitments of the values
+func Migrate(src NodeStore, valueStore KVReader, model CommitmentModel, trieStore KVStore, opt ...MigrateOptions) (*MigrateStats, error) {
+	var o MigrateOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	batchSize := o.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultMigrateBatchSize
+	}
+	if _, ok := NewTrieReader(model, trieStore, valueStore).GetNode(nil); ok {
+		return nil, fmt.Errorf("trie::Migrate: the target trie store is not empty")
+	}
+	srcKeys := 0
+	_, err := IterateKeys(src, nil, func([]byte, TCommitment) bool {
+		srcKeys++
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("trie::Migrate: %w", err)
+	}
+	spotChecks := o.SpotChecks
+	if spotChecks == 0 {
+		spotChecks = defaultMigrateSpotChecks
+	}
+	stride := 0
+	if spotChecks > 0 {
+		stride = (srcKeys + spotChecks - 1) / spotChecks
+	}
+
+	o.Options.Middleware = nil
+	tr := NewWithOptions(model, trieStore, valueStore, o.Options)
+	ret := &MigrateStats{}
+	samples := make([][2][]byte, 0, spotChecks)
+	persist := func() {
+		tr.Commit()
+		tr.PersistMutations(trieStore)
+		tr.ClearCache()
+		if o.Progress != nil {
+			o.Progress(ret.Keys)
+		}
+	}
+	_, err = IterateKeys(src, nil, func(key []byte, terminal TCommitment) bool {
+		var value []byte
+		if _, value, err = terminalValue(src, valueStore, UnpackBytes(key, src.PathArity()), terminal); err != nil {
+			return false
+		}
+		tr.Update(key, value)
+		if stride > 0 && ret.Keys%stride == 0 {
+			samples = append(samples, [2][]byte{key, value})
+		}
+		ret.Keys++
+		if ret.Keys%batchSize == 0 {
+			persist()
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("trie::Migrate: %w", err)
+	}
+	persist()
+	ret.Root = RootCommitment(tr)
+
+	// verification
+	reader := NewTrieReader(model, trieStore, valueStore)
+	dstKeys := 0
+	if _, err = IterateKeys(reader, nil, func([]byte, TCommitment) bool {
+		dstKeys++
+		return true
+	}); err != nil {
+		return nil, fmt.Errorf("trie::Migrate: %w", err)
+	}
+	if dstKeys != srcKeys || ret.Keys != srcKeys {
+		return nil, fmt.Errorf("trie::Migrate: number of keys in the source trie is %d, migrated %d, in the target trie %d",
+			srcKeys, ret.Keys, dstKeys)
+	}
+	for _, s := range samples {
+		_, nodes, _, ending := proofPathWithNodes(reader, UnpackBytes(s[0], model.PathArity()))
+		if ending != EndingTerminal || len(nodes) == 0 ||
+			!model.EqualCommitments(nodes[len(nodes)-1].Terminal(), tr.commitToValue(s[0], s[1])) {
+			return nil, fmt.Errorf("trie::Migrate: spot check of the key '%s' failed", hex.EncodeToString(s[0]))
+		}
+		ret.SpotChecks++
+	}
+	return ret, nil
+}
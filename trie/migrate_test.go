@@ -0,0 +1,67 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	runTest := func(t *testing.T, m, mNew trie.CommitmentModel, optimizeKeyCommitments bool) {
+		t.Run("migrate"+tn(m)+tn(mNew), func(t *testing.T) {
+			opt := trie.Options{OptimizeKeyCommitments: optimizeKeyCommitments}
+			store := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, valueStore, opt)
+			expected := trie.NewWithOptions(mNew, trie.NewInMemoryKVStore(), valueStore, opt)
+			for i, s := range genRnd4()[:1000] {
+				if i%5 == 0 && len(s) > 0 {
+					tr.InsertKeyCommitment([]byte(s))
+					expected.InsertKeyCommitment([]byte(s))
+					valueStore.Set([]byte(s), nil)
+					continue
+				}
+				tr.UpdateStr(s, s+"*")
+				expected.UpdateStr(s, s+"*")
+				valueStore.Set([]byte(s), []byte(s+"*"))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			expected.Commit()
+
+			newStore := trie.NewInMemoryKVStore()
+			progress := 0
+			stats, err := trie.Migrate(trie.NewTrieReader(m, store, valueStore), valueStore, mNew, newStore, trie.MigrateOptions{
+				Options:   opt,
+				BatchSize: 97,
+				Progress:  func(keys int) { progress = keys },
+			})
+			require.NoError(t, err)
+			require.True(t, mNew.EqualCommitments(trie.RootCommitment(expected), stats.Root))
+			require.EqualValues(t, stats.Keys, progress)
+			require.True(t, stats.SpotChecks > 0)
+			numKeys := 0
+			_, err = tr.IterateKeys(nil, func([]byte, trie.TCommitment) bool {
+				numKeys++
+				return true
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, numKeys, stats.Keys)
+
+			// the target store must be empty
+			_, err = trie.Migrate(trie.NewTrieReader(m, store, valueStore), valueStore, mNew, newStore)
+			require.Error(t, err)
+			if !optimizeKeyCommitments {
+				// values must be present
+				_, err = trie.Migrate(trie.NewTrieReader(m, store, valueStore), trie.NewInMemoryKVStore(), mNew, trie.NewInMemoryKVStore())
+				require.Error(t, err)
+			}
+		})
+	}
+	for _, optimize := range []bool{false, true} {
+		runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160), trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256), optimize)
+		runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256), trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160), optimize)
+	}
+}
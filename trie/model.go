@@ -2,6 +2,7 @@ package trie
 
 import (
 	"fmt"
+	"io"
 )
 
 // CommitmentModel abstracts 256+ Trie logic from the commitment logic/cryptography
@@ -34,6 +35,24 @@ type CommitmentModel interface {
 	// ShortName short name
 	ShortName() string
 }
+
+// ReaderCommitter is implemented by commitment models which can commit to the value read from the reader,
+// without loading the whole value into memory (see Trie.UpdateReader)
+type ReaderCommitter interface {
+	// CommitToDataReader returns terminal commitment to the value of the size read from the reader. It must be
+	// equal to the commitment returned by CommitToData for the same data. Zero size means no data (deletion)
+	CommitToDataReader(r io.Reader, size int64) (TCommitment, error)
+}
+
+// EmptyValueCommitter is implemented by commitment models which can commit to the empty value
+// distinctly from the absence of the value. It is required by the trie with Options.AllowEmptyValues
+type EmptyValueCommitter interface {
+	// CommitToEmptyValue returns terminal commitment to the empty value. It must be different from
+	// commitment to any non-empty data. The commitment must always be stored with the node, because
+	// empty values are not stored in the value store
+	CommitToEmptyValue() TCommitment
+}
+
 type PathArity byte
 
 const (
@@ -44,6 +63,16 @@ const (
 
 var AllPathArity = []PathArity{PathArity256, PathArity16, PathArity2}
 
+// IsValid checks if the arity is one of the supported ones. Arity read from untrusted data must be checked
+// before use, methods of the wrong arity panic
+func (a PathArity) IsValid() bool {
+	switch a {
+	case PathArity256, PathArity16, PathArity2:
+		return true
+	}
+	return false
+}
+
 func (a PathArity) String() string {
 	switch a {
 	case PathArity256, PathArity16, PathArity2:
@@ -1,7 +1,6 @@
 package trie
 
 import (
-	"bytes"
 	"encoding/hex"
 	"fmt"
 )
@@ -50,8 +49,8 @@ func (n *nodeReadOnly) IsCommitted() bool {
 	return true
 }
 
-func nodeReadOnlyFromBytes(model CommitmentModel, data, unpackedKey []byte, arity PathArity, valueStore KVReader) (*nodeReadOnly, error) {
-	ret, err := NodeDataFromBytes(model, data, unpackedKey, arity, valueStore)
+func nodeReadOnlyFromBytes(codec Codec, model CommitmentModel, data, unpackedKey []byte, arity PathArity, valueStore KVReader) (*nodeReadOnly, error) {
+	ret, err := NodeDataFromBytesWithCodec(codec, model, data, unpackedKey, arity, valueStore)
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +70,8 @@ type bufferedNode struct {
 	newTerminal      TCommitment       // next value of Terminal
 	modifiedChildren map[byte]struct{} // children which has been modified
 	pathChanged      bool              // position of the node in trie has been changed duo to modifications
+	frozen           bool              // node is shared between forked caches and must be cloned before use
+	persisted        bool              // node has not been changed since it was read from or written to the store
 }
 
 func newBufferedNode(key []byte) *bufferedNode {
@@ -114,6 +115,7 @@ func (n *bufferedNode) Clone() *bufferedNode {
 		newTerminal:      newTerminal,
 		modifiedChildren: make(map[byte]struct{}),
 		pathChanged:      n.pathChanged,
+		persisted:        n.persisted,
 	}
 	copy(ret.unpackedKey, n.unpackedKey)
 	for k, v := range n.modifiedChildren {
@@ -122,6 +124,11 @@ func (n *bufferedNode) Clone() *bufferedNode {
 	return ret
 }
 
+// isModified returns true if node has uncommitted modifications
+func (n *bufferedNode) isModified(model CommitmentModel) bool {
+	return n.pathChanged || len(n.modifiedChildren) > 0 || !model.EqualCommitments(n.newTerminal, n.n.Terminal)
+}
+
 func (n *bufferedNode) setNewKey(key []byte) {
 	n.unpackedKey = key
 	n.pathChanged = true
@@ -140,7 +147,7 @@ func (n *bufferedNode) markChildModified(index byte) {
 	n.modifiedChildren[index] = struct{}{}
 }
 
-func (n *bufferedNode) Bytes(model CommitmentModel, arity PathArity, optimizeKeyCommitments bool) []byte {
+func (n *bufferedNode) Bytes(codec Codec, model CommitmentModel, arity PathArity, optimizeKeyCommitments bool) []byte {
 	// Optimization: if terminal commits to unpackedKey, no need to serialize it,
 	// because all information is in the key
 	isKeyCommitment := false
@@ -148,11 +155,11 @@ func (n *bufferedNode) Bytes(model CommitmentModel, arity PathArity, optimizeKey
 		keyCommitment := model.CommitToData(Concat(n.unpackedKey, n.n.PathFragment))
 		isKeyCommitment = model.EqualCommitments(n.n.Terminal, keyCommitment)
 	}
-	var buf bytes.Buffer
+	buf := getBuffer()
 	skipStoreTerminal := n.n.Terminal != nil && !model.ForceStoreTerminalWithNode(n.n.Terminal)
-	err := n.n.Write(&buf, arity, isKeyCommitment, skipStoreTerminal)
+	err := codec.WriteNode(buf, &n.n, arity, isKeyCommitment, skipStoreTerminal)
 	Assert(err == nil, "trie::bufferedNode::Bytes: %v", err)
-	return buf.Bytes()
+	return putBuffer(buf)
 }
 
 func childKey(n Node, childIndex byte) []byte {
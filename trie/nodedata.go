@@ -1,10 +1,10 @@
 package trie
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 
 	"golang.org/x/xerrors"
 )
@@ -25,16 +25,7 @@ func NewNodeData() *NodeData {
 }
 
 func NodeDataFromBytes(model CommitmentModel, data, unpackedKey []byte, arity PathArity, valueStore KVReader) (*NodeData, error) {
-	ret := NewNodeData()
-	rdr := bytes.NewReader(data)
-	if err := ret.Read(rdr, model, unpackedKey, arity, valueStore); err != nil {
-		return nil, err
-	}
-	if rdr.Len() != 0 {
-		// not all data was consumed
-		return nil, ErrNotAllBytesConsumed
-	}
-	return ret, nil
+	return NodeDataFromBytesWithCodec(BinaryCodec, model, data, unpackedKey, arity, valueStore)
 }
 
 // Clone deep copy
@@ -106,13 +97,9 @@ func newCflags(arity PathArity) cflags {
 
 func readCflags(r io.Reader, arity PathArity) (cflags, error) {
 	ret := newCflags(arity)
-	n, err := r.Read(ret)
-	if err != nil {
+	if _, err := io.ReadFull(r, ret); err != nil {
 		return nil, err
 	}
-	if n != cflagsSize(arity) {
-		return nil, fmt.Errorf("expected %d bytes, got %d", cflagsSize(arity), n)
-	}
 	return ret, nil
 }
 
@@ -126,29 +113,9 @@ func (fl cflags) hasFlag(i byte) bool {
 
 // Write serialized node data
 func (n *NodeData) Write(w io.Writer, arity PathArity, isKeyCommitment bool, skipTerminal bool) error {
-	var smallFlags byte
-	if n.Terminal != nil {
-		smallFlags |= terminalExistsFlag
-	}
-	if skipTerminal {
-		smallFlags |= takeTerminalFromValueFlag
-	}
-	if isKeyCommitment {
-		smallFlags |= takeTerminalFromKeyFlag
-	}
-	if len(n.ChildCommitments) > 0 {
-		smallFlags |= serializeChildrenFlag
-	}
-	if smallFlags == 0 {
-		return xerrors.New("non-committing node can't be serialized")
-	}
-	var pathFragmentEncoded []byte
-	var err error
-	if len(n.PathFragment) > 0 {
-		smallFlags |= serializePathFragmentFlag
-		if pathFragmentEncoded, err = EncodeUnpackedBytes(n.PathFragment, arity); err != nil {
-			return err
-		}
+	smallFlags, pathFragmentEncoded, err := n.flags(arity, isKeyCommitment, skipTerminal)
+	if err != nil {
+		return err
 	}
 	if err = WriteByte(w, smallFlags); err != nil {
 		return err
@@ -192,6 +159,35 @@ func (n *NodeData) Write(w io.Writer, arity PathArity, isKeyCommitment bool, ski
 	return nil
 }
 
+// flags returns flags of the node serialization and the encoded path fragment
+func (n *NodeData) flags(arity PathArity, isKeyCommitment bool, skipTerminal bool) (byte, []byte, error) {
+	var smallFlags byte
+	if n.Terminal != nil {
+		smallFlags |= terminalExistsFlag
+	}
+	if skipTerminal {
+		smallFlags |= takeTerminalFromValueFlag
+	}
+	if isKeyCommitment {
+		smallFlags |= takeTerminalFromKeyFlag
+	}
+	if len(n.ChildCommitments) > 0 {
+		smallFlags |= serializeChildrenFlag
+	}
+	if smallFlags == 0 {
+		return 0, nil, xerrors.New("non-committing node can't be serialized")
+	}
+	var pathFragmentEncoded []byte
+	var err error
+	if len(n.PathFragment) > 0 {
+		smallFlags |= serializePathFragmentFlag
+		if pathFragmentEncoded, err = EncodeUnpackedBytes(n.PathFragment, arity); err != nil {
+			return 0, nil, err
+		}
+	}
+	return smallFlags, pathFragmentEncoded, nil
+}
+
 // Read deserialize node data
 func (n *NodeData) Read(r io.Reader, model CommitmentModel, unpackedKey []byte, arity PathArity, valueStore KVReader) error {
 	var err error
@@ -211,39 +207,13 @@ func (n *NodeData) Read(r io.Reader, model CommitmentModel, unpackedKey []byte,
 		n.PathFragment = nil
 	}
 	n.Terminal = nil
-	if smallFlags&terminalExistsFlag != 0 {
-		// terminal exists. Should be taken from 1 or 3 locations
-		if smallFlags&takeTerminalFromKeyFlag != 0 {
-			// terminal is in key
-			if len(unpackedKey) == 0 {
-				return xerrors.New("non-empty unpackedKey expected")
-			}
-			n.Terminal = model.CommitToData(Concat(unpackedKey, n.PathFragment))
-		} else if smallFlags&takeTerminalFromValueFlag != 0 {
-			// terminal should be taken from the value store
-			if valueStore == nil {
-				return errors.New("can't read node: value store not provided")
-			}
-			key, err := PackUnpackedBytes(Concat(unpackedKey, n.PathFragment), arity)
-			if err != nil {
-				return err
-			}
-			value := valueStore.Get(key)
-			if value == nil {
-				return fmt.Errorf("can't find terminal value for key '%x'", key)
-			}
-			n.Terminal = model.CommitToData(value)
-		} else {
-			n.Terminal = model.NewTerminalCommitment()
-			if err = n.Terminal.Read(r); err != nil {
-				return err
-			}
-		}
-	} else {
-		// terminal does not exist. Enforce other flags to be 0
-		if smallFlags&(takeTerminalFromKeyFlag|takeTerminalFromValueFlag) != 0 {
-			return errors.New("wrong flag")
+	if smallFlags&terminalExistsFlag != 0 && smallFlags&(takeTerminalFromKeyFlag|takeTerminalFromValueFlag) == 0 {
+		n.Terminal = model.NewTerminalCommitment()
+		if err = n.Terminal.Read(r); err != nil {
+			return err
 		}
+	} else if err = n.restoreTerminal(smallFlags, model, unpackedKey, arity, valueStore); err != nil {
+		return err
 	}
 	if smallFlags&serializeChildrenFlag != 0 {
 		var flags cflags
@@ -262,3 +232,43 @@ func (n *NodeData) Read(r io.Reader, model CommitmentModel, unpackedKey []byte,
 	}
 	return nil
 }
+
+// restoreTerminal restores the terminal, which is not stored with the node, from the key or from the value store
+// according to flags
+func (n *NodeData) restoreTerminal(smallFlags byte, model CommitmentModel, unpackedKey []byte, arity PathArity, valueStore KVReader) error {
+	if smallFlags&terminalExistsFlag == 0 {
+		// terminal does not exist. Enforce other flags to be 0
+		if smallFlags&(takeTerminalFromKeyFlag|takeTerminalFromValueFlag) != 0 {
+			return errors.New("wrong flag")
+		}
+		return nil
+	}
+	// terminal exists. Should be taken from 1 or 3 locations
+	if smallFlags&takeTerminalFromKeyFlag != 0 {
+		// terminal is in key
+		if len(unpackedKey) == 0 {
+			return xerrors.New("non-empty unpackedKey expected")
+		}
+		n.Terminal = model.CommitToData(Concat(unpackedKey, n.PathFragment))
+		return nil
+	}
+	// terminal should be taken from the value store
+	if valueStore == nil {
+		return errors.New("can't read node: value store not provided")
+	}
+	key, err := PackUnpackedBytes(Concat(unpackedKey, n.PathFragment), arity)
+	if err != nil {
+		return err
+	}
+	value := valueStore.Get(key)
+	if value == nil {
+		return fmt.Errorf("can't find terminal value for key '%x'", key)
+	}
+	if tc, ok := model.(ThresholdCommitter); ok {
+		// the terminal remains in the value store when the node is rewritten, whatever the threshold of the model is
+		n.Terminal = tc.CommitToDataWithThreshold(value, math.MaxInt)
+		return nil
+	}
+	n.Terminal = model.CommitToData(value)
+	return nil
+}
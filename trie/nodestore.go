@@ -12,14 +12,16 @@ type nodeStore struct {
 	trieStore  KVReader
 	valueStore KVReader
 	arity      PathArity
+	codec      Codec
 }
 
-func newNodeStore(trieStore, valueStore KVReader, model CommitmentModel, arity PathArity) *nodeStore {
+func newNodeStore(trieStore, valueStore KVReader, model CommitmentModel, arity PathArity, codec Codec) *nodeStore {
 	return &nodeStore{
 		m:          model,
 		trieStore:  trieStore,
 		valueStore: valueStore,
 		arity:      arity,
+		codec:      codec,
 	}
 }
 
@@ -33,7 +35,7 @@ func (sr *nodeStore) getNode(unpackedKey []byte) (*nodeReadOnly, bool) {
 	if len(nodeBin) == 0 {
 		return nil, false
 	}
-	n, err := nodeReadOnlyFromBytes(sr.m, nodeBin, unpackedKey, sr.arity, sr.valueStore)
+	n, err := nodeReadOnlyFromBytes(sr.codec, sr.m, nodeBin, unpackedKey, sr.arity, sr.valueStore)
 	Assert(err == nil, "trie::nodeStore::getNode assert 2: err: '%v' nodeBin: '%s', unpackedKey: '%s', arity: %s",
 		err, hex.EncodeToString(nodeBin), hex.EncodeToString(unpackedKey), sr.arity.String())
 	return n, true
@@ -44,38 +46,109 @@ type nodeStoreBuffered struct {
 	reader nodeStore
 	// buffered part of the trie
 	nodeCache map[string]*bufferedNode
-	// cached deleted nodes
-	deleted                map[string]struct{}
+	// cached deleted nodes. Value is true if deletion has been persisted
+	deleted                map[string]bool
 	arity                  PathArity
 	optimizeKeyCommitments bool
+	allowEmptyValues       bool
+	// digest index store and tracked changes of terminal commitments. Nil if digest index is disabled
+	digestIndex   KVWriter
+	digestChanges map[string]*digestChange
+	// expiry index store and tracked changes of expiry times of keys. Nil if expiry index is disabled
+	expiryIndex   KVStore
+	expiryChanges map[string]int64
+	// changelog index store, tracked changes of terminal commitments since the last commit, entries created by commits
+	// since the last persist and the sequence number of the next commit. Nil if changelog index is disabled
+	changelogIndex   KVStore
+	changelogChanges map[string]*digestChange
+	changelogPending map[string][]byte
+	changelogSeq     uint64
+	// snapshots publishes read snapshots upon commits. Nil if read snapshots are disabled
+	snapshots *snapshotState
+	// expectedNodes is the capacity of the node cache upon creation and after clearing. 0 means no preallocation
+	expectedNodes int
 }
 
-func newNodeStoreBuffered(model CommitmentModel, trieStore, valueStore KVReader, arity PathArity, optimizeKeyCommitments bool) *nodeStoreBuffered {
+func newNodeStoreBuffered(model CommitmentModel, trieStore, valueStore KVReader, arity PathArity, optimizeKeyCommitments bool, codec Codec) *nodeStoreBuffered {
 	ret := &nodeStoreBuffered{
-		reader:                 *newNodeStore(trieStore, valueStore, model, arity),
+		reader:                 *newNodeStore(trieStore, valueStore, model, arity, codec),
 		nodeCache:              make(map[string]*bufferedNode),
-		deleted:                make(map[string]struct{}),
+		deleted:                make(map[string]bool),
 		arity:                  arity,
 		optimizeKeyCommitments: optimizeKeyCommitments,
+		digestChanges:          make(map[string]*digestChange),
+		expiryChanges:          make(map[string]int64),
+		changelogChanges:       make(map[string]*digestChange),
+		changelogPending:       make(map[string][]byte),
 	}
 	return ret
 }
 
+// preallocate allocates the node cache for the expected number of keys. The trie of n keys with arity k has
+// at most n terminal nodes and (n-1)/(k-1) branching nodes
+func (sc *nodeStoreBuffered) preallocate(expectedKeys int) {
+	if expectedKeys <= 0 {
+		return
+	}
+	sc.expectedNodes = expectedKeys + expectedKeys/(sc.arity.NumChildren()-1)
+	sc.nodeCache = make(map[string]*bufferedNode, sc.expectedNodes)
+}
+
 // clone is a deep copy of the trie, including its buffered data
 func (sc *nodeStoreBuffered) clone() *nodeStoreBuffered {
 	ret := &nodeStoreBuffered{
 		reader:                 sc.reader,
 		nodeCache:              make(map[string]*bufferedNode),
-		deleted:                make(map[string]struct{}),
+		deleted:                make(map[string]bool),
 		arity:                  sc.arity,
 		optimizeKeyCommitments: sc.optimizeKeyCommitments,
+		allowEmptyValues:       sc.allowEmptyValues,
+		digestIndex:            sc.digestIndex,
+		expiryIndex:            sc.expiryIndex,
+		changelogIndex:         sc.changelogIndex,
+		changelogSeq:           sc.changelogSeq,
+		snapshots:              sc.snapshots.fork(),
+		expectedNodes:          sc.expectedNodes,
 	}
 	for k, v := range sc.nodeCache {
 		ret.nodeCache[k] = v.Clone()
 	}
-	for k := range sc.deleted {
-		ret.deleted[k] = struct{}{}
+	for k, persisted := range sc.deleted {
+		ret.deleted[k] = persisted
+	}
+	ret.digestChanges = sc.cloneDigestChanges()
+	ret.expiryChanges = sc.cloneExpiryChanges()
+	ret.changelogChanges, ret.changelogPending = sc.cloneChangelog()
+	return ret
+}
+
+// fork is a copy-on-write copy of the buffered store. Cached nodes are shared between the original and the fork.
+// Shared nodes are frozen and are cloned by each of the stores upon first access
+func (sc *nodeStoreBuffered) fork() *nodeStoreBuffered {
+	ret := &nodeStoreBuffered{
+		reader:                 sc.reader,
+		nodeCache:              make(map[string]*bufferedNode, len(sc.nodeCache)),
+		deleted:                make(map[string]bool, len(sc.deleted)),
+		arity:                  sc.arity,
+		optimizeKeyCommitments: sc.optimizeKeyCommitments,
+		allowEmptyValues:       sc.allowEmptyValues,
+		digestIndex:            sc.digestIndex,
+		expiryIndex:            sc.expiryIndex,
+		changelogIndex:         sc.changelogIndex,
+		changelogSeq:           sc.changelogSeq,
+		snapshots:              sc.snapshots.fork(),
+		expectedNodes:          sc.expectedNodes,
+	}
+	for k, v := range sc.nodeCache {
+		v.frozen = true
+		ret.nodeCache[k] = v
 	}
+	for k, persisted := range sc.deleted {
+		ret.deleted[k] = persisted
+	}
+	ret.digestChanges = sc.cloneDigestChanges()
+	ret.expiryChanges = sc.cloneExpiryChanges()
+	ret.changelogChanges, ret.changelogPending = sc.cloneChangelog()
 	return ret
 }
 
@@ -86,17 +159,33 @@ func (sc *nodeStoreBuffered) getNode(unpackedKey []byte) (*bufferedNode, bool) {
 	}
 	ret, ok := sc.nodeCache[string(unpackedKey)]
 	if ok {
+		if ret.frozen {
+			// node is shared with the fork, make own copy
+			ret = ret.Clone()
+			sc.nodeCache[string(unpackedKey)] = ret
+		}
 		return ret, true
 	}
 	n, ok := sc.reader.getNode(unpackedKey)
 	if !ok {
 		return nil, false
 	}
-	ret = newBufferedNode(unpackedKey)
+	return sc.cacheNode(unpackedKey, n), true
+}
+
+// cacheNode puts the node read from the store into the cache
+func (sc *nodeStoreBuffered) cacheNode(unpackedKey []byte, n *nodeReadOnly) *bufferedNode {
+	ret := newBufferedNode(unpackedKey)
 	ret.n = n.n
-	ret.newTerminal = n.n.Terminal
+	if sc.snapshots != nil {
+		// the loaded node is the state of the node in snapshots, the cached copy is mutated
+		sc.snapshots.loaded[string(unpackedKey)] = n
+		ret.n = *n.n.Clone()
+	}
+	ret.newTerminal = ret.n.Terminal
+	ret.persisted = true
 	sc.nodeCache[string(unpackedKey)] = ret
-	return ret, true
+	return ret
 }
 
 func (sc *nodeStoreBuffered) mustGetNode(key []byte) *bufferedNode {
@@ -108,7 +197,8 @@ func (sc *nodeStoreBuffered) mustGetNode(key []byte) *bufferedNode {
 // removeKey marks unpackedKey deleted
 func (sc *nodeStoreBuffered) removeKey(unpackedKey []byte) {
 	delete(sc.nodeCache, string(unpackedKey))
-	sc.deleted[string(unpackedKey)] = struct{}{}
+	sc.deleted[string(unpackedKey)] = false
+	sc.snapshots.touch(unpackedKey)
 }
 
 // unDelete removes deletion mark, if any
@@ -130,28 +220,51 @@ func (sc *nodeStoreBuffered) replaceNode(n *bufferedNode) {
 	sc.nodeCache[string(n.unpackedKey)] = n
 }
 
-// PersistMutations persists the cache to the unpackedKey/value store
-// Does not clear cache
-func (sc *nodeStoreBuffered) persistMutations(store KVWriter) int {
-	counter := 0
-	for _, v := range sc.nodeCache {
-		store.Set(mustEncodeUnpackedBytes(v.unpackedKey, sc.arity), v.Bytes(sc.reader.m, sc.arity, sc.optimizeKeyCommitments))
-		counter++
+// persistMutations writes nodes changed since the last persist and deletes removed nodes.
+// Nodes read from the store and not modified are not written
+func (sc *nodeStoreBuffered) persistMutations(store KVWriter) PersistStats {
+	var ret PersistStats
+	for k, v := range sc.nodeCache {
+		if v.persisted && !v.isModified(sc.reader.m) {
+			continue
+		}
+		data := v.Bytes(sc.reader.codec, sc.reader.m, sc.arity, sc.optimizeKeyCommitments)
+		store.Set(mustEncodeUnpackedBytes(v.unpackedKey, sc.arity), data)
+		ret.NodesWritten++
+		ret.BytesWritten += len(data)
+		sc.snapshots.persisted(v)
+		if v.frozen {
+			// node is shared with the fork, make own copy
+			v = v.Clone()
+			sc.nodeCache[k] = v
+		}
+		v.persisted = true
 	}
-	for k := range sc.deleted {
+	for k, persisted := range sc.deleted {
+		if persisted {
+			continue
+		}
 		_, inCache := sc.nodeCache[k]
 		Assert(!inCache, "trie::persistMutations:: inconsistency. Non-existent key is marked for deletion: '%s'",
 			hex.EncodeToString([]byte(k)))
 		store.Set(mustEncodeUnpackedBytes([]byte(k), sc.arity), nil)
-		counter++
+		sc.deleted[k] = true
+		sc.snapshots.deleted(k)
+		ret.NodesDeleted++
 	}
-	return counter
+	sc.snapshots.persistedAll()
+	return ret
 }
 
 // ClearCache clears the node cache
 func (sc *nodeStoreBuffered) clearCache() {
-	sc.nodeCache = make(map[string]*bufferedNode)
-	sc.deleted = make(map[string]struct{})
+	sc.nodeCache = make(map[string]*bufferedNode, sc.expectedNodes)
+	sc.deleted = make(map[string]bool)
+	sc.digestChanges = make(map[string]*digestChange)
+	sc.expiryChanges = make(map[string]int64)
+	sc.changelogChanges = make(map[string]*digestChange)
+	sc.changelogPending = make(map[string][]byte)
+	sc.snapshots.clear()
 }
 
 func (sc *nodeStoreBuffered) dangerouslyDumpCacheToString() string {
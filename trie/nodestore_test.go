@@ -0,0 +1,44 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectedSize(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("expected size"+tn(m), func(t *testing.T) {
+			data := genData1()
+			store1 := trie.NewInMemoryKVStore()
+			tr1 := trie.New(m, store1, nil)
+			store2 := trie.NewInMemoryKVStore()
+			tr2 := trie.NewWithOptions(m, store2, nil, trie.Options{ExpectedSize: 100})
+			require.EqualValues(t, 0, tr1.Stats().ExpectedNodes)
+			require.True(t, tr2.Stats().ExpectedNodes >= 100)
+			for i, s := range data {
+				tr1.UpdateStr(s, s+"$")
+				tr2.UpdateStr(s, s+"$")
+				if i%100 == 99 {
+					tr1.Commit()
+					tr1.PersistMutations(store1)
+					tr1.ClearCache()
+					tr2.Commit()
+					tr2.PersistMutations(store2)
+					tr2.ClearCache()
+				}
+			}
+			tr1.Commit()
+			tr2.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr1), trie.RootCommitment(tr2)))
+			require.EqualValues(t, tr2.Stats().ExpectedNodes, tr2.Clone().Stats().ExpectedNodes)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
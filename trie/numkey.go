@@ -0,0 +1,96 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ErrWrongUint64Key is returned when the key is not the canonical encoding of the number (see Uint64Key)
+var ErrWrongUint64Key = errors.New("wrong uint64 key")
+
+// Uint64Key encodes the number into the key which preserves the numeric order in the lexicographical order of keys:
+// the number of significant bytes is followed by the significant bytes in big-endian order. Small numbers take
+// short keys, e.g. 0 is 0x00, 1000 is 0x0203e8 and math.MaxUint64 is 0x08ffffffffffffffff
+func Uint64Key(v uint64) []byte {
+	n := (bits.Len64(v) + 7) / 8
+	var buf [9]byte
+	buf[0] = byte(n)
+	binary.BigEndian.PutUint64(buf[1:], v)
+	return Concat(buf[0], buf[9-n:])
+}
+
+// Uint64FromKey decodes the number from the key encoded with Uint64Key. The encoding is canonical:
+// other encodings of the number are rejected
+func Uint64FromKey(key []byte) (uint64, error) {
+	if len(key) == 0 || int(key[0]) > 8 || len(key) != int(key[0])+1 {
+		return 0, ErrWrongUint64Key
+	}
+	if key[0] > 0 && key[1] == 0 {
+		// leading zero byte
+		return 0, ErrWrongUint64Key
+	}
+	var buf [8]byte
+	copy(buf[8-int(key[0]):], key[1:])
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// Uint64KeyCodec maps uint64 keys of the namespace to keys of the trie and back. The key of the number is the prefix
+// followed by the number encoded with Uint64Key, so keys of time series and indices are iterated by IterateKeys
+// in the numeric order and ranges of numbers are iterated with IterateRange
+type Uint64KeyCodec struct {
+	// Prefix is the namespace of keys
+	Prefix []byte
+}
+
+// Key returns the key of the number
+func (c Uint64KeyCodec) Key(v uint64) []byte {
+	return Concat(c.Prefix, Uint64Key(v))
+}
+
+// Decode returns the number of the key
+func (c Uint64KeyCodec) Decode(key []byte) (uint64, error) {
+	if !bytes.HasPrefix(key, c.Prefix) {
+		return 0, ErrWrongUint64Key
+	}
+	return Uint64FromKey(key[len(c.Prefix):])
+}
+
+// IterateRange iterates numbers from 'from' to 'to' inclusive committed in the trie in the ascending order,
+// together with terminal commitments. All keys of the namespace in the range must be encoded numbers.
+// Iteration stops when 'fun' returns false.
+// For the Trie, it is expected all mutations are committed
+func (c Uint64KeyCodec) IterateRange(tr NodeStore, from, to uint64, fun func(v uint64, terminal TCommitment) bool) error {
+	if from > to {
+		return nil
+	}
+	n, ok := tr.GetNode(nil)
+	if !ok {
+		return nil
+	}
+	// keys following the number before 'from'
+	after := c.Prefix
+	if from > 0 {
+		after = c.Key(from - 1)
+	}
+	last := c.Key(to)
+	var err error
+	iterateKeys(tr, n, UnpackBytes(after, tr.PathArity()), true, func(unpackedKey []byte, terminal TCommitment) bool {
+		var key []byte
+		if key, err = PackUnpackedBytes(unpackedKey, tr.PathArity()); err != nil {
+			return false
+		}
+		if bytes.Compare(key, last) > 0 {
+			return false
+		}
+		var v uint64
+		if v, err = c.Decode(key); err != nil {
+			err = fmt.Errorf("trie::Uint64KeyCodec.IterateRange: key '%x': %w", key, err)
+			return false
+		}
+		return fun(v, terminal)
+	})
+	return err
+}
@@ -0,0 +1,86 @@
+package trie_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUint64KeyCodec(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("uint64 keys"+tn(m), func(t *testing.T) {
+			codec := trie.Uint64KeyCodec{Prefix: []byte("ts/")}
+			tr := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			rnd := rand.New(rand.NewSource(42))
+			numbers := make([]uint64, 0)
+			present := make(map[uint64]bool)
+			for _, v := range []uint64{0, 1, 255, 256, 65535, 65536, math.MaxUint64} {
+				numbers = append(numbers, v)
+				present[v] = true
+			}
+			for i := 0; i < 500; i++ {
+				v := rnd.Uint64() >> uint(rnd.Intn(64))
+				if !present[v] {
+					numbers = append(numbers, v)
+					present[v] = true
+				}
+			}
+			for _, v := range numbers {
+				tr.Update(codec.Key(v), []byte(fmt.Sprintf("value %d", v)))
+			}
+			// keys around the namespace
+			tr.UpdateStr("ts", "before")
+			tr.UpdateStr("tt", "after")
+			tr.Commit()
+			sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+			check := func(from, to uint64) {
+				expected := make([]uint64, 0)
+				for _, v := range numbers {
+					if v >= from && v <= to {
+						expected = append(expected, v)
+					}
+				}
+				visited := make([]uint64, 0)
+				err := codec.IterateRange(tr, from, to, func(v uint64, terminal trie.TCommitment) bool {
+					require.NotNil(t, terminal)
+					visited = append(visited, v)
+					return true
+				})
+				require.NoError(t, err)
+				require.EqualValues(t, expected, visited)
+			}
+			check(0, math.MaxUint64)
+			check(0, 0)
+			check(1, 1000)
+			check(256, 65536)
+			check(numbers[10], numbers[100])
+			check(numbers[10]+1, numbers[100]-1)
+			check(math.MaxUint64, math.MaxUint64)
+			check(1000, 1)
+
+			count := 0
+			require.NoError(t, codec.IterateRange(tr, 0, math.MaxUint64, func(uint64, trie.TCommitment) bool {
+				count++
+				return count < 10
+			}))
+			require.EqualValues(t, 10, count)
+
+			tr.Update(codec.Key(7)[:len(codec.Key(7))-1], []byte("not a number"))
+			tr.Update(trie.Concat(codec.Key(7), "junk"), []byte("not a number"))
+			tr.Commit()
+			require.Error(t, codec.IterateRange(tr, 0, math.MaxUint64, func(uint64, trie.TCommitment) bool {
+				return true
+			}))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+}
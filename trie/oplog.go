@@ -0,0 +1,224 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Op-log is an optional append-only log of updates and deletions applied to the trie, with root commitments
+// at each commit (see Options.OpLog). Replaying the log with ReplayOpLog deterministically rebuilds the trie
+// and verifies it arrives at the same roots, so the log serves for disaster recovery and for debugging.
+// Each record is the operation byte followed by fields encoded with WriteBytes32
+
+const (
+	// opLogOpen starts the log or its continuation. Operations not committed before it are dropped by the replay
+	opLogOpen = byte(iota + 1)
+	opLogUpdate
+	opLogDelete
+	opLogCommit
+	// opLogDiscard means uncommitted operations have been discarded with ClearCache
+	opLogDiscard
+	// opLogUpdateTerminal is the update with the terminal commitment (see Trie.UpdateWithTerminal and Trie.UpdateReader)
+	opLogUpdateTerminal
+)
+
+// OpLog writes the op-log of the trie. The first error of the writer is retained and returned by Err,
+// after which nothing is written
+type OpLog struct {
+	w   io.Writer
+	err error
+	// uncommitted is number of operations since the last commit
+	uncommitted int
+	records     int
+}
+
+// NewOpLog creates the op-log on the writer. The writer may be positioned at the end of the existing log:
+// the log is continued and operations which were not committed before are dropped by the replay
+func NewOpLog(w io.Writer) *OpLog {
+	ret := &OpLog{w: w}
+	ret.write(opLogOpen)
+	return ret
+}
+
+// Err returns the first error of writing to the log
+func (l *OpLog) Err() error {
+	return l.err
+}
+
+// Records returns number of records written to the log
+func (l *OpLog) Records() int {
+	return l.records
+}
+
+func (l *OpLog) write(op byte, fields ...[]byte) {
+	if l == nil || l.err != nil {
+		return
+	}
+	if l.err = WriteByte(l.w, op); l.err != nil {
+		return
+	}
+	for _, f := range fields {
+		if l.err = WriteBytes32(l.w, f); l.err != nil {
+			return
+		}
+	}
+	l.records++
+}
+
+func (l *OpLog) update(key, value []byte) {
+	if l == nil {
+		return
+	}
+	l.write(opLogUpdate, key, value)
+	l.uncommitted++
+}
+
+func (l *OpLog) updateTerminal(key []byte, terminal TCommitment) {
+	if l == nil {
+		return
+	}
+	l.write(opLogUpdateTerminal, key, terminal.Bytes())
+	l.uncommitted++
+}
+
+func (l *OpLog) delete(key []byte) {
+	if l == nil {
+		return
+	}
+	l.write(opLogDelete, key)
+	l.uncommitted++
+}
+
+func (l *OpLog) commit(root VCommitment) {
+	if l == nil {
+		return
+	}
+	var data []byte
+	if root != nil {
+		data = root.Bytes()
+	}
+	l.write(opLogCommit, data)
+	l.uncommitted = 0
+}
+
+func (l *OpLog) discard() {
+	if l == nil || l.uncommitted == 0 {
+		return
+	}
+	l.write(opLogDiscard)
+	l.uncommitted = 0
+}
+
+// ReplayOpLog rebuilds the trie by applying operations of the op-log to the trie in the trie store.
+// The trie store must contain the trie in the state at the start of the log, normally the empty one.
+// Values are written to the value store. Nil value store means values are not written, it is allowed only if the model
+// stores all terminal commitments with nodes (i.e. the trie does not read values). The trie and its values
+// are persisted at each commit of the log, after the root commitment is verified against the one recorded in the log.
+// Options must be the options of the logged trie, the op-log and middleware options are ignored,
+// because the log contains transformed keys and values.
+// Operations after the last commit of the log are not applied.
+// Returns the root commitment after the last commit and number of replayed commits
+func ReplayOpLog(r io.Reader, model CommitmentModel, trieStore, valueStore KVStore, opt ...Options) (VCommitment, int, error) {
+	var o Options
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	o.OpLog = nil
+	o.Middleware = nil
+	tr := NewWithOptions(model, trieStore, valueStore, o)
+	root := RootCommitment(tr)
+	values := make(map[string][]byte)
+	commits := 0
+	for {
+		op, err := ReadByte(r)
+		if errors.Is(err, io.EOF) {
+			return root, commits, nil
+		}
+		if err != nil {
+			return root, commits, fmt.Errorf("trie::ReplayOpLog: %w", err)
+		}
+		switch op {
+		case opLogOpen, opLogDiscard:
+			tr.ClearCache()
+			values = make(map[string][]byte)
+		case opLogUpdate:
+			var key, value []byte
+			if key, err = readOpLogField(r); err != nil {
+				break
+			}
+			if value, err = readOpLogField(r); err != nil {
+				break
+			}
+			tr.Update(key, value)
+			values[string(key)] = value
+		case opLogUpdateTerminal:
+			var key, data []byte
+			if key, err = readOpLogField(r); err != nil {
+				break
+			}
+			if data, err = readOpLogField(r); err != nil {
+				break
+			}
+			terminal := model.NewTerminalCommitment()
+			if err = terminal.Read(bytes.NewReader(data)); err != nil {
+				return root, commits, fmt.Errorf("trie::ReplayOpLog: wrong terminal commitment after commit #%d: %w", commits, err)
+			}
+			if !model.ForceStoreTerminalWithNode(terminal) {
+				// the value, streamed with UpdateReader, is not in the log
+				return root, commits, fmt.Errorf("trie::ReplayOpLog: terminal commitment of the key '%x' after commit #%d requires the value", key, commits)
+			}
+			tr.UpdateWithTerminal(key, terminal)
+			values[string(key)] = nil
+		case opLogDelete:
+			var key []byte
+			if key, err = readOpLogField(r); err != nil {
+				break
+			}
+			tr.Delete(key)
+			values[string(key)] = nil
+		case opLogCommit:
+			var expected []byte
+			if expected, err = readOpLogField(r); err != nil {
+				break
+			}
+			tr.Commit()
+			root = RootCommitment(tr)
+			var got []byte
+			if root != nil {
+				got = root.Bytes()
+			}
+			if string(got) != string(expected) {
+				return root, commits, fmt.Errorf("trie::ReplayOpLog: root mismatch at commit #%d: expected %x, got %x",
+					commits, expected, got)
+			}
+			tr.PersistMutations(trieStore)
+			tr.ClearCache()
+			if valueStore != nil {
+				for k, v := range values {
+					valueStore.Set([]byte(k), v)
+				}
+			}
+			values = make(map[string][]byte)
+			commits++
+		default:
+			return root, commits, fmt.Errorf("trie::ReplayOpLog: wrong record %d after commit #%d", op, commits)
+		}
+		if err != nil {
+			return root, commits, fmt.Errorf("trie::ReplayOpLog: truncated record after commit #%d: %w", commits, err)
+		}
+	}
+}
+
+func readOpLogField(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := ReadUint32(r, &size); err != nil {
+		return nil, err
+	}
+	ret := make([]byte, size)
+	if _, err := io.ReadFull(r, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
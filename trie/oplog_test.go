@@ -0,0 +1,80 @@
+package trie_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpLog(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel, opt trie.Options) {
+		t.Run("op-log"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:500]
+			var logBuf bytes.Buffer
+			store := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			opt.OpLog = trie.NewOpLog(&logBuf)
+			tr := trie.NewWithOptions(m, store, valueStore, opt)
+			roots := make([]trie.VCommitment, 0)
+			commit := func(tr *trie.Trie) {
+				tr.Commit()
+				tr.PersistMutations(store)
+				tr.ClearCache()
+				roots = append(roots, trie.RootCommitment(tr))
+			}
+			for i := 0; i < len(data); i += 50 {
+				for j, s := range data[i : i+50] {
+					if j%5 == 0 {
+						tr.DeleteStr(data[(i+j)/2])
+						valueStore.Set([]byte(data[(i+j)/2]), nil)
+						continue
+					}
+					tr.UpdateStr(s, s+"~")
+					valueStore.Set([]byte(s), []byte(s+"~"))
+				}
+				commit(tr)
+			}
+			// discarded updates are not replayed
+			tr.UpdateStr("discarded", "1")
+			tr.ClearCache()
+			tr.DeleteStr(data[7])
+			valueStore.Set([]byte(data[7]), nil)
+			commit(tr)
+
+			// updates not committed before the restart are not replayed
+			tr.UpdateStr("lost", "1")
+			opt.OpLog = trie.NewOpLog(&logBuf)
+			tr = trie.NewWithOptions(m, store, valueStore, opt)
+			tr.UpdateStr("after restart", "1")
+			valueStore.Set([]byte("after restart"), []byte("1"))
+			commit(tr)
+			// not committed
+			tr.UpdateStr("pending", "1")
+			require.NoError(t, opt.OpLog.Err())
+
+			replayStore := trie.NewInMemoryKVStore()
+			replayValues := trie.NewInMemoryKVStore()
+			root, commits, err := trie.ReplayOpLog(bytes.NewReader(logBuf.Bytes()), m, replayStore, replayValues, opt)
+			require.NoError(t, err)
+			require.EqualValues(t, len(roots), commits)
+			require.True(t, m.EqualCommitments(roots[len(roots)-1], root))
+			require.EqualValues(t, storeContents(store), storeContents(replayStore))
+			require.EqualValues(t, storeContents(valueStore), storeContents(replayValues))
+
+			// replay with the wrong model or from the truncated log fails
+			_, _, err = trie.ReplayOpLog(bytes.NewReader(logBuf.Bytes()), trie_blake2b.NewWithSalt(m.PathArity(), trie_blake2b.HashSize160, []byte("other")),
+				trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore(), opt)
+			require.Error(t, err)
+			truncated := logBuf.Bytes()[:logBuf.Len()/2]
+			_, commits, err = trie.ReplayOpLog(bytes.NewReader(truncated), m, trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore(), opt)
+			require.True(t, err != nil || commits < len(roots))
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160), trie.Options{})
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize256, 10), trie.Options{OptimizeKeyCommitments: true})
+	}
+}
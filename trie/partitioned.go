@@ -0,0 +1,130 @@
+package trie
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// PartitionedCommitOptions are optional parameters of CommitPartitioned
+type PartitionedCommitOptions struct {
+	// Parallelism is the number of partitions built concurrently. Zero means the number of CPUs
+	Parallelism int
+	// Progress, if not nil, is called after each partition is merged into the trie, with the number of merged partitions
+	// out of 256
+	Progress func(partitions int)
+}
+
+// PartitionedCommitStats is the result of CommitPartitioned
+type PartitionedCommitStats struct {
+	// Root is the root commitment of the trie
+	Root VCommitment
+	// Keys is the number of committed keys
+	Keys int
+	// Partitions is the number of non-empty partitions
+	Partitions int
+}
+
+// numPartitions is the number of partitions of CommitPartitioned, one per value of the first byte of keys
+const numPartitions = 256
+
+// CommitPartitioned builds the trie of the key/value pairs in the empty trie store, for initial imports of tens
+// of millions of keys. Pairs are split into partitions by the first byte of keys. Each partition is committed
+// independently as the standalone trie, up to 'Parallelism' partitions at a time on separate cores, then partitions are
+// merged into the trie one by one with MountSubtree, and the trie is committed, persisted to the trie store and its cache
+// is cleared after each of them. So the peak memory is bounded by nodes of the partitions being built, not by the whole
+// trie. Keys of one byte, which are prefixes of partitions, are inserted in the final pass.
+// The resulting root is the same as if all pairs were committed in one batch. Pairs with empty values are skipped.
+// Each partition iterates pairs with its prefix, so pairs should implement KVPrefixIterator, otherwise each partition
+// scans all pairs. Parallelism > 1 requires pairs to be safe for concurrent iterations. Values are not written
+// to the value store
+func CommitPartitioned(model CommitmentModel, pairs KVIterator, trieStore KVStore, opt ...PartitionedCommitOptions) (*PartitionedCommitStats, error) {
+	var o PartitionedCommitOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	parallelism := o.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+	tr := New(model, trieStore, nil)
+	if _, ok := tr.GetNode(nil); ok {
+		return nil, fmt.Errorf("trie::CommitPartitioned: the trie store is not empty")
+	}
+	ret := &PartitionedCommitStats{}
+	merged := 0
+	for first := 0; first < numPartitions; first += parallelism {
+		last := first + parallelism
+		if last > numPartitions {
+			last = numPartitions
+		}
+		parts := make([]*committedPartition, last-first)
+		var wg sync.WaitGroup
+		for i := range parts {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				parts[i] = commitPartition(model, pairs, byte(first+i))
+			}(i)
+		}
+		wg.Wait()
+		for _, p := range parts {
+			if p.root != nil {
+				if err := MountSubtree(tr, []byte{p.prefix}, p.store, p.root); err != nil {
+					return nil, fmt.Errorf("trie::CommitPartitioned: %w", err)
+				}
+				tr.Commit()
+				tr.PersistMutations(trieStore)
+				tr.ClearCache()
+				ret.Partitions++
+				ret.Keys += p.keys
+			}
+			merged++
+			if o.Progress != nil {
+				o.Progress(merged)
+			}
+		}
+	}
+	pairs.Iterate(func(k, v []byte) bool {
+		if len(k) == 1 && len(v) > 0 {
+			tr.Update(k, v)
+			ret.Keys++
+		}
+		return true
+	})
+	tr.Commit()
+	tr.PersistMutations(trieStore)
+	tr.ClearCache()
+	ret.Root = RootCommitment(tr)
+	return ret, nil
+}
+
+// committedPartition is the standalone trie of suffixes of keys with the prefix
+type committedPartition struct {
+	prefix byte
+	store  KVStore
+	root   VCommitment
+	keys   int
+}
+
+func commitPartition(model CommitmentModel, pairs KVIterator, prefix byte) *committedPartition {
+	ret := &committedPartition{
+		prefix: prefix,
+		store:  NewInMemoryKVStore(),
+	}
+	tr := New(model, ret.store, nil)
+	IteratePrefix(pairs, []byte{prefix}, func(k, v []byte) bool {
+		if len(k) > 1 && len(v) > 0 {
+			tr.Update(k[1:], v)
+			ret.keys++
+		}
+		return true
+	})
+	if ret.keys == 0 {
+		return ret
+	}
+	tr.Commit()
+	tr.PersistMutations(ret.store)
+	ret.root = RootCommitment(tr)
+	return ret
+}
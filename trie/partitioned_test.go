@@ -0,0 +1,64 @@
+package trie_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitPartitioned(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel, parallelism int) {
+		t.Run(fmt.Sprintf("partitioned commit%s-%d", tn(m), parallelism), func(t *testing.T) {
+			pairs := trie.NewInMemoryKVStore()
+			for i, s := range genData1() {
+				if i%7 > 0 {
+					continue
+				}
+				pairs.Set([]byte(s), []byte(s+"$"))
+			}
+			// keys of one byte are prefixes of partitions
+			pairs.Set([]byte("a"), []byte("a$"))
+			pairs.Set([]byte{0xff}, []byte("ff$"))
+			pairs.Set([]byte("ab\x00"), []byte{})
+			expected := trie.ComputeRoot(m, pairs)
+
+			store := trie.NewInMemoryKVStore()
+			progress := 0
+			stats, err := trie.CommitPartitioned(m, pairs, store, trie.PartitionedCommitOptions{
+				Parallelism: parallelism,
+				Progress:    func(partitions int) { progress = partitions },
+			})
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(expected, stats.Root))
+			require.EqualValues(t, 256, progress)
+			require.True(t, stats.Partitions > 1)
+			keys := 0
+			pairs.Iterate(func(_, v []byte) bool {
+				if len(v) > 0 {
+					keys++
+				}
+				return true
+			})
+			require.EqualValues(t, keys, stats.Keys)
+			reader := trie.NewTrieReader(m, store, nil)
+			require.True(t, m.EqualCommitments(expected, trie.RootCommitment(reader)))
+			pairs.Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, len(v) > 0, trie.HasMany(reader, [][]byte{k})[0])
+				return true
+			})
+
+			_, err = trie.CommitPartitioned(m, pairs, store)
+			require.Error(t, err)
+		})
+	}
+	for _, parallelism := range []int{1, 4} {
+		runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160), parallelism)
+		runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256), parallelism)
+		runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256), parallelism)
+	}
+	runTest(t, trie_kzg_bn256.New(), 0)
+}
@@ -0,0 +1,160 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ThresholdCommitter is implemented by commitment models which support the terminal policy (see TerminalPolicy)
+type ThresholdCommitter interface {
+	// CommitToDataWithThreshold commits to data the same way as CommitToData does. The commitment is always stored
+	// with the node (see ForceStoreTerminalWithNode) if data is longer than the threshold
+	CommitToDataWithThreshold(data []byte, threshold int) TCommitment
+}
+
+// TerminalRule sets the value size threshold for keys with the prefix
+type TerminalRule struct {
+	// Prefix of keys, in original bytes
+	Prefix []byte
+	// Threshold is the value size threshold. Terminal commitments to values longer than the threshold are stored
+	// with the node (inlined), terminal commitments to other values are not stored and are restored from
+	// the value store upon reading of the node (externalized). 0 means all terminals are inlined
+	Threshold uint32
+}
+
+// ExternalizeAll is the threshold of the rule which externalizes terminals of all values
+const ExternalizeAll = math.MaxUint32
+
+// TerminalPolicy is the set of value size thresholds per key prefix, which overrides the single threshold of the
+// commitment model (for example, trie_blake2b.New). For example, small metadata values under one namespace may be
+// inlined with the threshold 0, so they are read without the value store, while terminals of blobs under
+// another one are always externalized, to keep nodes small.
+// The rule with the longest prefix matching the key applies. Keys which do not match any prefix follow
+// the commitment model. The policy is enforced on Update and is kept in the config record (see TrieConfig).
+// It does not change commitments, only the serialization of nodes
+type TerminalPolicy []TerminalRule
+
+// Validate checks if prefixes of rules are distinct
+func (p TerminalPolicy) Validate() error {
+	for i := range p {
+		for j := i + 1; j < len(p); j++ {
+			if bytes.Equal(p[i].Prefix, p[j].Prefix) {
+				return fmt.Errorf("terminal policy: duplicate prefix '%x'", p[i].Prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// Threshold returns the threshold of the rule with the longest prefix matching the key.
+// Returns false if no rule applies
+func (p TerminalPolicy) Threshold(key []byte) (int, bool) {
+	ret := -1
+	longest := -1
+	for i := range p {
+		if len(p[i].Prefix) > longest && bytes.HasPrefix(key, p[i].Prefix) {
+			ret = int(p[i].Threshold)
+			if uint64(p[i].Threshold) > math.MaxInt {
+				ret = math.MaxInt
+			}
+			longest = len(p[i].Prefix)
+		}
+	}
+	return ret, longest >= 0
+}
+
+func (p TerminalPolicy) Write(w io.Writer) error {
+	if err := WriteUint16(w, uint16(len(p))); err != nil {
+		return err
+	}
+	for i := range p {
+		if err := WriteBytes16(w, p[i].Prefix); err != nil {
+			return err
+		}
+		if err := WriteUint32(w, p[i].Threshold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *TerminalPolicy) Read(r io.Reader) error {
+	var size uint16
+	if err := ReadUint16(r, &size); err != nil {
+		return err
+	}
+	*p = make(TerminalPolicy, size)
+	for i := range *p {
+		var err error
+		if (*p)[i].Prefix, err = ReadBytes16(r); err != nil {
+			return err
+		}
+		if err = ReadUint32(r, &(*p)[i].Threshold); err != nil {
+			return err
+		}
+	}
+	return p.Validate()
+}
+
+// ConfigKey is the key of the config record in the metadata store (see StoreLayout.MetadataStore)
+var ConfigKey = []byte("trie_config")
+
+// TrieConfig is the persistent part of the configuration of the trie. It is kept in the config record, so all
+// processes which open the store apply the same configuration
+type TrieConfig struct {
+	TerminalPolicy TerminalPolicy
+}
+
+func TrieConfigFromBytes(data []byte) (*TrieConfig, error) {
+	ret := &TrieConfig{}
+	rdr := bytes.NewReader(data)
+	if err := ret.Read(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+func (c *TrieConfig) Bytes() []byte {
+	return MustBytes(c)
+}
+
+func (c *TrieConfig) Write(w io.Writer) error {
+	return c.TerminalPolicy.Write(w)
+}
+
+func (c *TrieConfig) Read(r io.Reader) error {
+	return c.TerminalPolicy.Read(r)
+}
+
+// Options returns options of the trie with the configuration applied
+func (c *TrieConfig) Options(opt Options) Options {
+	opt.TerminalPolicy = c.TerminalPolicy
+	return opt
+}
+
+// WriteConfig writes the config record to the metadata store
+func WriteConfig(store KVWriter, c *TrieConfig) error {
+	if err := c.TerminalPolicy.Validate(); err != nil {
+		return fmt.Errorf("trie::WriteConfig: %w", err)
+	}
+	store.Set(ConfigKey, c.Bytes())
+	return nil
+}
+
+// ReadConfig reads the config record from the metadata store. Returns empty configuration if there's no record
+func ReadConfig(store KVReader) (*TrieConfig, error) {
+	data := store.Get(ConfigKey)
+	if len(data) == 0 {
+		return &TrieConfig{}, nil
+	}
+	ret, err := TrieConfigFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("trie::ReadConfig: %w", err)
+	}
+	return ret, nil
+}
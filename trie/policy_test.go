@@ -0,0 +1,97 @@
+package trie_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminalPolicy(t *testing.T) {
+	policy := trie.TerminalPolicy{
+		{Prefix: []byte("meta/"), Threshold: 0},
+		{Prefix: []byte("blob/"), Threshold: trie.ExternalizeAll},
+	}
+	require.NoError(t, policy.Validate())
+	require.Error(t, append(policy, trie.TerminalRule{Prefix: []byte("meta/")}).Validate())
+	threshold, ok := append(policy, trie.TerminalRule{Prefix: []byte("meta/x"), Threshold: 7}).Threshold([]byte("meta/xyz"))
+	require.True(t, ok)
+	require.EqualValues(t, 7, threshold)
+	_, ok = policy.Threshold([]byte("other"))
+	require.False(t, ok)
+	require.Panics(t, func() {
+		trie.NewWithOptions(trie_kzg_bn256.New(), trie.NewInMemoryKVStore(), nil, trie.Options{TerminalPolicy: policy})
+	})
+
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("terminal policy"+tn(m), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			layout := trie.DefaultStoreLayout
+			require.NoError(t, trie.WriteConfig(layout.MetadataStore(store), &trie.TrieConfig{TerminalPolicy: policy}))
+			cfg, err := trie.ReadConfig(layout.MetadataStore(store))
+			require.NoError(t, err)
+			require.EqualValues(t, policy, cfg.TerminalPolicy)
+
+			tr := trie.NewWithLayout(m, store, layout, cfg.Options(trie.Options{}))
+			require.EqualValues(t, 2, tr.Stats().TerminalRules)
+			reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			values := layout.ValueStore(store)
+			var metaKeys, blobKeys [][]byte
+			for i := 0; i < 50; i++ {
+				// small values are externalized by the model, big ones are inlined. The policy does the opposite
+				k, v := []byte(fmt.Sprintf("meta/%03d", i)), []byte(fmt.Sprintf("m%d", i))
+				metaKeys = append(metaKeys, k)
+				tr.Update(k, v)
+				reference.Update(k, v)
+				values.Set(k, v)
+				k, v = []byte(fmt.Sprintf("blob/%03d", i)), []byte(strings.Repeat(fmt.Sprintf("blob%d", i), 30))
+				blobKeys = append(blobKeys, k)
+				tr.Update(k, v)
+				reference.Update(k, v)
+				values.Set(k, v)
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+
+			// terminals of meta keys are in nodes, terminals of blobs are restored from the value store
+			checkPlacement := func() {
+				reader := trie.NewTrieReader(m, layout.NodeStore(store), nil)
+				for _, k := range metaKeys {
+					p := trie.GetProofGeneric(reader, trie.UnpackBytes(k, m.PathArity()))
+					require.EqualValues(t, trie.EndingTerminal, p.Ending)
+				}
+				for _, k := range blobKeys {
+					require.Panics(t, func() {
+						trie.GetProofGeneric(reader, trie.UnpackBytes(k, m.PathArity()))
+					})
+				}
+			}
+			checkPlacement()
+
+			// nodes of blobs rewritten by another process keep terminals in the value store
+			cfg, err = trie.ReadConfig(layout.MetadataStore(store))
+			require.NoError(t, err)
+			tr = trie.NewWithLayout(m, store, layout, cfg.Options(trie.Options{}))
+			for _, k := range blobKeys {
+				kk := trie.Concat(k, "/x")
+				tr.Update(kk, []byte("x"))
+				reference.Update(kk, []byte("x"))
+				values.Set(kk, []byte("x"))
+			}
+			tr.Commit()
+			tr.PersistMutations(layout.NodeStore(store))
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+			checkPlacement()
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160, 10))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256, 10))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256, 10))
+}
@@ -0,0 +1,96 @@
+package trie
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferPool provides buffers for serialization of nodes and proofs. The buffer is returned to the pool as soon as
+// serialized data is copied out of it, so buffers are never retained by the trie. Implementations must be safe
+// for concurrent use
+type BufferPool interface {
+	// Get returns an empty buffer
+	Get() *bytes.Buffer
+	// Put returns the buffer to the pool
+	Put(buf *bytes.Buffer)
+}
+
+// maxPooledBufferSize is the capacity of buffers above which the default pool does not keep them,
+// so one huge serialization does not pin memory
+const maxPooledBufferSize = 1 << 16
+
+type syncBufferPool struct {
+	pool sync.Pool
+}
+
+func newSyncBufferPool() *syncBufferPool {
+	return &syncBufferPool{pool: sync.Pool{
+		New: func() interface{} { return new(bytes.Buffer) },
+	}}
+}
+
+func (p *syncBufferPool) Get() *bytes.Buffer {
+	return p.pool.Get().(*bytes.Buffer)
+}
+
+func (p *syncBufferPool) Put(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	p.pool.Put(buf)
+}
+
+// bufferPoolHolder wraps the pool, because atomic.Value requires values of the same concrete type
+type bufferPoolHolder struct {
+	BufferPool
+}
+
+var (
+	defaultBufferPool BufferPool = newSyncBufferPool()
+	bufferPool        atomic.Value
+	readerPool        = sync.Pool{
+		New: func() interface{} { return new(bytes.Reader) },
+	}
+)
+
+func init() {
+	bufferPool.Store(bufferPoolHolder{defaultBufferPool})
+}
+
+// SetBufferPool overrides the pool of buffers used in serialization of nodes and proofs, for example with the pool
+// of an arena shared with other components of the application. Nil restores the default sync.Pool based pool
+func SetBufferPool(p BufferPool) {
+	if p == nil {
+		p = defaultBufferPool
+	}
+	bufferPool.Store(bufferPoolHolder{p})
+}
+
+// getBuffer takes the empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	ret := bufferPool.Load().(bufferPoolHolder).Get()
+	ret.Reset()
+	return ret
+}
+
+// putBuffer returns the buffer to the pool and returns the copy of its content
+func putBuffer(buf *bytes.Buffer) []byte {
+	ret := make([]byte, buf.Len())
+	copy(ret, buf.Bytes())
+	buf.Reset()
+	bufferPool.Load().(bufferPoolHolder).Put(buf)
+	return ret
+}
+
+// getReader takes the reader of data from the pool. The reader is returned with putReader
+func getReader(data []byte) *bytes.Reader {
+	ret := readerPool.Get().(*bytes.Reader)
+	ret.Reset(data)
+	return ret
+}
+
+func putReader(r *bytes.Reader) {
+	r.Reset(nil)
+	readerPool.Put(r)
+}
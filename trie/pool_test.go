@@ -0,0 +1,77 @@
+package trie_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+type countingBufferPool struct {
+	mutex sync.Mutex
+	free  []*bytes.Buffer
+	gets  int
+	puts  int
+}
+
+func (p *countingBufferPool) Get() *bytes.Buffer {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.gets++
+	if len(p.free) == 0 {
+		return new(bytes.Buffer)
+	}
+	ret := p.free[len(p.free)-1]
+	p.free = p.free[:len(p.free)-1]
+	return ret
+}
+
+func (p *countingBufferPool) Put(buf *bytes.Buffer) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.puts++
+	p.free = append(p.free, buf)
+}
+
+func TestBufferPool(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("buffer pool"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			build := func() (trie.VCommitment, map[string]string) {
+				store := trie.NewInMemoryKVStore()
+				tr := trie.New(m, store, nil)
+				for _, s := range data {
+					tr.UpdateStr(s, s+"~")
+				}
+				tr.Commit()
+				for _, s := range data[:len(data)/2] {
+					tr.DeleteStr(s)
+				}
+				tr.Commit()
+				tr.PersistMutations(store)
+				return trie.RootCommitment(tr), storeContents(store)
+			}
+			rootDefault, contentsDefault := build()
+
+			pool := &countingBufferPool{}
+			trie.SetBufferPool(pool)
+			defer trie.SetBufferPool(nil)
+
+			root, contents := build()
+			require.True(t, m.EqualCommitments(rootDefault, root))
+			require.EqualValues(t, contentsDefault, contents)
+			require.True(t, pool.gets > 0)
+			require.EqualValues(t, pool.gets, pool.puts)
+			// buffers are reused, so few of them are allocated
+			require.True(t, len(pool.free) < 10)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,112 @@
+package trie
+
+import (
+	"bytes"
+	"sync"
+)
+
+const defaultPrefetchParallelism = 8
+
+// Prefetch warms the node cache of the trie with nodes on the paths of the keys (in original bytes), for example
+// with keys from access lists of transactions of the next block, before the block is executed.
+// Nodes are read from the store with 'parallelism' concurrent workers (default 8), which hides the latency of
+// remote or disk stores. Nodes which are already cached, including uncommitted ones, are not read again.
+// The trie store and the value store must be safe for concurrent reads. The trie must not be used concurrently
+// with Prefetch. Keys are transformed by the middleware of the trie. Returns number of nodes read from the store
+func (tr *Trie) Prefetch(keys [][]byte, parallelism ...int) int {
+	p := defaultPrefetchParallelism
+	if len(parallelism) > 0 && parallelism[0] > 0 {
+		p = parallelism[0]
+	}
+	pf := &prefetcher{
+		sc:      tr.nodeStore,
+		fetched: make(map[string]*nodeReadOnly),
+	}
+	// the root is on the path of all keys
+	if _, ok := pf.node(nil); !ok {
+		return pf.store()
+	}
+	ch := make(chan []byte)
+	var wg sync.WaitGroup
+	for w := 0; w < p; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for unpackedKey := range ch {
+				pf.prefetchPath(unpackedKey)
+			}
+		}()
+	}
+	for _, k := range keys {
+		ch <- UnpackBytes(tr.middleware.TransformKey(k), tr.PathArity())
+	}
+	close(ch)
+	wg.Wait()
+	return pf.store()
+}
+
+// prefetcher reads nodes concurrently. The node cache of the trie is only read by workers
+// and is updated when all workers are finished
+type prefetcher struct {
+	sc      *nodeStoreBuffered
+	mutex   sync.Mutex
+	fetched map[string]*nodeReadOnly
+}
+
+// node returns data of the node from the cache of the trie, from already fetched nodes or from the store
+func (pf *prefetcher) node(unpackedKey []byte) (*NodeData, bool) {
+	if _, isDeleted := pf.sc.deleted[string(unpackedKey)]; isDeleted {
+		return nil, false
+	}
+	if n, ok := pf.sc.nodeCache[string(unpackedKey)]; ok {
+		return &n.n, true
+	}
+	pf.mutex.Lock()
+	n, ok := pf.fetched[string(unpackedKey)]
+	pf.mutex.Unlock()
+	if ok {
+		if n == nil {
+			return nil, false
+		}
+		return &n.n, true
+	}
+	n, ok = pf.sc.reader.getNode(unpackedKey)
+	pf.mutex.Lock()
+	defer pf.mutex.Unlock()
+	if !ok {
+		// absence is remembered too, so the store is not asked again
+		pf.fetched[string(unpackedKey)] = nil
+		return nil, false
+	}
+	pf.fetched[string(unpackedKey)] = n
+	return &n.n, true
+}
+
+// prefetchPath reads nodes along the path of the key, same way as the path is followed upon update
+func (pf *prefetcher) prefetchPath(unpackedKey []byte) {
+	var key []byte
+	for {
+		n, ok := pf.node(key)
+		if !ok {
+			return
+		}
+		path := Concat(key, n.PathFragment)
+		if len(unpackedKey) <= len(path) || !bytes.HasPrefix(unpackedKey, path) {
+			return
+		}
+		key = Concat(path, unpackedKey[len(path)])
+	}
+}
+
+// store puts fetched nodes into the node cache of the trie. Returns number of nodes read from the store
+func (pf *prefetcher) store() int {
+	ret := 0
+	for k, n := range pf.fetched {
+		if n == nil {
+			continue
+		}
+		pf.sc.cacheNode([]byte(k), n)
+		ret++
+	}
+	return ret
+}
@@ -0,0 +1,86 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("prefetch"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:2000]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range data[:1500] {
+				tr.UpdateStr(s, s+"+")
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+
+			block := make([][]byte, 0)
+			for _, s := range data[1000:] {
+				block = append(block, []byte(s))
+			}
+			execute := func(tr *trie.Trie) trie.VCommitment {
+				for i, k := range block {
+					if i%3 == 0 {
+						tr.Delete(k)
+					} else {
+						tr.Update(k, []byte("new"))
+					}
+				}
+				tr.Commit()
+				return trie.RootCommitment(tr)
+			}
+			counting := &countingKVReader{KVReader: store}
+			expected := execute(trie.New(m, counting, nil))
+			readsWithoutPrefetch := counting.reads
+
+			counting.reads = 0
+			tr = trie.New(m, counting, nil)
+			tr.UpdateStr(data[0], "uncommitted")
+			n := tr.Prefetch(block)
+			require.True(t, n > 0)
+			// absent nodes are looked up too
+			require.True(t, counting.reads > n)
+			// all existing nodes on paths are cached, only absent nodes are looked up again
+			require.EqualValues(t, 0, tr.Prefetch(block, 1))
+
+			counting.reads = 0
+			tr.UpdateStr(data[0], data[0]+"+")
+			require.True(t, m.EqualCommitments(expected, execute(tr)))
+			require.True(t, counting.reads < readsWithoutPrefetch-n)
+
+			require.EqualValues(t, 0, trie.New(m, trie.NewInMemoryKVStore(), nil).Prefetch(block))
+		})
+		t.Run("prefetch with middleware"+tn(m), func(t *testing.T) {
+			opt := trie.Options{Middleware: trie.MiddlewareChain{prefixMiddleware("pref:")}}
+			store := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, opt)
+			keys := make([][]byte, 0)
+			for _, s := range genData1()[:500] {
+				tr.UpdateStr(s, s+"+")
+				keys = append(keys, []byte(s))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+
+			counting := &countingKVReader{KVReader: store}
+			tr = trie.NewWithOptions(m, counting, nil, opt)
+			require.True(t, tr.Prefetch(keys) > 0)
+			// paths of transformed keys are cached, updates of existing keys don't read the store
+			counting.reads = 0
+			for _, k := range keys {
+				tr.Update(k, []byte("new"))
+			}
+			tr.Commit()
+			require.EqualValues(t, 0, counting.reads)
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160))
+	}
+}
@@ -13,6 +13,9 @@ type ProofGeneric struct {
 	Key    []byte
 	Path   [][]byte
 	Ending ProofEndingCode
+	// Nodes are the nodes of the trie along the Path, read while collecting the path.
+	// Allows the model to build the proof without reading nodes from the store again
+	Nodes []Node
 }
 
 type ProofEndingCode byte
@@ -48,14 +51,74 @@ func (p *ProofGeneric) String() string {
 // Should be immediately converted into the specific proof model independent of the trie
 // Normally only called by the model
 func GetProofGeneric(tr NodeStore, unpackedKey []byte) *ProofGeneric {
-	p, _, ending := proofPath(tr, unpackedKey)
+	tracer, ctx := tracerOf(tr)
+	span := startSpan(ctx, tracer, SpanProof)
+	defer span.End()
+	p, nodes, _, ending := proofPathWithNodes(tr, unpackedKey)
+	span.SetAttribute(AttrPathLength, int64(len(p)))
 	return &ProofGeneric{
 		Key:    unpackedKey,
 		Path:   p,
 		Ending: ending,
+		Nodes:  nodes,
 	}
 }
 
+// GetProofGenericAnchored returns generic proof path of the key relative to the subtrie of keys with the unpacked
+// anchor prefix, i.e. the proof which is verified against the commitment returned by CommitmentAt.
+// The Key of the returned proof is the part of the key after the anchor. The first node of the path is the topmost node
+// of the subtrie with the path fragment relative to the anchor. Path contains keys of the nodes in the trie.
+// Returns nil if the key does not start with the anchor or if no keys with the anchor are committed in the trie
+func GetProofGenericAnchored(tr NodeStore, unpackedKey, unpackedAnchor []byte) *ProofGeneric {
+	if !bytes.HasPrefix(unpackedKey, unpackedAnchor) {
+		return nil
+	}
+	anchorNode, ok := findNodeByPrefix(tr, unpackedAnchor)
+	if !ok {
+		return nil
+	}
+	p := GetProofGeneric(tr, unpackedKey)
+	for i := range p.Path {
+		if !bytes.Equal(p.Path[i], anchorNode.Key()) {
+			continue
+		}
+		nodes := make([]Node, len(p.Nodes)-i)
+		copy(nodes, p.Nodes[i:])
+		nodes[0] = &anchoredNode{
+			Node:         nodes[0],
+			pathFragment: Concat(anchorNode.Key(), anchorNode.PathFragment())[len(unpackedAnchor):],
+		}
+		return &ProofGeneric{
+			Key:    unpackedKey[len(unpackedAnchor):],
+			Path:   p.Path[i:],
+			Ending: p.Ending,
+			Nodes:  nodes,
+		}
+	}
+	panic("trie::GetProofGenericAnchored: inconsistency: proof path does not contain the anchor node")
+}
+
+// anchoredNode is the topmost node of the subtrie with the path fragment relative to the anchor prefix
+type anchoredNode struct {
+	Node
+	pathFragment []byte
+}
+
+func (n *anchoredNode) PathFragment() []byte {
+	return n.pathFragment
+}
+
+// GetWithProofGeneric returns value of the key from the value store together with the generic proof.
+// Nodes along the path are read only once. Returns nil value if the value store is not provided
+// or the key is absent
+func (tr *TrieReader) GetWithProofGeneric(key []byte) ([]byte, *ProofGeneric) {
+	proof := GetProofGeneric(tr, UnpackBytes(key, tr.PathArity()))
+	if tr.reader.valueStore == nil {
+		return nil, proof
+	}
+	return tr.reader.valueStore.Get(key), proof
+}
+
 // proofPath takes full unpackedKey as 'path' and collects the trie path up to the deepest possible node
 // It returns:
 // - path of keys which leads to 'finalKey'
@@ -66,25 +129,33 @@ func GetProofGeneric(tr NodeStore, unpackedKey []byte) *ProofGeneric {
 //    prefix of the 'finalKey'. The trie must be reorged to include the new unpackedKey
 // -- EndingExtend the path is a prefix of the 'finalKey', so trie must be extended to the same direction with new node
 func proofPath(trieAccess NodeStore, unpackedKey []byte) ([][]byte, []byte, ProofEndingCode) {
+	proof, _, prefix, ending := proofPathWithNodes(trieAccess, unpackedKey)
+	return proof, prefix, ending
+}
+
+// proofPathWithNodes is proofPath which also returns nodes along the path
+func proofPathWithNodes(trieAccess NodeStore, unpackedKey []byte) ([][]byte, []Node, []byte, ProofEndingCode) {
 	n, ok := trieAccess.GetNode(nil)
 	if !ok {
-		return nil, nil, 0
+		return nil, nil, nil, 0
 	}
 
 	proof := make([][]byte, 0)
+	nodes := make([]Node, 0)
 	var key []byte
 
 	for {
 		proof = append(proof, key)
+		nodes = append(nodes, n)
 		Assert(len(key) <= len(unpackedKey), "trie::proofPath assert: len(unpackedKey) <= len(unpackedKey), key: '%s', unpackedKey: '%s'",
 			hex.EncodeToString(key), hex.EncodeToString(unpackedKey))
 		if bytes.Equal(unpackedKey[len(key):], n.PathFragment()) {
-			return proof, nil, EndingTerminal
+			return proof, nodes, nil, EndingTerminal
 		}
 		prefix := commonPrefix(unpackedKey[len(key):], n.PathFragment())
 
 		if len(prefix) < len(n.PathFragment()) {
-			return proof, prefix, EndingSplit
+			return proof, nodes, prefix, EndingSplit
 		}
 		Assert(len(prefix) == len(n.PathFragment()), "trie::proofPath assert: len(prefix)==len(n.PathFragment), prefix: '%s', pathFragment: '%s'",
 			hex.EncodeToString(prefix), hex.EncodeToString(n.PathFragment()))
@@ -96,7 +167,7 @@ func proofPath(trieAccess NodeStore, unpackedKey []byte) ([][]byte, []byte, Proo
 		n, ok = trieAccess.GetNode(key)
 		if !ok {
 			// if there are no commitment to the child at the position, it means trie must be extended at this point
-			return proof, prefix, EndingExtend
+			return proof, nodes, prefix, EndingExtend
 		}
 	}
 }
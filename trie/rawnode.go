@@ -0,0 +1,109 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrNodeMismatch is returned when the serialized node does not match the commitment expected by its parent or the root
+var ErrNodeMismatch = errors.New("trie: node does not match the commitment")
+
+// RawNodeOptions are optional parameters of NewRawNodeStore
+type RawNodeOptions struct {
+	// Codec of serialized nodes. Nil means BinaryCodec
+	Codec Codec
+	// ValueStore is the value store of the trie. Required to validate nodes which do not store terminal commitments
+	ValueStore KVReader
+}
+
+// RawNodeStore moves serialized nodes in and out of the node store by their keys in the store (see EncodeUnpackedBytes),
+// so replication and state sync layers can transfer the trie node by node without higher level APIs.
+// Each node put into the store is checked against the commitment expected by the trusted root: the root node
+// must hash to the root commitment, any other node must hash to the child commitment of its parent, which must be
+// put before. This way inconsistent nodes can't be injected into the store, while the trie is transferred in any order
+// of parents before children
+type RawNodeStore struct {
+	model      CommitmentModel
+	store      KVStore
+	root       VCommitment
+	codec      Codec
+	valueStore KVReader
+}
+
+// NewRawNodeStore creates the RawNodeStore over the node store for the trusted root commitment
+func NewRawNodeStore(model CommitmentModel, store KVStore, root VCommitment, opt ...RawNodeOptions) *RawNodeStore {
+	var o RawNodeOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	return &RawNodeStore{
+		model:      model,
+		store:      store,
+		root:       root,
+		codec:      codecOrDefault(o.Codec),
+		valueStore: o.ValueStore,
+	}
+}
+
+// GetRawNode returns the serialized node under the key in the node store. Nil if the node is absent
+func (s *RawNodeStore) GetRawNode(nodeKey []byte) []byte {
+	return s.store.Get(nodeKey)
+}
+
+// PutRawNode validates the serialized node and writes it under the key in the node store. Returns the error
+// wrapping ErrNodeMismatch if the node does not hash to the expected commitment, or the error if the parent
+// of the node is not in the store yet. Nothing is written on error
+func (s *RawNodeStore) PutRawNode(nodeKey, data []byte) error {
+	unpackedKey, err := DecodeToUnpackedBytes(nodeKey, s.model.PathArity())
+	if err != nil {
+		return fmt.Errorf("trie::PutRawNode: wrong node key '%s': %w", hex.EncodeToString(nodeKey), err)
+	}
+	expected, err := s.expectedCommitment(unpackedKey)
+	if err != nil {
+		return fmt.Errorf("trie::PutRawNode: %w", err)
+	}
+	n, err := nodeReadOnlyFromBytes(s.codec, s.model, data, unpackedKey, s.model.PathArity(), s.valueStore)
+	if err != nil {
+		return fmt.Errorf("trie::PutRawNode: can't read node '%s': %w", hex.EncodeToString(unpackedKey), err)
+	}
+	if !s.model.EqualCommitments(nodeCommitment(s.model, n), expected) {
+		return fmt.Errorf("trie::PutRawNode: node '%s': %w", hex.EncodeToString(unpackedKey), ErrNodeMismatch)
+	}
+	s.store.Set(nodeKey, data)
+	return nil
+}
+
+// expectedCommitment returns the commitment of the node with the unpacked key, expected by the root or by the parent
+// of the node. The path from the root to the parent is read from the store and verified
+func (s *RawNodeStore) expectedCommitment(unpackedKey []byte) (VCommitment, error) {
+	if s.root == nil {
+		return nil, fmt.Errorf("the trie is empty")
+	}
+	if len(unpackedKey) == 0 {
+		return s.root, nil
+	}
+	var key []byte
+	expected := s.root
+	for {
+		n, err := readVerifiedNode(s.codec, s.store, s.model, s.valueStore, key, expected)
+		if err != nil {
+			return nil, fmt.Errorf("parent of node '%s': %w", hex.EncodeToString(unpackedKey), err)
+		}
+		full := Concat(n.Key(), n.PathFragment())
+		if len(unpackedKey) <= len(full) || !bytes.HasPrefix(unpackedKey, full) {
+			return nil, fmt.Errorf("node '%s' is not in the trie", hex.EncodeToString(unpackedKey))
+		}
+		childIndex := unpackedKey[len(full)]
+		c, ok := n.ChildCommitments()[childIndex]
+		if !ok {
+			return nil, fmt.Errorf("node '%s' is not in the trie", hex.EncodeToString(unpackedKey))
+		}
+		key = childKey(n, childIndex)
+		if len(key) == len(unpackedKey) {
+			return c, nil
+		}
+		expected = c
+	}
+}
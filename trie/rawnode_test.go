@@ -0,0 +1,81 @@
+package trie_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRawNodeStore(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("raw nodes"+tn(m), func(t *testing.T) {
+			src := trie.NewInMemoryKVStore()
+			tr := trie.New(m, src, nil)
+			data := genData1()[:100]
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutations(src)
+			root := trie.RootCommitment(tr)
+
+			// nodes are put parents first
+			type rawNode struct {
+				key, unpackedKey, data []byte
+			}
+			nodes := make([]rawNode, 0)
+			src.Iterate(func(k, v []byte) bool {
+				unpacked, err := trie.DecodeToUnpackedBytes(k, m.PathArity())
+				require.NoError(t, err)
+				nodes = append(nodes, rawNode{key: k, unpackedKey: unpacked, data: v})
+				return true
+			})
+			sort.Slice(nodes, func(i, j int) bool {
+				return len(nodes[i].unpackedKey) < len(nodes[j].unpackedKey)
+			})
+			srcNodes := trie.NewRawNodeStore(m, src, root)
+			dst := trie.NewInMemoryKVStore()
+			dstNodes := trie.NewRawNodeStore(m, dst, root)
+			// the child can't be put before its parent
+			require.Error(t, dstNodes.PutRawNode(nodes[len(nodes)-1].key, nodes[len(nodes)-1].data))
+			for i, n := range nodes {
+				require.EqualValues(t, n.data, srcNodes.GetRawNode(n.key))
+				if i > 0 {
+					// the node under the key of another node is rejected
+					err := dstNodes.PutRawNode(n.key, nodes[i-1].data)
+					require.ErrorIs(t, err, trie.ErrNodeMismatch)
+				}
+				require.NoError(t, dstNodes.PutRawNode(n.key, n.data))
+			}
+			count := 0
+			dst.Iterate(func([]byte, []byte) bool {
+				count++
+				return true
+			})
+			require.EqualValues(t, len(nodes), count)
+			reader := trie.NewTrieReader(m, dst, nil)
+			require.True(t, m.EqualCommitments(root, trie.RootCommitment(reader)))
+			for _, s := range data {
+				require.True(t, trie.HasMany(reader, [][]byte{[]byte(s)})[0])
+			}
+
+			// nodes of another trie are rejected
+			tr.UpdateStr(data[0], "other")
+			tr.Commit()
+			other := trie.NewInMemoryKVStore()
+			tr.PersistMutations(other)
+			other.Iterate(func(k, v []byte) bool {
+				require.Error(t, dstNodes.PutRawNode(k, v))
+				return true
+			})
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,180 @@
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrReadOnly is returned, or panicked with by mutators which do not return errors, when the trie in the read-only
+// mode is mutated (see Trie.SetReadOnly)
+var ErrReadOnly = errors.New("trie: the trie is read-only")
+
+// SetReadOnly switches the read-only mode of the trie at runtime. In the read-only mode the trie serves reads,
+// iterations and proofs, while updates, deletions, commits and persisting of mutations are rejected with ErrReadOnly
+// before anything is changed, so the state can be frozen during maintenance or when the store is mounted read-only.
+// Mutations buffered before the switch are kept and can be committed and persisted after the mode is switched off.
+// Mutators which return errors, such as TryCommit, DeletePrefix or TryUpdate, return the error wrapping ErrReadOnly,
+// other mutators panic with it. Each panicking mutator has the Try variant which returns the error instead,
+// for example TryUpdateMany, TryPersistMutations or TryMutationSet. The mode can be switched from any goroutine.
+// Clones and forks of the trie are created writable
+func (tr *Trie) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	if atomic.SwapInt32(&tr.readOnly, v) != v {
+		tr.log.Debugf("trie: read-only mode: %v", readOnly)
+	}
+}
+
+// IsReadOnly returns true if the trie is in the read-only mode (see SetReadOnly)
+func (tr *Trie) IsReadOnly() bool {
+	return atomic.LoadInt32(&tr.readOnly) != 0
+}
+
+// checkWritable returns the error wrapping ErrReadOnly if the trie is in the read-only mode
+func (tr *Trie) checkWritable(op string) error {
+	if tr.IsReadOnly() {
+		return fmt.Errorf("trie::%s: %w", op, ErrReadOnly)
+	}
+	return nil
+}
+
+// mustBeWritable panics with the error wrapping ErrReadOnly if the trie is in the read-only mode
+func (tr *Trie) mustBeWritable(op string) {
+	if err := tr.checkWritable(op); err != nil {
+		panic(err)
+	}
+}
+
+// TryUpdate is Update which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TryUpdate(key, value []byte) error {
+	if err := tr.checkWritable("TryUpdate"); err != nil {
+		return err
+	}
+	tr.Update(key, value)
+	return nil
+}
+
+// TryDelete is Delete which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TryDelete(key []byte) error {
+	if err := tr.checkWritable("TryDelete"); err != nil {
+		return err
+	}
+	tr.Delete(key)
+	return nil
+}
+
+// TryUpdateMany is UpdateMany which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TryUpdateMany(keys, values [][]byte) error {
+	if err := tr.checkWritable("TryUpdateMany"); err != nil {
+		return err
+	}
+	tr.UpdateMany(keys, values)
+	return nil
+}
+
+// TryUpdateAll is UpdateAll which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TryUpdateAll(store KVIterator) error {
+	if err := tr.checkWritable("TryUpdateAll"); err != nil {
+		return err
+	}
+	tr.UpdateAll(store)
+	return nil
+}
+
+// TryUpdateWithTerminal is UpdateWithTerminal which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode
+func (tr *Trie) TryUpdateWithTerminal(key []byte, terminal TCommitment) error {
+	if err := tr.checkWritable("TryUpdateWithTerminal"); err != nil {
+		return err
+	}
+	tr.UpdateWithTerminal(key, terminal)
+	return nil
+}
+
+// TryUpdateWithExpiry is UpdateWithExpiry which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode
+func (tr *Trie) TryUpdateWithExpiry(key, value []byte, expiry time.Time) error {
+	if err := tr.checkWritable("TryUpdateWithExpiry"); err != nil {
+		return err
+	}
+	tr.UpdateWithExpiry(key, value, expiry)
+	return nil
+}
+
+// TryInsertKeyCommitment is InsertKeyCommitment which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode
+func (tr *Trie) TryInsertKeyCommitment(key []byte) error {
+	if err := tr.checkWritable("TryInsertKeyCommitment"); err != nil {
+		return err
+	}
+	tr.InsertKeyCommitment(key)
+	return nil
+}
+
+// TryExpire is Expire which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TryExpire(now time.Time) (int, error) {
+	if err := tr.checkWritable("TryExpire"); err != nil {
+		return 0, err
+	}
+	return tr.Expire(now), nil
+}
+
+// TrySetMetadata is SetMetadata which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TrySetMetadata(md *Metadata, valueStore KVWriter) error {
+	if err := tr.checkWritable("TrySetMetadata"); err != nil {
+		return err
+	}
+	tr.SetMetadata(md, valueStore)
+	return nil
+}
+
+// TryPersistMutations is PersistMutationsWithStats which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode
+func (tr *Trie) TryPersistMutations(store KVWriter) (PersistStats, error) {
+	if err := tr.checkWritable("TryPersistMutations"); err != nil {
+		return PersistStats{}, err
+	}
+	return tr.PersistMutationsWithStats(store), nil
+}
+
+// TryPersistMutationsWAL is PersistMutationsWAL which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode. Nothing is journaled then
+func (tr *Trie) TryPersistMutationsWAL(store KVWriter, wal *WAL) (PersistStats, error) {
+	if err := tr.checkWritable("TryPersistMutationsWAL"); err != nil {
+		return PersistStats{}, err
+	}
+	return tr.PersistMutationsWAL(store, wal), nil
+}
+
+// TryPersistMutationsAsync is PersistMutationsAsync which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode. Nothing is handed to the pipeline then
+func (tr *Trie) TryPersistMutationsAsync(p *AsyncPersister) (*DurabilityBarrier, PersistStats, error) {
+	if err := tr.checkWritable("TryPersistMutationsAsync"); err != nil {
+		return nil, PersistStats{}, err
+	}
+	barrier, stats := tr.PersistMutationsAsync(p)
+	return barrier, stats, nil
+}
+
+// TryMutationSet is MutationSet which returns the error wrapping ErrReadOnly instead of panicking in the read-only mode
+func (tr *Trie) TryMutationSet() ([]NodeMutation, PersistStats, error) {
+	if err := tr.checkWritable("TryMutationSet"); err != nil {
+		return nil, PersistStats{}, err
+	}
+	mutations, stats := tr.MutationSet()
+	return mutations, stats, nil
+}
+
+// TryMutationSetWithIndexes is MutationSetWithIndexes which returns the error wrapping ErrReadOnly instead of panicking
+// in the read-only mode
+func (tr *Trie) TryMutationSetWithIndexes() ([]NodeMutation, IndexMutations, PersistStats, error) {
+	if err := tr.checkWritable("TryMutationSetWithIndexes"); err != nil {
+		return nil, IndexMutations{}, PersistStats{}, err
+	}
+	nodes, indexes, stats := tr.MutationSetWithIndexes()
+	return nodes, indexes, stats, nil
+}
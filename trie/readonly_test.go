@@ -0,0 +1,114 @@
+package trie_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+// requireReadOnlyPanic checks the function panics with ErrReadOnly
+func requireReadOnlyPanic(t *testing.T, fun func()) {
+	defer func() {
+		err, ok := recover().(error)
+		require.True(t, ok)
+		require.True(t, errors.Is(err, trie.ErrReadOnly))
+	}()
+	fun()
+}
+
+func TestReadOnly(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("read-only"+tn(m), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			data := genData1()[:100]
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			root := trie.RootCommitment(tr)
+
+			tr.SetReadOnly(true)
+			require.True(t, tr.IsReadOnly())
+			require.True(t, tr.Stats().ReadOnly)
+			requireReadOnlyPanic(t, func() { tr.UpdateStr("new", "new$") })
+			requireReadOnlyPanic(t, func() { tr.DeleteStr(data[0]) })
+			requireReadOnlyPanic(t, func() { tr.UpdateMany([][]byte{[]byte("new")}, [][]byte{[]byte("new$")}) })
+			requireReadOnlyPanic(t, func() { tr.Commit() })
+			requireReadOnlyPanic(t, func() { tr.PersistMutations(store) })
+			requireReadOnlyPanic(t, func() { tr.MutationSet() })
+			require.ErrorIs(t, tr.TryUpdate([]byte("new"), []byte("new$")), trie.ErrReadOnly)
+			require.ErrorIs(t, tr.TryDelete([]byte(data[0])), trie.ErrReadOnly)
+			_, err := tr.TryCommit()
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			_, err = tr.DeletePrefix([]byte(data[0]))
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+
+			// each panicking mutator has the Try variant which returns the error
+			storeBefore := storeContents(store)
+			require.ErrorIs(t, tr.TryUpdateMany([][]byte{[]byte("new")}, [][]byte{[]byte("new$")}), trie.ErrReadOnly)
+			require.ErrorIs(t, tr.TryUpdateAll(trie.NewInMemoryKVStore()), trie.ErrReadOnly)
+			require.ErrorIs(t, tr.TryUpdateWithTerminal([]byte("new"), nil), trie.ErrReadOnly)
+			require.ErrorIs(t, tr.TryUpdateWithExpiry([]byte("new"), []byte("new$"), time.Now()), trie.ErrReadOnly)
+			require.ErrorIs(t, tr.TryInsertKeyCommitment([]byte("new")), trie.ErrReadOnly)
+			_, err = tr.TryExpire(time.Now())
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			require.ErrorIs(t, tr.TrySetMetadata(&trie.Metadata{StateIndex: 1}, store), trie.ErrReadOnly)
+			_, err = tr.TryPersistMutations(store)
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			_, err = tr.TryPersistMutationsWAL(store, trie.NewWAL(trie.NewInMemoryKVStore()))
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			_, _, err = tr.TryPersistMutationsAsync(nil)
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			_, _, err = tr.TryMutationSet()
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			_, _, _, err = tr.TryMutationSetWithIndexes()
+			require.ErrorIs(t, err, trie.ErrReadOnly)
+			require.EqualValues(t, storeBefore, storeContents(store))
+
+			// reads and proofs are served
+			require.True(t, m.EqualCommitments(root, trie.RootCommitment(tr)))
+			keys := make([][]byte, len(data))
+			for i, s := range data {
+				keys[i] = []byte(s)
+			}
+			for _, has := range trie.HasMany(tr, keys) {
+				require.True(t, has)
+			}
+			require.False(t, trie.HasMany(tr, [][]byte{[]byte("new")})[0])
+			p := trie.GetProofGeneric(tr, trie.UnpackBytes([]byte(data[0]), m.PathArity()))
+			require.EqualValues(t, trie.EndingTerminal, p.Ending)
+
+			// mutations buffered before the switch are committed after it
+			tr.SetReadOnly(false)
+			require.False(t, tr.IsReadOnly())
+			tr.UpdateStr("pending", "pending$")
+			tr.SetReadOnly(true)
+			requireReadOnlyPanic(t, func() { tr.Commit() })
+			tr.SetReadOnly(false)
+			require.NoError(t, tr.TryUpdateMany([][]byte{[]byte("pending1")}, [][]byte{[]byte("pending1$")}))
+			_, err = tr.TryCommit()
+			require.NoError(t, err)
+			stats, err := tr.TryPersistMutations(store)
+			require.NoError(t, err)
+			require.True(t, stats.NodesWritten > 0)
+			for _, has := range trie.HasMany(trie.NewTrieReader(m, store, nil), [][]byte{[]byte("pending"), []byte("pending1")}) {
+				require.True(t, has)
+			}
+
+			tr1 := trie.NewWithOptions(m, store, nil, trie.Options{ReadOnly: true})
+			require.ErrorIs(t, tr1.TryUpdate([]byte("new"), []byte("new$")), trie.ErrReadOnly)
+			require.False(t, tr1.Clone().IsReadOnly())
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
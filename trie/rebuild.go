@@ -0,0 +1,86 @@
+package trie
+
+import "fmt"
+
+// RebuildOptions are optional parameters of RebuildFromValues
+type RebuildOptions struct {
+	// Options of the lost trie. The middleware is ignored: values in the value store are already transformed
+	Options
+	// ExpectedRoot, if not nil, is the root commitment the rebuilt trie must have, e.g. the last known root of the state
+	ExpectedRoot VCommitment
+	// BatchSize is the number of keys after which the trie is committed and persisted.
+	// Zero means defaultRebuildBatchSize
+	BatchSize int
+	// Progress, if not nil, is called after each batch with the number of rebuilt keys
+	Progress func(keys int)
+}
+
+// RebuildStats is the result of RebuildFromValues
+type RebuildStats struct {
+	// Root is the root commitment of the rebuilt trie
+	Root VCommitment
+	// Keys is the number of keys committed to the rebuilt trie
+	Keys int
+}
+
+const defaultRebuildBatchSize = 10000
+
+// RebuildFromValues is the disaster recovery of the trie partition: it reconstructs the trie purely from
+// the value store, such as the value partition of the hive_adaptor layout, into the trie store, which must contain
+// no trie. It is the inverse of ReconcileTerminals: instead of checking terminals against values, it commits every
+// value of the value store, which also becomes the value store of the rebuilt trie. Nodes are serialized the same
+// way as nodes of the trie with the value store, so the rebuilt partition is the one which was lost.
+// Keys committed with InsertKeyCommitment have no value in the value store and can't be recovered. Empty values are
+// skipped unless AllowEmptyValues is set. The value store must contain values of the trie only.
+// If ExpectedRoot is set and the rebuilt root is different, the error wrapping ErrRootMismatch is returned along with
+// statistics, and the rebuilt trie is left in the trie store for inspection
+func RebuildFromValues(valueStore KVStore, model CommitmentModel, dst KVStore, opt ...RebuildOptions) (*RebuildStats, error) {
+	var o RebuildOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	batchSize := o.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRebuildBatchSize
+	}
+	if _, ok := NewTrieReader(model, dst, valueStore).GetNode(nil); ok {
+		return nil, fmt.Errorf("trie::RebuildFromValues: the trie store is not empty")
+	}
+	o.Options.Middleware = nil
+	if o.Options.ExpectedSize == 0 {
+		o.Options.ExpectedSize = batchSize
+	}
+	tr := NewWithOptions(model, dst, valueStore, o.Options)
+	ret := &RebuildStats{}
+	persist := func() {
+		tr.Commit()
+		tr.PersistMutations(dst)
+		tr.ClearCache()
+		if o.Progress != nil {
+			o.Progress(ret.Keys)
+		}
+	}
+	valueStore.Iterate(func(k, v []byte) bool {
+		if len(v) == 0 && !o.AllowEmptyValues {
+			return true
+		}
+		tr.Update(k, v)
+		ret.Keys++
+		if ret.Keys%batchSize == 0 {
+			persist()
+		}
+		return true
+	})
+	persist()
+	ret.Root = RootCommitment(tr)
+	if o.ExpectedRoot == nil {
+		return ret, nil
+	}
+	if ret.Root == nil {
+		return ret, fmt.Errorf("trie::RebuildFromValues: expected root %s, rebuilt empty trie: %w", o.ExpectedRoot, ErrRootMismatch)
+	}
+	if !model.EqualCommitments(ret.Root, o.ExpectedRoot) {
+		return ret, fmt.Errorf("trie::RebuildFromValues: expected root %s, rebuilt %s: %w", o.ExpectedRoot, ret.Root, ErrRootMismatch)
+	}
+	return ret, nil
+}
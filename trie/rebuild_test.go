@@ -0,0 +1,72 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebuildFromValues(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("rebuild from values"+tn(m), func(t *testing.T) {
+			data := genData1()
+			nodeStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, nodeStore, valueStore)
+			for i, s := range data {
+				if i%7 == 0 {
+					tr.UpdateStr(s, s+"-value-which-is-longer-than-the-hash")
+					valueStore.Set([]byte(s), []byte(s+"-value-which-is-longer-than-the-hash"))
+				}
+			}
+			tr.Commit()
+			tr.PersistMutations(nodeStore)
+			root := trie.RootCommitment(tr)
+
+			dst := trie.NewInMemoryKVStore()
+			batches := 0
+			stats, err := trie.RebuildFromValues(valueStore, m, dst, trie.RebuildOptions{
+				ExpectedRoot: root,
+				BatchSize:    100,
+				Progress: func(int) {
+					batches++
+				},
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, trie.NumEntries(valueStore), stats.Keys)
+			require.EqualValues(t, stats.Keys/100+1, batches)
+			require.True(t, m.EqualCommitments(root, stats.Root))
+			require.EqualValues(t, trie.NumEntries(nodeStore), trie.NumEntries(dst))
+			nodeStore.Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, v, dst.Get(k))
+				return true
+			})
+			diff, err := trie.NewTrieReader(m, dst, valueStore).Reconcile()
+			require.NoError(t, err)
+			require.EqualValues(t, 0, len(diff))
+
+			// the trie store must be empty
+			_, err = trie.RebuildFromValues(valueStore, m, dst)
+			require.Error(t, err)
+
+			// the rebuilt root does not match the expected one if values are corrupted
+			valueStore.Set([]byte(data[0]), []byte("corrupted"))
+			stats, err = trie.RebuildFromValues(valueStore, m, trie.NewInMemoryKVStore(), trie.RebuildOptions{ExpectedRoot: root})
+			require.ErrorIs(t, err, trie.ErrRootMismatch)
+			require.False(t, m.EqualCommitments(root, stats.Root))
+
+			_, err = trie.RebuildFromValues(trie.NewInMemoryKVStore(), m, trie.NewInMemoryKVStore(), trie.RebuildOptions{ExpectedRoot: root})
+			require.ErrorIs(t, err, trie.ErrRootMismatch)
+			stats, err = trie.RebuildFromValues(trie.NewInMemoryKVStore(), m, trie.NewInMemoryKVStore())
+			require.NoError(t, err)
+			require.Nil(t, stats.Root)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,117 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Recommit recommits the whole trie under another commitment model of the same path arity, for example under
+// the blake2b model with another salt or personalization, when the identity of the state committed in the model
+// parameters has to change. The structure of the trie (node keys and path fragments) is kept, only terminal commitments
+// and node commitments are recomputed, bottom-up. Values are read from the value store and are not rewritten:
+// the value store remains the value store of the recommitted trie. Nodes are written to the trie store, each node
+// after all its children. The trie store may be the store of the source trie: each node is read before it is
+// overwritten, however the store is inconsistent if the recommit is interrupted, so a batch or another store is preferable.
+// Options are the options of the trie the nodes are serialized for. Returns root commitment of the recommitted trie
+func Recommit(tr NodeStore, valueStore KVReader, model CommitmentModel, trieStore KVWriter, opt ...Options) (VCommitment, error) {
+	if tr.PathArity() != model.PathArity() {
+		return nil, fmt.Errorf("trie::Recommit: path arity of the model %s is different from path arity of the trie %s",
+			model.PathArity(), tr.PathArity())
+	}
+	var o Options
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	n, ok := tr.GetNode(nil)
+	if !ok {
+		return nil, nil
+	}
+	r := &recommitter{
+		tr:         tr,
+		valueStore: valueStore,
+		model:      model,
+		trieStore:  trieStore,
+		opt:        o,
+	}
+	return r.recommitNode(n)
+}
+
+type recommitter struct {
+	tr         NodeStore
+	valueStore KVReader
+	model      CommitmentModel
+	trieStore  KVWriter
+	opt        Options
+}
+
+func (r *recommitter) recommitNode(n Node) (VCommitment, error) {
+	data := NewNodeData()
+	data.PathFragment = n.PathFragment()
+	for i, c := range n.ChildCommitments() {
+		if c == nil {
+			continue
+		}
+		child, ok := r.tr.GetNode(childKey(n, i))
+		if !ok {
+			return nil, fmt.Errorf("trie::Recommit: missing node '%s'", hex.EncodeToString(childKey(n, i)))
+		}
+		cc, err := r.recommitNode(child)
+		if err != nil {
+			return nil, err
+		}
+		data.ChildCommitments[i] = cc
+	}
+	if n.Terminal() != nil {
+		t, err := r.recommitTerminal(Concat(n.Key(), n.PathFragment()), n.Terminal())
+		if err != nil {
+			return nil, err
+		}
+		data.Terminal = t
+	}
+	bn := &bufferedNode{
+		n:           *data,
+		unpackedKey: n.Key(),
+	}
+	r.trieStore.Set(mustEncodeUnpackedBytes(n.Key(), r.model.PathArity()), bn.Bytes(codecOrDefault(r.opt.Codec), r.model, r.model.PathArity(), r.opt.OptimizeKeyCommitments))
+	return r.model.CalcNodeCommitment(data), nil
+}
+
+// recommitTerminal commits to the value of the key with the new model, same way as Trie.Update does
+func (r *recommitter) recommitTerminal(unpackedKey []byte, t TCommitment) (TCommitment, error) {
+	key, value, err := terminalValue(r.tr, r.valueStore, unpackedKey, t)
+	if err != nil {
+		return nil, fmt.Errorf("trie::Recommit: %w", err)
+	}
+	if r.opt.OptimizeKeyCommitments && bytes.Equal(key, value) {
+		return r.model.CommitToData(unpackedKey), nil
+	}
+	ret := r.model.CommitToData(value)
+	if ret == nil {
+		return nil, fmt.Errorf("trie::Recommit: value of the key '%s' is empty", hex.EncodeToString(key))
+	}
+	return ret, nil
+}
+
+// terminalValue returns the key (in original bytes) and the value committed with the terminal.
+// Terminals inserted with InsertKeyCommitment may have no value in the value store, then the value is the key itself
+func terminalValue(tr NodeStore, valueStore KVReader, unpackedKey []byte, t TCommitment) ([]byte, []byte, error) {
+	key, err := PackUnpackedBytes(unpackedKey, tr.PathArity())
+	if err != nil {
+		return nil, nil, err
+	}
+	var value []byte
+	if valueStore != nil {
+		value = valueStore.Get(key)
+	}
+	if value == nil && len(key) > 0 {
+		m := tr.Model()
+		if m.EqualCommitments(m.CommitToData(unpackedKey), t) || m.EqualCommitments(m.CommitToData(key), t) {
+			value = key
+		}
+	}
+	if value == nil {
+		return nil, nil, fmt.Errorf("value of the key '%s' is missing in the value store", hex.EncodeToString(key))
+	}
+	return key, value, nil
+}
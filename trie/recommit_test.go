@@ -0,0 +1,81 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecommit(t *testing.T) {
+	runTest := func(t *testing.T, m, mNew trie.CommitmentModel, optimizeKeyCommitments bool) {
+		t.Run("recommit"+tn(m)+tn(mNew), func(t *testing.T) {
+			opt := trie.Options{OptimizeKeyCommitments: optimizeKeyCommitments}
+			unique := make(map[string]struct{})
+			data := make([]string, 0)
+			for _, s := range genRnd4()[:1000] {
+				if _, ok := unique[s]; !ok {
+					unique[s] = struct{}{}
+					data = append(data, s)
+				}
+			}
+			store := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, valueStore, opt)
+			expectedStore := trie.NewInMemoryKVStore()
+			expected := trie.NewWithOptions(mNew, expectedStore, valueStore, opt)
+			for i, s := range data {
+				if optimizeKeyCommitments && i%3 == 0 && len(s) > 0 {
+					tr.InsertKeyCommitment([]byte(s))
+					expected.InsertKeyCommitment([]byte(s))
+					continue
+				}
+				tr.UpdateStr(s, s+"$")
+				expected.UpdateStr(s, s+"$")
+				valueStore.Set([]byte(s), []byte(s+"$"))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			expected.Commit()
+			expected.PersistMutations(expectedStore)
+			valuesBefore := trie.NumEntries(valueStore)
+
+			newStore := trie.NewInMemoryKVStore()
+			root, err := trie.Recommit(trie.NewTrieReader(m, store, valueStore), valueStore, mNew, newStore, opt)
+			require.NoError(t, err)
+			require.True(t, mNew.EqualCommitments(trie.RootCommitment(expected), root))
+			require.True(t, mNew.EqualCommitments(root, trie.RootCommitment(trie.NewTrieReader(mNew, newStore, valueStore))))
+			require.EqualValues(t, trie.NumEntries(expectedStore), trie.NumEntries(newStore))
+			expectedStore.Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, v, newStore.Get(k))
+				return true
+			})
+			require.EqualValues(t, valuesBefore, trie.NumEntries(valueStore))
+
+			// in place
+			root, err = trie.Recommit(trie.NewTrieReader(m, store, valueStore), valueStore, mNew, store, opt)
+			require.NoError(t, err)
+			require.True(t, mNew.EqualCommitments(trie.RootCommitment(expected), root))
+			require.True(t, mNew.EqualCommitments(root, trie.RootCommitment(trie.NewTrieReader(mNew, store, valueStore))))
+
+			if !optimizeKeyCommitments {
+				_, err = trie.Recommit(trie.NewTrieReader(mNew, store, valueStore), trie.NewInMemoryKVStore(), m, trie.NewInMemoryKVStore(), opt)
+				require.Error(t, err)
+			}
+		})
+	}
+	for _, arity := range trie.AllPathArity {
+		for _, optimize := range []bool{false, true} {
+			runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160),
+				trie_blake2b.NewWithSalt(arity, trie_blake2b.HashSize160, []byte("new chain")), optimize)
+			runTest(t, trie_blake2b.New(arity, trie_blake2b.HashSize160),
+				trie_blake2b.NewWithParams(arity, trie_blake2b.HashSize256, trie_blake2b.Params{Personalization: []byte("chain-2")}), optimize)
+		}
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160), trie_kzg_bn256.New(), false)
+	_, err := trie.Recommit(trie.NewTrieReader(trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160), trie.NewInMemoryKVStore(), nil),
+		nil, trie_kzg_bn256.New(), trie.NewInMemoryKVStore())
+	require.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// ReconcileTerminals is the counterpart of Trie.Reconcile for the immutable state: it visits every terminal committed
+// in the trie and checks it against the value of the key in the value store, for end-to-end integrity checks after sync.
+// Returns keys (in original bytes) the terminals of which do not match the value store, including keys without a value.
+// Terminals inserted with InsertKeyCommitment match without a value. Values are committed the same way
+// Trie.Update does, so options must be those of the trie which wrote the state: OptimizeKeyCommitments,
+// AllowEmptyValues and TerminalPolicy are taken into account. With AllowEmptyValues, the terminal of the empty value
+// matches an absent value too, because value stores may not distinguish between the two. The error is returned if a node of the trie is missing.
+// For the Trie, it is expected all mutations are committed. May be an expensive operation
+func ReconcileTerminals(tr NodeStore, valueStore KVReader, opt ...Options) ([][]byte, error) {
+	r := &terminalReconciler{
+		tr:         tr,
+		valueStore: valueStore,
+		ret:        make([][]byte, 0),
+	}
+	if len(opt) > 0 {
+		r.opt = opt[0]
+	}
+	n, ok := tr.GetNode(nil)
+	if !ok {
+		return r.ret, nil
+	}
+	if err := r.reconcileNode(n); err != nil {
+		return nil, fmt.Errorf("trie::ReconcileTerminals: %w", err)
+	}
+	return r.ret, nil
+}
+
+// Reconcile returns keys the terminals of which do not match the value store of the reader. See ReconcileTerminals
+func (tr *TrieReader) Reconcile(opt ...Options) ([][]byte, error) {
+	return ReconcileTerminals(tr, tr.reader.valueStore, opt...)
+}
+
+type terminalReconciler struct {
+	tr         NodeStore
+	valueStore KVReader
+	opt        Options
+	ret        [][]byte
+}
+
+func (r *terminalReconciler) reconcileNode(n Node) error {
+	if n.Terminal() != nil {
+		key, err := PackUnpackedBytes(Concat(n.Key(), n.PathFragment()), r.tr.PathArity())
+		if err != nil {
+			return err
+		}
+		if !r.matches(key, n.Terminal()) {
+			r.ret = append(r.ret, key)
+		}
+	}
+	children := n.ChildCommitments()
+	for i := 0; i < r.tr.PathArity().NumChildren(); i++ {
+		if _, ok := children[byte(i)]; !ok {
+			continue
+		}
+		child, ok := r.tr.GetNode(childKey(n, byte(i)))
+		if !ok {
+			return fmt.Errorf("missing node '%s'", hex.EncodeToString(childKey(n, byte(i))))
+		}
+		if err := r.reconcileNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches checks the terminal against the value of the key, same way as Trie.Update commits to the value
+func (r *terminalReconciler) matches(key []byte, t TCommitment) bool {
+	m := r.tr.Model()
+	var value []byte
+	if r.valueStore != nil {
+		value = r.valueStore.Get(key)
+	}
+	if value == nil {
+		// the value store may not keep empty values apart from absent ones
+		if r.opt.AllowEmptyValues && m.EqualCommitments(m.(EmptyValueCommitter).CommitToEmptyValue(), t) {
+			return true
+		}
+		// key commitment may have no value
+		unpackedKey := UnpackBytes(key, r.tr.PathArity())
+		return len(key) > 0 && (m.EqualCommitments(m.CommitToData(unpackedKey), t) || m.EqualCommitments(m.CommitToData(key), t))
+	}
+	c := commitToValueWithOptions(m, r.opt, key, value)
+	return c != nil && m.EqualCommitments(c, t)
+}
+
+// commitToValueWithOptions returns the terminal commitment to the non-nil value of the key, the same way as
+// Trie.Update of the trie with options opt commits to it. Returns nil if the empty value is not allowed
+func commitToValueWithOptions(m CommitmentModel, opt Options, key, value []byte) TCommitment {
+	switch {
+	case len(value) == 0:
+		if !opt.AllowEmptyValues {
+			return nil
+		}
+		return m.(EmptyValueCommitter).CommitToEmptyValue()
+	case opt.OptimizeKeyCommitments && bytes.Equal(key, value):
+		return m.CommitToData(UnpackBytes(value, m.PathArity()))
+	}
+	if threshold, ok := opt.TerminalPolicy.Threshold(key); ok {
+		return m.(ThresholdCommitter).CommitToDataWithThreshold(value, threshold)
+	}
+	return m.CommitToData(value)
+}
@@ -0,0 +1,88 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileTerminals(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("reconcile terminals"+tn(m), func(t *testing.T) {
+			data := genData2()[:300]
+			nodeStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, nodeStore, valueStore)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"-value-which-is-longer-than-the-hash")
+				valueStore.Set([]byte(s), []byte(s+"-value-which-is-longer-than-the-hash"))
+			}
+			// key commitments have no value
+			tr.InsertKeyCommitment([]byte("key-commitment"))
+			tr.Commit()
+			tr.PersistMutations(nodeStore)
+
+			rdr := trie.NewTrieReader(m, nodeStore, valueStore)
+			diff, err := rdr.Reconcile()
+			require.NoError(t, err)
+			require.EqualValues(t, 0, len(diff))
+
+			diff, err = trie.ReconcileTerminals(trie.NewTrieReader(m, trie.NewInMemoryKVStore(), nil), valueStore)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, len(diff))
+
+			// changed and missing values are reported, other values are not checked
+			changed := []byte(data[1])
+			missing := []byte(data[2])
+			valueStore.Set(changed, []byte("changed"))
+			valueStore.Set(missing, nil)
+			valueStore.Set([]byte("not-in-the-trie"), []byte("value"))
+			diff, err = trie.ReconcileTerminals(rdr, valueStore)
+			require.NoError(t, err)
+			require.EqualValues(t, 2, len(diff))
+			require.Contains(t, diff, changed)
+			require.Contains(t, diff, missing)
+
+			// the missing node is an error
+			nodeStore.Iterate(func(k, v []byte) bool {
+				if len(k) > 1 {
+					nodeStore.Set(k, nil)
+					return false
+				}
+				return true
+			})
+			_, err = trie.ReconcileTerminals(trie.NewTrieReader(m, nodeStore, valueStore), valueStore)
+			require.Error(t, err)
+		})
+		t.Run("reconcile with options"+tn(m), func(t *testing.T) {
+			nodeStore := trie.NewInMemoryKVStore()
+			valueStore := trie.NewInMemoryKVStore()
+			opt := trie.Options{OptimizeKeyCommitments: true, AllowEmptyValues: true}
+			tr := trie.NewWithOptions(m, nodeStore, valueStore, opt)
+			for _, s := range genData1() {
+				tr.UpdateStr(s, s)
+				valueStore.Set([]byte(s), []byte(s))
+			}
+			tr.UpdateStr("empty", "")
+			valueStore.Set([]byte("empty"), []byte{})
+			tr.Commit()
+			tr.PersistMutations(nodeStore)
+
+			diff, err := trie.ReconcileTerminals(tr, valueStore, opt)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, len(diff))
+
+			// empty value is not a value without AllowEmptyValues
+			diff, err = trie.ReconcileTerminals(tr, valueStore, trie.Options{OptimizeKeyCommitments: true})
+			require.NoError(t, err)
+			require.EqualValues(t, [][]byte{[]byte("empty")}, diff)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
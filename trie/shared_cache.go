@@ -0,0 +1,190 @@
+package trie
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// SharedNodeCache is the cache of nodes which is shared by many readers of the same or different stores,
+// for example TrieReaders created per request for different roots. It is safe for concurrent use.
+// Nodes are cached under the node key and the node commitment, i.e. the cache is content-addressed:
+// an entry is never stale, because the commitment binds the whole content of the node.
+// The cache is split into shards, each with its own lock and LRU eviction
+type SharedNodeCache struct {
+	// counters are accessed atomically. They are first in the struct for 64-bit alignment on 32-bit platforms
+	hits   uint64
+	misses uint64
+	// mismatches is number of nodes read from the store which did not match the expected commitment
+	mismatches uint64
+	evictions  uint64
+	seed       maphash.Seed
+	shards     []*sharedCacheShard
+}
+
+// SharedNodeCacheStats are metrics of the SharedNodeCache
+type SharedNodeCacheStats struct {
+	Hits       uint64
+	Misses     uint64
+	Mismatches uint64
+	Evictions  uint64
+	Size       int
+}
+
+// HitRate returns share of hits among all lookups, 0 if there were no lookups
+func (s SharedNodeCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+const sharedNodeCacheShards = 64
+
+type sharedCacheShard struct {
+	mutex    sync.Mutex
+	capacity int
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+type sharedCacheEntry struct {
+	key  string
+	node Node
+}
+
+// NewSharedNodeCache creates the cache with the capacity of approximately 'capacity' nodes
+func NewSharedNodeCache(capacity int) *SharedNodeCache {
+	Assert(capacity > 0, "trie::NewSharedNodeCache: capacity must be positive")
+	perShard := (capacity + sharedNodeCacheShards - 1) / sharedNodeCacheShards
+	ret := &SharedNodeCache{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*sharedCacheShard, sharedNodeCacheShards),
+	}
+	for i := range ret.shards {
+		ret.shards[i] = &sharedCacheShard{
+			capacity: perShard,
+			lru:      list.New(),
+			entries:  make(map[string]*list.Element),
+		}
+	}
+	return ret
+}
+
+// Stats returns metrics of the cache
+func (c *SharedNodeCache) Stats() SharedNodeCacheStats {
+	ret := SharedNodeCacheStats{
+		Hits:       atomic.LoadUint64(&c.hits),
+		Misses:     atomic.LoadUint64(&c.misses),
+		Mismatches: atomic.LoadUint64(&c.mismatches),
+		Evictions:  atomic.LoadUint64(&c.evictions),
+	}
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		ret.Size += len(s.entries)
+		s.mutex.Unlock()
+	}
+	return ret
+}
+
+func (c *SharedNodeCache) shard(key string) *sharedCacheShard {
+	var h maphash.Hash
+	h.SetSeed(c.seed)
+	_, _ = h.WriteString(key)
+	return c.shards[h.Sum64()%sharedNodeCacheShards]
+}
+
+func (c *SharedNodeCache) get(key string) (Node, bool) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*sharedCacheEntry).node, true
+}
+
+func (c *SharedNodeCache) put(key string, n Node) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&sharedCacheEntry{key: key, node: n})
+	for s.lru.Len() > s.capacity {
+		last := s.lru.Back()
+		s.lru.Remove(last)
+		delete(s.entries, last.Value.(*sharedCacheEntry).key)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// Wrap returns the NodeStore which reads nodes of the trie with the root commitment through the cache.
+// Commitments of nodes are known from their parents, starting from the root, so the cache is used for nodes
+// reached from the root, as with proofs and iteration. Other nodes are read from the underlying NodeStore directly.
+// Nodes read from the underlying NodeStore are checked against the expected commitment before caching.
+// Nil root means nothing is cached.
+// The wrapper is safe for concurrent use if the underlying NodeStore is (see NewConcurrentNodeStore)
+func (c *SharedNodeCache) Wrap(tr NodeStore, root VCommitment) NodeStore {
+	ret := &sharedCacheReader{
+		NodeStore: tr,
+		cache:     c,
+		prefix:    Concat(tr.Model().ShortName(), byte(0)),
+		expected:  make(map[string]VCommitment),
+	}
+	if root != nil {
+		ret.expected[""] = root
+	}
+	return ret
+}
+
+// sharedCacheReader tracks expected commitments of the children of returned nodes
+type sharedCacheReader struct {
+	NodeStore
+	cache    *SharedNodeCache
+	prefix   []byte
+	mutex    sync.Mutex
+	expected map[string]VCommitment
+}
+
+func (r *sharedCacheReader) GetNode(unpackedKey []byte) (Node, bool) {
+	r.mutex.Lock()
+	c, known := r.expected[string(unpackedKey)]
+	r.mutex.Unlock()
+	if !known {
+		return r.NodeStore.GetNode(unpackedKey)
+	}
+	key := string(Concat(r.prefix, Uint32To4Bytes(uint32(len(unpackedKey))), unpackedKey, c))
+	if n, ok := r.cache.get(key); ok {
+		atomic.AddUint64(&r.cache.hits, 1)
+		r.expectChildren(n)
+		return n, true
+	}
+	atomic.AddUint64(&r.cache.misses, 1)
+	n, ok := r.NodeStore.GetNode(unpackedKey)
+	if !ok {
+		return nil, false
+	}
+	if !r.Model().EqualCommitments(nodeCommitment(r.Model(), n), c) {
+		atomic.AddUint64(&r.cache.mismatches, 1)
+		return n, true
+	}
+	r.cache.put(key, n)
+	r.expectChildren(n)
+	return n, true
+}
+
+func (r *sharedCacheReader) expectChildren(n Node) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, c := range n.ChildCommitments() {
+		if c != nil {
+			r.expected[string(childKey(n, i))] = c
+		}
+	}
+}
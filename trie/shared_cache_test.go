@@ -0,0 +1,81 @@
+package trie_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedNodeCache(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("shared node cache"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			// two states which differ in one key, in different stores
+			stores := []trie.KVStore{trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()}
+			roots := make([]trie.VCommitment, 2)
+			for i, store := range stores {
+				tr := trie.New(m, store, nil)
+				for _, s := range data {
+					tr.UpdateStr(s, s+"$")
+				}
+				tr.UpdateStr("state", fmt.Sprintf("%d", i))
+				tr.Commit()
+				tr.PersistMutations(store)
+				roots[i] = trie.RootCommitment(tr)
+			}
+			cache := trie.NewSharedNodeCache(100000)
+			keys := func(tr trie.NodeStore) []string {
+				ret := make([]string, 0)
+				_, err := trie.IterateKeys(tr, nil, func(k []byte, _ trie.TCommitment) bool {
+					ret = append(ret, string(k))
+					return true
+				})
+				require.NoError(t, err)
+				return ret
+			}
+			expected := keys(trie.NewTrieReader(m, stores[0], nil))
+
+			require.EqualValues(t, expected, keys(cache.Wrap(trie.NewTrieReader(m, stores[0], nil), roots[0])))
+			stats := cache.Stats()
+			require.EqualValues(t, 0, stats.Hits)
+			require.True(t, stats.Misses > 0)
+			require.EqualValues(t, stats.Misses, stats.Size)
+
+			// nodes of the other state are shared, except those on the path to the different key
+			require.EqualValues(t, expected, keys(cache.Wrap(trie.NewTrieReader(m, stores[1], nil), roots[1])))
+			stats1 := cache.Stats()
+			require.True(t, stats1.Hits > 0)
+			require.True(t, stats1.Misses-stats.Misses < stats.Misses/10)
+			require.True(t, stats1.HitRate() > 0.4)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					require.EqualValues(t, expected, keys(cache.Wrap(trie.NewTrieReader(m, stores[i%2], nil), roots[i%2])))
+				}(i)
+			}
+			wg.Wait()
+			require.EqualValues(t, stats1.Misses, cache.Stats().Misses)
+
+			// node which does not match the expected root is not cached
+			fresh := trie.NewSharedNodeCache(100000)
+			require.EqualValues(t, expected, keys(fresh.Wrap(trie.NewTrieReader(m, stores[0], nil), roots[1])))
+			require.EqualValues(t, 1, fresh.Stats().Mismatches)
+			require.EqualValues(t, 0, fresh.Stats().Size)
+
+			small := trie.NewSharedNodeCache(10)
+			require.EqualValues(t, expected, keys(small.Wrap(trie.NewTrieReader(m, stores[0], nil), roots[0])))
+			require.True(t, small.Stats().Evictions > 0)
+			require.True(t, small.Stats().Size <= 64)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
@@ -0,0 +1,109 @@
+package trie
+
+import "fmt"
+
+// SharedNodesOptions are optional parameters of SharedNodes
+type SharedNodesOptions struct {
+	// StoreB is the node store of the root B. Nil means the root B is in the same store as the root A
+	StoreB KVReader
+	// Codec is the serialization of nodes. Nil means BinaryCodec
+	Codec Codec
+	// ValueStore is the value store of tries. Required if terminal commitments are not stored with nodes
+	ValueStore KVReader
+}
+
+// SharedNodesStats is the result of SharedNodes. Sizes are sums of lengths of keys and values of node records
+type SharedNodesStats struct {
+	// SharedNodes are nodes of both roots, i.e. nodes with the same key and the same commitment
+	SharedNodes int
+	SharedBytes int
+	// OnlyANodes and OnlyBNodes are nodes of one root only
+	OnlyANodes int
+	OnlyABytes int
+	OnlyBNodes int
+	OnlyBBytes int
+	// MissingNodes is the number of nodes of the roots which are absent in the store or do not match commitments,
+	// for example because nodes of the root A have been overwritten by the root B in the same store
+	MissingNodes int
+}
+
+func (s *SharedNodesStats) String() string {
+	return fmt.Sprintf("shared nodes: %d (%d bytes), only in A: %d (%d bytes), only in B: %d (%d bytes), missing nodes: %d",
+		s.SharedNodes, s.SharedBytes, s.OnlyANodes, s.OnlyABytes, s.OnlyBNodes, s.OnlyBBytes, s.MissingNodes)
+}
+
+// SharedNodes reports how many nodes and bytes the tries of two roots share versus differ, for example roots of two
+// consecutive blocks. It quantifies the storage amplification of the block: nodes of the root B which are not shared
+// with the root A had to be written by the block. Nodes are read and verified against commitments of the roots,
+// as in GarbageReport. Nodes of the trie are keyed by their paths, so the node is shared if both roots have
+// the node with the same commitment under the same key. The store is read-only
+func SharedNodes(store KVReader, model CommitmentModel, rootA, rootB VCommitment, opt ...SharedNodesOptions) *SharedNodesStats {
+	var o SharedNodesOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	storeB := o.StoreB
+	if storeB == nil {
+		storeB = store
+	}
+	s := &sharedNodesCounter{
+		codec:      codecOrDefault(o.Codec),
+		model:      model,
+		valueStore: o.ValueStore,
+		nodesA:     make(map[string]sharedNode),
+	}
+	if rootA != nil {
+		s.visit(store, nil, rootA, func(key []byte, c VCommitment, size int) {
+			s.nodesA[string(key)] = sharedNode{commitment: c, size: size}
+		})
+	}
+	if rootB != nil {
+		s.visit(storeB, nil, rootB, func(key []byte, c VCommitment, size int) {
+			if n, ok := s.nodesA[string(key)]; ok && model.EqualCommitments(n.commitment, c) {
+				n.shared = true
+				s.nodesA[string(key)] = n
+				s.stats.SharedNodes++
+				s.stats.SharedBytes += size
+				return
+			}
+			s.stats.OnlyBNodes++
+			s.stats.OnlyBBytes += size
+		})
+	}
+	for _, n := range s.nodesA {
+		if !n.shared {
+			s.stats.OnlyANodes++
+			s.stats.OnlyABytes += n.size
+		}
+	}
+	return &s.stats
+}
+
+type sharedNode struct {
+	commitment VCommitment
+	size       int
+	shared     bool
+}
+
+type sharedNodesCounter struct {
+	codec      Codec
+	model      CommitmentModel
+	valueStore KVReader
+	// nodesA are nodes of the root A by encoded keys
+	nodesA map[string]sharedNode
+	stats  SharedNodesStats
+}
+
+// visit calls back with each node of the subtree, verified against the commitment, with its encoded key and size
+func (s *sharedNodesCounter) visit(store KVReader, unpackedKey []byte, expected VCommitment, fun func(encodedKey []byte, c VCommitment, size int)) {
+	n, err := readVerifiedNode(s.codec, store, s.model, s.valueStore, unpackedKey, expected)
+	if err != nil {
+		s.stats.MissingNodes++
+		return
+	}
+	encodedKey := mustEncodeUnpackedBytes(unpackedKey, s.model.PathArity())
+	fun(encodedKey, expected, len(encodedKey)+len(store.Get(encodedKey)))
+	for i, c := range n.ChildCommitments() {
+		s.visit(store, childKey(n, i), c, fun)
+	}
+}
@@ -0,0 +1,67 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedNodes(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("shared nodes"+tn(m), func(t *testing.T) {
+			storeA := trie.NewInMemoryKVStore()
+			tr := trie.New(m, storeA, nil)
+			data := genData1()[:100]
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutations(storeA)
+			rootA := trie.RootCommitment(tr)
+			nodesA, bytesA := 0, 0
+			storeA.Iterate(func(k, v []byte) bool {
+				nodesA++
+				bytesA += len(k) + len(v)
+				return true
+			})
+
+			stats := trie.SharedNodes(storeA, m, rootA, rootA)
+			require.EqualValues(t, nodesA, stats.SharedNodes)
+			require.EqualValues(t, bytesA, stats.SharedBytes)
+			require.EqualValues(t, 0, stats.OnlyANodes+stats.OnlyBNodes+stats.MissingNodes)
+
+			// the block updates values of some keys
+			storeB := trie.NewInMemoryKVStore()
+			storeA.Iterate(func(k, v []byte) bool {
+				storeB.Set(k, v)
+				return true
+			})
+			for _, s := range data[:5] {
+				tr.UpdateStr(s, s+"$$")
+			}
+			tr.Commit()
+			persisted := tr.PersistMutationsWithStats(storeB)
+			rootB := trie.RootCommitment(tr)
+
+			stats = trie.SharedNodes(storeA, m, rootA, rootB, trie.SharedNodesOptions{StoreB: storeB})
+			t.Logf("%s", stats)
+			require.EqualValues(t, 0, stats.MissingNodes)
+			require.EqualValues(t, persisted.NodesWritten, stats.OnlyBNodes)
+			require.EqualValues(t, persisted.NodesWritten, stats.OnlyANodes)
+			require.EqualValues(t, nodesA, stats.SharedNodes+stats.OnlyBNodes)
+			require.EqualValues(t, bytesA, stats.SharedBytes+stats.OnlyABytes)
+
+			// in the same store nodes of the root A are overwritten, starting from the root
+			stats = trie.SharedNodes(storeB, m, rootA, rootB)
+			require.EqualValues(t, 1, stats.MissingNodes)
+			require.EqualValues(t, nodesA, stats.OnlyBNodes)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
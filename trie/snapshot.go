@@ -0,0 +1,241 @@
+package trie
+
+import "sync/atomic"
+
+// readSnapshot is an immutable view of the trie as of a commit, published atomically by Commit (see ReadSnapshot).
+// It consists of:
+// - nodes committed since the last persist or clear of the cache, nil value means the node is deleted.
+// The map is copied on write: the next commit shares nodes of the previous snapshot and replaces only changed ones
+// - the undo chain of the later snapshots. Each commit attaches to the previous snapshot the layer with the state of
+// the nodes it changes as seen by the previous snapshot. When these nodes are persisted later, readers of
+// the previous snapshot take them from the layer instead of the store
+// - the persisted trie for all other nodes
+type readSnapshot struct {
+	reader nodeStore
+	nodes  map[string]*nodeReadOnly
+	// next is *snapshotUndo, attached once by the next commit
+	next atomic.Value
+}
+
+// snapshotUndo is the state of nodes before the commit of the snapshot, nil value means the node did not exist
+type snapshotUndo struct {
+	nodes    map[string]*nodeReadOnly
+	snapshot *readSnapshot
+}
+
+// readSnapshot implements NodeStore
+var _ NodeStore = &readSnapshot{}
+
+func newReadSnapshot(reader nodeStore, nodes map[string]*nodeReadOnly) *readSnapshot {
+	return &readSnapshot{
+		reader: reader,
+		nodes:  nodes,
+	}
+}
+
+func (s *readSnapshot) getNode(unpackedKey []byte) (*nodeReadOnly, bool) {
+	if n, ok := s.nodes[string(unpackedKey)]; ok {
+		return n, n != nil
+	}
+	for next := s.undo(); next != nil; next = next.snapshot.undo() {
+		if n, ok := next.nodes[string(unpackedKey)]; ok {
+			return n, n != nil
+		}
+	}
+	return s.reader.getNode(unpackedKey)
+}
+
+func (s *readSnapshot) undo() *snapshotUndo {
+	ret, _ := s.next.Load().(*snapshotUndo)
+	return ret
+}
+
+func (s *readSnapshot) GetNode(unpackedKey []byte) (Node, bool) {
+	n, ok := s.getNode(unpackedKey)
+	if !ok {
+		return nil, false
+	}
+	return n, true
+}
+
+func (s *readSnapshot) Model() CommitmentModel {
+	return s.reader.m
+}
+
+func (s *readSnapshot) PathArity() PathArity {
+	return s.reader.arity
+}
+
+// Info returns the human-readable configuration of the snapshot
+func (s *readSnapshot) Info() string {
+	return s.Stats().String()
+}
+
+// Stats returns the machine-readable configuration of the snapshot
+func (s *readSnapshot) Stats() *TrieInfo {
+	return newTrieInfo("ReadSnapshot", &s.reader)
+}
+
+// snapshotState tracks changes of the buffered node store needed to publish snapshots. Nil means snapshots are disabled
+type snapshotState struct {
+	// current is the *readSnapshot published by the last commit
+	current atomic.Value
+	// touched are keys of nodes committed or deleted since the current snapshot was published
+	touched map[string]struct{}
+	// reset means the next snapshot does not inherit nodes of the current one, because they have been persisted
+	// or discarded
+	reset bool
+	// loaded are immutable copies of nodes as they are in the store, nil value means the node is absent.
+	// They are the state of nodes in snapshots which read the nodes from the store
+	loaded map[string]*nodeReadOnly
+}
+
+func newSnapshotState(reader nodeStore) *snapshotState {
+	ret := &snapshotState{
+		touched: make(map[string]struct{}),
+		loaded:  make(map[string]*nodeReadOnly),
+	}
+	ret.current.Store(newReadSnapshot(reader, make(map[string]*nodeReadOnly)))
+	return ret
+}
+
+// fork starts snapshots of the copy of the buffered store from the current snapshot
+func (s *snapshotState) fork() *snapshotState {
+	if s == nil {
+		return nil
+	}
+	cur := s.snapshot()
+	ret := &snapshotState{
+		touched: make(map[string]struct{}, len(s.touched)),
+		reset:   s.reset,
+		loaded:  make(map[string]*nodeReadOnly, len(s.loaded)),
+	}
+	ret.current.Store(newReadSnapshot(cur.reader, cur.nodes))
+	for k := range s.touched {
+		ret.touched[k] = struct{}{}
+	}
+	for k, n := range s.loaded {
+		ret.loaded[k] = n
+	}
+	return ret
+}
+
+func (s *snapshotState) snapshot() *readSnapshot {
+	return s.current.Load().(*readSnapshot)
+}
+
+func (s *snapshotState) touch(unpackedKey []byte) {
+	if s == nil {
+		return
+	}
+	s.touched[string(unpackedKey)] = struct{}{}
+}
+
+// persisted records the state of the node written to the store
+func (s *snapshotState) persisted(n *bufferedNode) {
+	if s == nil {
+		return
+	}
+	k := string(n.unpackedKey)
+	if c, ok := s.snapshot().nodes[k]; ok && c != nil {
+		s.loaded[k] = c
+		return
+	}
+	s.loaded[k] = &nodeReadOnly{n: *n.n.Clone(), key: n.unpackedKey}
+}
+
+// deleted records the node deleted from the store
+func (s *snapshotState) deleted(unpackedKey string) {
+	if s == nil {
+		return
+	}
+	s.loaded[unpackedKey] = nil
+}
+
+// persistedAll means nodes of the current snapshot are in the store
+func (s *snapshotState) persistedAll() {
+	if s == nil {
+		return
+	}
+	s.reset = true
+}
+
+func (s *snapshotState) clear() {
+	if s == nil {
+		return
+	}
+	s.touched = make(map[string]struct{})
+	s.loaded = make(map[string]*nodeReadOnly)
+	s.reset = true
+}
+
+// publish publishes the snapshot of the committed state of the trie. Nodes changed since the previous
+// snapshot are copied, the state of them in the previous snapshot is attached to it as the undo layer.
+// It must be called after the commit, before mutations are persisted
+func (s *snapshotState) publish(nodeCache map[string]*bufferedNode) {
+	if s == nil {
+		return
+	}
+	prev := s.snapshot()
+	nodes := make(map[string]*nodeReadOnly)
+	if !s.reset {
+		for k, n := range prev.nodes {
+			nodes[k] = n
+		}
+	}
+	undo := &snapshotUndo{nodes: make(map[string]*nodeReadOnly, len(s.touched))}
+	for k := range s.touched {
+		undo.nodes[k] = s.stateInSnapshot(prev, k)
+		nodes[k] = nil
+		if n, ok := nodeCache[k]; ok {
+			nodes[k] = &nodeReadOnly{
+				n:   *n.n.Clone(),
+				key: n.unpackedKey,
+			}
+		}
+	}
+	undo.snapshot = newReadSnapshot(prev.reader, nodes)
+	prev.next.Store(undo)
+	s.current.Store(undo.snapshot)
+	s.touched = make(map[string]struct{})
+	s.reset = false
+}
+
+// stateInSnapshot returns the node as it is seen by the snapshot, before undo is attached to it
+func (s *snapshotState) stateInSnapshot(snapshot *readSnapshot, key string) *nodeReadOnly {
+	if n, ok := snapshot.nodes[key]; ok {
+		return n
+	}
+	// the node in the store has not changed since the snapshot
+	if n, ok := s.loaded[key]; ok {
+		return n
+	}
+	ret, _ := snapshot.reader.getNode([]byte(key))
+	return ret
+}
+
+// ReadSnapshot returns the consistent read-only view of the trie as of the last Commit (or of the persisted trie, if
+// there was no commit). The trie must be created with Options.ReadSnapshots. The view does not take locks: it can be
+// used concurrently with updates, commits and persisting of the trie, and by many goroutines, as long as the trie store
+// is safe for concurrent use. Snapshots are published atomically by Commit in the copy-on-write manner, so older
+// snapshots remain consistent after the following commits and persists. Persisting must follow the commit
+func (tr *Trie) ReadSnapshot() NodeStore {
+	Assert(tr.nodeStore.snapshots != nil, "trie::ReadSnapshot: read snapshots are not enabled")
+	return tr.nodeStore.snapshots.snapshot()
+}
+
+// GetCommitted returns the terminal commitment of the key (in original bytes) as of the last Commit, ignoring buffered
+// updates which are not committed yet. Read paths which serve the state of the current block use it, so they do not
+// observe updates of the next block in progress. Returns false if the key is absent in the committed state.
+// The key is transformed by the middleware of the trie, if any. The trie must be created with Options.ReadSnapshots.
+// As ReadSnapshot, it can be called concurrently with updates and commits of the trie
+func (tr *Trie) GetCommitted(key []byte) (TCommitment, bool) {
+	Assert(tr.nodeStore.snapshots != nil, "trie::GetCommitted: read snapshots are not enabled")
+	snapshot := tr.nodeStore.snapshots.snapshot()
+	_, nodes, _, ending := proofPathWithNodes(snapshot, UnpackBytes(tr.middleware.TransformKey(key), snapshot.PathArity()))
+	if len(nodes) == 0 || ending != EndingTerminal {
+		return nil, false
+	}
+	terminal := nodes[len(nodes)-1].Terminal()
+	return terminal, terminal != nil
+}
@@ -0,0 +1,177 @@
+package trie_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSnapshot(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("read snapshot"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:600]
+			store := &lockedKVStore{KVStore: trie.NewInMemoryKVStore()}
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{ReadSnapshots: true})
+			require.Nil(t, trie.RootCommitment(tr.ReadSnapshot()))
+
+			keys := make(map[string]bool)
+			snapshots := make([]trie.NodeStore, 0)
+			roots := make([]trie.VCommitment, 0)
+			expected := make([]map[string]bool, 0)
+			for round := 0; round < 6; round++ {
+				for i, s := range data[round*100 : round*100+100] {
+					if i%4 == 0 && round > 0 {
+						tr.DeleteStr(data[(round-1)*100+i])
+						delete(keys, data[(round-1)*100+i])
+					}
+					tr.UpdateStr(s, s+"+"+strconv.Itoa(round))
+					keys[s] = true
+				}
+				// uncommitted updates are not visible in the snapshot
+				if round > 0 {
+					require.True(t, m.EqualCommitments(roots[round-1], trie.RootCommitment(tr.ReadSnapshot())))
+				}
+				tr.Commit()
+				snapshots = append(snapshots, tr.ReadSnapshot())
+				roots = append(roots, trie.RootCommitment(tr))
+				exp := make(map[string]bool)
+				for k := range keys {
+					exp[k] = true
+				}
+				expected = append(expected, exp)
+				if round%2 == 1 {
+					tr.PersistMutations(store)
+				}
+				if round == 3 {
+					tr.ClearCache()
+				}
+			}
+			tr.PersistMutations(store)
+			tr.ClearCache()
+			for i, snap := range snapshots {
+				require.True(t, m.EqualCommitments(roots[i], trie.RootCommitment(snap)))
+				require.EqualValues(t, expected[i], snapshotKeys(t, snap))
+			}
+			require.True(t, m.EqualCommitments(roots[len(roots)-1], trie.RootCommitment(trie.NewTrieReader(m, store, nil))))
+			require.True(t, m.EqualCommitments(roots[len(roots)-1], trie.RootCommitment(tr.Fork().ReadSnapshot())))
+			require.True(t, tr.Stats().ReadSnapshots)
+			require.Contains(t, tr.ReadSnapshot().Info(), "ReadSnapshot(")
+			require.Panics(t, func() {
+				trie.New(m, store, nil).ReadSnapshot()
+			})
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestReadSnapshotConcurrent(t *testing.T) {
+	m := trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160)
+	data := genRnd4()[:1000]
+	store := &lockedKVStore{KVStore: trie.NewInMemoryKVStore()}
+	tr := trie.NewWithOptions(m, store, nil, trie.Options{ReadSnapshots: true})
+
+	published := make(map[string]bool)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	seen := make([][]trie.VCommitment, 4)
+	for r := range seen {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := tr.ReadSnapshot()
+				root := trie.RootCommitment(snap)
+				if root != nil {
+					seen[r] = append(seen[r], root)
+				}
+			}
+		}(r)
+	}
+	for i := 0; i < len(data); i += 50 {
+		for _, s := range data[i : i+50] {
+			tr.UpdateStr(s, s+"*")
+		}
+		tr.Commit()
+		mutex.Lock()
+		published[trie.RootCommitment(tr).String()] = true
+		mutex.Unlock()
+		tr.PersistMutations(store)
+		if i%200 == 0 {
+			tr.ClearCache()
+		}
+	}
+	close(stop)
+	wg.Wait()
+	for _, roots := range seen {
+		for _, root := range roots {
+			require.True(t, published[root.String()])
+		}
+	}
+}
+
+func TestGetCommitted(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("get committed"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:400]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{ReadSnapshots: true})
+			committed := make(map[string]string)
+			checkCommitted := func() {
+				for _, s := range data {
+					terminal, ok := tr.GetCommitted([]byte(s))
+					v, exists := committed[s]
+					require.EqualValues(t, exists, ok)
+					if exists {
+						require.True(t, m.EqualCommitments(m.CommitToData([]byte(v)), terminal))
+					}
+				}
+			}
+			checkCommitted()
+			for round := 0; round < 4; round++ {
+				for i, s := range data[:100+round*100] {
+					if i%3 == round%3 {
+						tr.DeleteStr(s)
+					} else {
+						tr.UpdateStr(s, s+"+"+strconv.Itoa(round))
+					}
+				}
+				// updates of the round are not visible until commit
+				checkCommitted()
+				tr.Commit()
+				for i, s := range data[:100+round*100] {
+					if i%3 == round%3 {
+						delete(committed, s)
+					} else {
+						committed[s] = s + "+" + strconv.Itoa(round)
+					}
+				}
+				checkCommitted()
+				if round%2 == 1 {
+					tr.PersistMutations(store)
+					tr.ClearCache()
+				}
+			}
+			require.Panics(t, func() {
+				trie.New(m, store, nil).GetCommitted([]byte("a"))
+			})
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
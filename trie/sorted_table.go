@@ -0,0 +1,258 @@
+package trie
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Sorted table is a compact immutable on-disk format of the key/value store, intended for the node store
+// of proof-serving replicas. The file is memory mapped, lookups are binary searches over the index and
+// returned values are slices of the mapped memory, so reading from the table does not allocate and
+// resident memory is limited to the pages which are actually touched.
+//
+// File layout (all integers little-endian):
+//   header:  magic (8 bytes), version (1 byte)
+//   records: key and value bytes of each record, in the order of keys
+//   index:   per record: offset of the record (uint64), key length (uint32), value length (uint32)
+//   footer:  offset of the index (uint64), number of records (uint64), magic (8 bytes)
+
+const (
+	sortedTableMagic       = "trie.sst"
+	sortedTableVersion     = 0x01
+	sortedTableHeaderSize  = len(sortedTableMagic) + 1
+	sortedTableFooterSize  = 8 + 8 + len(sortedTableMagic)
+	sortedTableIndexRecord = 16
+)
+
+// SortedTable is a read-only key/value store backed by the sorted table file or bytes.
+// It implements KVReader, KVIterator and KVPrefixIterator. Iteration is in the order of keys.
+// Returned values must not be modified and must not be used after Close
+type SortedTable struct {
+	data  []byte
+	index []byte
+	n     int
+	unmap func([]byte) error
+}
+
+var (
+	_ KVReader         = &SortedTable{}
+	_ KVIterator       = &SortedTable{}
+	_ KVPrefixIterator = &SortedTable{}
+)
+
+// WriteSortedTable writes all key/value pairs of the store to the writer in the sorted table format.
+// Only keys are kept in memory while sorting. Returns number of records written
+func WriteSortedTable(w io.Writer, store KVStore) (int, error) {
+	keys := make([][]byte, 0)
+	store.Iterate(func(k, _ []byte) bool {
+		keys = append(keys, Concat(k))
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(sortedTableMagic); err != nil {
+		return 0, err
+	}
+	if err := bw.WriteByte(sortedTableVersion); err != nil {
+		return 0, err
+	}
+	index := make([]byte, len(keys)*sortedTableIndexRecord)
+	offset := uint64(sortedTableHeaderSize)
+	for i, k := range keys {
+		v := store.Get(k)
+		rec := index[i*sortedTableIndexRecord:]
+		binary.LittleEndian.PutUint64(rec[0:8], offset)
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(len(k)))
+		binary.LittleEndian.PutUint32(rec[12:16], uint32(len(v)))
+		if _, err := bw.Write(k); err != nil {
+			return 0, err
+		}
+		if _, err := bw.Write(v); err != nil {
+			return 0, err
+		}
+		offset += uint64(len(k) + len(v))
+	}
+	if _, err := bw.Write(index); err != nil {
+		return 0, err
+	}
+	var footer [16]byte
+	binary.LittleEndian.PutUint64(footer[0:8], offset)
+	binary.LittleEndian.PutUint64(footer[8:16], uint64(len(keys)))
+	if _, err := bw.Write(footer[:]); err != nil {
+		return 0, err
+	}
+	if _, err := bw.WriteString(sortedTableMagic); err != nil {
+		return 0, err
+	}
+	return len(keys), bw.Flush()
+}
+
+// WriteSortedTableFile writes the store to the file in the sorted table format
+func WriteSortedTableFile(fname string, store KVStore) (int, error) {
+	f, err := os.Create(fname)
+	if err != nil {
+		return 0, err
+	}
+	n, err := WriteSortedTable(f, store)
+	if err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+	return n, f.Close()
+}
+
+// OpenSortedTable maps the sorted table file into memory. On platforms without mmap support the file is read into memory.
+// The table must be closed with Close
+func OpenSortedTable(fname string) (*SortedTable, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < int64(sortedTableHeaderSize+sortedTableFooterSize) {
+		return nil, errors.New("trie::OpenSortedTable: file too short")
+	}
+	data, unmap, err := mmapFile(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	ret, err := NewSortedTable(data)
+	if err != nil {
+		if unmap != nil {
+			_ = unmap(data)
+		}
+		return nil, err
+	}
+	ret.unmap = unmap
+	return ret, nil
+}
+
+// NewSortedTable creates the table over bytes in the sorted table format
+func NewSortedTable(data []byte) (*SortedTable, error) {
+	if len(data) < sortedTableHeaderSize+sortedTableFooterSize {
+		return nil, errors.New("trie::NewSortedTable: data too short")
+	}
+	if string(data[:len(sortedTableMagic)]) != sortedTableMagic || string(data[len(data)-len(sortedTableMagic):]) != sortedTableMagic {
+		return nil, errors.New("trie::NewSortedTable: not a sorted table")
+	}
+	if v := data[len(sortedTableMagic)]; v != sortedTableVersion {
+		return nil, fmt.Errorf("trie::NewSortedTable: unsupported version %d", v)
+	}
+	footer := data[len(data)-sortedTableFooterSize:]
+	indexOffset := binary.LittleEndian.Uint64(footer[0:8])
+	n := binary.LittleEndian.Uint64(footer[8:16])
+	indexEnd := uint64(len(data) - sortedTableFooterSize)
+	if indexOffset < uint64(sortedTableHeaderSize) || indexOffset > indexEnd || (indexEnd-indexOffset)/sortedTableIndexRecord != n ||
+		(indexEnd-indexOffset)%sortedTableIndexRecord != 0 {
+		return nil, errors.New("trie::NewSortedTable: wrong index")
+	}
+	ret := &SortedTable{
+		data:  data,
+		index: data[indexOffset:indexEnd],
+		n:     int(n),
+	}
+	for i := 0; i < ret.n; i++ {
+		off, kl, vl := ret.record(i)
+		// checked with subtraction, the sum may overflow
+		if off < uint64(sortedTableHeaderSize) || off > indexOffset || uint64(kl) > indexOffset-off || uint64(vl) > indexOffset-off-uint64(kl) {
+			return nil, fmt.Errorf("trie::NewSortedTable: record #%d out of bounds", i)
+		}
+	}
+	return ret, nil
+}
+
+// Close releases the mapped memory
+func (st *SortedTable) Close() error {
+	if st.unmap == nil {
+		return nil
+	}
+	err := st.unmap(st.data)
+	st.unmap = nil
+	st.data, st.index, st.n = nil, nil, 0
+	return err
+}
+
+// Len returns number of records in the table
+func (st *SortedTable) Len() int {
+	return st.n
+}
+
+func (st *SortedTable) record(i int) (uint64, uint32, uint32) {
+	rec := st.index[i*sortedTableIndexRecord : (i+1)*sortedTableIndexRecord]
+	return binary.LittleEndian.Uint64(rec[0:8]), binary.LittleEndian.Uint32(rec[8:12]), binary.LittleEndian.Uint32(rec[12:16])
+}
+
+func (st *SortedTable) key(i int) []byte {
+	off, kl, _ := st.record(i)
+	return st.data[off : off+uint64(kl)]
+}
+
+func (st *SortedTable) value(i int) []byte {
+	off, kl, vl := st.record(i)
+	return st.data[off+uint64(kl) : off+uint64(kl)+uint64(vl)]
+}
+
+// search returns index of the first key which is not less than the key
+func (st *SortedTable) search(key []byte) int {
+	lo, hi := 0, st.n
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if bytes.Compare(st.key(mid), key) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+func (st *SortedTable) Get(key []byte) []byte {
+	i := st.search(key)
+	if i == st.n || !bytes.Equal(st.key(i), key) {
+		return nil
+	}
+	return st.value(i)
+}
+
+func (st *SortedTable) Has(key []byte) bool {
+	i := st.search(key)
+	return i < st.n && bytes.Equal(st.key(i), key)
+}
+
+func (st *SortedTable) Iterate(fun func(k, v []byte) bool) {
+	for i := 0; i < st.n; i++ {
+		if !fun(st.key(i), st.value(i)) {
+			return
+		}
+	}
+}
+
+func (st *SortedTable) IteratePrefix(prefix []byte, fun func(k, v []byte) bool) {
+	for i := st.search(prefix); i < st.n; i++ {
+		k := st.key(i)
+		if !bytes.HasPrefix(k, prefix) || !fun(k, st.value(i)) {
+			return
+		}
+	}
+}
+
+func (st *SortedTable) IterateKeysPrefix(prefix []byte, fun func(k []byte) bool) {
+	for i := st.search(prefix); i < st.n; i++ {
+		k := st.key(i)
+		if !bytes.HasPrefix(k, prefix) || !fun(k) {
+			return
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package trie
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are cumulative counters of commits and persisted mutations, maintained by tries created with Options.Stats.
+// One Stats may be shared by many tries. Counters are read concurrently with updates. Stats implement expvar.Var,
+// so they are exported to the debug endpoint with:
+//
+//	expvar.Publish("trie", stats)
+type Stats struct {
+	// counters are accessed atomically. They are first in the struct for 64-bit alignment on 32-bit platforms
+	commits       int64
+	commitNanos   int64
+	persists      int64
+	nodesWritten  int64
+	nodesDeleted  int64
+	bytesWritten  int64
+	digestUpdates int64
+}
+
+// StatsSnapshot are values of the counters of Stats at one moment
+type StatsSnapshot struct {
+	Commits int64 `json:"commits"`
+	// CommitDuration is the total duration of commits
+	CommitDuration time.Duration `json:"commitDuration"`
+	// AvgCommitDuration is CommitDuration divided by Commits
+	AvgCommitDuration time.Duration `json:"avgCommitDuration"`
+	// Persists is the number of persists of mutations, including those collected with MutationSet
+	Persists           int64 `json:"persists"`
+	NodesWritten       int64 `json:"nodesWritten"`
+	NodesDeleted       int64 `json:"nodesDeleted"`
+	BytesWritten       int64 `json:"bytesWritten"`
+	DigestIndexUpdates int64 `json:"digestIndexUpdates"`
+}
+
+// NewStats creates zero counters
+func NewStats() *Stats {
+	return &Stats{}
+}
+
+func (s *Stats) commit(d time.Duration) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.commits, 1)
+	atomic.AddInt64(&s.commitNanos, int64(d))
+}
+
+func (s *Stats) persisted(p PersistStats) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.persists, 1)
+	atomic.AddInt64(&s.nodesWritten, int64(p.NodesWritten))
+	atomic.AddInt64(&s.nodesDeleted, int64(p.NodesDeleted))
+	atomic.AddInt64(&s.bytesWritten, int64(p.BytesWritten))
+	atomic.AddInt64(&s.digestUpdates, int64(p.DigestIndexUpdates))
+}
+
+// Snapshot returns current values of the counters. Counters are read one by one, so they may be slightly inconsistent
+// with each other while tries are committed
+func (s *Stats) Snapshot() StatsSnapshot {
+	ret := StatsSnapshot{
+		Commits:            atomic.LoadInt64(&s.commits),
+		CommitDuration:     time.Duration(atomic.LoadInt64(&s.commitNanos)),
+		Persists:           atomic.LoadInt64(&s.persists),
+		NodesWritten:       atomic.LoadInt64(&s.nodesWritten),
+		NodesDeleted:       atomic.LoadInt64(&s.nodesDeleted),
+		BytesWritten:       atomic.LoadInt64(&s.bytesWritten),
+		DigestIndexUpdates: atomic.LoadInt64(&s.digestUpdates),
+	}
+	if ret.Commits > 0 {
+		ret.AvgCommitDuration = ret.CommitDuration / time.Duration(ret.Commits)
+	}
+	return ret
+}
+
+// String returns the JSON of the snapshot of counters, as required by expvar.Var
+func (s *Stats) String() string {
+	data, err := json.Marshal(s.Snapshot())
+	Assert(err == nil, "trie::Stats: %v", err)
+	return string(data)
+}
+
+// CommitStats are statistics of one commit returned by Trie.CommitWithStats. The profile of recommitted nodes,
+// i.e. of nodes on modified paths, is collected only by tries created with Options.ProfileCommits
+type CommitStats struct {
+	Duration time.Duration `json:"duration"`
+	// NodesCommitted is the number of recommitted nodes
+	NodesCommitted int `json:"nodesCommitted"`
+	// Profiled is true if the profile below is collected
+	Profiled bool `json:"profiled"`
+	// NodesPerDepth is the number of recommitted nodes at each depth. The root is at the depth 0
+	NodesPerDepth []int `json:"nodesPerDepth,omitempty"`
+	// PathEndsPerDepth is the number of modified paths ending at each depth, i.e. of recommitted nodes without
+	// modified children
+	PathEndsPerDepth []int `json:"pathEndsPerDepth,omitempty"`
+	// NodesPerChildren is the number of recommitted nodes by the number of their children after the commit
+	NodesPerChildren map[int]int `json:"nodesPerChildren,omitempty"`
+	// NodesPerModifiedChildren is the number of recommitted nodes by the number of their modified children,
+	// i.e. the branching of modified paths
+	NodesPerModifiedChildren map[int]int `json:"nodesPerModifiedChildren,omitempty"`
+	// PathFragmentBytes is the total length of path fragments of recommitted nodes, in unpacked bytes
+	PathFragmentBytes int `json:"pathFragmentBytes"`
+}
+
+func newCommitStats(profile bool) CommitStats {
+	if !profile {
+		return CommitStats{}
+	}
+	return CommitStats{
+		Profiled:                 true,
+		NodesPerChildren:         make(map[int]int),
+		NodesPerModifiedChildren: make(map[int]int),
+	}
+}
+
+func (s *CommitStats) nodeCommitted(depth, children, modifiedChildren, pathFragmentLen int) {
+	s.NodesCommitted++
+	if !s.Profiled {
+		return
+	}
+	for len(s.NodesPerDepth) <= depth {
+		s.NodesPerDepth = append(s.NodesPerDepth, 0)
+		s.PathEndsPerDepth = append(s.PathEndsPerDepth, 0)
+	}
+	s.NodesPerDepth[depth]++
+	if modifiedChildren == 0 {
+		s.PathEndsPerDepth[depth]++
+	}
+	s.NodesPerChildren[children]++
+	s.NodesPerModifiedChildren[modifiedChildren]++
+	s.PathFragmentBytes += pathFragmentLen
+}
+
+// AvgPathDepth returns the average depth of ends of modified paths. 0 if the commit is not profiled
+func (s *CommitStats) AvgPathDepth() float64 {
+	var sum, num int
+	for depth, ends := range s.PathEndsPerDepth {
+		sum += depth * ends
+		num += ends
+	}
+	if num == 0 {
+		return 0
+	}
+	return float64(sum) / float64(num)
+}
+
+func (s *CommitStats) String() string {
+	ret := fmt.Sprintf("commit: duration: %v, nodes committed: %d", s.Duration, s.NodesCommitted)
+	if s.Profiled {
+		ret += fmt.Sprintf(", nodes per depth: %v, avg path depth: %.2f, path fragment bytes: %d",
+			s.NodesPerDepth, s.AvgPathDepth(), s.PathFragmentBytes)
+	}
+	return ret
+}
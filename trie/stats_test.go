@@ -0,0 +1,127 @@
+package trie_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("stats"+tn(m), func(t *testing.T) {
+			stats := trie.NewStats()
+			var _ expvar.Var = stats
+			store := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{Stats: stats})
+			require.True(t, tr.Stats().Stats)
+
+			var total trie.PersistStats
+			data := genRnd4()[:500]
+			for i, s := range data {
+				tr.UpdateStr(s, s)
+				if i%100 == 99 {
+					tr.Commit()
+					p := tr.PersistMutationsWithStats(store)
+					total.NodesWritten += p.NodesWritten
+					total.NodesDeleted += p.NodesDeleted
+					total.BytesWritten += p.BytesWritten
+				}
+			}
+			for _, s := range data[:200] {
+				tr.DeleteStr(s)
+			}
+			tr.Commit()
+			_, p := tr.MutationSet()
+			total.NodesWritten += p.NodesWritten
+			total.NodesDeleted += p.NodesDeleted
+			total.BytesWritten += p.BytesWritten
+
+			snap := stats.Snapshot()
+			require.EqualValues(t, 6, snap.Commits)
+			require.EqualValues(t, 6, snap.Persists)
+			require.EqualValues(t, total.NodesWritten, snap.NodesWritten)
+			require.EqualValues(t, total.NodesDeleted, snap.NodesDeleted)
+			require.EqualValues(t, total.BytesWritten, snap.BytesWritten)
+			require.True(t, snap.NodesDeleted > 0)
+			require.True(t, snap.CommitDuration > 0)
+			require.EqualValues(t, snap.CommitDuration/6, snap.AvgCommitDuration)
+
+			var back trie.StatsSnapshot
+			require.NoError(t, json.Unmarshal([]byte(stats.String()), &back))
+			require.EqualValues(t, snap, back)
+
+			// clones are not counted
+			tr.Clone().Commit()
+			require.EqualValues(t, 6, stats.Snapshot().Commits)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestCommitProfile(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("commit profile"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:500]
+			plain := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			tr := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, trie.Options{ProfileCommits: true})
+			require.True(t, tr.Stats().ProfileCommits)
+			for _, s := range data {
+				plain.UpdateStr(s, s+"-value")
+				tr.UpdateStr(s, s+"-value")
+			}
+			plainStats := plain.CommitWithStats()
+			require.False(t, plainStats.Profiled)
+			require.True(t, plainStats.NodesCommitted > 0)
+			require.Nil(t, plainStats.NodesPerDepth)
+
+			stats := tr.CommitWithStats()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(plain), trie.RootCommitment(tr)))
+			require.True(t, stats.Profiled)
+			require.EqualValues(t, plainStats.NodesCommitted, stats.NodesCommitted)
+			// the fresh trie is recommitted entirely
+			require.EqualValues(t, 1, stats.NodesPerDepth[0])
+			sum, ends, withChildren := 0, 0, 0
+			for d, n := range stats.NodesPerDepth {
+				sum += n
+				ends += stats.PathEndsPerDepth[d]
+				require.True(t, stats.PathEndsPerDepth[d] <= n)
+			}
+			require.EqualValues(t, stats.NodesCommitted, sum)
+			for c, n := range stats.NodesPerChildren {
+				if c > 0 {
+					withChildren += n
+				}
+			}
+			require.EqualValues(t, stats.NodesCommitted, ends+withChildren)
+			require.EqualValues(t, stats.NodesPerChildren, stats.NodesPerModifiedChildren)
+			require.True(t, stats.AvgPathDepth() > 0)
+			require.True(t, stats.PathFragmentBytes > 0)
+
+			// one key updated: one path is recommitted
+			tr.UpdateStr(data[0], "other value")
+			stats = tr.CommitWithStats()
+			require.EqualValues(t, 1, stats.PathEndsPerDepth[len(stats.PathEndsPerDepth)-1])
+			for d, n := range stats.NodesPerDepth {
+				require.EqualValues(t, 1, n, "depth %d", d)
+			}
+			require.EqualValues(t, len(stats.NodesPerDepth), stats.NodesCommitted)
+			require.EqualValues(t, len(stats.NodesPerDepth)-1, stats.AvgPathDepth())
+
+			stats = tr.CommitWithStats()
+			require.EqualValues(t, 0, stats.NodesCommitted)
+			require.Contains(t, stats.String(), "nodes committed: 0")
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
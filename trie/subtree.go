@@ -0,0 +1,313 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// ExportSubtreeOptions are optional parameters of ExportSubtree
+type ExportSubtreeOptions struct {
+	// ValueStore is the value store of the source trie. It is required if terminals are not stored with nodes
+	// or if values are exported
+	ValueStore KVReader
+	// ValueDst, if not nil, receives values of the subtree under keys with the prefix removed
+	ValueDst KVWriter
+	// Codec is the serialization of nodes of both the source and the exported tries. Nil means BinaryCodec
+	Codec Codec
+}
+
+// ExportSubtree materializes the subtree of keys with the prefix as the standalone trie in the dst store: the key 'prefix'+'k'
+// of the source trie becomes the key 'k' of the exported trie. The subtree is re-rooted: the node at the top of
+// the subtree becomes the root with the path fragment shortened by the prefix, other nodes are moved to keys without
+// the prefix unchanged, so only the commitment of the root is recomputed. Terminal commitments are kept and stored
+// with nodes, so the exported trie is readable without the value store. Terminals of key commitments remain
+// commitments to the original keys.
+// All exported nodes are verified against the root commitment of the source trie, as well as nodes on the path
+// to the subtree. Returns the root commitment of the exported trie, nil if there are no keys with the prefix
+func ExportSubtree(store KVReader, model CommitmentModel, root VCommitment, prefix []byte, dst KVWriter, opt ...ExportSubtreeOptions) (VCommitment, error) {
+	var o ExportSubtreeOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	o.Codec = codecOrDefault(o.Codec)
+	if o.ValueDst != nil && o.ValueStore == nil {
+		return nil, fmt.Errorf("trie::ExportSubtree: value store is required to export values")
+	}
+	e := &subtreeExporter{
+		store: store,
+		model: model,
+		dst:   dst,
+		opt:   o,
+	}
+	unpackedPrefix := UnpackBytes(prefix, model.PathArity())
+	n, err := e.findSubtree(root, unpackedPrefix)
+	if err != nil || n == nil {
+		return nil, err
+	}
+	e.cut = len(unpackedPrefix)
+	return e.exportNode(n)
+}
+
+type subtreeExporter struct {
+	store KVReader
+	model CommitmentModel
+	dst   KVWriter
+	opt   ExportSubtreeOptions
+	// cut is the length of the unpacked prefix
+	cut int
+}
+
+// findSubtree descends from the root along the prefix to the top node of the subtree. Returns nil if there are no
+// keys with the prefix
+func (e *subtreeExporter) findSubtree(root VCommitment, unpackedPrefix []byte) (Node, error) {
+	if root == nil {
+		return nil, nil
+	}
+	var key []byte
+	expected := root
+	for {
+		n, err := e.readNode(key, expected)
+		if err != nil {
+			return nil, err
+		}
+		full := Concat(n.Key(), n.PathFragment())
+		if bytes.HasPrefix(full, unpackedPrefix) {
+			return n, nil
+		}
+		if !bytes.HasPrefix(unpackedPrefix, full) {
+			return nil, nil
+		}
+		idx := unpackedPrefix[len(full)]
+		c, ok := n.ChildCommitments()[idx]
+		if !ok {
+			return nil, nil
+		}
+		key = Concat(full, idx)
+		expected = c
+	}
+}
+
+// readNode reads the node and checks its commitment
+func (e *subtreeExporter) readNode(unpackedKey []byte, expected VCommitment) (Node, error) {
+	n, err := readVerifiedNode(e.opt.Codec, e.store, e.model, e.opt.ValueStore, unpackedKey, expected)
+	if err != nil {
+		return nil, fmt.Errorf("trie::ExportSubtree: %w", err)
+	}
+	return n, nil
+}
+
+// readVerifiedNode reads the node from the store and checks it against the commitment
+func readVerifiedNode(codec Codec, store KVReader, model CommitmentModel, valueStore KVReader, unpackedKey []byte, expected VCommitment) (Node, error) {
+	nodeBin := store.Get(mustEncodeUnpackedBytes(unpackedKey, model.PathArity()))
+	if len(nodeBin) == 0 {
+		return nil, fmt.Errorf("missing node '%s'", hex.EncodeToString(unpackedKey))
+	}
+	n, err := nodeReadOnlyFromBytes(codec, model, nodeBin, unpackedKey, model.PathArity(), valueStore)
+	if err != nil {
+		return nil, fmt.Errorf("can't read node '%s': %w", hex.EncodeToString(unpackedKey), err)
+	}
+	if !model.EqualCommitments(nodeCommitment(model, n), expected) {
+		return nil, fmt.Errorf("node '%s' does not match the commitment", hex.EncodeToString(unpackedKey))
+	}
+	return n, nil
+}
+
+// exportNode writes the node and its subtree to the dst store. The top node of the subtree becomes the root
+func (e *subtreeExporter) exportNode(n Node) (VCommitment, error) {
+	for i, c := range n.ChildCommitments() {
+		child, err := e.readNode(childKey(n, i), c)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = e.exportNode(child); err != nil {
+			return nil, err
+		}
+	}
+	full := Concat(n.Key(), n.PathFragment())
+	if n.Terminal() != nil && e.opt.ValueDst != nil {
+		if err := e.exportValue(full); err != nil {
+			return nil, err
+		}
+	}
+	data := &NodeData{
+		PathFragment:     n.PathFragment(),
+		ChildCommitments: n.ChildCommitments(),
+		Terminal:         n.Terminal(),
+	}
+	var newKey []byte
+	if len(n.Key()) <= e.cut {
+		// the top node of the subtree
+		data.PathFragment = full[e.cut:]
+	} else {
+		newKey = n.Key()[e.cut:]
+	}
+	buf := getBuffer()
+	if err := e.opt.Codec.WriteNode(buf, data, e.model.PathArity(), false, false); err != nil {
+		putBuffer(buf)
+		return nil, fmt.Errorf("trie::ExportSubtree: %w", err)
+	}
+	e.dst.Set(mustEncodeUnpackedBytes(newKey, e.model.PathArity()), putBuffer(buf))
+	return e.model.CalcNodeCommitment(data), nil
+}
+
+// exportValue copies the value of the key to the value store of the exported trie. Key commitments may have no value
+func (e *subtreeExporter) exportValue(unpackedKey []byte) error {
+	key, err := PackUnpackedBytes(unpackedKey, e.model.PathArity())
+	if err != nil {
+		return fmt.Errorf("trie::ExportSubtree: %w", err)
+	}
+	value := e.opt.ValueStore.Get(key)
+	if value == nil {
+		return nil
+	}
+	newKey, err := PackUnpackedBytes(unpackedKey[e.cut:], e.model.PathArity())
+	if err != nil {
+		return fmt.Errorf("trie::ExportSubtree: %w", err)
+	}
+	e.opt.ValueDst.Set(newKey, value)
+	return nil
+}
+
+// MountSubtree grafts the standalone trie, for example exported with ExportSubtree, under the prefix of the trie:
+// the key 'k' of the source trie becomes the key 'prefix'+'k'. The trie must have no keys with the prefix.
+// Nodes of the source trie are verified against the source root and inserted into the node cache of the trie
+// in one bulk operation with their commitments, so the next Commit recomputes only the commitments on the path
+// from the top of the mounted subtree to the root. The resulting root is the same as if the keys were inserted
+// one by one. The optional value store of the source trie is required if terminals are not stored with its nodes.
+// Values are not copied: values of the mounted keys must be written to the value store of the trie under prefixed keys.
+// Nodes of the source trie must be encoded with the codec of the trie.
+// The trie must have no middleware, and no op-log, because mounted keys are not logged
+func MountSubtree(tr *Trie, prefix []byte, srcStore KVReader, srcRoot VCommitment, srcValueStore ...KVReader) error {
+	if err := tr.checkWritable("MountSubtree"); err != nil {
+		return err
+	}
+	if len(tr.middleware) > 0 {
+		return fmt.Errorf("trie::MountSubtree: keys can't be mounted through the middleware")
+	}
+	if tr.opLog != nil {
+		return fmt.Errorf("trie::MountSubtree: keys can't be mounted into the trie with the op-log")
+	}
+	if srcRoot == nil {
+		return nil
+	}
+	m := &subtreeMounter{
+		tr:             tr,
+		store:          srcStore,
+		unpackedPrefix: UnpackBytes(prefix, tr.PathArity()),
+	}
+	if len(srcValueStore) > 0 {
+		m.values = srcValueStore[0]
+	}
+	if m.hasKeysWithPrefix() {
+		return fmt.Errorf("trie::MountSubtree: the trie contains keys with the prefix '%s'", hex.EncodeToString(prefix))
+	}
+	srcRootNode, err := m.readNode(nil, srcRoot)
+	if err != nil {
+		return err
+	}
+	// nodes are read and verified before the trie is modified
+	nodes := []Node{srcRootNode}
+	for i := 0; i < len(nodes); i++ {
+		for idx, c := range nodes[i].ChildCommitments() {
+			child, err := m.readNode(childKey(nodes[i], idx), c)
+			if err != nil {
+				return err
+			}
+			nodes = append(nodes, child)
+		}
+	}
+	m.mountRoot(srcRootNode)
+	for _, n := range nodes[1:] {
+		m.mountNode(n)
+	}
+	return nil
+}
+
+type subtreeMounter struct {
+	tr             *Trie
+	store          KVReader
+	values         KVReader
+	unpackedPrefix []byte
+}
+
+func (m *subtreeMounter) readNode(unpackedKey []byte, expected VCommitment) (Node, error) {
+	n, err := readVerifiedNode(m.tr.nodeStore.reader.codec, m.store, m.tr.Model(), m.values, unpackedKey, expected)
+	if err != nil {
+		return nil, fmt.Errorf("trie::MountSubtree: %w", err)
+	}
+	return n, nil
+}
+
+// hasKeysWithPrefix checks if there's a node in the trie with the path which starts with the prefix
+func (m *subtreeMounter) hasKeysWithPrefix() bool {
+	proof, lastCommonPrefix, ending := proofPath(m.tr, m.unpackedPrefix)
+	if len(proof) == 0 {
+		return false
+	}
+	switch ending {
+	case EndingTerminal:
+		return true
+	case EndingSplit:
+		// keys exist if the path fragment of the last node continues the prefix
+		return len(proof[len(proof)-1])+len(lastCommonPrefix) == len(m.unpackedPrefix)
+	}
+	return false
+}
+
+// mountRoot inserts the root of the source trie into the trie the same way as the terminal of the key is inserted
+// and marks commitments on the path to the root modified
+func (m *subtreeMounter) mountRoot(n Node) {
+	ns := m.tr.nodeStore
+	full := Concat(m.unpackedPrefix, n.PathFragment())
+	proof, lastCommonPrefix, ending := proofPath(m.tr, full)
+	var top *bufferedNode
+	switch {
+	case len(proof) == 0:
+		top = m.tr.newTerminalNode(nil, full, nil)
+	case ending == EndingExtend:
+		lastKey := proof[len(proof)-1]
+		childIndexPosition := len(lastKey) + len(lastCommonPrefix)
+		Assert(childIndexPosition < len(full), "childPosition < len(full)")
+		ns.removeKey(full[:childIndexPosition+1])
+		top = m.tr.newTerminalNode(full[:childIndexPosition+1], full[childIndexPosition+1:], nil)
+		ns.mustGetNode(lastKey).markChildModified(full[childIndexPosition])
+	case ending == EndingSplit:
+		lastKey := proof[len(proof)-1]
+		childIndexPosition := len(lastKey) + len(lastCommonPrefix)
+		Assert(childIndexPosition < len(full), "trie::MountSubtree: inconsistency: the trie contains the mount point")
+		m.tr.splitNode(full, lastKey, lastCommonPrefix, nil)
+		top = ns.mustGetNode(full[:childIndexPosition+1])
+	default:
+		panic("trie::MountSubtree: inconsistency: the trie contains the mount point")
+	}
+	for i, c := range n.ChildCommitments() {
+		top.n.ChildCommitments[i] = c
+	}
+	m.mountTerminal(top, n.Terminal())
+	if len(proof) > 0 {
+		m.tr.markModifiedCommitmentsBackToRoot(proof)
+	}
+}
+
+// mountNode inserts the node of the source trie under the prefix. The node is not modified, so it is not recommitted,
+// but it is not persisted yet
+func (m *subtreeMounter) mountNode(n Node) {
+	bn := newBufferedNode(Concat(m.unpackedPrefix, n.Key()))
+	bn.n.PathFragment = n.PathFragment()
+	bn.n.ChildCommitments = n.ChildCommitments()
+	bn.n.Terminal = n.Terminal()
+	m.tr.nodeStore.insertNewNode(bn)
+	m.tr.nodeStore.snapshots.touch(bn.unpackedKey)
+	m.mountTerminal(bn, n.Terminal())
+}
+
+func (m *subtreeMounter) mountTerminal(n *bufferedNode, terminal TCommitment) {
+	n.newTerminal = terminal
+	if terminal == nil {
+		return
+	}
+	key, err := PackUnpackedBytes(Concat(n.unpackedKey, n.n.PathFragment), m.tr.PathArity())
+	Assert(err == nil, "trie::MountSubtree: %v", err)
+	m.tr.nodeStore.recordTerminalChange(key, nil, terminal)
+}
@@ -0,0 +1,153 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSubtree(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("export subtree"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			store, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, valueStore)
+			reference, referenceValues := trie.New(m, trie.NewInMemoryKVStore(), nil), trie.NewInMemoryKVStore()
+			for _, s := range data {
+				for _, ns := range []string{"ns1/", "ns2/", "n"} {
+					k, v := ns+s, []byte(ns+s+"-value")
+					tr.UpdateStr(k, v)
+					valueStore.Set([]byte(k), v)
+				}
+				reference.UpdateStr(s, []byte("ns1/"+s+"-value"))
+				referenceValues.Set([]byte(s), []byte("ns1/"+s+"-value"))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			reference.Commit()
+			root := trie.RootCommitment(tr)
+
+			dst, dstValues := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			opt := trie.ExportSubtreeOptions{ValueStore: valueStore, ValueDst: dstValues}
+			c, err := trie.ExportSubtree(store, m, root, []byte("ns1/"), dst, opt)
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), c))
+			require.EqualValues(t, storeContents(referenceValues), storeContents(dstValues))
+
+			exported := trie.NewTrieReader(m, dst, nil)
+			require.True(t, m.EqualCommitments(c, trie.RootCommitment(exported)))
+			require.EqualValues(t, snapshotKeys(t, reference), snapshotKeys(t, exported))
+			report, err := trie.VerifyRoot(dst, m, c, 1, nil)
+			require.NoError(t, err)
+			require.True(t, report.OK(), report.String())
+
+			// the exported trie is updatable
+			updatable := trie.New(m, dst, dstValues)
+			updatable.UpdateStr("new key", "new value")
+			updatable.Commit()
+			reference.UpdateStr("new key", "new value")
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(updatable)))
+
+			// the whole trie
+			c, err = trie.ExportSubtree(store, m, root, nil, trie.NewInMemoryKVStore(), trie.ExportSubtreeOptions{ValueStore: valueStore})
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(root, c))
+			// no keys with the prefix
+			c, err = trie.ExportSubtree(store, m, root, []byte("ns3/"), trie.NewInMemoryKVStore(), opt)
+			require.NoError(t, err)
+			require.Nil(t, c)
+			// wrong root
+			_, err = trie.ExportSubtree(store, m, m.NewVectorCommitment(), []byte("ns1/"), trie.NewInMemoryKVStore(), opt)
+			require.Error(t, err)
+			_, err = trie.ExportSubtree(store, m, root, []byte("ns1/"), trie.NewInMemoryKVStore(), trie.ExportSubtreeOptions{ValueDst: dstValues})
+			require.Error(t, err)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256, 10))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestMountSubtree(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("mount subtree"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			store, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, valueStore)
+			targetStore := trie.NewInMemoryKVStore()
+			target := trie.New(m, targetStore, valueStore)
+			for _, s := range data {
+				for _, ns := range []string{"ns1/", "ns2/", "n"} {
+					k, v := ns+s, []byte(ns+s+"-value")
+					tr.UpdateStr(k, v)
+					valueStore.Set([]byte(k), v)
+					if ns != "ns1/" {
+						target.UpdateStr(k, v)
+					}
+				}
+			}
+			tr.UpdateStr("ns", "ns-value")
+			target.UpdateStr("ns", "ns-value")
+			valueStore.Set([]byte("ns"), []byte("ns-value"))
+			tr.Commit()
+			tr.PersistMutations(store)
+			target.Commit()
+			target.PersistMutations(targetStore)
+			target.ClearCache()
+			root := trie.RootCommitment(tr)
+
+			exported, exportedValues := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			opt := trie.ExportSubtreeOptions{ValueStore: valueStore, ValueDst: exportedValues}
+			c, err := trie.ExportSubtree(store, m, root, []byte("ns1/"), exported, opt)
+			require.NoError(t, err)
+
+			require.Error(t, trie.MountSubtree(target, []byte("ns2/"), exported, c, exportedValues))
+			require.Error(t, trie.MountSubtree(target, []byte("n"), exported, c, exportedValues))
+			require.NoError(t, trie.MountSubtree(target, []byte("ns1/"), exported, c, exportedValues))
+			target.Commit()
+			require.True(t, m.EqualCommitments(root, trie.RootCommitment(target)))
+			target.PersistMutations(targetStore)
+			target.ClearCache()
+			require.True(t, m.EqualCommitments(root, trie.RootCommitment(target)))
+			require.EqualValues(t, storeContents(store), storeContents(targetStore))
+
+			// mount into the empty trie and into the trie being updated
+			emptyStore := trie.NewInMemoryKVStore()
+			empty := trie.New(m, emptyStore, valueStore)
+			require.NoError(t, trie.MountSubtree(empty, []byte("ns1/"), exported, c, exportedValues))
+			empty.Commit()
+			reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data {
+				reference.UpdateStr("ns1/"+s, "ns1/"+s+"-value")
+			}
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(empty)))
+			empty.PersistMutations(emptyStore)
+			report, err := trie.VerifyRoot(emptyStore, m, trie.RootCommitment(empty), 1, valueStore)
+			require.NoError(t, err)
+			require.True(t, report.OK(), report.String())
+
+			empty.UpdateStr("ns1", "ns1-value")
+			require.NoError(t, trie.MountSubtree(empty, []byte("other/"), exported, c, exportedValues))
+			empty.Commit()
+			reference.UpdateStr("ns1", "ns1-value")
+			for _, s := range data {
+				reference.UpdateStr("other/"+s, "ns1/"+s+"-value")
+			}
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(empty)))
+
+			// the mounted subtree must match the root
+			require.Error(t, trie.MountSubtree(trie.New(m, trie.NewInMemoryKVStore(), nil), []byte("x"), exported, root, exportedValues))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256, 10))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
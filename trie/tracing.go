@@ -0,0 +1,77 @@
+package trie
+
+import "context"
+
+// Tracer starts spans of slow operations of the trie, so they show up in distributed traces of the host application.
+// It is shaped after OpenTelemetry without depending on it: the adapter over trace.Tracer of the TracerProvider passes
+// the context to trace.Tracer.Start, so the span becomes the child of the span of the host operation carried by the
+// context, sets integer attributes with attribute.Int64 and ends the span.
+// Spans are started by Commit, PersistMutations, IterateKeys and proofs of keys (GetProofGeneric) of the Trie
+// created with Options.Tracer. The context of spans is set with SetTraceContext, context.Background() by default
+type Tracer interface {
+	// Start starts the span of the operation, for example "trie.Commit", as the child of the span in the context
+	Start(ctx context.Context, operation string) Span
+}
+
+// Span is the span of one operation of the trie
+type Span interface {
+	// SetAttribute sets the counter of the operation, such as number of nodes or bytes
+	SetAttribute(key string, value int64)
+	End()
+}
+
+// span names and attributes of trie operations
+const (
+	SpanCommit           = "trie.Commit"
+	SpanPersistMutations = "trie.PersistMutations"
+	SpanIterate          = "trie.Iterate"
+	SpanProof            = "trie.Proof"
+
+	AttrNodesCommitted = "trie.nodes_committed"
+	AttrNodesWritten   = "trie.nodes_written"
+	AttrNodesDeleted   = "trie.nodes_deleted"
+	AttrBytesWritten   = "trie.bytes_written"
+	AttrKeysVisited    = "trie.keys_visited"
+	AttrPathLength     = "trie.path_length"
+)
+
+// nullSpan is the span of the trie without the tracer
+type nullSpan struct{}
+
+func (nullSpan) SetAttribute(string, int64) {}
+func (nullSpan) End()                       {}
+
+// startSpan starts the span with the tracer, if any
+func startSpan(ctx context.Context, tracer Tracer, operation string) Span {
+	if tracer == nil {
+		return nullSpan{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return tracer.Start(ctx, operation)
+}
+
+// traced is implemented by node stores which trace operations
+type traced interface {
+	tracer() (Tracer, context.Context)
+}
+
+// tracerOf returns the tracer of the node store and the context of its spans. The tracer is nil if the node store
+// does not trace operations
+func tracerOf(tr NodeStore) (Tracer, context.Context) {
+	if t, ok := tr.(traced); ok {
+		return t.tracer()
+	}
+	return nil, nil
+}
+
+func (tr *Trie) tracer() (Tracer, context.Context) {
+	return tr.trace, tr.traceCtx
+}
+
+// SetTraceContext sets the context of spans of subsequent operations of the trie. The span of the host operation
+// carried by the context becomes the parent of spans of the trie. Nil resets it to context.Background()
+func (tr *Trie) SetTraceContext(ctx context.Context) {
+	tr.traceCtx = ctx
+}
@@ -0,0 +1,109 @@
+package trie_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	operation  string
+	ctx        context.Context
+	attributes map[string]int64
+	ended      bool
+}
+
+func (r *recordingTracer) Start(ctx context.Context, operation string) trie.Span {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ret := &recordedSpan{operation: operation, ctx: ctx, attributes: make(map[string]int64)}
+	r.spans = append(r.spans, ret)
+	return ret
+}
+
+func (s *recordedSpan) SetAttribute(key string, value int64) {
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) End() {
+	s.ended = true
+}
+
+// last returns the last span of the operation
+func (r *recordingTracer) last(operation string) *recordedSpan {
+	for i := len(r.spans) - 1; i >= 0; i-- {
+		if r.spans[i].operation == operation {
+			return r.spans[i]
+		}
+	}
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("tracer"+tn(m), func(t *testing.T) {
+			tracer := &recordingTracer{}
+			store := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{Tracer: tracer})
+			data := genData1()[:100]
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			commitStats := tr.CommitWithStats()
+			span := tracer.last(trie.SpanCommit)
+			require.NotNil(t, span)
+			require.True(t, span.ended)
+			require.EqualValues(t, commitStats.NodesCommitted, span.attributes[trie.AttrNodesCommitted])
+			require.EqualValues(t, context.Background(), span.ctx)
+
+			// spans of subsequent operations are children of the span of the host operation in the context
+			type hostSpanKey struct{}
+			hostCtx := context.WithValue(context.Background(), hostSpanKey{}, "host")
+			tr.SetTraceContext(hostCtx)
+
+			persistStats := tr.PersistMutationsWithStats(store)
+			span = tracer.last(trie.SpanPersistMutations)
+			require.True(t, span.ended)
+			require.EqualValues(t, persistStats.NodesWritten, span.attributes[trie.AttrNodesWritten])
+			require.EqualValues(t, persistStats.BytesWritten, span.attributes[trie.AttrBytesWritten])
+			require.EqualValues(t, "host", span.ctx.Value(hostSpanKey{}))
+
+			_, err := tr.IterateKeys(nil, func([]byte, trie.TCommitment) bool { return true })
+			require.NoError(t, err)
+			span = tracer.last(trie.SpanIterate)
+			require.True(t, span.ended)
+			require.EqualValues(t, len(data), span.attributes[trie.AttrKeysVisited])
+			require.EqualValues(t, "host", span.ctx.Value(hostSpanKey{}))
+
+			p := trie.GetProofGeneric(tr, trie.UnpackBytes([]byte(data[0]), m.PathArity()))
+			span = tracer.last(trie.SpanProof)
+			require.True(t, span.ended)
+			require.EqualValues(t, len(p.Path), span.attributes[trie.AttrPathLength])
+			require.EqualValues(t, "host", span.ctx.Value(hostSpanKey{}))
+
+			tr.SetTraceContext(nil)
+			tr.UpdateStr(data[0], "updated")
+			tr.Commit()
+			require.EqualValues(t, context.Background(), tracer.last(trie.SpanCommit).ctx)
+
+			// the reader does not trace
+			n := len(tracer.spans)
+			trie.GetProofGeneric(trie.NewTrieReader(m, store, nil), []byte(data[0]))
+			require.EqualValues(t, n, len(tracer.spans))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,132 @@
+package trie
+
+import "bytes"
+
+// TraverseNodes visits nodes of the trie starting from the node with the unpacked key 'unpackedKey' (nil means root)
+// in depth-first order. Children are visited in the ascending order of child indices.
+// The visitor receives the unpacked key of the node and its data. The node data must not be mutated.
+// Traversal stops when visitor returns false. Function returns false if traversal was interrupted by the visitor.
+// For the Trie, it is expected all mutations are committed, otherwise node data may not reflect the latest updates
+func TraverseNodes(tr NodeStore, unpackedKey []byte, fun func(unpackedKey []byte, n *NodeData) bool) bool {
+	n, ok := tr.GetNode(unpackedKey)
+	if !ok {
+		return true
+	}
+	return traverseNode(tr, n, fun)
+}
+
+func traverseNode(tr NodeStore, n Node, fun func(unpackedKey []byte, n *NodeData) bool) bool {
+	children := n.ChildCommitments()
+	if !fun(n.Key(), &NodeData{
+		PathFragment:     n.PathFragment(),
+		ChildCommitments: children,
+		Terminal:         n.Terminal(),
+	}) {
+		return false
+	}
+	for i := 0; i < tr.PathArity().NumChildren(); i++ {
+		if _, ok := children[byte(i)]; !ok {
+			continue
+		}
+		child, ok := tr.GetNode(childKey(n, byte(i)))
+		if !ok {
+			continue
+		}
+		if !traverseNode(tr, child, fun) {
+			return false
+		}
+	}
+	return true
+}
+
+// TraverseNodes visits nodes of the trie. See TraverseNodes
+func (tr *Trie) TraverseNodes(unpackedKey []byte, fun func(unpackedKey []byte, n *NodeData) bool) bool {
+	return TraverseNodes(tr, unpackedKey, fun)
+}
+
+// TraverseNodes visits nodes of the trie. See TraverseNodes
+func (tr *TrieReader) TraverseNodes(unpackedKey []byte, fun func(unpackedKey []byte, n *NodeData) bool) bool {
+	return TraverseNodes(tr, unpackedKey, fun)
+}
+
+// findNodeByPrefix finds the topmost node which commits to all keys with the unpacked prefix,
+// i.e. the node with key and path fragment which (concatenated) start with the prefix.
+func findNodeByPrefix(tr NodeStore, unpackedPrefix []byte) (Node, bool) {
+	n, ok := tr.GetNode(nil)
+	if !ok {
+		return nil, false
+	}
+	for {
+		path := Concat(n.Key(), n.PathFragment())
+		if len(unpackedPrefix) <= len(path) {
+			if !bytes.HasPrefix(path, unpackedPrefix) {
+				return nil, false
+			}
+			return n, true
+		}
+		if !bytes.HasPrefix(unpackedPrefix, path) {
+			return nil, false
+		}
+		if n, ok = tr.GetNode(childKey(n, unpackedPrefix[len(path)])); !ok {
+			return nil, false
+		}
+	}
+}
+
+// CommitmentAt returns commitment to the subtrie of all keys with the prefix. The prefix is in original (packed) bytes.
+// All keys with the prefix may continue with the same unpacked residual path, which is returned too.
+// The commitment is calculated as if the topmost node of the subtrie would be located exactly at the prefix, i.e.
+// with the residual path as its path fragment. So it is a fingerprint of the set of key/value pairs with the prefix,
+// which does not depend on other keys in the trie. Returns false if no key with the prefix is committed in the trie.
+// For the Trie, it is expected all mutations are committed
+func CommitmentAt(tr NodeStore, prefix []byte) (VCommitment, []byte, bool) {
+	unpackedPrefix := UnpackBytes(prefix, tr.PathArity())
+	n, ok := findNodeByPrefix(tr, unpackedPrefix)
+	if !ok {
+		return nil, nil, false
+	}
+	residual := Concat(n.Key(), n.PathFragment())[len(unpackedPrefix):]
+	return tr.Model().CalcNodeCommitment(&NodeData{
+		PathFragment:     residual,
+		ChildCommitments: n.ChildCommitments(),
+		Terminal:         n.Terminal(),
+	}), residual, true
+}
+
+// CommitmentAt returns commitment of the subtrie with the prefix. See CommitmentAt
+func (tr *Trie) CommitmentAt(prefix []byte) (VCommitment, []byte, bool) {
+	return CommitmentAt(tr, prefix)
+}
+
+// CommitmentAt returns commitment of the subtrie with the prefix. See CommitmentAt
+func (tr *TrieReader) CommitmentAt(prefix []byte) (VCommitment, []byte, bool) {
+	return CommitmentAt(tr, prefix)
+}
+
+// ChildCommitments returns child commitments of the topmost node which commits to all keys with the prefix, in original
+// (packed) bytes, without decoding raw node bytes. It is intended for auditors which spot-check internal structure
+// of the trie and for custom traversals. The unpacked path of the node (its key concatenated with the path fragment)
+// is returned too: the child with the index 'i' is the node with the unpacked key path||i (see TraverseNodes).
+// Commitments are copies, so they can be retained and mutated. Returns false if no key with the prefix
+// is committed in the trie. For the Trie, it is expected all mutations are committed
+func ChildCommitments(tr NodeStore, prefix []byte) (map[byte]VCommitment, []byte, bool) {
+	n, ok := findNodeByPrefix(tr, UnpackBytes(prefix, tr.PathArity()))
+	if !ok {
+		return nil, nil, false
+	}
+	ret := make(map[byte]VCommitment, len(n.ChildCommitments()))
+	for i, c := range n.ChildCommitments() {
+		ret[i] = c.Clone()
+	}
+	return ret, Concat(n.Key(), n.PathFragment()), true
+}
+
+// ChildCommitments returns child commitments of the node with the prefix. See ChildCommitments
+func (tr *Trie) ChildCommitments(prefix []byte) (map[byte]VCommitment, []byte, bool) {
+	return ChildCommitments(tr, prefix)
+}
+
+// ChildCommitments returns child commitments of the node with the prefix. See ChildCommitments
+func (tr *TrieReader) ChildCommitments(prefix []byte) (map[byte]VCommitment, []byte, bool) {
+	return ChildCommitments(tr, prefix)
+}
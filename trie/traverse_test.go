@@ -0,0 +1,171 @@
+package trie_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraverseNodes(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("traverse"+tn(m), func(t *testing.T) {
+			data := genData1()[:500]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			tr.ClearCache()
+
+			rdr := trie.NewTrieReader(m, store, nil)
+			numNodes, numTerminals := 0, 0
+			var prevKey []byte
+			ok := rdr.TraverseNodes(nil, func(unpackedKey []byte, n *trie.NodeData) bool {
+				if numNodes > 0 {
+					require.True(t, bytes.Compare(prevKey, unpackedKey) < 0)
+				}
+				prevKey = unpackedKey
+				numNodes++
+				if n.Terminal != nil {
+					numTerminals++
+				}
+				return true
+			})
+			require.True(t, ok)
+			require.EqualValues(t, trie.NumEntries(store), numNodes)
+			require.EqualValues(t, len(data), numTerminals)
+
+			numNodesTrie := 0
+			tr.TraverseNodes(nil, func(_ []byte, _ *trie.NodeData) bool {
+				numNodesTrie++
+				return true
+			})
+			require.EqualValues(t, numNodes, numNodesTrie)
+
+			numNodes = 0
+			ok = rdr.TraverseNodes(nil, func(_ []byte, _ *trie.NodeData) bool {
+				numNodes++
+				return numNodes < 10
+			})
+			require.False(t, ok)
+			require.EqualValues(t, 10, numNodes)
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
+
+func TestCommitmentAt(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("commitment at"+tn(m), func(t *testing.T) {
+			namespace := []string{"account1/a", "account1/b", "account1/c/d"}
+			tr1 := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			tr2 := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range namespace {
+				tr1.UpdateStr(s, s+"$")
+				tr2.UpdateStr(s, s+"$")
+			}
+			for _, s := range genData1() {
+				tr1.UpdateStr("x"+s, s)
+			}
+			tr2.UpdateStr("account2/a", "a")
+			tr1.Commit()
+			tr2.Commit()
+			require.False(t, m.EqualCommitments(trie.RootCommitment(tr1), trie.RootCommitment(tr2)))
+
+			c1, residual1, ok := tr1.CommitmentAt([]byte("account1/"))
+			require.True(t, ok)
+			c2, residual2, ok := tr2.CommitmentAt([]byte("account1/"))
+			require.True(t, ok)
+			require.EqualValues(t, residual1, residual2)
+			require.True(t, m.EqualCommitments(c1, c2))
+
+			_, residual1, ok = tr1.CommitmentAt([]byte("acc"))
+			require.True(t, ok)
+			require.True(t, bytes.HasPrefix(residual1, trie.UnpackBytes([]byte("ount1/"), m.PathArity())))
+			c1, _, _ = tr1.CommitmentAt([]byte("acc"))
+			c2, _, ok = tr2.CommitmentAt([]byte("acc"))
+			require.True(t, ok)
+			require.False(t, m.EqualCommitments(c1, c2))
+
+			_, _, ok = tr1.CommitmentAt([]byte("account3"))
+			require.False(t, ok)
+
+			c1, _, _ = tr1.CommitmentAt([]byte("account1/"))
+			tr1.UpdateStr("account1/b", "changed")
+			tr1.Commit()
+			c2, _, ok = tr1.CommitmentAt([]byte("account1/"))
+			require.True(t, ok)
+			require.False(t, m.EqualCommitments(c1, c2))
+
+			cRoot, _, ok := tr1.CommitmentAt(nil)
+			require.True(t, ok)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr1), cRoot))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestChildCommitments(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("child commitments"+tn(m), func(t *testing.T) {
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range genData1() {
+				tr.UpdateStr("account1/"+s, s)
+				tr.UpdateStr("account2/"+s, s)
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			rdr := trie.NewTrieReader(m, store, nil)
+
+			for _, prefix := range []string{"", "account1/", "account2/a"} {
+				children, path, ok := rdr.ChildCommitments([]byte(prefix))
+				require.True(t, ok)
+				require.True(t, len(children) > 0)
+				require.True(t, bytes.HasPrefix(path, trie.UnpackBytes([]byte(prefix), m.PathArity())))
+				// each child commitment is the commitment of the node under the child key
+				for i, c := range children {
+					n, ok := rdr.GetNode(trie.Concat(path, i))
+					require.True(t, ok)
+					require.True(t, m.EqualCommitments(c, m.CalcNodeCommitment(&trie.NodeData{
+						PathFragment:     n.PathFragment(),
+						ChildCommitments: n.ChildCommitments(),
+						Terminal:         n.Terminal(),
+					})))
+				}
+				trChildren, trPath, ok := tr.ChildCommitments([]byte(prefix))
+				require.True(t, ok)
+				require.EqualValues(t, path, trPath)
+				require.EqualValues(t, len(children), len(trChildren))
+			}
+			_, _, ok := rdr.ChildCommitments([]byte("account3"))
+			require.False(t, ok)
+
+			// returned commitments are copies
+			children, _, _ := rdr.ChildCommitments(nil)
+			root := trie.RootCommitment(rdr)
+			for i := range children {
+				delete(children, i)
+			}
+			require.True(t, m.EqualCommitments(root, trie.RootCommitment(rdr)))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -8,18 +8,41 @@ package trie
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"sort"
+	"time"
 )
 
 // Trie is an updatable trie implemented on top of the unpackedKey/value store. It is virtualized and optimized by caching of the
 // trie update operation and keeping consistent trie in the cache
 type Trie struct {
 	nodeStore *nodeStoreBuffered
+	log       Logger
+	opLog     *OpLog
+	// middleware transforms keys and values before insertion
+	middleware MiddlewareChain
+	stats      *Stats
+	// profileCommits enables collection of profiles of commits (see CommitWithStats)
+	profileCommits bool
+	// terminalPolicy overrides value size thresholds of the model per key prefix
+	terminalPolicy TerminalPolicy
+	// fixedKeyLength is the length of all keys. 0 means keys of any length
+	fixedKeyLength int
+	// trace starts spans of slow operations. Nil means no tracing
+	trace Tracer
+	// traceCtx is the parent context of spans (see SetTraceContext). Nil means context.Background()
+	traceCtx context.Context
+	// readOnly is 1 when the trie rejects mutations (see SetReadOnly). Accessed atomically
+	readOnly int32
 }
 
 // TrieReader direct read-only access to trie
 type TrieReader struct {
 	reader *nodeStore
+	// root is the verified root node shared by readers opened from the RootCatalog, if not nil
+	root *nodeReadOnly
 }
 
 // NodeStore is an interface to TrieReader to the trie as a set of TrieReader represented as unpackedKey/value pairs
@@ -33,29 +56,119 @@ type NodeStore interface {
 	Info() string
 }
 
-// RootCommitment computes root commitment from the root node of the trie represented as a NodeStore
+// RootCommitment computes root commitment from the root node of the trie represented as a NodeStore.
+// The empty trie (the "genesis" state without any key) has no root node and its root commitment is nil.
+// The trie returns to the nil root after all keys are deleted. The proof of any key in the empty trie has an empty path
 func RootCommitment(tr NodeStore) VCommitment {
 	n, ok := tr.GetNode(nil)
 	if !ok {
 		return nil
 	}
-	return tr.Model().CalcNodeCommitment(&NodeData{
-		PathFragment:     n.PathFragment(),
-		ChildCommitments: n.ChildCommitments(),
-		Terminal:         n.Terminal(),
-	})
+	return nodeCommitment(tr.Model(), n)
 }
 
 // Trie implements NodeStore interface. It buffers (caches) all TrieReader for optimization purposes
 var _ NodeStore = &Trie{}
 
+// Options are optional parameters of the Trie
+type Options struct {
+	// OptimizeKeyCommitments enables optimized serialization of nodes which commit to its own key (see InsertKeyCommitment)
+	OptimizeKeyCommitments bool
+	// AllowEmptyValues makes empty value a legal value, distinct from the absence of the key.
+	// In this mode only nil value means deletion, while empty non-nil value is committed with the
+	// special terminal commitment. The commitment model must implement EmptyValueCommitter
+	AllowEmptyValues bool
+	// Logger receives trie events. Nil means no logging
+	Logger Logger
+	// DigestIndex enables the secondary index of keys by terminal commitments (see KeysByTerminal).
+	// The index is updated in the store upon PersistMutations. Nil means the index is not maintained
+	DigestIndex KVWriter
+	// ExpiryIndex enables the index of keys by expiry time (see UpdateWithExpiry and Expire).
+	// The index is updated in the store upon PersistMutations. Nil means the index is not maintained
+	ExpiryIndex KVStore
+	// ChangelogIndex enables the index of roots of commits which changed the value of the key (see KeyHistory).
+	// The index is updated in the store upon PersistMutations. Only one trie may update the index.
+	// Nil means the index is not maintained
+	ChangelogIndex KVStore
+	// OpLog records updates, deletions and root commitments of commits (see ReplayOpLog). Clones and forks
+	// of the trie are not recorded. The replay assumes mutations are persisted after each commit. Nil means no op-log
+	OpLog *OpLog
+	// ReadSnapshots enables publishing of read snapshots by Commit (see ReadSnapshot). It costs copying of nodes
+	// changed by each commit and of not yet persisted nodes
+	ReadSnapshots bool
+	// Middleware transforms keys and values before they are inserted into the trie (see Middleware).
+	// The value store must contain transformed pairs (see Trie.Transform). Nil means keys and values are inserted as is
+	Middleware MiddlewareChain
+	// Stats receives cumulative counters of commits and persisted mutations (see Stats). Clones and forks of the trie
+	// are not counted. Nil means counters are not maintained
+	Stats *Stats
+	// ProfileCommits makes commits collect the distribution of depths and branching of recommitted nodes,
+	// returned by CommitWithStats. It helps to choose arity and hashing parameters with the real workload
+	ProfileCommits bool
+	// Codec is the serialization of nodes in the node store (see Codec). Readers of the store must use the same codec.
+	// Nil means BinaryCodec
+	Codec Codec
+	// TerminalPolicy sets value size thresholds of inlining of terminal commitments per key prefix (see TerminalPolicy
+	// and TrieConfig). The commitment model must implement ThresholdCommitter. Nil means thresholds of the model
+	TerminalPolicy TerminalPolicy
+	// FixedKeyLength asserts all keys are exactly FixedKeyLength bytes long (after the middleware), for example 32-byte
+	// hashed keys. It enables the fast path of updates and deletions with fewer allocations. Keys of other length panic.
+	// 0 means keys of any length
+	FixedKeyLength int
+	// Tracer starts spans of commits, persists, iterations and proofs (see Tracer). Nil means no tracing
+	Tracer Tracer
+	// ReadOnly creates the trie in the read-only mode (see Trie.SetReadOnly)
+	ReadOnly bool
+	// ExpectedSize is the expected number of keys updated between clearings of the cache (see ClearCache), for example
+	// the number of records per batch of the bulk import. The node cache is preallocated for it upon creation and after
+	// each ClearCache, which avoids repeated growth of the cache. 0 means no preallocation
+	ExpectedSize int
+}
+
 func New(model CommitmentModel, trieStore, valueStore KVReader, optimizeKeyCommitments ...bool) *Trie {
 	o := false
 	if len(optimizeKeyCommitments) > 0 {
 		o = optimizeKeyCommitments[0]
 	}
+	return NewWithOptions(model, trieStore, valueStore, Options{OptimizeKeyCommitments: o})
+}
+
+// NewWithOptions creates new Trie with the specified options
+func NewWithOptions(model CommitmentModel, trieStore, valueStore KVReader, opt Options) *Trie {
+	if opt.AllowEmptyValues {
+		_, ok := model.(EmptyValueCommitter)
+		Assert(ok, "trie::NewWithOptions: commitment model '%s' does not support empty values", model.ShortName())
+	}
+	if len(opt.TerminalPolicy) > 0 {
+		_, ok := model.(ThresholdCommitter)
+		Assert(ok, "trie::NewWithOptions: commitment model '%s' does not support the terminal policy", model.ShortName())
+		err := opt.TerminalPolicy.Validate()
+		Assert(err == nil, "trie::NewWithOptions: %v", err)
+	}
 	ret := &Trie{
-		nodeStore: newNodeStoreBuffered(model, trieStore, valueStore, model.PathArity(), o),
+		nodeStore:      newNodeStoreBuffered(model, trieStore, valueStore, model.PathArity(), opt.OptimizeKeyCommitments, codecOrDefault(opt.Codec)),
+		log:            loggerOrNull(opt.Logger),
+		opLog:          opt.OpLog,
+		middleware:     opt.Middleware,
+		stats:          opt.Stats,
+		profileCommits: opt.ProfileCommits,
+		terminalPolicy: opt.TerminalPolicy,
+		fixedKeyLength: opt.FixedKeyLength,
+		trace:          opt.Tracer,
+	}
+	ret.nodeStore.allowEmptyValues = opt.AllowEmptyValues
+	ret.nodeStore.preallocate(opt.ExpectedSize)
+	ret.nodeStore.digestIndex = opt.DigestIndex
+	ret.nodeStore.expiryIndex = opt.ExpiryIndex
+	if opt.ChangelogIndex != nil {
+		ret.nodeStore.changelogIndex = opt.ChangelogIndex
+		ret.nodeStore.changelogSeq = readChangelogSeq(opt.ChangelogIndex)
+	}
+	if opt.ReadSnapshots {
+		ret.nodeStore.snapshots = newSnapshotState(ret.nodeStore.reader)
+	}
+	if opt.ReadOnly {
+		ret.readOnly = 1
 	}
 	return ret
 }
@@ -63,7 +176,30 @@ func New(model CommitmentModel, trieStore, valueStore KVReader, optimizeKeyCommi
 // Clone is a deep copy of the trie, including its buffered data
 func (tr *Trie) Clone() *Trie {
 	return &Trie{
-		nodeStore: tr.nodeStore.clone(),
+		nodeStore:      tr.nodeStore.clone(),
+		log:            tr.log,
+		middleware:     tr.middleware,
+		profileCommits: tr.profileCommits,
+		terminalPolicy: tr.terminalPolicy,
+		fixedKeyLength: tr.fixedKeyLength,
+		trace:          tr.trace,
+		traceCtx:       tr.traceCtx,
+	}
+}
+
+// Fork creates an independent trie which shares the underlying stores and the buffered data with the original.
+// Buffered nodes are copied lazily, upon the first access, so forking is cheap. Mutations of the fork are not
+// visible in the original trie and vice versa. It can be used to apply speculative updates and discard them
+func (tr *Trie) Fork() *Trie {
+	return &Trie{
+		nodeStore:      tr.nodeStore.fork(),
+		log:            tr.log,
+		middleware:     tr.middleware,
+		profileCommits: tr.profileCommits,
+		terminalPolicy: tr.terminalPolicy,
+		fixedKeyLength: tr.fixedKeyLength,
+		trace:          tr.trace,
+		traceCtx:       tr.traceCtx,
 	}
 }
 
@@ -80,21 +216,133 @@ func (tr *Trie) GetNode(unpackedKey []byte) (Node, bool) {
 	return tr.nodeStore.getNode(unpackedKey)
 }
 
+// Info returns the human-readable configuration of the trie and the number of cached nodes
 func (tr *Trie) Info() string {
-	return fmt.Sprintf("Trie( model dscr: '%s', optimize key commitments: %v)",
-		tr.nodeStore.reader.m.Description(), tr.nodeStore.optimizeKeyCommitments,
-	)
+	return tr.Stats().String()
+}
+
+// Stats returns the machine-readable configuration of the trie and the number of cached nodes
+func (tr *Trie) Stats() *TrieInfo {
+	ret := newTrieInfo("Trie", &tr.nodeStore.reader)
+	ret.OptimizeKeyCommitments = tr.nodeStore.optimizeKeyCommitments
+	ret.AllowEmptyValues = tr.nodeStore.allowEmptyValues
+	ret.DigestIndex = tr.nodeStore.digestIndex != nil
+	ret.ExpiryIndex = tr.nodeStore.expiryIndex != nil
+	ret.ChangelogIndex = tr.nodeStore.changelogIndex != nil
+	ret.OpLog = tr.opLog != nil
+	ret.ReadSnapshots = tr.nodeStore.snapshots != nil
+	ret.Stats = tr.stats != nil
+	ret.ProfileCommits = tr.profileCommits
+	ret.TerminalRules = len(tr.terminalPolicy)
+	ret.FixedKeyLength = tr.fixedKeyLength
+	ret.ReadOnly = tr.IsReadOnly()
+	ret.ExpectedNodes = tr.nodeStore.expectedNodes
+	ret.CachedNodes = len(tr.nodeStore.nodeCache)
+	return ret
+}
+
+// PersistStats are statistics of the persisted node mutations
+type PersistStats struct {
+	NodesWritten int
+	NodesDeleted int
+	BytesWritten int
+	// DigestIndexUpdates is number of updated entries of the digest index
+	DigestIndexUpdates int
+	// ExpiryIndexUpdates is number of updated entries of the expiry index
+	ExpiryIndexUpdates int
+	// ChangelogIndexUpdates is number of written entries of the changelog index
+	ChangelogIndexUpdates int
 }
 
-// PersistMutations persists the cache to the unpackedKey/value store
-// Does not clear cache
+// NodeMutation is a write of the serialized node under the encoded key. Nil Value means deletion of the key
+type NodeMutation struct {
+	Key   []byte
+	Value []byte
+}
+
+// PersistMutations persists the cache to the unpackedKey/value store. Only nodes changed since the last
+// persist are written. Does not clear cache. Returns number of written and deleted nodes
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryPersistMutations)
 func (tr *Trie) PersistMutations(store KVWriter) int {
-	return tr.nodeStore.persistMutations(store)
+	stats := tr.PersistMutationsWithStats(store)
+	return stats.NodesWritten + stats.NodesDeleted
+}
+
+// PersistMutationsWithStats is PersistMutations which returns statistics of the persisted mutations.
+// Changes of the digest, expiry and changelog indexes are written to their stores
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryPersistMutations)
+func (tr *Trie) PersistMutationsWithStats(store KVWriter) PersistStats {
+	return tr.persistMutations(store, tr.nodeStore.digestIndex, tr.nodeStore.expiryIndex, tr.nodeStore.changelogIndex)
+}
+
+func (tr *Trie) persistMutations(store, digestIndex, expiryIndex, changelogIndex KVWriter) PersistStats {
+	tr.mustBeWritable("PersistMutations")
+	span := startSpan(tr.traceCtx, tr.trace, SpanPersistMutations)
+	defer span.End()
+	ret := tr.nodeStore.persistMutations(store)
+	ret.DigestIndexUpdates = tr.nodeStore.persistDigestChanges(digestIndex)
+	ret.ExpiryIndexUpdates = tr.nodeStore.persistExpiryChanges(expiryIndex)
+	ret.ChangelogIndexUpdates = tr.nodeStore.persistChangelog(changelogIndex)
+	tr.stats.persisted(ret)
+	span.SetAttribute(AttrNodesWritten, int64(ret.NodesWritten))
+	span.SetAttribute(AttrNodesDeleted, int64(ret.NodesDeleted))
+	span.SetAttribute(AttrBytesWritten, int64(ret.BytesWritten))
+	tr.log.Debugf("trie: persisted mutations: %d nodes written, %d deleted, %d bytes", ret.NodesWritten, ret.NodesDeleted, ret.BytesWritten)
+	return ret
+}
+
+// MutationSet returns node mutations instead of writing them to the store, so the caller can route them
+// into its own atomic batch together with the application data. Mutations are sorted by key.
+// The trie treats returned mutations as persisted. Changes of the digest, expiry and changelog indexes are written directly
+// to their stores, i.e. not atomically with node mutations. Use MutationSetWithIndexes to collect them too
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryMutationSet)
+func (tr *Trie) MutationSet() ([]NodeMutation, PersistStats) {
+	collector := &mutationCollector{}
+	stats := tr.PersistMutationsWithStats(collector)
+	return collector.sorted(), stats
+}
+
+// IndexMutations are writes to the index stores of the trie (see Options.DigestIndex, Options.ExpiryIndex and
+// Options.ChangelogIndex). Keys are those of the respective index store
+type IndexMutations struct {
+	Digest    []NodeMutation
+	Expiry    []NodeMutation
+	Changelog []NodeMutation
+}
+
+// MutationSetWithIndexes is MutationSet which collects changes of the digest, expiry and changelog indexes instead of writing
+// them to index stores, so nodes and indexes can be written in one atomic batch. Index stores must not be
+// written until the returned mutations are applied. Mutations are sorted by key
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryMutationSetWithIndexes)
+func (tr *Trie) MutationSetWithIndexes() ([]NodeMutation, IndexMutations, PersistStats) {
+	nodes := &mutationCollector{}
+	digest := &mutationCollector{}
+	expiry := &mutationCollector{}
+	changelog := &mutationCollector{}
+	stats := tr.persistMutations(nodes, digest, expiry, changelog)
+	return nodes.sorted(), IndexMutations{Digest: digest.sorted(), Expiry: expiry.sorted(), Changelog: changelog.sorted()}, stats
+}
+
+type mutationCollector struct {
+	mutations []NodeMutation
+}
+
+func (c *mutationCollector) sorted() []NodeMutation {
+	sort.Slice(c.mutations, func(i, j int) bool {
+		return bytes.Compare(c.mutations[i].Key, c.mutations[j].Key) < 0
+	})
+	return c.mutations
+}
+
+func (c *mutationCollector) Set(key, value []byte) {
+	c.mutations = append(c.mutations, NodeMutation{Key: key, Value: value})
 }
 
 // ClearCache clears the node cache
 func (tr *Trie) ClearCache() {
+	tr.log.Debugf("trie: clear cache: %d cached nodes, %d deleted", len(tr.nodeStore.nodeCache), len(tr.nodeStore.deleted))
 	tr.nodeStore.clearCache()
+	tr.opLog.discard()
 }
 
 // newTerminalNode creates new node in the trie with specified PathFragment and Terminal commitment.
@@ -110,18 +358,96 @@ func (tr *Trie) newTerminalNode(unpackedKey, unpackedPathFragment []byte, newTer
 }
 
 // Commit calculates a new root commitment value from the cache and commits all mutations in the cached TrieReader
-// It is a re-calculation of the trie. bufferedNode caches are updated accordingly.
+// It is a re-calculation of the trie. bufferedNode caches are updated accordingly
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryCommit)
 func (tr *Trie) Commit() {
-	tr.commitNode(nil, nil)
+	tr.CommitWithStats()
+}
+
+// CommitWithStats is Commit which returns statistics of the commit. Profile of recommitted nodes is collected
+// only by tries created with Options.ProfileCommits. If the commitment model fails, the commit is rolled back
+// (see TryCommit) and CommitWithStats panics. In the read-only mode it panics with the error wrapping ErrReadOnly.
+// TryCommit returns both errors instead
+func (tr *Trie) CommitWithStats() CommitStats {
+	tr.mustBeWritable("Commit")
+	ret, err := tr.TryCommit()
+	Assert(err == nil, "%v", err)
+	return ret
+}
+
+// TryCommit is CommitWithStats with transactional semantics. New commitments are computed into the staging area and
+// applied to cached nodes only when the whole trie has been recommitted. If the commitment model panics in the middle
+// of the commit, for example because of failure of KZG math, nodes are left as they were before the commit,
+// with all updates still uncommitted, and the error is returned
+func (tr *Trie) TryCommit() (CommitStats, error) {
+	if err := tr.checkWritable("TryCommit"); err != nil {
+		return newCommitStats(tr.profileCommits), err
+	}
+	span := startSpan(tr.traceCtx, tr.trace, SpanCommit)
+	defer span.End()
+	ret := newCommitStats(tr.profileCommits)
+	start := time.Now()
+	staged, err := tr.stageCommit(&ret)
+	if err != nil {
+		tr.log.Warnf("trie: commit has been rolled back: %v", err)
+		return newCommitStats(tr.profileCommits), err
+	}
+	for i := range staged {
+		staged[i].apply(tr.nodeStore)
+	}
+	ret.Duration = time.Since(start)
+	tr.stats.commit(ret.Duration)
+	span.SetAttribute(AttrNodesCommitted, int64(ret.NodesCommitted))
+	tr.nodeStore.snapshots.publish(tr.nodeStore.nodeCache)
+	if tr.nodeStore.changelogIndex != nil {
+		tr.nodeStore.commitChangelog(RootCommitment(tr))
+	}
+	if tr.opLog != nil {
+		tr.opLog.commit(RootCommitment(tr))
+	}
+	tr.log.Debugf("trie: committed: %d cached nodes, %d deleted", len(tr.nodeStore.nodeCache), len(tr.nodeStore.deleted))
+	return ret, nil
+}
+
+// stagedNode is the node recommitted by the commit and its new child commitments
+type stagedNode struct {
+	n                *bufferedNode
+	childCommitments map[byte]VCommitment
+}
+
+// apply makes the staged state of the node committed. Child modification marks are cleaned
+func (s *stagedNode) apply(sc *nodeStoreBuffered) {
+	s.n.persisted = false
+	sc.snapshots.touch(s.n.unpackedKey)
+	s.n.n.ChildCommitments = s.childCommitments
+	s.n.n.Terminal = s.n.newTerminal
+	if len(s.n.modifiedChildren) > 0 {
+		// clean the modification marks if any
+		s.n.modifiedChildren = make(map[byte]struct{})
+	}
+	s.n.pathChanged = false
+}
+
+// stageCommit recommits the trie into the staging area. The panic of the commitment model is returned as the error
+func (tr *Trie) stageCommit(stats *CommitStats) (staged []stagedNode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			staged = nil
+			err = fmt.Errorf("trie::Commit: commitment model '%s' failed: %v", tr.Model().ShortName(), r)
+		}
+	}()
+	tr.commitNode(nil, nil, 0, stats, &staged)
+	return staged, nil
 }
 
 // commitNode re-calculates node commitment and, recursively, its children commitments
-// Child modification marks in 'modifiedChildren' are updated
+// New child commitments of the node are staged, the node itself is not changed until staged nodes are applied
 // Return update to the upper commitment. nil mean upper commitment is not updated
 // It calls implementation-specific function UpdateNodeCommitment and passes parameter
 // calcDelta = true if node's commitment can be updated incrementally. The implementation
-// of UpdateNodeCommitment may use this parameter to optimize underlying cryptography
-func (tr *Trie) commitNode(key []byte, update *VCommitment) {
+// of UpdateNodeCommitment may use this parameter to optimize underlying cryptography.
+// 'depth' is the depth of the node in the trie, the root is at the depth 0
+func (tr *Trie) commitNode(key []byte, update *VCommitment, depth int, stats *CommitStats, staged *[]stagedNode) {
 	n, ok := tr.nodeStore.getNode(key)
 	if !ok {
 		if update != nil {
@@ -129,74 +455,180 @@ func (tr *Trie) commitNode(key []byte, update *VCommitment) {
 		}
 		return
 	}
-	isModified := n.pathChanged || len(n.modifiedChildren) > 0 || !tr.Model().EqualCommitments(n.newTerminal, n.n.Terminal)
-	if !isModified {
+	if !n.isModified(tr.Model()) {
 		return
 	}
+	// the model mutates child commitments of the node data, so they are copied
 	mutate := NodeData{
 		PathFragment:     n.n.PathFragment,
-		ChildCommitments: n.n.ChildCommitments,
+		ChildCommitments: make(map[byte]VCommitment, len(n.n.ChildCommitments)),
 		Terminal:         n.n.Terminal,
 	}
+	for i, c := range n.n.ChildCommitments {
+		mutate.ChildCommitments[i] = c
+	}
 	childUpdates := make(map[byte]VCommitment)
 	for childIndex := range n.modifiedChildren {
 		curCommitment := mutate.ChildCommitments[childIndex] // may be nil
-		tr.commitNode(childKey(n, childIndex), &curCommitment)
+		tr.commitNode(childKey(n, childIndex), &curCommitment, depth+1, stats, staged)
 		childUpdates[childIndex] = curCommitment
 	}
 
 	calcDelta := !n.pathChanged && update != nil && *update == nil
 	tr.Model().UpdateNodeCommitment(&mutate, childUpdates, calcDelta, n.newTerminal, update)
+	stats.nodeCommitted(depth, len(mutate.ChildCommitments), len(n.modifiedChildren), len(n.n.PathFragment))
+	*staged = append(*staged, stagedNode{n: n, childCommitments: mutate.ChildCommitments})
+}
 
-	n.n.Terminal = n.newTerminal
-	if len(n.modifiedChildren) > 0 {
-		// clean the modification marks if any
-		n.modifiedChildren = make(map[byte]struct{})
+// commitToValue calculates terminal commitment to the value stored under the key.
+// Returns nil if the value means deletion of the key
+func (tr *Trie) commitToValue(key, value []byte) TCommitment {
+	if tr.nodeStore.allowEmptyValues && value != nil && len(value) == 0 {
+		return tr.nodeStore.reader.m.(EmptyValueCommitter).CommitToEmptyValue()
+	}
+	if tr.nodeStore.optimizeKeyCommitments && bytes.Equal(key, value) {
+		return tr.nodeStore.reader.m.CommitToData(UnpackBytes(value, tr.nodeStore.arity))
 	}
-	n.pathChanged = false
+	if threshold, ok := tr.terminalPolicy.Threshold(key); ok {
+		return tr.nodeStore.reader.m.(ThresholdCommitter).CommitToDataWithThreshold(value, threshold)
+	}
+	return tr.nodeStore.reader.m.CommitToData(value)
 }
 
 // Update updates Trie with the unpackedKey/value. Reorganizes and re-calculates trie, keeps cache consistent
+// Empty value means deletion of the key, unless trie is created with Options.AllowEmptyValues. In the latter case
+// only nil value deletes the key. Key and value are transformed by the middleware of the trie, if any
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryUpdate)
 func (tr *Trie) Update(key []byte, value []byte) {
-	var c TCommitment
-	if tr.nodeStore.optimizeKeyCommitments && bytes.Equal(key, value) {
-		c = tr.nodeStore.reader.m.CommitToData(UnpackBytes(value, tr.nodeStore.arity))
-	} else {
-		c = tr.nodeStore.reader.m.CommitToData(value)
+	if len(tr.middleware) > 0 {
+		if tr.isDeletion(value) {
+			tr.Delete(key)
+			return
+		}
+		key, value = tr.middleware.Transform(key, value)
 	}
+	tr.update(key, value)
+}
+
+// Transform returns the key and the value as they are inserted into the trie by Update,
+// i.e. transformed by the middleware of the trie (see Options.Middleware)
+func (tr *Trie) Transform(key, value []byte) ([]byte, []byte) {
+	return tr.middleware.Transform(key, value)
+}
+
+// Middleware returns the middleware chain of the trie
+func (tr *Trie) Middleware() MiddlewareChain {
+	return tr.middleware
+}
+
+func (tr *Trie) isDeletion(value []byte) bool {
+	return value == nil || (len(value) == 0 && !tr.nodeStore.allowEmptyValues)
+}
+
+// update updates the trie with the key/value bypassing the middleware
+func (tr *Trie) update(key []byte, value []byte) {
+	tr.mustBeWritable("Update")
+	c := tr.commitToValue(key, value)
 	if c == nil {
 		// nil value means deletion
-		tr.Delete(key)
+		tr.delete(key)
+		return
+	}
+	tr.opLog.update(key, value)
+	tr.updateTerminal(key, c)
+}
+
+// UpdateWithTerminal inserts the key with the terminal commitment computed outside the trie instead of the value,
+// for example the Merkle root or the KZG commitment produced by another system. The trie anchors the external
+// commitment as a leaf: proofs of the key prove the terminal commitment, which is checked by the verifier
+// against the expected one instead of the commitment to the value. Nothing is stored in the value store,
+// so the model must force storing the terminal with the node (see CommitmentModel.ForceStoreTerminalWithNode).
+// Nil terminal means deletion of the key. The key is transformed by the middleware of the trie, if any
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryUpdateWithTerminal)
+func (tr *Trie) UpdateWithTerminal(key []byte, terminal TCommitment) {
+	tr.mustBeWritable("UpdateWithTerminal")
+	key = tr.middleware.TransformKey(key)
+	if terminal == nil {
+		tr.delete(key)
 		return
 	}
+	Assert(tr.nodeStore.reader.m.ForceStoreTerminalWithNode(terminal),
+		"trie::UpdateWithTerminal: terminal commitment must be stored with the node")
+	tr.opLog.updateTerminal(key, terminal)
+	tr.updateTerminal(key, terminal.Clone())
+}
+
+// UpdateReader updates the key with the value of the size read from the reader. The value is streamed through
+// the hasher of the commitment model, which must implement ReaderCommitter, so large values, such as gigabyte blobs,
+// are committed without loading them into memory. The trie does not store values: the caller writes the value
+// to the value store separately. Zero size is the empty value (see Update). Values equal to the key are not
+// detected as key commitments. Streamed values can't be transformed, so the trie must have no middleware
+func (tr *Trie) UpdateReader(key []byte, r io.Reader, size int64) error {
+	if err := tr.checkWritable("UpdateReader"); err != nil {
+		return err
+	}
+	if len(tr.middleware) > 0 {
+		return fmt.Errorf("trie::UpdateReader: values can't be streamed through the middleware")
+	}
+	rc, ok := tr.nodeStore.reader.m.(ReaderCommitter)
+	if !ok {
+		return fmt.Errorf("trie::UpdateReader: commitment model '%s' does not support reading of values",
+			tr.nodeStore.reader.m.ShortName())
+	}
+	if size <= 0 {
+		tr.Update(key, []byte{})
+		return nil
+	}
+	c, err := rc.CommitToDataReader(r, size)
+	if err != nil {
+		return fmt.Errorf("trie::UpdateReader: %w", err)
+	}
+	tr.opLog.updateTerminal(key, c)
+	tr.updateTerminal(key, c)
+	return nil
+}
+
+// updateTerminal inserts or replaces terminal commitment 'c' of the key
+func (tr *Trie) updateTerminal(key []byte, c TCommitment) {
+	tr.nodeStore.recordExpiry(key, 0)
 	// find path in the trie corresponding to the unpackedKey
-	unpackedKey := UnpackBytes(key, tr.nodeStore.arity)
-	proof, lastCommonPrefix, ending := proofPath(tr, unpackedKey)
+	unpackedKey, proof, lastCommonPrefix, ending := tr.keyPath(key)
+	tr.updateTerminalAtPath(key, c, unpackedKey, proof, lastCommonPrefix, ending, 0)
+}
+
+// updateTerminalAtPath inserts or replaces terminal commitment 'c' of the key, given the path to the unpacked key.
+// Links between the first 'marked' elements of the path are known to be marked as modified already
+func (tr *Trie) updateTerminalAtPath(key []byte, c TCommitment, unpackedKey []byte, proof [][]byte, lastCommonPrefix []byte, ending ProofEndingCode, marked int) {
 	if len(proof) == 0 {
+		tr.nodeStore.recordTerminalChange(key, nil, c)
 		tr.newTerminalNode(nil, unpackedKey, c)
 		return
 	}
 	lastKey := proof[len(proof)-1]
 	switch ending {
 	case EndingTerminal:
-		tr.nodeStore.mustGetNode(lastKey).setNewTerminal(c)
+		n := tr.nodeStore.mustGetNode(lastKey)
+		tr.nodeStore.recordTerminalChange(key, n.newTerminal, c)
+		n.setNewTerminal(c)
 
 	case EndingExtend:
 		childIndexPosition := len(lastKey) + len(lastCommonPrefix)
 		Assert(childIndexPosition < len(unpackedKey), "childPosition < len(unpackedKey)")
 		childIndex := unpackedKey[childIndexPosition]
+		tr.nodeStore.recordTerminalChange(key, nil, c)
 		tr.nodeStore.removeKey(unpackedKey[:childIndexPosition+1])
 		tr.newTerminalNode(unpackedKey[:childIndexPosition+1], unpackedKey[childIndexPosition+1:], c)
 		tr.nodeStore.mustGetNode(lastKey).markChildModified(childIndex)
 
 	case EndingSplit:
 		// splitting the node into two path fragments
+		tr.nodeStore.recordTerminalChange(key, nil, c)
 		tr.splitNode(unpackedKey, lastKey, lastCommonPrefix, c)
 
 	default:
 		panic("inconsistency: unknown path ending code")
 	}
-	tr.markModifiedCommitmentsBackToRoot(proof)
+	tr.markModifiedCommitmentsBackToRoot(proof[marked:])
 }
 
 // InsertKeyCommitment inserts unpackedKey/value pair with equal unpackedKey and value.
@@ -205,6 +637,7 @@ func (tr *Trie) Update(key []byte, value []byte) {
 // contained in the unpackedKey.
 // It saves 33 bytes per trie node for use cases such as ledger state commitment via UTXO IDs:
 // each UTXO ID is a commitment to the output, so we only need PoI, not the commitment itself
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryInsertKeyCommitment)
 func (tr *Trie) InsertKeyCommitment(key []byte) {
 	if len(key) == 0 {
 		panic("InsertKeyCommitment: unpackedKey can't be empty")
@@ -254,10 +687,18 @@ func (tr *Trie) splitNode(fullKey, lastKey, commonPrefix []byte, newTerminal TCo
 	}
 }
 
-// Delete deletes Key/value from the Trie, reorganizes the trie
+// Delete deletes Key/value from the Trie, reorganizes the trie. The key is transformed by the middleware of the trie, if any
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryDelete)
 func (tr *Trie) Delete(key []byte) {
-	unpackedKey := UnpackBytes(key, tr.nodeStore.arity)
-	proof, _, ending := proofPath(tr, unpackedKey)
+	tr.delete(tr.middleware.TransformKey(key))
+}
+
+// delete deletes the key bypassing the middleware
+func (tr *Trie) delete(key []byte) {
+	tr.mustBeWritable("Delete")
+	tr.nodeStore.recordExpiry(key, 0)
+	tr.opLog.delete(key)
+	_, proof, _, ending := tr.keyPath(key)
 	if len(proof) == 0 || ending != EndingTerminal {
 		return
 	}
@@ -266,6 +707,7 @@ func (tr *Trie) Delete(key []byte) {
 	if !ok {
 		return
 	}
+	tr.nodeStore.recordTerminalChange(key, lastNode.newTerminal, nil)
 	lastNode.setNewTerminal(nil)
 	reorg, mergeChildIndex := tr.checkReorg(lastNode)
 	switch reorg {
@@ -376,6 +818,7 @@ func (tr *Trie) checkReorg(n *bufferedNode) (reorgStatus, byte) {
 }
 
 // UpdateStr updates unpackedKey/value pair in the trie
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryUpdate)
 func (tr *Trie) UpdateStr(key interface{}, value interface{}) {
 	var k, v []byte
 	if key != nil {
@@ -402,6 +845,7 @@ func (tr *Trie) UpdateStr(key interface{}, value interface{}) {
 }
 
 // DeleteStr removes node from trie
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryDelete)
 func (tr *Trie) DeleteStr(key interface{}) {
 	var k []byte
 	if key != nil {
@@ -435,18 +879,16 @@ func (tr *Trie) VectorCommitmentFromBytes(data []byte) (VCommitment, error) {
 func (tr *Trie) Reconcile(store KVIterator) [][]byte {
 	ret := make([][]byte, 0)
 	store.Iterate(func(k, v []byte) bool {
+		proven := false
 		p, _, ending := proofPath(tr, UnpackBytes(k, tr.PathArity()))
-		if ending == EndingTerminal {
+		if len(p) > 0 && ending == EndingTerminal {
 			lastKey := p[len(p)-1]
-			n, ok := tr.GetNode(lastKey)
-			if !ok {
-				ret = append(ret, k)
-			} else {
-				if !tr.Model().EqualCommitments(tr.nodeStore.reader.m.CommitToData(v), n.Terminal()) {
-					ret = append(ret, k)
-				}
+			if n, ok := tr.GetNode(lastKey); ok {
+				proven = tr.Model().EqualCommitments(tr.commitToValue(k, v), n.Terminal())
 			}
-		} else {
+		}
+		if !proven {
+			tr.log.Warnf("trie: reconcile: key '%x' can't be proven in the trie", k)
 			ret = append(ret, k)
 		}
 		return true
@@ -456,6 +898,7 @@ func (tr *Trie) Reconcile(store KVIterator) [][]byte {
 
 // UpdateAll mass-updates trie from the unpackedKey/value store.
 // To be used to build trie for arbitrary unpackedKey/value data sets
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryUpdateAll)
 func (tr *Trie) UpdateAll(store KVIterator) {
 	store.Iterate(func(k, v []byte) bool {
 		tr.Update(k, v)
@@ -463,6 +906,20 @@ func (tr *Trie) UpdateAll(store KVIterator) {
 	})
 }
 
+// ComputeRoot computes root commitment of the trie which would contain the key/value pairs. The trie is built
+// entirely in memory and nothing is persisted. Keys with empty values are treated as deleted, same as in Update.
+// Optional Options must be the same as of the trie the root is compared with
+func ComputeRoot(model CommitmentModel, pairs KVIterator, opt ...Options) VCommitment {
+	var o Options
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	tr := NewWithOptions(model, NewInMemoryKVStore(), nil, o)
+	tr.UpdateAll(pairs)
+	tr.Commit()
+	return RootCommitment(tr)
+}
+
 func (tr *Trie) DangerouslyDumpCacheToString() string {
 	return tr.nodeStore.dangerouslyDumpCacheToString()
 }
@@ -470,13 +927,18 @@ func (tr *Trie) DangerouslyDumpCacheToString() string {
 // TrieReader implements NodeStore
 var _ NodeStore = &TrieReader{}
 
-func NewTrieReader(model CommitmentModel, trieStore, valueStore KVReader) *TrieReader {
+// NewTrieReader creates the reader of the trie in the store. The optional codec must be the codec of the trie
+// which wrote the store. BinaryCodec by default
+func NewTrieReader(model CommitmentModel, trieStore, valueStore KVReader, codec ...Codec) *TrieReader {
 	return &TrieReader{
-		reader: newNodeStore(trieStore, valueStore, model, model.PathArity()),
+		reader: newNodeStore(trieStore, valueStore, model, model.PathArity(), codecOrDefault(codec...)),
 	}
 }
 
 func (tr *TrieReader) GetNode(unpackedKey []byte) (Node, bool) {
+	if tr.root != nil && len(unpackedKey) == 0 {
+		return tr.root, true
+	}
 	return tr.reader.getNode(unpackedKey)
 }
 
@@ -488,8 +950,12 @@ func (tr *TrieReader) PathArity() PathArity {
 	return tr.reader.arity
 }
 
+// Info returns the human-readable configuration of the reader
 func (tr *TrieReader) Info() string {
-	return fmt.Sprintf("TrieReader ( model: %s, path arity: %s )",
-		tr.reader.m.Description(), tr.reader.arity,
-	)
+	return tr.Stats().String()
+}
+
+// Stats returns the machine-readable configuration of the reader
+func (tr *TrieReader) Stats() *TrieInfo {
+	return newTrieInfo("TrieReader", tr.reader)
 }
@@ -0,0 +1,282 @@
+package trie_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistMutationsDiff(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("persist diff"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range data {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			stats := tr.PersistMutationsWithStats(store)
+			require.EqualValues(t, trie.NumEntries(store), stats.NodesWritten)
+			require.True(t, stats.BytesWritten > 0)
+			total := stats.NodesWritten
+
+			stats = tr.PersistMutationsWithStats(store)
+			require.EqualValues(t, trie.PersistStats{}, stats)
+
+			tr.UpdateStr(data[0], "new value")
+			tr.Commit()
+			stats = tr.PersistMutationsWithStats(store)
+			require.True(t, stats.NodesWritten > 0)
+			require.True(t, stats.NodesWritten < total/10)
+
+			rdr := trie.NewTrieReader(m, store, nil)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr), trie.RootCommitment(rdr)))
+		})
+		t.Run("mutation set"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:1000]
+			store1 := trie.NewInMemoryKVStore()
+			tr1 := trie.New(m, store1, nil)
+			store2 := trie.NewInMemoryKVStore()
+			tr2 := trie.New(m, store2, nil)
+			for _, s := range data {
+				tr1.UpdateStr(s, s+"$")
+				tr2.UpdateStr(s, s+"$")
+			}
+			tr1.Commit()
+			tr2.Commit()
+			tr1.PersistMutations(store1)
+			mutations, _ := tr2.MutationSet()
+			for _, mut := range mutations {
+				store2.Set(mut.Key, mut.Value)
+			}
+			require.EqualValues(t, trie.NumEntries(store1), trie.NumEntries(store2))
+
+			for _, s := range data[:100] {
+				tr1.DeleteStr(s)
+				tr2.DeleteStr(s)
+			}
+			tr1.Commit()
+			tr2.Commit()
+			tr1.PersistMutations(store1)
+			mutations, stats := tr2.MutationSet()
+			require.EqualValues(t, stats.NodesWritten+stats.NodesDeleted, len(mutations))
+			require.True(t, stats.NodesDeleted > 0)
+			for i := range mutations {
+				if i > 0 {
+					require.True(t, bytes.Compare(mutations[i-1].Key, mutations[i].Key) < 0)
+				}
+				store2.Set(mutations[i].Key, mutations[i].Value)
+			}
+			require.EqualValues(t, trie.NumEntries(store1), trie.NumEntries(store2))
+
+			mutations, _ = tr2.MutationSet()
+			require.EqualValues(t, 0, len(mutations))
+
+			rdr1 := trie.NewTrieReader(m, store1, nil)
+			rdr2 := trie.NewTrieReader(m, store2, nil)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(rdr1), trie.RootCommitment(rdr2)))
+		})
+		t.Run("mutation set with indexes"+tn(m), func(t *testing.T) {
+			data := genData2()[:300]
+			start := time.Unix(1_700_000_000, 0)
+			store := trie.NewInMemoryKVStore()
+			digestIndex := trie.NewInMemoryKVStore()
+			expiryIndex := trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, nil, trie.Options{DigestIndex: digestIndex, ExpiryIndex: expiryIndex})
+			apply := func(store trie.KVWriter, mutations []trie.NodeMutation) {
+				for _, mut := range mutations {
+					store.Set(mut.Key, mut.Value)
+				}
+			}
+			for i, s := range data {
+				tr.UpdateWithExpiry([]byte(s), []byte("value"), start.Add(time.Duration(i)*time.Second))
+			}
+			tr.Commit()
+			nodes, indexes, stats := tr.MutationSetWithIndexes()
+			// nothing is written until mutations are applied
+			require.EqualValues(t, 0, trie.NumEntries(store))
+			require.EqualValues(t, 0, trie.NumEntries(digestIndex))
+			require.EqualValues(t, 0, trie.NumEntries(expiryIndex))
+			require.EqualValues(t, stats.NodesWritten, len(nodes))
+			require.EqualValues(t, stats.DigestIndexUpdates, len(indexes.Digest))
+			require.EqualValues(t, stats.ExpiryIndexUpdates, len(indexes.Expiry))
+			require.EqualValues(t, len(data), len(indexes.Digest))
+			apply(store, nodes)
+			apply(digestIndex, indexes.Digest)
+			apply(expiryIndex, indexes.Expiry)
+			require.EqualValues(t, len(data), len(trie.KeysByTerminal(digestIndex, m.CommitToData([]byte("value")))))
+
+			// previous index entries are replaced
+			for _, s := range data[:100] {
+				tr.UpdateStr(s, "new value")
+			}
+			tr.Commit()
+			nodes, indexes, _ = tr.MutationSetWithIndexes()
+			apply(store, nodes)
+			apply(digestIndex, indexes.Digest)
+			apply(expiryIndex, indexes.Expiry)
+			require.EqualValues(t, 100, len(trie.KeysByTerminal(digestIndex, m.CommitToData([]byte("new value")))))
+			require.EqualValues(t, len(data)-100, len(trie.KeysByTerminal(digestIndex, m.CommitToData([]byte("value")))))
+			for i, s := range data {
+				_, ok := tr.Expiry([]byte(s))
+				require.EqualValues(t, i >= 100, ok)
+			}
+			rdr := trie.NewTrieReader(m, store, nil)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr), trie.RootCommitment(rdr)))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}
+
+func TestComputeRoot(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("compute root"+tn(m), func(t *testing.T) {
+			require.Nil(t, trie.ComputeRoot(m, trie.NewInMemoryKVStore()))
+
+			data := genRnd4()[:1000]
+			pairs := trie.NewInMemoryKVStore()
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, nil)
+			for _, s := range data {
+				pairs.Set([]byte(s), []byte(s+"$"))
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(tr), trie.ComputeRoot(m, pairs)))
+			require.EqualValues(t, 0, trie.NumEntries(store))
+
+			trOpt := trie.NewWithOptions(m, trie.NewInMemoryKVStore(), nil, trie.Options{OptimizeKeyCommitments: true})
+			for _, s := range data {
+				trOpt.UpdateStr(s, s)
+				pairs.Set([]byte(s), []byte(s))
+			}
+			trOpt.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(trOpt),
+				trie.ComputeRoot(m, pairs, trie.Options{OptimizeKeyCommitments: true})))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+	runTest(t, trie_kzg_bn256.New())
+}
+
+func TestUpdateReader(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("update reader"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:200]
+			sizes := []int64{1, 20, 21, 1000, 1 << 20}
+			valueStore := trie.NewInMemoryKVStore()
+			tr := trie.New(m, trie.NewInMemoryKVStore(), valueStore)
+			reference := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for i, s := range data {
+				size := sizes[i%len(sizes)]
+				require.NoError(t, tr.UpdateReader([]byte(s), &patternReader{size: size}, size))
+				value, err := io.ReadAll(&patternReader{size: size})
+				require.NoError(t, err)
+				reference.Update([]byte(s), value)
+				valueStore.Set([]byte(s), value)
+			}
+			tr.Commit()
+			reference.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(reference), trie.RootCommitment(tr)))
+
+			// zero size deletes the key
+			for _, s := range data {
+				require.NoError(t, tr.UpdateReader([]byte(s), &patternReader{}, 0))
+			}
+			tr.Commit()
+			require.Nil(t, trie.RootCommitment(tr))
+
+			require.Error(t, tr.UpdateReader([]byte("short"), &patternReader{size: 100}, 1000))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256, 100))
+	runTest(t, trie_blake2b.NewWithParams(trie.PathArity2, trie_blake2b.HashSize192, trie_blake2b.Params{Personalization: []byte("p")}))
+
+	tr := trie.New(trie_kzg_bn256.New(), trie.NewInMemoryKVStore(), nil)
+	require.Error(t, tr.UpdateReader([]byte("a"), &patternReader{size: 10}, 10))
+}
+
+// failingModel is the commitment model which panics in UpdateNodeCommitment after the number of calls
+type failingModel struct {
+	trie.CommitmentModel
+	failAfter int
+}
+
+func (m *failingModel) UpdateNodeCommitment(mutate *trie.NodeData, childUpdates map[byte]trie.VCommitment, calcDelta bool, terminal trie.TCommitment, update *trie.VCommitment) {
+	if m.failAfter == 0 {
+		panic("model failure")
+	}
+	m.failAfter--
+	m.CommitmentModel.UpdateNodeCommitment(mutate, childUpdates, calcDelta, terminal, update)
+}
+
+func TestTryCommit(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("try commit"+tn(m), func(t *testing.T) {
+			data := genRnd4()[:300]
+			fm := &failingModel{CommitmentModel: m, failAfter: -1}
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(fm, store, nil)
+			trRef := trie.New(m, trie.NewInMemoryKVStore(), nil)
+			for _, s := range data[:150] {
+				tr.UpdateStr(s, s+"-1")
+				trRef.UpdateStr(s, s+"-1")
+			}
+			_, err := tr.TryCommit()
+			require.NoError(t, err)
+			trRef.Commit()
+			root1 := trie.RootCommitment(tr)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(trRef), root1))
+			tr.PersistMutations(store)
+
+			for i, s := range data {
+				if i%4 == 0 {
+					tr.DeleteStr(s)
+					trRef.DeleteStr(s)
+				} else {
+					tr.UpdateStr(s, s+"-2")
+					trRef.UpdateStr(s, s+"-2")
+				}
+			}
+			// the commit fails in the middle and is rolled back
+			uncommitted := trie.RootCommitment(tr)
+			require.False(t, m.EqualCommitments(root1, uncommitted))
+			fm.failAfter = 10
+			_, err = tr.TryCommit()
+			require.Error(t, err)
+			require.True(t, m.EqualCommitments(uncommitted, trie.RootCommitment(tr)))
+			fm.failAfter = 0
+			require.Panics(t, func() {
+				tr.Commit()
+			})
+			require.True(t, m.EqualCommitments(uncommitted, trie.RootCommitment(tr)))
+
+			// updates remain uncommitted and are committed by the next successful commit
+			fm.failAfter = -1
+			stats, err := tr.TryCommit()
+			require.NoError(t, err)
+			require.True(t, stats.NodesCommitted > 10)
+			trRef.Commit()
+			require.True(t, m.EqualCommitments(trie.RootCommitment(trRef), trie.RootCommitment(tr)))
+			tr.PersistMutations(store)
+			trFresh := trie.New(m, store, nil)
+			require.True(t, m.EqualCommitments(trie.RootCommitment(trRef), trie.RootCommitment(trFresh)))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -2,12 +2,12 @@ package trie
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"math"
-	"os"
 	"reflect"
 
 	"golang.org/x/crypto/blake2b"
@@ -28,13 +28,23 @@ func CheckNils(i1, i2 interface{}) (bool, bool) {
 	return false, false
 }
 
-// MustBytes most common way of serialization
+// Bytes serializes the object into the buffer from the pool (see SetBufferPool)
+func Bytes(o interface{ Write(w io.Writer) error }) ([]byte, error) {
+	buf := getBuffer()
+	if err := o.Write(buf); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return putBuffer(buf), nil
+}
+
+// MustBytes most common way of serialization. It is Bytes which panics on error
 func MustBytes(o interface{ Write(w io.Writer) error }) []byte {
-	var buf bytes.Buffer
-	if err := o.Write(&buf); err != nil {
+	ret, err := Bytes(o)
+	if err != nil {
 		panic(err)
 	}
-	return buf.Bytes()
+	return ret
 }
 
 // byteCounter simple byte counter as io.Writer
@@ -112,25 +122,11 @@ func NumEntries(s KVIterator) int {
 }
 
 // DumpToFile serializes iterator to the file in binary form.
-// The content of the file in general is non-deterministic due to the random order of iteration
+// The content of the file in general is non-deterministic due to the random order of iteration.
+// See DumpToFileWithOptions for progress reporting and cancellation
 func DumpToFile(r KVIterator, fname string) (int, error) {
-	file, err := os.Create(fname)
-	if err != nil {
-		return 0, err
-	}
-	defer func() { _ = file.Close() }()
-
-	var bytesTotal int
-	r.Iterate(func(k, v []byte) bool {
-		n, errw := writeKV(file, k, v)
-		if errw != nil {
-			err = errw
-			return false
-		}
-		bytesTotal += n
-		return true
-	})
-	return bytesTotal, err
+	progress, err := DumpToFileWithOptions(context.Background(), r, fname)
+	return progress.Bytes, err
 }
 
 func DangerouslyDumpToConsole(title string, r KVIterator) {
@@ -143,25 +139,11 @@ func DangerouslyDumpToConsole(title string, r KVIterator) {
 	})
 }
 
-// UnDumpFromFile restores dumped set of key/value pairs into the key/value writer
+// UnDumpFromFile restores dumped set of key/value pairs into the key/value writer.
+// See UnDumpFromFileWithOptions for progress reporting, cancellation and verification of the root
 func UnDumpFromFile(w KVWriter, fname string) (int, error) {
-	file, err := os.Open(fname)
-	if err != nil {
-		return 0, err
-	}
-	defer func() { _ = file.Close() }()
-
-	var k, v []byte
-	var exit bool
-	n := 0
-	for {
-		if k, v, exit = readKV(file); exit {
-			break
-		}
-		n += len(k) + len(v) + 6
-		w.Set(k, v)
-	}
-	return n, nil
+	progress, err := UnDumpFromFileWithOptions(context.Background(), w, fname)
+	return progress.Bytes, err
 }
 
 // writeKV serializes key/value pair into the io.Writer. 2 and 4 little endian bytes for respectively key length and value length
@@ -175,23 +157,35 @@ func writeKV(w io.Writer, k, v []byte) (int, error) {
 	return len(k) + len(v) + 6, nil
 }
 
-// readKV deserializes key/value pair from io.Reader. Returns key/value pair and an error flag if not enough data
-func readKV(r io.Reader) ([]byte, []byte, bool) {
-	k, err := ReadBytes16(r)
-	if errors.Is(err, io.EOF) {
-		return nil, nil, true
+// ---------------------------------------------------------------------------
+// r/w utility functions
+// TODO rewrite with generics when switch to Go 1.18
+// Readers never panic on malformed data: short data is io.ErrUnexpectedEOF, and memory for data of the declared
+// length is allocated as the data is read, so huge declared lengths of short inputs do not exhaust memory
+
+// maxPreallocSize is the maximum size of the buffer allocated ahead of reading data of the declared length
+const maxPreallocSize = 1 << 16
+
+// readExact reads exactly 'length' bytes
+func readExact(r io.Reader, length int) ([]byte, error) {
+	if length <= maxPreallocSize {
+		ret := make([]byte, length)
+		if _, err := io.ReadFull(r, ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
 	}
-	v, err := ReadBytes32(r)
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, int64(length))
 	if err != nil {
-		panic(err)
+		if err == io.EOF && n < int64(length) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
 	}
-	return k, v, false
+	return buf.Bytes(), nil
 }
 
-// ---------------------------------------------------------------------------
-// r/w utility functions
-// TODO rewrite with generics when switch to Go 1.18
-
 func ReadBytes8(r io.Reader) ([]byte, error) {
 	length, err := ReadByte(r)
 	if err != nil {
@@ -200,12 +194,7 @@ func ReadBytes8(r io.Reader) ([]byte, error) {
 	if length == 0 {
 		return []byte{}, nil
 	}
-	ret := make([]byte, length)
-	_, err = r.Read(ret)
-	if err != nil {
-		return nil, err
-	}
-	return ret, nil
+	return readExact(r, int(length))
 }
 
 func WriteBytes8(w io.Writer, data []byte) error {
@@ -231,12 +220,7 @@ func ReadBytes16(r io.Reader) ([]byte, error) {
 	if length == 0 {
 		return []byte{}, nil
 	}
-	ret := make([]byte, length)
-	_, err = r.Read(ret)
-	if err != nil {
-		return nil, err
-	}
-	return ret, nil
+	return readExact(r, int(length))
 }
 
 func WriteBytes16(w io.Writer, data []byte) error {
@@ -255,7 +239,7 @@ func WriteBytes16(w io.Writer, data []byte) error {
 
 func ReadUint16(r io.Reader, pval *uint16) error {
 	var tmp2 [2]byte
-	_, err := r.Read(tmp2[:])
+	_, err := io.ReadFull(r, tmp2[:])
 	if err != nil {
 		return err
 	}
@@ -283,7 +267,7 @@ func Uint16From2Bytes(b []byte) (uint16, error) {
 
 func ReadByte(r io.Reader) (byte, error) {
 	var b [1]byte
-	_, err := r.Read(b[:])
+	_, err := io.ReadFull(r, b[:])
 	if err != nil {
 		return 0, err
 	}
@@ -305,12 +289,7 @@ func ReadBytes32(r io.Reader) ([]byte, error) {
 	if length == 0 {
 		return []byte{}, nil
 	}
-	ret := make([]byte, length)
-	_, err = r.Read(ret)
-	if err != nil {
-		return nil, err
-	}
-	return ret, nil
+	return readExact(r, int(length))
 }
 
 func WriteBytes32(w io.Writer, data []byte) error {
@@ -348,7 +327,7 @@ func MustUint32From4Bytes(b []byte) uint32 {
 
 func ReadUint32(r io.Reader, pval *uint32) error {
 	var tmp4 [4]byte
-	_, err := r.Read(tmp4[:])
+	_, err := io.ReadFull(r, tmp4[:])
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,205 @@
+package trie
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// RootReport is the result of VerifyRoot
+type RootReport struct {
+	// Paths is the number of sampled leaf-to-root paths
+	Paths int
+	// NodesVerified is the number of distinct nodes the commitment of which was recomputed
+	NodesVerified int
+	// EstimatedLeaves is the estimate of the number of leaves (nodes without children) of the trie.
+	// It is the mean of products of branching factors along sampled paths (Knuth's estimator)
+	EstimatedLeaves float64
+	// Corrupted are unpacked keys of nodes which are missing, can't be decoded or do not match the commitment
+	// of their parent (of the root for the root node). Sampling of the path stops at the corrupted node
+	Corrupted [][]byte
+	// Duration of the verification
+	Duration time.Duration
+}
+
+// OK returns true if no corrupted nodes were found
+func (r *RootReport) OK() bool {
+	return len(r.Corrupted) == 0
+}
+
+// Confidence returns the probability that the check would detect corruption of the given fraction of leaf-to-root paths.
+// Paths are sampled by random descent, i.e. not exactly uniformly, so it is an approximation
+func (r *RootReport) Confidence(corruptedFraction float64) float64 {
+	if corruptedFraction <= 0 {
+		return 0
+	}
+	if corruptedFraction >= 1 {
+		if r.Paths > 0 {
+			return 1
+		}
+		return 0
+	}
+	return 1 - math.Pow(1-corruptedFraction, float64(r.Paths))
+}
+
+func (r *RootReport) String() string {
+	return fmt.Sprintf("root check: paths: %d, nodes verified: %d, estimated leaves: %.0f, corrupted nodes: %d, duration: %v, confidence(1%%): %.4f",
+		r.Paths, r.NodesVerified, r.EstimatedLeaves, len(r.Corrupted), r.Duration, r.Confidence(0.01))
+}
+
+// VerifyRoot is the light audit of the trie in the store against the root commitment. It re-verifies the random sample
+// of leaf-to-root paths: each path is a random descent from the root, commitments of nodes along it are recomputed
+// from node data and compared with commitments stored in their parents. Paths are sampled until their number reaches
+// sampleRate (0 < sampleRate <= 1) times the estimated number of leaves, at least one path.
+// The value store may be nil. It is required if terminal commitments are not stored with nodes: values of such terminals
+// are read and committed, so they are verified too. The optional codec is the serialization of nodes, BinaryCodec
+// by default, as in NewTrieReader.
+// Corrupted nodes are reported in RootReport. The error is returned only for wrong parameters
+func VerifyRoot(store KVReader, model CommitmentModel, root VCommitment, sampleRate float64, valueStore KVReader, codec ...Codec) (*RootReport, error) {
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("trie::VerifyRoot: sample rate must be in (0, 1], got %v", sampleRate)
+	}
+	v := &rootVerifier{
+		store:    store,
+		values:   valueStore,
+		codec:    codecOrDefault(codec...),
+		model:    model,
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		verified: make(map[string]Node),
+		report:   &RootReport{},
+	}
+	start := time.Now()
+	var sumEstimates float64
+	for {
+		estimate, ok := v.samplePath(root)
+		v.report.Paths++
+		if !ok {
+			// the root node is corrupted or absent. Nothing else can be sampled
+			break
+		}
+		sumEstimates += estimate
+		v.report.EstimatedLeaves = sumEstimates / float64(v.report.Paths)
+		if float64(v.report.Paths) >= sampleRate*v.report.EstimatedLeaves {
+			break
+		}
+	}
+	v.report.NodesVerified = len(v.verified)
+	v.report.Duration = time.Since(start)
+	return v.report, nil
+}
+
+type rootVerifier struct {
+	store    KVReader
+	values   KVReader
+	codec    Codec
+	model    CommitmentModel
+	rnd      *rand.Rand
+	verified map[string]Node
+	report   *RootReport
+}
+
+// samplePath verifies the random path from the root to a leaf. Returns the product of branching factors along the path.
+// Returns false if the path could not be sampled at all, i.e. the root node is corrupted or the trie is empty
+func (v *rootVerifier) samplePath(root VCommitment) (float64, bool) {
+	if root == nil {
+		if encodedKey, err := EncodeUnpackedBytes(nil, v.model.PathArity()); err == nil && len(v.store.Get(encodedKey)) != 0 {
+			v.corrupted(nil)
+		}
+		return 0, false
+	}
+	n, ok := v.verifyNode(nil, root)
+	if !ok {
+		return 0, false
+	}
+	estimate := 1.0
+	for {
+		children := n.ChildCommitments()
+		if len(children) == 0 {
+			return estimate, true
+		}
+		estimate *= float64(len(children))
+		indices := make([]byte, 0, len(children))
+		for i := range children {
+			indices = append(indices, i)
+		}
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+		idx := indices[v.rnd.Intn(len(indices))]
+		if n, ok = v.verifyNode(childKey(n, idx), children[idx]); !ok {
+			return estimate, true
+		}
+	}
+}
+
+// verifyNode reads the node and checks its commitment. Verified nodes are not read again
+func (v *rootVerifier) verifyNode(unpackedKey []byte, expected VCommitment) (Node, bool) {
+	if n, ok := v.verified[string(unpackedKey)]; ok {
+		return n, true
+	}
+	n, ok := v.readNode(unpackedKey)
+	if !ok || !v.model.EqualCommitments(nodeCommitment(v.model, n), expected) {
+		v.corrupted(unpackedKey)
+		return nil, false
+	}
+	v.verified[string(unpackedKey)] = n
+	return n, true
+}
+
+// verifyAll verifies all nodes of the trie against the root commitment, depth first: the commitment of each node
+// is recomputed from its data and compared with the child commitment of its parent. Nodes are not kept in memory.
+// Corrupted nodes are reported, their subtrees are not visited
+func verifyAll(store KVReader, model CommitmentModel, root VCommitment, valueStore KVReader, codec ...Codec) *RootReport {
+	v := &rootVerifier{
+		store:  store,
+		values: valueStore,
+		codec:  codecOrDefault(codec...),
+		model:  model,
+		report: &RootReport{},
+	}
+	start := time.Now()
+	if root == nil {
+		v.samplePath(nil)
+	} else {
+		v.verifySubtree(nil, root)
+	}
+	v.report.Duration = time.Since(start)
+	return v.report
+}
+
+func (v *rootVerifier) verifySubtree(unpackedKey []byte, expected VCommitment) {
+	n, ok := v.readNode(unpackedKey)
+	if !ok || !v.model.EqualCommitments(nodeCommitment(v.model, n), expected) {
+		v.corrupted(unpackedKey)
+		return
+	}
+	v.report.NodesVerified++
+	for i, c := range n.ChildCommitments() {
+		v.verifySubtree(childKey(n, i), c)
+	}
+}
+
+func (v *rootVerifier) readNode(unpackedKey []byte) (Node, bool) {
+	encodedKey, err := EncodeUnpackedBytes(unpackedKey, v.model.PathArity())
+	if err != nil {
+		return nil, false
+	}
+	nodeBin := v.store.Get(encodedKey)
+	if len(nodeBin) == 0 {
+		return nil, false
+	}
+	n, err := nodeReadOnlyFromBytes(v.codec, v.model, nodeBin, unpackedKey, v.model.PathArity(), v.values)
+	if err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+func (v *rootVerifier) corrupted(unpackedKey []byte) {
+	for _, k := range v.report.Corrupted {
+		if string(k) == string(unpackedKey) {
+			return
+		}
+	}
+	v.report.Corrupted = append(v.report.Corrupted, Concat(unpackedKey))
+}
@@ -0,0 +1,108 @@
+package trie_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/models/trie_kzg_bn256"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyRoot(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		t.Run("verify root"+tn(m), func(t *testing.T) {
+			_, err := trie.VerifyRoot(trie.NewInMemoryKVStore(), m, nil, 0, nil)
+			require.Error(t, err)
+			report, err := trie.VerifyRoot(trie.NewInMemoryKVStore(), m, nil, 1, nil)
+			require.NoError(t, err)
+			require.True(t, report.OK())
+
+			store, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			tr := trie.New(m, store, valueStore)
+			for _, s := range genRnd4()[:500] {
+				tr.UpdateStr(s, s+"-value")
+				valueStore.Set([]byte(s), []byte(s+"-value"))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			root := trie.RootCommitment(tr)
+
+			full, err := trie.VerifyRoot(store, m, root, 1, valueStore)
+			require.NoError(t, err)
+			require.True(t, full.OK(), full.String())
+			require.True(t, full.Paths > 0)
+			require.True(t, full.EstimatedLeaves > 0)
+			require.True(t, full.NodesVerified > 0)
+
+			light, err := trie.VerifyRoot(store, m, root, 0.05, valueStore)
+			require.NoError(t, err)
+			require.True(t, light.OK(), light.String())
+			require.True(t, light.Paths <= full.Paths)
+			require.True(t, light.Confidence(0.5) > 0 && light.Confidence(0.5) < full.Confidence(0.5)+1e-9)
+
+			// wrong root
+			report, err = trie.VerifyRoot(store, m, m.NewVectorCommitment(), 0.05, valueStore)
+			require.NoError(t, err)
+			require.False(t, report.OK())
+			require.EqualValues(t, 1, len(report.Corrupted))
+			require.EqualValues(t, 0, len(report.Corrupted[0]))
+
+			// the node below the root is replaced with another node
+			rootKey, err := trie.EncodeUnpackedBytes(nil, m.PathArity())
+			require.NoError(t, err)
+			// the child of the root is on the path of many samples, while deep nodes may be not sampled at all
+			var below []byte
+			store.Iterate(func(k, _ []byte) bool {
+				if bytes.Equal(k, rootKey) {
+					return true
+				}
+				unpacked, err := trie.DecodeToUnpackedBytes(k, m.PathArity())
+				require.NoError(t, err)
+				if below == nil || len(unpacked) < len(below) {
+					below = unpacked
+				}
+				return true
+			})
+			require.NotNil(t, below)
+			belowKey, err := trie.EncodeUnpackedBytes(below, m.PathArity())
+			require.NoError(t, err)
+			// the record of the root node can't match the commitment of any other node. Records of other nodes
+			// may decode to the same node, because terminals are read from the value store
+			store.Set(belowKey, store.Get(rootKey))
+			for i := 0; ; i++ {
+				require.True(t, i < 100, "corruption not detected")
+				report, err = trie.VerifyRoot(store, m, root, 1, valueStore)
+				require.NoError(t, err)
+				if !report.OK() {
+					break
+				}
+			}
+		})
+		t.Run("verify root cbor"+tn(m), func(t *testing.T) {
+			store, valueStore := trie.NewInMemoryKVStore(), trie.NewInMemoryKVStore()
+			tr := trie.NewWithOptions(m, store, valueStore, trie.Options{Codec: trie.CBORCodec})
+			for _, s := range genRnd4()[:500] {
+				tr.UpdateStr(s, s+"-value")
+				valueStore.Set([]byte(s), []byte(s+"-value"))
+			}
+			tr.Commit()
+			tr.PersistMutations(store)
+			root := trie.RootCommitment(tr)
+
+			report, err := trie.VerifyRoot(store, m, root, 1, valueStore, trie.CBORCodec)
+			require.NoError(t, err)
+			require.True(t, report.OK(), report.String())
+			require.True(t, report.NodesVerified > 1)
+			// nodes are not decoded with the wrong codec
+			report, err = trie.VerifyRoot(store, m, root, 1, valueStore)
+			require.NoError(t, err)
+			require.False(t, report.OK())
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize256, 10))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize256))
+	runTest(t, trie_kzg_bn256.New())
+}
@@ -0,0 +1,127 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrCorruptedJournal is returned by Recover when the sealed journal is torn or corrupted
+var ErrCorruptedJournal = errors.New("trie: corrupted WAL journal")
+
+// WAL is a write-ahead log of the node mutations. It makes transition of the trie from one root to another
+// atomic on key/value stores which do not support atomic batches.
+// The mutation set is first journaled into the separate store (for example, the metadata partition of the StoreLayout),
+// then the journal is sealed and only then the mutations are applied to the trie store.
+// After a crash, Recover replays the sealed journal or discards the unsealed one, so the trie store always ends
+// up in one of the two consistent states
+type WAL struct {
+	journal KVStore
+}
+
+var (
+	walSealKey     = []byte{0x00}
+	walEntryPrefix = []byte{0x01}
+)
+
+// NewWAL creates the write-ahead log on top of the journal store
+func NewWAL(journal KVStore) *WAL {
+	return &WAL{journal: journal}
+}
+
+func walEntryKey(i uint32) []byte {
+	return Concat(walEntryPrefix, Uint32To4Bytes(i))
+}
+
+// Apply journals mutations, seals the journal, applies mutations to the store and clears the journal.
+// The journal must be recovered before (see Recover)
+func (w *WAL) Apply(store KVWriter, mutations []NodeMutation) {
+	Assert(!w.journal.Has(walSealKey), "trie::WAL.Apply: journal contains sealed mutations which must be recovered first")
+	for i := range mutations {
+		buf := getBuffer()
+		err := NewBinaryStreamWriter(buf).Write(mutations[i].Key, mutations[i].Value)
+		Assert(err == nil, "trie::WAL.Apply: %v", err)
+		w.journal.Set(walEntryKey(uint32(i)), putBuffer(buf))
+	}
+	w.journal.Set(walSealKey, Uint32To4Bytes(uint32(len(mutations))))
+	for i := range mutations {
+		store.Set(mutations[i].Key, mutations[i].Value)
+	}
+	w.clear(len(mutations))
+}
+
+// Recover brings the store into the consistent state after the crash. If the journal is sealed, the mutations are
+// replayed (rolled forward). Otherwise, the incomplete journal is discarded (rolled back), because the store was not
+// touched yet. Returns number of replayed mutations. The error wrapping ErrCorruptedJournal is returned if the seal
+// or entries of the sealed journal are torn, then the store is not touched. The number of mutations in the seal
+// is not trusted: the mutation set grows with entries actually read from the journal
+func (w *WAL) Recover(store KVWriter) (int, error) {
+	seal := w.journal.Get(walSealKey)
+	if seal == nil {
+		w.discard()
+		return 0, nil
+	}
+	n, err := Uint32From4Bytes(seal)
+	if err != nil {
+		return 0, fmt.Errorf("trie::WAL.Recover: wrong seal: %v: %w", err, ErrCorruptedJournal)
+	}
+	mutations := make([]NodeMutation, 0)
+	for i := uint32(0); i < n; i++ {
+		data := w.journal.Get(walEntryKey(i))
+		if data == nil {
+			return 0, fmt.Errorf("trie::WAL.Recover: missing journal entry #%d of %d: %w", i, n, ErrCorruptedJournal)
+		}
+		var m NodeMutation
+		read := false
+		err = NewBinaryStreamIterator(bytes.NewReader(data)).Iterate(func(k, v []byte) bool {
+			m.Key = k
+			if len(v) > 0 {
+				m.Value = v
+			}
+			read = true
+			return false
+		})
+		if err == nil && !read {
+			err = errors.New("empty entry")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("trie::WAL.Recover: wrong journal entry #%d: %v: %w", i, err, ErrCorruptedJournal)
+		}
+		mutations = append(mutations, m)
+	}
+	for i := range mutations {
+		store.Set(mutations[i].Key, mutations[i].Value)
+	}
+	w.clear(len(mutations))
+	return len(mutations), nil
+}
+
+// clear removes the sealed journal. The seal is removed first
+func (w *WAL) clear(n int) {
+	w.journal.Set(walSealKey, nil)
+	for i := 0; i < n; i++ {
+		w.journal.Set(walEntryKey(uint32(i)), nil)
+	}
+}
+
+// discard removes entries of the unsealed journal
+func (w *WAL) discard() {
+	keys := make([][]byte, 0)
+	w.journal.Iterate(func(k, _ []byte) bool {
+		if bytes.HasPrefix(k, walEntryPrefix) {
+			keys = append(keys, Concat(k))
+		}
+		return true
+	})
+	for _, k := range keys {
+		w.journal.Set(k, nil)
+	}
+}
+
+// PersistMutationsWAL persists the cache to the store through the write-ahead log
+// Panics with the error wrapping ErrReadOnly in the read-only mode (see TryPersistMutationsWAL)
+func (tr *Trie) PersistMutationsWAL(store KVWriter, wal *WAL) PersistStats {
+	mutations, stats := tr.MutationSet()
+	wal.Apply(store, mutations)
+	return stats
+}
@@ -0,0 +1,113 @@
+package trie_test
+
+import (
+	"testing"
+
+	"github.com/iotaledger/trie.go/models/trie_blake2b"
+	"github.com/iotaledger/trie.go/trie"
+	"github.com/stretchr/testify/require"
+)
+
+// crashingKVStore panics after the given number of writes
+type crashingKVStore struct {
+	trie.KVStore
+	writesLeft int
+}
+
+func (s *crashingKVStore) Set(key, value []byte) {
+	if s.writesLeft == 0 {
+		panic("crash")
+	}
+	s.writesLeft--
+	s.KVStore.Set(key, value)
+}
+
+func TestWAL(t *testing.T) {
+	runTest := func(t *testing.T, m trie.CommitmentModel) {
+		data := genRnd4()[:1000]
+		layout := trie.DefaultStoreLayout
+		initState := func() (trie.KVStore, *trie.Trie, trie.VCommitment, trie.VCommitment) {
+			store := trie.NewInMemoryKVStore()
+			tr := trie.New(m, layout.NodeStore(store), nil)
+			for _, s := range data[:500] {
+				tr.UpdateStr(s, s+"$")
+			}
+			tr.Commit()
+			tr.PersistMutationsWAL(layout.NodeStore(store), trie.NewWAL(layout.MetadataStore(store)))
+			rootBefore := trie.RootCommitment(tr)
+			for _, s := range data[500:] {
+				tr.UpdateStr(s, s+"$")
+			}
+			for _, s := range data[:100] {
+				tr.DeleteStr(s)
+			}
+			tr.Commit()
+			return store, tr, rootBefore, trie.RootCommitment(tr)
+		}
+		rootOf := func(store trie.KVStore) trie.VCommitment {
+			return trie.RootCommitment(trie.NewTrieReader(m, layout.NodeStore(store), nil))
+		}
+		crash := func(f func()) {
+			defer func() {
+				require.EqualValues(t, "crash", recover())
+			}()
+			f()
+		}
+		t.Run("no crash"+tn(m), func(t *testing.T) {
+			store, tr, _, rootAfter := initState()
+			tr.PersistMutationsWAL(layout.NodeStore(store), trie.NewWAL(layout.MetadataStore(store)))
+			require.True(t, m.EqualCommitments(rootAfter, rootOf(store)))
+			require.EqualValues(t, 0, trie.NumEntries(layout.MetadataStore(store)))
+			n, err := trie.NewWAL(layout.MetadataStore(store)).Recover(layout.NodeStore(store))
+			require.NoError(t, err)
+			require.EqualValues(t, 0, n)
+		})
+		t.Run("crash while journaling"+tn(m), func(t *testing.T) {
+			store, tr, rootBefore, _ := initState()
+			crashing := &crashingKVStore{KVStore: store, writesLeft: 50}
+			crash(func() {
+				tr.PersistMutationsWAL(layout.NodeStore(crashing), trie.NewWAL(layout.MetadataStore(crashing)))
+			})
+			require.True(t, trie.NumEntries(layout.MetadataStore(store)) > 0)
+			n, err := trie.NewWAL(layout.MetadataStore(store)).Recover(layout.NodeStore(store))
+			require.NoError(t, err)
+			require.EqualValues(t, 0, n)
+			require.EqualValues(t, 0, trie.NumEntries(layout.MetadataStore(store)))
+			require.True(t, m.EqualCommitments(rootBefore, rootOf(store)))
+		})
+		t.Run("crash while applying"+tn(m), func(t *testing.T) {
+			store, tr, _, rootAfter := initState()
+			mutations, _ := tr.MutationSet()
+			crashing := &crashingKVStore{KVStore: store, writesLeft: len(mutations) + 1 + len(mutations)/2}
+			crash(func() {
+				trie.NewWAL(layout.MetadataStore(crashing)).Apply(layout.NodeStore(crashing), mutations)
+			})
+			n, err := trie.NewWAL(layout.MetadataStore(store)).Recover(layout.NodeStore(store))
+			require.NoError(t, err)
+			require.EqualValues(t, len(mutations), n)
+			require.EqualValues(t, 0, trie.NumEntries(layout.MetadataStore(store)))
+			require.True(t, m.EqualCommitments(rootAfter, rootOf(store)))
+		})
+		t.Run("corrupted seal"+tn(m), func(t *testing.T) {
+			store, tr, _, _ := initState()
+			mutations, _ := tr.MutationSet()
+			crashing := &crashingKVStore{KVStore: store, writesLeft: len(mutations) + 1}
+			crash(func() {
+				trie.NewWAL(layout.MetadataStore(crashing)).Apply(layout.NodeStore(crashing), mutations)
+			})
+			nodesBefore := storeContents(layout.NodeStore(store))
+			journal := layout.MetadataStore(store)
+			// the torn seal claims a huge number of entries
+			journal.Set([]byte{0x00}, []byte{0xff, 0xff, 0xff, 0xff})
+			_, err := trie.NewWAL(journal).Recover(layout.NodeStore(store))
+			require.ErrorIs(t, err, trie.ErrCorruptedJournal)
+			journal.Set([]byte{0x00}, []byte{0xff})
+			_, err = trie.NewWAL(journal).Recover(layout.NodeStore(store))
+			require.ErrorIs(t, err, trie.ErrCorruptedJournal)
+			require.EqualValues(t, nodesBefore, storeContents(layout.NodeStore(store)))
+		})
+	}
+	runTest(t, trie_blake2b.New(trie.PathArity256, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity16, trie_blake2b.HashSize160))
+	runTest(t, trie_blake2b.New(trie.PathArity2, trie_blake2b.HashSize160))
+}